@@ -0,0 +1,39 @@
+/*
+ * Copyright 2021 Skyscanner Limited.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * https://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+
+	"github.com/skyscanner/turbolift/internal/actions"
+	"github.com/skyscanner/turbolift/internal/campaign"
+	"github.com/skyscanner/turbolift/internal/logging"
+)
+
+// reportToActions writes the command's step outputs and job summary for GitHub Actions
+func reportToActions(c *cobra.Command) error {
+	// the failed repositories are picked out of the campaign's
+	return actions.Report("turbolift "+c.Name(), logging.CurrentResults(), commandRepos(c))
+}
+
+// commandRepos returns the repositories the command worked on, where it has a repo file that can be reread
+func commandRepos(c *cobra.Command) []campaign.Repo {
+	if repoFile := c.Flags().Lookup("repos"); repoFile != nil && repoFile.Value.String() != campaign.StdinFilename {
+		repos, _ := campaign.ReadRepoFile(repoFile.Value.String())
+		return repos
+	}
+	return nil
+}
@@ -0,0 +1,284 @@
+/*
+ * Copyright 2021 Skyscanner Limited.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * https://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package addrepo
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+
+	"github.com/skyscanner/turbolift/internal/audit"
+	"github.com/skyscanner/turbolift/internal/campaign"
+	"github.com/skyscanner/turbolift/internal/colors"
+	"github.com/skyscanner/turbolift/internal/history"
+	"github.com/skyscanner/turbolift/internal/lock"
+	"github.com/skyscanner/turbolift/internal/logging"
+)
+
+// runTurbolift runs another turbolift command under the lock held by this one, and is swapped out in tests
+var runTurbolift = func(c *cobra.Command, args []string) error {
+	self, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("unable to find the turbolift executable: %w", err)
+	}
+	run := exec.Command(self, args...)
+	run.Stdin = os.Stdin
+	run.Stdout = c.OutOrStdout()
+	run.Stderr = c.ErrOrStderr()
+	run.Env = lock.Environ()
+	return run.Run()
+}
+
+var (
+	repoFile string
+	catchUp  bool
+)
+
+// AddedReposFilename is the repo file listing the repositories added and cloned by the latest add-repo, for running
+// further commands on them
+const AddedReposFilename = "added.txt"
+
+// catchUpCommands are the commands whose recorded runs are replayed on added repositories by --catch-up
+var catchUpCommands = map[string]bool{
+	"turbolift foreach": true,
+	"turbolift commit":  true,
+}
+
+// unreplayedFlags are not given to replayed commands, as they would select repositories other than the added ones
+var unreplayedFlags = map[string]bool{
+	"repos":               true,
+	"shard":               true,
+	"only-topic":          true,
+	"only-language":       true,
+	"skip-archived":       true,
+	"pushed-since":        true,
+	"filter-from-results": true,
+}
+
+func NewAddRepoCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "add-repo REPO...",
+		Short: "Add repositories to a campaign which is under way, and clone them",
+		Long: `Add repositories, given by their full names (e.g. org/repo), to the end of the repo file, and clone them.
+With --catch-up, the foreach and commit commands recorded in the campaign's execution history are then run again
+on the added repositories, in the order they were first run, so that they catch up with the rest of the campaign.
+The added repositories are listed in ` + AddedReposFilename + `, for running further commands on them with --repos.`,
+		Args: cobra.MinimumNArgs(1),
+		Run:  run,
+	}
+
+	cmd.Flags().StringVar(&repoFile, "repos", "repos.txt", "A file containing a list of repositories to add the repositories to.")
+	cmd.Flags().BoolVar(&catchUp, "catch-up", false, "Run the foreach and commit commands recorded in "+history.Filename+" again on the added repositories.")
+
+	return cmd
+}
+
+func run(c *cobra.Command, args []string) {
+	logger := logging.NewLogger(c)
+
+	readCampaignActivity := logger.StartSetupActivity("Reading campaign data (%s)", repoFile)
+	options := campaign.NewCampaignOptions()
+	options.RepoFilename = repoFile
+	options.Unfiltered = true
+	dir, err := campaign.OpenCampaign(options)
+	if err != nil {
+		readCampaignActivity.EndWithFailure(err)
+		return
+	}
+	var steps []history.Run
+	if catchUp {
+		if steps, err = catchUpSteps(); err != nil {
+			readCampaignActivity.EndWithFailure(err)
+			return
+		}
+	}
+	readCampaignActivity.EndWithSuccess()
+
+	listed := map[string]campaign.Repo{}
+	for _, repo := range dir.Repos {
+		listed[repo.FullRepoName] = repo
+	}
+	var toList, toClone []string
+	for _, name := range args {
+		repo, ok := listed[name]
+		if !ok {
+			toList = append(toList, name)
+			toClone = append(toClone, name)
+			continue
+		}
+		if _, err := os.Stat(repo.FullRepoPath()); os.IsNotExist(err) {
+			// listed already, e.g. by an earlier add-repo which did not finish, but not cloned yet
+			toClone = append(toClone, name)
+			continue
+		}
+		logger.Printf("%s is already in the campaign", name)
+	}
+
+	if len(toList) > 0 {
+		repoFilename := campaign.ProfileFile(repoFile)
+		addActivity := logger.StartActivity("Adding %d repositories to %s", len(toList), repoFilename)
+		if err := campaign.AddRepos(repoFilename, toList); err != nil {
+			addActivity.EndWithFailure(err)
+			return
+		}
+		addActivity.EndWithSuccess()
+	}
+	if len(toClone) == 0 {
+		logger.Successf("turbolift add-repo completed %s(%s)\n", colors.Normal(), colors.Green(0, " added"))
+		return
+	}
+
+	if err := ioutil.WriteFile(AddedReposFilename, []byte(strings.Join(toClone, "\n")+"\n"), 0o644); err != nil {
+		logger.Errorf("Unable to write %s: %v", AddedReposFilename, err)
+		return
+	}
+
+	globalFlags := givenGlobalFlags(c)
+	var failed []string
+	commands := [][]string{commandArgs(c, "turbolift clone", nil, globalFlags)}
+	for _, step := range steps {
+		commands = append(commands, commandArgs(c, step.Command, step.Args, mergeFlags(globalFlags, step.Flags)))
+	}
+	for _, commandLine := range commands {
+		logger.Printf("Running %s", colors.Cyan("turbolift ", strings.Join(commandLine, " ")))
+		if err := runTurbolift(c, commandLine); err != nil {
+			failed = append(failed, strings.Join(commandLine, " "))
+		}
+	}
+
+	if len(failed) == 0 {
+		logger.Successf("turbolift add-repo completed %s(%s, %s)\n", colors.Normal(), colors.Green(len(toClone), " added"), colors.Green(len(steps), " steps replayed"))
+	} else {
+		logger.Warnf("turbolift add-repo completed with %s %s(%s, %s, %s)\n", colors.Red("errors"), colors.Normal(), colors.Green(len(toClone), " added"), colors.Green(len(steps), " steps replayed"), colors.Red(len(failed), " commands failed"))
+		logger.Println("These commands failed for some of the added repositories:")
+		for _, command := range failed {
+			logger.Println("   turbolift", command)
+		}
+		logger.Printf("To retry them, use %s", colors.Cyan("--repos ", AddedReposFilename))
+	}
+}
+
+// catchUpSteps returns the recorded runs to replay on the added repositories: those of the catch-up commands which
+// succeeded for at least one repository
+func catchUpSteps() ([]history.Run, error) {
+	filename := campaign.StatePath(history.Filename)
+	runs, err := history.Read(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	var steps []history.Run
+	for _, run := range runs {
+		if !catchUpCommands[run.Command] || run.Totals.Succeeded == 0 {
+			continue
+		}
+		for _, arg := range run.Args {
+			if audit.IsRedacted(arg) {
+				return nil, fmt.Errorf("the %s recorded in %s at %s cannot be replayed, as some of its arguments were redacted", run.Command, filename, run.Timestamp.Format("2006-01-02 15:04:05"))
+			}
+		}
+		for _, value := range run.Flags {
+			if audit.IsRedacted(value) {
+				return nil, fmt.Errorf("the %s recorded in %s at %s cannot be replayed, as some of its flags were redacted", run.Command, filename, run.Timestamp.Format("2006-01-02 15:04:05"))
+			}
+		}
+		steps = append(steps, run)
+	}
+	return steps, nil
+}
+
+// givenGlobalFlags returns the global flags given to this command, such as --profile, to give to the commands it runs
+func givenGlobalFlags(c *cobra.Command) map[string]string {
+	given := map[string]string{}
+	record := func(f *pflag.Flag) {
+		if c.Root().PersistentFlags().Lookup(f.Name) != nil {
+			given[f.Name] = f.Value.String()
+		}
+	}
+	// global flags given before the command's name are parsed by the root command
+	c.Root().Flags().Visit(record)
+	c.Flags().Visit(record)
+	return given
+}
+
+// mergeFlags returns the flags with those recorded for a step taking precedence
+func mergeFlags(flags map[string]string, recorded map[string]string) map[string]string {
+	merged := map[string]string{}
+	for name, value := range flags {
+		merged[name] = value
+	}
+	for name, value := range recorded {
+		merged[name] = value
+	}
+	return merged
+}
+
+// commandArgs returns the arguments to run a command (e.g. "turbolift foreach") with the given flags and arguments on
+// the added repositories. Global flags are given before the command's name, as foreach parses its own flags.
+func commandArgs(c *cobra.Command, command string, args []string, flags map[string]string) []string {
+	var names []string
+	for name := range flags {
+		if !unreplayedFlags[name] {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	var global, local []string
+	for _, name := range names {
+		arg := fmt.Sprintf("--%s=%s", name, flags[name])
+		if c.Root().PersistentFlags().Lookup(name) != nil {
+			global = append(global, arg)
+		} else {
+			local = append(local, arg)
+		}
+	}
+
+	result := append(global, strings.Fields(command)[1:]...)
+	result = append(result, local...)
+	result = append(result, "--repos", AddedReposFilename)
+	return append(result, withoutRepoSelection(args)...)
+}
+
+// withoutRepoSelection removes the flags which select repositories, such as --repos, from the arguments of foreach,
+// which parses its own flags, leaving the command it runs untouched
+func withoutRepoSelection(args []string) []string {
+	var result []string
+	for i := 0; i < len(args); i++ {
+		if args[i] == "--" || !strings.HasPrefix(args[i], "--") {
+			// the command which foreach runs
+			return append(result, args[i:]...)
+		}
+		if unreplayedFlags[strings.TrimPrefix(args[i], "--")] {
+			// foreach's flags which select repositories all take a value
+			i++
+			continue
+		}
+		result = append(result, args[i])
+		if i+1 < len(args) && !strings.HasPrefix(args[i+1], "-") {
+			// the flag's value, if it takes one
+			i++
+			result = append(result, args[i])
+		}
+	}
+	return result
+}
@@ -0,0 +1,148 @@
+/*
+ * Copyright 2021 Skyscanner Limited.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * https://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package addrepo
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/skyscanner/turbolift/internal/history"
+	"github.com/skyscanner/turbolift/internal/testsupport"
+)
+
+func init() {
+	// disable output colouring so that strings we want to do 'Contains' checks on do not have ANSI escape sequences in IDEs
+	_ = os.Setenv("NO_COLOR", "1")
+}
+
+func TestItAddsAndClonesRepos(t *testing.T) {
+	calls := fakeRunTurbolift(nil)
+	testsupport.PrepareTempCampaign(true, "org/repo1")
+
+	out, err := runCommand("org/repo2", "org/repo3")
+	assert.NoError(t, err)
+	assert.Contains(t, out, "turbolift add-repo completed (2 added, 0 steps replayed)")
+
+	contents, err := ioutil.ReadFile("repos.txt")
+	assert.NoError(t, err)
+	assert.Equal(t, "org/repo1\norg/repo2\norg/repo3\n", string(contents))
+	added, err := ioutil.ReadFile(AddedReposFilename)
+	assert.NoError(t, err)
+	assert.Equal(t, "org/repo2\norg/repo3\n", string(added))
+
+	assert.Equal(t, [][]string{
+		{"clone", "--repos", AddedReposFilename},
+	}, *calls)
+}
+
+func TestItSkipsReposAlreadyInTheCampaign(t *testing.T) {
+	calls := fakeRunTurbolift(nil)
+	testsupport.PrepareTempCampaign(true, "org/repo1")
+
+	out, err := runCommand("org/repo1")
+	assert.NoError(t, err)
+	assert.Contains(t, out, "org/repo1 is already in the campaign")
+	assert.Contains(t, out, "turbolift add-repo completed (0 added)")
+	assert.Empty(t, *calls)
+}
+
+func TestItReplaysRecordedStepsToCatchUp(t *testing.T) {
+	calls := fakeRunTurbolift(nil)
+	testsupport.PrepareTempCampaign(true, "org/repo1")
+	recordRuns(t,
+		history.Run{Command: "turbolift clone", Totals: history.Totals{Succeeded: 1}},
+		history.Run{Command: "turbolift foreach", Args: []string{"--repos", "repos.txt", "--shell", "bash", "sed", "-i", "s/a/b/", "go.mod"}, Flags: map[string]string{"profile": "phase-2"}, Totals: history.Totals{Succeeded: 1}},
+		history.Run{Command: "turbolift foreach", Args: []string{"false"}, Totals: history.Totals{Failed: 1}},
+		history.Run{Command: "turbolift commit", Flags: map[string]string{"message": "Upgrade", "shard": "1/2"}, Totals: history.Totals{Succeeded: 1}},
+	)
+
+	out, err := runCommand("--catch-up", "org/repo2")
+	assert.NoError(t, err)
+	assert.Contains(t, out, "turbolift add-repo completed (1 added, 2 steps replayed)")
+
+	assert.Equal(t, [][]string{
+		{"clone", "--repos", AddedReposFilename},
+		{"--profile=phase-2", "foreach", "--repos", AddedReposFilename, "--shell", "bash", "sed", "-i", "s/a/b/", "go.mod"},
+		{"commit", "--message=Upgrade", "--repos", AddedReposFilename},
+	}, *calls)
+}
+
+func TestItDoesNotReplayRedactedSteps(t *testing.T) {
+	calls := fakeRunTurbolift(nil)
+	testsupport.PrepareTempCampaign(true, "org/repo1")
+	recordRuns(t,
+		history.Run{Command: "turbolift foreach", Args: []string{"curl", "-H", "Authorization: [REDACTED]"}, Totals: history.Totals{Succeeded: 1}},
+	)
+
+	out, err := runCommand("--catch-up", "org/repo2")
+	assert.NoError(t, err)
+	assert.Contains(t, out, "cannot be replayed, as some of its arguments were redacted")
+	assert.Empty(t, *calls)
+
+	contents, err := ioutil.ReadFile("repos.txt")
+	assert.NoError(t, err)
+	assert.Equal(t, "org/repo1", string(contents))
+}
+
+func TestItReportsCommandsWhichFailed(t *testing.T) {
+	fakeRunTurbolift(errors.New("exit status 3"))
+	testsupport.PrepareTempCampaign(true, "org/repo1")
+
+	out, err := runCommand("org/repo2")
+	assert.NoError(t, err)
+	assert.Contains(t, out, "turbolift add-repo completed with errors (1 added, 0 steps replayed, 1 commands failed)")
+	assert.Contains(t, out, "turbolift clone --repos added.txt")
+}
+
+func fakeRunTurbolift(err error) *[][]string {
+	var calls [][]string
+	runTurbolift = func(_ *cobra.Command, args []string) error {
+		calls = append(calls, args)
+		return err
+	}
+	return &calls
+}
+
+func recordRuns(t *testing.T, runs ...history.Run) {
+	for _, run := range runs {
+		run.Timestamp = time.Now()
+		assert.NoError(t, history.Append(history.Filename, run))
+	}
+}
+
+func runCommand(args ...string) (string, error) {
+	// global flags are those of the root command
+	root := &cobra.Command{Use: "turbolift"}
+	root.PersistentFlags().String("profile", "", "")
+	cmd := NewAddRepoCmd()
+	root.AddCommand(cmd)
+	catchUp = false
+	root.SetArgs(append([]string{"add-repo"}, args...))
+	outBuffer := bytes.NewBufferString("")
+	root.SetOut(outBuffer)
+	err := root.Execute()
+	if err != nil {
+		return outBuffer.String(), err
+	}
+	return outBuffer.String(), nil
+}
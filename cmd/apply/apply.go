@@ -0,0 +1,113 @@
+/*
+ * Copyright 2021 Skyscanner Limited.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * https://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package apply
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+
+	"github.com/skyscanner/turbolift/internal/campaign"
+	"github.com/skyscanner/turbolift/internal/colors"
+	"github.com/skyscanner/turbolift/internal/git"
+	"github.com/skyscanner/turbolift/internal/interrupt"
+	"github.com/skyscanner/turbolift/internal/logging"
+)
+
+var g git.Git = git.NewRealGit()
+
+var repoFile string
+
+func NewApplyCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "apply PATCH_FILE",
+		Short: "Apply a patch to every repository",
+		Long: `Apply a unified diff to each working copy. Where the patch does not apply cleanly, a three-way merge is
+attempted; repositories where that also fails are left with conflict markers and listed as needing manual attention.`,
+		Args: cobra.ExactArgs(1),
+		Run:  run,
+	}
+
+	cmd.Flags().StringVar(&repoFile, "repos", "repos.txt", "A file containing a list of repositories to apply the patch to.")
+
+	return cmd
+}
+
+func run(c *cobra.Command, args []string) {
+	logger := logging.NewLogger(c)
+
+	readCampaignActivity := logger.StartSetupActivity("Reading campaign data (%s)", repoFile)
+	options := campaign.NewCampaignOptions()
+	options.RepoFilename = repoFile
+	dir, err := campaign.OpenCampaign(options)
+	if err != nil {
+		readCampaignActivity.EndWithFailure(err)
+		return
+	}
+	// the patch is applied from within each working copy
+	patchFile, err := filepath.Abs(args[0])
+	if err == nil {
+		_, err = os.Stat(patchFile)
+	}
+	if err != nil {
+		readCampaignActivity.EndWithFailure(fmt.Errorf("unable to read patch file: %w", err))
+		return
+	}
+	readCampaignActivity.EndWithSuccess()
+
+	var needsAttention []string
+	cleanCount := 0
+	mergedCount := 0
+	skippedCount := 0
+	interrupt.ForEachRepo(logger, dir.Repos, func(repo campaign.Repo) {
+		repoDirPath := repo.FullRepoPath()
+
+		applyActivity := logger.StartActivity("Applying %s to %s", filepath.Base(patchFile), repo.FullRepoName)
+		// skip if the working copy does not exist
+		if _, err = os.Stat(repoDirPath); os.IsNotExist(err) {
+			applyActivity.EndWithWarningf("Directory %s does not exist - has it been cloned?", repoDirPath)
+			skippedCount++
+			return
+		}
+
+		if err := g.Apply(applyActivity.Writer(), repoDirPath, patchFile, false); err == nil {
+			applyActivity.EndWithSuccess()
+			cleanCount++
+			return
+		}
+
+		applyActivity.Log("The patch does not apply cleanly - attempting a three-way merge")
+		if err := g.Apply(applyActivity.Writer(), repoDirPath, patchFile, true); err != nil {
+			applyActivity.EndWithFailure(err)
+			needsAttention = append(needsAttention, repo.FullRepoName)
+			return
+		}
+		applyActivity.EndWithWarning("Applied using a three-way merge")
+		mergedCount++
+	})
+
+	if len(needsAttention) == 0 {
+		logger.Successf("turbolift apply completed %s(%s, %s, %s)\n", colors.Normal(), colors.Green(cleanCount, " applied cleanly"), colors.Yellow(mergedCount, " merged"), colors.Yellow(skippedCount, " skipped"))
+	} else {
+		logger.Warnf("turbolift apply completed with %s %s(%s, %s, %s, %s)\n", colors.Red("errors"), colors.Normal(), colors.Green(cleanCount, " applied cleanly"), colors.Yellow(mergedCount, " merged"), colors.Yellow(skippedCount, " skipped"), colors.Red(len(needsAttention), " need manual attention"))
+		logger.Println("These repositories need manual attention:")
+		for _, repoName := range needsAttention {
+			logger.Println("  ", repoName)
+		}
+	}
+}
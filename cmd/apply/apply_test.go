@@ -0,0 +1,111 @@
+/*
+ * Copyright 2021 Skyscanner Limited.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * https://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package apply
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/skyscanner/turbolift/internal/git"
+	"github.com/skyscanner/turbolift/internal/testsupport"
+)
+
+func init() {
+	// disable output colouring so that strings we want to do 'Contains' checks on do not have ANSI escape sequences in IDEs
+	_ = os.Setenv("NO_COLOR", "1")
+}
+
+func TestItAppliesPatchesCleanly(t *testing.T) {
+	fakeGit := git.NewAlwaysSucceedsFakeGit()
+	g = fakeGit
+
+	testsupport.PrepareTempCampaign(true, "org/repo1", "org/repo2")
+	patchFile := createPatch()
+
+	out, err := runCommand("change.patch")
+	assert.NoError(t, err)
+	assert.Contains(t, out, "Applying change.patch to org/repo1")
+	assert.Contains(t, out, "turbolift apply completed (2 applied cleanly, 0 merged, 0 skipped)")
+
+	cwd, _ := os.Getwd()
+	patchPath := filepath.Join(cwd, patchFile)
+	fakeGit.AssertCalledWith(t, [][]string{
+		{"apply", "work/org/repo1", patchPath},
+		{"apply", "work/org/repo2", patchPath},
+	})
+}
+
+func TestItFallsBackToAThreeWayMerge(t *testing.T) {
+	fakeGit := git.NewFakeGit(func(_ io.Writer, call []string) (bool, error) {
+		if call[1] == "--3way" && call[2] == "work/org/repo2" {
+			return false, errors.New("synthetic error")
+		}
+		if call[1] != "--3way" {
+			return false, errors.New("synthetic error")
+		}
+		return true, nil
+	})
+	g = fakeGit
+
+	testsupport.PrepareTempCampaign(true, "org/repo1", "org/repo2")
+	createPatch()
+
+	out, err := runCommand("change.patch")
+	assert.NoError(t, err)
+	assert.Contains(t, out, "Applied using a three-way merge")
+	assert.Contains(t, out, "turbolift apply completed with errors (0 applied cleanly, 1 merged, 0 skipped, 1 need manual attention)")
+	assert.Contains(t, out, "These repositories need manual attention:\n   org/repo2")
+}
+
+func TestItRequiresAnExistingPatchFile(t *testing.T) {
+	fakeGit := git.NewAlwaysSucceedsFakeGit()
+	g = fakeGit
+
+	testsupport.PrepareTempCampaign(true, "org/repo1")
+
+	out, err := runCommand("missing.patch")
+	assert.NoError(t, err)
+	assert.Contains(t, out, "unable to read patch file")
+
+	fakeGit.AssertCalledWith(t, [][]string{})
+}
+
+func createPatch() string {
+	err := ioutil.WriteFile("change.patch", []byte("--- a/README.md\n+++ b/README.md\n@@ -1 +1 @@\n-old\n+new\n"), 0o644)
+	if err != nil {
+		panic(err)
+	}
+	return "change.patch"
+}
+
+func runCommand(args ...string) (string, error) {
+	cmd := NewApplyCmd()
+	cmd.SetArgs(args)
+	outBuffer := bytes.NewBufferString("")
+	cmd.SetOut(outBuffer)
+	err := cmd.Execute()
+	if err != nil {
+		return outBuffer.String(), err
+	}
+	return outBuffer.String(), nil
+}
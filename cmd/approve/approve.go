@@ -0,0 +1,169 @@
+/*
+ * Copyright 2021 Skyscanner Limited.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * https://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package approve
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"text/template"
+
+	"github.com/spf13/cobra"
+
+	"github.com/skyscanner/turbolift/internal/campaign"
+	"github.com/skyscanner/turbolift/internal/colors"
+	"github.com/skyscanner/turbolift/internal/github"
+	"github.com/skyscanner/turbolift/internal/interrupt"
+	"github.com/skyscanner/turbolift/internal/logging"
+	"github.com/skyscanner/turbolift/internal/prompt"
+)
+
+var (
+	gh github.GitHub = github.NewCachingGitHub(github.NewGitHub())
+	p  prompt.Prompt = prompt.NewRealPrompt()
+)
+
+var (
+	repoFile     string
+	body         string
+	bodyTemplate string
+	commentOnly  bool
+)
+
+func NewApproveCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "approve",
+		Short: "Approve the campaign's open PRs, optionally with a review body rendered for each repository",
+		Long: `Leave an approving review on each of the campaign's open PRs. The review body can be given directly, or as a
+template file which can refer to {{.Campaign}}, {{.FullRepoName}}, {{.OrgName}} and {{.RepoName}}.
+With --comment-only, the review only comments rather than approving.`,
+		Args: cobra.NoArgs,
+		Run:  run,
+	}
+
+	cmd.Flags().StringVar(&repoFile, "repos", "repos.txt", "A file containing a list of repositories whose PRs to approve.")
+	cmd.Flags().StringVar(&body, "body", "", "The body of each review.")
+	cmd.Flags().StringVar(&bodyTemplate, "body-template", "", "A file containing a template for the body of each review.")
+	cmd.Flags().BoolVar(&commentOnly, "comment-only", false, "Leave the review as a comment, rather than approving.")
+
+	return cmd
+}
+
+func validateFlags() error {
+	if body != "" && bodyTemplate != "" {
+		return errors.New("only one of --body and --body-template can be given")
+	}
+	if commentOnly && body == "" && bodyTemplate == "" {
+		return errors.New("--comment-only needs a review body, from --body or --body-template")
+	}
+	return nil
+}
+
+func run(c *cobra.Command, _ []string) {
+	logger := logging.NewLogger(c)
+	if err := validateFlags(); err != nil {
+		logger.FlagErrorf("%v", err)
+		return
+	}
+
+	readCampaignActivity := logger.StartSetupActivity("Reading campaign data (%s)", repoFile)
+	options := campaign.NewCampaignOptions()
+	options.RepoFilename = repoFile
+	dir, err := campaign.OpenCampaign(options)
+	if err != nil {
+		readCampaignActivity.EndWithFailure(err)
+		return
+	}
+	var tmpl *template.Template
+	if bodyTemplate != "" {
+		if tmpl, err = campaign.ReadTemplateFile(bodyTemplate, "review template"); err != nil {
+			readCampaignActivity.EndWithFailure(err)
+			return
+		}
+	}
+	readCampaignActivity.EndWithSuccess()
+
+	action := "Approve"
+	if commentOnly {
+		action = "Comment on"
+	}
+
+	// Prompting for confirmation
+	if !prompt.AssumeYes() {
+		if !p.AskConfirm(prompt.Approve, fmt.Sprintf("%s all open PRs from the %s campaign?", action, dir.Name)) {
+			return
+		}
+	}
+
+	var doneCount, skippedCount, errorCount int
+	interrupt.ForEachRepo(logger, dir.Repos, func(repo campaign.Repo) {
+		repoDirPath := repo.FullRepoPath()
+
+		reviewActivity := logger.StartActivity("Reviewing PR in %s", repo.FullRepoName)
+		// skip if the working copy does not exist
+		if _, err = os.Stat(repoDirPath); os.IsNotExist(err) {
+			reviewActivity.EndWithWarningf("Directory %s does not exist - has it been cloned?", repoDirPath)
+			skippedCount++
+			return
+		}
+
+		pr, err := gh.GetPR(reviewActivity.Writer(), repoDirPath, dir.Name)
+		if err != nil {
+			if _, ok := err.(*github.NoPRFoundError); ok {
+				reviewActivity.EndWithWarning(err)
+				skippedCount++
+			} else {
+				reviewActivity.EndWithFailure(err)
+				errorCount++
+			}
+			return
+		}
+		if pr.State != "OPEN" {
+			reviewActivity.EndWithWarningf("PR is %s", strings.ToLower(pr.State))
+			skippedCount++
+			return
+		}
+
+		reviewBody := body
+		if tmpl != nil {
+			if reviewBody, err = campaign.RenderTemplate(tmpl, campaign.NewTemplateData(dir, repo)); err != nil {
+				reviewActivity.EndWithFailure(err)
+				errorCount++
+				return
+			}
+			reviewBody = strings.TrimSpace(reviewBody)
+		}
+
+		if err := gh.ReviewPullRequest(reviewActivity.Writer(), repoDirPath, dir.Name, !commentOnly, reviewBody); err != nil {
+			reviewActivity.EndWithFailure(err)
+			errorCount++
+			return
+		}
+		reviewActivity.EndWithSuccess()
+		doneCount++
+	})
+
+	doneLabel := " approved"
+	if commentOnly {
+		doneLabel = " commented on"
+	}
+	if errorCount == 0 {
+		logger.Successf("turbolift approve completed %s(%s, %s)\n", colors.Normal(), colors.Green(doneCount, doneLabel), colors.Yellow(skippedCount, " skipped"))
+	} else {
+		logger.Warnf("turbolift approve completed with %s %s(%s, %s, %s)\n", colors.Red("errors"), colors.Normal(), colors.Green(doneCount, doneLabel), colors.Yellow(skippedCount, " skipped"), colors.Red(errorCount, " errored"))
+	}
+}
@@ -0,0 +1,147 @@
+/*
+ * Copyright 2021 Skyscanner Limited.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * https://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package approve
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/skyscanner/turbolift/internal/github"
+	"github.com/skyscanner/turbolift/internal/prompt"
+	"github.com/skyscanner/turbolift/internal/testsupport"
+)
+
+func init() {
+	// disable output colouring so that strings we want to do 'Contains' checks on do not have ANSI escape sequences in IDEs
+	_ = os.Setenv("NO_COLOR", "1")
+}
+
+// fakeGitHubWithPRs has an open PR in repo1 and repo3, and a merged PR in repo2
+func fakeGitHubWithPRs() *github.FakeGitHub {
+	return github.NewFakeGitHub(func(github.Command, []string) (bool, error) {
+		return true, nil
+	}, func(workingDir string) (interface{}, error) {
+		if workingDir == "work/org/repo2" {
+			return &github.PrStatus{State: "MERGED"}, nil
+		}
+		return &github.PrStatus{State: "OPEN"}, nil
+	})
+}
+
+func TestItApprovesOpenPRs(t *testing.T) {
+	fakeGitHub := fakeGitHubWithPRs()
+	gh = fakeGitHub
+	p = prompt.NewFakePromptYes()
+
+	testsupport.PrepareTempCampaign(true, "org/repo1", "org/repo2")
+
+	out, err := runCommand("--body", "LGTM")
+	assert.NoError(t, err)
+	assert.Contains(t, out, "PR is merged")
+	assert.Contains(t, out, "turbolift approve completed (1 approved, 1 skipped)")
+
+	fakeGitHub.AssertCalledWith(t, [][]string{
+		{"work/org/repo1"},
+		{"work/org/repo1", testsupport.Pwd(), "APPROVE", "LGTM"},
+		{"work/org/repo2"},
+	})
+}
+
+func TestItRendersTheReviewBodyForEachRepo(t *testing.T) {
+	fakeGitHub := fakeGitHubWithPRs()
+	gh = fakeGitHub
+	p = prompt.NewFakePromptYes()
+
+	testsupport.PrepareTempCampaign(true, "org/repo1", "org/repo3")
+	err := ioutil.WriteFile("review.md", []byte("See https://example.com/migration#{{.RepoName}}\n"), 0o644)
+	assert.NoError(t, err)
+
+	out, err := runCommand("--body-template", "review.md", "--comment-only")
+	assert.NoError(t, err)
+	assert.Contains(t, out, "turbolift approve completed (2 commented on, 0 skipped)")
+
+	fakeGitHub.AssertCalledWith(t, [][]string{
+		{"work/org/repo1"},
+		{"work/org/repo1", testsupport.Pwd(), "COMMENT", "See https://example.com/migration#repo1"},
+		{"work/org/repo3"},
+		{"work/org/repo3", testsupport.Pwd(), "COMMENT", "See https://example.com/migration#repo3"},
+	})
+}
+
+func TestItDoesNotApproveIfNotConfirmed(t *testing.T) {
+	fakeGitHub := fakeGitHubWithPRs()
+	gh = fakeGitHub
+	p = prompt.NewFakePromptNo()
+
+	testsupport.PrepareTempCampaign(true, "org/repo1")
+
+	out, err := runCommand()
+	assert.NoError(t, err)
+	assert.NotContains(t, out, "turbolift approve completed")
+
+	fakeGitHub.AssertCalledWith(t, [][]string{})
+}
+
+func TestItRejectsInvalidFlags(t *testing.T) {
+	testCases := []struct {
+		Name          string
+		Args          []string
+		ExpectedError string
+	}{
+		{
+			Name:          "body and body template",
+			Args:          []string{"--body", "LGTM", "--body-template", "review.md"},
+			ExpectedError: "only one of --body and --body-template can be given",
+		},
+		{
+			Name:          "comment only without a body",
+			Args:          []string{"--comment-only"},
+			ExpectedError: "--comment-only needs a review body, from --body or --body-template",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			fakeGitHub := fakeGitHubWithPRs()
+			gh = fakeGitHub
+			p = prompt.NewFakePromptYes()
+
+			testsupport.PrepareTempCampaign(true, "org/repo1")
+
+			out, err := runCommand(tc.Args...)
+			assert.NoError(t, err)
+			assert.Contains(t, out, tc.ExpectedError)
+
+			fakeGitHub.AssertCalledWith(t, [][]string{})
+		})
+	}
+}
+
+func runCommand(args ...string) (string, error) {
+	cmd := NewApproveCmd()
+	cmd.SetArgs(args)
+	outBuffer := bytes.NewBufferString("")
+	cmd.SetOut(outBuffer)
+	err := cmd.Execute()
+	if err != nil {
+		return outBuffer.String(), err
+	}
+	return outBuffer.String(), nil
+}
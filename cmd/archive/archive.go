@@ -0,0 +1,191 @@
+/*
+ * Copyright 2021 Skyscanner Limited.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * https://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package archive
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/skyscanner/turbolift/internal/campaign"
+	"github.com/skyscanner/turbolift/internal/colors"
+	"github.com/skyscanner/turbolift/internal/git"
+	"github.com/skyscanner/turbolift/internal/github"
+	"github.com/skyscanner/turbolift/internal/interrupt"
+	"github.com/skyscanner/turbolift/internal/logging"
+	"github.com/skyscanner/turbolift/internal/prompt"
+	"github.com/skyscanner/turbolift/internal/worktrees"
+)
+
+var (
+	// gh is not cached, so that the final states of the PRs are recorded as they are now
+	gh github.GitHub = github.NewGitHub()
+	g  git.Git       = git.NewRealGit()
+	p  prompt.Prompt = prompt.NewRealPrompt()
+)
+
+var now = time.Now
+
+var (
+	repoFile string
+	keepWork bool
+)
+
+// finalState is the state of a repository's PR when the campaign was archived
+type finalState struct {
+	repo  string
+	state string
+	url   string
+}
+
+func NewArchiveCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "archive",
+		Short: "Record the final state of the campaign's PRs and close out the campaign",
+		Long: fmt.Sprintf(`Record the final state of every PR in the campaign in %s, remove the working copies
+and mark the campaign as archived, after which other turbolift commands will refuse to operate on it.`, campaign.ArchivedFilename),
+		Run: run,
+	}
+
+	cmd.Flags().StringVar(&repoFile, "repos", "repos.txt", "A file containing a list of repositories to archive the campaign for.")
+	cmd.Flags().BoolVar(&keepWork, "keep-work", false, "Keep the working copies in the work directory rather than removing them.")
+
+	return cmd
+}
+
+func run(c *cobra.Command, _ []string) {
+	logger := logging.NewLogger(c)
+
+	readCampaignActivity := logger.StartSetupActivity("Reading campaign data (%s)", repoFile)
+	options := campaign.NewCampaignOptions()
+	options.RepoFilename = repoFile
+	dir, err := campaign.OpenCampaign(options)
+	if err != nil {
+		readCampaignActivity.EndWithFailure(err)
+		return
+	}
+	readCampaignActivity.EndWithSuccess()
+
+	var states []finalState
+	errorCount := 0
+	interrupt.ForEachRepo(logger, dir.Repos, func(repo campaign.Repo) {
+		repoDirPath := repo.FullRepoPath()
+
+		checkActivity := logger.StartActivity("Recording final PR state for %s", repo.FullRepoName)
+		// a repo which was never cloned has no PR to record
+		if _, err = os.Stat(repoDirPath); os.IsNotExist(err) {
+			checkActivity.EndWithWarningf("Directory %s does not exist - has it been cloned?", repoDirPath)
+			states = append(states, finalState{repo: repo.FullRepoName, state: "NOT CLONED"})
+			return
+		}
+
+		pr, err := gh.GetPR(checkActivity.Writer(), repoDirPath, dir.Name)
+		var noPRFoundError *github.NoPRFoundError
+		if errors.As(err, &noPRFoundError) {
+			checkActivity.EndWithWarning(err)
+			states = append(states, finalState{repo: repo.FullRepoName, state: "NO PR"})
+			return
+		}
+		if err != nil {
+			checkActivity.EndWithFailure(err)
+			errorCount++
+			return
+		}
+		checkActivity.EndWithSuccess()
+		states = append(states, finalState{repo: repo.FullRepoName, state: pr.State, url: pr.Url})
+	})
+
+	if errorCount > 0 {
+		logger.Warnf("turbolift archive %s: the state of %d PRs could not be recorded, so the campaign has not been archived\n", colors.Red("failed"), errorCount)
+		return
+	}
+
+	if !keepWork {
+		if _, err := os.Stat(campaign.WorkDir()); err == nil {
+			if !p.AskConfirm(prompt.RemoveWorkingCopies, fmt.Sprintf("Remove all working copies in the %s directory, including any changes which have not been pushed?", campaign.WorkDir())) {
+				logger.Warnf("turbolift archive cancelled - use --keep-work to archive without removing the working copies\n")
+				return
+			}
+			removeActivity := logger.StartActivity("Removing working copies")
+			// working copies added to shared clones are removed one by one first, for the shared clones to forget them
+			for _, repo := range dir.Repos {
+				_ = worktrees.RemoveWorkingCopy(removeActivity.Writer(), g, repo.FullRepoPath())
+			}
+			if err := os.RemoveAll(campaign.WorkDir()); err != nil {
+				removeActivity.EndWithFailure(err)
+				return
+			}
+			_ = os.RemoveAll(".turbolift-cache")
+			removeActivity.EndWithSuccess()
+		}
+	}
+
+	archiveActivity := logger.StartActivity("Writing %s", campaign.ArchivedFilename)
+	if err := ioutil.WriteFile(campaign.ArchivedFilename, []byte(report(dir, states)), 0o644); err != nil {
+		archiveActivity.EndWithFailure(err)
+		return
+	}
+	archiveActivity.EndWithSuccess()
+
+	logger.Successf("turbolift archive completed - campaign %s is archived %s(%s)\n", dir.Name, colors.Normal(), summary(states))
+}
+
+func countStates(states []finalState) ([]string, map[string]int) {
+	var order []string
+	counts := map[string]int{}
+	for _, s := range states {
+		if counts[s.state] == 0 {
+			order = append(order, s.state)
+		}
+		counts[s.state]++
+	}
+	return order, counts
+}
+
+func summary(states []finalState) string {
+	order, counts := countStates(states)
+	var parts []string
+	for _, state := range order {
+		parts = append(parts, fmt.Sprintf("%d %s", counts[state], strings.ToLower(state)))
+	}
+	return strings.Join(parts, ", ")
+}
+
+func report(dir *campaign.Campaign, states []finalState) string {
+	sb := strings.Builder{}
+	_, _ = fmt.Fprintf(&sb, "# Archived campaign: %s\n\n", dir.Name)
+	_, _ = fmt.Fprintf(&sb, "Archived on %s.\n\n", now().Format("2006-01-02"))
+	_, _ = fmt.Fprintf(&sb, "PR title: %s\n\n", dir.PrTitle)
+
+	sb.WriteString("## Summary\n\n")
+	order, counts := countStates(states)
+	for _, state := range order {
+		_, _ = fmt.Fprintf(&sb, "* %s: %d\n", state, counts[state])
+	}
+
+	sb.WriteString("\n## Repositories\n\n")
+	sb.WriteString("| Repository | PR state | PR |\n")
+	sb.WriteString("|---|---|---|\n")
+	for _, s := range states {
+		_, _ = fmt.Fprintf(&sb, "| %s | %s | %s |\n", s.repo, s.state, s.url)
+	}
+	return sb.String()
+}
@@ -0,0 +1,142 @@
+/*
+ * Copyright 2021 Skyscanner Limited.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * https://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package archive
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/skyscanner/turbolift/internal/campaign"
+	"github.com/skyscanner/turbolift/internal/github"
+	"github.com/skyscanner/turbolift/internal/prompt"
+	"github.com/skyscanner/turbolift/internal/testsupport"
+)
+
+func init() {
+	// disable output colouring so that strings we want to do 'Contains' checks on do not have ANSI escape sequences in IDEs
+	_ = os.Setenv("NO_COLOR", "1")
+	now = func() time.Time {
+		return time.Date(2021, 10, 1, 12, 0, 0, 0, time.UTC)
+	}
+}
+
+func TestItRecordsFinalStatesAndRemovesWorkingCopies(t *testing.T) {
+	prepareFakeGitHub()
+	p = prompt.NewFakePromptYes()
+
+	testsupport.PrepareTempCampaign(true, "org/repo1", "org/repo2", "org/repo3")
+
+	out, err := runCommand(false)
+	assert.NoError(t, err)
+	assert.Contains(t, out, "Recording final PR state for org/repo1")
+	assert.Contains(t, out, "turbolift archive completed")
+	assert.Contains(t, out, "1 merged, 1 closed, 1 no pr")
+
+	report, err := ioutil.ReadFile(campaign.ArchivedFilename)
+	assert.NoError(t, err)
+	assert.Contains(t, string(report), "# Archived campaign: "+testsupport.Pwd())
+	assert.Contains(t, string(report), "Archived on 2021-10-01.")
+	assert.Contains(t, string(report), "PR title: PR title")
+	assert.Contains(t, string(report), "* MERGED: 1\n")
+	assert.Contains(t, string(report), "| org/repo1 | MERGED | https://github.com/org/repo1/pull/1 |\n")
+	assert.Contains(t, string(report), "| org/repo3 | NO PR |  |\n")
+
+	_, err = os.Stat("work")
+	assert.True(t, os.IsNotExist(err))
+
+	out, err = runCommand(false)
+	assert.NoError(t, err)
+	assert.Contains(t, out, "has been archived")
+}
+
+func TestItKeepsWorkingCopiesWhenAsked(t *testing.T) {
+	prepareFakeGitHub()
+	p = prompt.NewFakePromptNo()
+
+	testsupport.PrepareTempCampaign(true, "org/repo1")
+
+	_, err := runCommand(true)
+	assert.NoError(t, err)
+
+	_, err = os.Stat(campaign.ArchivedFilename)
+	assert.NoError(t, err)
+	_, err = os.Stat("work/org/repo1")
+	assert.NoError(t, err)
+}
+
+func TestItDoesNotArchiveWhenRemovingWorkingCopiesIsDeclined(t *testing.T) {
+	prepareFakeGitHub()
+	p = prompt.NewFakePromptNo()
+
+	testsupport.PrepareTempCampaign(true, "org/repo1")
+
+	out, err := runCommand(false)
+	assert.NoError(t, err)
+	assert.Contains(t, out, "turbolift archive cancelled")
+
+	_, err = os.Stat(campaign.ArchivedFilename)
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestItDoesNotArchiveWhenPRStatesCannotBeRecorded(t *testing.T) {
+	prepareFakeGitHub()
+	p = prompt.NewFakePromptYes()
+
+	testsupport.PrepareTempCampaign(true, "org/repo1", "org/repoWithError")
+
+	out, err := runCommand(false)
+	assert.NoError(t, err)
+	assert.Contains(t, out, "the state of 1 PRs could not be recorded")
+
+	_, err = os.Stat(campaign.ArchivedFilename)
+	assert.True(t, os.IsNotExist(err))
+	_, err = os.Stat("work/org/repo1")
+	assert.NoError(t, err)
+}
+
+func runCommand(keep bool) (string, error) {
+	cmd := NewArchiveCmd()
+	keepWork = keep
+	outBuffer := bytes.NewBufferString("")
+	cmd.SetOut(outBuffer)
+	err := cmd.Execute()
+	if err != nil {
+		return outBuffer.String(), err
+	}
+	return outBuffer.String(), nil
+}
+
+func prepareFakeGitHub() {
+	prs := map[string]*github.PrStatus{
+		"work/org/repo1": {Number: 1, State: "MERGED", Url: "https://github.com/org/repo1/pull/1"},
+		"work/org/repo2": {Number: 2, State: "CLOSED", Url: "https://github.com/org/repo2/pull/2"},
+	}
+	gh = github.NewFakeGitHub(nil, func(workingDir string) (interface{}, error) {
+		if workingDir == "work/org/repoWithError" {
+			return nil, errors.New("synthetic error")
+		}
+		if pr, ok := prs[workingDir]; ok {
+			return pr, nil
+		}
+		return nil, &github.NoPRFoundError{Path: workingDir, BranchName: "branch"}
+	})
+}
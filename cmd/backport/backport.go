@@ -0,0 +1,259 @@
+/*
+ * Copyright 2021 Skyscanner Limited.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * https://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package backport
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/skyscanner/turbolift/internal/campaign"
+	"github.com/skyscanner/turbolift/internal/changes"
+	"github.com/skyscanner/turbolift/internal/colors"
+	"github.com/skyscanner/turbolift/internal/git"
+	"github.com/skyscanner/turbolift/internal/github"
+	"github.com/skyscanner/turbolift/internal/hooks"
+	"github.com/skyscanner/turbolift/internal/interrupt"
+	"github.com/skyscanner/turbolift/internal/logging"
+	"github.com/skyscanner/turbolift/internal/secrets"
+)
+
+var (
+	gh github.GitHub = github.NewCachingGitHub(github.NewGitHub())
+	g  git.Git       = git.NewRealGit()
+)
+
+var (
+	isDraft           bool
+	repoFile          string
+	prDescriptionFile string
+	targetBranches    []string
+	targetsFile       string
+	secretRules       string
+	allowSecrets      bool
+)
+
+// errNothingToBackport is returned where the campaign branch has no commits of its own to cherry-pick
+var errNothingToBackport = errors.New("no committed changes")
+
+func NewBackportCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "backport",
+		Short: "Cherry-pick the campaign's changes onto release branches, and raise a backport PR to each",
+		Long: `Cherry-pick the commits on the campaign branch of each repository onto one or more release branches, and raise
+a PR to each release branch from a branch named after the campaign and the release branch. The release branches are
+given with --to for every repository, or for particular repositories (or orgs) with --to-file.
+
+Running it again updates the backport branches, and any open PRs from them, with the campaign's latest changes.
+Repositories where the changes do not apply cleanly to a release branch are reported at the end as needing manual
+work.`,
+		Args: cobra.NoArgs,
+		Run:  run,
+	}
+
+	cmd.Flags().BoolVar(&isDraft, "draft", false, "Creates the Pull Requests as Draft PRs")
+	cmd.Flags().StringVar(&repoFile, "repos", "repos.txt", "A file containing a list of repositories to backport the changes of.")
+	cmd.Flags().StringVar(&prDescriptionFile, "description", "README.md", "A file containing the title and description for the PRs.")
+	cmd.Flags().StringArrayVar(&targetBranches, "to", nil, "A release branch to backport the changes to in every repository (can be given more than once).")
+	cmd.Flags().StringVar(&secretRules, "secret-rules", "", "A gitleaks configuration file with rules for secrets to check for, in addition to the built-in rules.")
+	cmd.Flags().BoolVar(&allowSecrets, "allow-secrets", false, "Push changes even where they appear to contain secrets.")
+	cmd.Flags().StringVar(&targetsFile, "to-file", "", "A file where each line is a repository (or org/*) followed by the release branches to backport its changes to, which take precedence over --to.")
+
+	return cmd
+}
+
+func run(c *cobra.Command, _ []string) {
+	logger := logging.NewLogger(c)
+
+	if len(targetBranches) == 0 && targetsFile == "" {
+		logger.FlagErrorf("at least one of --to and --to-file is required")
+		return
+	}
+
+	readCampaignActivity := logger.StartSetupActivity("Reading campaign data (%s, %s)", repoFile, prDescriptionFile)
+	options := campaign.NewCampaignOptions()
+	options.RepoFilename = repoFile
+	options.PrDescriptionFilename = prDescriptionFile
+	dir, err := campaign.OpenCampaign(options)
+	if err != nil {
+		readCampaignActivity.EndWithFailure(err)
+		return
+	}
+	lifecycleHooks, err := hooks.Load()
+	if err != nil {
+		readCampaignActivity.EndWithFailure(err)
+		return
+	}
+	rules, err := secrets.LoadRules(secretRules)
+	if err != nil {
+		readCampaignActivity.EndWithFailure(err)
+		return
+	}
+	targets := campaign.BackportTargets{}
+	if targetsFile != "" {
+		if targets, err = campaign.ReadBackportTargets(targetsFile); err != nil {
+			readCampaignActivity.EndWithFailure(err)
+			return
+		}
+	}
+	readCampaignActivity.EndWithSuccess()
+
+	if err := lifecycleHooks.RunForCommand(logger, hooks.PrePush); err != nil {
+		return
+	}
+
+	var needsManualWork []string
+	doneCount := 0
+	skippedCount := 0
+	interrupt.ForEachRepo(logger, dir.Repos, func(repo campaign.Repo) {
+		repoDirPath := repo.FullRepoPath()
+
+		checkActivity := logger.StartActivity("Checking changes in %s", repo.FullRepoName)
+		// skip if the working copy does not exist
+		if _, err = os.Stat(repoDirPath); os.IsNotExist(err) {
+			checkActivity.EndWithWarningf("Directory %s does not exist - has it been cloned?", repoDirPath)
+			skippedCount++
+			return
+		}
+
+		branches := targets.For(repo)
+		if len(branches) == 0 {
+			branches = targetBranches
+		}
+		if len(branches) == 0 {
+			checkActivity.EndWithWarning("No release branches to backport to - skipping")
+			skippedCount++
+			return
+		}
+
+		baseBranch, err := changes.BaseBranch(checkActivity.Writer(), gh, repo)
+		if err != nil {
+			checkActivity.EndWithFailure(err)
+			needsManualWork = append(needsManualWork, repo.FullRepoName)
+			return
+		}
+		baseRemote, err := changes.BaseRemote(checkActivity.Writer(), g, repoDirPath)
+		if err != nil {
+			checkActivity.EndWithFailure(err)
+			needsManualWork = append(needsManualWork, repo.FullRepoName)
+			return
+		}
+		head, err := changes.HeadOwner(checkActivity.Writer(), g, repo, repoDirPath)
+		if err != nil {
+			checkActivity.EndWithFailure(err)
+			needsManualWork = append(needsManualWork, repo.FullRepoName)
+			return
+		}
+		// the campaign's commits are cherry-picked as they are, so are scanned once for every release branch
+		if !allowSecrets {
+			if err := secrets.CheckBranch(checkActivity.Writer(), g, gh, repo, rules); err != nil {
+				checkActivity.EndWithFailuref("Not pushing: %v", err)
+				needsManualWork = append(needsManualWork, repo.FullRepoName)
+				return
+			}
+		}
+		if err := lifecycleHooks.RunForRepo(checkActivity.Writer(), hooks.PrePush, repo); err != nil {
+			checkActivity.EndWithFailure(err)
+			needsManualWork = append(needsManualWork, repo.FullRepoName)
+			return
+		}
+		checkActivity.EndWithSuccess()
+
+		for _, target := range branches {
+			backportActivity := logger.StartActivity("Backporting %s to %s", repo.FullRepoName, target)
+			created, err := backport(backportActivity, dir, repo, baseRemote, baseRemote+"/"+baseBranch, head, target)
+			if err == errNothingToBackport {
+				backportActivity.EndWithWarning("No committed changes - skipping")
+				skippedCount++
+			} else if err != nil {
+				backportActivity.EndWithFailure(err)
+				needsManualWork = append(needsManualWork, fmt.Sprintf("%s (%s)", repo.FullRepoName, target))
+			} else if !created {
+				backportActivity.EndWithSuccessAndEmitLogs()
+				doneCount++
+			} else {
+				backportActivity.EndWithSuccess()
+				doneCount++
+			}
+		}
+	})
+
+	if len(needsManualWork) == 0 {
+		logger.Successf("turbolift backport completed %s(%s, %s)\n", colors.Normal(), colors.Green(doneCount, " OK"), colors.Yellow(skippedCount, " skipped"))
+	} else {
+		logger.Warnf("turbolift backport completed with %s %s(%s, %s, %s)\n", colors.Red("errors"), colors.Normal(), colors.Green(doneCount, " OK"), colors.Yellow(skippedCount, " skipped"), colors.Red(len(needsManualWork), " need manual work"))
+		logger.Println("These repositories still need manual work:")
+		for _, repoName := range needsManualWork {
+			logger.Println("  ", repoName)
+		}
+	}
+}
+
+// backport cherry-picks the campaign's commits onto the latest target branch, pushes the result to the backport
+// branch, and raises a PR from it to the target branch unless one is open already, returning whether a PR was created
+func backport(activity *logging.Activity, dir *campaign.Campaign, repo campaign.Repo, baseRemote string, baseRef string, head string, target string) (bool, error) {
+	repoDirPath := repo.FullRepoPath()
+	branchName := campaign.BackportBranchName(dir.Name, target)
+
+	if err := g.Fetch(activity.Writer(), repoDirPath, baseRemote, target); err != nil {
+		return false, err
+	}
+	count, err := g.CherryPickToBranch(activity.Writer(), repoDirPath, branchName, baseRef, baseRemote+"/"+target)
+	if err != nil {
+		return false, err
+	}
+	if count == 0 {
+		return false, errNothingToBackport
+	}
+	// the branch is recreated each time, so may have been pushed before with other commits
+	if err := g.ForcePush(activity.Writer(), repoDirPath, "origin", branchName); err != nil {
+		return false, err
+	}
+
+	// the working copy is still on the campaign branch, whose own PR GetPR would find
+	pr, err := gh.GetPRForBranch(activity.Writer(), repoDirPath, branchName)
+	if _, ok := err.(*github.NoPRFoundError); !ok && err != nil {
+		return false, err
+	}
+	if err == nil && pr.State == "OPEN" {
+		activity.Logf("Updated the open PR %s", pr.Url)
+		return false, nil
+	}
+
+	didCreate, err := gh.CreatePullRequest(activity.Writer(), repoDirPath, github.PullRequest{
+		Title:        fmt.Sprintf("[%s] %s", target, dir.PrTitle),
+		Body:         backportNote(dir.PrBody, target),
+		UpstreamRepo: repo.FullRepoName,
+		IsDraft:      isDraft,
+		Base:         target,
+		Head:         head + branchName,
+	})
+	if err != nil {
+		return false, err
+	}
+	if !didCreate {
+		return false, fmt.Errorf("no PR created from %s", branchName)
+	}
+	return true, nil
+}
+
+// backportNote tells reviewers which release branch a PR backports the campaign's changes to
+func backportNote(body string, target string) string {
+	return fmt.Sprintf("%s\n\n> **Note**\n> This backports this campaign's changes to `%s`.\n", strings.TrimRight(body, "\n"), target)
+}
@@ -0,0 +1,137 @@
+/*
+ * Copyright 2021 Skyscanner Limited.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * https://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package blockers
+
+import (
+	"os"
+	"strings"
+
+	"github.com/fatih/color"
+	"github.com/rodaine/table"
+	"github.com/spf13/cobra"
+
+	"github.com/skyscanner/turbolift/internal/campaign"
+	"github.com/skyscanner/turbolift/internal/colors"
+	"github.com/skyscanner/turbolift/internal/github"
+	"github.com/skyscanner/turbolift/internal/interrupt"
+	"github.com/skyscanner/turbolift/internal/logging"
+)
+
+// gh is not cached, so that PRs which were unblocked a moment ago are no longer listed
+var gh github.GitHub = github.NewGitHub()
+
+var repoFile string
+
+func NewBlockersCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "blockers",
+		Short: "Explain why open PRs cannot be merged yet",
+		Long: `Check each open PR against the branch protection of its base branch, and list the requirements it does not
+meet yet: approving reviews, required status checks, signed commits, conflicts and being up to date with the base
+branch.`,
+		Args: cobra.NoArgs,
+		Run:  run,
+	}
+
+	cmd.Flags().StringVar(&repoFile, "repos", "repos.txt", "A file containing a list of repositories to check.")
+
+	return cmd
+}
+
+func run(c *cobra.Command, _ []string) {
+	logger := logging.NewLogger(c)
+
+	readCampaignActivity := logger.StartSetupActivity("Reading campaign data (%s)", repoFile)
+	options := campaign.NewCampaignOptions()
+	options.RepoFilename = repoFile
+	dir, err := campaign.OpenCampaign(options)
+	if err != nil {
+		readCampaignActivity.EndWithFailure(err)
+		return
+	}
+	readCampaignActivity.EndWithSuccess()
+
+	blockersTable := table.New("Repository", "Unmet requirement", "URL")
+	blockersTable.WithHeaderFormatter(color.New(color.Underline).SprintfFunc())
+	blockersTable.WithFirstColumnFormatter(colors.Cyanf)
+	blockersTable.WithWriter(logger.Writer())
+
+	refs := dir.PRRefs()
+	fetchActivity := logger.StartActivity("Fetching PRs of %d repositories", len(refs))
+	prs, err := github.FetchPRs(fetchActivity.Writer(), gh, refs)
+	if err != nil {
+		fetchActivity.EndWithWarningf("Unable to fetch PRs together, so fetching them one at a time: %v", err)
+	} else {
+		fetchActivity.EndWithSuccess()
+	}
+
+	var readyCount, blockedCount, skippedCount, errorCount int
+	interrupt.ForEachRepo(logger, dir.Repos, func(repo campaign.Repo) {
+		repoDirPath := repo.FullRepoPath()
+
+		checkActivity := logger.StartActivity("Checking merge requirements of PR in %s", repo.FullRepoName)
+		// skip if the working copy does not exist
+		if _, err = os.Stat(repoDirPath); os.IsNotExist(err) {
+			checkActivity.EndWithWarningf("Directory %s does not exist - has it been cloned?", repoDirPath)
+			skippedCount++
+			return
+		}
+
+		pr, err := prs.GetPR(checkActivity.Writer(), repoDirPath, dir.Name)
+		if err != nil {
+			checkActivity.EndWithFailuref("No PR found: %v", err)
+			errorCount++
+			return
+		}
+
+		if pr.State != "OPEN" {
+			checkActivity.EndWithWarningf("PR is %s", strings.ToLower(pr.State))
+			skippedCount++
+			return
+		}
+
+		requirements, err := prs.GetMergeRequirements(checkActivity.Writer(), repoDirPath, pr)
+		if err != nil {
+			checkActivity.EndWithFailure(err)
+			errorCount++
+			return
+		}
+
+		unmet := requirements.Unmet()
+		if len(unmet) == 0 {
+			checkActivity.EndWithSuccess()
+			readyCount++
+			return
+		}
+
+		checkActivity.EndWithWarningf("Not ready to merge: %s", strings.Join(unmet, "; "))
+		for _, requirement := range unmet {
+			blockersTable.AddRow(repo.FullRepoName, requirement, pr.Url)
+		}
+		blockedCount++
+	})
+
+	if errorCount == 0 {
+		logger.Successf("turbolift blockers completed %s(%s, %s, %s)\n", colors.Normal(), colors.Green(readyCount, " ready to merge"), colors.Yellow(blockedCount, " blocked"), colors.Yellow(skippedCount, " skipped"))
+	} else {
+		logger.Warnf("turbolift blockers completed with %s %s(%s, %s, %s, %s)\n", colors.Red("errors"), colors.Normal(), colors.Green(readyCount, " ready to merge"), colors.Yellow(blockedCount, " blocked"), colors.Yellow(skippedCount, " skipped"), colors.Red(errorCount, " errored"))
+	}
+
+	if blockedCount > 0 {
+		logger.Println()
+		blockersTable.Print()
+	}
+}
@@ -0,0 +1,94 @@
+/*
+ * Copyright 2021 Skyscanner Limited.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * https://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package blockers
+
+import (
+	"bytes"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/skyscanner/turbolift/internal/github"
+	"github.com/skyscanner/turbolift/internal/testsupport"
+)
+
+func init() {
+	// disable output colouring so that strings we want to do 'Contains' checks on do not have ANSI escape sequences in IDEs
+	_ = os.Setenv("NO_COLOR", "1")
+}
+
+func TestItExplainsWhyPRsCannotBeMerged(t *testing.T) {
+	fakeGitHub := fakeGitHubWithPRs(map[string]string{"work/org/repo1": "OPEN", "work/org/repo2": "MERGED"})
+	fakeGitHub.MergeRequirements = &github.MergeRequirements{
+		MergeStateStatus: "BLOCKED",
+		ReviewDecision:   "REVIEW_REQUIRED",
+		Protection: &github.BranchProtection{
+			RequiresApprovingReviews:     true,
+			RequiredApprovingReviewCount: 1,
+			RequiresStatusChecks:         true,
+			RequiredStatusCheckContexts:  []string{"build"},
+		},
+		Checks: map[string]string{"build": "FAILURE"},
+	}
+	gh = fakeGitHub
+
+	testsupport.PrepareTempCampaign(true, "org/repo1", "org/repo2")
+
+	out, err := runCommand()
+	assert.NoError(t, err)
+	assert.Contains(t, out, "Not ready to merge: 1 approving review(s) are required; required check build is failure")
+	assert.Contains(t, out, "PR is merged")
+	assert.Contains(t, out, "turbolift blockers completed (0 ready to merge, 1 blocked, 1 skipped)")
+	assert.Regexp(t, `org/repo1\s+required check build is failure\s+https://github.com/org/repo1/pull/1`, out)
+
+	fakeGitHub.AssertCalledWith(t, [][]string{
+		{"work/org/repo1"},
+		{"work/org/repo1", "PR_work/org/repo1"},
+		{"work/org/repo2"},
+	})
+}
+
+func TestItReportsPRsThatAreReadyToMerge(t *testing.T) {
+	gh = fakeGitHubWithPRs(map[string]string{"work/org/repo1": "OPEN"})
+
+	testsupport.PrepareTempCampaign(true, "org/repo1")
+
+	out, err := runCommand()
+	assert.NoError(t, err)
+	assert.Contains(t, out, "turbolift blockers completed (1 ready to merge, 0 blocked, 0 skipped)")
+	assert.NotContains(t, out, "Unmet requirement")
+}
+
+func fakeGitHubWithPRs(states map[string]string) *github.FakeGitHub {
+	return github.NewFakeGitHub(func(github.Command, []string) (bool, error) {
+		return true, nil
+	}, func(workingDir string) (interface{}, error) {
+		return &github.PrStatus{Id: "PR_" + workingDir, State: states[workingDir], Url: "https://github.com/" + workingDir[len("work/"):] + "/pull/1"}, nil
+	})
+}
+
+func runCommand(args ...string) (string, error) {
+	cmd := NewBlockersCmd()
+	cmd.SetArgs(args)
+	outBuffer := bytes.NewBufferString("")
+	cmd.SetOut(outBuffer)
+	err := cmd.Execute()
+	if err != nil {
+		return outBuffer.String(), err
+	}
+	return outBuffer.String(), nil
+}
@@ -0,0 +1,142 @@
+/*
+ * Copyright 2021 Skyscanner Limited.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * https://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package checkout
+
+import (
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/skyscanner/turbolift/internal/campaign"
+	"github.com/skyscanner/turbolift/internal/changes"
+	"github.com/skyscanner/turbolift/internal/colors"
+	"github.com/skyscanner/turbolift/internal/git"
+	"github.com/skyscanner/turbolift/internal/github"
+	"github.com/skyscanner/turbolift/internal/interrupt"
+	"github.com/skyscanner/turbolift/internal/logging"
+)
+
+var (
+	gh github.GitHub = github.NewCachingGitHub(github.NewGitHub())
+	g  git.Git       = git.NewRealGit()
+)
+
+var (
+	repoFile string
+	fromBase bool
+)
+
+func NewCheckoutCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "checkout",
+		Short: "Switch the cloned working copies to the campaign branch, such as the branch of a --profile",
+		Long: `Switch each cloned working copy to the campaign branch, creating it if it does not exist yet.
+With --profile, this is the profile's own branch, so that the same working copies can host several related
+campaigns, e.g. a phase 2 which builds on phase 1. A new branch starts from the commit currently checked out,
+or from the base branch with --from-base.
+Working copies with uncommitted changes are skipped.`,
+		Run: run,
+	}
+
+	cmd.Flags().StringVar(&repoFile, "repos", "repos.txt", "A file containing a list of repositories to check out.")
+	cmd.Flags().BoolVar(&fromBase, "from-base", false, "Create new branches from the base branch rather than from the commit currently checked out.")
+
+	return cmd
+}
+
+func run(c *cobra.Command, _ []string) {
+	logger := logging.NewLogger(c)
+
+	readCampaignActivity := logger.StartSetupActivity("Reading campaign data (%s)", repoFile)
+	options := campaign.NewCampaignOptions()
+	options.RepoFilename = repoFile
+	dir, err := campaign.OpenCampaign(options)
+	if err != nil {
+		readCampaignActivity.EndWithFailure(err)
+		return
+	}
+	readCampaignActivity.EndWithSuccess()
+
+	doneCount := 0
+	skippedCount := 0
+	errorCount := 0
+	interrupt.ForEachRepo(logger, dir.Repos, func(repo campaign.Repo) {
+		repoDirPath := repo.FullRepoPath()
+
+		checkoutActivity := logger.StartActivity("Checking out %s in %s", dir.Name, repo.FullRepoName)
+		// skip if the working copy does not exist
+		if _, err = os.Stat(repoDirPath); os.IsNotExist(err) {
+			checkoutActivity.EndWithWarningf("Directory %s does not exist - has it been cloned?", repoDirPath)
+			skippedCount++
+			return
+		}
+
+		changed, err := g.IsRepoChanged(checkoutActivity.Writer(), repoDirPath)
+		if err != nil {
+			checkoutActivity.EndWithFailure(err)
+			errorCount++
+			return
+		}
+		if changed {
+			checkoutActivity.EndWithWarningf("%s has uncommitted changes - commit or discard them first", repoDirPath)
+			skippedCount++
+			return
+		}
+
+		startPoint := ""
+		if fromBase {
+			if startPoint, err = baseStartPoint(checkoutActivity, repo, repoDirPath); err != nil {
+				checkoutActivity.EndWithFailure(err)
+				errorCount++
+				return
+			}
+		}
+
+		created, err := g.SwitchBranch(checkoutActivity.Writer(), repoDirPath, dir.Name, startPoint)
+		if err != nil {
+			checkoutActivity.EndWithFailure(err)
+			errorCount++
+			return
+		}
+		if created {
+			checkoutActivity.Logf("Created branch %s", dir.Name)
+		}
+		checkoutActivity.EndWithSuccess()
+		doneCount++
+	})
+
+	if errorCount == 0 {
+		logger.Successf("turbolift checkout completed %s(%s, %s)\n", colors.Normal(), colors.Green(doneCount, " OK"), colors.Yellow(skippedCount, " skipped"))
+	} else {
+		logger.Warnf("turbolift checkout completed with %s %s(%s, %s, %s)\n", colors.Red("errors"), colors.Normal(), colors.Green(doneCount, " OK"), colors.Yellow(skippedCount, " skipped"), colors.Red(errorCount, " errored"))
+	}
+}
+
+// baseStartPoint fetches the repository's base branch, and returns it as the start point of a new branch
+func baseStartPoint(activity *logging.Activity, repo campaign.Repo, repoDirPath string) (string, error) {
+	baseBranch, err := changes.BaseBranch(activity.Writer(), gh, repo)
+	if err != nil {
+		return "", err
+	}
+	baseRemote, err := changes.BaseRemote(activity.Writer(), g, repoDirPath)
+	if err != nil {
+		return "", err
+	}
+	if err := g.Fetch(activity.Writer(), repoDirPath, baseRemote, baseBranch); err != nil {
+		return "", err
+	}
+	return baseRemote + "/" + baseBranch, nil
+}
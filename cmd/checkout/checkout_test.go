@@ -0,0 +1,108 @@
+/*
+ * Copyright 2021 Skyscanner Limited.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * https://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package checkout
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/skyscanner/turbolift/cmd/flags"
+	"github.com/skyscanner/turbolift/internal/git"
+	"github.com/skyscanner/turbolift/internal/github"
+	"github.com/skyscanner/turbolift/internal/testsupport"
+)
+
+func init() {
+	// disable output colouring so that strings we want to do 'Contains' checks on do not have ANSI escape sequences in IDEs
+	_ = os.Setenv("NO_COLOR", "1")
+}
+
+func TestItSwitchesToTheProfileBranch(t *testing.T) {
+	fakeGit := git.NewFakeGit(unchangedWorkingCopies)
+	g = fakeGit
+	flags.Profile = "phase-2"
+	defer func() { flags.Profile = "" }()
+
+	testsupport.PrepareTempCampaign(true, "org/repo1", "org/repo2")
+
+	out, err := runCommand()
+	assert.NoError(t, err)
+	assert.Contains(t, out, "turbolift checkout completed (2 OK, 0 skipped)")
+
+	branch := testsupport.Pwd() + "-phase-2"
+	fakeGit.AssertCalledWith(t, [][]string{
+		{"isRepoChanged", "work/org/repo1"},
+		{"switchBranch", "work/org/repo1", branch, ""},
+		{"isRepoChanged", "work/org/repo2"},
+		{"switchBranch", "work/org/repo2", branch, ""},
+	})
+}
+
+func TestItCreatesBranchesFromTheBaseBranchWhenAsked(t *testing.T) {
+	gh = github.NewAlwaysSucceedsFakeGitHub()
+	fakeGit := git.NewFakeGit(unchangedWorkingCopies)
+	g = fakeGit
+
+	testsupport.PrepareTempCampaign(true, "org/repo1")
+
+	out, err := runCommand("--from-base")
+	assert.NoError(t, err)
+	assert.Contains(t, out, "turbolift checkout completed (1 OK, 0 skipped)")
+
+	fakeGit.AssertCalledWith(t, [][]string{
+		{"isRepoChanged", "work/org/repo1"},
+		{"remotes", "work/org/repo1"},
+		{"fetch", "work/org/repo1", "origin", "main"},
+		{"switchBranch", "work/org/repo1", testsupport.Pwd(), "origin/main"},
+	})
+}
+
+func TestItSkipsWorkingCopiesWithUncommittedChanges(t *testing.T) {
+	fakeGit := git.NewAlwaysSucceedsFakeGit()
+	g = fakeGit
+
+	testsupport.PrepareTempCampaign(true, "org/repo1")
+
+	out, err := runCommand()
+	assert.NoError(t, err)
+	assert.Contains(t, out, "has uncommitted changes")
+	assert.Contains(t, out, "turbolift checkout completed (0 OK, 1 skipped)")
+
+	fakeGit.AssertCalledWith(t, [][]string{
+		{"isRepoChanged", "work/org/repo1"},
+	})
+}
+
+func unchangedWorkingCopies(_ io.Writer, call []string) (bool, error) {
+	return call[0] != "isRepoChanged", nil
+}
+
+func runCommand(args ...string) (string, error) {
+	cmd := NewCheckoutCmd()
+	fromBase = false
+	cmd.SetArgs(args)
+	outBuffer := bytes.NewBufferString("")
+	cmd.SetOut(outBuffer)
+	err := cmd.Execute()
+	if err != nil {
+		return outBuffer.String(), err
+	}
+	return outBuffer.String(), nil
+}
@@ -16,37 +16,72 @@
 package clone
 
 import (
+	"errors"
+	"fmt"
+	"io"
 	"os"
 	"path"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/spf13/cobra"
 
+	"github.com/skyscanner/turbolift/cmd/flags"
+	bandwidthlimit "github.com/skyscanner/turbolift/internal/bandwidth"
 	"github.com/skyscanner/turbolift/internal/campaign"
 	"github.com/skyscanner/turbolift/internal/colors"
 	"github.com/skyscanner/turbolift/internal/git"
 	"github.com/skyscanner/turbolift/internal/github"
+	"github.com/skyscanner/turbolift/internal/hooks"
+	"github.com/skyscanner/turbolift/internal/interrupt"
 	"github.com/skyscanner/turbolift/internal/logging"
+	"github.com/skyscanner/turbolift/internal/refcache"
+	"github.com/skyscanner/turbolift/internal/worktrees"
 )
 
 var (
-	gh github.GitHub = github.NewRealGitHub()
+	gh github.GitHub = github.NewCachingGitHub(github.NewGitHub())
 	g  git.Git       = git.NewRealGit()
 )
 
 var (
-	nofork   bool
-	repoFile string
+	nofork         bool
+	repoFile       string
+	referenceCache string
+	filter         string
+	skipLFS        bool
+	recurse        bool
+	worktreeStore  string
+	retries        int
+	parallel       int
+	bandwidth      string
 )
 
+// retryDelay is how long to wait before retrying repositories which failed with transient errors, which increases with
+// each attempt
+var retryDelay = 10 * time.Second
+
 func NewCloneCmd() *cobra.Command {
 	cmd := &cobra.Command{
 		Use:   "clone",
 		Short: "Clone all repositories",
+		Args:  cobra.NoArgs,
 		Run:   run,
 	}
 
 	cmd.Flags().BoolVar(&nofork, "no-fork", false, "Will not fork, just clone and create a branch.")
 	cmd.Flags().StringVar(&repoFile, "repos", "repos.txt", "A file containing a list of repositories to clone.")
+	cmd.Flags().StringVar(&referenceCache, "reference-cache", "", "Keep a mirror of each repository in this directory, shared between campaigns, and clone using it so that only new objects are downloaded.")
+	cmd.Flags().Lookup("reference-cache").NoOptDefVal = refcache.DefaultDir()
+	cmd.Flags().StringVar(&worktreeStore, "worktrees", "", "Keep a single bare clone of each repository in this directory, shared between campaigns, and add each working copy to it as a git worktree, which takes far less disk space. Requires --no-fork.")
+	cmd.Flags().Lookup("worktrees").NoOptDefVal = worktrees.DefaultDir()
+	cmd.Flags().BoolVar(&skipLFS, "skip-lfs", false, "Leave files stored with Git LFS as pointers, without downloading their content, for campaigns which do not change them.")
+	cmd.Flags().BoolVar(&recurse, "recurse-submodules", false, "Also clone the submodules of each repository. By default they are left uninitialised, and commit leaves them out.")
+	cmd.Flags().IntVar(&retries, "retries", 2, "How many more times to try cloning repositories which failed with transient errors, such as network errors, after all the others.")
+	cmd.Flags().IntVar(&parallel, "parallel", 1, "How many repositories to clone at once. When the git server says it is throttling clones, fewer are cloned at once, after a pause.")
+	cmd.Flags().StringVar(&bandwidth, "bandwidth", "", "Limit the rate each clone downloads at, in bytes per second, e.g. 500K or 2M, so that cloning does not saturate the network. Only HTTPS clones are limited.")
+	cmd.Flags().StringVar(&filter, "filter", "", "Make partial clones of very large repositories, which fetch file contents only when they are needed: blob:none to omit all file contents, or tree:0 to also omit directory listings.")
 
 	return cmd
 }
@@ -54,7 +89,40 @@ func NewCloneCmd() *cobra.Command {
 func run(c *cobra.Command, _ []string) {
 	logger := logging.NewLogger(c)
 
-	readCampaignActivity := logger.StartActivity("Reading campaign data (%s)", repoFile)
+	if filter != "" {
+		if !isSupportedFilter(filter) {
+			logger.FlagErrorf("unsupported --filter %s - expected blob:none, blob:limit=SIZE or tree:0", filter)
+			return
+		}
+		if referenceCache != "" {
+			logger.FlagErrorf("--filter cannot be combined with --reference-cache, which fetches every object")
+			return
+		}
+	}
+
+	if parallel < 1 {
+		logger.FlagErrorf("--parallel must be at least 1")
+		return
+	}
+
+	if worktreeStore != "" {
+		switch {
+		case !nofork:
+			logger.FlagErrorf("--worktrees requires --no-fork, as the working copies of every campaign share their remotes")
+			return
+		case referenceCache != "":
+			logger.FlagErrorf("--worktrees cannot be combined with --reference-cache, as shared clones already download each repository only once")
+			return
+		case recurse:
+			logger.FlagErrorf("--worktrees cannot be combined with --recurse-submodules")
+			return
+		case flags.Offline != "":
+			logger.FlagErrorf("--worktrees cannot be used offline")
+			return
+		}
+	}
+
+	readCampaignActivity := logger.StartSetupActivity("Reading campaign data (%s)", repoFile)
 	options := campaign.NewCampaignOptions()
 	options.RepoFilename = repoFile
 	dir, err := campaign.OpenCampaign(options)
@@ -62,88 +130,337 @@ func run(c *cobra.Command, _ []string) {
 		readCampaignActivity.EndWithFailure(err)
 		return
 	}
+	lifecycleHooks, err := hooks.Load()
+	if err != nil {
+		readCampaignActivity.EndWithFailure(err)
+		return
+	}
 	readCampaignActivity.EndWithSuccess()
 
-	var doneCount, skippedCount, errorCount int
-	for _, repo := range dir.Repos {
-		orgDirPath := path.Join("work", repo.OrgName) // i.e. work/org
+	if err := lifecycleHooks.RunForCommand(logger, hooks.PreClone); err != nil {
+		return
+	}
+
+	if skipLFS {
+		// stops git-lfs downloading content as repositories are checked out, where it is set up globally
+		_ = os.Setenv("GIT_LFS_SKIP_SMUDGE", "1")
+	}
 
-		var cloneActivity *logging.Activity
-		if nofork {
-			cloneActivity = logger.StartActivity("Cloning %s into %s/%s", repo.FullRepoName, orgDirPath, repo.RepoName)
-		} else {
-			cloneActivity = logger.StartActivity("Forking and cloning %s into %s/%s", repo.FullRepoName, orgDirPath, repo.RepoName)
+	if bandwidth != "" {
+		stop, err := limitBandwidth(logger)
+		if err != nil {
+			logger.Errorf("Unable to limit the bandwidth of clones: %v", err)
+			return
 		}
+		defer stop()
+	}
 
-		err := os.MkdirAll(orgDirPath, os.ModeDir|0o755)
-		if err != nil {
-			cloneActivity.EndWithFailuref("Unable to create org directory: %s", err)
-			errorCount++
+	t := newThrottle(logger, parallel)
+	var counts cloneCounts
+	transientlyFailed, notReached := cloneAll(logger, dir, dir.Repos, lifecycleHooks, t, &counts)
+	if len(notReached) > 0 {
+		interrupt.Stop(logger, notReached)
+	}
+
+	for attempt := 1; attempt <= retries && len(transientlyFailed) > 0 && !interrupt.Requested(); attempt++ {
+		delay := retryDelay * time.Duration(attempt)
+		logger.Printf("Retrying %d repositories which failed with transient errors in %s (attempt %d of %d)", len(transientlyFailed), delay, attempt, retries)
+		time.Sleep(delay)
+
+		stillFailing, notReached := cloneAll(logger, dir, transientlyFailed, lifecycleHooks, t, &counts)
+		if len(notReached) > 0 {
+			interrupt.Stop(logger, notReached)
+		}
+		transientlyFailed = append(stillFailing, notReached...)
+	}
+	doneCount, skippedCount, errorCount := counts.done, counts.skipped, counts.errored+len(transientlyFailed)
+
+	if errorCount == 0 {
+		logger.Successf("turbolift clone completed %s(%s repos cloned, %s repos skipped)\n", colors.Normal(), colors.Green(doneCount), colors.Yellow(skippedCount))
+	} else {
+		logger.Warnf("turbolift clone completed with %s %s(%s repos cloned, %s repos skipped, %s repos errored)\n", colors.Red("errors"), colors.Normal(), colors.Green(doneCount), colors.Yellow(skippedCount), colors.Red(errorCount))
+		logger.Println("Please check errors above and fix if necessary")
+	}
+	logger.Println("To continue:")
+	logger.Println("\t1. Make your changes in the cloned repositories within the", colors.Cyan(campaign.WorkDir()), "directory")
+	logger.Println("\t2. Add new files across all repos using", colors.Cyan(`turbolift foreach git add -A`))
+	logger.Println("\t3. Commit changes across all repos using", colors.Cyan(`turbolift commit --message "Your commit message"`))
+	logger.Println("\t4. Change the PR title and description in the", colors.Cyan(`README.md`), "of a campaign")
+}
+
+// cloneCounts are how many repositories were cloned, skipped and failed other than transiently
+type cloneCounts struct {
+	done, skipped, errored int
+}
+
+// cloneAll clones the repositories, up to --parallel at once as the throttle allows, adding to the counts. It returns
+// the repositories which failed transiently, and those which were not reached because the command was interrupted.
+func cloneAll(logger *logging.Logger, dir *campaign.Campaign, repos []campaign.Repo, lifecycleHooks *hooks.Hooks, t *throttle, counts *cloneCounts) ([]campaign.Repo, []campaign.Repo) {
+	// activities of clones running at once must not share a spinner
+	startActivity := logger.StartActivity
+	if parallel > 1 {
+		startActivity = logger.StartConcurrentActivity
+	}
+
+	var mutex sync.Mutex
+	var running sync.WaitGroup
+	var transientlyFailed, notReached []campaign.Repo
+	for i, repo := range repos {
+		if !t.acquire() {
+			notReached = repos[i:]
 			break
 		}
+		running.Add(1)
+		go func(repo campaign.Repo) {
+			defer running.Done()
+			result := cloneRepo(startActivity, dir, repo, lifecycleHooks)
+			t.release(result == throttled)
 
-		repoDirPath := path.Join(orgDirPath, repo.RepoName) // i.e. work/org/repo
-		// skip if the working copy is already cloned
-		if _, err = os.Stat(repoDirPath); !os.IsNotExist(err) {
-			cloneActivity.EndWithWarningf("Directory already exists")
-			skippedCount++
-			continue
+			mutex.Lock()
+			defer mutex.Unlock()
+			switch result {
+			case cloned:
+				counts.done++
+			case skipped:
+				counts.skipped++
+			case failedTransiently, throttled:
+				transientlyFailed = append(transientlyFailed, repo)
+			default:
+				counts.errored++
+			}
+		}(repo)
+	}
+	running.Wait()
+	return transientlyFailed, notReached
+}
+
+// limitBandwidth sends the HTTPS traffic of git and gh through a local proxy which limits each connection to
+// --bandwidth, returning a function which stops it
+func limitBandwidth(logger *logging.Logger) (func(), error) {
+	rate, err := bandwidthlimit.ParseRate(bandwidth)
+	if err != nil {
+		return nil, fmt.Errorf("invalid --bandwidth: %w", err)
+	}
+	for _, name := range []string{"HTTPS_PROXY", "https_proxy", "ALL_PROXY", "all_proxy"} {
+		if os.Getenv(name) != "" {
+			return nil, fmt.Errorf("--bandwidth cannot be combined with a proxy in %s", name)
 		}
+	}
 
-		if nofork {
-			err = gh.Clone(cloneActivity.Writer(), orgDirPath, repo.FullRepoName)
-		} else {
-			err = gh.ForkAndClone(cloneActivity.Writer(), orgDirPath, repo.FullRepoName)
+	proxy, err := bandwidthlimit.Start(rate)
+	if err != nil {
+		return nil, err
+	}
+	_ = os.Setenv("HTTPS_PROXY", proxy.URL())
+	logger.Printf("Limiting each clone to %s bytes per second", bandwidth)
+	return func() {
+		_ = os.Unsetenv("HTTPS_PROXY")
+		_ = proxy.Close()
+	}, nil
+}
+
+// setUpLFS makes sure that LFS files in a working copy have their content, rather than pointers which a script could
+// change and commit in place of the content, and that their content is pushed along with commits
+func setUpLFS(activity *logging.Activity, repoDirPath string) error {
+	if err := g.CheckLFSInstalled(activity.Writer()); err != nil {
+		if skipLFS {
+			activity.Log("This repository uses Git LFS, which is not installed - its LFS files are left as pointers")
+			return nil
 		}
+		// the working copy holds pointers in place of LFS files, so remove it to be cloned again once git-lfs is installed
+		_ = worktrees.RemoveWorkingCopy(activity.Writer(), g, repoDirPath)
+		return errors.New("this repository uses Git LFS, but git-lfs is not installed - install it from https://git-lfs.com and clone again, or use --skip-lfs to work with pointers")
+	}
 
-		if err != nil {
-			cloneActivity.EndWithFailure(err)
-			errorCount++
-			continue
+	if skipLFS {
+		activity.Log("Setting up Git LFS, leaving LFS files as pointers")
+	} else {
+		activity.Log("Setting up Git LFS and downloading LFS files")
+	}
+	return g.InitLFS(activity.Writer(), repoDirPath, skipLFS)
+}
+
+// isSupportedFilter checks for the filters which git clone --filter accepts and which leave a working copy usable
+func isSupportedFilter(filter string) bool {
+	return filter == "blob:none" || filter == "tree:0" || strings.HasPrefix(filter, "blob:limit=")
+}
+
+// outcome is how cloning a repository turned out
+type outcome int
+
+const (
+	cloned outcome = iota
+	skipped
+	failed
+	// failedTransiently is a failure which is likely to succeed if tried again, such as a network error
+	failedTransiently
+	// throttled is a transient failure where the git server said it is throttling clones
+	throttled
+)
+
+// cloneRepo clones a repository and creates the campaign branch in it. A working copy is only left behind once it is
+// complete, so that running clone again picks up where it left off.
+func cloneRepo(startActivity func(format string, args ...interface{}) *logging.Activity, dir *campaign.Campaign, repo campaign.Repo, lifecycleHooks *hooks.Hooks) outcome {
+	orgDirPath := path.Join(campaign.WorkDir(), repo.OrgName) // i.e. work/org
+	repoDirPath := repo.FullRepoPath()
+
+	// the output of git and gh is kept to tell transient failures from others
+	var transcript strings.Builder
+	writer := func(activity *logging.Activity) io.Writer {
+		return io.MultiWriter(activity.Writer(), &transcript)
+	}
+	fail := func(activity *logging.Activity, err error) outcome {
+		activity.EndWithFailure(err)
+		// leave no incomplete working copy behind, which would be skipped as already cloned next time
+		_ = worktrees.RemoveWorkingCopy(activity.Writer(), g, repoDirPath)
+		output := err.Error() + "\n" + transcript.String()
+		if isThrottled(output) {
+			return throttled
+		}
+		if isTransient(output) {
+			return failedTransiently
 		}
+		return failed
+	}
 
-		cloneActivity.EndWithSuccess()
+	var cloneActivity *logging.Activity
+	if worktreeStore != "" {
+		cloneActivity = startActivity("Adding a worktree of %s at %s/%s", repo.FullRepoName, orgDirPath, repo.RepoName)
+	} else if nofork {
+		cloneActivity = startActivity("Cloning %s into %s/%s", repo.FullRepoName, orgDirPath, repo.RepoName)
+	} else {
+		cloneActivity = startActivity("Forking and cloning %s into %s/%s", repo.FullRepoName, orgDirPath, repo.RepoName)
+	}
 
-		createBranchActivity := logger.StartActivity("Creating branch %s in %s", dir.Name, repo.FullRepoName)
+	// skip if the working copy is already cloned
+	if _, err := os.Stat(repoDirPath); !os.IsNotExist(err) {
+		cloneActivity.EndWithWarningf("Directory already exists")
+		return skipped
+	}
+
+	if err := os.MkdirAll(orgDirPath, os.ModeDir|0o755); err != nil {
+		cloneActivity.EndWithFailuref("Unable to create org directory: %s", err)
+		return failed
+	}
 
-		err = g.Checkout(createBranchActivity.Writer(), repoDirPath, dir.Name)
+	if err := lifecycleHooks.RunForRepo(cloneActivity.Writer(), hooks.PreClone, repo); err != nil {
+		cloneActivity.EndWithFailure(err)
+		return failed
+	}
+
+	var gitFlags []string
+	if filter != "" {
+		gitFlags = append(gitFlags, "--filter="+filter)
+	}
+
+	if worktreeStore != "" {
+		// the campaign branch is created along with the worktree
+		err := worktrees.Store{Dir: worktreeStore}.AddWorkingCopy(writer(cloneActivity), g, repo, dir.Name, gitFlags...)
+		if err == nil && git.UsesLFS(repoDirPath) {
+			err = setUpLFS(cloneActivity, repoDirPath)
+		}
+		if err == nil {
+			_, err = recordBaseBranch(writer(cloneActivity), repo)
+		}
 		if err != nil {
-			createBranchActivity.EndWithFailure(err)
-			errorCount++
-			continue
-		}
-		createBranchActivity.EndWithSuccess()
-
-		if !nofork {
-			pullFromUpstreamActivity := logger.StartActivity("Pulling latest changes from %s", repo.FullRepoName)
-			var defaultBranch string
-			defaultBranch, err = gh.GetDefaultBranchName(pullFromUpstreamActivity.Writer(), repoDirPath, repo.FullRepoName)
-			if err != nil {
-				pullFromUpstreamActivity.EndWithFailure(err)
-				errorCount++
-				continue
-			}
-			err = g.Pull(pullFromUpstreamActivity.Writer(), repoDirPath, "upstream", defaultBranch)
-			if err != nil {
-				pullFromUpstreamActivity.EndWithFailure(err)
-				errorCount++
-				continue
-			}
-			pullFromUpstreamActivity.EndWithSuccess()
+			return fail(cloneActivity, err)
 		}
+		cloneActivity.EndWithSuccess()
+		return cloned
+	}
 
-		doneCount++
+	if recurse {
+		gitFlags = append(gitFlags, "--recurse-submodules")
+	}
+	// in offline mode, repositories are cloned from local mirrors already
+	if referenceCache != "" && flags.Offline == "" {
+		mirrorPath, err := refcache.Cache{Dir: referenceCache}.Update(cloneActivity.Writer(), g, repo)
+		if err != nil {
+			cloneActivity.Logf("Unable to update the reference cache, so cloning without it: %v", err)
+		} else {
+			gitFlags = append(gitFlags, refcache.CloneFlags(mirrorPath)...)
+		}
 	}
 
-	if errorCount == 0 {
-		logger.Successf("turbolift clone completed %s(%s repos cloned, %s repos skipped)\n", colors.Normal(), colors.Green(doneCount), colors.Yellow(skippedCount))
+	var err error
+	if nofork {
+		err = gh.Clone(writer(cloneActivity), orgDirPath, repo.FullRepoName, gitFlags...)
 	} else {
-		logger.Warnf("turbolift clone completed with %s %s(%s repos cloned, %s repos skipped, %s repos errored)\n", colors.Red("errors"), colors.Normal(), colors.Green(doneCount), colors.Yellow(skippedCount), colors.Red(errorCount))
-		logger.Println("Please check errors above and fix if necessary")
+		err = gh.ForkAndClone(writer(cloneActivity), orgDirPath, repo.FullRepoName, gitFlags...)
 	}
-	logger.Println("To continue:")
-	logger.Println("\t1. Make your changes in the cloned repositories within the", colors.Cyan("work"), "directory")
-	logger.Println("\t2. Add new files across all repos using", colors.Cyan(`turbolift foreach git add -A`))
-	logger.Println("\t3. Commit changes across all repos using", colors.Cyan(`turbolift commit --message "Your commit message"`))
-	logger.Println("\t4. Change the PR title and description in the", colors.Cyan(`README.md`), "of a campaign")
+	if err != nil {
+		return fail(cloneActivity, err)
+	}
+
+	if git.UsesLFS(repoDirPath) {
+		if err := setUpLFS(cloneActivity, repoDirPath); err != nil {
+			return fail(cloneActivity, err)
+		}
+	}
+
+	baseBranch, err := recordBaseBranch(writer(cloneActivity), repo)
+	if err != nil {
+		return fail(cloneActivity, err)
+	}
+	cloneActivity.EndWithSuccess()
+
+	createBranchActivity := startActivity("Creating branch %s in %s", dir.Name, repo.FullRepoName)
+	if err := g.Checkout(writer(createBranchActivity), repoDirPath, dir.Name); err != nil {
+		return fail(createBranchActivity, err)
+	}
+	createBranchActivity.EndWithSuccess()
+
+	if !nofork {
+		pullFromUpstreamActivity := startActivity("Pulling latest changes from %s", repo.FullRepoName)
+		if err := g.Pull(writer(pullFromUpstreamActivity), repoDirPath, "upstream", baseBranch); err != nil {
+			return fail(pullFromUpstreamActivity, err)
+		}
+		pullFromUpstreamActivity.EndWithSuccess()
+	}
+
+	return cloned
+}
+
+// recordBaseBranch looks up the default branch of a repository, which its campaign branch is created from, and records
+// it so that later commands compare changes against, and raise PRs to, the same branch
+func recordBaseBranch(output io.Writer, repo campaign.Repo) (string, error) {
+	baseBranch, err := gh.GetDefaultBranchName(output, repo.FullRepoPath(), repo.FullRepoName)
+	if err != nil {
+		return "", err
+	}
+	if err := campaign.RecordBaseBranch(repo, baseBranch); err != nil {
+		return "", fmt.Errorf("unable to record the base branch in %s: %w", campaign.BaseBranchesFilename, err)
+	}
+	return baseBranch, nil
+}
+
+// transientErrors are the messages of git, gh and the network which mean that a clone may well succeed if tried again
+var transientErrors = []string{
+	"could not resolve host",
+	"connection reset",
+	"connection refused",
+	"connection timed out",
+	"operation timed out",
+	"i/o timeout",
+	"tls handshake timeout",
+	"the remote end hung up unexpectedly",
+	"early eof",
+	"rpc failed",
+	"unexpected disconnect",
+	"http 500",
+	"http 502",
+	"http 503",
+	"http 504",
+	"returned error: 5",
+	"secondary rate limit",
+}
+
+func isTransient(output string) bool {
+	output = strings.ToLower(output)
+	for _, message := range transientErrors {
+		if strings.Contains(output, message) {
+			return true
+		}
+	}
+	return false
 }
@@ -17,9 +17,14 @@ package clone
 
 import (
 	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
 	"os"
 	"path"
+	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/skyscanner/turbolift/internal/git"
 	"github.com/skyscanner/turbolift/internal/github"
@@ -107,7 +112,9 @@ func TestItLogsCheckoutErrorsButContinuesToTryAll(t *testing.T) {
 
 	fakeGitHub.AssertCalledWith(t, [][]string{
 		{"work/org", "org/repo1"},
+		{"work/org/repo1", "org/repo1"},
 		{"work/org", "org/repo2"},
+		{"work/org/repo2", "org/repo2"},
 	})
 	fakeGit.AssertCalledWith(t, [][]string{
 		{"checkout", "work/org/repo1", testsupport.Pwd()},
@@ -159,7 +166,9 @@ func TestItDoesNotPullFromUpstreamWhenCloningWithoutFork(t *testing.T) {
 
 	fakeGitHub.AssertCalledWith(t, [][]string{
 		{"work/org1", "org1/repo1"},
+		{"work/org1/repo1", "org1/repo1"},
 		{"work/org2", "org2/repo2"},
+		{"work/org2/repo2", "org2/repo2"},
 	})
 	fakeGit.AssertCalledWith(t, [][]string{
 		{"checkout", "work/org1/repo1", testsupport.Pwd()},
@@ -176,8 +185,9 @@ func TestItLogsDefaultBranchErrorsButContinuesToTryAll(t *testing.T) {
 	testsupport.PrepareTempCampaign(false, "org1/repo1", "org2/repo2")
 	out, err := runCloneCommandWithFork()
 	assert.NoError(t, err)
-	assert.Contains(t, out, "Pulling latest changes from org1/repo1")
-	assert.Contains(t, out, "Pulling latest changes from org2/repo2")
+	assert.Contains(t, out, "Forking and cloning org1/repo1")
+	assert.Contains(t, out, "Forking and cloning org2/repo2")
+	assert.NotContains(t, out, "Creating branch")
 	assert.Contains(t, out, "turbolift clone completed with errors")
 	assert.Contains(t, out, "2 repos errored")
 
@@ -187,10 +197,22 @@ func TestItLogsDefaultBranchErrorsButContinuesToTryAll(t *testing.T) {
 		{"work/org2", "org2/repo2"},
 		{"work/org2/repo2", "org2/repo2"},
 	})
-	fakeGit.AssertCalledWith(t, [][]string{
-		{"checkout", "work/org1/repo1", testsupport.Pwd()},
-		{"checkout", "work/org2/repo2", testsupport.Pwd()},
-	})
+	fakeGit.AssertCalledWith(t, [][]string{})
+}
+
+func TestItRecordsTheBaseBranchOfEachRepo(t *testing.T) {
+	gh = github.NewAlwaysSucceedsFakeGitHub()
+	g = git.NewAlwaysSucceedsFakeGit()
+
+	testsupport.PrepareTempCampaign(false, "org/repo1", "org/repo2")
+
+	out, err := runCloneCommand()
+	assert.NoError(t, err)
+	assert.Contains(t, out, "turbolift clone completed (2 repos cloned, 0 repos skipped)")
+
+	recorded, err := ioutil.ReadFile("base_branches.txt")
+	assert.NoError(t, err)
+	assert.Equal(t, "org/repo1 main\norg/repo2 main\n", string(recorded))
 }
 
 func TestItLogsPullErrorsButContinuesToTryAll(t *testing.T) {
@@ -236,7 +258,9 @@ func TestItClonesReposFoundInReposFile(t *testing.T) {
 
 	fakeGitHub.AssertCalledWith(t, [][]string{
 		{"work/org", "org/repo1"},
+		{"work/org/repo1", "org/repo1"},
 		{"work/org", "org/repo2"},
+		{"work/org/repo2", "org/repo2"},
 	})
 	fakeGit.AssertCalledWith(t, [][]string{
 		{"checkout", "work/org/repo1", testsupport.Pwd()},
@@ -257,7 +281,9 @@ func TestItClonesReposInMultipleOrgs(t *testing.T) {
 
 	fakeGitHub.AssertCalledWith(t, [][]string{
 		{"work/orgA", "orgA/repo1"},
+		{"work/orgA/repo1", "orgA/repo1"},
 		{"work/orgB", "orgB/repo2"},
+		{"work/orgB/repo2", "orgB/repo2"},
 	})
 	fakeGit.AssertCalledWith(t, [][]string{
 		{"checkout", "work/orgA/repo1", testsupport.Pwd()},
@@ -278,7 +304,9 @@ func TestItClonesReposFromOtherHosts(t *testing.T) {
 
 	fakeGitHub.AssertCalledWith(t, [][]string{
 		{"work/orgA", "mygitserver.com/orgA/repo1"},
+		{"work/orgA/repo1", "mygitserver.com/orgA/repo1"},
 		{"work/orgB", "orgB/repo2"},
+		{"work/orgB/repo2", "orgB/repo2"},
 	})
 	fakeGit.AssertCalledWith(t, [][]string{
 		{"checkout", "work/orgA/repo1", testsupport.Pwd()},
@@ -309,6 +337,337 @@ func TestItSkipsCloningIfAWorkingCopyAlreadyExists(t *testing.T) {
 	})
 }
 
+func TestItClonesUsingTheReferenceCache(t *testing.T) {
+	fakeGitHub := github.NewAlwaysSucceedsFakeGitHub()
+	gh = fakeGitHub
+	fakeGit := git.NewAlwaysSucceedsFakeGit()
+	g = fakeGit
+
+	testsupport.PrepareTempCampaign(false, "org/repo1")
+	cacheDir := t.TempDir()
+	mirrorPath := filepath.Join(cacheDir, "github.com", "org", "repo1.git")
+
+	out, err := runCloneCommandWithArgs("--no-fork", "--reference-cache="+cacheDir)
+	assert.NoError(t, err)
+	assert.Contains(t, out, "turbolift clone completed (1 repos cloned, 0 repos skipped)")
+
+	fakeGit.AssertCalledWith(t, [][]string{
+		{"cloneMirror", "https://github.com/org/repo1.git", mirrorPath},
+		{"checkout", "work/org/repo1", filepath.Base(testsupport.Pwd())},
+	})
+	fakeGitHub.AssertCalledWith(t, [][]string{
+		{"work/org", "org/repo1", "--reference-if-able", mirrorPath, "--dissociate"},
+		{"work/org/repo1", "org/repo1"},
+	})
+}
+
+func TestItAddsWorktreesOfSharedClones(t *testing.T) {
+	fakeGitHub := github.NewAlwaysSucceedsFakeGitHub()
+	gh = fakeGitHub
+	fakeGit := git.NewAlwaysSucceedsFakeGit()
+	g = fakeGit
+
+	testsupport.PrepareTempCampaign(false, "org/repo1")
+	storeDir := t.TempDir()
+	sharedPath := filepath.Join(storeDir, "github.com", "org", "repo1.git")
+	workingCopyPath, err := filepath.Abs(filepath.Join("work", "org", "repo1"))
+	assert.NoError(t, err)
+
+	out, err := runCloneCommandWithArgs("--no-fork", "--worktrees="+storeDir, "--filter", "blob:none")
+	assert.NoError(t, err)
+	assert.Contains(t, out, "Adding a worktree of org/repo1 at work/org/repo1")
+	assert.Contains(t, out, "turbolift clone completed (1 repos cloned, 0 repos skipped)")
+
+	fakeGit.AssertCalledWith(t, [][]string{
+		{"cloneShared", "https://github.com/org/repo1.git", sharedPath, "--filter=blob:none"},
+		{"updateShared", sharedPath},
+		{"addWorktreeBranch", sharedPath, workingCopyPath, filepath.Base(testsupport.Pwd()), "origin/HEAD"},
+	})
+	fakeGitHub.AssertCalledWith(t, [][]string{
+		{"work/org/repo1", "org/repo1"},
+	})
+}
+
+func TestItOnlyAddsWorktreesWithoutForks(t *testing.T) {
+	fakeGitHub := github.NewAlwaysSucceedsFakeGitHub()
+	gh = fakeGitHub
+	fakeGit := git.NewAlwaysSucceedsFakeGit()
+	g = fakeGit
+
+	testsupport.PrepareTempCampaign(false, "org/repo1")
+
+	out, err := runCloneCommandWithArgs("--worktrees=" + t.TempDir())
+	assert.NoError(t, err)
+	assert.Contains(t, out, "--worktrees requires --no-fork")
+
+	fakeGit.AssertCalledWith(t, [][]string{})
+	fakeGitHub.AssertCalledWith(t, [][]string{})
+}
+
+func TestItRetriesTransientFailuresAfterTheOtherRepos(t *testing.T) {
+	retryDelay = 0
+	attempts := 0
+	fakeGitHub := github.NewFakeGitHub(func(command github.Command, args []string) (bool, error) {
+		if command == github.GetDefaultBranchName {
+			return true, nil
+		}
+		if args[1] == "org/repo1" {
+			attempts++
+			// git leaves a partial working copy behind
+			_ = os.MkdirAll(path.Join(args[0], "repo1", ".git"), 0o755)
+			if attempts == 1 {
+				return false, errors.New("fatal: unable to access 'https://github.com/org/repo1/': Could not resolve host: github.com")
+			}
+		}
+		_ = os.MkdirAll(path.Join(args[0], path.Base(args[1])), 0o755)
+		return true, nil
+	}, nil)
+	gh = fakeGitHub
+	g = git.NewAlwaysSucceedsFakeGit()
+
+	testsupport.PrepareTempCampaign(false, "org/repo1", "org/repo2")
+
+	out, err := runCloneCommandWithArgs("--no-fork")
+	assert.NoError(t, err)
+	assert.Contains(t, out, "Retrying 1 repositories which failed with transient errors")
+	assert.Contains(t, out, "turbolift clone completed (2 repos cloned, 0 repos skipped)")
+
+	fakeGitHub.AssertCalledWith(t, [][]string{
+		{"work/org", "org/repo1"},
+		{"work/org", "org/repo2"},
+		{"work/org/repo2", "org/repo2"},
+		{"work/org", "org/repo1"},
+		{"work/org/repo1", "org/repo1"},
+	})
+}
+
+func TestItGivesUpOnTransientFailuresAfterRetrying(t *testing.T) {
+	retryDelay = 0
+	fakeGitHub := github.NewFakeGitHub(func(command github.Command, args []string) (bool, error) {
+		return false, errors.New("error: RPC failed; curl 56 GnuTLS recv error (-9): A TLS packet with unexpected length was received.")
+	}, nil)
+	gh = fakeGitHub
+	g = git.NewAlwaysSucceedsFakeGit()
+
+	testsupport.PrepareTempCampaign(false, "org/repo1")
+
+	out, err := runCloneCommandWithArgs("--no-fork", "--retries", "1")
+	assert.NoError(t, err)
+	assert.Contains(t, out, "turbolift clone completed with errors (0 repos cloned, 0 repos skipped, 1 repos errored)")
+
+	fakeGitHub.AssertCalledWith(t, [][]string{
+		{"work/org", "org/repo1"},
+		{"work/org", "org/repo1"},
+	})
+}
+
+func TestItPausesAndRetriesClonesWhichTheServerThrottles(t *testing.T) {
+	retryDelay = 0
+	throttlePause = 0
+	defer func() { throttlePause = 30 * time.Second }()
+	attempts := 0
+	fakeGitHub := github.NewFakeGitHub(func(command github.Command, args []string) (bool, error) {
+		if command == github.Clone {
+			attempts++
+			if attempts == 1 {
+				return false, errors.New("error: RPC failed; HTTP 429 curl 22 The requested URL returned error: 429")
+			}
+			_ = os.MkdirAll(path.Join(args[0], path.Base(args[1])), 0o755)
+		}
+		return true, nil
+	}, nil)
+	gh = fakeGitHub
+	g = git.NewAlwaysSucceedsFakeGit()
+
+	testsupport.PrepareTempCampaign(false, "org/repo1", "org/repo2")
+
+	out, err := runCloneCommandWithArgs("--no-fork")
+	assert.NoError(t, err)
+	assert.Contains(t, out, "The git server is throttling clones - pausing for 0s, then cloning 1 at once")
+	assert.Contains(t, out, "Retrying 1 repositories which failed with transient errors")
+	assert.Contains(t, out, "turbolift clone completed (2 repos cloned, 0 repos skipped)")
+}
+
+func TestItRefusesToLimitBandwidthThroughAnotherProxy(t *testing.T) {
+	fakeGitHub := github.NewAlwaysSucceedsFakeGitHub()
+	gh = fakeGitHub
+	g = git.NewAlwaysSucceedsFakeGit()
+
+	testsupport.PrepareTempCampaign(false, "org/repo1")
+	_ = os.Setenv("HTTPS_PROXY", "http://proxy.example.com:3128")
+	defer func() { _ = os.Unsetenv("HTTPS_PROXY") }()
+
+	out, err := runCloneCommandWithArgs("--no-fork", "--bandwidth", "1M")
+	assert.NoError(t, err)
+	assert.Contains(t, out, "--bandwidth cannot be combined with a proxy in HTTPS_PROXY")
+
+	fakeGitHub.AssertCalledWith(t, [][]string{})
+}
+
+func TestItRemovesIncompleteWorkingCopiesSoThatTheyAreClonedAgain(t *testing.T) {
+	fakeGitHub := github.NewFakeGitHub(func(command github.Command, args []string) (bool, error) {
+		_ = os.MkdirAll(path.Join(args[0], path.Base(args[1])), 0o755)
+		return true, nil
+	}, nil)
+	gh = fakeGitHub
+	fakeGit := git.NewAlwaysFailsFakeGit()
+	g = fakeGit
+
+	testsupport.PrepareTempCampaign(false, "org/repo1")
+
+	out, err := runCloneCommandWithArgs("--no-fork")
+	assert.NoError(t, err)
+	assert.Contains(t, out, "1 repos errored")
+
+	// the campaign branch could not be created, so nothing is left to be mistaken for a complete working copy
+	_, err = os.Stat("work/org/repo1")
+	assert.True(t, os.IsNotExist(err))
+
+	fakeGitHub.AssertCalledWith(t, [][]string{
+		{"work/org", "org/repo1"},
+		{"work/org/repo1", "org/repo1"},
+	})
+}
+
+func TestItMakesPartialClones(t *testing.T) {
+	fakeGitHub := github.NewAlwaysSucceedsFakeGitHub()
+	gh = fakeGitHub
+	g = git.NewAlwaysSucceedsFakeGit()
+
+	testsupport.PrepareTempCampaign(false, "org/repo1")
+
+	out, err := runCloneCommandWithArgs("--no-fork", "--filter", "blob:none")
+	assert.NoError(t, err)
+	assert.Contains(t, out, "turbolift clone completed (1 repos cloned, 0 repos skipped)")
+
+	fakeGitHub.AssertCalledWith(t, [][]string{
+		{"work/org", "org/repo1", "--filter=blob:none"},
+		{"work/org/repo1", "org/repo1"},
+	})
+}
+
+func TestItClonesSubmodulesWhenAsked(t *testing.T) {
+	fakeGitHub := github.NewAlwaysSucceedsFakeGitHub()
+	gh = fakeGitHub
+	g = git.NewAlwaysSucceedsFakeGit()
+
+	testsupport.PrepareTempCampaign(false, "org/repo1")
+
+	out, err := runCloneCommandWithArgs("--no-fork", "--filter", "blob:none", "--recurse-submodules")
+	assert.NoError(t, err)
+	assert.Contains(t, out, "turbolift clone completed (1 repos cloned, 0 repos skipped)")
+
+	fakeGitHub.AssertCalledWith(t, [][]string{
+		{"work/org", "org/repo1", "--filter=blob:none", "--recurse-submodules"},
+		{"work/org/repo1", "org/repo1"},
+	})
+}
+
+func TestItRejectsUnsupportedFilters(t *testing.T) {
+	fakeGitHub := github.NewAlwaysSucceedsFakeGitHub()
+	gh = fakeGitHub
+	g = git.NewAlwaysSucceedsFakeGit()
+
+	testsupport.PrepareTempCampaign(false, "org/repo1")
+
+	out, err := runCloneCommandWithArgs("--filter", "sparse:oid=abc")
+	assert.NoError(t, err)
+	assert.Contains(t, out, "unsupported --filter sparse:oid=abc")
+
+	out, err = runCloneCommandWithArgs("--filter", "tree:0", "--reference-cache")
+	assert.NoError(t, err)
+	assert.Contains(t, out, "--filter cannot be combined with --reference-cache")
+
+	fakeGitHub.AssertCalledWith(t, [][]string{})
+}
+
+func TestItSetsUpLFSInReposWhichUseIt(t *testing.T) {
+	gh = fakeGitHubCloningLFSRepos()
+	fakeGit := git.NewAlwaysSucceedsFakeGit()
+	g = fakeGit
+
+	testsupport.PrepareTempCampaign(false, "org/repo1")
+
+	out, err := runCloneCommandWithArgs("--no-fork")
+	assert.NoError(t, err)
+	assert.Contains(t, out, "turbolift clone completed (1 repos cloned, 0 repos skipped)")
+
+	fakeGit.AssertCalledWith(t, [][]string{
+		{"checkLFSInstalled"},
+		{"initLFS", "work/org/repo1", "false"},
+		{"checkout", "work/org/repo1", filepath.Base(testsupport.Pwd())},
+	})
+}
+
+func TestItFailsClearlyWhenLFSIsNotInstalled(t *testing.T) {
+	gh = fakeGitHubCloningLFSRepos()
+	fakeGit := git.NewFakeGit(func(_ io.Writer, call []string) (bool, error) {
+		if call[0] == "checkLFSInstalled" {
+			return false, errors.New("git: 'lfs' is not a git command")
+		}
+		return true, nil
+	})
+	g = fakeGit
+
+	testsupport.PrepareTempCampaign(false, "org/repo1")
+
+	out, err := runCloneCommandWithArgs("--no-fork")
+	assert.NoError(t, err)
+	assert.Contains(t, out, "this repository uses Git LFS, but git-lfs is not installed")
+	assert.Contains(t, out, "1 repos errored")
+
+	// removed, so that it is cloned again once git-lfs is installed
+	_, err = os.Stat("work/org/repo1")
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestItCanLeaveLFSFilesAsPointers(t *testing.T) {
+	defer func() {
+		_ = os.Unsetenv("GIT_LFS_SKIP_SMUDGE")
+	}()
+	gh = fakeGitHubCloningLFSRepos()
+	fakeGit := git.NewAlwaysSucceedsFakeGit()
+	g = fakeGit
+
+	testsupport.PrepareTempCampaign(false, "org/repo1")
+
+	out, err := runCloneCommandWithArgs("--no-fork", "--skip-lfs")
+	assert.NoError(t, err)
+	assert.Contains(t, out, "turbolift clone completed (1 repos cloned, 0 repos skipped)")
+	assert.Equal(t, "1", os.Getenv("GIT_LFS_SKIP_SMUDGE"))
+
+	fakeGit.AssertCalledWith(t, [][]string{
+		{"checkLFSInstalled"},
+		{"initLFS", "work/org/repo1", "true"},
+		{"checkout", "work/org/repo1", filepath.Base(testsupport.Pwd())},
+	})
+}
+
+// fakeGitHubCloningLFSRepos creates a working copy which stores files with LFS for each repository cloned
+func fakeGitHubCloningLFSRepos() *github.FakeGitHub {
+	return github.NewFakeGitHub(func(command github.Command, args []string) (bool, error) {
+		if command == github.Clone {
+			repoDirPath := filepath.Join(args[0], path.Base(args[1]))
+			if err := os.MkdirAll(repoDirPath, 0o755); err != nil {
+				return false, err
+			}
+			return true, ioutil.WriteFile(filepath.Join(repoDirPath, ".gitattributes"), []byte("*.psd filter=lfs diff=lfs merge=lfs -text\n"), 0o644)
+		}
+		return true, nil
+	}, func(workingDir string) (interface{}, error) {
+		return nil, nil
+	})
+}
+
+func runCloneCommandWithArgs(args ...string) (string, error) {
+	cmd := NewCloneCmd()
+	cmd.SetArgs(args)
+	outBuffer := bytes.NewBufferString("")
+	cmd.SetOut(outBuffer)
+	err := cmd.Execute()
+	return outBuffer.String(), err
+}
+
 func runCloneCommand() (string, error) {
 	cmd := NewCloneCmd()
 	outBuffer := bytes.NewBufferString("")
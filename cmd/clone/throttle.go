@@ -0,0 +1,120 @@
+/*
+ * Copyright 2021 Skyscanner Limited.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * https://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package clone
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/skyscanner/turbolift/internal/interrupt"
+	"github.com/skyscanner/turbolift/internal/logging"
+)
+
+// How clones slow down when the git server says it is throttling them: the number at once is halved and all clones
+// pause, for longer each time it happens again, until enough clones succeed in a row to speed up again
+var (
+	throttlePause    = 30 * time.Second
+	maxThrottlePause = 10 * time.Minute
+	throttleWaitStep = 100 * time.Millisecond
+)
+
+// throttleRecovery is how many clones must succeed in a row before one more is allowed at once
+const throttleRecovery = 10
+
+// throttlingErrors are the messages of git, gh and the server which mean that clones are being throttled
+var throttlingErrors = []string{
+	"http 429",
+	"returned error: 429",
+	"too many requests",
+	"rate limit exceeded",
+	"secondary rate limit",
+	"abuse detection",
+}
+
+func isThrottled(output string) bool {
+	output = strings.ToLower(output)
+	for _, message := range throttlingErrors {
+		if strings.Contains(output, message) {
+			return true
+		}
+	}
+	return false
+}
+
+// throttle limits how many clones run at once, adapting the limit to throttling by the git server
+type throttle struct {
+	logger *logging.Logger
+
+	mutex       sync.Mutex
+	max         int
+	limit       int
+	active      int
+	pause       time.Duration
+	pausedUntil time.Time
+	successes   int
+}
+
+func newThrottle(logger *logging.Logger, max int) *throttle {
+	return &throttle{logger: logger, max: max, limit: max}
+}
+
+// acquire waits until another clone may start, returning false if the command is interrupted while waiting
+func (t *throttle) acquire() bool {
+	for {
+		if interrupt.Requested() {
+			return false
+		}
+		t.mutex.Lock()
+		if t.active < t.limit && !time.Now().Before(t.pausedUntil) {
+			t.active++
+			t.mutex.Unlock()
+			return true
+		}
+		t.mutex.Unlock()
+		time.Sleep(throttleWaitStep)
+	}
+}
+
+// release ends a clone, slowing down if the server throttled it and speeding up again after enough clones succeed
+func (t *throttle) release(throttled bool) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.active--
+
+	if !throttled {
+		t.successes++
+		if t.successes >= throttleRecovery && t.limit < t.max {
+			t.limit++
+			t.successes = 0
+		}
+		return
+	}
+
+	t.successes = 0
+	if t.limit > 1 {
+		t.limit /= 2
+	}
+	t.pause *= 2
+	if t.pause == 0 {
+		t.pause = throttlePause
+	}
+	if t.pause > maxThrottlePause {
+		t.pause = maxThrottlePause
+	}
+	t.pausedUntil = time.Now().Add(t.pause)
+	t.logger.Warnf("The git server is throttling clones - pausing for %s, then cloning %d at once", t.pause, t.limit)
+}
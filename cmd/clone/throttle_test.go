@@ -0,0 +1,75 @@
+/*
+ * Copyright 2021 Skyscanner Limited.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * https://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package clone
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/skyscanner/turbolift/internal/logging"
+)
+
+func TestItRecognisesThrottlingErrors(t *testing.T) {
+	assert.True(t, isThrottled("error: RPC failed; HTTP 429 curl 22 The requested URL returned error: 429"))
+	assert.True(t, isThrottled("You have exceeded a secondary rate limit. Please wait a few minutes before you try again."))
+	assert.False(t, isThrottled("fatal: repository 'https://github.com/org/repo1/' not found"))
+}
+
+func TestItHalvesTheClonesAtOnceAndPausesWhenThrottled(t *testing.T) {
+	throttle := newTestThrottle(8)
+
+	assert.True(t, throttle.acquire())
+	throttle.release(true)
+	assert.Equal(t, 4, throttle.limit)
+	assert.Equal(t, throttlePause, throttle.pause)
+	assert.True(t, throttle.pausedUntil.After(time.Now()))
+
+	throttle.release(true)
+	assert.Equal(t, 2, throttle.limit)
+	assert.Equal(t, 2*throttlePause, throttle.pause)
+}
+
+func TestItNeverPausesForLongerThanTheMaximum(t *testing.T) {
+	throttle := newTestThrottle(1)
+	for i := 0; i < 10; i++ {
+		throttle.release(true)
+	}
+	assert.Equal(t, 1, throttle.limit)
+	assert.Equal(t, maxThrottlePause, throttle.pause)
+}
+
+func TestItClonesMoreAtOnceAgainAfterEnoughSucceed(t *testing.T) {
+	throttle := newTestThrottle(4)
+	throttle.release(true)
+	assert.Equal(t, 2, throttle.limit)
+
+	for i := 0; i < throttleRecovery-1; i++ {
+		throttle.release(false)
+	}
+	assert.Equal(t, 2, throttle.limit)
+	throttle.release(false)
+	assert.Equal(t, 3, throttle.limit)
+}
+
+func newTestThrottle(max int) *throttle {
+	c := &cobra.Command{}
+	c.SetOut(bytes.NewBufferString(""))
+	return newThrottle(logging.NewLogger(c), max)
+}
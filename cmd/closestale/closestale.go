@@ -0,0 +1,222 @@
+/*
+ * Copyright 2021 Skyscanner Limited.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * https://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package closestale
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/skyscanner/turbolift/internal/campaign"
+	"github.com/skyscanner/turbolift/internal/colors"
+	"github.com/skyscanner/turbolift/internal/github"
+	"github.com/skyscanner/turbolift/internal/interrupt"
+	"github.com/skyscanner/turbolift/internal/logging"
+	"github.com/skyscanner/turbolift/internal/prompt"
+)
+
+var (
+	gh github.GitHub = github.NewCachingGitHub(github.NewGitHub())
+	p  prompt.Prompt = prompt.NewRealPrompt()
+)
+
+var now = time.Now
+
+var (
+	repoFile    string
+	days        int
+	deadline    string
+	comment     string
+	commentFile string
+	commentOnly bool
+	dryRun      bool
+)
+
+func NewCloseStaleCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "close-stale",
+		Short: "Close the campaign's open PRs that have had no activity for a number of days, or after a deadline",
+		Long: `Close the campaign's open PRs which have had no activity (commits, comments, reviews or other updates) for
+--days days, or every open PR once the campaign's --deadline has passed. A comment explaining why can be left on each
+PR before it is closed, or with --comment-only the PRs can just be nudged with the comment instead. Designed to be run
+on a schedule, e.g. from CI.`,
+		Args: cobra.NoArgs,
+		Run:  run,
+	}
+
+	cmd.Flags().StringVar(&repoFile, "repos", "repos.txt", "A file containing a list of repositories to check.")
+	cmd.Flags().IntVar(&days, "days", 0, "Close PRs which have had no activity for this many days.")
+	cmd.Flags().StringVar(&deadline, "deadline", "", "Close every open PR if this date (YYYY-MM-DD) has passed, and none before then.")
+	cmd.Flags().StringVar(&comment, "comment", "", "A comment explaining why the PR is being closed, left on each PR before it is closed.")
+	cmd.Flags().StringVar(&commentFile, "comment-file", "", "A Markdown file containing the comment to leave on each PR.")
+	cmd.Flags().BoolVar(&commentOnly, "comment-only", false, "Leave the comment on each stale PR without closing it.")
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "Only show which PRs are stale, without changing anything.")
+
+	return cmd
+}
+
+func validateFlags() error {
+	if (days > 0) == (deadline != "") {
+		return errors.New("one of --days or --deadline must be given")
+	}
+	if days < 0 {
+		return errors.New("--days must be positive")
+	}
+	if comment != "" && commentFile != "" {
+		return errors.New("only one of --comment and --comment-file can be given")
+	}
+	if commentOnly && comment == "" && commentFile == "" {
+		return errors.New("--comment-only needs a comment, given with --comment or --comment-file")
+	}
+	return nil
+}
+
+func run(c *cobra.Command, _ []string) {
+	logger := logging.NewLogger(c)
+	if err := validateFlags(); err != nil {
+		logger.FlagErrorf("%v", err)
+		return
+	}
+
+	readCampaignActivity := logger.StartSetupActivity("Reading campaign data (%s)", repoFile)
+	options := campaign.NewCampaignOptions()
+	options.RepoFilename = repoFile
+	dir, err := campaign.OpenCampaign(options)
+	if err != nil {
+		readCampaignActivity.EndWithFailure(err)
+		return
+	}
+	if commentFile != "" {
+		contents, err := ioutil.ReadFile(commentFile)
+		if err != nil {
+			readCampaignActivity.EndWithFailure(fmt.Errorf("unable to read comment file: %w", err))
+			return
+		}
+		comment = strings.TrimSpace(string(contents))
+	}
+	var deadlineTime time.Time
+	if deadline != "" {
+		deadlineTime, err = time.ParseInLocation("2006-01-02", deadline, time.Local)
+		if err != nil {
+			readCampaignActivity.EndWithFailure(fmt.Errorf("invalid deadline %s - expected a date such as 2021-12-31", deadline))
+			return
+		}
+		// the deadline is the end of the given day
+		deadlineTime = deadlineTime.AddDate(0, 0, 1)
+	}
+	readCampaignActivity.EndWithSuccess()
+
+	if deadline != "" && now().Before(deadlineTime) {
+		logger.Successf("The deadline of %s has not passed yet, so no PRs are stale\n", deadline)
+		return
+	}
+
+	action := "Close"
+	if commentOnly {
+		action = "Comment on"
+	}
+	if !dryRun && !prompt.AssumeYes() {
+		var question string
+		if deadline != "" {
+			question = fmt.Sprintf("%s every open PR from the %s campaign, as its deadline has passed?", action, dir.Name)
+		} else {
+			question = fmt.Sprintf("%s open PRs from the %s campaign with no activity for %d days?", action, dir.Name, days)
+		}
+		if !p.AskConfirm(prompt.CloseStale, question) {
+			return
+		}
+	}
+
+	var staleCount, activeCount, skippedCount, errorCount int
+	interrupt.ForEachRepo(logger, dir.Repos, func(repo campaign.Repo) {
+		repoDirPath := repo.FullRepoPath()
+
+		checkActivity := logger.StartActivity("Checking for a stale PR in %s", repo.FullRepoName)
+		// skip if the working copy does not exist
+		if _, err = os.Stat(repoDirPath); os.IsNotExist(err) {
+			checkActivity.EndWithWarningf("Directory %s does not exist - has it been cloned?", repoDirPath)
+			skippedCount++
+			return
+		}
+
+		pr, err := gh.GetPR(checkActivity.Writer(), repoDirPath, dir.Name)
+		if err != nil {
+			if _, ok := err.(*github.NoPRFoundError); ok {
+				checkActivity.EndWithWarning(err)
+				skippedCount++
+			} else {
+				checkActivity.EndWithFailure(err)
+				errorCount++
+			}
+			return
+		}
+
+		if pr.State != "OPEN" {
+			checkActivity.EndWithWarningf("PR is %s", strings.ToLower(pr.State))
+			skippedCount++
+			return
+		}
+
+		idle := now().Sub(pr.UpdatedAt)
+		if deadline == "" && idle < time.Duration(days)*24*time.Hour {
+			checkActivity.EndWithSuccess()
+			activeCount++
+			return
+		}
+
+		idleDays := int(idle.Hours() / 24)
+		if dryRun {
+			checkActivity.EndWithWarningf("Would %s PR with no activity for %d days: %s", strings.ToLower(action), idleDays, pr.Url)
+			staleCount++
+			return
+		}
+
+		if commentOnly {
+			err = gh.CommentOnPullRequest(checkActivity.Writer(), repoDirPath, dir.Name, comment)
+		} else {
+			err = gh.ClosePullRequest(checkActivity.Writer(), repoDirPath, dir.Name, comment)
+		}
+		if err != nil {
+			checkActivity.EndWithFailure(err)
+			errorCount++
+			return
+		}
+		checkActivity.EndWithWarningf("%s PR with no activity for %d days: %s", pastTense(action), idleDays, pr.Url)
+		staleCount++
+	})
+
+	staleLabel := " " + strings.ToLower(pastTense(action))
+	if dryRun {
+		staleLabel = " stale"
+	}
+	if errorCount == 0 {
+		logger.Successf("turbolift close-stale completed %s(%s, %s, %s)\n", colors.Normal(), colors.Yellow(staleCount, staleLabel), colors.Green(activeCount, " active"), colors.Yellow(skippedCount, " skipped"))
+	} else {
+		logger.Warnf("turbolift close-stale completed with %s %s(%s, %s, %s, %s)\n", colors.Red("errors"), colors.Normal(), colors.Yellow(staleCount, staleLabel), colors.Green(activeCount, " active"), colors.Yellow(skippedCount, " skipped"), colors.Red(errorCount, " errored"))
+	}
+}
+
+func pastTense(action string) string {
+	if action == "Close" {
+		return "Closed"
+	}
+	return "Commented on"
+}
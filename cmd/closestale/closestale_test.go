@@ -0,0 +1,189 @@
+/*
+ * Copyright 2021 Skyscanner Limited.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * https://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package closestale
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/skyscanner/turbolift/internal/github"
+	"github.com/skyscanner/turbolift/internal/prompt"
+	"github.com/skyscanner/turbolift/internal/testsupport"
+)
+
+func init() {
+	// disable output colouring so that strings we want to do 'Contains' checks on do not have ANSI escape sequences in IDEs
+	_ = os.Setenv("NO_COLOR", "1")
+	now = func() time.Time {
+		return time.Date(2021, 6, 30, 12, 0, 0, 0, time.Local)
+	}
+}
+
+// fakeGitHubWithPRs has an open PR in repo1 last updated 40 days ago, and one in repo2 updated 2 days ago
+func fakeGitHubWithPRs() *github.FakeGitHub {
+	return github.NewFakeGitHub(func(github.Command, []string) (bool, error) {
+		return true, nil
+	}, func(workingDir string) (interface{}, error) {
+		updatedAt := now().AddDate(0, 0, -2)
+		if workingDir == "work/org/repo1" {
+			updatedAt = now().AddDate(0, 0, -40)
+		}
+		return &github.PrStatus{State: "OPEN", UpdatedAt: updatedAt, Url: "https://github.com/" + workingDir}, nil
+	})
+}
+
+func TestItClosesPRsWithNoRecentActivity(t *testing.T) {
+	fakeGitHub := fakeGitHubWithPRs()
+	gh = fakeGitHub
+	p = prompt.NewFakePromptYes()
+
+	tempDir := testsupport.PrepareTempCampaign(true, "org/repo1", "org/repo2")
+
+	out, err := runCommand("--days", "30", "--comment", "Closing as this campaign has been withdrawn")
+	assert.NoError(t, err)
+	assert.Contains(t, out, "Closed PR with no activity for 40 days: https://github.com/work/org/repo1")
+	assert.Contains(t, out, "turbolift close-stale completed (1 closed, 1 active, 0 skipped)")
+
+	fakeGitHub.AssertCalledWith(t, [][]string{
+		{"work/org/repo1"},
+		{"work/org/repo1", filepath.Base(tempDir), "Closing as this campaign has been withdrawn"},
+		{"work/org/repo2"},
+	})
+}
+
+func TestItOnlyCommentsWhenAsked(t *testing.T) {
+	fakeGitHub := fakeGitHubWithPRs()
+	gh = fakeGitHub
+	p = prompt.NewFakePromptYes()
+
+	tempDir := testsupport.PrepareTempCampaign(true, "org/repo1", "org/repo2")
+
+	out, err := runCommand("--days", "1", "--comment", "Friendly reminder", "--comment-only")
+	assert.NoError(t, err)
+	assert.Contains(t, out, "turbolift close-stale completed (2 commented on, 0 active, 0 skipped)")
+
+	fakeGitHub.AssertCalledWith(t, [][]string{
+		{"work/org/repo1"},
+		{"work/org/repo1", filepath.Base(tempDir), "Friendly reminder"},
+		{"work/org/repo2"},
+		{"work/org/repo2", filepath.Base(tempDir), "Friendly reminder"},
+	})
+}
+
+func TestItDoesNothingBeforeTheDeadline(t *testing.T) {
+	fakeGitHub := fakeGitHubWithPRs()
+	gh = fakeGitHub
+	p = prompt.NewFakePromptYes()
+
+	testsupport.PrepareTempCampaign(true, "org/repo1", "org/repo2")
+
+	out, err := runCommand("--deadline", "2021-06-30")
+	assert.NoError(t, err)
+	assert.Contains(t, out, "The deadline of 2021-06-30 has not passed yet, so no PRs are stale")
+
+	fakeGitHub.AssertCalledWith(t, [][]string{})
+}
+
+func TestItClosesEveryOpenPRAfterTheDeadline(t *testing.T) {
+	fakeGitHub := fakeGitHubWithPRs()
+	gh = fakeGitHub
+	p = prompt.NewFakePromptYes()
+
+	testsupport.PrepareTempCampaign(true, "org/repo1", "org/repo2")
+
+	out, err := runCommand("--deadline", "2021-06-29")
+	assert.NoError(t, err)
+	assert.Contains(t, out, "turbolift close-stale completed (2 closed, 0 active, 0 skipped)")
+}
+
+func TestItOnlyReportsStalePRsOnADryRun(t *testing.T) {
+	fakeGitHub := fakeGitHubWithPRs()
+	gh = fakeGitHub
+	p = prompt.NewFakePromptNo()
+
+	testsupport.PrepareTempCampaign(true, "org/repo1", "org/repo2")
+
+	out, err := runCommand("--days", "30", "--dry-run")
+	assert.NoError(t, err)
+	assert.Contains(t, out, "Would close PR with no activity for 40 days")
+	assert.Contains(t, out, "turbolift close-stale completed (1 stale, 1 active, 0 skipped)")
+
+	fakeGitHub.AssertCalledWith(t, [][]string{
+		{"work/org/repo1"},
+		{"work/org/repo2"},
+	})
+}
+
+func TestItDoesNotClosePRsIfNotConfirmed(t *testing.T) {
+	fakeGitHub := fakeGitHubWithPRs()
+	gh = fakeGitHub
+	p = prompt.NewFakePromptNo()
+
+	testsupport.PrepareTempCampaign(true, "org/repo1", "org/repo2")
+
+	out, err := runCommand("--days", "30")
+	assert.NoError(t, err)
+	assert.NotContains(t, out, "turbolift close-stale completed")
+
+	fakeGitHub.AssertCalledWith(t, [][]string{})
+}
+
+func TestItValidatesFlags(t *testing.T) {
+	testCases := []struct {
+		Name          string
+		Args          []string
+		ExpectedError string
+	}{
+		{"no threshold", []string{}, "one of --days or --deadline must be given"},
+		{"both thresholds", []string{"--days", "3", "--deadline", "2021-01-01"}, "one of --days or --deadline must be given"},
+		{"comment only without a comment", []string{"--days", "3", "--comment-only"}, "--comment-only needs a comment"},
+		{"two comments", []string{"--days", "3", "--comment", "a", "--comment-file", "b"}, "only one of --comment and --comment-file can be given"},
+		{"invalid deadline", []string{"--deadline", "31/12/2021"}, "invalid deadline 31/12/2021 - expected a date such as 2021-12-31"},
+		{"missing comment file", []string{"--days", "3", "--comment-file", "missing.md"}, "unable to read comment file"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			fakeGitHub := fakeGitHubWithPRs()
+			gh = fakeGitHub
+
+			testsupport.PrepareTempCampaign(true, "org/repo1")
+
+			out, err := runCommand(tc.Args...)
+			assert.NoError(t, err)
+			assert.Contains(t, out, tc.ExpectedError)
+
+			fakeGitHub.AssertCalledWith(t, [][]string{})
+		})
+	}
+}
+
+func runCommand(args ...string) (string, error) {
+	cmd := NewCloseStaleCmd()
+	cmd.SetArgs(args)
+	outBuffer := bytes.NewBufferString("")
+	cmd.SetOut(outBuffer)
+	err := cmd.Execute()
+	if err != nil {
+		return outBuffer.String(), err
+	}
+	return outBuffer.String(), nil
+}
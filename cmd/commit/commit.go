@@ -16,38 +16,65 @@
 package commit
 
 import (
+	"errors"
+	"fmt"
+	"io"
 	"os"
-	"path"
+	"regexp"
+	"strings"
+	"text/template"
 
 	"github.com/spf13/cobra"
 
 	"github.com/skyscanner/turbolift/internal/campaign"
+	"github.com/skyscanner/turbolift/internal/changes"
 	"github.com/skyscanner/turbolift/internal/colors"
 	"github.com/skyscanner/turbolift/internal/git"
+	"github.com/skyscanner/turbolift/internal/interrupt"
 	"github.com/skyscanner/turbolift/internal/logging"
+	"github.com/skyscanner/turbolift/internal/secrets"
 )
 
 var g git.Git = git.NewRealGit()
 
 var (
-	message  string
-	repoFile string
+	message      string
+	messageFile  string
+	repoFile     string
+	secretRules  string
+	allowSecrets bool
+	submodules   string
+
+	trailers        []string
+	tickets         []string
+	coAuthors       []string
+	campaignTrailer bool
+	signoff         bool
 )
 
 func NewCommitCmd() *cobra.Command {
 	cmd := &cobra.Command{
 		Use:   "commit",
 		Short: "Applies git commit -a -m '...' to all working copies, if they have changes",
-		Run:   run,
+		Long: `Applies git commit -a -m '...' to all working copies, if they have changes.
+
+The commit message is a template, which can refer to {{.Campaign}}, {{.FullRepoName}}, {{.OrgName}} and {{.RepoName}}.
+So can trailers, which are appended to the message in the order: --trailer, --ticket, --co-author, the campaign
+trailer and the sign-off.`,
+		Run: run,
 	}
 
 	cmd.Flags().StringVarP(&message, "message", "m", "", "Commit message to apply")
+	cmd.Flags().StringVar(&messageFile, "message-file", "", "A file containing the commit message to apply, instead of --message.")
 	cmd.Flags().StringVar(&repoFile, "repos", "repos.txt", "A file containing a list of repositories to clone.")
-
-	err := cmd.MarkFlagRequired("message")
-	if err != nil {
-		panic(err)
-	}
+	cmd.Flags().StringVar(&secretRules, "secret-rules", "", "A gitleaks configuration file with rules for secrets to check for, in addition to the built-in rules.")
+	cmd.Flags().BoolVar(&allowSecrets, "allow-secrets", false, "Commit changes even where they appear to contain secrets.")
+	cmd.Flags().StringVar(&submodules, "submodules", "ignore", "What to do with submodules which have been moved to other commits: ignore, leaving them uncommitted, or include them in the commit.")
+	cmd.Flags().StringArrayVar(&trailers, "trailer", nil, "A trailer to append to the commit message, as 'Key: value' or Key=value. May be repeated.")
+	cmd.Flags().StringArrayVar(&tickets, "ticket", nil, "A ticket to refer to with a 'Ticket:' trailer. May be repeated.")
+	cmd.Flags().StringArrayVar(&coAuthors, "co-author", nil, "A co-author to credit with a 'Co-authored-by:' trailer, as 'Name <email>'. May be repeated.")
+	cmd.Flags().BoolVar(&campaignTrailer, "campaign-trailer", false, "Append a 'Turbolift-Campaign:' trailer naming the campaign.")
+	cmd.Flags().BoolVarP(&signoff, "signoff", "s", false, "Append a 'Signed-off-by:' trailer with the commit author's identity, for repositories which enforce the Developer Certificate of Origin.")
 
 	return cmd
 }
@@ -55,7 +82,17 @@ func NewCommitCmd() *cobra.Command {
 func run(c *cobra.Command, _ []string) {
 	logger := logging.NewLogger(c)
 
-	readCampaignActivity := logger.StartActivity("Reading campaign data (%s)", repoFile)
+	if (message == "") == (messageFile == "") {
+		logger.FlagErrorf("one of --message and --message-file is required")
+		return
+	}
+
+	if submodules != "ignore" && submodules != "include" {
+		logger.FlagErrorf("--submodules must be ignore or include, not %s", submodules)
+		return
+	}
+
+	readCampaignActivity := logger.StartSetupActivity("Reading campaign data (%s)", repoFile)
 	options := campaign.NewCampaignOptions()
 	options.RepoFilename = repoFile
 	dir, err := campaign.OpenCampaign(options)
@@ -63,13 +100,28 @@ func run(c *cobra.Command, _ []string) {
 		readCampaignActivity.EndWithFailure(err)
 		return
 	}
+	rules, err := secrets.LoadRules(secretRules)
+	if err != nil {
+		readCampaignActivity.EndWithFailure(err)
+		return
+	}
+	messageTemplate, err := readMessageTemplate()
+	if err != nil {
+		readCampaignActivity.EndWithFailure(err)
+		return
+	}
+	trailerTemplates, err := parseTrailers()
+	if err != nil {
+		readCampaignActivity.EndWithFailure(err)
+		return
+	}
 	readCampaignActivity.EndWithSuccess()
 
 	doneCount := 0
 	skippedCount := 0
 	errorCount := 0
-	for _, repo := range dir.Repos {
-		repoDirPath := path.Join("work", repo.OrgName, repo.RepoName) // i.e. work/org/repo
+	interrupt.ForEachRepo(logger, dir.Repos, func(repo campaign.Repo) {
+		repoDirPath := repo.FullRepoPath()
 
 		commitActivity := logger.StartActivity("Committing changes in %s", repo.FullRepoName)
 
@@ -77,31 +129,92 @@ func run(c *cobra.Command, _ []string) {
 		if _, err = os.Stat(repoDirPath); os.IsNotExist(err) {
 			commitActivity.EndWithWarningf("Directory %s does not exist - has it been cloned?", repoDirPath)
 			skippedCount++
-			continue
+			return
+		}
+
+		var wrongBranchError *changes.WrongBranchError
+		if err := changes.CheckProfileBranch(commitActivity.Writer(), g, repoDirPath, dir.Name); errors.As(err, &wrongBranchError) {
+			commitActivity.EndWithWarning(err)
+			skippedCount++
+			return
+		} else if err != nil {
+			commitActivity.EndWithFailure(err)
+			errorCount++
+			return
 		}
 
 		isChanged, err := g.IsRepoChanged(commitActivity.Writer(), repoDirPath)
 		if err != nil {
 			commitActivity.EndWithFailure(err)
 			errorCount++
-			continue
+			return
 		}
 
 		if !isChanged {
 			commitActivity.EndWithWarning("No changes - skipping commit")
 			skippedCount++
-			continue
+			return
+		}
+
+		if !allowSecrets {
+			err = secrets.CheckWorkingCopy(commitActivity.Writer(), g, repoDirPath, rules)
+			if err != nil {
+				commitActivity.EndWithFailuref("Not committing: %v", err)
+				errorCount++
+				return
+			}
+		}
+
+		commit := g.Commit
+		var leftOut []string
+		if git.HasSubmodules(repoDirPath) {
+			var skipReason string
+			commit, leftOut, skipReason, err = submoduleAwareCommit(commitActivity, repoDirPath)
+			if err != nil {
+				commitActivity.EndWithFailure(err)
+				errorCount++
+				return
+			}
+			if skipReason != "" {
+				commitActivity.EndWithWarning(skipReason)
+				skippedCount++
+				return
+			}
 		}
 
-		err = g.Commit(commitActivity.Writer(), repoDirPath, message)
+		renderedMessage, err := renderMessage(messageTemplate, trailerTemplates, campaign.NewTemplateData(dir, repo))
+		if err != nil {
+			commitActivity.EndWithFailuref("Unable to render the commit message: %v", err)
+			errorCount++
+			return
+		}
+
+		if signoff {
+			identity, err := g.AuthorIdentity(commitActivity.Writer(), repoDirPath)
+			if err != nil {
+				commitActivity.EndWithFailuref("Unable to sign off, as no git identity is configured: %v", err)
+				errorCount++
+				return
+			}
+			signedOffBy := "Signed-off-by: " + identity
+			if !strings.Contains(renderedMessage, signedOffBy) {
+				renderedMessage = appendTrailers(renderedMessage, []string{signedOffBy})
+			}
+		}
+
+		err = commit(commitActivity.Writer(), repoDirPath, renderedMessage)
 		if err != nil {
 			commitActivity.EndWithFailure(err)
 			errorCount++
+		} else if len(leftOut) > 0 {
+			commitActivity.Logf("Left out submodules moved to other commits: %s (use --submodules include to commit them)", strings.Join(leftOut, ", "))
+			commitActivity.EndWithSuccessAndEmitLogs()
+			doneCount++
 		} else {
 			commitActivity.EndWithSuccess()
 			doneCount++
 		}
-	}
+	})
 
 	if errorCount == 0 {
 		logger.Successf("turbolift commit completed %s(%s, %s)\n", colors.Normal(), colors.Green(doneCount, " OK"), colors.Yellow(skippedCount, " skipped"))
@@ -109,3 +222,114 @@ func run(c *cobra.Command, _ []string) {
 		logger.Warnf("turbolift commit completed with %s %s(%s, %s, %s)\n", colors.Red("errors"), colors.Normal(), colors.Green(doneCount, " OK"), colors.Yellow(skippedCount, " skipped"), colors.Red(errorCount, " errored"))
 	}
 }
+
+// submoduleAwareCommit chooses how to commit in a working copy with submodules, returning the submodules which it
+// leaves out, or gives a reason to skip the working copy if nothing but submodules would be committed
+func submoduleAwareCommit(activity *logging.Activity, repoDirPath string) (commit func(io.Writer, string, string) error, leftOut []string, skipReason string, err error) {
+	moved, otherChanges, err := g.ChangedSubmodules(activity.Writer(), repoDirPath)
+	if err != nil {
+		return nil, nil, "", err
+	}
+
+	if submodules == "include" {
+		if !otherChanges && len(moved) == 0 {
+			return nil, nil, "Only uncommitted changes within submodules - skipping commit", nil
+		}
+		return g.Commit, nil, "", nil
+	}
+
+	if !otherChanges {
+		return nil, nil, "Only submodules changed - skipping commit (use --submodules include to commit them)", nil
+	}
+	return g.CommitIgnoringSubmodules, moved, "", nil
+}
+
+// readMessageTemplate parses the commit message given with --message or --message-file
+func readMessageTemplate() (*template.Template, error) {
+	if messageFile != "" {
+		return campaign.ReadTemplateFile(messageFile, "commit message")
+	}
+	t, err := campaign.ParseTemplate("message", message)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse the commit message: %w", err)
+	}
+	return t, nil
+}
+
+var (
+	trailerPattern         = regexp.MustCompile(`^([A-Za-z0-9][A-Za-z0-9-]*)(?:: ?|=)(.+)$`)
+	existingTrailerPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9-]*: \S`)
+)
+
+// parseTrailers parses the trailers given with --trailer, --ticket, --co-author and --campaign-trailer, in that order
+func parseTrailers() ([]*template.Template, error) {
+	var all []string
+	for _, trailer := range trailers {
+		match := trailerPattern.FindStringSubmatch(trailer)
+		if match == nil {
+			return nil, fmt.Errorf("invalid trailer %q: expected 'Key: value' or Key=value", trailer)
+		}
+		all = append(all, match[1]+": "+strings.TrimSpace(match[2]))
+	}
+	for _, ticket := range tickets {
+		all = append(all, "Ticket: "+ticket)
+	}
+	for _, coAuthor := range coAuthors {
+		all = append(all, "Co-authored-by: "+coAuthor)
+	}
+	if campaignTrailer {
+		all = append(all, "Turbolift-Campaign: {{.Campaign}}")
+	}
+
+	var parsed []*template.Template
+	for _, trailer := range all {
+		t, err := campaign.ParseTemplate("trailer", trailer)
+		if err != nil {
+			return nil, fmt.Errorf("unable to parse trailer %q: %w", trailer, err)
+		}
+		parsed = append(parsed, t)
+	}
+	return parsed, nil
+}
+
+// renderMessage renders the commit message for a repository and appends any trailers to it
+func renderMessage(messageTemplate *template.Template, trailerTemplates []*template.Template, data campaign.TemplateData) (string, error) {
+	message, err := campaign.RenderTemplate(messageTemplate, data)
+	if err != nil || len(trailerTemplates) == 0 {
+		return message, err
+	}
+
+	var rendered []string
+	for _, t := range trailerTemplates {
+		trailer, err := campaign.RenderTemplate(t, data)
+		if err != nil {
+			return "", err
+		}
+		rendered = append(rendered, trailer)
+	}
+	return appendTrailers(message, rendered), nil
+}
+
+// appendTrailers appends trailers to a message, joining the message's own trailers if it ends with some
+func appendTrailers(message string, trailers []string) string {
+	message = strings.TrimRight(message, " \t\n")
+	separator := "\n\n"
+	if endsWithTrailers(message) {
+		separator = "\n"
+	}
+	return message + separator + strings.Join(trailers, "\n") + "\n"
+}
+
+// endsWithTrailers reports whether the last paragraph of a message, other than its subject, consists of trailers
+func endsWithTrailers(message string) bool {
+	paragraphs := strings.Split(message, "\n\n")
+	if len(paragraphs) < 2 {
+		return false
+	}
+	for _, line := range strings.Split(paragraphs[len(paragraphs)-1], "\n") {
+		if !existingTrailerPattern.MatchString(line) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,148 @@
+/*
+ * Copyright 2021 Skyscanner Limited.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * https://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package conflicts
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/fatih/color"
+	"github.com/rodaine/table"
+	"github.com/spf13/cobra"
+
+	"github.com/skyscanner/turbolift/internal/campaign"
+	"github.com/skyscanner/turbolift/internal/colors"
+	"github.com/skyscanner/turbolift/internal/github"
+	"github.com/skyscanner/turbolift/internal/interrupt"
+	"github.com/skyscanner/turbolift/internal/logging"
+)
+
+// defaultConflictedReposFile is written when --write-repos is given without a filename
+const defaultConflictedReposFile = "conflicted.txt"
+
+// gh is not cached, as GitHub may still be working out whether PRs can be merged, and will know when asked again
+var gh github.GitHub = github.NewGitHub()
+
+var (
+	repoFile       string
+	conflictedFile string
+)
+
+func NewConflictsCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "conflicts",
+		Short: "List open PRs which cannot be merged because of conflicts",
+		Run:   run,
+	}
+
+	cmd.Flags().StringVar(&repoFile, "repos", "repos.txt", "A file containing a list of repositories to check.")
+	cmd.Flags().StringVar(&conflictedFile, "write-repos", "", fmt.Sprintf("Write the conflicted repositories to a repo file, for use with --repos (%s if no filename is given).", defaultConflictedReposFile))
+	cmd.Flags().Lookup("write-repos").NoOptDefVal = defaultConflictedReposFile
+
+	return cmd
+}
+
+func run(c *cobra.Command, _ []string) {
+	logger := logging.NewLogger(c)
+
+	readCampaignActivity := logger.StartSetupActivity("Reading campaign data (%s)", repoFile)
+	options := campaign.NewCampaignOptions()
+	options.RepoFilename = repoFile
+	dir, err := campaign.OpenCampaign(options)
+	if err != nil {
+		readCampaignActivity.EndWithFailure(err)
+		return
+	}
+	readCampaignActivity.EndWithSuccess()
+
+	conflictsTable := table.New("Repository", "URL")
+	conflictsTable.WithHeaderFormatter(color.New(color.Underline).SprintfFunc())
+	conflictsTable.WithFirstColumnFormatter(colors.Cyanf)
+	conflictsTable.WithWriter(logger.Writer())
+
+	var conflicted []string
+	unknownCount := 0
+	skippedCount := 0
+	errorCount := 0
+	interrupt.ForEachRepo(logger, dir.Repos, func(repo campaign.Repo) {
+		repoDirPath := repo.FullRepoPath()
+
+		checkActivity := logger.StartActivity("Checking mergeability of PR in %s", repo.FullRepoName)
+		// skip if the working copy does not exist
+		if _, err = os.Stat(repoDirPath); os.IsNotExist(err) {
+			checkActivity.EndWithWarningf("Directory %s does not exist - has it been cloned?", repoDirPath)
+			skippedCount++
+			return
+		}
+
+		pr, err := gh.GetPR(checkActivity.Writer(), repoDirPath, dir.Name)
+		if err != nil {
+			checkActivity.EndWithFailuref("No PR found: %v", err)
+			errorCount++
+			return
+		}
+
+		if pr.State != "OPEN" {
+			checkActivity.EndWithWarningf("PR is %s", strings.ToLower(pr.State))
+			skippedCount++
+			return
+		}
+
+		switch pr.Mergeable {
+		case "CONFLICTING":
+			checkActivity.EndWithFailuref("PR has conflicts: %s", pr.Url)
+			conflicted = append(conflicted, repo.FullRepoName)
+			conflictsTable.AddRow(repo.FullRepoName, pr.Url)
+		case "MERGEABLE":
+			checkActivity.EndWithSuccess()
+		default:
+			// GitHub calculates mergeability in the background, so it may not be known yet
+			checkActivity.EndWithWarningf("Mergeability is not yet known - try again shortly")
+			unknownCount++
+		}
+	})
+
+	if conflictedFile != "" {
+		writeActivity := logger.StartActivity("Writing conflicted repositories to %s", conflictedFile)
+		contents := ""
+		if len(conflicted) > 0 {
+			contents = strings.Join(conflicted, "\n") + "\n"
+		}
+		if err := ioutil.WriteFile(conflictedFile, []byte(contents), 0o644); err != nil {
+			writeActivity.EndWithFailure(err)
+			errorCount++
+		} else {
+			writeActivity.EndWithSuccess()
+		}
+	}
+
+	if errorCount == 0 {
+		logger.Successf("turbolift conflicts completed %s(%s, %s, %s)\n", colors.Normal(), colors.Red(len(conflicted), " conflicted"), colors.Yellow(unknownCount, " unknown"), colors.Yellow(skippedCount, " skipped"))
+	} else {
+		logger.Warnf("turbolift conflicts completed with %s %s(%s, %s, %s, %s)\n", colors.Red("errors"), colors.Normal(), colors.Red(len(conflicted), " conflicted"), colors.Yellow(unknownCount, " unknown"), colors.Yellow(skippedCount, " skipped"), colors.Red(errorCount, " errored"))
+	}
+
+	if len(conflicted) > 0 {
+		logger.Println()
+		conflictsTable.Print()
+		logger.Println()
+		if conflictedFile != "" {
+			logger.Printf("To work on only the conflicted repositories, use %s", colors.Cyan("--repos ", conflictedFile))
+		}
+	}
+}
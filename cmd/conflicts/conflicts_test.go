@@ -0,0 +1,107 @@
+/*
+ * Copyright 2021 Skyscanner Limited.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * https://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package conflicts
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/skyscanner/turbolift/internal/github"
+	"github.com/skyscanner/turbolift/internal/testsupport"
+)
+
+func init() {
+	// disable output colouring so that strings we want to do 'Contains' checks on do not have ANSI escape sequences in IDEs
+	_ = os.Setenv("NO_COLOR", "1")
+}
+
+func TestItListsConflictedPRs(t *testing.T) {
+	prepareFakeResponses()
+
+	testsupport.PrepareTempCampaign(true, "org/repo1", "org/repo2", "org/repo3", "org/repo4")
+
+	out, err := runCommand()
+	assert.NoError(t, err)
+	assert.Contains(t, out, "Checking mergeability of PR in org/repo1")
+	assert.Contains(t, out, "Mergeability is not yet known")
+	assert.Contains(t, out, "turbolift conflicts completed (1 conflicted, 1 unknown, 1 skipped)")
+	assert.Regexp(t, "org/repo2\\s+https://github.com/org/repo2/pull/2", out)
+	assert.NotRegexp(t, "org/repo1\\s+https", out)
+
+	_, err = os.Stat(defaultConflictedReposFile)
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestItWritesConflictedReposToARepoFile(t *testing.T) {
+	prepareFakeResponses()
+
+	testsupport.PrepareTempCampaign(true, "org/repo1", "org/repo2", "org/repo3")
+
+	out, err := runCommand("--write-repos")
+	assert.NoError(t, err)
+	assert.Contains(t, out, "--repos conflicted.txt")
+
+	contents, err := ioutil.ReadFile(defaultConflictedReposFile)
+	assert.NoError(t, err)
+	assert.Equal(t, "org/repo2\n", string(contents))
+}
+
+func TestItReportsErrors(t *testing.T) {
+	prepareFakeResponses()
+
+	testsupport.PrepareTempCampaign(true, "org/repo1", "org/repoWithError")
+
+	out, err := runCommand("--write-repos=mine.txt")
+	assert.NoError(t, err)
+	assert.Contains(t, out, "turbolift conflicts completed with errors (0 conflicted, 0 unknown, 0 skipped, 1 errored)")
+
+	contents, err := ioutil.ReadFile("mine.txt")
+	assert.NoError(t, err)
+	assert.Equal(t, "", string(contents))
+}
+
+func runCommand(args ...string) (string, error) {
+	cmd := NewConflictsCmd()
+	conflictedFile = ""
+	cmd.SetArgs(args)
+	outBuffer := bytes.NewBufferString("")
+	cmd.SetOut(outBuffer)
+	err := cmd.Execute()
+	if err != nil {
+		return outBuffer.String(), err
+	}
+	return outBuffer.String(), nil
+}
+
+func prepareFakeResponses() {
+	prs := map[string]*github.PrStatus{
+		"work/org/repo1": {State: "OPEN", Mergeable: "MERGEABLE", Url: "https://github.com/org/repo1/pull/1"},
+		"work/org/repo2": {State: "OPEN", Mergeable: "CONFLICTING", Url: "https://github.com/org/repo2/pull/2"},
+		"work/org/repo3": {State: "MERGED", Mergeable: "UNKNOWN", Url: "https://github.com/org/repo3/pull/3"},
+		"work/org/repo4": {State: "OPEN", Mergeable: "UNKNOWN", Url: "https://github.com/org/repo4/pull/4"},
+	}
+	gh = github.NewFakeGitHub(nil, func(workingDir string) (interface{}, error) {
+		if workingDir == "work/org/repoWithError" {
+			return nil, errors.New("synthetic error")
+		}
+		return prs[workingDir], nil
+	})
+}
@@ -0,0 +1,161 @@
+/*
+ * Copyright 2021 Skyscanner Limited.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * https://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package create_prs
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"time"
+
+	"github.com/skyscanner/turbolift/internal/campaign"
+	"github.com/skyscanner/turbolift/internal/colors"
+	"github.com/skyscanner/turbolift/internal/github"
+	"github.com/skyscanner/turbolift/internal/interrupt"
+	"github.com/skyscanner/turbolift/internal/logging"
+	"github.com/skyscanner/turbolift/internal/prompt"
+)
+
+// CanaryRemainingFilename lists the repositories which were held back because the canary did not succeed, so that
+// their PRs can be created later with --repos
+const CanaryRemainingFilename = "canary_remaining.txt"
+
+// canaryPollInterval is how often the canary PRs are checked while waiting for them to merge. It is no shorter than the
+// time PR lookups are cached for, so that each check sees their latest state.
+var canaryPollInterval = 5 * time.Minute
+
+// selectCanary orders the campaign's repositories with those in the canary first, returning how many are in it
+func selectCanary(repos []campaign.Repo) ([]campaign.Repo, int, error) {
+	if canaryCount > 0 && len(canaryRepos) > 0 {
+		return nil, 0, errors.New("only one of --canary and --canary-repos can be used")
+	}
+	if canaryCount < 0 {
+		return nil, 0, errors.New("--canary must be a positive number of repositories")
+	}
+	if canaryWait != "merged" && canaryWait != "confirm" {
+		return nil, 0, fmt.Errorf("--canary-wait must be merged or confirm, not %s", canaryWait)
+	}
+	if canaryCount > 0 {
+		if canaryCount > len(repos) {
+			return repos, len(repos), nil
+		}
+		return repos, canaryCount, nil
+	}
+
+	inCanary := map[string]bool{}
+	for _, name := range canaryRepos {
+		inCanary[name] = true
+	}
+	var canary, rest []campaign.Repo
+	for _, repo := range repos {
+		if inCanary[repo.FullRepoName] {
+			canary = append(canary, repo)
+			delete(inCanary, repo.FullRepoName)
+		} else {
+			rest = append(rest, repo)
+		}
+	}
+	for _, name := range canaryRepos {
+		if inCanary[name] {
+			return nil, 0, fmt.Errorf("canary repository %s is not in the campaign", name)
+		}
+	}
+	return append(canary, rest...), len(canary), nil
+}
+
+// awaitCanary waits for the PRs in the canary repositories to merge, or for confirmation to go on, returning whether
+// the PRs for the remaining repositories should be created
+func awaitCanary(logger *logging.Logger, dir *campaign.Campaign, canary []campaign.Repo, remaining int) bool {
+	if canaryWait == "confirm" {
+		return p.AskConfirm(prompt.ContinueAfterCanary, fmt.Sprintf("Canary PRs have been created in %d repositories - create PRs in the remaining %d?", len(canary), remaining))
+	}
+
+	logger.Printf("Waiting for the canary PRs in %d repositories to merge before creating PRs in the remaining %d", len(canary), remaining)
+	deadline := time.Now().Add(canaryTimeout)
+	for {
+		activity := logger.StartActivity("Checking canary PRs")
+		merged, failed := checkCanary(activity, dir, canary)
+		if len(failed) > 0 {
+			activity.EndWithFailuref("Not creating the remaining PRs, as canary PRs did not merge: %s", strings.Join(failed, ", "))
+			return false
+		}
+		if merged == len(canary) {
+			activity.Logf("All %d canary PRs have merged", merged)
+			activity.EndWithSuccessAndEmitLogs()
+			return true
+		}
+		if canaryTimeout > 0 && time.Now().Add(canaryPollInterval).After(deadline) {
+			activity.EndWithFailuref("Not creating the remaining PRs, as only %d of %d canary PRs merged within %s", merged, len(canary), canaryTimeout)
+			return false
+		}
+		activity.Logf("%d of %d canary PRs have merged - checking again in %s", merged, len(canary), canaryPollInterval)
+		activity.EndWithSuccessAndEmitLogs()
+
+		if !sleepUnlessInterrupted(canaryPollInterval) {
+			return false
+		}
+	}
+}
+
+// checkCanary counts the canary PRs which have merged, and lists the repositories whose PRs never will
+func checkCanary(activity *logging.Activity, dir *campaign.Campaign, canary []campaign.Repo) (int, []string) {
+	merged := 0
+	var failed []string
+	for _, repo := range canary {
+		pr, err := gh.GetPR(activity.Writer(), repo.FullRepoPath(), dir.Name)
+		if _, ok := err.(*github.NoPRFoundError); ok {
+			failed = append(failed, repo.FullRepoName+" (no PR)")
+			continue
+		} else if err != nil {
+			failed = append(failed, fmt.Sprintf("%s (%v)", repo.FullRepoName, err))
+			continue
+		}
+		switch pr.State {
+		case "MERGED":
+			merged++
+		case "OPEN":
+		default:
+			failed = append(failed, fmt.Sprintf("%s (%s)", repo.FullRepoName, strings.ToLower(pr.State)))
+		}
+	}
+	return merged, failed
+}
+
+// sleepUnlessInterrupted waits for the given time, returning false if the run is interrupted in the meantime
+func sleepUnlessInterrupted(d time.Duration) bool {
+	for end := time.Now().Add(d); time.Now().Before(end); {
+		if interrupt.Requested() {
+			return false
+		}
+		time.Sleep(time.Second)
+	}
+	return !interrupt.Requested()
+}
+
+// holdBack records the repositories whose PRs were not created because of the canary, for creating them later
+func holdBack(logger *logging.Logger, remaining []campaign.Repo) {
+	var names []string
+	for _, repo := range remaining {
+		names = append(names, repo.FullRepoName)
+	}
+
+	if err := ioutil.WriteFile(CanaryRemainingFilename, []byte(strings.Join(names, "\n")+"\n"), 0o644); err != nil {
+		logger.Warnf("%d repositories were held back, but they could not be written to %s: %v", len(remaining), CanaryRemainingFilename, err)
+		return
+	}
+	logger.Warnf("%d repositories were held back. To create their PRs once the canary is fixed, use %s", len(remaining), colors.Cyan("--repos ", CanaryRemainingFilename))
+}
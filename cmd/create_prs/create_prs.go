@@ -16,22 +16,37 @@
 package create_prs
 
 import (
+	"errors"
+	"fmt"
+	"io/ioutil"
 	"os"
-	"path"
+	"sort"
+	"strings"
+	"text/template"
 	"time"
 
 	"github.com/spf13/cobra"
 
 	"github.com/skyscanner/turbolift/internal/campaign"
+	"github.com/skyscanner/turbolift/internal/changes"
 	"github.com/skyscanner/turbolift/internal/colors"
+	"github.com/skyscanner/turbolift/internal/executor"
 	"github.com/skyscanner/turbolift/internal/git"
 	"github.com/skyscanner/turbolift/internal/github"
+	"github.com/skyscanner/turbolift/internal/hooks"
+	"github.com/skyscanner/turbolift/internal/interrupt"
 	"github.com/skyscanner/turbolift/internal/logging"
+	"github.com/skyscanner/turbolift/internal/ordering"
+	"github.com/skyscanner/turbolift/internal/prompt"
+	"github.com/skyscanner/turbolift/internal/prtemplate"
+	"github.com/skyscanner/turbolift/internal/secrets"
 )
 
 var (
-	gh github.GitHub = github.NewRealGitHub()
-	g  git.Git       = git.NewRealGit()
+	gh   github.GitHub     = github.NewCachingGitHub(github.NewGitHub())
+	g    git.Git           = git.NewRealGit()
+	exec executor.Executor = executor.NewRealExecutor()
+	p    prompt.Prompt     = prompt.NewRealPrompt()
 )
 
 var (
@@ -39,6 +54,39 @@ var (
 	repoFile          string
 	prDescriptionFile string
 	sleep             time.Duration
+	appendDiffstat    bool
+	checkSizes        bool
+	maxDiffLines      int
+	projectRef        string
+	projectStatus     string
+	labels            []string
+	reviewerPool      []string
+	assignReviewers   bool
+	reviewersFile     string
+	secretRules       string
+	allowSecrets      bool
+	verifyCommand     string
+	onVerifyFailure   string
+	existingPRs       string
+	squash            bool
+	squashMessage     string
+	baseBranch        string
+	baseBranchFile    string
+	canaryCount       int
+	canaryRepos       []string
+	canaryWait        string
+	canaryTimeout     time.Duration
+	useRepoTemplate   bool
+)
+
+// VerifyFailedFilename lists the repositories where the --verify command failed, so that they can be fixed and retried
+const VerifyFailedFilename = "verify_failed.txt"
+
+// A repository's changes are unexpectedly large when they are this many times the median across the campaign, which
+// usually means that a script misbehaved in that repository
+const (
+	outlierFactor   = 10
+	minOutlierLines = 100
 )
 
 func NewCreatePRsCmd() *cobra.Command {
@@ -52,6 +100,29 @@ func NewCreatePRsCmd() *cobra.Command {
 	cmd.Flags().BoolVar(&isDraft, "draft", false, "Creates the Pull Request as Draft PR")
 	cmd.Flags().StringVar(&repoFile, "repos", "repos.txt", "A file containing a list of repositories to clone.")
 	cmd.Flags().StringVar(&prDescriptionFile, "description", "README.md", "A file containing the title and description for the PRs.")
+	cmd.Flags().BoolVar(&useRepoTemplate, "use-repo-template", false, "Fill in each repository's own PR template with the description, section by section where their headings match, instead of replacing it.")
+	cmd.Flags().BoolVar(&appendDiffstat, "append-diffstat", false, "Append a summary of the changes made in each repository to its PR description.")
+	cmd.Flags().BoolVar(&checkSizes, "check-sizes", false, "Warn about repositories whose changes are unexpectedly large compared to the rest of the campaign.")
+	cmd.Flags().IntVar(&maxDiffLines, "max-diff-lines", 0, "Do not push or create PRs for repositories where more than this many lines are changed. Unexpectedly large changes are also warned about, as with --check-sizes.")
+	cmd.Flags().StringSliceVar(&labels, "label", nil, "A label to add to each PR, which is created in repositories where it does not exist yet (may be repeated, or comma-separated)")
+	cmd.Flags().StringSliceVar(&reviewerPool, "reviewer-pool", nil, "Reviewers to share the PRs between, one per PR, given as LOGIN or LOGIN:WEIGHT (may be repeated, or comma-separated)")
+	cmd.Flags().StringVar(&reviewersFile, "reviewers-file", "", "A file giving the reviewers (people or ORG/TEAM) for each repository, as lines of REPO REVIEWER... Repositories which are not in it fall back to the --reviewer-pool.")
+	cmd.Flags().BoolVar(&assignReviewers, "assign-reviewers", false, "Also assign each PR to its reviewer from the --reviewer-pool")
+	cmd.Flags().StringVar(&projectRef, "project", "", "Add each PR to this GitHub Project (v2), given as OWNER/NUMBER.")
+	cmd.Flags().StringVar(&secretRules, "secret-rules", "", "A gitleaks configuration file with rules for secrets to check for, in addition to the built-in rules.")
+	cmd.Flags().BoolVar(&allowSecrets, "allow-secrets", false, "Push changes even where they appear to contain secrets.")
+	cmd.Flags().StringVar(&verifyCommand, "verify", "", "A shell command, such as \"make test\", to run in each working copy before pushing it. Repositories where it fails are listed in "+VerifyFailedFilename+".")
+	cmd.Flags().StringVar(&onVerifyFailure, "on-verify-failure", "skip", "What to do where the --verify command fails: skip the repository, or push it and create a draft PR which says that verification failed.")
+	cmd.Flags().StringVar(&existingPRs, "existing-prs", "skip", "What to do where the campaign branch already has an open PR, e.g. from an earlier campaign of the same name: skip the repository, or adopt the PR by pushing to it and updating its title and description.")
+	cmd.Flags().StringVar(&projectStatus, "project-status", "", "The status to set on each PR added to the --project, e.g. \"In Progress\".")
+	cmd.Flags().StringVar(&baseBranch, "base", "", "The branch to raise PRs against, instead of each repository's default branch.")
+	cmd.Flags().StringVar(&baseBranchFile, "base-file", "", "A file giving the branch to raise PRs against for some repositories, as lines of REPO BRANCH. Repositories which are not in it fall back to --base.")
+	cmd.Flags().BoolVar(&squash, "squash", false, "Squash the campaign branch into a single commit before pushing it, where it has more than one.")
+	cmd.Flags().StringVar(&squashMessage, "squash-message", "", "The message for commits made by --squash, which is a template like commit's --message. Defaults to the PR title.")
+	cmd.Flags().IntVar(&canaryCount, "canary", 0, "Create PRs in the first N repositories first, as a canary, and only create the rest once the canary PRs have merged.")
+	cmd.Flags().StringSliceVar(&canaryRepos, "canary-repos", nil, "The repositories to create PRs in first, as a canary, instead of the first N given with --canary (may be repeated, or comma-separated)")
+	cmd.Flags().StringVar(&canaryWait, "canary-wait", "merged", "What to wait for before creating the remaining PRs: the canary PRs to be merged, or confirmation that they are good.")
+	cmd.Flags().DurationVar(&canaryTimeout, "canary-timeout", 24*time.Hour, "How long to wait for the canary PRs to merge before giving up on the remaining PRs (0 for no limit).")
 
 	return cmd
 }
@@ -59,7 +130,7 @@ func NewCreatePRsCmd() *cobra.Command {
 func run(c *cobra.Command, _ []string) {
 	logger := logging.NewLogger(c)
 
-	readCampaignActivity := logger.StartActivity("Reading campaign data (%s, %s)", repoFile, prDescriptionFile)
+	readCampaignActivity := logger.StartSetupActivity("Reading campaign data (%s, %s)", repoFile, prDescriptionFile)
 	options := campaign.NewCampaignOptions()
 	options.RepoFilename = repoFile
 	options.PrDescriptionFilename = prDescriptionFile
@@ -68,47 +139,298 @@ func run(c *cobra.Command, _ []string) {
 		readCampaignActivity.EndWithFailure(err)
 		return
 	}
+	lifecycleHooks, err := hooks.Load()
+	if err != nil {
+		readCampaignActivity.EndWithFailure(err)
+		return
+	}
+	rules, err := secrets.LoadRules(secretRules)
+	if err != nil {
+		readCampaignActivity.EndWithFailure(err)
+		return
+	}
+	if err := applyBaseBranches(dir); err != nil {
+		readCampaignActivity.EndWithFailure(err)
+		return
+	}
 	readCampaignActivity.EndWithSuccess()
 
+	if onVerifyFailure != "skip" && onVerifyFailure != "draft" {
+		logger.FlagErrorf("--on-verify-failure must be skip or draft, not %s", onVerifyFailure)
+		return
+	}
+
+	if existingPRs != "skip" && existingPRs != "adopt" {
+		logger.FlagErrorf("--existing-prs must be skip or adopt, not %s", existingPRs)
+		return
+	}
+
+	var capabilities []github.Capability
+	if projectRef != "" {
+		capabilities = append(capabilities, github.ProjectsCapability)
+	}
+	if len(labels) > 0 {
+		capabilities = append(capabilities, github.LabelsCapability)
+	}
+	if isDraft || (verifyCommand != "" && onVerifyFailure == "draft") {
+		capabilities = append(capabilities, github.DraftPRsCapability)
+	}
+	if !checkCapabilities(logger, capabilities) {
+		return
+	}
+
+	var project *github.Project
+	if projectRef != "" {
+		if project, err = readProject(logger); err != nil {
+			return
+		}
+	} else if projectStatus != "" {
+		logger.FlagErrorf("--project-status can only be used with --project")
+		return
+	}
+
+	pool, err := campaign.ParseReviewerPool(reviewerPool)
+	if err != nil {
+		logger.FlagErrorf("%v", err)
+		return
+	}
+	if assignReviewers && len(pool) == 0 {
+		logger.FlagErrorf("--assign-reviewers can only be used with --reviewer-pool")
+		return
+	}
+	var reviewerMapping campaign.ReviewerMapping
+	if reviewersFile != "" {
+		if reviewerMapping, err = campaign.ReadReviewerMapping(reviewersFile); err != nil {
+			logger.FlagErrorf("%v", err)
+			return
+		}
+	}
+	assignedReviewers, err := campaign.ReadReviewers()
+	if err != nil {
+		logger.Errorf("Unable to read the reviewers already requested: %v", err)
+		return
+	}
+
+	if squashMessage != "" && !squash {
+		logger.FlagErrorf("--squash-message can only be used with --squash")
+		return
+	}
+	if squashMessage == "" {
+		squashMessage = dir.PrTitle
+	}
+	squashTemplate, err := campaign.ParseTemplate("squash-message", squashMessage)
+	if err != nil {
+		logger.FlagErrorf("unable to parse --squash-message: %v", err)
+		return
+	}
+
+	stage, ok := ordering.Start(logger, gh, dir)
+	if !ok {
+		return
+	}
+
+	repos, canarySize, err := selectCanary(dir.Repos)
+	if err != nil {
+		logger.FlagErrorf("%v", err)
+		return
+	}
+
+	// summarising the changes costs a diff and possibly an API call per repo, so is only done for the flags needing it
+	var summaries map[string]*changes.Summary
+	if checkSizes || maxDiffLines > 0 || appendDiffstat {
+		summaries = checkChangeSizes(logger, dir)
+	}
+
+	if err := lifecycleHooks.RunForCommand(logger, hooks.PrePush); err != nil {
+		return
+	}
+
+	var tooLarge []string
+	var verifyFailed []string
+	var alreadyOpen []string
 	doneCount := 0
 	skippedCount := 0
 	errorCount := 0
-	for _, repo := range dir.Repos {
+	createPr := func(repo campaign.Repo) {
 		if sleep > 0 {
 			logger.Successf("Sleeping for %s", sleep)
 			time.Sleep(sleep)
 		}
 
-		repoDirPath := path.Join("work", repo.OrgName, repo.RepoName) // i.e. work/org/repo
+		repoDirPath := repo.FullRepoPath()
 
 		pushActivity := logger.StartActivity("Pushing changes in %s to origin", repo.FullRepoName)
 		// skip if the working copy does not exist
 		if _, err = os.Stat(repoDirPath); os.IsNotExist(err) {
 			pushActivity.EndWithWarningf("Directory %s does not exist - has it been cloned?", repoDirPath)
 			skippedCount++
-			continue
+			return
 		}
 
-		err := g.Push(pushActivity.Writer(), repoDirPath, "origin", dir.Name)
+		var wrongBranchError *changes.WrongBranchError
+		if err := changes.CheckProfileBranch(pushActivity.Writer(), g, repoDirPath, dir.Name); errors.As(err, &wrongBranchError) {
+			pushActivity.EndWithWarning(err)
+			skippedCount++
+			return
+		} else if err != nil {
+			pushActivity.EndWithFailure(err)
+			errorCount++
+			return
+		}
+
+		existingPR, err := findExistingPR(pushActivity, repoDirPath, dir.Name)
 		if err != nil {
 			pushActivity.EndWithFailure(err)
 			errorCount++
-			continue
+			return
+		}
+		if existingPR != nil && existingPRs == "skip" {
+			pushActivity.EndWithWarningf("Not pushing, as branch %s already has an open PR: %s", dir.Name, existingPR.Url)
+			alreadyOpen = append(alreadyOpen, repo.FullRepoName+" "+existingPR.Url)
+			skippedCount++
+			return
+		}
+
+		if maxDiffLines > 0 {
+			summary, ok := summaries[repo.FullRepoName]
+			if !ok {
+				pushActivity.EndWithWarningf("Not pushing, as the size of the changes could not be checked against --max-diff-lines")
+				tooLarge = append(tooLarge, repo.FullRepoName)
+				skippedCount++
+				return
+			}
+			if lines := changedLines(summary); lines > maxDiffLines {
+				pushActivity.EndWithWarningf("Not pushing, as %d lines are changed, more than --max-diff-lines %d", lines, maxDiffLines)
+				tooLarge = append(tooLarge, repo.FullRepoName)
+				skippedCount++
+				return
+			}
+		}
+
+		if !allowSecrets {
+			err = secrets.CheckBranch(pushActivity.Writer(), g, gh, repo, rules)
+			if err != nil {
+				pushActivity.EndWithFailuref("Not pushing: %v", err)
+				errorCount++
+				return
+			}
+		}
+
+		verified := true
+		if verifyCommand != "" {
+			if err := verify(pushActivity, repoDirPath); err != nil {
+				verifyFailed = append(verifyFailed, repo.FullRepoName)
+				if onVerifyFailure == "skip" {
+					pushActivity.EndWithWarningf("Not pushing, as %v", err)
+					skippedCount++
+					return
+				}
+				pushActivity.Logf("Pushing anyway, as a draft PR, although %v", err)
+				verified = false
+			}
+		}
+
+		err = lifecycleHooks.RunForRepo(pushActivity.Writer(), hooks.PrePush, repo)
+		if err != nil {
+			pushActivity.EndWithFailure(err)
+			errorCount++
+			return
 		}
-		pushActivity.EndWithSuccess()
 
+		push := g.Push
+		if squash {
+			squashed, err := squashBranch(pushActivity, repo, dir, squashTemplate)
+			if err != nil {
+				pushActivity.EndWithFailuref("Unable to squash the campaign branch: %v", err)
+				errorCount++
+				return
+			}
+			if squashed > 1 {
+				// the branch may have been pushed before it was rewritten
+				push = g.ForcePush
+			}
+		}
+
+		err = push(pushActivity.Writer(), repoDirPath, "origin", dir.Name)
+		if err != nil {
+			pushActivity.EndWithFailure(err)
+			errorCount++
+			return
+		}
+		if verified {
+			pushActivity.EndWithSuccess()
+		} else {
+			pushActivity.EndWithSuccessAndEmitLogs()
+		}
+
+		if existingPR != nil {
+			adoptActivity := logger.StartActivity("Adopting existing PR %s", existingPR.Url)
+			if err := adopt(adoptActivity, repo, repoDirPath, dir); err != nil {
+				adoptActivity.EndWithFailure(err)
+				errorCount++
+			} else {
+				adoptActivity.EndWithSuccess()
+				doneCount++
+			}
+			return
+		}
+
+		draft := isDraft || !verified
 		var createPrActivity *logging.Activity
-		if isDraft {
+		if draft {
 			createPrActivity = logger.StartActivity("Creating Draft PR in %s", repo.FullRepoName)
 		} else {
 			createPrActivity = logger.StartActivity("Creating PR in %s", repo.FullRepoName)
 		}
 
+		body, err := description(createPrActivity, repoDirPath, dir)
+		if err != nil {
+			createPrActivity.EndWithFailure(err)
+			errorCount++
+			return
+		}
+
 		pullRequest := github.PullRequest{
 			Title:        dir.PrTitle,
-			Body:         dir.PrBody,
+			Body:         body,
 			UpstreamRepo: repo.FullRepoName,
-			IsDraft:      isDraft,
+			IsDraft:      draft,
+			Labels:       labels,
+			Base:         repo.BaseBranch,
+		}
+		if !verified {
+			pullRequest.Body = verifyFailureNote(pullRequest.Body)
+		}
+
+		var poolReviewers []string
+		if mapped := reviewerMapping.For(repo); len(mapped) > 0 {
+			pullRequest.Reviewers = mapped
+		} else if len(pool) > 0 {
+			poolReviewers = assignedReviewers[repo.FullRepoName]
+			if len(poolReviewers) == 0 {
+				poolReviewers = []string{pool.Next(assignedReviewers)}
+			}
+			pullRequest.Reviewers = poolReviewers
+			if assignReviewers {
+				pullRequest.Assignees = poolReviewers
+			}
+		}
+
+		// PRs cannot be created with labels that do not exist in the repository
+		if err := ensureLabels(createPrActivity, repo, repoDirPath); err != nil {
+			createPrActivity.EndWithFailure(err)
+			errorCount++
+			return
+		}
+
+		if appendDiffstat {
+			summary, ok := summaries[repo.FullRepoName]
+			if !ok {
+				createPrActivity.EndWithFailuref("Unable to summarise the changes in %s", repo.FullRepoName)
+				errorCount++
+				return
+			}
+			pullRequest.Body = summary.AppendTo(pullRequest.Body)
 		}
 
 		didCreate, err := gh.CreatePullRequest(createPrActivity.Writer(), repoDirPath, pullRequest)
@@ -119,15 +441,302 @@ func run(c *cobra.Command, _ []string) {
 		} else if !didCreate {
 			createPrActivity.EndWithWarningf("No PR created in %s", repo.FullRepoName)
 			skippedCount++
+		} else if err := recordReviewers(assignedReviewers, repo, poolReviewers); err != nil {
+			createPrActivity.EndWithFailuref("PR created, but unable to record its reviewers in %s: %v", campaign.ReviewersFilename, err)
+			errorCount++
+		} else if err := addToProject(createPrActivity, project, repoDirPath, dir.Name); err != nil {
+			createPrActivity.EndWithFailuref("PR created, but unable to add it to project %s: %v", projectRef, err)
+			errorCount++
+		} else if err := lifecycleHooks.RunForRepo(createPrActivity.Writer(), hooks.PostCreatePrs, repo); err != nil {
+			createPrActivity.EndWithFailure(err)
+			errorCount++
 		} else {
 			createPrActivity.EndWithSuccess()
 			doneCount++
 		}
 	}
 
+	canary, rest := repos, []campaign.Repo(nil)
+	if canarySize > 0 {
+		canary, rest = repos[:canarySize], repos[canarySize:]
+	}
+	if interrupt.ForEachRepo(logger, canary, createPr) && len(rest) > 0 {
+		if awaitCanary(logger, dir, canary, len(rest)) {
+			interrupt.ForEachRepo(logger, rest, createPr)
+		} else {
+			holdBack(logger, rest)
+		}
+	}
+
+	if err := lifecycleHooks.RunForCommand(logger, hooks.PostCreatePrs); err != nil {
+		errorCount++
+	}
+
 	if errorCount == 0 {
 		logger.Successf("turbolift create-prs completed %s(%s, %s)\n", colors.Normal(), colors.Green(doneCount, " OK"), colors.Yellow(skippedCount, " skipped"))
 	} else {
 		logger.Warnf("turbolift create-prs completed with %s %s(%s, %s, %s)\n", colors.Red("errors"), colors.Normal(), colors.Green(doneCount, " OK"), colors.Yellow(skippedCount, " skipped"), colors.Red(errorCount, " errored"))
 	}
+
+	if len(tooLarge) > 0 {
+		logger.Println("These repositories were skipped, as their changes could be larger than --max-diff-lines:")
+		for _, repoName := range tooLarge {
+			logger.Println("  ", repoName)
+		}
+	}
+
+	if len(alreadyOpen) > 0 {
+		logger.Printf("These repositories were skipped, as branch %s already has an open PR in them - use --existing-prs adopt to take them over:", dir.Name)
+		for _, repoAndUrl := range alreadyOpen {
+			logger.Println("  ", repoAndUrl)
+		}
+	}
+
+	if len(verifyFailed) > 0 {
+		writeVerifyFailed(logger, verifyFailed)
+	}
+
+	stage.ReportWaiting(logger, "create-prs")
+}
+
+// applyBaseBranches sets the branch that each repository's PR is raised against, from --base-file or --base
+func applyBaseBranches(dir *campaign.Campaign) error {
+	mapping := campaign.BaseBranchMapping{}
+	if baseBranchFile != "" {
+		var err error
+		if mapping, err = campaign.ReadBaseBranchMapping(baseBranchFile); err != nil {
+			return err
+		}
+	}
+	for i, repo := range dir.Repos {
+		if branch := mapping.For(repo); branch != "" {
+			dir.Repos[i].BaseBranch = branch
+		} else if baseBranch != "" {
+			dir.Repos[i].BaseBranch = baseBranch
+		}
+	}
+	return nil
+}
+
+// findExistingPR returns the open PR from the campaign branch, if there is one already
+func findExistingPR(activity *logging.Activity, repoDirPath string, branchName string) (*github.PrStatus, error) {
+	pr, err := gh.GetPR(activity.Writer(), repoDirPath, branchName)
+	if _, ok := err.(*github.NoPRFoundError); ok {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if pr.State != "OPEN" {
+		return nil, nil
+	}
+	return pr, nil
+}
+
+// adopt makes an existing PR from the campaign branch part of this campaign, giving it the campaign's title,
+// description and labels
+func adopt(activity *logging.Activity, repo campaign.Repo, repoDirPath string, dir *campaign.Campaign) error {
+	body, err := description(activity, repoDirPath, dir)
+	if err != nil {
+		return err
+	}
+	if err := gh.UpdatePRDescription(activity.Writer(), repoDirPath, dir.Name, dir.PrTitle, body); err != nil {
+		return err
+	}
+	if len(labels) == 0 {
+		return nil
+	}
+	if err := ensureLabels(activity, repo, repoDirPath); err != nil {
+		return err
+	}
+	return gh.UpdatePRLabels(activity.Writer(), repoDirPath, dir.Name, labels, nil)
+}
+
+// description returns the PR description for a repository, which with --use-repo-template is the repository's own PR
+// template filled in with the campaign's description
+func description(activity *logging.Activity, repoDirPath string, dir *campaign.Campaign) (string, error) {
+	if !useRepoTemplate {
+		return dir.PrBody, nil
+	}
+	body, found, err := prtemplate.Fill(repoDirPath, dir.PrBody)
+	if err != nil {
+		return "", err
+	}
+	if !found {
+		activity.Log("The repository has no PR template, so using the campaign's description as it is")
+	}
+	return body, nil
+}
+
+// squashBranch squashes the commits on the campaign branch since it diverged from the base branch into one,
+// returning how many commits there were
+func squashBranch(activity *logging.Activity, repo campaign.Repo, dir *campaign.Campaign, messageTemplate *template.Template) (int, error) {
+	repoDirPath := repo.FullRepoPath()
+	message, err := campaign.RenderTemplate(messageTemplate, campaign.NewTemplateData(dir, repo))
+	if err != nil {
+		return 0, err
+	}
+	baseBranch, err := changes.BaseBranch(activity.Writer(), gh, repo)
+	if err != nil {
+		return 0, err
+	}
+	baseRemote, err := changes.BaseRemote(activity.Writer(), g, repoDirPath)
+	if err != nil {
+		return 0, err
+	}
+
+	squashed, err := g.Squash(activity.Writer(), repoDirPath, baseRemote+"/"+baseBranch, message)
+	if err == nil && squashed > 1 {
+		activity.Logf("Squashed %d commits into one", squashed)
+	}
+	return squashed, err
+}
+
+// verify runs the --verify command in a working copy, with its output going to the activity
+func verify(activity *logging.Activity, repoDirPath string) error {
+	shellCommand, shellArgs := executor.ShellInvocation("", verifyCommand)
+	if err := exec.Execute(activity.Writer(), repoDirPath, shellCommand, shellArgs...); err != nil {
+		return fmt.Errorf("verification failed: %w", err)
+	}
+	return nil
+}
+
+// verifyFailureNote warns reviewers of a PR created although its changes failed verification
+func verifyFailureNote(body string) string {
+	return strings.TrimRight(body, "\n") + fmt.Sprintf("\n\n> **Warning**\n> `%s` failed for these changes, so this PR needs fixing before it can be merged.\n", verifyCommand)
+}
+
+func writeVerifyFailed(logger *logging.Logger, repos []string) {
+	if err := ioutil.WriteFile(VerifyFailedFilename, []byte(strings.Join(repos, "\n")+"\n"), 0o644); err != nil {
+		logger.Warnf("Verification failed in %d repositories, but they could not be written to %s: %v", len(repos), VerifyFailedFilename, err)
+		return
+	}
+	logger.Warnf("Verification failed in %d repositories, which are listed in %s. Once they are fixed, use %s", len(repos), VerifyFailedFilename, colors.Cyan("--repos ", VerifyFailedFilename))
+}
+
+// recordReviewers saves the reviewers requested for a PR from the pool, so that later runs carry on the rotation
+func recordReviewers(assignedReviewers map[string][]string, repo campaign.Repo, reviewers []string) error {
+	if len(reviewers) == 0 {
+		return nil
+	}
+	assignedReviewers[repo.FullRepoName] = reviewers
+	return campaign.WriteReviewers(assignedReviewers)
+}
+
+func ensureLabels(activity *logging.Activity, repo campaign.Repo, repoDirPath string) error {
+	for _, label := range labels {
+		created, err := gh.EnsureLabel(activity.Writer(), repoDirPath, repo.FullRepoName, github.Label{
+			Name:        label,
+			Color:       github.DefaultLabelColor,
+			Description: github.DefaultLabelDescription,
+		})
+		if err != nil {
+			return err
+		}
+		if created {
+			activity.Logf("Created the %s label in %s", label, repo.FullRepoName)
+		}
+	}
+	return nil
+}
+
+// checkCapabilities checks that gh supports the features that the flags need before any PRs are created, rather than
+// failing in every repository
+func checkCapabilities(logger *logging.Logger, capabilities []github.Capability) bool {
+	for _, capability := range capabilities {
+		capabilityActivity := logger.StartActivity("Checking gh supports %s", capability.Feature)
+		if err := gh.CheckCapability(capabilityActivity.Writer(), capability); err != nil {
+			capabilityActivity.EndWithFailure(err)
+			return false
+		}
+		capabilityActivity.EndWithSuccess()
+	}
+	return true
+}
+
+// readProject looks up the --project, checking that it has the --project-status (if given) before any PRs are created
+func readProject(logger *logging.Logger) (*github.Project, error) {
+	projectActivity := logger.StartActivity("Reading project %s", projectRef)
+	owner, number, err := github.ParseProjectRef(projectRef)
+	if err != nil {
+		projectActivity.EndWithFailure(err)
+		return nil, err
+	}
+	project, err := gh.GetProject(projectActivity.Writer(), ".", owner, number)
+	if err != nil {
+		projectActivity.EndWithFailure(err)
+		return nil, err
+	}
+	if projectStatus != "" {
+		if _, _, err := project.StatusOption(projectStatus); err != nil {
+			projectActivity.EndWithFailure(err)
+			return nil, err
+		}
+	}
+	projectActivity.EndWithSuccess()
+	return project, nil
+}
+
+// addToProject adds the newly created PR to the project, if there is one
+func addToProject(activity *logging.Activity, project *github.Project, repoDirPath string, branchName string) error {
+	if project == nil {
+		return nil
+	}
+	pr, err := gh.GetPR(activity.Writer(), repoDirPath, branchName)
+	if err != nil {
+		return err
+	}
+	return gh.AddToProject(activity.Writer(), repoDirPath, project, pr.Url, projectStatus)
+}
+
+// checkChangeSizes summarises the committed changes in each working copy, warning about repositories whose changes
+// are unexpectedly large compared to the rest of the campaign. Summaries are keyed by full repo name.
+func checkChangeSizes(logger *logging.Logger, dir *campaign.Campaign) map[string]*changes.Summary {
+	summaries := map[string]*changes.Summary{}
+	sizeActivity := logger.StartActivity("Checking the size of changes")
+	for _, repo := range dir.Repos {
+		if _, err := os.Stat(repo.FullRepoPath()); err != nil {
+			continue
+		}
+		summary, err := changes.Summarise(sizeActivity.Writer(), g, gh, repo)
+		if err != nil {
+			sizeActivity.Logf("Unable to summarise the changes in %s: %v", repo.FullRepoName, err)
+			continue
+		}
+		summaries[repo.FullRepoName] = summary
+	}
+	sizeActivity.EndWithSuccess()
+
+	for _, repoName := range outliers(summaries) {
+		logger.Warnf("%s has unexpectedly large changes (%s) - check that they are intended", repoName, summaries[repoName])
+	}
+	return summaries
+}
+
+// outliers returns the repositories whose changed lines are far above the median across the campaign
+func outliers(summaries map[string]*changes.Summary) []string {
+	var sizes []int
+	for _, summary := range summaries {
+		if lines := changedLines(summary); lines > 0 {
+			sizes = append(sizes, lines)
+		}
+	}
+	if len(sizes) == 0 {
+		return nil
+	}
+	sort.Ints(sizes)
+	median := sizes[(len(sizes)-1)/2]
+
+	var repoNames []string
+	for repoName, summary := range summaries {
+		if lines := changedLines(summary); lines >= minOutlierLines && lines > outlierFactor*median {
+			repoNames = append(repoNames, repoName)
+		}
+	}
+	sort.Strings(repoNames)
+	return repoNames
+}
+
+func changedLines(summary *changes.Summary) int {
+	_, insertions, deletions := summary.Totals()
+	return insertions + deletions
 }
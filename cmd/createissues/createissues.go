@@ -0,0 +1,144 @@
+/*
+ * Copyright 2021 Skyscanner Limited.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * https://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package createissues
+
+import (
+	"strings"
+	"text/template"
+
+	"github.com/spf13/cobra"
+
+	"github.com/skyscanner/turbolift/internal/campaign"
+	"github.com/skyscanner/turbolift/internal/colors"
+	"github.com/skyscanner/turbolift/internal/github"
+	"github.com/skyscanner/turbolift/internal/interrupt"
+	"github.com/skyscanner/turbolift/internal/logging"
+)
+
+var gh github.GitHub = github.NewGitHub()
+
+var (
+	repoFile     string
+	templateFile string
+	labels       []string
+	assignees    []string
+)
+
+func NewCreateIssuesCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "create-issues",
+		Short: "Open an issue in each repository, for campaigns which are tracked with issues rather than PRs",
+		Long: `Open an issue in each repository from a template, whose first line is the title and the rest is the body.
+The template can refer to {{.Campaign}}, {{.FullRepoName}}, {{.OrgName}} and {{.RepoName}}.
+The issues opened are recorded in ` + campaign.IssuesFilename + `, and repositories which already have one are skipped.`,
+		Args: cobra.NoArgs,
+		Run:  run,
+	}
+
+	cmd.Flags().StringVar(&repoFile, "repos", "repos.txt", "A file containing a list of repositories to open issues in.")
+	cmd.Flags().StringVar(&templateFile, "template", "ISSUE.md", "A file containing the template for the issue title and body.")
+	cmd.Flags().StringSliceVar(&labels, "label", nil, "A label to add to each issue (may be repeated, or comma-separated)")
+	cmd.Flags().StringSliceVar(&assignees, "assignee", nil, "A login to assign each issue to (may be repeated, or comma-separated)")
+
+	return cmd
+}
+
+func run(c *cobra.Command, _ []string) {
+	logger := logging.NewLogger(c)
+
+	readCampaignActivity := logger.StartSetupActivity("Reading campaign data (%s, %s)", repoFile, templateFile)
+	options := campaign.NewCampaignOptions()
+	options.RepoFilename = repoFile
+	dir, err := campaign.OpenCampaign(options)
+	if err != nil {
+		readCampaignActivity.EndWithFailure(err)
+		return
+	}
+	issueTemplate, err := campaign.ReadTemplateFile(templateFile, "issue template")
+	if err != nil {
+		readCampaignActivity.EndWithFailure(err)
+		return
+	}
+	issues, err := campaign.ReadIssues()
+	if err != nil {
+		readCampaignActivity.EndWithFailure(err)
+		return
+	}
+	readCampaignActivity.EndWithSuccess()
+
+	var doneCount, skippedCount, errorCount int
+	interrupt.ForEachRepo(logger, dir.Repos, func(repo campaign.Repo) {
+		createActivity := logger.StartActivity("Opening issue in %s", repo.FullRepoName)
+
+		if existing, ok := issues[repo.FullRepoName]; ok {
+			createActivity.EndWithWarningf("An issue has already been opened: %s", existing.Url)
+			skippedCount++
+			return
+		}
+
+		title, body, err := render(issueTemplate, campaign.NewTemplateData(dir, repo))
+		if err != nil {
+			createActivity.EndWithFailure(err)
+			errorCount++
+			return
+		}
+
+		created, err := gh.CreateIssue(createActivity.Writer(), ".", github.Issue{
+			Title:     title,
+			Body:      body,
+			Repo:      repo.FullRepoName,
+			Labels:    labels,
+			Assignees: assignees,
+		})
+		if err != nil {
+			createActivity.EndWithFailure(err)
+			errorCount++
+			return
+		}
+
+		// record each issue as soon as it is opened, so that a failure part way through does not lose track of it
+		issues[repo.FullRepoName] = *created
+		if err := campaign.WriteIssues(issues); err != nil {
+			createActivity.EndWithFailuref("Opened %s, but unable to record it in %s: %v", created.Url, campaign.IssuesFilename, err)
+			errorCount++
+			return
+		}
+		createActivity.Logf("Opened issue #%d: %s", created.Number, created.Url)
+		createActivity.EndWithSuccessAndEmitLogs()
+		doneCount++
+	})
+
+	if errorCount == 0 {
+		logger.Successf("turbolift create-issues completed %s(%s, %s)\n", colors.Normal(), colors.Green(doneCount, " OK"), colors.Yellow(skippedCount, " skipped"))
+	} else {
+		logger.Warnf("turbolift create-issues completed with %s %s(%s, %s, %s)\n", colors.Red("errors"), colors.Normal(), colors.Green(doneCount, " OK"), colors.Yellow(skippedCount, " skipped"), colors.Red(errorCount, " errored"))
+	}
+}
+
+// render fills in the template for a repository, returning the title (from the first line) and body of the issue
+func render(t *template.Template, data campaign.TemplateData) (string, string, error) {
+	rendered, err := campaign.RenderTemplate(t, data)
+	if err != nil {
+		return "", "", err
+	}
+	lines := strings.SplitN(rendered, "\n", 2)
+	title := strings.TrimLeft(lines[0], "# ")
+	body := ""
+	if len(lines) > 1 {
+		body = strings.TrimSpace(lines[1])
+	}
+	return title, body, nil
+}
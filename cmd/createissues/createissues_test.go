@@ -0,0 +1,165 @@
+/*
+ * Copyright 2021 Skyscanner Limited.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * https://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package createissues
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/skyscanner/turbolift/internal/campaign"
+	"github.com/skyscanner/turbolift/internal/github"
+	"github.com/skyscanner/turbolift/internal/testsupport"
+)
+
+func init() {
+	// disable output colouring so that strings we want to do 'Contains' checks on do not have ANSI escape sequences in IDEs
+	_ = os.Setenv("NO_COLOR", "1")
+}
+
+func TestItOpensTemplatedIssuesAndRecordsThem(t *testing.T) {
+	fakeGitHub := github.NewAlwaysSucceedsFakeGitHub()
+	gh = fakeGitHub
+
+	testsupport.PrepareTempCampaign(false, "org/repo1", "org/repo2")
+	writeTemplate("# Migrate {{.RepoName}} by March\n\nPlease migrate {{.FullRepoName}}.\n")
+
+	out, err := runCommand("--label", "migration,platform", "--assignee", "alice")
+	assert.NoError(t, err)
+	assert.Contains(t, out, "Opened issue #1: https://github.com/org/repo1/issues/1")
+	assert.Contains(t, out, "turbolift create-issues completed (2 OK, 0 skipped)")
+
+	assert.Equal(t, []github.Issue{
+		{Title: "Migrate repo1 by March", Body: "Please migrate org/repo1.", Repo: "org/repo1", Labels: []string{"migration", "platform"}, Assignees: []string{"alice"}},
+		{Title: "Migrate repo2 by March", Body: "Please migrate org/repo2.", Repo: "org/repo2", Labels: []string{"migration", "platform"}, Assignees: []string{"alice"}},
+	}, fakeGitHub.Issues)
+
+	issues, err := campaign.ReadIssues()
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]github.CreatedIssue{
+		"org/repo1": {Number: 1, Url: "https://github.com/org/repo1/issues/1"},
+		"org/repo2": {Number: 2, Url: "https://github.com/org/repo2/issues/2"},
+	}, issues)
+}
+
+func TestItSkipsReposWhichAlreadyHaveAnIssue(t *testing.T) {
+	fakeGitHub := github.NewAlwaysSucceedsFakeGitHub()
+	gh = fakeGitHub
+
+	testsupport.PrepareTempCampaign(false, "org/repo1", "org/repo2")
+	writeTemplate("# Migrate\n")
+	assert.NoError(t, campaign.WriteIssues(map[string]github.CreatedIssue{
+		"org/repo1": {Number: 7, Url: "https://github.com/org/repo1/issues/7"},
+	}))
+
+	out, err := runCommand()
+	assert.NoError(t, err)
+	assert.Contains(t, out, "An issue has already been opened: https://github.com/org/repo1/issues/7")
+	assert.Contains(t, out, "turbolift create-issues completed (1 OK, 1 skipped)")
+
+	fakeGitHub.AssertCalledWith(t, [][]string{
+		{".", "org/repo2", "Migrate"},
+	})
+
+	issues, err := campaign.ReadIssues()
+	assert.NoError(t, err)
+	assert.Len(t, issues, 2)
+}
+
+func TestItReportsFailuresToOpenIssues(t *testing.T) {
+	gh = github.NewAlwaysFailsFakeGitHub()
+
+	testsupport.PrepareTempCampaign(false, "org/repo1")
+	writeTemplate("# Migrate\n")
+
+	out, err := runCommand()
+	assert.NoError(t, err)
+	assert.Contains(t, out, "turbolift create-issues completed with errors (0 OK, 0 skipped, 1 errored)")
+
+	issues, err := campaign.ReadIssues()
+	assert.NoError(t, err)
+	assert.Empty(t, issues)
+}
+
+func TestItFailsWithoutATemplate(t *testing.T) {
+	fakeGitHub := github.NewAlwaysSucceedsFakeGitHub()
+	gh = fakeGitHub
+
+	testsupport.PrepareTempCampaign(false, "org/repo1")
+
+	out, err := runCommand()
+	assert.NoError(t, err)
+	assert.Contains(t, out, "unable to open issue template file: ISSUE.md")
+
+	fakeGitHub.AssertCalledWith(t, [][]string{})
+}
+
+func TestItRendersTitleAndBody(t *testing.T) {
+	testCases := []struct {
+		Name          string
+		Template      string
+		ExpectedTitle string
+		ExpectedBody  string
+	}{
+		{
+			Name:          "title only",
+			Template:      "# Upgrade {{.OrgName}}",
+			ExpectedTitle: "Upgrade org",
+			ExpectedBody:  "",
+		},
+		{
+			Name:          "title and body",
+			Template:      "Upgrade\n\nFor campaign {{.Campaign}}\n",
+			ExpectedTitle: "Upgrade",
+			ExpectedBody:  "For campaign my-campaign",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			testsupport.PrepareTempCampaign(false)
+			writeTemplate(tc.Template)
+			issueTemplate, err := campaign.ReadTemplateFile("ISSUE.md", "issue template")
+			assert.NoError(t, err)
+
+			title, body, err := render(issueTemplate, campaign.TemplateData{Campaign: "my-campaign", OrgName: "org"})
+			assert.NoError(t, err)
+			assert.Equal(t, tc.ExpectedTitle, title)
+			assert.Equal(t, tc.ExpectedBody, body)
+		})
+	}
+}
+
+func writeTemplate(contents string) {
+	if err := ioutil.WriteFile("ISSUE.md", []byte(contents), 0o644); err != nil {
+		panic(err)
+	}
+}
+
+func runCommand(args ...string) (string, error) {
+	cmd := NewCreateIssuesCmd()
+	cmd.SetArgs(args)
+	outBuffer := bytes.NewBufferString("")
+	cmd.SetOut(outBuffer)
+	err := cmd.Execute()
+	if err != nil {
+		return outBuffer.String(), err
+	}
+	return outBuffer.String(), nil
+}
@@ -0,0 +1,132 @@
+/*
+ * Copyright 2021 Skyscanner Limited.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * https://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package diff
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/fatih/color"
+	"github.com/rodaine/table"
+	"github.com/spf13/cobra"
+
+	"github.com/skyscanner/turbolift/internal/campaign"
+	"github.com/skyscanner/turbolift/internal/changes"
+	"github.com/skyscanner/turbolift/internal/colors"
+	"github.com/skyscanner/turbolift/internal/git"
+	"github.com/skyscanner/turbolift/internal/github"
+	"github.com/skyscanner/turbolift/internal/interrupt"
+	"github.com/skyscanner/turbolift/internal/logging"
+)
+
+var (
+	gh github.GitHub = github.NewCachingGitHub(github.NewGitHub())
+	g  git.Git       = git.NewRealGit()
+)
+
+var (
+	repoFile  string
+	showPaths bool
+)
+
+func NewDiffCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "diff",
+		Short: "Summarise the changes in each repository against its base branch",
+		Long: `Summarise the changes in each repository's working copy, committed or not, against the base branch,
+with a total across the campaign, so that changes can be checked before they are committed and pushed.`,
+		Run: run,
+	}
+
+	cmd.Flags().StringVar(&repoFile, "repos", "repos.txt", "A file containing a list of repositories to summarise.")
+	cmd.Flags().BoolVar(&showPaths, "paths", false, "Also list the paths with the most changes in each repository.")
+
+	return cmd
+}
+
+func run(c *cobra.Command, _ []string) {
+	logger := logging.NewLogger(c)
+
+	readCampaignActivity := logger.StartSetupActivity("Reading campaign data (%s)", repoFile)
+	options := campaign.NewCampaignOptions()
+	options.RepoFilename = repoFile
+	dir, err := campaign.OpenCampaign(options)
+	if err != nil {
+		readCampaignActivity.EndWithFailure(err)
+		return
+	}
+	readCampaignActivity.EndWithSuccess()
+
+	diffTable := table.New("Repository", "Files", "Insertions", "Deletions")
+	diffTable.WithHeaderFormatter(color.New(color.Underline).SprintfFunc())
+	diffTable.WithFirstColumnFormatter(colors.Cyanf)
+	diffTable.WithWriter(logger.Writer())
+
+	total := &changes.Summary{}
+	changedCount := 0
+	unchangedCount := 0
+	skippedCount := 0
+	errorCount := 0
+	interrupt.ForEachRepo(logger, dir.Repos, func(repo campaign.Repo) {
+		repoDirPath := repo.FullRepoPath()
+
+		diffActivity := logger.StartActivity("Summarising changes in %s", repo.FullRepoName)
+		// skip if the working copy does not exist
+		if _, err = os.Stat(repoDirPath); os.IsNotExist(err) {
+			diffActivity.EndWithWarningf("Directory %s does not exist - has it been cloned?", repoDirPath)
+			skippedCount++
+			return
+		}
+
+		summary, err := changes.SummariseWorkingCopy(diffActivity.Writer(), g, gh, repo)
+		if err != nil {
+			diffActivity.EndWithFailure(err)
+			errorCount++
+			return
+		}
+		if len(summary.Files) == 0 {
+			diffActivity.EndWithWarning("No changes")
+			unchangedCount++
+			return
+		}
+		if showPaths {
+			for _, path := range summary.NotablePaths() {
+				diffActivity.Log(path.String())
+			}
+			diffActivity.EndWithSuccessAndEmitLogs()
+		} else {
+			diffActivity.EndWithSuccess()
+		}
+
+		files, insertions, deletions := summary.Totals()
+		diffTable.AddRow(repo.FullRepoName, files, colors.Green("+", insertions), colors.Red("-", deletions))
+		total.Files = append(total.Files, summary.Files...)
+		changedCount++
+	})
+
+	if errorCount == 0 {
+		logger.Successf("turbolift diff completed %s(%s, %s, %s)\n", colors.Normal(), colors.Green(changedCount, " changed"), colors.Yellow(unchangedCount, " unchanged"), colors.Yellow(skippedCount, " skipped"))
+	} else {
+		logger.Warnf("turbolift diff completed with %s %s(%s, %s, %s, %s)\n", colors.Red("errors"), colors.Normal(), colors.Green(changedCount, " changed"), colors.Yellow(unchangedCount, " unchanged"), colors.Yellow(skippedCount, " skipped"), colors.Red(errorCount, " errored"))
+	}
+
+	if changedCount > 0 {
+		logger.Println()
+		diffTable.Print()
+		logger.Println()
+		logger.Println(fmt.Sprintf("Total across %d repositories: %s", changedCount, total))
+	}
+}
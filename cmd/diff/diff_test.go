@@ -0,0 +1,96 @@
+/*
+ * Copyright 2021 Skyscanner Limited.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * https://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package diff
+
+import (
+	"bytes"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/skyscanner/turbolift/internal/git"
+	"github.com/skyscanner/turbolift/internal/github"
+	"github.com/skyscanner/turbolift/internal/testsupport"
+)
+
+func init() {
+	// disable output colouring so that strings we want to do 'Contains' checks on do not have ANSI escape sequences in IDEs
+	_ = os.Setenv("NO_COLOR", "1")
+}
+
+func TestItSummarisesChangesPerRepoAndInTotal(t *testing.T) {
+	gh = github.NewAlwaysSucceedsFakeGitHub()
+	fakeGit := git.NewAlwaysSucceedsFakeGit()
+	g = fakeGit
+
+	testsupport.PrepareTempCampaign(true, "org/repo1", "org/repo2", "org/repo3")
+	_ = os.Remove("work/org/repo3")
+
+	out, err := runCommand()
+	assert.NoError(t, err)
+	assert.Contains(t, out, "Summarising changes in org/repo1")
+	assert.Contains(t, out, "turbolift diff completed (2 changed, 0 unchanged, 1 skipped)")
+	assert.Regexp(t, "org/repo1\\s+3\\s+\\+10\\s+-2", out)
+	assert.Regexp(t, "org/repo2\\s+3\\s+\\+10\\s+-2", out)
+	assert.Contains(t, out, "Total across 2 repositories: 6 files changed, 20 insertions(+), 4 deletions(-)")
+	assert.NotContains(t, out, "src/ (2 files")
+
+	fakeGit.AssertCalledWith(t, [][]string{
+		{"remotes", "work/org/repo1"},
+		{"fetch", "work/org/repo1", "origin", "main"},
+		{"diffNumstat", "work/org/repo1", "origin/main"},
+		{"remotes", "work/org/repo2"},
+		{"fetch", "work/org/repo2", "origin", "main"},
+		{"diffNumstat", "work/org/repo2", "origin/main"},
+	})
+}
+
+func TestItListsNotablePathsWhenAsked(t *testing.T) {
+	gh = github.NewAlwaysSucceedsFakeGitHub()
+	g = git.NewAlwaysSucceedsFakeGit()
+
+	testsupport.PrepareTempCampaign(true, "org/repo1")
+
+	out, err := runCommand("--paths")
+	assert.NoError(t, err)
+	assert.Contains(t, out, "src/ (2 files, +9 -2)")
+	assert.Contains(t, out, "README.md (+1 -0)")
+}
+
+func TestItReportsErrors(t *testing.T) {
+	gh = github.NewAlwaysFailsFakeGitHub()
+	g = git.NewAlwaysSucceedsFakeGit()
+
+	testsupport.PrepareTempCampaign(true, "org/repo1")
+
+	out, err := runCommand()
+	assert.NoError(t, err)
+	assert.Contains(t, out, "turbolift diff completed with errors (0 changed, 0 unchanged, 0 skipped, 1 errored)")
+	assert.NotContains(t, out, "Total across")
+}
+
+func runCommand(args ...string) (string, error) {
+	cmd := NewDiffCmd()
+	cmd.SetArgs(args)
+	outBuffer := bytes.NewBufferString("")
+	cmd.SetOut(outBuffer)
+	err := cmd.Execute()
+	if err != nil {
+		return outBuffer.String(), err
+	}
+	return outBuffer.String(), nil
+}
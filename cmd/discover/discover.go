@@ -0,0 +1,136 @@
+/*
+ * Copyright 2021 Skyscanner Limited.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * https://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package discover
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/skyscanner/turbolift/internal/colors"
+	"github.com/skyscanner/turbolift/internal/github"
+	"github.com/skyscanner/turbolift/internal/logging"
+)
+
+var gh github.GitHub = github.NewGitHub()
+
+var (
+	team     string
+	repoFile string
+)
+
+func NewDiscoverCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "discover",
+		Short: "Add the repositories owned by a team to the repo file",
+		Run:   run,
+	}
+
+	cmd.Flags().StringVar(&team, "team", "", "A team, as org/team-slug, whose administered or maintained repositories should be added.")
+	cmd.Flags().StringVar(&repoFile, "repos", "repos.txt", "A file containing a list of repositories to add to.")
+
+	err := cmd.MarkFlagRequired("team")
+	if err != nil {
+		panic(err)
+	}
+
+	return cmd
+}
+
+func run(c *cobra.Command, _ []string) {
+	logger := logging.NewLogger(c)
+
+	splitTeam := strings.Split(team, "/")
+	if len(splitTeam) != 2 || splitTeam[0] == "" || splitTeam[1] == "" {
+		logger.FlagErrorf("Unable to parse team %s - expected org/team-slug", team)
+		return
+	}
+	orgName, teamSlug := splitTeam[0], splitTeam[1]
+
+	listActivity := logger.StartActivity("Listing repositories of team %s", team)
+	teamRepos, err := gh.ListTeamRepos(listActivity.Writer(), ".", orgName, teamSlug)
+	if err != nil {
+		listActivity.EndWithFailure(err)
+		return
+	}
+	listActivity.EndWithSuccess()
+
+	writeActivity := logger.StartActivity("Adding repositories to %s", repoFile)
+	existingRepos, err := readExistingRepos(repoFile)
+	if err != nil {
+		writeActivity.EndWithFailure(err)
+		return
+	}
+
+	var newRepos []string
+	for _, repo := range teamRepos {
+		if _, seen := existingRepos[repo]; !seen {
+			newRepos = append(newRepos, repo)
+			existingRepos[repo] = struct{}{}
+		}
+	}
+
+	if len(newRepos) > 0 {
+		err = appendRepos(repoFile, fmt.Sprintf("# Repositories administered or maintained by %s", team), newRepos)
+		if err != nil {
+			writeActivity.EndWithFailure(err)
+			return
+		}
+	}
+	writeActivity.EndWithSuccess()
+
+	logger.Successf("turbolift discover completed %s(%s, %s)\n", colors.Normal(), colors.Green(len(newRepos), " added"), colors.Yellow(len(teamRepos)-len(newRepos), " already listed"))
+}
+
+func readExistingRepos(filename string) (map[string]interface{}, error) {
+	existing := map[string]interface{}{}
+
+	file, err := os.Open(filename)
+	if os.IsNotExist(err) {
+		return existing, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("unable to open repo file: %s", filename)
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		existing[strings.TrimSpace(scanner.Text())] = struct{}{}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("unable to read repo file %s: %w", filename, err)
+	}
+	return existing, nil
+}
+
+func appendRepos(filename string, comment string, repos []string) error {
+	file, err := os.OpenFile(filename, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return fmt.Errorf("unable to open repo file for writing: %w", err)
+	}
+
+	_, err = fmt.Fprintf(file, "\n%s\n%s\n", comment, strings.Join(repos, "\n"))
+	closeErr := file.Close()
+	if err != nil {
+		return fmt.Errorf("unable to write repo file: %w", err)
+	}
+	return closeErr
+}
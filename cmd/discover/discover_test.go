@@ -0,0 +1,87 @@
+/*
+ * Copyright 2021 Skyscanner Limited.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * https://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package discover
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/skyscanner/turbolift/internal/github"
+	"github.com/skyscanner/turbolift/internal/testsupport"
+)
+
+func TestItAppendsTeamReposToTheRepoFile(t *testing.T) {
+	fakeGitHub := github.NewAlwaysSucceedsFakeGitHub()
+	gh = fakeGitHub
+
+	testsupport.PrepareTempCampaign(false, "other/repo3", "org/repo1")
+
+	out, err := runCommand("org/platform-team")
+	assert.NoError(t, err)
+	assert.Contains(t, out, "Listing repositories of team org/platform-team")
+	assert.Contains(t, out, "turbolift discover completed")
+	assert.Contains(t, out, "1 added, 1 already listed")
+
+	contents, err := ioutil.ReadFile("repos.txt")
+	assert.NoError(t, err)
+	assert.Equal(t, "other/repo3\norg/repo1\n# Repositories administered or maintained by org/platform-team\norg/repo2\n", string(contents))
+
+	fakeGitHub.AssertCalledWith(t, [][]string{
+		{".", "org", "platform-team"},
+	})
+}
+
+func TestItRejectsMalformedTeams(t *testing.T) {
+	fakeGitHub := github.NewAlwaysSucceedsFakeGitHub()
+	gh = fakeGitHub
+
+	testsupport.PrepareTempCampaign(false)
+
+	out, err := runCommand("platform-team")
+	assert.NoError(t, err)
+	assert.Contains(t, out, "Unable to parse team platform-team")
+
+	fakeGitHub.AssertCalledWith(t, [][]string{})
+}
+
+func TestItDoesNotWriteTheRepoFileWhenListingFails(t *testing.T) {
+	fakeGitHub := github.NewAlwaysFailsFakeGitHub()
+	gh = fakeGitHub
+
+	testsupport.PrepareTempCampaign(false, "org/repo1")
+
+	_, err := runCommand("org/platform-team")
+	assert.NoError(t, err)
+
+	contents, err := ioutil.ReadFile("repos.txt")
+	assert.NoError(t, err)
+	assert.Equal(t, "org/repo1", string(contents))
+}
+
+func runCommand(team string) (string, error) {
+	cmd := NewDiscoverCmd()
+	outBuffer := bytes.NewBufferString("")
+	cmd.SetOut(outBuffer)
+	cmd.SetArgs([]string{"--team", team})
+	err := cmd.Execute()
+	if err != nil {
+		return outBuffer.String(), err
+	}
+	return outBuffer.String(), nil
+}
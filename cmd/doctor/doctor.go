@@ -0,0 +1,318 @@
+/*
+ * Copyright 2021 Skyscanner Limited.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * https://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package doctor
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/skyscanner/turbolift/internal/campaign"
+	"github.com/skyscanner/turbolift/internal/changes"
+	"github.com/skyscanner/turbolift/internal/colors"
+	"github.com/skyscanner/turbolift/internal/config"
+	"github.com/skyscanner/turbolift/internal/executor"
+	"github.com/skyscanner/turbolift/internal/git"
+	"github.com/skyscanner/turbolift/internal/github"
+	"github.com/skyscanner/turbolift/internal/logging"
+	"github.com/skyscanner/turbolift/internal/upgrade"
+)
+
+var (
+	exec executor.Executor = executor.NewRealExecutor()
+	g    git.Git           = git.NewRealGit()
+	gh   github.GitHub     = github.NewCachingGitHub(github.NewGitHub())
+)
+
+// The oldest versions that support everything turbolift uses, e.g. GIT_CONFIG_COUNT for the configured protocol and
+// gh's --json output
+const (
+	minGitVersion = "2.31.0"
+	minGhVersion  = "2.0.0"
+)
+
+var repoFile string
+
+var versionPattern = regexp.MustCompile(`(\d+)\.(\d+)(?:\.(\d+))?`)
+
+func NewDoctorCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "doctor",
+		Short: "Check that git, gh and GitHub credentials are set up for turbolift",
+		Long: `Check that git and gh are installed and recent enough, that git has an identity to commit with, that gh is
+logged in to every host the campaign's repositories are on with sufficient token scopes, and that SSH credentials work
+where git uses SSH. Each problem found is reported with a hint on how to fix it. Outside a campaign directory, only the default host is checked.`,
+		Args: cobra.NoArgs,
+		Run:  run,
+	}
+
+	cmd.Flags().StringVar(&repoFile, "repos", "repos.txt", "A file containing a list of repositories whose hosts to check.")
+
+	return cmd
+}
+
+// check is the outcome of a single diagnostic. A failed check is expected to stop turbolift working, whereas a
+// warning may or may not.
+type check struct {
+	failed  bool
+	warning string
+	err     error
+	hint    string
+}
+
+func passed() check {
+	return check{}
+}
+
+func warn(hint string, format string, args ...interface{}) check {
+	return check{warning: fmt.Sprintf(format, args...), hint: hint}
+}
+
+func fail(hint string, format string, args ...interface{}) check {
+	return check{failed: true, err: fmt.Errorf(format, args...), hint: hint}
+}
+
+func run(c *cobra.Command, _ []string) {
+	logger := logging.NewLogger(c)
+
+	var passedCount, warningCount, failedCount int
+	report := func(activity *logging.Activity, result check) {
+		switch {
+		case result.failed:
+			activity.EndWithFailuref("%v. To fix: %s", result.err, result.hint)
+			failedCount++
+		case result.warning != "":
+			activity.EndWithWarningf("%s. To fix: %s", result.warning, result.hint)
+			warningCount++
+		default:
+			activity.EndWithSuccess()
+			passedCount++
+		}
+	}
+
+	gitActivity := logger.StartActivity("Checking git is installed (%s or later)", minGitVersion)
+	report(gitActivity, checkVersion(gitActivity.Writer(), "git", minGitVersion, "install or upgrade git from https://git-scm.com/downloads"))
+
+	ghActivity := logger.StartActivity("Checking gh is installed (%s or later)", minGhVersion)
+	report(ghActivity, checkVersion(ghActivity.Writer(), "gh", minGhVersion, "install or upgrade gh from https://cli.github.com"))
+
+	identityActivity := logger.StartActivity("Checking git identity for commits")
+	report(identityActivity, checkIdentity(identityActivity.Writer()))
+
+	cfg, err := config.Load()
+	if err != nil {
+		cfg = &config.Config{}
+	}
+
+	for _, host := range campaignHosts(logger) {
+		authActivity := logger.StartActivity("Checking gh is logged in to %s", host.name)
+		authResult := checkAuth(authActivity.Writer(), host.name)
+		report(authActivity, authResult)
+		if authResult.failed {
+			continue
+		}
+
+		scopesActivity := logger.StartActivity("Checking token scopes for %s", host.name)
+		report(scopesActivity, checkScopes(scopesActivity.Writer(), host))
+
+		protocol := cfg.Protocol
+		if protocol == "" {
+			protocol, _ = exec.ExecuteAndCapture(ioutil.Discard, ".", "gh", "config", "get", "git_protocol", "--host", host.name)
+			protocol = strings.TrimSpace(protocol)
+		}
+		if protocol == "ssh" {
+			sshActivity := logger.StartActivity("Checking SSH authentication to %s", host.name)
+			report(sshActivity, checkSSH(sshActivity.Writer(), host.name))
+		}
+	}
+
+	if failedCount == 0 {
+		logger.Successf("turbolift doctor completed %s(%s, %s)\n", colors.Normal(), colors.Green(passedCount, " passed"), colors.Yellow(warningCount, " warnings"))
+	} else {
+		logger.Warnf("turbolift doctor completed with %s %s(%s, %s, %s)\n", colors.Red("problems"), colors.Normal(), colors.Green(passedCount, " passed"), colors.Yellow(warningCount, " warnings"), colors.Red(failedCount, " failed"))
+	}
+}
+
+func checkVersion(output io.Writer, tool string, minVersion string, hint string) check {
+	versionOutput, err := exec.ExecuteAndCapture(output, ".", tool, "--version")
+	if err != nil {
+		return fail(hint, "%s could not be run: %v", tool, err)
+	}
+	version := parseVersion(versionOutput)
+	if version == "" {
+		return warn(hint, "unable to determine the version of %s from %q", tool, strings.TrimSpace(versionOutput))
+	}
+	if upgrade.IsNewer(minVersion, version) {
+		return fail(hint, "%s %s is too old - turbolift needs %s or later", tool, version, minVersion)
+	}
+	return passed()
+}
+
+// parseVersion finds the version in the output of e.g. git --version ("git version 2.39.2 (Apple Git-143)")
+func parseVersion(versionOutput string) string {
+	match := versionPattern.FindStringSubmatch(versionOutput)
+	if match == nil {
+		return ""
+	}
+	patch := match[3]
+	if patch == "" {
+		patch = "0"
+	}
+	return fmt.Sprintf("%s.%s.%s", match[1], match[2], patch)
+}
+
+// checkIdentity checks that commits will be authored by someone, rather than an identity git guesses from the user
+// and host names, which DCO checks on sign-offs would reject
+func checkIdentity(output io.Writer) check {
+	hint := "set git.name and git.email in turbolift's user configuration, or run git config --global user.name and user.email"
+	ident, err := exec.ExecuteAndCapture(output, ".", "git", "-c", "user.useConfigOnly=true", "var", "GIT_AUTHOR_IDENT")
+	if err != nil {
+		return fail(hint, "no git identity is configured, so commits cannot be made or signed off")
+	}
+	_, email, _ := cut(ident, "<")
+	email, _, _ = cut(email, ">")
+	if !strings.Contains(email, "@") {
+		return warn(hint, "the git identity's email %q is not an email address, so sign-offs may not be accepted", email)
+	}
+	return passed()
+}
+
+func checkAuth(output io.Writer, host string) check {
+	if _, err := exec.ExecuteAndCapture(output, ".", "gh", "auth", "status", "--hostname", host); err != nil {
+		if config.Token() != "" {
+			return fail(fmt.Sprintf("check that the token in %s is valid for %s", strings.Join(config.TokenVariables, " or "), host), "gh is unable to authenticate to %s with the token from the environment", host)
+		}
+		return fail(fmt.Sprintf("run gh auth login --hostname %s, or give a token in TURBOLIFT_TOKEN", host), "gh is not logged in to %s", host)
+	}
+	return passed()
+}
+
+func checkScopes(output io.Writer, host host) check {
+	response, err := exec.ExecuteAndCapture(output, ".", "gh", "api", "--hostname", host.name, "--include", "user")
+	if err != nil {
+		return fail(fmt.Sprintf("run gh auth login --hostname %s", host.name), "unable to query %s with the current token", host.name)
+	}
+
+	scopes, ok := tokenScopes(response)
+	if !ok {
+		return warn("check that the token can push to, and raise PRs on, the campaign's repositories", "unable to determine the scopes of the token for %s, e.g. because it is a fine-grained token", host.name)
+	}
+
+	var missing []string
+	if !scopes["repo"] {
+		missing = append(missing, "repo")
+	}
+	if host.changesWorkflows && !scopes["workflow"] {
+		missing = append(missing, "workflow")
+	}
+	if len(missing) > 0 {
+		return fail(fmt.Sprintf("run gh auth refresh --hostname %s --scopes %s", host.name, strings.Join(missing, ",")), "the token for %s is missing the %s scope(s)", host.name, strings.Join(missing, ", "))
+	}
+	return passed()
+}
+
+// tokenScopes reads the scopes of a classic token from the X-OAuth-Scopes header of an API response
+func tokenScopes(response string) (map[string]bool, bool) {
+	for _, line := range strings.Split(response, "\n") {
+		name, value, found := cut(line, ":")
+		if !found || !strings.EqualFold(strings.TrimSpace(name), "X-OAuth-Scopes") {
+			continue
+		}
+		scopes := map[string]bool{}
+		for _, scope := range strings.Split(value, ",") {
+			scopes[strings.TrimSpace(scope)] = true
+		}
+		return scopes, true
+	}
+	return nil, false
+}
+
+func checkSSH(output io.Writer, host string) check {
+	hint := fmt.Sprintf("add your SSH key to the agent with ssh-add, and to your account on %s", host)
+	if os.Getenv("SSH_AUTH_SOCK") == "" {
+		return warn(hint, "no SSH agent is running, so any passphrase-protected key will be prompted for repeatedly")
+	}
+	// GitHub always exits with a failure here, as it doesn't provide shell access
+	response, _ := exec.ExecuteAndCapture(output, ".", "ssh", "-T", "-o", "BatchMode=yes", "git@"+host)
+	if !strings.Contains(response, "successfully authenticated") {
+		return fail(hint, "unable to authenticate to %s over SSH", host)
+	}
+	return passed()
+}
+
+type host struct {
+	name             string
+	changesWorkflows bool
+}
+
+// campaignHosts returns the hosts of the campaign's repositories, noting which have working copies that change
+// GitHub Actions workflows. Outside a campaign, only the default host is returned.
+func campaignHosts(logger *logging.Logger) []host {
+	defaultHost := os.Getenv("GH_HOST")
+	if defaultHost == "" {
+		defaultHost = "github.com"
+	}
+
+	options := campaign.NewCampaignOptions()
+	options.RepoFilename = repoFile
+	dir, err := campaign.OpenCampaign(options)
+	if err != nil || len(dir.Repos) == 0 {
+		return []host{{name: defaultHost}}
+	}
+
+	workflowActivity := logger.StartActivity("Checking which repositories change GitHub Actions workflows")
+	hosts := map[string]*host{}
+	for _, repo := range dir.Repos {
+		name := repo.Host
+		if name == "" {
+			name = defaultHost
+		}
+		if hosts[name] == nil {
+			hosts[name] = &host{name: name}
+		}
+
+		if _, err := os.Stat(repo.FullRepoPath()); err != nil {
+			continue
+		}
+		summary, err := changes.SummariseWorkingCopy(workflowActivity.Writer(), g, gh, repo)
+		if err == nil && summary.ChangesWorkflows() {
+			workflowActivity.Logf("%s changes workflows", repo.FullRepoName)
+			hosts[name].changesWorkflows = true
+		}
+	}
+	workflowActivity.EndWithSuccessAndEmitLogs()
+
+	var result []host
+	for _, h := range hosts {
+		result = append(result, *h)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].name < result[j].name })
+	return result
+}
+
+// cut is strings.Cut, which is not available in Go 1.16
+func cut(s string, sep string) (before string, after string, found bool) {
+	if i := strings.Index(s, sep); i >= 0 {
+		return s[:i], s[i+len(sep):], true
+	}
+	return s, "", false
+}
@@ -0,0 +1,204 @@
+/*
+ * Copyright 2021 Skyscanner Limited.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * https://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package doctor
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/skyscanner/turbolift/internal/executor"
+	"github.com/skyscanner/turbolift/internal/testsupport"
+)
+
+func init() {
+	// disable output colouring so that strings we want to do 'Contains' checks on do not have ANSI escape sequences in IDEs
+	_ = os.Setenv("NO_COLOR", "1")
+}
+
+// fakeTools answers as a correctly set up environment would, except for the overridden commands
+func fakeTools(overrides map[string]string) *executor.FakeExecutor {
+	responses := map[string]string{
+		"git --version": "git version 2.39.2 (Apple Git-143)",
+		"gh --version":  "gh version 2.32.1 (2023-07-24)",
+		"git -c user.useConfigOnly=true var GIT_AUTHOR_IDENT": "Jane Doe <jane@example.com> 1697000000 +0100",
+		"gh auth status --hostname github.com":                "Logged in to github.com",
+		"gh api --hostname github.com --include user":         "HTTP/2.0 200 OK\nX-Oauth-Scopes: gist, read:org, repo, workflow\n\n{}",
+		"gh config get git_protocol --host github.com":        "https",
+		"ssh -T -o BatchMode=yes git@github.com":              "Hi someone! You've successfully authenticated, but GitHub does not provide shell access.",
+	}
+	for command, response := range overrides {
+		responses[command] = response
+	}
+
+	return executor.NewFakeExecutor(func(string, string, ...string) error {
+		return nil
+	}, func(_ string, name string, args ...string) (string, error) {
+		response, ok := responses[strings.Join(append([]string{name}, args...), " ")]
+		if !ok || response == "FAIL" {
+			return "", errors.New("synthetic error")
+		}
+		return response, nil
+	})
+}
+
+func TestItPassesAWorkingEnvironment(t *testing.T) {
+	exec = fakeTools(nil)
+	prepareCampaign()
+
+	out, err := runCommand()
+	assert.NoError(t, err)
+	assert.Contains(t, out, "Checking gh is logged in to github.com")
+	assert.NotContains(t, out, "Checking SSH authentication")
+	assert.Contains(t, out, "turbolift doctor completed (5 passed, 0 warnings)")
+}
+
+func TestItReportsProblemsWithFixHints(t *testing.T) {
+	clearTokens()
+	exec = fakeTools(map[string]string{
+		"git --version":                        "git version 2.20.1",
+		"gh auth status --hostname github.com": "FAIL",
+	})
+	prepareCampaign()
+
+	out, err := runCommand()
+	assert.NoError(t, err)
+	assert.Contains(t, out, "git 2.20.1 is too old - turbolift needs 2.31.0 or later. To fix: install or upgrade git")
+	assert.Contains(t, out, "gh is not logged in to github.com. To fix: run gh auth login --hostname github.com")
+	assert.NotContains(t, out, "Checking token scopes")
+	assert.Contains(t, out, "turbolift doctor completed with problems (2 passed, 0 warnings, 2 failed)")
+}
+
+func TestItPointsAtTheTokenFromTheEnvironmentWhenAuthenticationFails(t *testing.T) {
+	clearTokens()
+	defer clearTokens()
+	_ = os.Setenv("TURBOLIFT_TOKEN", "expired")
+	exec = fakeTools(map[string]string{
+		"gh auth status --hostname github.com": "FAIL",
+	})
+	prepareCampaign()
+
+	out, err := runCommand()
+	assert.NoError(t, err)
+	assert.Contains(t, out, "gh is unable to authenticate to github.com with the token from the environment. To fix: check that the token in TURBOLIFT_TOKEN or GITHUB_TOKEN is valid for github.com")
+}
+
+// clearTokens stops a token in the environment running the tests from changing how authentication is checked
+func clearTokens() {
+	_ = os.Unsetenv("TURBOLIFT_TOKEN")
+	_ = os.Unsetenv("GITHUB_TOKEN")
+}
+
+func TestItChecksSSHWhenGitUsesSSH(t *testing.T) {
+	exec = fakeTools(map[string]string{
+		"gh config get git_protocol --host github.com": "ssh\n",
+		"ssh -T -o BatchMode=yes git@github.com":       "git@github.com: Permission denied (publickey).",
+	})
+	prepareCampaign()
+	_ = os.Setenv("SSH_AUTH_SOCK", "/tmp/agent.sock")
+	defer func() { _ = os.Unsetenv("SSH_AUTH_SOCK") }()
+
+	out, err := runCommand()
+	assert.NoError(t, err)
+	assert.Contains(t, out, "unable to authenticate to github.com over SSH. To fix: add your SSH key to the agent")
+	assert.Contains(t, out, "(5 passed, 0 warnings, 1 failed)")
+}
+
+func TestItRequiresAConfiguredGitIdentity(t *testing.T) {
+	exec = fakeTools(map[string]string{
+		"git -c user.useConfigOnly=true var GIT_AUTHOR_IDENT": "FAIL",
+	})
+
+	result := checkIdentity(ioutil.Discard)
+	assert.True(t, result.failed)
+	assert.EqualError(t, result.err, "no git identity is configured, so commits cannot be made or signed off")
+	assert.Contains(t, result.hint, "git.email")
+}
+
+func TestItWarnsAboutIdentitiesWithoutAnEmailAddress(t *testing.T) {
+	exec = fakeTools(map[string]string{
+		"git -c user.useConfigOnly=true var GIT_AUTHOR_IDENT": "Jane Doe <jane> 1697000000 +0100",
+	})
+
+	assert.Equal(t, `the git identity's email "jane" is not an email address, so sign-offs may not be accepted`, checkIdentity(ioutil.Discard).warning)
+}
+
+func TestItChecksHostsOfTheCampaignRepos(t *testing.T) {
+	exec = fakeTools(map[string]string{
+		"gh auth status --hostname github.example.com": "FAIL",
+	})
+	prepareCampaign("org/repo1", "github.example.com/org/repo2")
+
+	out, err := runCommand()
+	assert.NoError(t, err)
+	assert.Contains(t, out, "gh is not logged in to github.example.com")
+	assert.Contains(t, out, "(5 passed, 0 warnings, 1 failed)")
+}
+
+func TestItRequiresTheWorkflowScopeToChangeWorkflows(t *testing.T) {
+	exec = fakeTools(map[string]string{
+		"gh api --hostname github.com --include user": "HTTP/2.0 200 OK\nX-Oauth-Scopes: repo\n\n{}",
+	})
+
+	assert.Equal(t, passed(), checkScopes(ioutil.Discard, host{name: "github.com"}))
+
+	result := checkScopes(ioutil.Discard, host{name: "github.com", changesWorkflows: true})
+	assert.True(t, result.failed)
+	assert.EqualError(t, result.err, "the token for github.com is missing the workflow scope(s)")
+	assert.Equal(t, "run gh auth refresh --hostname github.com --scopes workflow", result.hint)
+}
+
+func TestItWarnsWhenTokenScopesAreUnknown(t *testing.T) {
+	exec = fakeTools(map[string]string{
+		"gh api --hostname github.com --include user": "HTTP/2.0 200 OK\n\n{}",
+	})
+
+	result := checkScopes(ioutil.Discard, host{name: "github.com"})
+	assert.False(t, result.failed)
+	assert.Contains(t, result.warning, "unable to determine the scopes of the token for github.com")
+}
+
+func TestItParsesToolVersions(t *testing.T) {
+	assert.Equal(t, "2.39.2", parseVersion("git version 2.39.2 (Apple Git-143)"))
+	assert.Equal(t, "2.41.0", parseVersion("git version 2.41.0.windows.1"))
+	assert.Equal(t, "2.0.0", parseVersion("gh version 2.0 (2021-08-23)"))
+	assert.Equal(t, "", parseVersion("command not found"))
+}
+
+func prepareCampaign(repos ...string) {
+	testsupport.PrepareTempCampaign(false, repos...)
+	// keep the user's own configuration out of the tests
+	cwd, _ := os.Getwd()
+	_ = os.Setenv("XDG_CONFIG_HOME", cwd)
+	_ = os.Unsetenv("GH_HOST")
+}
+
+func runCommand(args ...string) (string, error) {
+	cmd := NewDoctorCmd()
+	cmd.SetArgs(args)
+	outBuffer := bytes.NewBufferString("")
+	cmd.SetOut(outBuffer)
+	err := cmd.Execute()
+	if err != nil {
+		return outBuffer.String(), err
+	}
+	return outBuffer.String(), nil
+}
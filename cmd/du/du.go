@@ -0,0 +1,275 @@
+/*
+ * Copyright 2021 Skyscanner Limited.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * https://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package du
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/fatih/color"
+	"github.com/rodaine/table"
+	"github.com/spf13/cobra"
+
+	"github.com/skyscanner/turbolift/internal/campaign"
+	"github.com/skyscanner/turbolift/internal/colors"
+	"github.com/skyscanner/turbolift/internal/git"
+	"github.com/skyscanner/turbolift/internal/github"
+	"github.com/skyscanner/turbolift/internal/interrupt"
+	"github.com/skyscanner/turbolift/internal/logging"
+	"github.com/skyscanner/turbolift/internal/prompt"
+	"github.com/skyscanner/turbolift/internal/worktrees"
+)
+
+var (
+	gh github.GitHub = github.NewCachingGitHub(github.NewGitHub())
+	g  git.Git       = git.NewRealGit()
+	p  prompt.Prompt = prompt.NewRealPrompt()
+)
+
+var (
+	repoFile string
+	largest  int
+	merged   bool
+	clean    bool
+)
+
+// workingCopy is a cloned repository and the disk space its working copy takes up
+type workingCopy struct {
+	repo  campaign.Repo
+	size  int64
+	state string
+}
+
+func NewDuCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "du",
+		Short: "Show the disk space taken up by each working copy, and remove the largest or merged ones",
+		Long: `Show the disk space taken up by each working copy, largest first.
+
+Use --largest and --merged to select working copies, and --clean to remove the selected ones.
+Working copies with uncommitted changes are never removed.`,
+		Args: cobra.NoArgs,
+		Run:  run,
+	}
+
+	cmd.Flags().StringVar(&repoFile, "repos", "repos.txt", "A file containing a list of repositories to report on.")
+	cmd.Flags().IntVar(&largest, "largest", 0, "Only select this many of the largest working copies.")
+	cmd.Flags().BoolVar(&merged, "merged", false, "Only select working copies whose PR has been merged.")
+	cmd.Flags().BoolVar(&clean, "clean", false, "Remove the selected working copies.")
+
+	return cmd
+}
+
+func run(c *cobra.Command, _ []string) {
+	logger := logging.NewLogger(c)
+
+	if largest < 0 {
+		logger.FlagErrorf("--largest must not be negative")
+		return
+	}
+
+	readCampaignActivity := logger.StartSetupActivity("Reading campaign data (%s)", repoFile)
+	options := campaign.NewCampaignOptions()
+	options.RepoFilename = repoFile
+	dir, err := campaign.OpenCampaign(options)
+	if err != nil {
+		readCampaignActivity.EndWithFailure(err)
+		return
+	}
+	readCampaignActivity.EndWithSuccess()
+
+	var workingCopies []workingCopy
+	if !interrupt.ForEachRepo(logger, dir.Repos, func(repo campaign.Repo) {
+		repoDirPath := repo.FullRepoPath()
+		// repos which were never cloned, or have been cleaned up, take up no space
+		if _, err = os.Stat(repoDirPath); os.IsNotExist(err) {
+			return
+		}
+
+		measureActivity := logger.StartActivity("Measuring %s", repoDirPath)
+		size, err := diskUsage(repoDirPath)
+		if err != nil {
+			measureActivity.EndWithFailure(err)
+			return
+		}
+		wc := workingCopy{repo: repo, size: size}
+
+		if merged {
+			pr, err := gh.GetPR(measureActivity.Writer(), repoDirPath, dir.Name)
+			var noPRFoundError *github.NoPRFoundError
+			if errors.As(err, &noPRFoundError) {
+				wc.state = "NO PR"
+			} else if err != nil {
+				measureActivity.EndWithFailure(err)
+				return
+			} else {
+				wc.state = pr.State
+			}
+		}
+
+		measureActivity.EndWithSuccess()
+		workingCopies = append(workingCopies, wc)
+	}) {
+		return
+	}
+
+	sort.SliceStable(workingCopies, func(i, j int) bool {
+		return workingCopies[i].size > workingCopies[j].size
+	})
+	selected := selectWorkingCopies(workingCopies)
+
+	logger.Println()
+	usageTable := table.New("Size", "Repository", "PR State", "Selected")
+	usageTable.WithHeaderFormatter(color.New(color.Underline).SprintfFunc())
+	usageTable.WithFirstColumnFormatter(colors.Cyanf)
+	usageTable.WithWriter(logger.Writer())
+	selectedRepos := map[string]bool{}
+	for _, wc := range selected {
+		selectedRepos[wc.repo.FullRepoName] = true
+	}
+	for _, wc := range workingCopies {
+		state := wc.state
+		if state == "" {
+			state = "-"
+		}
+		marker := ""
+		if selectedRepos[wc.repo.FullRepoName] {
+			marker = "*"
+		}
+		usageTable.AddRow(formatSize(wc.size), wc.repo.FullRepoName, state, marker)
+	}
+	usageTable.Print()
+	logger.Println()
+
+	if !clean {
+		logger.Successf("turbolift du completed %s(%d working copies, %s in total, %s selected)\n", colors.Normal(), len(workingCopies), formatSize(totalSize(workingCopies)), formatSize(totalSize(selected)))
+		if len(selected) > 0 {
+			logger.Printf("To remove the selected working copies, run again with %s", colors.Cyan("--clean"))
+		}
+		return
+	}
+
+	if len(selected) == 0 {
+		logger.Successf("turbolift du completed - no working copies selected to remove\n")
+		return
+	}
+	if !p.AskConfirm(prompt.RemoveWorkingCopies, fmt.Sprintf("Remove %d working copies, freeing %s?", len(selected), formatSize(totalSize(selected)))) {
+		logger.Warnf("turbolift du cancelled - no working copies were removed\n")
+		return
+	}
+
+	var freed int64
+	var removedCount, skippedCount, errorCount int
+	var repos []campaign.Repo
+	selectedByName := map[string]workingCopy{}
+	for _, wc := range selected {
+		repos = append(repos, wc.repo)
+		selectedByName[wc.repo.FullRepoName] = wc
+	}
+	interrupt.ForEachRepo(logger, repos, func(repo campaign.Repo) {
+		wc := selectedByName[repo.FullRepoName]
+		repoDirPath := repo.FullRepoPath()
+		removeActivity := logger.StartActivity("Removing %s", repoDirPath)
+
+		isChanged, err := g.IsRepoChanged(removeActivity.Writer(), repoDirPath)
+		if err != nil {
+			removeActivity.EndWithFailure(err)
+			errorCount++
+			return
+		}
+		if isChanged {
+			removeActivity.EndWithWarning("It has uncommitted changes - not removing it")
+			skippedCount++
+			return
+		}
+
+		if err := worktrees.RemoveWorkingCopy(removeActivity.Writer(), g, repoDirPath); err != nil {
+			removeActivity.EndWithFailure(err)
+			errorCount++
+			return
+		}
+		removeActivity.EndWithSuccess()
+		freed += wc.size
+		removedCount++
+	})
+
+	if errorCount == 0 {
+		logger.Successf("turbolift du completed %s(%s, %s, %s freed)\n", colors.Normal(), colors.Green(removedCount, " removed"), colors.Yellow(skippedCount, " skipped"), formatSize(freed))
+	} else {
+		logger.Warnf("turbolift du completed with %s %s(%s, %s, %s, %s freed)\n", colors.Red("errors"), colors.Normal(), colors.Green(removedCount, " removed"), colors.Yellow(skippedCount, " skipped"), colors.Red(errorCount, " errored"), formatSize(freed))
+	}
+}
+
+// selectWorkingCopies picks the working copies chosen with --merged and --largest from those given, largest first
+func selectWorkingCopies(workingCopies []workingCopy) []workingCopy {
+	if !merged && largest == 0 {
+		return nil
+	}
+
+	var selected []workingCopy
+	for _, wc := range workingCopies {
+		if merged && wc.state != "MERGED" {
+			continue
+		}
+		selected = append(selected, wc)
+	}
+	if largest > 0 && len(selected) > largest {
+		selected = selected[:largest]
+	}
+	return selected
+}
+
+// diskUsage adds up the sizes of the files within a directory. Working copies which are worktrees of a shared clone
+// do not include the shared clone.
+func diskUsage(path string) (int64, error) {
+	var size int64
+	err := filepath.Walk(path, func(_ string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.Mode().IsRegular() {
+			size += info.Size()
+		}
+		return nil
+	})
+	return size, err
+}
+
+func totalSize(workingCopies []workingCopy) int64 {
+	var total int64
+	for _, wc := range workingCopies {
+		total += wc.size
+	}
+	return total
+}
+
+func formatSize(size int64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%d B", size)
+	}
+	value := float64(size) / unit
+	for _, suffix := range []string{"KiB", "MiB", "GiB"} {
+		if value < unit {
+			return fmt.Sprintf("%.1f %s", value, suffix)
+		}
+		value /= unit
+	}
+	return fmt.Sprintf("%.1f TiB", value)
+}
@@ -0,0 +1,159 @@
+/*
+ * Copyright 2021 Skyscanner Limited.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * https://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package du
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/skyscanner/turbolift/internal/git"
+	"github.com/skyscanner/turbolift/internal/github"
+	"github.com/skyscanner/turbolift/internal/prompt"
+	"github.com/skyscanner/turbolift/internal/testsupport"
+)
+
+func init() {
+	// disable output colouring so that strings we want to do 'Contains' checks on do not have ANSI escape sequences in IDEs
+	_ = os.Setenv("NO_COLOR", "1")
+}
+
+func TestItReportsWorkingCopySizesLargestFirst(t *testing.T) {
+	g = git.NewAlwaysSucceedsFakeGit()
+	testsupport.PrepareTempCampaign(true, "org/repo1", "org/repo2", "org/repo3")
+	writeFile("work/org/repo1/small.txt", 10)
+	writeFile("work/org/repo2/large.bin", 3*1024*1024)
+	assert.NoError(t, os.RemoveAll("work/org/repo3"))
+
+	out, err := runCommand()
+	assert.NoError(t, err)
+	assert.Regexp(t, `(?s)3\.0 MiB +org/repo2.*10 B +org/repo1`, out)
+	assert.NotContains(t, out, "org/repo3")
+	assert.Contains(t, out, "turbolift du completed (2 working copies, 3.0 MiB in total, 0 B selected)")
+
+	_, err = os.Stat("work/org/repo2")
+	assert.NoError(t, err)
+}
+
+func TestItRemovesTheLargestWorkingCopies(t *testing.T) {
+	fakeGit := git.NewFakeGit(func(_ io.Writer, _ []string) (bool, error) {
+		return false, nil
+	})
+	g = fakeGit
+	p = prompt.NewFakePromptYes()
+	testsupport.PrepareTempCampaign(true, "org/repo1", "org/repo2", "org/repo3")
+	writeFile("work/org/repo1/small.txt", 10)
+	writeFile("work/org/repo2/large.bin", 2048)
+	writeFile("work/org/repo3/medium.bin", 1024)
+
+	out, err := runCommand("--largest", "2", "--clean")
+	assert.NoError(t, err)
+	assert.Contains(t, out, "turbolift du completed (2 removed, 0 skipped, 3.0 KiB freed)")
+
+	fakeGit.AssertCalledWith(t, [][]string{
+		{"isRepoChanged", "work/org/repo2"},
+		{"isRepoChanged", "work/org/repo3"},
+	})
+	assertExists(t, "work/org/repo1", true)
+	assertExists(t, "work/org/repo2", false)
+	assertExists(t, "work/org/repo3", false)
+}
+
+func TestItRemovesMergedWorkingCopiesWithoutUncommittedChanges(t *testing.T) {
+	g = git.NewFakeGit(func(_ io.Writer, call []string) (bool, error) {
+		return call[0] == "isRepoChanged" && call[1] == "work/org/repo2", nil
+	})
+	gh = github.NewFakeGitHub(nil, func(workingDir string) (interface{}, error) {
+		if workingDir == "work/org/repo3" {
+			return &github.PrStatus{State: "OPEN"}, nil
+		}
+		return &github.PrStatus{State: "MERGED"}, nil
+	})
+	p = prompt.NewFakePromptYes()
+	testsupport.PrepareTempCampaign(true, "org/repo1", "org/repo2", "org/repo3")
+
+	out, err := runCommand("--merged", "--clean")
+	assert.NoError(t, err)
+	assert.Contains(t, out, "Removing work/org/repo2: It has uncommitted changes - not removing it")
+	assert.Contains(t, out, "turbolift du completed (1 removed, 1 skipped, 0 B freed)")
+
+	assertExists(t, "work/org/repo1", false)
+	assertExists(t, "work/org/repo2", true)
+	assertExists(t, "work/org/repo3", true)
+}
+
+func TestItRemovesNothingUnlessConfirmed(t *testing.T) {
+	fakeGit := git.NewAlwaysSucceedsFakeGit()
+	g = fakeGit
+	p = prompt.NewFakePromptNo()
+	testsupport.PrepareTempCampaign(true, "org/repo1")
+
+	out, err := runCommand("--largest", "1", "--clean")
+	assert.NoError(t, err)
+	assert.Contains(t, out, "turbolift du cancelled")
+
+	fakeGit.AssertCalledWith(t, [][]string{})
+	assertExists(t, "work/org/repo1", true)
+}
+
+func TestItReportsReposWhosePRCannotBeChecked(t *testing.T) {
+	g = git.NewAlwaysSucceedsFakeGit()
+	gh = github.NewFakeGitHub(nil, func(workingDir string) (interface{}, error) {
+		return nil, errors.New("synthetic error")
+	})
+	testsupport.PrepareTempCampaign(true, "org/repo1")
+
+	out, err := runCommand("--merged")
+	assert.NoError(t, err)
+	assert.Contains(t, out, "Measuring work/org/repo1: synthetic error")
+	assert.Contains(t, out, "turbolift du completed (0 working copies, 0 B in total, 0 B selected)")
+}
+
+func TestItFormatsSizes(t *testing.T) {
+	assert.Equal(t, "1023 B", formatSize(1023))
+	assert.Equal(t, "1.5 KiB", formatSize(1536))
+	assert.Equal(t, "2.0 GiB", formatSize(2*1024*1024*1024))
+	assert.Equal(t, "1024.0 TiB", formatSize(1024*1024*1024*1024*1024))
+}
+
+func writeFile(name string, size int) {
+	if err := os.MkdirAll(filepath.Dir(name), 0o755); err != nil {
+		panic(err)
+	}
+	if err := ioutil.WriteFile(name, make([]byte, size), 0o644); err != nil {
+		panic(err)
+	}
+}
+
+func assertExists(t *testing.T, path string, exists bool) {
+	_, err := os.Stat(path)
+	assert.Equal(t, exists, err == nil, path)
+}
+
+func runCommand(args ...string) (string, error) {
+	cmd := NewDuCmd()
+	cmd.SetArgs(args)
+	outBuffer := bytes.NewBufferString("")
+	cmd.SetOut(outBuffer)
+	err := cmd.Execute()
+	return outBuffer.String(), err
+}
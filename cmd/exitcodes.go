@@ -0,0 +1,87 @@
+/*
+ * Copyright 2021 Skyscanner Limited.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * https://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package cmd
+
+import (
+	"errors"
+
+	"github.com/skyscanner/turbolift/internal/logging"
+)
+
+// The codes turbolift exits with, so that scripts and CI jobs can tell what went wrong. Warnings alone do not make a
+// command exit with a non-zero code.
+const (
+	exitSuccess = 0
+	// exitInvalidUsage is for commands which could not start because of their flags, arguments or configuration
+	exitInvalidUsage = 2
+	// exitPartialFailure is for commands which failed for some repositories but succeeded for others
+	exitPartialFailure = 3
+	// exitFailure is for commands which failed without succeeding at anything
+	exitFailure = 4
+)
+
+// exitCodeError is an error which decides the code turbolift exits with, such as when running a command for every
+// variant, where the code comes from the runs for each variant
+type exitCodeError struct {
+	code int
+	err  error
+}
+
+func (e *exitCodeError) Error() string {
+	return e.err.Error()
+}
+
+func (e *exitCodeError) Unwrap() error {
+	return e.err
+}
+
+// exitCode decides the code to exit with from the error returned by the command, if any, and what happened in its
+// activities
+func exitCode(err error, results logging.Results) int {
+	var codeErr *exitCodeError
+	if errors.As(err, &codeErr) {
+		return codeErr.code
+	}
+	if err != nil || results.UsageErrors > 0 {
+		return exitInvalidUsage
+	}
+
+	if len(results.Failures)+results.Errors == 0 {
+		return exitSuccess
+	}
+	if results.Succeeded > 0 {
+		return exitPartialFailure
+	}
+	return exitFailure
+}
+
+// worstExitCode combines the codes of several runs of turbolift, such as one for each variant. Runs which failed
+// completely alongside ones which succeeded make a partial failure overall.
+func worstExitCode(codes []int) int {
+	worst, succeeded := exitSuccess, false
+	for _, code := range codes {
+		if code == exitSuccess {
+			succeeded = true
+		}
+		if code > worst {
+			worst = code
+		}
+	}
+	if worst == exitFailure && succeeded {
+		return exitPartialFailure
+	}
+	return worst
+}
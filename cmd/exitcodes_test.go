@@ -0,0 +1,64 @@
+/*
+ * Copyright 2021 Skyscanner Limited.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * https://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package cmd
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/skyscanner/turbolift/internal/logging"
+)
+
+func TestItExitsWithSuccessDespiteWarnings(t *testing.T) {
+	assert.Equal(t, exitSuccess, exitCode(nil, logging.Results{
+		Succeeded: 2,
+		Warnings:  []logging.Outcome{{Activity: "Cloning org/repo1", Message: "skipped"}},
+	}))
+}
+
+func TestItExitsWithInvalidUsageForErrorsAndFlagProblems(t *testing.T) {
+	assert.Equal(t, exitInvalidUsage, exitCode(errors.New("unknown flag: --foo"), logging.Results{}))
+	assert.Equal(t, exitInvalidUsage, exitCode(nil, logging.Results{Errors: 1, UsageErrors: 1}))
+}
+
+func TestItExitsWithPartialFailureWhenSomeReposFailed(t *testing.T) {
+	assert.Equal(t, exitPartialFailure, exitCode(nil, logging.Results{
+		Succeeded: 1,
+		Failures:  []logging.Outcome{{Activity: "Cloning org/repo2", Message: "permission denied"}},
+	}))
+}
+
+func TestItExitsWithFailureWhenNothingSucceeded(t *testing.T) {
+	assert.Equal(t, exitFailure, exitCode(nil, logging.Results{
+		Failures: []logging.Outcome{{Activity: "Cloning org/repo1", Message: "permission denied"}},
+	}))
+	assert.Equal(t, exitFailure, exitCode(nil, logging.Results{Errors: 1}))
+}
+
+func TestItExitsWithTheCodeOfAnExitCodeError(t *testing.T) {
+	err := &exitCodeError{code: exitPartialFailure, err: errors.New("the command failed for variants: eu")}
+	assert.Equal(t, exitPartialFailure, exitCode(err, logging.Results{}))
+}
+
+func TestItCombinesTheExitCodesOfVariants(t *testing.T) {
+	assert.Equal(t, exitSuccess, worstExitCode([]int{exitSuccess, exitSuccess}))
+	assert.Equal(t, exitPartialFailure, worstExitCode([]int{exitSuccess, exitFailure}))
+	assert.Equal(t, exitFailure, worstExitCode([]int{exitFailure, exitFailure}))
+	assert.Equal(t, exitInvalidUsage, worstExitCode([]int{exitSuccess, exitInvalidUsage}))
+	assert.Equal(t, exitFailure, worstExitCode([]int{exitFailure, exitInvalidUsage}))
+}
@@ -15,6 +15,35 @@
 
 package flags
 
+import "time"
+
 var (
 	Verbose bool
+	Quiet   bool
+	LogFile string
+	NoColor bool
+	Yes     bool
+	No      bool
+	Shard   string
+	NoCache bool
+	Timeout time.Duration
+	Timing  bool
+	Offline string
+	Actions bool
+	Record  string
+	Variant string
+	Branch  string
+	Profile string
+
+	// ForceUnlock breaks the campaign's lock, even if the command holding it still seems to be running
+	ForceUnlock bool
+
+	// the filters on the metadata recorded by refresh-metadata
+	OnlyTopics    []string
+	OnlyLanguages []string
+	SkipArchived  bool
+	PushedSince   string
+
+	// FilterFromResults are the COMMAND=OUTCOME filters on the results of earlier commands
+	FilterFromResults []string
 )
@@ -16,33 +16,96 @@
 package foreach
 
 import (
+	"errors"
+	"fmt"
 	"os"
-	"path"
 	"strings"
 
 	"github.com/spf13/cobra"
 
+	"github.com/skyscanner/turbolift/cmd/flags"
 	"github.com/skyscanner/turbolift/internal/campaign"
+	"github.com/skyscanner/turbolift/internal/changes"
 	"github.com/skyscanner/turbolift/internal/colors"
 	"github.com/skyscanner/turbolift/internal/executor"
+	"github.com/skyscanner/turbolift/internal/git"
+	"github.com/skyscanner/turbolift/internal/github"
+	"github.com/skyscanner/turbolift/internal/hooks"
+	"github.com/skyscanner/turbolift/internal/interrupt"
 	"github.com/skyscanner/turbolift/internal/logging"
+	"github.com/skyscanner/turbolift/internal/prompt"
 )
 
-var exec executor.Executor = executor.NewRealExecutor()
+var (
+	exec executor.Executor = executor.NewRealExecutor()
+	g    git.Git           = git.NewRealGit()
+	p    prompt.Prompt     = prompt.NewRealPrompt()
+)
 
 var (
-	repoFile string = "repos.txt"
-	helpFlag bool   = false
+	repoFile  string = "repos.txt"
+	shell     string = ""
+	timeout   string = ""
+	container string = ""
+	envSet    []string
+	envFile   string = ""
+	envPassed []string
+	isolate   bool = false
+	confirm   bool = false
+	preview   bool = false
+	save      bool = false
+	helpFlag  bool = false
 )
 
-func parseForeachArgs(args []string) []string {
+func parseForeachArgs(args []string) ([]string, error) {
 	strippedArgs := make([]string, 0)
+	var err error
 MAIN:
-	for i := 0; i < len(args); i++ {
+	for i := 0; i < len(args) && err == nil; i++ {
 		switch args[i] {
 		case "--repos":
-			repoFile = args[i+1]
-			i = i + 1
+			repoFile, err = flagValue(args, &i)
+		case "--shell":
+			shell, err = flagValue(args, &i)
+		case "--env":
+			var value string
+			if value, err = flagValue(args, &i); err == nil {
+				envSet = append(envSet, value)
+			}
+		case "--env-file":
+			envFile, err = flagValue(args, &i)
+		case "--pass-env":
+			var value string
+			if value, err = flagValue(args, &i); err == nil {
+				envPassed = append(envPassed, value)
+			}
+		case "--isolate-env":
+			isolate = true
+		case "--confirm":
+			confirm = true
+		case "--preview":
+			preview = true
+		case "--save-for-refresh":
+			save = true
+		case "--record":
+			// the global --record, which for foreach is taken up as the command is run
+			flags.Record, err = flagValue(args, &i)
+		case "--container":
+			container, err = flagValue(args, &i)
+		case "--timeout":
+			// the global --timeout, which for foreach limits the command in each repository along with anything it starts
+			timeout, err = flagValue(args, &i)
+		case "--shard":
+			flags.Shard, err = flagValue(args, &i)
+		case "--variant":
+			// the global --variant, which has already been applied to the campaign
+			_, err = flagValue(args, &i)
+		case "--branch":
+			flags.Branch, err = flagValue(args, &i)
+		case "--profile":
+			flags.Profile, err = flagValue(args, &i)
+		case "--force-unlock":
+			flags.ForceUnlock = true
 		case "--help":
 			helpFlag = true
 		default:
@@ -51,8 +114,20 @@ MAIN:
 			break MAIN
 		}
 	}
+	if err != nil {
+		return nil, err
+	}
 
-	return strippedArgs
+	return strippedArgs, nil
+}
+
+// flagValue returns the value given after the flag at args[*i], moving i on to it
+func flagValue(args []string, i *int) (string, error) {
+	if *i+1 >= len(args) {
+		return "", fmt.Errorf("flag needs an argument: %s", args[*i])
+	}
+	*i++
+	return args[*i], nil
 }
 
 func NewForeachCmd() *cobra.Command {
@@ -67,6 +142,15 @@ func NewForeachCmd() *cobra.Command {
 
 	// this flag will not be parsed (DisabledFlagParsing is on) but is here for the help context and auto complete
 	cmd.Flags().StringVar(&repoFile, "repos", "repos.txt", "A file containing a list of repositories to clone.")
+	cmd.Flags().StringVar(&shell, "shell", "", "The shell used to interpret the command, e.g. bash, sh or pwsh. Defaults to $SHELL, or sh (cmd.exe on Windows) if unset.")
+	cmd.Flags().StringArrayVar(&envSet, "env", nil, "Set an environment variable for the command, as KEY=VALUE. Can be given more than once.")
+	cmd.Flags().StringVar(&envFile, "env-file", "", "A file of KEY=VALUE lines setting environment variables for the command.")
+	cmd.Flags().BoolVar(&isolate, "isolate-env", false, "Run the command without turbolift's environment, apart from essential variables such as PATH and HOME, those given with --pass-env, and those set with --env or --env-file.")
+	cmd.Flags().StringArrayVar(&envPassed, "pass-env", nil, "The name of an environment variable to pass to the command despite --isolate-env, or into a container. Can be given more than once.")
+	cmd.Flags().BoolVar(&confirm, "confirm", false, "Ask whether to keep the changes the command made in each repository, discarding them if not. Repositories which already have uncommitted changes are skipped.")
+	cmd.Flags().BoolVar(&preview, "preview", false, "With --confirm, show the diff of the changes, and any new files, before asking whether to keep them.")
+	cmd.Flags().BoolVar(&save, "save-for-refresh", false, "Save the command, and the options it is run with, as the campaign's script, for refresh to run again.")
+	cmd.Flags().StringVar(&container, "container", "", "Run the command in a new container of this image, e.g. node:18, with the working copy mounted as its working directory. The shell defaults to sh.")
 
 	return cmd
 }
@@ -80,7 +164,11 @@ func run(c *cobra.Command, args []string) {
 		Because of this, we need a manual parsing of the arguments.
 		Assumption is the foreach arguments will be parsed before the command and its arguments.
 	*/
-	args = parseForeachArgs(args)
+	args, err := parseForeachArgs(args)
+	if err != nil {
+		logger.FlagErrorf("%v", err)
+		return
+	}
 
 	// check if the help flag was toggled
 	if helpFlag {
@@ -88,7 +176,37 @@ func run(c *cobra.Command, args []string) {
 		return
 	}
 
-	readCampaignActivity := logger.StartActivity("Reading campaign data (%s)", repoFile)
+	if preview && !confirm {
+		logger.FlagErrorf("--preview can only be used with --confirm")
+		return
+	}
+
+	script := campaign.ForeachCommand{
+		Command:   strings.Join(args, " "),
+		Shell:     shell,
+		Container: container,
+		Env:       envSet,
+		EnvFile:   envFile,
+		PassEnv:   envPassed,
+		Isolate:   isolate,
+		Timeout:   timeout,
+	}
+	// a timeout from the configuration applies unless one is given
+	limit, err := script.Limit()
+	if err != nil {
+		logger.FlagErrorf("%v", err)
+		return
+	}
+	environment, err := script.Environment()
+	if err != nil {
+		logger.FlagErrorf("%v", err)
+		return
+	}
+	if flags.Record != "" {
+		github.SetRecording(flags.Record)
+	}
+
+	readCampaignActivity := logger.StartSetupActivity("Reading campaign data (%s)", repoFile)
 	options := campaign.NewCampaignOptions()
 	options.RepoFilename = repoFile
 	dir, err := campaign.OpenCampaign(options)
@@ -96,12 +214,24 @@ func run(c *cobra.Command, args []string) {
 		readCampaignActivity.EndWithFailure(err)
 		return
 	}
+	lifecycleHooks, err := hooks.Load()
+	if err != nil {
+		readCampaignActivity.EndWithFailure(err)
+		return
+	}
 	readCampaignActivity.EndWithSuccess()
 
-	var doneCount, skippedCount, errorCount int
-	for _, repo := range dir.Repos {
-		repoDirPath := path.Join("work", repo.OrgName, repo.RepoName) // i.e. work/org/repo
-		command := strings.Join(args, " ")
+	command := script.Command
+	if save {
+		// so that refresh can run it again in the same way
+		if err := campaign.RecordForeachCommand(script); err != nil {
+			logger.Warnf("Unable to record the command in %s: %v", campaign.ForeachCommandFilename, err)
+		}
+	}
+
+	var doneCount, discardedCount, skippedCount, errorCount int
+	interrupt.ForEachRepo(logger, dir.Repos, func(repo campaign.Repo) {
+		repoDirPath := repo.FullRepoPath()
 
 		execActivity := logger.StartActivity("Executing %s in %s", command, repoDirPath)
 
@@ -109,29 +239,131 @@ func run(c *cobra.Command, args []string) {
 		if _, err = os.Stat(repoDirPath); os.IsNotExist(err) {
 			execActivity.EndWithWarningf("Directory %s does not exist - has it been cloned?", repoDirPath)
 			skippedCount++
-			continue
+			return
+		}
+
+		var wrongBranchError *changes.WrongBranchError
+		if err := changes.CheckProfileBranch(execActivity.Writer(), g, repoDirPath, dir.Name); errors.As(err, &wrongBranchError) {
+			execActivity.EndWithWarning(err)
+			skippedCount++
+			return
+		} else if err != nil {
+			execActivity.EndWithFailure(err)
+			errorCount++
+			return
+		}
+
+		if confirm {
+			// changes which are not kept are discarded, so there must be no others to lose
+			changed, err := g.IsRepoChanged(execActivity.Writer(), repoDirPath)
+			if err != nil {
+				execActivity.EndWithFailure(err)
+				errorCount++
+				return
+			}
+			if changed {
+				execActivity.EndWithWarningf("%s already has uncommitted changes - commit or discard them first", repoDirPath)
+				skippedCount++
+				return
+			}
 		}
 
 		// Execute within a shell so that piping, redirection, etc are possible
-		shellCommand := os.Getenv("SHELL")
-		if shellCommand == "" {
-			shellCommand = "sh"
+		shellCommand, shellArgs, env, err := executor.ScriptInvocation(container, repoDirPath, environment, shell, command)
+		if err != nil {
+			execActivity.EndWithFailure(err)
+			errorCount++
+			return
+		}
+		err = exec.ExecuteWithTimeout(execActivity.Writer(), repoDirPath, env, limit, shellCommand, shellArgs...)
+		if err == nil {
+			err = lifecycleHooks.RunForRepo(execActivity.Writer(), hooks.PostForeach, repo)
 		}
-		shellArgs := []string{"-c", command}
-		err := exec.Execute(execActivity.Writer(), repoDirPath, shellCommand, shellArgs...)
 
 		if err != nil {
 			execActivity.EndWithFailure(err)
 			errorCount++
-		} else {
-			execActivity.EndWithSuccessAndEmitLogs()
-			doneCount++
+			return
+		}
+		execActivity.EndWithSuccessAndEmitLogs()
+
+		if confirm {
+			kept, err := confirmChanges(logger, repo, repoDirPath)
+			if err != nil {
+				errorCount++
+				return
+			}
+			if !kept {
+				discardedCount++
+				return
+			}
 		}
+		doneCount++
+	})
+
+	if err := lifecycleHooks.RunForCommand(logger, hooks.PostForeach); err != nil {
+		errorCount++
 	}
 
+	counts := []string{colors.Green(doneCount, " OK")}
+	if confirm {
+		counts = append(counts, colors.Yellow(discardedCount, " discarded"))
+	}
+	counts = append(counts, colors.Yellow(skippedCount, " skipped"))
 	if errorCount == 0 {
-		logger.Successf("turbolift foreach completed %s(%s, %s)\n", colors.Normal(), colors.Green(doneCount, " OK"), colors.Yellow(skippedCount, " skipped"))
+		logger.Successf("turbolift foreach completed %s(%s)\n", colors.Normal(), strings.Join(counts, ", "))
 	} else {
-		logger.Warnf("turbolift foreach completed with %s %s(%s, %s, %s)\n", colors.Red("errors"), colors.Normal(), colors.Green(doneCount, " OK"), colors.Yellow(skippedCount, " skipped"), colors.Red(errorCount, " errored"))
+		counts = append(counts, colors.Red(errorCount, " errored"))
+		logger.Warnf("turbolift foreach completed with %s %s(%s)\n", colors.Red("errors"), colors.Normal(), strings.Join(counts, ", "))
+	}
+}
+
+// confirmChanges asks whether to keep the changes the command made in a repository, showing them first with --preview,
+// and discards them if not. A repository where nothing changed has nothing to confirm.
+func confirmChanges(logger *logging.Logger, repo campaign.Repo, repoDirPath string) (bool, error) {
+	checkActivity := logger.StartActivity("Checking the changes in %s", repo.FullRepoName)
+	changed, err := g.IsRepoChanged(checkActivity.Writer(), repoDirPath)
+	if err != nil {
+		checkActivity.EndWithFailure(err)
+		return false, err
+	}
+	if !changed {
+		checkActivity.EndWithSuccess()
+		return true, nil
+	}
+	var diff string
+	var untracked []string
+	if preview {
+		if diff, err = g.Diff(checkActivity.Writer(), repoDirPath, "HEAD", true); err != nil {
+			checkActivity.EndWithFailure(err)
+			return false, err
+		}
+		// new files are not in the diff until they are added
+		if untracked, err = g.UntrackedFiles(checkActivity.Writer(), repoDirPath); err != nil {
+			checkActivity.EndWithFailure(err)
+			return false, err
+		}
+	}
+	checkActivity.EndWithSuccess()
+
+	if diff != "" {
+		logger.Println(diff)
+	}
+	if len(untracked) > 0 {
+		logger.Println("New files, which commit leaves out until they are added with git add:")
+		for _, path := range untracked {
+			logger.Println("  ", path)
+		}
+	}
+	if p.AskConfirm(prompt.KeepChanges, fmt.Sprintf("Keep the changes in %s?", repo.FullRepoName)) {
+		return true, nil
+	}
+
+	discardActivity := logger.StartActivity("Discarding the changes in %s", repo.FullRepoName)
+	if err := g.DiscardChanges(discardActivity.Writer(), repoDirPath); err != nil {
+		discardActivity.EndWithFailure(err)
+		return false, err
 	}
+	discardActivity.EndWithSuccess()
+	return false, nil
 }
@@ -17,12 +17,22 @@ package foreach
 
 import (
 	"bytes"
+	"io"
+	"io/ioutil"
 	"os"
+	"path/filepath"
+	"runtime"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
 
+	"github.com/skyscanner/turbolift/cmd/flags"
+	"github.com/skyscanner/turbolift/internal/campaign"
 	"github.com/skyscanner/turbolift/internal/executor"
+	"github.com/skyscanner/turbolift/internal/git"
+	"github.com/skyscanner/turbolift/internal/github"
+	"github.com/skyscanner/turbolift/internal/interrupt"
+	"github.com/skyscanner/turbolift/internal/prompt"
 	"github.com/skyscanner/turbolift/internal/testsupport"
 )
 
@@ -108,7 +118,8 @@ func TestParseForEachArgs(t *testing.T) {
 
 	for _, tc := range testCases {
 		t.Run(tc.Name, func(t *testing.T) {
-			actual := parseForeachArgs(tc.Args)
+			actual, err := parseForeachArgs(tc.Args)
+			assert.NoError(t, err)
 			t.Log(actual)
 			assert.EqualValues(t, tc.ExpectedCommand, actual)
 			assert.Equal(t, repoFile, tc.ExpectedRepoFileName)
@@ -121,6 +132,182 @@ func TestParseForEachArgs(t *testing.T) {
 	}
 }
 
+func TestItParsesTheShellFlag(t *testing.T) {
+	actual, err := parseForeachArgs([]string{"--repos", "test.txt", "--shell", "bash", "ls", "-l"})
+	assert.NoError(t, err)
+	assert.EqualValues(t, []string{"ls", "-l"}, actual)
+	assert.Equal(t, "test.txt", repoFile)
+	assert.Equal(t, "bash", shell)
+
+	repoFile = "repos.txt"
+	shell = ""
+}
+
+func TestItRejectsFlagsWithoutTheirValues(t *testing.T) {
+	for _, flag := range []string{"--repos", "--shell", "--env", "--env-file", "--pass-env", "--container", "--timeout", "--shard", "--variant", "--branch", "--profile", "--record"} {
+		_, err := parseForeachArgs([]string{"--confirm", flag})
+		assert.EqualError(t, err, "flag needs an argument: "+flag)
+	}
+	confirm = false
+	repoFile = "repos.txt"
+}
+
+func TestItReportsAFlagWithoutItsValue(t *testing.T) {
+	fakeExecutor := executor.NewAlwaysSucceedsFakeExecutor()
+	exec = fakeExecutor
+
+	testsupport.PrepareTempCampaign(true, "org/repo1")
+
+	out, err := runCommand("--shell")
+	assert.NoError(t, err)
+	assert.Contains(t, out, "flag needs an argument: --shell")
+	assert.NotContains(t, out, "turbolift foreach completed")
+
+	fakeExecutor.AssertCalledWith(t, [][]string{})
+}
+
+func TestItParsesTheShardFlag(t *testing.T) {
+	actual, err := parseForeachArgs([]string{"--shard", "2/3", "ls", "-l"})
+	assert.NoError(t, err)
+	assert.EqualValues(t, []string{"ls", "-l"}, actual)
+	assert.Equal(t, "2/3", flags.Shard)
+
+	flags.Shard = ""
+}
+
+func TestItParsesTheTimeoutFlag(t *testing.T) {
+	actual, err := parseForeachArgs([]string{"--timeout", "5m", "--shell", "bash", "ls", "-l"})
+	assert.NoError(t, err)
+	assert.EqualValues(t, []string{"ls", "-l"}, actual)
+	assert.Equal(t, "5m", timeout)
+	assert.Equal(t, "bash", shell)
+
+	timeout = ""
+	shell = ""
+}
+
+func TestItRejectsInvalidTimeouts(t *testing.T) {
+	fakeExecutor := executor.NewAlwaysSucceedsFakeExecutor()
+	exec = fakeExecutor
+
+	testsupport.PrepareTempCampaign(true, "org/repo1")
+
+	out, err := runCommand("--timeout", "soon", "some", "command")
+	timeout = ""
+	assert.NoError(t, err)
+	assert.Contains(t, out, "invalid --timeout soon")
+
+	fakeExecutor.AssertCalledWith(t, [][]string{})
+}
+
+func TestItMarksReposWhichTimeOutAsErroredAndContinues(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("relies on sleep")
+	}
+	exec = executor.NewRealExecutor()
+
+	testsupport.PrepareTempCampaign(true, "org/repo1", "org/repo2")
+	assert.NoError(t, ioutil.WriteFile("work/org/repo1/slow", nil, 0o644))
+
+	out, err := runCommand("--timeout", "200ms", "--shell", "sh", "if [ -f slow ]; then sleep 10; fi")
+	timeout = ""
+	shell = ""
+	assert.NoError(t, err)
+	assert.Contains(t, out, "timed out after 200ms")
+	assert.Contains(t, out, "1 OK, 0 skipped, 1 errored")
+}
+
+func TestItSetsEnvironmentVariables(t *testing.T) {
+	fakeExecutor := executor.NewAlwaysSucceedsFakeExecutor()
+	exec = fakeExecutor
+
+	testsupport.PrepareTempCampaign(true, "org/repo1")
+	assert.NoError(t, ioutil.WriteFile("campaign.env", []byte("NODE_ENV=production\n"), 0o644))
+	_ = os.Setenv("TURBOLIFT_TEST_SECRET", "secret")
+	defer func() { _ = os.Unsetenv("TURBOLIFT_TEST_SECRET") }()
+
+	out, err := runCommand("--isolate-env", "--env-file", "campaign.env", "--env", "CI=true", "some", "command")
+	isolate = false
+	assert.NoError(t, err)
+	assert.Contains(t, out, "1 OK, 0 skipped")
+
+	assert.Contains(t, fakeExecutor.LastEnv, "NODE_ENV=production")
+	assert.Contains(t, fakeExecutor.LastEnv, "CI=true")
+	assert.Contains(t, fakeExecutor.LastEnv, "PATH="+os.Getenv("PATH"))
+	assert.NotContains(t, fakeExecutor.LastEnv, "TURBOLIFT_TEST_SECRET=secret")
+}
+
+func TestItRejectsInvalidEnvironmentVariables(t *testing.T) {
+	fakeExecutor := executor.NewAlwaysSucceedsFakeExecutor()
+	exec = fakeExecutor
+
+	testsupport.PrepareTempCampaign(true, "org/repo1")
+
+	out, err := runCommand("--env", "CI", "some", "command")
+	assert.NoError(t, err)
+	assert.Contains(t, out, "--env CI is not of the form KEY=VALUE")
+
+	fakeExecutor.AssertCalledWith(t, [][]string{})
+}
+
+func TestItPassesNamedVariablesIntoContainers(t *testing.T) {
+	fakeExecutor := executor.NewAlwaysSucceedsFakeExecutor()
+	exec = fakeExecutor
+
+	testsupport.PrepareTempCampaign(true, "org/repo1")
+	_ = os.Setenv("TURBOLIFT_TEST_SECRET", "secret")
+	defer func() { _ = os.Unsetenv("TURBOLIFT_TEST_SECRET") }()
+
+	_, err := runCommand("--container", "node:18", "--isolate-env", "--pass-env", "NPM_TOKEN", "--env", "CI=true", "npm", "install")
+	container = ""
+	isolate = false
+	assert.NoError(t, err)
+
+	workingCopyPath, err := filepath.Abs("work/org/repo1")
+	assert.NoError(t, err)
+	name, args := executor.ContainerInvocation("node:18", workingCopyPath, []string{"NPM_TOKEN", "CI"}, "", "npm install")
+	fakeExecutor.AssertCalledWith(t, [][]string{
+		append([]string{"work/org/repo1", name}, args...),
+	})
+	// the container runtime keeps turbolift's environment, along with the variables set for the container
+	assert.Contains(t, fakeExecutor.LastEnv, "TURBOLIFT_TEST_SECRET=secret")
+	assert.Equal(t, "CI=true", fakeExecutor.LastEnv[len(fakeExecutor.LastEnv)-1])
+}
+
+func TestItRunsCommandInContainers(t *testing.T) {
+	fakeExecutor := executor.NewAlwaysSucceedsFakeExecutor()
+	exec = fakeExecutor
+
+	testsupport.PrepareTempCampaign(true, "org/repo1", "org/repo2")
+
+	out, err := runCommand("--container", "node:18", "npm", "install")
+	container = ""
+	assert.NoError(t, err)
+	assert.Contains(t, out, "2 OK, 0 skipped")
+
+	fakeExecutor.AssertCalledWith(t, [][]string{
+		expectedContainerCall("work/org/repo1", "node:18", "npm install"),
+		expectedContainerCall("work/org/repo2", "node:18", "npm install"),
+	})
+}
+
+func TestItRunsCommandInTheChosenShell(t *testing.T) {
+	fakeExecutor := executor.NewAlwaysSucceedsFakeExecutor()
+	exec = fakeExecutor
+
+	testsupport.PrepareTempCampaign(true, "org/repo1", "org/repo2")
+
+	out, err := runCommand("--shell", "pwsh", "Get-ChildItem")
+	shell = ""
+	assert.NoError(t, err)
+	assert.Contains(t, out, "2 OK, 0 skipped")
+
+	fakeExecutor.AssertCalledWith(t, [][]string{
+		{"work/org/repo1", "pwsh", "-NoProfile", "-Command", "Get-ChildItem"},
+		{"work/org/repo2", "pwsh", "-NoProfile", "-Command", "Get-ChildItem"},
+	})
+}
+
 func TestItRejectsEmptyArgs(t *testing.T) {
 	fakeExecutor := executor.NewAlwaysSucceedsFakeExecutor()
 	exec = fakeExecutor
@@ -146,8 +333,75 @@ func TestItRunsCommandInShellAgainstWorkingCopies(t *testing.T) {
 	assert.Contains(t, out, "2 OK, 0 skipped")
 
 	fakeExecutor.AssertCalledWith(t, [][]string{
-		{"work/org/repo1", userShell(), "-c", "some command"},
-		{"work/org/repo2", userShell(), "-c", "some command"},
+		expectedCall("work/org/repo1", "some command"),
+		expectedCall("work/org/repo2", "some command"),
+	})
+}
+
+func TestItRecordsTheCommandForRefreshWhenAsked(t *testing.T) {
+	exec = executor.NewAlwaysSucceedsFakeExecutor()
+
+	testsupport.PrepareTempCampaign(true, "org/repo1")
+
+	_, err := runCommand("--save-for-refresh", "--shell", "bash", "some", "command")
+	save, shell = false, ""
+	assert.NoError(t, err)
+
+	command, err := campaign.ReadForeachCommand()
+	assert.NoError(t, err)
+	assert.Equal(t, campaign.ForeachCommand{Command: "some command", Shell: "bash"}, command)
+}
+
+func TestItPassesTheGlobalRecordFlagThrough(t *testing.T) {
+	fakeExecutor := executor.NewAlwaysSucceedsFakeExecutor()
+	exec = fakeExecutor
+
+	testsupport.PrepareTempCampaign(true, "org/repo1")
+
+	_, err := runCommand("--record", "operations.jsonl", "some", "command")
+	recorded := flags.Record
+	flags.Record = ""
+	github.SetRecording("")
+	assert.NoError(t, err)
+	assert.Equal(t, "operations.jsonl", recorded)
+
+	fakeExecutor.AssertCalledWith(t, [][]string{
+		expectedCall("work/org/repo1", "some command"),
+	})
+	_, err = campaign.ReadForeachCommand()
+	assert.Error(t, err)
+}
+
+func TestItDoesNotRecordTheCommandUnlessAsked(t *testing.T) {
+	exec = executor.NewAlwaysSucceedsFakeExecutor()
+
+	testsupport.PrepareTempCampaign(true, "org/repo1")
+
+	_, err := runCommand("some", "command")
+	assert.NoError(t, err)
+
+	_, err = campaign.ReadForeachCommand()
+	assert.Error(t, err)
+}
+
+func TestItSkipsReposWhichAreNotOnTheProfileBranch(t *testing.T) {
+	fakeExecutor := executor.NewAlwaysSucceedsFakeExecutor()
+	exec = fakeExecutor
+	fakeGit := git.NewAlwaysSucceedsFakeGit()
+	g = fakeGit
+	flags.Profile = "phase-2"
+	defer func() { flags.Profile = "" }()
+
+	testsupport.PrepareTempCampaign(true, "org/repo1", "org/repo2")
+	fakeGit.Branches = map[string]string{"work/org/repo1": testsupport.Pwd() + "-phase-2", "work/org/repo2": "HEAD"}
+
+	out, err := runCommand("some", "command")
+	assert.NoError(t, err)
+	assert.Contains(t, out, "work/org/repo2 is on branch HEAD rather than "+testsupport.Pwd()+"-phase-2")
+	assert.Contains(t, out, "1 OK, 1 skipped")
+
+	fakeExecutor.AssertCalledWith(t, [][]string{
+		expectedCall("work/org/repo1", "some command"),
 	})
 }
 
@@ -164,7 +418,7 @@ func TestItSkipsMissingWorkingCopies(t *testing.T) {
 	assert.Contains(t, out, "1 OK, 1 skipped")
 
 	fakeExecutor.AssertCalledWith(t, [][]string{
-		{"work/org/repo1", userShell(), "-c", "some command"},
+		expectedCall("work/org/repo1", "some command"),
 	})
 }
 
@@ -180,9 +434,35 @@ func TestItContinuesOnAndRecordsFailures(t *testing.T) {
 	assert.Contains(t, out, "0 OK, 0 skipped, 2 errored")
 
 	fakeExecutor.AssertCalledWith(t, [][]string{
-		{"work/org/repo1", userShell(), "-c", "some command"},
-		{"work/org/repo2", userShell(), "-c", "some command"},
+		expectedCall("work/org/repo1", "some command"),
+		expectedCall("work/org/repo2", "some command"),
+	})
+}
+
+func TestItStopsAfterTheCurrentRepoWhenInterrupted(t *testing.T) {
+	defer interrupt.Reset()
+	fakeExecutor := executor.NewFakeExecutor(func(string, string, ...string) error {
+		interrupt.Request()
+		return nil
+	}, func(string, string, ...string) (string, error) {
+		return "", nil
+	})
+	exec = fakeExecutor
+
+	testsupport.PrepareTempCampaign(true, "org/repo1", "org/repo2", "org/repo3")
+
+	out, err := runCommand("some", "command")
+	assert.NoError(t, err)
+	assert.Contains(t, out, "Interrupted - 2 repositories were not reached. To resume, use --repos remaining.txt")
+	assert.Contains(t, out, "1 OK, 0 skipped")
+
+	fakeExecutor.AssertCalledWith(t, [][]string{
+		expectedCall("work/org/repo1", "some command"),
 	})
+
+	contents, err := ioutil.ReadFile(interrupt.RemainingReposFilename)
+	assert.NoError(t, err)
+	assert.Equal(t, "org/repo2\norg/repo3\n", string(contents))
 }
 
 func TestHelpFlagReturnsUsage(t *testing.T) {
@@ -192,6 +472,7 @@ func TestHelpFlagReturnsUsage(t *testing.T) {
 	testsupport.PrepareTempCampaign(true, "org/repo1", "org/repo2")
 
 	out, err := runCommand("--help", "command1")
+	helpFlag = false
 	t.Log(out)
 	assert.NoError(t, err)
 	// should return usage
@@ -204,12 +485,104 @@ func TestHelpFlagReturnsUsage(t *testing.T) {
 	fakeExecutor.AssertCalledWith(t, [][]string{})
 }
 
-func userShell() string {
-	shell := os.Getenv("SHELL")
-	if shell == "" {
-		return "sh"
+func TestItKeepsChangesWhenConfirmed(t *testing.T) {
+	exec = executor.NewAlwaysSucceedsFakeExecutor()
+	fakeGit := git.NewFakeGit(changedByTheCommand())
+	fakeGit.Untracked = []string{"config/new.yaml"}
+	g = fakeGit
+	p = prompt.NewFakePromptYes()
+
+	testsupport.PrepareTempCampaign(true, "org/repo1")
+
+	out, err := runCommand("--confirm", "--preview", "some", "command")
+	confirm, preview = false, false
+	assert.NoError(t, err)
+	assert.Contains(t, out, "New files, which commit leaves out until they are added with git add:\n   config/new.yaml")
+	assert.Contains(t, out, "turbolift foreach completed (1 OK, 0 discarded, 0 skipped)")
+
+	fakeGit.AssertCalledWith(t, [][]string{
+		{"isRepoChanged", "work/org/repo1"},
+		{"isRepoChanged", "work/org/repo1"},
+		{"diff", "work/org/repo1", "HEAD"},
+		{"untrackedFiles", "work/org/repo1"},
+	})
+}
+
+func TestItDiscardsChangesWhichAreNotKept(t *testing.T) {
+	exec = executor.NewAlwaysSucceedsFakeExecutor()
+	fakeGit := git.NewFakeGit(changedByTheCommand())
+	g = fakeGit
+	p = prompt.NewFakePromptNo()
+
+	testsupport.PrepareTempCampaign(true, "org/repo1")
+
+	out, err := runCommand("--confirm", "some", "command")
+	confirm = false
+	assert.NoError(t, err)
+	assert.Contains(t, out, "Discarding the changes in org/repo1")
+	assert.Contains(t, out, "turbolift foreach completed (0 OK, 1 discarded, 0 skipped)")
+
+	fakeGit.AssertCalledWith(t, [][]string{
+		{"isRepoChanged", "work/org/repo1"},
+		{"isRepoChanged", "work/org/repo1"},
+		{"discardChanges", "work/org/repo1"},
+	})
+}
+
+func TestItSkipsReposWithUncommittedChangesWhenConfirming(t *testing.T) {
+	fakeExecutor := executor.NewAlwaysSucceedsFakeExecutor()
+	exec = fakeExecutor
+	g = git.NewAlwaysSucceedsFakeGit()
+	p = prompt.NewFakePromptNo()
+
+	testsupport.PrepareTempCampaign(true, "org/repo1")
+
+	out, err := runCommand("--confirm", "some", "command")
+	confirm = false
+	assert.NoError(t, err)
+	assert.Contains(t, out, "already has uncommitted changes")
+	assert.Contains(t, out, "turbolift foreach completed (0 OK, 0 discarded, 1 skipped)")
+	fakeExecutor.AssertCalledWith(t, [][]string{})
+}
+
+func TestItOnlyPreviewsWhenConfirming(t *testing.T) {
+	fakeExecutor := executor.NewAlwaysSucceedsFakeExecutor()
+	exec = fakeExecutor
+
+	testsupport.PrepareTempCampaign(true, "org/repo1")
+
+	out, err := runCommand("--preview", "some", "command")
+	preview = false
+	assert.NoError(t, err)
+	assert.Contains(t, out, "--preview can only be used with --confirm")
+	fakeExecutor.AssertCalledWith(t, [][]string{})
+}
+
+func expectedCall(workingDir string, command string) []string {
+	shell, args := executor.ShellInvocation("", command)
+	return append([]string{workingDir, shell}, args...)
+}
+
+func expectedContainerCall(workingDir string, image string, command string) []string {
+	workingCopyPath, err := filepath.Abs(workingDir)
+	if err != nil {
+		panic(err)
+	}
+	name, args := executor.ContainerInvocation(image, workingCopyPath, nil, "", command)
+	return append([]string{workingDir, name}, args...)
+}
+
+// changedByTheCommand reports each working copy as unchanged until the command has run in it
+func changedByTheCommand() func(io.Writer, []string) (bool, error) {
+	checked := map[string]bool{}
+	return func(_ io.Writer, call []string) (bool, error) {
+		if call[0] != "isRepoChanged" {
+			return true, nil
+		}
+		changed := checked[call[1]]
+		checked[call[1]] = true
+		return changed, nil
 	}
-	return shell
 }
 
 func runCommand(args ...string) (string, error) {
@@ -23,6 +23,7 @@ import (
 	"path/filepath"
 
 	"github.com/skyscanner/turbolift/internal/colors"
+	"github.com/skyscanner/turbolift/internal/config"
 	"github.com/skyscanner/turbolift/internal/logging"
 	"github.com/spf13/cobra"
 )
@@ -41,6 +42,9 @@ var (
 
 	//go:embed templates/repos.txt
 	reposTemplate string
+
+	//go:embed templates/turbolift.yaml
+	configTemplate string
 )
 
 type TemplateVariables struct {
@@ -84,6 +88,8 @@ func run(c *cobra.Command, _ []string) {
 		".turbolift": turboliftTemplate,
 		"README.md":  readmeTemplate,
 		"repos.txt":  reposTemplate,
+
+		config.CampaignConfigFilename: configTemplate,
 	}
 	for filename, templateFile := range files {
 		err := applyTemplate(filepath.Join(campaignName, filename), templateFile, data)
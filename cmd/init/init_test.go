@@ -32,6 +32,7 @@ func TestAllFilesAreCreated(t *testing.T) {
 	assert.FileExists(t, "foo/.turbolift", "a .turbolift file should have been created")
 	assert.FileExists(t, "foo/README.md", "a README.md file should have been created")
 	assert.FileExists(t, "foo/repos.txt", "a repos.txt file should have been created")
+	assert.FileExists(t, "foo/turbolift.yaml", "a turbolift.yaml file should have been created")
 }
 
 func TestTemplatedFilesHaveExpectedContent(t *testing.T) {
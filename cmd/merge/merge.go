@@ -0,0 +1,211 @@
+/*
+ * Copyright 2021 Skyscanner Limited.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * https://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package merge
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/skyscanner/turbolift/internal/campaign"
+	"github.com/skyscanner/turbolift/internal/colors"
+	"github.com/skyscanner/turbolift/internal/github"
+	"github.com/skyscanner/turbolift/internal/interrupt"
+	"github.com/skyscanner/turbolift/internal/logging"
+	"github.com/skyscanner/turbolift/internal/ordering"
+	"github.com/skyscanner/turbolift/internal/prompt"
+)
+
+var (
+	// gh is not cached, so that PRs are only merged on their current state and mergeability
+	gh github.GitHub = github.NewGitHub()
+	p  prompt.Prompt = prompt.NewRealPrompt()
+)
+
+var (
+	repoFile string
+	method   string
+	auto     bool
+)
+
+func NewMergeCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "merge",
+		Short: "Merge the campaign's open PRs, or add them to the merge queue where the repository has one",
+		Long: `Merge each of the campaign's open PRs which has met all of its merge requirements.
+Where the target branch is protected by a merge queue, the PR is added to the queue instead of being merged directly.
+With --auto, PRs which are not yet ready have auto-merge enabled, so that GitHub merges them once they are.`,
+		Args: cobra.NoArgs,
+		Run:  run,
+	}
+
+	cmd.Flags().StringVar(&repoFile, "repos", "repos.txt", "A file containing a list of repositories whose PRs to merge.")
+	cmd.Flags().BoolVar(&auto, "auto", false, "Enable auto-merge on PRs which are not yet ready to merge, rather than leaving them blocked.")
+	cmd.Flags().StringVar(&method, "method", "squash", fmt.Sprintf("How to merge PRs which are not merged by a merge queue: one of %s.", strings.Join(github.MergeMethods, ", ")))
+
+	return cmd
+}
+
+func validateFlags() error {
+	for _, m := range github.MergeMethods {
+		if method == m {
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid merge method %s - expected one of %s", method, strings.Join(github.MergeMethods, ", "))
+}
+
+func run(c *cobra.Command, _ []string) {
+	logger := logging.NewLogger(c)
+	if err := validateFlags(); err != nil {
+		logger.FlagErrorf("%v", err)
+		return
+	}
+
+	readCampaignActivity := logger.StartSetupActivity("Reading campaign data (%s)", repoFile)
+	options := campaign.NewCampaignOptions()
+	options.RepoFilename = repoFile
+	dir, err := campaign.OpenCampaign(options)
+	if err != nil {
+		readCampaignActivity.EndWithFailure(err)
+		return
+	}
+	readCampaignActivity.EndWithSuccess()
+
+	if auto {
+		capabilityActivity := logger.StartActivity("Checking gh supports %s", github.AutoMergeCapability.Feature)
+		if err := gh.CheckCapability(capabilityActivity.Writer(), github.AutoMergeCapability); err != nil {
+			capabilityActivity.EndWithFailure(err)
+			return
+		}
+		capabilityActivity.EndWithSuccess()
+	}
+
+	stage, ok := ordering.Start(logger, gh, dir)
+	if !ok {
+		return
+	}
+
+	// Prompting for confirmation
+	if !prompt.AssumeYes() {
+		if !p.AskConfirm(prompt.Merge, fmt.Sprintf("Merge all ready PRs from the %s campaign?", dir.Name)) {
+			return
+		}
+	}
+
+	refs := dir.PRRefs()
+	fetchActivity := logger.StartActivity("Fetching PRs of %d repositories", len(refs))
+	prs, err := github.FetchPRs(fetchActivity.Writer(), gh, refs)
+	if err != nil {
+		fetchActivity.EndWithWarningf("Unable to fetch PRs together, so fetching them one at a time: %v", err)
+	} else {
+		fetchActivity.EndWithSuccess()
+	}
+
+	var mergedCount, queuedCount, blockedCount, skippedCount, errorCount int
+	interrupt.ForEachRepo(logger, dir.Repos, func(repo campaign.Repo) {
+		repoDirPath := repo.FullRepoPath()
+
+		mergeActivity := logger.StartActivity("Merging PR in %s", repo.FullRepoName)
+		// skip if the working copy does not exist
+		if _, err = os.Stat(repoDirPath); os.IsNotExist(err) {
+			mergeActivity.EndWithWarningf("Directory %s does not exist - has it been cloned?", repoDirPath)
+			skippedCount++
+			return
+		}
+
+		pr, err := prs.GetPR(mergeActivity.Writer(), repoDirPath, dir.Name)
+		if err != nil {
+			if _, ok := err.(*github.NoPRFoundError); ok {
+				mergeActivity.EndWithWarning(err)
+				skippedCount++
+			} else {
+				mergeActivity.EndWithFailure(err)
+				errorCount++
+			}
+			return
+		}
+		if pr.State != "OPEN" {
+			mergeActivity.EndWithWarningf("PR is %s", strings.ToLower(pr.State))
+			skippedCount++
+			return
+		}
+
+		requirements, err := prs.GetMergeRequirements(mergeActivity.Writer(), repoDirPath, pr)
+		if err != nil {
+			mergeActivity.EndWithFailure(err)
+			errorCount++
+			return
+		}
+		if entry := requirements.MergeQueueEntry; entry != nil {
+			mergeActivity.EndWithWarningf("PR is already in the merge queue at position %d (%s)", entry.Position, strings.ToLower(entry.State))
+			skippedCount++
+			return
+		}
+		if unmet := requirements.Unmet(); len(unmet) > 0 && auto {
+			if err := gh.EnableAutoMerge(mergeActivity.Writer(), repoDirPath, pr, method); err != nil {
+				mergeActivity.EndWithFailure(err)
+				errorCount++
+				return
+			}
+			mergeActivity.Logf("Auto-merge enabled, as it is not ready to merge yet: %s", strings.Join(unmet, "; "))
+			mergeActivity.EndWithSuccessAndEmitLogs()
+			queuedCount++
+			return
+		} else if len(unmet) > 0 {
+			mergeActivity.EndWithWarningf("Not ready to merge: %s", strings.Join(unmet, "; "))
+			blockedCount++
+			return
+		}
+
+		if requirements.MergeQueueEnabled {
+			// only known once a repository with a merge queue is reached; gh's version is only looked up once per run
+			if err := gh.CheckCapability(mergeActivity.Writer(), github.MergeQueueCapability); err != nil {
+				mergeActivity.EndWithFailure(err)
+				errorCount++
+				return
+			}
+			entry, err := gh.EnqueuePullRequest(mergeActivity.Writer(), repoDirPath, pr)
+			if err != nil {
+				mergeActivity.EndWithFailure(err)
+				errorCount++
+				return
+			}
+			mergeActivity.Logf("Added to the merge queue at position %d", entry.Position)
+			mergeActivity.EndWithSuccessAndEmitLogs()
+			queuedCount++
+			return
+		}
+
+		if err := gh.MergePullRequest(mergeActivity.Writer(), repoDirPath, pr, method); err != nil {
+			mergeActivity.EndWithFailure(err)
+			errorCount++
+			return
+		}
+		mergeActivity.EndWithSuccess()
+		mergedCount++
+	})
+
+	if errorCount == 0 {
+		logger.Successf("turbolift merge completed %s(%s, %s, %s, %s)\n", colors.Normal(), colors.Green(mergedCount, " merged"), colors.Green(queuedCount, " queued"), colors.Yellow(blockedCount, " blocked"), colors.Yellow(skippedCount, " skipped"))
+	} else {
+		logger.Warnf("turbolift merge completed with %s %s(%s, %s, %s, %s, %s)\n", colors.Red("errors"), colors.Normal(), colors.Green(mergedCount, " merged"), colors.Green(queuedCount, " queued"), colors.Yellow(blockedCount, " blocked"), colors.Yellow(skippedCount, " skipped"), colors.Red(errorCount, " errored"))
+	}
+
+	stage.ReportWaiting(logger, "merge")
+}
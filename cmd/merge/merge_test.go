@@ -0,0 +1,245 @@
+/*
+ * Copyright 2021 Skyscanner Limited.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * https://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package merge
+
+import (
+	"bytes"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/skyscanner/turbolift/internal/github"
+	"github.com/skyscanner/turbolift/internal/prompt"
+	"github.com/skyscanner/turbolift/internal/testsupport"
+)
+
+func init() {
+	// disable output colouring so that strings we want to do 'Contains' checks on do not have ANSI escape sequences in IDEs
+	_ = os.Setenv("NO_COLOR", "1")
+}
+
+// fakeGitHubWithPRs has an open PR in repo1, and a merged PR in repo2
+func fakeGitHubWithPRs() *github.FakeGitHub {
+	return github.NewFakeGitHub(func(github.Command, []string) (bool, error) {
+		return true, nil
+	}, func(workingDir string) (interface{}, error) {
+		if workingDir == "work/org/repo2" {
+			return &github.PrStatus{State: "MERGED"}, nil
+		}
+		return &github.PrStatus{State: "OPEN", Id: "PR_1"}, nil
+	})
+}
+
+func TestItMergesReadyPRs(t *testing.T) {
+	fakeGitHub := fakeGitHubWithPRs()
+	gh = fakeGitHub
+	p = prompt.NewFakePromptYes()
+
+	testsupport.PrepareTempCampaign(true, "org/repo1", "org/repo2")
+
+	out, err := runCommand("--method", "rebase")
+	assert.NoError(t, err)
+	assert.Contains(t, out, "PR is merged")
+	assert.Contains(t, out, "turbolift merge completed (1 merged, 0 queued, 0 blocked, 1 skipped)")
+
+	fakeGitHub.AssertCalledWith(t, [][]string{
+		{"work/org/repo1"},
+		{"work/org/repo1", "PR_1"},
+		{"work/org/repo1", "rebase"},
+		{"work/org/repo2"},
+	})
+}
+
+func TestItChecksEveryPRInOneBatch(t *testing.T) {
+	fakeGitHub := fakeGitHubWithPRs()
+	fakeGitHub.BatchesPRs = true
+	gh = fakeGitHub
+	p = prompt.NewFakePromptYes()
+
+	testsupport.PrepareTempCampaign(true, "org/repo1", "org/repo2")
+
+	out, err := runCommand("--method", "rebase")
+	assert.NoError(t, err)
+	assert.Contains(t, out, "Fetching PRs of 2 repositories")
+	assert.Contains(t, out, "turbolift merge completed (1 merged, 0 queued, 0 blocked, 1 skipped)")
+
+	fakeGitHub.AssertCalledWith(t, [][]string{
+		{".", "work/org/repo1", "work/org/repo2"},
+		{"work/org/repo1", "rebase"},
+	})
+}
+
+func TestItOnlyMergesPRsOnceThoseOfEarlierOrderingGroupsHaveMerged(t *testing.T) {
+	fakeGitHub := fakeGitHubWithPRs()
+	gh = fakeGitHub
+	p = prompt.NewFakePromptYes()
+
+	testsupport.PrepareTempCampaign(true, "[libraries]", "org/repo2", "[services]", "org/repo1", "[apps]", "org/repo3")
+
+	out, err := runCommand()
+	assert.NoError(t, err)
+	assert.Contains(t, out, "Working on ordering group services, with 1 repositories in later groups waiting for its PRs to merge")
+	assert.Contains(t, out, "turbolift merge completed (1 merged, 0 queued, 0 blocked, 0 skipped)")
+	assert.Contains(t, out, "1 repositories in later ordering groups are waiting for the PRs of ordering group services to merge")
+
+	fakeGitHub.AssertCalledWith(t, [][]string{
+		{"work/org/repo2"},
+		{"work/org/repo1"},
+		{"work/org/repo1"},
+		{"work/org/repo1", "PR_1"},
+		{"work/org/repo1", "squash"},
+	})
+}
+
+func TestItEnqueuesPRsWhenThereIsAMergeQueue(t *testing.T) {
+	fakeGitHub := fakeGitHubWithPRs()
+	fakeGitHub.MergeRequirements = &github.MergeRequirements{MergeStateStatus: "BLOCKED", MergeQueueEnabled: true}
+	gh = fakeGitHub
+	p = prompt.NewFakePromptYes()
+
+	testsupport.PrepareTempCampaign(true, "org/repo1")
+
+	out, err := runCommand()
+	assert.NoError(t, err)
+	assert.Contains(t, out, "Added to the merge queue at position 1")
+	assert.Contains(t, out, "turbolift merge completed (0 merged, 1 queued, 0 blocked, 0 skipped)")
+
+	fakeGitHub.AssertCalledWith(t, [][]string{
+		{"work/org/repo1"},
+		{"work/org/repo1", "PR_1"},
+		{"work/org/repo1", "PR_1"},
+	})
+}
+
+func TestItSkipsPRsAlreadyInTheMergeQueue(t *testing.T) {
+	fakeGitHub := fakeGitHubWithPRs()
+	fakeGitHub.MergeRequirements = &github.MergeRequirements{
+		MergeStateStatus:  "BLOCKED",
+		MergeQueueEnabled: true,
+		MergeQueueEntry:   &github.MergeQueueEntry{Position: 2, State: "AWAITING_CHECKS"},
+	}
+	gh = fakeGitHub
+	p = prompt.NewFakePromptYes()
+
+	testsupport.PrepareTempCampaign(true, "org/repo1")
+
+	out, err := runCommand()
+	assert.NoError(t, err)
+	assert.Contains(t, out, "PR is already in the merge queue at position 2 (awaiting_checks)")
+	assert.Contains(t, out, "turbolift merge completed (0 merged, 0 queued, 0 blocked, 1 skipped)")
+}
+
+func TestItDoesNotMergeBlockedPRs(t *testing.T) {
+	fakeGitHub := fakeGitHubWithPRs()
+	fakeGitHub.MergeRequirements = &github.MergeRequirements{MergeStateStatus: "BLOCKED", ReviewDecision: "REVIEW_REQUIRED"}
+	gh = fakeGitHub
+	p = prompt.NewFakePromptYes()
+
+	testsupport.PrepareTempCampaign(true, "org/repo1")
+
+	out, err := runCommand()
+	assert.NoError(t, err)
+	assert.Contains(t, out, "Not ready to merge")
+	assert.Contains(t, out, "turbolift merge completed (0 merged, 0 queued, 1 blocked, 0 skipped)")
+
+	fakeGitHub.AssertCalledWith(t, [][]string{
+		{"work/org/repo1"},
+		{"work/org/repo1", "PR_1"},
+	})
+}
+
+func TestItRefusesToEnqueuePRsWithAnOldGh(t *testing.T) {
+	fakeGitHub := fakeGitHubWithPRs()
+	fakeGitHub.GhVersion = "1.14.0"
+	fakeGitHub.MergeRequirements = &github.MergeRequirements{MergeStateStatus: "BLOCKED", MergeQueueEnabled: true}
+	gh = fakeGitHub
+	p = prompt.NewFakePromptYes()
+
+	testsupport.PrepareTempCampaign(true, "org/repo1")
+
+	out, err := runCommand()
+	assert.NoError(t, err)
+	assert.Contains(t, out, "adding PRs to merge queues needs gh 2.0.0 or later, but gh 1.14.0 is installed")
+	assert.Contains(t, out, "turbolift merge completed with errors (0 merged, 0 queued, 0 blocked, 0 skipped, 1 errored)")
+
+	fakeGitHub.AssertCalledWith(t, [][]string{
+		{"work/org/repo1"},
+		{"work/org/repo1", "PR_1"},
+	})
+}
+
+func TestItEnablesAutoMergeOnBlockedPRsWhenAsked(t *testing.T) {
+	fakeGitHub := fakeGitHubWithPRs()
+	fakeGitHub.MergeRequirements = &github.MergeRequirements{MergeStateStatus: "BLOCKED", ReviewDecision: "REVIEW_REQUIRED"}
+	gh = fakeGitHub
+	p = prompt.NewFakePromptYes()
+
+	testsupport.PrepareTempCampaign(true, "org/repo1")
+
+	out, err := runCommand("--auto")
+	assert.NoError(t, err)
+	assert.Contains(t, out, "Auto-merge enabled, as it is not ready to merge yet")
+	assert.Contains(t, out, "turbolift merge completed (0 merged, 1 queued, 0 blocked, 0 skipped)")
+
+	fakeGitHub.AssertCalledWith(t, [][]string{
+		{"work/org/repo1"},
+		{"work/org/repo1", "PR_1"},
+		{"work/org/repo1", "auto", "squash"},
+	})
+}
+
+func TestItRefusesToEnableAutoMergeWithAnOldGh(t *testing.T) {
+	fakeGitHub := fakeGitHubWithPRs()
+	fakeGitHub.GhVersion = "1.14.0"
+	gh = fakeGitHub
+	p = prompt.NewFakePromptYes()
+
+	testsupport.PrepareTempCampaign(true, "org/repo1")
+
+	out, err := runCommand("--auto")
+	assert.NoError(t, err)
+	assert.Contains(t, out, "enabling auto-merge needs gh 2.0.0 or later, but gh 1.14.0 is installed")
+	assert.NotContains(t, out, "turbolift merge completed")
+
+	fakeGitHub.AssertCalledWith(t, [][]string{})
+}
+
+func TestItRejectsUnknownMergeMethods(t *testing.T) {
+	fakeGitHub := fakeGitHubWithPRs()
+	gh = fakeGitHub
+	p = prompt.NewFakePromptYes()
+
+	testsupport.PrepareTempCampaign(true, "org/repo1")
+
+	out, err := runCommand("--method", "octopus")
+	assert.NoError(t, err)
+	assert.Contains(t, out, "invalid merge method octopus - expected one of merge, squash, rebase")
+
+	fakeGitHub.AssertCalledWith(t, [][]string{})
+}
+
+func runCommand(args ...string) (string, error) {
+	cmd := NewMergeCmd()
+	cmd.SetArgs(args)
+	outBuffer := bytes.NewBufferString("")
+	cmd.SetOut(outBuffer)
+	err := cmd.Execute()
+	if err != nil {
+		return outBuffer.String(), err
+	}
+	return outBuffer.String(), nil
+}
@@ -17,16 +17,19 @@ package prstatus
 
 import (
 	"fmt"
+	"io/ioutil"
 	"os"
-	"path"
 	"strings"
+	"time"
 
 	"github.com/fatih/color"
 	"github.com/rodaine/table"
 	"github.com/spf13/cobra"
 
 	"github.com/skyscanner/turbolift/internal/campaign"
+	"github.com/skyscanner/turbolift/internal/colors"
 	"github.com/skyscanner/turbolift/internal/github"
+	"github.com/skyscanner/turbolift/internal/interrupt"
 	"github.com/skyscanner/turbolift/internal/logging"
 )
 
@@ -52,11 +55,25 @@ var reactionsMapping = map[string]string{
 	"EYES":        "👀",
 }
 
-var gh github.GitHub = github.NewRealGitHub()
+// defaultChangesRequestedReposFile is written when --write-changes-requested is given without a filename
+const defaultChangesRequestedReposFile = "changes_requested.txt"
+
+// defaultClosedReposFile is written when --write-closed is given without a filename
+const defaultClosedReposFile = "closed.txt"
+
+// maxCommentLength is the length that review comments are shortened to in the changes requested listing
+const maxCommentLength = 60
+
+// gh is not cached, as the point of pr-status is to show the PRs as they are now
+var gh github.GitHub = github.NewGitHub()
+
+var now = time.Now
 
 var (
-	list     bool
-	repoFile string
+	list                 bool
+	repoFile             string
+	changesRequestedFile string
+	closedFile           string
 )
 
 func NewPrStatusCmd() *cobra.Command {
@@ -67,6 +84,10 @@ func NewPrStatusCmd() *cobra.Command {
 	}
 	cmd.Flags().BoolVar(&list, "list", false, "Displays a listing by PR")
 	cmd.Flags().StringVar(&repoFile, "repos", "repos.txt", "A file containing a list of repositories to clone.")
+	cmd.Flags().StringVar(&changesRequestedFile, "write-changes-requested", "", fmt.Sprintf("Write the repositories whose PRs have changes requested to a repo file, for use with --repos (%s if no filename is given).", defaultChangesRequestedReposFile))
+	cmd.Flags().Lookup("write-changes-requested").NoOptDefVal = defaultChangesRequestedReposFile
+	cmd.Flags().StringVar(&closedFile, "write-closed", "", fmt.Sprintf("Write the repositories whose PRs were closed without being merged to a repo file, for use with --repos (%s if no filename is given).", defaultClosedReposFile))
+	cmd.Flags().Lookup("write-closed").NoOptDefVal = defaultClosedReposFile
 
 	return cmd
 }
@@ -74,7 +95,7 @@ func NewPrStatusCmd() *cobra.Command {
 func run(c *cobra.Command, _ []string) {
 	logger := logging.NewLogger(c)
 
-	readCampaignActivity := logger.StartActivity("Reading campaign data (%s)", repoFile)
+	readCampaignActivity := logger.StartSetupActivity("Reading campaign data (%s)", repoFile)
 
 	options := campaign.NewCampaignOptions()
 	options.RepoFilename = repoFile
@@ -88,13 +109,28 @@ func run(c *cobra.Command, _ []string) {
 	statuses := make(map[string]int)
 	reactions := make(map[string]int)
 
-	detailsTable := table.New("Repository", "State", "Reviews", "URL")
+	detailsTable := table.New("Repository", "State", "Reviews", "Age", "Last Activity", "Reviewer Interaction", "Merge Queue", "URL")
 	detailsTable.WithHeaderFormatter(color.New(color.Underline).SprintfFunc())
-	detailsTable.WithFirstColumnFormatter(color.New(color.FgCyan).SprintfFunc())
+	detailsTable.WithFirstColumnFormatter(colors.Cyanf)
 	detailsTable.WithWriter(logger.Writer())
 
-	for _, repo := range dir.Repos {
-		repoDirPath := path.Join("work", repo.OrgName, repo.RepoName) // i.e. work/org/repo
+	changesRequestedTable := table.New("Repository", "Reviewer", "Latest Comment", "URL")
+	changesRequestedTable.WithHeaderFormatter(color.New(color.Underline).SprintfFunc())
+	changesRequestedTable.WithFirstColumnFormatter(colors.Cyanf)
+	changesRequestedTable.WithWriter(logger.Writer())
+
+	refs := dir.PRRefs()
+	fetchActivity := logger.StartActivity("Fetching PRs of %d repositories", len(refs))
+	prs, err := github.FetchPRs(fetchActivity.Writer(), gh, refs)
+	if err != nil {
+		fetchActivity.EndWithWarningf("Unable to fetch PRs together, so fetching them one at a time: %v", err)
+	} else {
+		fetchActivity.EndWithSuccess()
+	}
+
+	var changesRequestedRepos, closedRepos []string
+	interrupt.ForEachRepo(logger, dir.Repos, func(repo campaign.Repo) {
+		repoDirPath := repo.FullRepoPath()
 
 		checkStatusActivity := logger.StartActivity("Checking PR status for %s", repo.FullRepoName)
 
@@ -102,26 +138,44 @@ func run(c *cobra.Command, _ []string) {
 		if _, err = os.Stat(repoDirPath); os.IsNotExist(err) {
 			checkStatusActivity.EndWithWarningf("Directory %s does not exist - has it been cloned?", repoDirPath)
 			statuses["SKIPPED"]++
-			continue
+			return
 		}
 
-		prStatus, err := gh.GetPR(checkStatusActivity.Writer(), repoDirPath, dir.Name)
+		prStatus, err := prs.GetPR(checkStatusActivity.Writer(), repoDirPath, dir.Name)
 		if err != nil {
 			checkStatusActivity.EndWithFailuref("No PR found: %v", err)
 			statuses["NO_PR"]++
-			continue
+			return
 		}
 
 		statuses[prStatus.State]++
+		if prStatus.State == "CLOSED" {
+			closedRepos = append(closedRepos, repo.FullRepoName)
+		}
+		if prStatus.State == "OPEN" && len(prStatus.Reviews) == 0 {
+			statuses["NOT_REVIEWED"]++
+		}
+		if reviews := changesRequested(prStatus); len(reviews) > 0 {
+			statuses["CHANGES_REQUESTED"]++
+			changesRequestedRepos = append(changesRequestedRepos, repo.FullRepoName)
+			for _, review := range reviews {
+				changesRequestedTable.AddRow(repo.FullRepoName, review.Author.Login, shortComment(review.Body), prStatus.Url)
+			}
+		}
 
 		for _, reaction := range prStatus.ReactionGroups {
 			reactions[reaction.Content] += reaction.Users.TotalCount
 		}
 
-		detailsTable.AddRow(repo.FullRepoName, prStatus.State, prStatus.ReviewDecision, prStatus.Url)
+		queue := "-"
+		if list && prStatus.State == "OPEN" {
+			queue = mergeQueue(checkStatusActivity, prs, repoDirPath, prStatus)
+		}
+
+		detailsTable.AddRow(repo.FullRepoName, prStatus.State, prStatus.ReviewDecision, age(prStatus), lastActivity(prStatus), reviewerInteraction(prStatus), queue, prStatus.Url)
 
 		checkStatusActivity.EndWithSuccess()
-	}
+	})
 
 	logger.Successf("turbolift pr-status completed\n")
 
@@ -134,11 +188,13 @@ func run(c *cobra.Command, _ []string) {
 
 	summaryTable := table.New("State", "Count")
 	summaryTable.WithHeaderFormatter(color.New(color.Underline).SprintfFunc())
-	summaryTable.WithFirstColumnFormatter(color.New(color.FgCyan).SprintfFunc())
+	summaryTable.WithFirstColumnFormatter(colors.Cyanf)
 	summaryTable.WithWriter(logger.Writer())
 
 	summaryTable.AddRow("Merged", statuses["MERGED"])
 	summaryTable.AddRow("Open", statuses["OPEN"])
+	summaryTable.AddRow("Open, not reviewed", statuses["NOT_REVIEWED"])
+	summaryTable.AddRow("Open, changes requested", statuses["CHANGES_REQUESTED"])
 	summaryTable.AddRow("Closed", statuses["CLOSED"])
 	summaryTable.AddRow("Skipped", statuses["SKIPPED"])
 	summaryTable.AddRow("No PR Found", statuses["NO_PR"])
@@ -156,4 +212,128 @@ func run(c *cobra.Command, _ []string) {
 	if len(reactionsOutput) > 0 {
 		logger.Println("Reactions:", strings.Join(reactionsOutput, "   "))
 	}
+
+	if len(changesRequestedRepos) > 0 {
+		logger.Println()
+		logger.Println("Changes have been requested on these PRs:")
+		changesRequestedTable.Print()
+	}
+
+	if changesRequestedFile != "" {
+		writeRepoFile(logger, changesRequestedFile, "repositories with changes requested", changesRequestedRepos)
+	}
+
+	if closedFile != "" {
+		writeRepoFile(logger, closedFile, "repositories with PRs closed without merging", closedRepos)
+	}
+}
+
+// writeRepoFile writes a selection of the campaign's repositories to a repo file which can be used with --repos
+func writeRepoFile(logger *logging.Logger, filename string, description string, repos []string) {
+	logger.Println()
+	writeActivity := logger.StartActivity("Writing %s to %s", description, filename)
+	contents := ""
+	if len(repos) > 0 {
+		contents = strings.Join(repos, "\n") + "\n"
+	}
+	if err := ioutil.WriteFile(filename, []byte(contents), 0o644); err != nil {
+		writeActivity.EndWithFailure(err)
+		return
+	}
+	writeActivity.EndWithSuccess()
+	logger.Printf("To work on only these repositories, use %s", colors.Cyan("--repos ", filename))
+}
+
+// changesRequested returns the latest review of each reviewer who currently has changes requested on an open PR.
+// A reviewer's later approval or dismissal supersedes their request for changes, while comments do not.
+func changesRequested(pr *github.PrStatus) []github.Review {
+	if pr.State != "OPEN" {
+		return nil
+	}
+
+	var reviewers []string
+	latest := make(map[string]github.Review)
+	for _, review := range pr.Reviews {
+		switch review.State {
+		case "APPROVED", "CHANGES_REQUESTED", "DISMISSED":
+			if _, ok := latest[review.Author.Login]; !ok {
+				reviewers = append(reviewers, review.Author.Login)
+			}
+			latest[review.Author.Login] = review
+		}
+	}
+
+	var result []github.Review
+	for _, reviewer := range reviewers {
+		if latest[reviewer].State == "CHANGES_REQUESTED" {
+			result = append(result, latest[reviewer])
+		}
+	}
+	return result
+}
+
+// mergeQueue describes the PR's place in its base branch's merge queue, if the branch has one
+func mergeQueue(activity *logging.Activity, prs *github.PRBatch, repoDirPath string, pr *github.PrStatus) string {
+	requirements, err := prs.GetMergeRequirements(activity.Writer(), repoDirPath, pr)
+	if err != nil {
+		activity.Logf("Unable to check the merge queue: %v", err)
+		return "unknown"
+	}
+	if !requirements.MergeQueueEnabled {
+		return "-"
+	}
+	if requirements.MergeQueueEntry == nil {
+		return "not queued"
+	}
+	return fmt.Sprintf("#%d (%s)", requirements.MergeQueueEntry.Position, requirements.MergeQueueEntry.State)
+}
+
+// shortComment is the first line of a review comment, shortened to fit in a table
+func shortComment(body string) string {
+	comment := strings.TrimSpace(strings.SplitN(strings.TrimSpace(body), "\n", 2)[0])
+	if comment == "" {
+		return "-"
+	}
+	if runes := []rune(comment); len(runes) > maxCommentLength {
+		return string(runes[:maxCommentLength-3]) + "..."
+	}
+	return comment
+}
+
+// age is how long an open PR has been open for
+func age(pr *github.PrStatus) string {
+	if pr.State != "OPEN" || pr.CreatedAt.IsZero() {
+		return "-"
+	}
+	return formatDuration(now().Sub(pr.CreatedAt))
+}
+
+func lastActivity(pr *github.PrStatus) string {
+	if pr.UpdatedAt.IsZero() {
+		return "-"
+	}
+	return fmt.Sprintf("%s (%s ago)", pr.UpdatedAt.Local().Format("2006-01-02 15:04"), formatDuration(now().Sub(pr.UpdatedAt)))
+}
+
+func reviewerInteraction(pr *github.PrStatus) string {
+	switch len(pr.Reviews) {
+	case 0:
+		return "none"
+	case 1:
+		return "1 review"
+	default:
+		return fmt.Sprintf("%d reviews", len(pr.Reviews))
+	}
+}
+
+// formatDuration formats a duration to the nearest whole unit, e.g. 3d, 5h or 20m
+func formatDuration(d time.Duration) string {
+	switch {
+	case d >= 24*time.Hour:
+		return fmt.Sprintf("%dd", int(d.Hours()/24))
+	case d >= time.Hour:
+		return fmt.Sprintf("%dh", int(d.Hours()))
+	default:
+		return fmt.Sprintf("%dm", int(d.Minutes()))
+	}
 }
@@ -18,8 +18,11 @@ package prstatus
 import (
 	"bytes"
 	"errors"
+	"io/ioutil"
 	"os"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 
@@ -30,6 +33,9 @@ import (
 func init() {
 	// disable output colouring so that strings we want to do 'Contains' checks on do not have ANSI escape sequences in IDEs
 	_ = os.Setenv("NO_COLOR", "1")
+	now = func() time.Time {
+		return time.Date(2021, 10, 11, 12, 0, 0, 0, time.UTC)
+	}
 }
 
 func TestItLogsSummaryInformation(t *testing.T) {
@@ -69,6 +75,34 @@ func TestItLogsDetailedInformation(t *testing.T) {
 	assert.Regexp(t, "org/repo3\\s+CLOSED", out)
 }
 
+func TestItReportsTheAgeAndReviewerInteractionOfPRs(t *testing.T) {
+	prepareFakeResponses()
+
+	testsupport.PrepareTempCampaign(true, "org/repo1", "org/repo2")
+
+	out, err := runCommand(true)
+	assert.NoError(t, err)
+	assert.Regexp(t, "Open, not reviewed\\s+1", out)
+
+	assert.Regexp(t, "org/repo1\\s+OPEN\\s+REVIEW_REQUIRED\\s+10d\\s+\\d{4}-\\d\\d-\\d\\d \\d\\d:\\d\\d \\(5h ago\\)\\s+none", out)
+	assert.Regexp(t, "org/repo2\\s+MERGED\\s+APPROVED\\s+-\\s+-\\s+1 review", out)
+}
+
+func TestItReportsMergeQueuePositions(t *testing.T) {
+	fakeGitHub := prepareFakeResponses()
+	fakeGitHub.MergeRequirements = &github.MergeRequirements{
+		MergeQueueEnabled: true,
+		MergeQueueEntry:   &github.MergeQueueEntry{Position: 2, State: "AWAITING_CHECKS"},
+	}
+
+	testsupport.PrepareTempCampaign(true, "org/repo1", "org/repo2")
+
+	out, err := runCommand(true)
+	assert.NoError(t, err)
+	assert.Regexp(t, "org/repo1\\s+OPEN.*#2 \\(AWAITING_CHECKS\\)", out)
+	assert.Regexp(t, "org/repo2\\s+MERGED.*1 review\\s+-", out)
+}
+
 func TestItSkipsUnclonedRepos(t *testing.T) {
 	prepareFakeResponses()
 
@@ -103,9 +137,51 @@ func TestItNotesReposWhereNoPrCanBeFound(t *testing.T) {
 	assert.Regexp(t, "org/repo1\\s+OPEN", out)
 }
 
-func runCommand(showList bool) (string, error) {
+func TestItReportsPRsWithChangesRequested(t *testing.T) {
+	prepareFakeResponses()
+
+	testsupport.PrepareTempCampaign(true, "org/repo1", "org/repo4")
+
+	out, err := runCommand(false, "--write-changes-requested")
+	assert.NoError(t, err)
+	assert.Regexp(t, "Open, changes requested\\s+1", out)
+	assert.Contains(t, out, "Changes have been requested on these PRs:")
+	assert.Regexp(t, "org/repo4\\s+alice\\s+Please also update the docs\\s+https://github.com/org/repo4/pull/1", out)
+	assert.Regexp(t, "org/repo4\\s+carol\\s+-", out)
+	// bob has since approved, so is not listed
+	assert.NotContains(t, out, "bob")
+	assert.Contains(t, out, "To work on only these repositories, use --repos changes_requested.txt")
+
+	contents, err := ioutil.ReadFile("changes_requested.txt")
+	assert.NoError(t, err)
+	assert.Equal(t, "org/repo4\n", string(contents))
+}
+
+func TestItWritesReposWithClosedPRs(t *testing.T) {
+	prepareFakeResponses()
+
+	testsupport.PrepareTempCampaign(true, "org/repo1", "org/repo2", "org/repo3")
+
+	out, err := runCommand(false, "--write-closed=rejected.txt")
+	assert.NoError(t, err)
+	assert.Contains(t, out, "Writing repositories with PRs closed without merging to rejected.txt")
+	assert.Contains(t, out, "To work on only these repositories, use --repos rejected.txt")
+
+	contents, err := ioutil.ReadFile("rejected.txt")
+	assert.NoError(t, err)
+	assert.Equal(t, "org/repo3\n", string(contents))
+}
+
+func TestItShortensReviewComments(t *testing.T) {
+	assert.Equal(t, "-", shortComment(" \n"))
+	assert.Equal(t, "First line", shortComment("First line\r\nSecond line"))
+	assert.Equal(t, strings.Repeat("a", 57)+"...", shortComment(strings.Repeat("a", 61)))
+}
+
+func runCommand(showList bool, args ...string) (string, error) {
 	cmd := NewPrStatusCmd()
 	list = showList
+	cmd.SetArgs(args)
 	outBuffer := bytes.NewBufferString("")
 	cmd.SetOut(outBuffer)
 	err := cmd.Execute()
@@ -115,10 +191,12 @@ func runCommand(showList bool) (string, error) {
 	return outBuffer.String(), nil
 }
 
-func prepareFakeResponses() {
+func prepareFakeResponses() *github.FakeGitHub {
 	dummyData := map[string]*github.PrStatus{
 		"work/org/repo1": {
-			State: "OPEN",
+			State:     "OPEN",
+			CreatedAt: time.Date(2021, 10, 1, 12, 0, 0, 0, time.UTC),
+			UpdatedAt: time.Date(2021, 10, 11, 7, 0, 0, 0, time.UTC),
 			ReactionGroups: []github.ReactionGroup{
 				{
 					Content: "THUMBS_UP",
@@ -146,6 +224,20 @@ func prepareFakeResponses() {
 				},
 			},
 			ReviewDecision: "APPROVED",
+			Reviews:        []github.Review{{State: "APPROVED"}},
+		},
+		"work/org/repo4": {
+			State:          "OPEN",
+			ReviewDecision: "CHANGES_REQUESTED",
+			Url:            "https://github.com/org/repo4/pull/1",
+			Reviews: []github.Review{
+				review("alice", "CHANGES_REQUESTED", "Please fix the tests"),
+				review("bob", "CHANGES_REQUESTED", "This needs a changelog entry"),
+				review("alice", "COMMENTED", "Thanks"),
+				review("bob", "APPROVED", "LGTM"),
+				review("alice", "CHANGES_REQUESTED", "Please also update the docs\nThey are out of date"),
+				review("carol", "CHANGES_REQUESTED", ""),
+			},
 		},
 		"work/org/repo3": {
 			State: "CLOSED",
@@ -159,7 +251,9 @@ func prepareFakeResponses() {
 			},
 		},
 	}
-	fakeGitHub := github.NewFakeGitHub(nil, func(workingDir string) (interface{}, error) {
+	fakeGitHub := github.NewFakeGitHub(func(github.Command, []string) (bool, error) {
+		return true, nil
+	}, func(workingDir string) (interface{}, error) {
 		if workingDir == "work/org/repoWithError" {
 			return nil, errors.New("Synthetic error")
 		} else {
@@ -167,4 +261,11 @@ func prepareFakeResponses() {
 		}
 	})
 	gh = fakeGitHub
+	return fakeGitHub
+}
+
+func review(login string, state string, body string) github.Review {
+	r := github.Review{State: state, Body: body}
+	r.Author.Login = login
+	return r
 }
@@ -0,0 +1,197 @@
+/*
+ * Copyright 2021 Skyscanner Limited.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * https://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package prune
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+
+	"github.com/skyscanner/turbolift/internal/campaign"
+	"github.com/skyscanner/turbolift/internal/changes"
+	"github.com/skyscanner/turbolift/internal/colors"
+	"github.com/skyscanner/turbolift/internal/executor"
+	"github.com/skyscanner/turbolift/internal/git"
+	"github.com/skyscanner/turbolift/internal/github"
+	"github.com/skyscanner/turbolift/internal/interrupt"
+	"github.com/skyscanner/turbolift/internal/logging"
+)
+
+var (
+	gh   github.GitHub     = github.NewCachingGitHub(github.NewGitHub())
+	g    git.Git           = git.NewRealGit()
+	exec executor.Executor = executor.NewRealExecutor()
+)
+
+var (
+	repoFile  string
+	appliedIf string
+	patchFile string
+	shell     string
+)
+
+// droppedReason is noted against each repository commented out of the repo file
+const droppedReason = "change already present"
+
+func NewPruneCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "prune",
+		Short: "Drop repositories which already have the campaign's change on their default branch",
+		Long: `Check out each repository's default branch alongside its working copy, and check whether the change is already
+present there: either by running a command which succeeds if it is (--applied-if), or by checking that a patch has
+already been applied (--patch). Repositories which do not need the change are commented out of the repo file, so
+that no-op PRs are not raised for them.`,
+		Args: cobra.NoArgs,
+		Run:  run,
+	}
+
+	cmd.Flags().StringVar(&repoFile, "repos", "repos.txt", "A file containing a list of repositories to prune.")
+	cmd.Flags().StringVar(&appliedIf, "applied-if", "", "A shell command which succeeds when run on a default branch which already has the change, e.g. \"grep -q go1.21 go.mod\"")
+	cmd.Flags().StringVar(&patchFile, "patch", "", "A patch file, e.g. from turbolift diff, which is already present on a default branch if it can be reversed.")
+	cmd.Flags().StringVar(&shell, "shell", "", "The shell used to run the --applied-if command (default $SHELL, or sh)")
+
+	return cmd
+}
+
+func run(c *cobra.Command, _ []string) {
+	logger := logging.NewLogger(c)
+
+	if (appliedIf == "") == (patchFile == "") {
+		logger.FlagErrorf("exactly one of --applied-if or --patch is needed")
+		return
+	}
+
+	readCampaignActivity := logger.StartSetupActivity("Reading campaign data (%s)", repoFile)
+	options := campaign.NewCampaignOptions()
+	options.RepoFilename = repoFile
+	dir, err := campaign.OpenCampaign(options)
+	if err != nil {
+		readCampaignActivity.EndWithFailure(err)
+		return
+	}
+	if patchFile != "" {
+		// the check runs within each repository, so needs the patch's absolute path
+		if patchFile, err = filepath.Abs(patchFile); err != nil {
+			readCampaignActivity.EndWithFailure(err)
+			return
+		}
+		if _, err = os.Stat(patchFile); err != nil {
+			readCampaignActivity.EndWithFailure(err)
+			return
+		}
+	}
+	readCampaignActivity.EndWithSuccess()
+
+	var applied []string
+	keptCount := 0
+	skippedCount := 0
+	errorCount := 0
+	interrupt.ForEachRepo(logger, dir.Repos, func(repo campaign.Repo) {
+		repoDirPath := repo.FullRepoPath()
+
+		checkActivity := logger.StartActivity("Checking whether %s already has the change", repo.FullRepoName)
+		// skip if the working copy does not exist
+		if _, err = os.Stat(repoDirPath); os.IsNotExist(err) {
+			checkActivity.EndWithWarningf("Directory %s does not exist - has it been cloned?", repoDirPath)
+			skippedCount++
+			return
+		}
+
+		isApplied, err := checkApplied(checkActivity, repo, repoDirPath)
+		if err != nil {
+			checkActivity.EndWithFailure(err)
+			errorCount++
+		} else if isApplied {
+			checkActivity.EndWithSuccessAndEmitLogs()
+			applied = append(applied, repo.FullRepoName)
+		} else {
+			checkActivity.EndWithSuccess()
+			keptCount++
+		}
+	})
+
+	if len(applied) > 0 {
+		dropActivity := logger.StartActivity("Dropping %d repositories from %s", len(applied), repoFile)
+		notListed, err := campaign.DropRepos(repoFile, applied, droppedReason)
+		if err != nil {
+			dropActivity.EndWithFailure(err)
+			errorCount++
+		} else if len(notListed) > 0 {
+			for _, repoName := range notListed {
+				dropActivity.Logf("%s is not listed individually, so remove it by hand", repoName)
+			}
+			dropActivity.EndWithWarningf("%d repositories could not be dropped", len(notListed))
+		} else {
+			dropActivity.EndWithSuccess()
+		}
+	}
+
+	if errorCount == 0 {
+		logger.Successf("turbolift prune completed %s(%s, %s, %s)\n", colors.Normal(), colors.Green(len(applied), " dropped"), colors.Green(keptCount, " kept"), colors.Yellow(skippedCount, " skipped"))
+	} else {
+		logger.Warnf("turbolift prune completed with %s %s(%s, %s, %s, %s)\n", colors.Red("errors"), colors.Normal(), colors.Green(len(applied), " dropped"), colors.Green(keptCount, " kept"), colors.Yellow(skippedCount, " skipped"), colors.Red(errorCount, " errored"))
+	}
+}
+
+// checkApplied checks out the latest base branch into a temporary working tree and checks whether it already has
+// the change
+func checkApplied(activity *logging.Activity, repo campaign.Repo, repoDirPath string) (_ bool, err error) {
+	baseBranch, err := changes.BaseBranch(activity.Writer(), gh, repo)
+	if err != nil {
+		return false, err
+	}
+	baseRemote, err := changes.BaseRemote(activity.Writer(), g, repoDirPath)
+	if err != nil {
+		return false, err
+	}
+	if err := g.Fetch(activity.Writer(), repoDirPath, baseRemote, baseBranch); err != nil {
+		return false, err
+	}
+
+	tempDir, err := ioutil.TempDir("", "turbolift-prune-")
+	if err != nil {
+		return false, err
+	}
+	defer func() {
+		_ = os.RemoveAll(tempDir)
+	}()
+	worktree := filepath.Join(tempDir, repo.RepoName)
+	if err := g.AddWorktree(activity.Writer(), repoDirPath, worktree, baseRemote+"/"+baseBranch); err != nil {
+		return false, err
+	}
+	defer func() {
+		removeErr := g.RemoveWorktree(activity.Writer(), repoDirPath, worktree)
+		if err == nil {
+			err = removeErr
+		}
+	}()
+
+	// the check failing, for whatever reason, means that the change is needed
+	var checkErr error
+	if appliedIf != "" {
+		shellCommand, shellArgs := executor.ShellInvocation(shell, appliedIf)
+		checkErr = exec.Execute(activity.Writer(), worktree, shellCommand, shellArgs...)
+	} else {
+		checkErr = exec.Execute(activity.Writer(), worktree, "git", "apply", "--check", "--reverse", patchFile)
+	}
+	if checkErr != nil {
+		return false, nil
+	}
+	activity.Logf("%s already has the change", baseRemote+"/"+baseBranch)
+	return true, nil
+}
@@ -0,0 +1,139 @@
+/*
+ * Copyright 2021 Skyscanner Limited.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * https://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package prune
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/skyscanner/turbolift/internal/executor"
+	"github.com/skyscanner/turbolift/internal/git"
+	"github.com/skyscanner/turbolift/internal/github"
+	"github.com/skyscanner/turbolift/internal/testsupport"
+)
+
+func init() {
+	// disable output colouring so that strings we want to do 'Contains' checks on do not have ANSI escape sequences in IDEs
+	_ = os.Setenv("NO_COLOR", "1")
+}
+
+func TestItDropsReposWhichAlreadyHaveTheChange(t *testing.T) {
+	gh = github.NewAlwaysSucceedsFakeGitHub()
+	fakeGit := git.NewAlwaysSucceedsFakeGit()
+	g = fakeGit
+	fakeExecutor := executor.NewFakeExecutor(func(workingDir string, _ string, _ ...string) error {
+		// the check runs in a temporary working tree named after the repository
+		if strings.HasSuffix(workingDir, "repo2") {
+			return errors.New("exit status 1")
+		}
+		return nil
+	}, func(string, string, ...string) (string, error) {
+		return "", nil
+	})
+	exec = fakeExecutor
+
+	testsupport.PrepareTempCampaign(true, "org/repo1", "org/repo2")
+
+	out, err := runCommand("--applied-if", "grep -q go1.21 go.mod")
+	assert.NoError(t, err)
+	assert.Contains(t, out, "origin/main already has the change")
+	assert.Contains(t, out, "turbolift prune completed (1 dropped, 1 kept, 0 skipped)")
+
+	repos, err := ioutil.ReadFile("repos.txt")
+	assert.NoError(t, err)
+	assert.Equal(t, "# org/repo1 (change already present)\norg/repo2", string(repos))
+
+	fakeGit.AssertCalledWith(t, [][]string{
+		{"remotes", "work/org/repo1"},
+		{"fetch", "work/org/repo1", "origin", "main"},
+		{"addWorktree", "work/org/repo1", "origin/main"},
+		{"removeWorktree", "work/org/repo1"},
+		{"remotes", "work/org/repo2"},
+		{"fetch", "work/org/repo2", "origin", "main"},
+		{"addWorktree", "work/org/repo2", "origin/main"},
+		{"removeWorktree", "work/org/repo2"},
+	})
+}
+
+func TestItChecksWhetherAPatchIsAlreadyApplied(t *testing.T) {
+	gh = github.NewAlwaysSucceedsFakeGitHub()
+	g = git.NewAlwaysSucceedsFakeGit()
+	var checks [][]string
+	exec = executor.NewFakeExecutor(func(_ string, name string, args ...string) error {
+		checks = append(checks, append([]string{name}, args...))
+		return nil
+	}, func(string, string, ...string) (string, error) {
+		return "", nil
+	})
+
+	testsupport.PrepareTempCampaign(true, "org/repo1")
+	assert.NoError(t, ioutil.WriteFile("change.patch", []byte("diff --git a/x b/x\n"), 0o644))
+	patchPath, _ := filepath.Abs("change.patch")
+
+	out, err := runCommand("--patch", "change.patch")
+	assert.NoError(t, err)
+	assert.Contains(t, out, "turbolift prune completed (1 dropped, 0 kept, 0 skipped)")
+	assert.Equal(t, [][]string{{"git", "apply", "--check", "--reverse", patchPath}}, checks)
+}
+
+func TestItKeepsReposWhenTheCheckCannotBeSetUp(t *testing.T) {
+	gh = github.NewAlwaysSucceedsFakeGitHub()
+	g = git.NewFakeGit(func(_ io.Writer, call []string) (bool, error) {
+		if call[0] == "fetch" {
+			return false, errors.New("synthetic error")
+		}
+		return true, nil
+	})
+	exec = executor.NewAlwaysSucceedsFakeExecutor()
+
+	testsupport.PrepareTempCampaign(true, "org/repo1")
+
+	out, err := runCommand("--applied-if", "true")
+	assert.NoError(t, err)
+	assert.Contains(t, out, "turbolift prune completed with errors (0 dropped, 0 kept, 0 skipped, 1 errored)")
+
+	repos, err := ioutil.ReadFile("repos.txt")
+	assert.NoError(t, err)
+	assert.Equal(t, "org/repo1", string(repos))
+}
+
+func TestItNeedsExactlyOneCheck(t *testing.T) {
+	testsupport.PrepareTempCampaign(true, "org/repo1")
+
+	out, err := runCommand()
+	assert.NoError(t, err)
+	assert.Contains(t, out, "exactly one of --applied-if or --patch is needed")
+}
+
+func runCommand(args ...string) (string, error) {
+	cmd := NewPruneCmd()
+	cmd.SetArgs(args)
+	outBuffer := bytes.NewBufferString("")
+	cmd.SetOut(outBuffer)
+	err := cmd.Execute()
+	if err != nil {
+		return outBuffer.String(), err
+	}
+	return outBuffer.String(), nil
+}
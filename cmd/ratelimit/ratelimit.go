@@ -0,0 +1,202 @@
+/*
+ * Copyright 2021 Skyscanner Limited.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * https://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package ratelimit
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/fatih/color"
+	"github.com/rodaine/table"
+	"github.com/spf13/cobra"
+
+	"github.com/skyscanner/turbolift/internal/campaign"
+	"github.com/skyscanner/turbolift/internal/colors"
+	"github.com/skyscanner/turbolift/internal/github"
+	"github.com/skyscanner/turbolift/internal/logging"
+)
+
+var gh github.GitHub = github.NewGitHub()
+
+var now = time.Now
+
+var repoFile string
+
+// apiCost is the approximate number of REST (core) and GraphQL API calls a command makes for each repository,
+// assuming nothing has been cached
+type apiCost struct {
+	core    int
+	graphQL int
+}
+
+var costs = map[string]apiCost{
+	"approve":          {graphQL: 2},
+	"archive":          {graphQL: 1},
+	"backport":         {graphQL: 2},
+	"blockers":         {graphQL: 1},
+	"clone":            {core: 1, graphQL: 1},
+	"close-stale":      {graphQL: 2},
+	"conflicts":        {graphQL: 1},
+	"create-issues":    {graphQL: 1},
+	"create-prs":       {graphQL: 4},
+	"diff":             {graphQL: 1},
+	"du":               {graphQL: 1},
+	"merge":            {graphQL: 2},
+	"pr-status":        {graphQL: 1},
+	"prune":            {graphQL: 1},
+	"rebase":           {graphQL: 2},
+	"recreate-prs":     {graphQL: 3},
+	"refresh":          {graphQL: 2},
+	"refresh-metadata": {graphQL: 1},
+	"serve":            {graphQL: 1},
+	"split-prs":        {graphQL: 7},
+	"sync":             {graphQL: 1},
+	"undo":             {graphQL: 2},
+	"update-prs":       {graphQL: 2},
+}
+
+func NewRateLimitCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "rate-limit [COMMAND]",
+		Short: "Show the remaining GitHub API budget, and whether it will cover a command",
+		Long: `Show the remaining GitHub API budget and when it resets. Given a command (e.g. create-prs), also estimate the
+API calls it will make over the campaign's repositories and when it can be expected to complete, allowing for
+waiting on the budget to reset.`,
+		Args: cobra.MaximumNArgs(1),
+		Run:  run,
+	}
+
+	cmd.Flags().StringVar(&repoFile, "repos", "repos.txt", "A file containing a list of repositories the command will be run against.")
+
+	return cmd
+}
+
+func run(c *cobra.Command, args []string) {
+	logger := logging.NewLogger(c)
+
+	var commandName string
+	var repoCount int
+	if len(args) == 1 {
+		commandName = args[0]
+		if _, ok := costs[commandName]; !ok {
+			logger.Errorf("No estimate is available for %s - estimates are available for %s", commandName, strings.Join(knownCommands(), ", "))
+			return
+		}
+
+		readCampaignActivity := logger.StartSetupActivity("Reading campaign data (%s)", repoFile)
+		options := campaign.NewCampaignOptions()
+		options.RepoFilename = repoFile
+		dir, err := campaign.OpenCampaign(options)
+		if err != nil {
+			readCampaignActivity.EndWithFailure(err)
+			return
+		}
+		readCampaignActivity.EndWithSuccess()
+		repoCount = len(dir.Repos)
+	}
+
+	rateLimitActivity := logger.StartActivity("Checking GitHub API rate limits")
+	limits, err := gh.GetRateLimits(rateLimitActivity.Writer(), ".")
+	if err != nil {
+		rateLimitActivity.EndWithFailure(err)
+		return
+	}
+	rateLimitActivity.EndWithSuccess()
+
+	logger.Println()
+	budgetTable := table.New("API", "Remaining", "Limit", "Resets")
+	budgetTable.WithHeaderFormatter(color.New(color.Underline).SprintfFunc())
+	budgetTable.WithFirstColumnFormatter(colors.Cyanf)
+	budgetTable.WithWriter(logger.Writer())
+	budgetTable.AddRow("REST", limits.Core.Remaining, limits.Core.Limit, formatReset(limits.Core))
+	budgetTable.AddRow("GraphQL", limits.GraphQL.Remaining, limits.GraphQL.Limit, formatReset(limits.GraphQL))
+	budgetTable.Print()
+
+	if commandName == "" {
+		return
+	}
+
+	cost := costs[commandName]
+	logger.Println()
+	logger.Printf("Estimated usage for %s over %d repositories:", commandName, repoCount)
+	estimateTable := table.New("API", "Calls", "Remaining after", "Completes")
+	estimateTable.WithHeaderFormatter(color.New(color.Underline).SprintfFunc())
+	estimateTable.WithFirstColumnFormatter(colors.Cyanf)
+	estimateTable.WithWriter(logger.Writer())
+	completion := now()
+	for _, usage := range []struct {
+		name  string
+		calls int
+		limit github.RateLimit
+	}{
+		{"REST", cost.core * repoCount, limits.Core},
+		{"GraphQL", cost.graphQL * repoCount, limits.GraphQL},
+	} {
+		if usage.calls == 0 {
+			continue
+		}
+		completes := estimateCompletion(usage.calls, usage.limit)
+		if completes.After(completion) {
+			completion = completes
+		}
+		completesText := "within the current budget"
+		if !completes.IsZero() {
+			completesText = "after " + completes.Format("15:04")
+		}
+		estimateTable.AddRow(usage.name, usage.calls, max(usage.limit.Remaining-usage.calls, 0), completesText)
+	}
+	estimateTable.Print()
+
+	logger.Println()
+	if completion.After(now()) {
+		logger.Warnf("The rate limit will be reached - %s is expected to complete after %s, waiting for the budget to reset\n", commandName, completion.Format("15:04"))
+	} else {
+		logger.Successf("The current budget covers %s over %d repositories\n", commandName, repoCount)
+	}
+}
+
+// estimateCompletion returns when a number of calls will have been made given the budget, or the zero time if the
+// remaining budget covers them. Budgets are replenished hourly.
+func estimateCompletion(calls int, limit github.RateLimit) time.Time {
+	if calls <= limit.Remaining || limit.Limit <= 0 {
+		return time.Time{}
+	}
+	resets := (calls - limit.Remaining + limit.Limit - 1) / limit.Limit
+	return limit.ResetTime().Add(time.Duration(resets-1) * time.Hour)
+}
+
+func formatReset(limit github.RateLimit) string {
+	reset := limit.ResetTime()
+	return fmt.Sprintf("%s (in %s)", reset.Format("15:04"), reset.Sub(now()).Round(time.Minute))
+}
+
+func knownCommands() []string {
+	var names []string
+	for name := range costs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func max(a int, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,116 @@
+/*
+ * Copyright 2021 Skyscanner Limited.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * https://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package ratelimit
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/skyscanner/turbolift/internal/github"
+	"github.com/skyscanner/turbolift/internal/testsupport"
+)
+
+func init() {
+	// disable output colouring so that strings we want to do 'Contains' checks on do not have ANSI escape sequences in IDEs
+	_ = os.Setenv("NO_COLOR", "1")
+	// the fake budgets reset at 13:00 UTC
+	time.Local = time.UTC
+	now = func() time.Time {
+		return time.Date(2021, 1, 1, 12, 30, 0, 0, time.UTC)
+	}
+}
+
+func TestItShowsTheRemainingBudget(t *testing.T) {
+	fakeGitHub := github.NewAlwaysSucceedsFakeGitHub()
+	gh = fakeGitHub
+
+	testsupport.PrepareTempCampaign(false)
+
+	out, err := runCommand()
+	assert.NoError(t, err)
+	assert.Regexp(t, `REST\s+4000\s+5000\s+13:00 \(in 30m0s\)`, out)
+	assert.Regexp(t, `GraphQL\s+100\s+5000\s+13:00 \(in 30m0s\)`, out)
+	assert.NotContains(t, out, "Estimated usage")
+
+	fakeGitHub.AssertCalledWith(t, [][]string{
+		{"."},
+	})
+}
+
+func TestItEstimatesUsageWithinTheBudget(t *testing.T) {
+	gh = github.NewAlwaysSucceedsFakeGitHub()
+
+	testsupport.PrepareTempCampaign(false, "org/repo1", "org/repo2")
+
+	out, err := runCommand("pr-status")
+	assert.NoError(t, err)
+	assert.Contains(t, out, "Estimated usage for pr-status over 2 repositories:")
+	assert.Regexp(t, `GraphQL\s+2\s+98\s+within the current budget`, out)
+	assert.Contains(t, out, "The current budget covers pr-status over 2 repositories")
+}
+
+func TestItEstimatesCompletionWhenTheBudgetRunsOut(t *testing.T) {
+	gh = github.NewAlwaysSucceedsFakeGitHub()
+
+	var repos []string
+	for i := 0; i < 40; i++ {
+		repos = append(repos, fmt.Sprintf("org/repo%d", i))
+	}
+	testsupport.PrepareTempCampaign(false, repos...)
+
+	out, err := runCommand("create-prs")
+	assert.NoError(t, err)
+	assert.Regexp(t, `GraphQL\s+160\s+0\s+after 13:00`, out)
+	assert.Contains(t, out, "The rate limit will be reached - create-prs is expected to complete after 13:00")
+}
+
+func TestItRejectsCommandsWithoutAnEstimate(t *testing.T) {
+	fakeGitHub := github.NewAlwaysSucceedsFakeGitHub()
+	gh = fakeGitHub
+
+	testsupport.PrepareTempCampaign(false)
+
+	out, err := runCommand("foreach")
+	assert.NoError(t, err)
+	assert.Contains(t, out, "No estimate is available for foreach - estimates are available for approve, archive, backport, blockers")
+
+	fakeGitHub.AssertCalledWith(t, [][]string{})
+}
+
+func TestItEstimatesCompletionOverSeveralResets(t *testing.T) {
+	limit := github.RateLimit{Limit: 100, Remaining: 10, Reset: time.Date(2021, 1, 1, 13, 0, 0, 0, time.UTC).Unix()}
+
+	assert.True(t, estimateCompletion(10, limit).IsZero())
+	assert.Equal(t, "13:00", estimateCompletion(110, limit).UTC().Format("15:04"))
+	assert.Equal(t, "14:00", estimateCompletion(111, limit).UTC().Format("15:04"))
+}
+
+func runCommand(args ...string) (string, error) {
+	cmd := NewRateLimitCmd()
+	cmd.SetArgs(args)
+	outBuffer := bytes.NewBufferString("")
+	cmd.SetOut(outBuffer)
+	err := cmd.Execute()
+	if err != nil {
+		return outBuffer.String(), err
+	}
+	return outBuffer.String(), nil
+}
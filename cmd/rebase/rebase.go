@@ -0,0 +1,218 @@
+/*
+ * Copyright 2021 Skyscanner Limited.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * https://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package rebase
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/skyscanner/turbolift/internal/campaign"
+	"github.com/skyscanner/turbolift/internal/changes"
+	"github.com/skyscanner/turbolift/internal/colors"
+	"github.com/skyscanner/turbolift/internal/executor"
+	"github.com/skyscanner/turbolift/internal/git"
+	"github.com/skyscanner/turbolift/internal/github"
+	"github.com/skyscanner/turbolift/internal/hooks"
+	"github.com/skyscanner/turbolift/internal/interrupt"
+	"github.com/skyscanner/turbolift/internal/logging"
+	"github.com/skyscanner/turbolift/internal/secrets"
+)
+
+var (
+	// gh is not cached, as the PRs to rebase are decided by their current state
+	gh   github.GitHub     = github.NewGitHub()
+	g    git.Git           = git.NewRealGit()
+	exec executor.Executor = executor.NewRealExecutor()
+)
+
+var (
+	repoFile     string
+	regenerate   string
+	shell        string
+	message      string
+	allOpen      bool
+	secretRules  string
+	allowSecrets bool
+)
+
+func NewRebaseCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "rebase",
+		Short: "Rebase the branches of conflicted PRs onto their base branch, and force-push them",
+		Long: `Rebase the branch of each PR which has conflicts onto the latest version of its base branch, and force-push it.
+With --regenerate, the branch is instead reset to the base branch and the given command is run again to regenerate
+the campaign's changes, which are then committed and force-pushed.
+Repositories which still need manual work are reported at the end.`,
+		Run: run,
+	}
+
+	cmd.Flags().StringVar(&repoFile, "repos", "repos.txt", "A file containing a list of repositories to rebase.")
+	cmd.Flags().StringVar(&regenerate, "regenerate", "", "A command to regenerate the campaign's changes from the base branch, instead of rebasing them.")
+	cmd.Flags().StringVar(&shell, "shell", "", "The shell used to run the --regenerate command (default $SHELL, or sh)")
+	cmd.Flags().StringVarP(&message, "message", "m", "", "The commit message for regenerated changes (default the PR title)")
+	cmd.Flags().BoolVar(&allOpen, "all", false, "Rebase every open PR, not just those with conflicts.")
+	cmd.Flags().StringVar(&secretRules, "secret-rules", "", "A gitleaks configuration file with rules for secrets to check for, in addition to the built-in rules.")
+	cmd.Flags().BoolVar(&allowSecrets, "allow-secrets", false, "Push changes even where they appear to contain secrets.")
+
+	return cmd
+}
+
+func run(c *cobra.Command, _ []string) {
+	logger := logging.NewLogger(c)
+
+	readCampaignActivity := logger.StartSetupActivity("Reading campaign data (%s)", repoFile)
+	options := campaign.NewCampaignOptions()
+	options.RepoFilename = repoFile
+	dir, err := campaign.OpenCampaign(options)
+	if err != nil {
+		readCampaignActivity.EndWithFailure(err)
+		return
+	}
+	lifecycleHooks, err := hooks.Load()
+	if err != nil {
+		readCampaignActivity.EndWithFailure(err)
+		return
+	}
+	rules, err := secrets.LoadRules(secretRules)
+	if err != nil {
+		readCampaignActivity.EndWithFailure(err)
+		return
+	}
+	readCampaignActivity.EndWithSuccess()
+
+	if err := lifecycleHooks.RunForCommand(logger, hooks.PrePush); err != nil {
+		return
+	}
+
+	if message == "" {
+		message = dir.PrTitle
+	}
+
+	var needsManualWork []string
+	doneCount := 0
+	skippedCount := 0
+	errorCount := 0
+	interrupt.ForEachRepo(logger, dir.Repos, func(repo campaign.Repo) {
+		repoDirPath := repo.FullRepoPath()
+
+		checkActivity := logger.StartActivity("Checking PR in %s", repo.FullRepoName)
+		// skip if the working copy does not exist
+		if _, err = os.Stat(repoDirPath); os.IsNotExist(err) {
+			checkActivity.EndWithWarningf("Directory %s does not exist - has it been cloned?", repoDirPath)
+			skippedCount++
+			return
+		}
+
+		pr, err := gh.GetPR(checkActivity.Writer(), repoDirPath, dir.Name)
+		var noPRFoundError *github.NoPRFoundError
+		if errors.As(err, &noPRFoundError) {
+			checkActivity.EndWithWarning(err)
+			skippedCount++
+			return
+		}
+		if err != nil {
+			checkActivity.EndWithFailure(err)
+			errorCount++
+			return
+		}
+		if pr.State != "OPEN" || (pr.Mergeable != "CONFLICTING" && !allOpen) {
+			checkActivity.EndWithSuccess()
+			skippedCount++
+			return
+		}
+		checkActivity.EndWithSuccess()
+
+		var updateActivity *logging.Activity
+		if regenerate != "" {
+			updateActivity = logger.StartActivity("Regenerating changes in %s", repo.FullRepoName)
+		} else {
+			updateActivity = logger.StartActivity("Rebasing %s", repo.FullRepoName)
+		}
+		if err := update(updateActivity, lifecycleHooks, rules, repo, repoDirPath, dir.Name); err != nil {
+			updateActivity.EndWithFailure(err)
+			needsManualWork = append(needsManualWork, repo.FullRepoName)
+			return
+		}
+		updateActivity.EndWithSuccess()
+		doneCount++
+	})
+
+	if len(needsManualWork) == 0 && errorCount == 0 {
+		logger.Successf("turbolift rebase completed %s(%s, %s)\n", colors.Normal(), colors.Green(doneCount, " OK"), colors.Yellow(skippedCount, " skipped"))
+	} else {
+		logger.Warnf("turbolift rebase completed with %s %s(%s, %s, %s, %s)\n", colors.Red("errors"), colors.Normal(), colors.Green(doneCount, " OK"), colors.Yellow(skippedCount, " skipped"), colors.Red(errorCount, " errored"), colors.Red(len(needsManualWork), " need manual work"))
+	}
+	if len(needsManualWork) > 0 {
+		logger.Println("These repositories still need manual work:")
+		for _, repoName := range needsManualWork {
+			logger.Println("  ", repoName)
+		}
+	}
+}
+
+// update brings the campaign branch up to date with the base branch, by rebasing or regenerating it, and force-pushes it
+// unless its changes appear to contain secrets or a pre-push hook fails
+func update(activity *logging.Activity, lifecycleHooks *hooks.Hooks, rules []secrets.Rule, repo campaign.Repo, repoDirPath string, branchName string) error {
+	baseBranch, err := changes.BaseBranch(activity.Writer(), gh, repo)
+	if err != nil {
+		return err
+	}
+
+	baseRemote, err := changes.BaseRemote(activity.Writer(), g, repoDirPath)
+	if err != nil {
+		return err
+	}
+
+	if err := g.Fetch(activity.Writer(), repoDirPath, baseRemote, baseBranch); err != nil {
+		return err
+	}
+	base := baseRemote + "/" + baseBranch
+
+	if regenerate != "" {
+		if err := g.ResetHard(activity.Writer(), repoDirPath, base); err != nil {
+			return err
+		}
+		shellCommand, shellArgs := executor.ShellInvocation(shell, regenerate)
+		if err := exec.Execute(activity.Writer(), repoDirPath, shellCommand, shellArgs...); err != nil {
+			return err
+		}
+		changed, err := g.IsRepoChanged(activity.Writer(), repoDirPath)
+		if err != nil {
+			return err
+		}
+		if !changed {
+			return errors.New("regenerating made no changes, so the branch has been left as the base branch and not pushed")
+		}
+		if err := g.Commit(activity.Writer(), repoDirPath, message); err != nil {
+			return err
+		}
+	} else if err := g.Rebase(activity.Writer(), repoDirPath, base); err != nil {
+		return err
+	}
+
+	if !allowSecrets {
+		if err := secrets.CheckBranch(activity.Writer(), g, gh, repo, rules); err != nil {
+			return fmt.Errorf("not pushing: %w", err)
+		}
+	}
+	if err := lifecycleHooks.RunForRepo(activity.Writer(), hooks.PrePush, repo); err != nil {
+		return err
+	}
+	return g.ForcePush(activity.Writer(), repoDirPath, "origin", branchName)
+}
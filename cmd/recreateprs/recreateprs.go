@@ -0,0 +1,168 @@
+/*
+ * Copyright 2021 Skyscanner Limited.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * https://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package recreateprs
+
+import (
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/skyscanner/turbolift/internal/campaign"
+	"github.com/skyscanner/turbolift/internal/colors"
+	"github.com/skyscanner/turbolift/internal/git"
+	"github.com/skyscanner/turbolift/internal/github"
+	"github.com/skyscanner/turbolift/internal/hooks"
+	"github.com/skyscanner/turbolift/internal/interrupt"
+	"github.com/skyscanner/turbolift/internal/logging"
+	"github.com/skyscanner/turbolift/internal/secrets"
+)
+
+var (
+	gh github.GitHub = github.NewCachingGitHub(github.NewGitHub())
+	g  git.Git       = git.NewRealGit()
+)
+
+var (
+	isDraft           bool
+	repoFile          string
+	prDescriptionFile string
+	secretRules       string
+	allowSecrets      bool
+)
+
+func NewRecreatePRsCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "recreate-prs",
+		Short: "Recreate the campaign's PRs which were closed without being merged",
+		Long: `For each repository where the campaign's PR was closed without being merged (for example by mistake), push
+the campaign branch again in case it was deleted, and create a new PR using the campaign's PR title and description.
+Repositories with an open or merged PR are left alone.`,
+		Args: cobra.NoArgs,
+		Run:  run,
+	}
+
+	cmd.Flags().BoolVar(&isDraft, "draft", false, "Creates the Pull Request as Draft PR")
+	cmd.Flags().StringVar(&repoFile, "repos", "repos.txt", "A file containing a list of repositories to recreate PRs in.")
+	cmd.Flags().StringVar(&prDescriptionFile, "description", "README.md", "A file containing the title and description for the PRs.")
+	cmd.Flags().StringVar(&secretRules, "secret-rules", "", "A gitleaks configuration file with rules for secrets to check for, in addition to the built-in rules.")
+	cmd.Flags().BoolVar(&allowSecrets, "allow-secrets", false, "Push changes even where they appear to contain secrets.")
+
+	return cmd
+}
+
+func run(c *cobra.Command, _ []string) {
+	logger := logging.NewLogger(c)
+
+	readCampaignActivity := logger.StartSetupActivity("Reading campaign data (%s, %s)", repoFile, prDescriptionFile)
+	options := campaign.NewCampaignOptions()
+	options.RepoFilename = repoFile
+	options.PrDescriptionFilename = prDescriptionFile
+	dir, err := campaign.OpenCampaign(options)
+	if err != nil {
+		readCampaignActivity.EndWithFailure(err)
+		return
+	}
+	lifecycleHooks, err := hooks.Load()
+	if err != nil {
+		readCampaignActivity.EndWithFailure(err)
+		return
+	}
+	rules, err := secrets.LoadRules(secretRules)
+	if err != nil {
+		readCampaignActivity.EndWithFailure(err)
+		return
+	}
+	readCampaignActivity.EndWithSuccess()
+
+	if err := lifecycleHooks.RunForCommand(logger, hooks.PrePush); err != nil {
+		return
+	}
+
+	var doneCount, skippedCount, errorCount int
+	interrupt.ForEachRepo(logger, dir.Repos, func(repo campaign.Repo) {
+		repoDirPath := repo.FullRepoPath()
+
+		recreateActivity := logger.StartActivity("Recreating PR in %s", repo.FullRepoName)
+		// skip if the working copy does not exist
+		if _, err = os.Stat(repoDirPath); os.IsNotExist(err) {
+			recreateActivity.EndWithWarningf("Directory %s does not exist - has it been cloned?", repoDirPath)
+			skippedCount++
+			return
+		}
+
+		pr, err := gh.GetPR(recreateActivity.Writer(), repoDirPath, dir.Name)
+		if err != nil {
+			if _, ok := err.(*github.NoPRFoundError); ok {
+				recreateActivity.EndWithWarningf("No PR was ever created - use create-prs instead")
+				skippedCount++
+			} else {
+				recreateActivity.EndWithFailure(err)
+				errorCount++
+			}
+			return
+		}
+
+		if pr.State != "CLOSED" {
+			recreateActivity.EndWithWarningf("PR is %s", strings.ToLower(pr.State))
+			skippedCount++
+			return
+		}
+
+		if !allowSecrets {
+			if err := secrets.CheckBranch(recreateActivity.Writer(), g, gh, repo, rules); err != nil {
+				recreateActivity.EndWithFailuref("Not pushing: %v", err)
+				errorCount++
+				return
+			}
+		}
+		if err := lifecycleHooks.RunForRepo(recreateActivity.Writer(), hooks.PrePush, repo); err != nil {
+			recreateActivity.EndWithFailure(err)
+			errorCount++
+			return
+		}
+
+		// the branch may have been deleted when the PR was closed
+		if err := g.Push(recreateActivity.Writer(), repoDirPath, "origin", dir.Name); err != nil {
+			recreateActivity.EndWithFailure(err)
+			errorCount++
+			return
+		}
+
+		didCreate, err := gh.CreatePullRequest(recreateActivity.Writer(), repoDirPath, github.PullRequest{
+			Title:        dir.PrTitle,
+			Body:         dir.PrBody,
+			UpstreamRepo: repo.FullRepoName,
+			IsDraft:      isDraft,
+		})
+		if err != nil {
+			recreateActivity.EndWithFailure(err)
+			errorCount++
+		} else if !didCreate {
+			recreateActivity.EndWithWarningf("No PR created in %s", repo.FullRepoName)
+			skippedCount++
+		} else {
+			recreateActivity.EndWithSuccess()
+			doneCount++
+		}
+	})
+
+	if errorCount == 0 {
+		logger.Successf("turbolift recreate-prs completed %s(%s, %s)\n", colors.Normal(), colors.Green(doneCount, " OK"), colors.Yellow(skippedCount, " skipped"))
+	} else {
+		logger.Warnf("turbolift recreate-prs completed with %s %s(%s, %s, %s)\n", colors.Red("errors"), colors.Normal(), colors.Green(doneCount, " OK"), colors.Yellow(skippedCount, " skipped"), colors.Red(errorCount, " errored"))
+	}
+}
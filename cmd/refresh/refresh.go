@@ -0,0 +1,249 @@
+/*
+ * Copyright 2021 Skyscanner Limited.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * https://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package refresh
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/skyscanner/turbolift/internal/campaign"
+	"github.com/skyscanner/turbolift/internal/changes"
+	"github.com/skyscanner/turbolift/internal/colors"
+	"github.com/skyscanner/turbolift/internal/executor"
+	"github.com/skyscanner/turbolift/internal/git"
+	"github.com/skyscanner/turbolift/internal/github"
+	"github.com/skyscanner/turbolift/internal/hooks"
+	"github.com/skyscanner/turbolift/internal/interrupt"
+	"github.com/skyscanner/turbolift/internal/logging"
+	"github.com/skyscanner/turbolift/internal/secrets"
+)
+
+var (
+	gh   github.GitHub     = github.NewCachingGitHub(github.NewGitHub())
+	g    git.Git           = git.NewRealGit()
+	exec executor.Executor = executor.NewRealExecutor()
+)
+
+var (
+	repoFile     string
+	command      string
+	shell        string
+	message      string
+	secretRules  string
+	allowSecrets bool
+)
+
+func NewRefreshCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "refresh",
+		Short: "Bring open PRs up to date by merging their base branch and re-running the campaign's foreach command",
+		Long: `For each repository with an open PR, merge the latest version of its base branch into the campaign branch,
+run the campaign's script recorded with foreach --save-for-refresh (or the command given with --command) again, with the
+options it was recorded with, commit any changes it makes and push.
+This makes iterating on the campaign's changes after review feedback a single step.`,
+		Args: cobra.NoArgs,
+		Run:  run,
+	}
+
+	cmd.Flags().StringVar(&repoFile, "repos", "repos.txt", "A file containing a list of repositories to refresh.")
+	cmd.Flags().StringVar(&command, "command", "", "The command to run in each repository (default the command recorded with foreach --save-for-refresh)")
+	cmd.Flags().StringVar(&shell, "shell", "", "The shell used to run the command (default the shell recorded with the command, $SHELL, or sh)")
+	cmd.Flags().StringVarP(&message, "message", "m", "", "The commit message for the changes (default the PR title)")
+	cmd.Flags().StringVar(&secretRules, "secret-rules", "", "A gitleaks configuration file with rules for secrets to check for, in addition to the built-in rules.")
+	cmd.Flags().BoolVar(&allowSecrets, "allow-secrets", false, "Push changes even where they appear to contain secrets.")
+
+	return cmd
+}
+
+func run(c *cobra.Command, _ []string) {
+	logger := logging.NewLogger(c)
+
+	readCampaignActivity := logger.StartSetupActivity("Reading campaign data (%s)", repoFile)
+	options := campaign.NewCampaignOptions()
+	options.RepoFilename = repoFile
+	dir, err := campaign.OpenCampaign(options)
+	if err != nil {
+		readCampaignActivity.EndWithFailure(err)
+		return
+	}
+	script := campaign.ForeachCommand{Command: command, Shell: shell}
+	if command == "" {
+		if script, err = campaign.ReadForeachCommand(); err != nil {
+			readCampaignActivity.EndWithFailuref("%v - run the campaign's changes with foreach --save-for-refresh, or use --command", err)
+			return
+		}
+		if shell != "" {
+			script.Shell = shell
+		}
+	}
+	limit, err := script.Limit()
+	if err != nil {
+		readCampaignActivity.EndWithFailure(err)
+		return
+	}
+	environment, err := script.Environment()
+	if err != nil {
+		readCampaignActivity.EndWithFailure(err)
+		return
+	}
+	lifecycleHooks, err := hooks.Load()
+	if err != nil {
+		readCampaignActivity.EndWithFailure(err)
+		return
+	}
+	rules, err := secrets.LoadRules(secretRules)
+	if err != nil {
+		readCampaignActivity.EndWithFailure(err)
+		return
+	}
+	readCampaignActivity.EndWithSuccess()
+
+	if message == "" {
+		message = dir.PrTitle
+	}
+
+	if err := lifecycleHooks.RunForCommand(logger, hooks.PrePush); err != nil {
+		return
+	}
+
+	var needsManualWork []string
+	doneCount := 0
+	skippedCount := 0
+	errorCount := 0
+	interrupt.ForEachRepo(logger, dir.Repos, func(repo campaign.Repo) {
+		repoDirPath := repo.FullRepoPath()
+
+		checkActivity := logger.StartActivity("Checking PR in %s", repo.FullRepoName)
+		// skip if the working copy does not exist
+		if _, err = os.Stat(repoDirPath); os.IsNotExist(err) {
+			checkActivity.EndWithWarningf("Directory %s does not exist - has it been cloned?", repoDirPath)
+			skippedCount++
+			return
+		}
+
+		pr, err := gh.GetPR(checkActivity.Writer(), repoDirPath, dir.Name)
+		var noPRFoundError *github.NoPRFoundError
+		if errors.As(err, &noPRFoundError) {
+			checkActivity.EndWithWarning(err)
+			skippedCount++
+			return
+		}
+		if err != nil {
+			checkActivity.EndWithFailure(err)
+			errorCount++
+			return
+		}
+		if pr.State != "OPEN" {
+			checkActivity.EndWithWarningf("PR is not open")
+			skippedCount++
+			return
+		}
+		var wrongBranchError *changes.WrongBranchError
+		if err := changes.CheckProfileBranch(checkActivity.Writer(), g, repoDirPath, dir.Name); errors.As(err, &wrongBranchError) {
+			checkActivity.EndWithWarning(err)
+			skippedCount++
+			return
+		} else if err != nil {
+			checkActivity.EndWithFailure(err)
+			errorCount++
+			return
+		}
+		checkActivity.EndWithSuccess()
+
+		refreshActivity := logger.StartActivity("Refreshing %s with %s", repo.FullRepoName, script.Command)
+		if err := refresh(refreshActivity, lifecycleHooks, rules, script, environment, limit, repo, repoDirPath, dir.Name); err != nil {
+			refreshActivity.EndWithFailure(err)
+			needsManualWork = append(needsManualWork, repo.FullRepoName)
+			return
+		}
+		refreshActivity.EndWithSuccess()
+		doneCount++
+	})
+
+	if err := lifecycleHooks.RunForCommand(logger, hooks.PostForeach); err != nil {
+		errorCount++
+	}
+
+	if len(needsManualWork) == 0 && errorCount == 0 {
+		logger.Successf("turbolift refresh completed %s(%s, %s)\n", colors.Normal(), colors.Green(doneCount, " OK"), colors.Yellow(skippedCount, " skipped"))
+	} else {
+		logger.Warnf("turbolift refresh completed with %s %s(%s, %s, %s, %s)\n", colors.Red("errors"), colors.Normal(), colors.Green(doneCount, " OK"), colors.Yellow(skippedCount, " skipped"), colors.Red(errorCount, " errored"), colors.Red(len(needsManualWork), " need manual work"))
+	}
+	if len(needsManualWork) > 0 {
+		logger.Println("These repositories still need manual work:")
+		for _, repoName := range needsManualWork {
+			logger.Println("  ", repoName)
+		}
+	}
+}
+
+// refresh merges the base branch into the campaign branch, runs the command again as foreach does, commits any changes
+// and pushes, unless they appear to contain secrets or a pre-push hook fails
+func refresh(activity *logging.Activity, lifecycleHooks *hooks.Hooks, rules []secrets.Rule, script campaign.ForeachCommand, environment executor.Environment, limit time.Duration, repo campaign.Repo, repoDirPath string, branchName string) error {
+	baseBranch, err := changes.BaseBranch(activity.Writer(), gh, repo)
+	if err != nil {
+		return err
+	}
+
+	baseRemote, err := changes.BaseRemote(activity.Writer(), g, repoDirPath)
+	if err != nil {
+		return err
+	}
+
+	if err := g.Fetch(activity.Writer(), repoDirPath, baseRemote, baseBranch); err != nil {
+		return err
+	}
+	if err := g.Merge(activity.Writer(), repoDirPath, baseRemote+"/"+baseBranch); err != nil {
+		return err
+	}
+
+	shellCommand, shellArgs, env, err := executor.ScriptInvocation(script.Container, repoDirPath, environment, script.Shell, script.Command)
+	if err != nil {
+		return err
+	}
+	if err := exec.ExecuteWithTimeout(activity.Writer(), repoDirPath, env, limit, shellCommand, shellArgs...); err != nil {
+		return err
+	}
+	if err := lifecycleHooks.RunForRepo(activity.Writer(), hooks.PostForeach, repo); err != nil {
+		return err
+	}
+
+	changed, err := g.IsRepoChanged(activity.Writer(), repoDirPath)
+	if err != nil {
+		return err
+	}
+	if changed {
+		if err := g.Commit(activity.Writer(), repoDirPath, message); err != nil {
+			return err
+		}
+	} else {
+		activity.Log("No further changes were made")
+	}
+
+	if !allowSecrets {
+		if err := secrets.CheckBranch(activity.Writer(), g, gh, repo, rules); err != nil {
+			return fmt.Errorf("not pushing: %w", err)
+		}
+	}
+	if err := lifecycleHooks.RunForRepo(activity.Writer(), hooks.PrePush, repo); err != nil {
+		return err
+	}
+	return g.Push(activity.Writer(), repoDirPath, "origin", branchName)
+}
@@ -0,0 +1,95 @@
+/*
+ * Copyright 2021 Skyscanner Limited.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * https://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package refreshmetadata
+
+import (
+	"github.com/spf13/cobra"
+
+	"github.com/skyscanner/turbolift/internal/campaign"
+	"github.com/skyscanner/turbolift/internal/colors"
+	"github.com/skyscanner/turbolift/internal/github"
+	"github.com/skyscanner/turbolift/internal/interrupt"
+	"github.com/skyscanner/turbolift/internal/logging"
+)
+
+var gh github.GitHub = github.NewGitHub()
+
+var repoFile string
+
+func NewRefreshMetadataCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "refresh-metadata",
+		Short: "Fetch the attributes of each repository, for narrowing the campaign down by them",
+		Long: `Fetch whether each repository is archived, its topics, primary language, when it was last pushed to and its
+default branch, and record them in ` + campaign.MetadataFilename + `. Other commands can then be limited to the
+repositories matching --only-topic, --only-language, --skip-archived and --pushed-since.`,
+		Args: cobra.NoArgs,
+		Run:  run,
+	}
+
+	cmd.Flags().StringVar(&repoFile, "repos", "repos.txt", "A file containing a list of repositories to fetch the metadata of.")
+
+	return cmd
+}
+
+func run(c *cobra.Command, _ []string) {
+	logger := logging.NewLogger(c)
+
+	readCampaignActivity := logger.StartSetupActivity("Reading campaign data (%s)", repoFile)
+	options := campaign.NewCampaignOptions()
+	options.RepoFilename = repoFile
+	options.Unfiltered = true
+	dir, err := campaign.OpenCampaign(options)
+	if err != nil {
+		readCampaignActivity.EndWithFailure(err)
+		return
+	}
+	metadata, err := campaign.ReadRepoMetadata()
+	if err != nil {
+		readCampaignActivity.EndWithFailure(err)
+		return
+	}
+	readCampaignActivity.EndWithSuccess()
+
+	doneCount := 0
+	errorCount := 0
+	interrupt.ForEachRepo(logger, dir.Repos, func(repo campaign.Repo) {
+		fetchActivity := logger.StartActivity("Fetching metadata of %s", repo.FullRepoName)
+		repoMetadata, err := gh.GetRepoMetadata(fetchActivity.Writer(), ".", repo.FullRepoName)
+		if err != nil {
+			fetchActivity.EndWithFailure(err)
+			errorCount++
+			return
+		}
+		metadata[repo.FullRepoName] = repoMetadata
+		fetchActivity.EndWithSuccess()
+		doneCount++
+	})
+
+	// the metadata fetched is kept even if some repositories failed, so that they can be retried on their own
+	writeActivity := logger.StartActivity("Writing %s", campaign.MetadataFilename)
+	if err := campaign.WriteRepoMetadata(metadata); err != nil {
+		writeActivity.EndWithFailure(err)
+		return
+	}
+	writeActivity.EndWithSuccess()
+
+	if errorCount == 0 {
+		logger.Successf("turbolift refresh-metadata completed %s(%s)\n", colors.Normal(), colors.Green(doneCount, " OK"))
+	} else {
+		logger.Warnf("turbolift refresh-metadata completed with %s %s(%s, %s)\n", colors.Red("errors"), colors.Normal(), colors.Green(doneCount, " OK"), colors.Red(errorCount, " errored"))
+	}
+}
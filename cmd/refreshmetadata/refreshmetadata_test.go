@@ -0,0 +1,97 @@
+/*
+ * Copyright 2021 Skyscanner Limited.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * https://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package refreshmetadata
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/skyscanner/turbolift/internal/campaign"
+	"github.com/skyscanner/turbolift/internal/github"
+	"github.com/skyscanner/turbolift/internal/testsupport"
+)
+
+func init() {
+	// disable output colouring so that strings we want to do 'Contains' checks on do not have ANSI escape sequences in IDEs
+	_ = os.Setenv("NO_COLOR", "1")
+}
+
+func TestItRecordsTheMetadataOfEachRepo(t *testing.T) {
+	fakeGitHub := github.NewAlwaysSucceedsFakeGitHub()
+	fakeGitHub.RepoMetadata = map[string]*github.RepoMetadata{
+		"org/repo1": {Topics: []string{"payments"}, Language: "Go", PushedAt: time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC), DefaultBranch: "main"},
+	}
+	gh = fakeGitHub
+
+	testsupport.PrepareTempCampaign(false, "org/repo1", "org/repo2")
+
+	out, err := runCommand()
+	assert.NoError(t, err)
+	assert.Contains(t, out, "turbolift refresh-metadata completed (2 OK)")
+
+	fakeGitHub.AssertCalledWith(t, [][]string{
+		{".", "org/repo1"},
+		{".", "org/repo2"},
+	})
+
+	metadata, err := campaign.ReadRepoMetadata()
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]*github.RepoMetadata{
+		"org/repo1": {Topics: []string{"payments"}, Language: "Go", PushedAt: time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC), DefaultBranch: "main"},
+		"org/repo2": {DefaultBranch: "main"},
+	}, metadata)
+}
+
+func TestItKeepsTheMetadataOfReposWhichCouldNotBeFetched(t *testing.T) {
+	gh = github.NewFakeGitHub(func(command github.Command, args []string) (bool, error) {
+		if args[1] == "org/repo2" {
+			return false, errors.New("synthetic error")
+		}
+		return true, nil
+	}, nil)
+
+	testsupport.PrepareTempCampaign(false, "org/repo1", "org/repo2")
+	assert.NoError(t, campaign.WriteRepoMetadata(map[string]*github.RepoMetadata{
+		"org/repo2": {Archived: true, DefaultBranch: "master"},
+	}))
+
+	out, err := runCommand()
+	assert.NoError(t, err)
+	assert.Contains(t, out, "turbolift refresh-metadata completed with errors (1 OK, 1 errored)")
+
+	metadata, err := campaign.ReadRepoMetadata()
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]*github.RepoMetadata{
+		"org/repo1": {DefaultBranch: "main"},
+		"org/repo2": {Archived: true, DefaultBranch: "master"},
+	}, metadata)
+}
+
+func runCommand() (string, error) {
+	cmd := NewRefreshMetadataCmd()
+	outBuffer := bytes.NewBufferString("")
+	cmd.SetOut(outBuffer)
+	err := cmd.Execute()
+	if err != nil {
+		return outBuffer.String(), err
+	}
+	return outBuffer.String(), nil
+}
@@ -0,0 +1,164 @@
+/*
+ * Copyright 2021 Skyscanner Limited.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * https://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package removerepo
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/skyscanner/turbolift/internal/campaign"
+	"github.com/skyscanner/turbolift/internal/colors"
+	"github.com/skyscanner/turbolift/internal/git"
+	"github.com/skyscanner/turbolift/internal/github"
+	"github.com/skyscanner/turbolift/internal/interrupt"
+	"github.com/skyscanner/turbolift/internal/logging"
+	"github.com/skyscanner/turbolift/internal/prompt"
+	"github.com/skyscanner/turbolift/internal/worktrees"
+)
+
+var (
+	gh github.GitHub = github.NewCachingGitHub(github.NewGitHub())
+	g  git.Git       = git.NewRealGit()
+	p  prompt.Prompt = prompt.NewRealPrompt()
+)
+
+var (
+	repoFile string
+	closePRs bool
+	comment  string
+)
+
+// removedReason is noted against each repository commented out of the repo file
+const removedReason = "removed from the campaign"
+
+func NewRemoveRepoCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "remove-repo REPO...",
+		Short: "Remove repositories from the campaign, deleting their working copies",
+		Long: `Remove repositories, given by their full names (e.g. org/repo), from the campaign: delete their working copies,
+comment them out of the repo file and forget what the campaign has recorded about them, such as their base branches.
+With --close-prs, any PR already opened for them is closed first.`,
+		Args: cobra.MinimumNArgs(1),
+		Run:  run,
+	}
+
+	cmd.Flags().StringVar(&repoFile, "repos", "repos.txt", "A file containing a list of repositories to remove the repositories from.")
+	cmd.Flags().BoolVar(&closePRs, "close-prs", false, "Close any PR already opened for the repositories.")
+	cmd.Flags().StringVar(&comment, "comment", "", "A comment to leave on each PR closed with --close-prs.")
+
+	return cmd
+}
+
+func run(c *cobra.Command, args []string) {
+	logger := logging.NewLogger(c)
+
+	if comment != "" && !closePRs {
+		logger.FlagErrorf("--comment can only be used with --close-prs")
+		return
+	}
+
+	readCampaignActivity := logger.StartSetupActivity("Reading campaign data (%s)", repoFile)
+	options := campaign.NewCampaignOptions()
+	options.RepoFilename = repoFile
+	// the repositories are named explicitly, so must be found whatever the filters
+	options.Unfiltered = true
+	dir, err := campaign.OpenCampaign(options)
+	if err != nil {
+		readCampaignActivity.EndWithFailure(err)
+		return
+	}
+	readCampaignActivity.EndWithSuccess()
+
+	campaignRepos := map[string]campaign.Repo{}
+	for _, repo := range dir.Repos {
+		campaignRepos[repo.FullRepoName] = repo
+	}
+	var repos []campaign.Repo
+	for _, name := range args {
+		repo, ok := campaignRepos[name]
+		if !ok {
+			logger.FlagErrorf("%s is not in the campaign's repo file %s", name, repoFile)
+			return
+		}
+		repos = append(repos, repo)
+	}
+
+	if !p.AskConfirm(prompt.RemoveWorkingCopies, fmt.Sprintf("Remove %d repositories from the campaign, deleting their working copies including any changes which have not been pushed?", len(repos))) {
+		logger.Warnf("turbolift remove-repo cancelled - no repositories were removed\n")
+		return
+	}
+
+	var removed []string
+	errorCount := 0
+	interrupt.ForEachRepo(logger, repos, func(repo campaign.Repo) {
+		repoDirPath := repo.FullRepoPath()
+		removeActivity := logger.StartActivity("Removing %s", repo.FullRepoName)
+
+		_, statErr := os.Stat(repoDirPath)
+		if closePRs && statErr == nil {
+			err := gh.ClosePullRequest(removeActivity.Writer(), repoDirPath, dir.Name, comment)
+			if _, ok := err.(*github.NoPRFoundError); ok {
+				removeActivity.Logf("No PR to close")
+			} else if err != nil {
+				// keep the working copy, so that closing the PR can be tried again
+				removeActivity.EndWithFailure(err)
+				errorCount++
+				return
+			}
+		}
+
+		if err := worktrees.RemoveWorkingCopy(removeActivity.Writer(), g, repoDirPath); err != nil {
+			removeActivity.EndWithFailure(err)
+			errorCount++
+			return
+		}
+		removed = append(removed, repo.FullRepoName)
+
+		if closePRs && os.IsNotExist(statErr) {
+			removeActivity.EndWithWarningf("Directory %s does not exist, so any PR has not been closed", repoDirPath)
+			return
+		}
+		removeActivity.EndWithSuccess()
+	})
+
+	if len(removed) > 0 {
+		repoFilename := campaign.ProfileFile(repoFile)
+		dropActivity := logger.StartActivity("Removing %d repositories from %s", len(removed), repoFilename)
+		notListed, err := campaign.DropRepos(repoFilename, removed, removedReason)
+		if err == nil {
+			err = campaign.ForgetRepos(removed)
+		}
+		if err != nil {
+			dropActivity.EndWithFailure(err)
+			errorCount++
+		} else if len(notListed) > 0 {
+			for _, repoName := range notListed {
+				dropActivity.Logf("%s is not listed individually, so remove it by hand", repoName)
+			}
+			dropActivity.EndWithWarningf("%d repositories could not be removed", len(notListed))
+		} else {
+			dropActivity.EndWithSuccess()
+		}
+	}
+
+	if errorCount == 0 {
+		logger.Successf("turbolift remove-repo completed %s(%s)\n", colors.Normal(), colors.Green(len(removed), " removed"))
+	} else {
+		logger.Warnf("turbolift remove-repo completed with %s %s(%s, %s)\n", colors.Red("errors"), colors.Normal(), colors.Green(len(removed), " removed"), colors.Red(errorCount, " errored"))
+	}
+}
@@ -0,0 +1,137 @@
+/*
+ * Copyright 2021 Skyscanner Limited.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * https://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package removerepo
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/skyscanner/turbolift/internal/campaign"
+	"github.com/skyscanner/turbolift/internal/github"
+	"github.com/skyscanner/turbolift/internal/prompt"
+	"github.com/skyscanner/turbolift/internal/testsupport"
+)
+
+func init() {
+	// disable output colouring so that strings we want to do 'Contains' checks on do not have ANSI escape sequences in IDEs
+	_ = os.Setenv("NO_COLOR", "1")
+}
+
+func TestItRemovesReposFromTheCampaign(t *testing.T) {
+	fakeGitHub := github.NewAlwaysSucceedsFakeGitHub()
+	gh = fakeGitHub
+	p = prompt.NewFakePromptYes()
+
+	testsupport.PrepareTempCampaign(true, "org/repo1", "org/repo2", "org/repo3")
+	assert.NoError(t, campaign.RecordBaseBranch(campaign.Repo{FullRepoName: "org/repo2"}, "main"))
+
+	out, err := runCommand("org/repo1", "org/repo2")
+	assert.NoError(t, err)
+	assert.Contains(t, out, "turbolift remove-repo completed (2 removed)")
+
+	assert.NoDirExists(t, "work/org/repo1")
+	assert.NoDirExists(t, "work/org/repo2")
+	assert.DirExists(t, "work/org/repo3")
+	contents, err := ioutil.ReadFile("repos.txt")
+	assert.NoError(t, err)
+	assert.Equal(t, "# org/repo1 (removed from the campaign)\n# org/repo2 (removed from the campaign)\norg/repo3", string(contents))
+	recorded, err := ioutil.ReadFile(campaign.BaseBranchesFilename)
+	assert.NoError(t, err)
+	assert.Empty(t, string(recorded))
+
+	// PRs are left alone unless asked
+	fakeGitHub.AssertCalledWith(t, [][]string{})
+}
+
+func TestItClosesPRsWhenAsked(t *testing.T) {
+	fakeGitHub := github.NewAlwaysSucceedsFakeGitHub()
+	gh = fakeGitHub
+	p = prompt.NewFakePromptYes()
+
+	testsupport.PrepareTempCampaign(true, "org/repo1", "org/repo2")
+
+	out, err := runCommand("org/repo1", "--close-prs", "--comment", "No longer needed")
+	assert.NoError(t, err)
+	assert.Contains(t, out, "turbolift remove-repo completed (1 removed)")
+
+	fakeGitHub.AssertCalledWith(t, [][]string{
+		{"work/org/repo1", testsupport.Pwd(), "No longer needed"},
+	})
+}
+
+func TestItKeepsTheRepoWhenItsPRCannotBeClosed(t *testing.T) {
+	gh = github.NewAlwaysFailsFakeGitHub()
+	p = prompt.NewFakePromptYes()
+
+	testsupport.PrepareTempCampaign(true, "org/repo1")
+
+	out, err := runCommand("org/repo1", "--close-prs")
+	assert.NoError(t, err)
+	assert.Contains(t, out, "turbolift remove-repo completed with errors (0 removed, 1 errored)")
+	assert.DirExists(t, "work/org/repo1")
+}
+
+func TestItRemovesReposWithoutPRs(t *testing.T) {
+	gh = github.NewAlwaysThrowNoPRFound()
+	p = prompt.NewFakePromptYes()
+
+	testsupport.PrepareTempCampaign(true, "org/repo1")
+
+	out, err := runCommand("org/repo1", "--close-prs")
+	assert.NoError(t, err)
+	assert.Contains(t, out, "turbolift remove-repo completed (1 removed)")
+}
+
+func TestItRejectsReposWhichAreNotInTheCampaign(t *testing.T) {
+	gh = github.NewAlwaysSucceedsFakeGitHub()
+	p = prompt.NewFakePromptYes()
+
+	testsupport.PrepareTempCampaign(true, "org/repo1")
+
+	out, err := runCommand("org/other")
+	assert.NoError(t, err)
+	assert.Contains(t, out, "org/other is not in the campaign's repo file repos.txt")
+	assert.DirExists(t, "work/org/repo1")
+}
+
+func TestItRemovesNothingWhenNotConfirmed(t *testing.T) {
+	gh = github.NewAlwaysSucceedsFakeGitHub()
+	p = prompt.NewFakePromptNo()
+
+	testsupport.PrepareTempCampaign(true, "org/repo1")
+
+	out, err := runCommand("org/repo1")
+	assert.NoError(t, err)
+	assert.Contains(t, out, "turbolift remove-repo cancelled")
+	assert.DirExists(t, "work/org/repo1")
+}
+
+func runCommand(args ...string) (string, error) {
+	cmd := NewRemoveRepoCmd()
+	closePRs, comment = false, ""
+	cmd.SetArgs(args)
+	outBuffer := bytes.NewBufferString("")
+	cmd.SetOut(outBuffer)
+	err := cmd.Execute()
+	if err != nil {
+		return outBuffer.String(), err
+	}
+	return outBuffer.String(), nil
+}
@@ -0,0 +1,140 @@
+/*
+ * Copyright 2021 Skyscanner Limited.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * https://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package renamecampaign
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/skyscanner/turbolift/internal/campaign"
+	"github.com/skyscanner/turbolift/internal/colors"
+	"github.com/skyscanner/turbolift/internal/git"
+	"github.com/skyscanner/turbolift/internal/github"
+	"github.com/skyscanner/turbolift/internal/interrupt"
+	"github.com/skyscanner/turbolift/internal/logging"
+)
+
+var (
+	gh github.GitHub = github.NewGitHub()
+	g  git.Git       = git.NewRealGit()
+)
+
+var repoFile string
+
+func NewRenameCampaignCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "rename-campaign NEW_NAME",
+		Short: "Rename the campaign, along with its branches and the campaign directory",
+		Long: `Rename the campaign: rename the campaign branch in every working copy and on each repository's origin
+(which also updates any open PRs from the branch), then rename the campaign directory itself.`,
+		Args: cobra.ExactArgs(1),
+		Run:  run,
+	}
+
+	cmd.Flags().StringVar(&repoFile, "repos", "repos.txt", "A file containing a list of repositories to rename the campaign branch in.")
+
+	return cmd
+}
+
+func validateName(name string) error {
+	if name == "" || name == "." || name == ".." || strings.ContainsAny(name, "/\\ \t~^:?*[") {
+		return fmt.Errorf("%s cannot be used as both a directory and a branch name", name)
+	}
+	return nil
+}
+
+func run(c *cobra.Command, args []string) {
+	logger := logging.NewLogger(c)
+	newName := args[0]
+
+	readCampaignActivity := logger.StartSetupActivity("Reading campaign data (%s)", repoFile)
+	if err := validateName(newName); err != nil {
+		readCampaignActivity.EndWithFailure(err)
+		return
+	}
+	if campaign.IsBranchOverridden() {
+		readCampaignActivity.EndWithFailure("rename-campaign can only rename campaigns whose branch is named after the campaign directory, not one given with --branch or in turbolift.yaml")
+		return
+	}
+	options := campaign.NewCampaignOptions()
+	options.RepoFilename = repoFile
+	dir, err := campaign.OpenCampaign(options)
+	if err != nil {
+		readCampaignActivity.EndWithFailure(err)
+		return
+	}
+	campaignDir, _ := os.Getwd()
+	newCampaignDir := filepath.Join(filepath.Dir(campaignDir), newName)
+	if _, err := os.Stat(newCampaignDir); err == nil {
+		readCampaignActivity.EndWithFailuref("%s already exists", newCampaignDir)
+		return
+	}
+	readCampaignActivity.EndWithSuccess()
+
+	doneCount := 0
+	skippedCount := 0
+	errorCount := 0
+	interrupt.ForEachRepo(logger, dir.Repos, func(repo campaign.Repo) {
+		repoDirPath := repo.FullRepoPath()
+
+		renameActivity := logger.StartActivity("Renaming branch %s to %s in %s", dir.Name, newName, repo.FullRepoName)
+		// skip if the working copy does not exist
+		if _, err = os.Stat(repoDirPath); os.IsNotExist(err) {
+			renameActivity.EndWithWarningf("Directory %s does not exist - has it been cloned?", repoDirPath)
+			skippedCount++
+			return
+		}
+
+		originRepoName, err := g.RemoteRepoName(renameActivity.Writer(), repoDirPath, "origin")
+		if err == nil {
+			err = gh.RenameBranch(renameActivity.Writer(), repoDirPath, originRepoName, dir.Name, newName)
+		}
+		if err == nil {
+			err = g.RenameBranch(renameActivity.Writer(), repoDirPath, dir.Name, newName)
+		}
+		if err == nil {
+			err = g.TrackRemoteBranch(renameActivity.Writer(), repoDirPath, "origin", newName)
+		}
+		if err != nil {
+			renameActivity.EndWithFailure(err)
+			errorCount++
+			return
+		}
+		renameActivity.EndWithSuccess()
+		doneCount++
+	})
+
+	if errorCount > 0 {
+		logger.Warnf("turbolift rename-campaign completed with %s %s(%s, %s, %s)\n", colors.Red("errors"), colors.Normal(), colors.Green(doneCount, " OK"), colors.Yellow(skippedCount, " skipped"), colors.Red(errorCount, " errored"))
+		logger.Warnf("The campaign directory has not been renamed, as branches in some repositories could not be renamed")
+		return
+	}
+
+	renameDirActivity := logger.StartActivity("Renaming campaign directory to %s", newName)
+	if err := os.Rename(campaignDir, newCampaignDir); err != nil {
+		renameDirActivity.EndWithFailure(err)
+		return
+	}
+	_ = os.Chdir(newCampaignDir)
+	renameDirActivity.EndWithSuccess()
+
+	logger.Successf("turbolift rename-campaign completed %s(%s, %s)\n", colors.Normal(), colors.Green(doneCount, " OK"), colors.Yellow(skippedCount, " skipped"))
+	logger.Printf("The campaign is now in %s - run %s to continue working on it", newCampaignDir, colors.Cyan("cd ../", newName))
+}
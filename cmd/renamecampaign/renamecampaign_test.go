@@ -0,0 +1,127 @@
+/*
+ * Copyright 2021 Skyscanner Limited.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * https://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package renamecampaign
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/skyscanner/turbolift/internal/campaign"
+	"github.com/skyscanner/turbolift/internal/git"
+	"github.com/skyscanner/turbolift/internal/github"
+	"github.com/skyscanner/turbolift/internal/testsupport"
+)
+
+func init() {
+	// disable output colouring so that strings we want to do 'Contains' checks on do not have ANSI escape sequences in IDEs
+	_ = os.Setenv("NO_COLOR", "1")
+}
+
+func TestItRenamesBranchesAndTheCampaignDirectory(t *testing.T) {
+	fakeGitHub := github.NewAlwaysSucceedsFakeGitHub()
+	gh = fakeGitHub
+	fakeGit := git.NewAlwaysSucceedsFakeGit()
+	g = fakeGit
+
+	tempDir := testsupport.PrepareTempCampaign(true, "org/repo1", "org/repo2")
+	oldName := filepath.Base(tempDir)
+	newName := oldName + "-renamed"
+	defer func() { _ = os.RemoveAll(filepath.Join(filepath.Dir(tempDir), newName)) }()
+
+	out, err := runCommand(newName)
+	assert.NoError(t, err)
+	assert.Contains(t, out, "turbolift rename-campaign completed (2 OK, 0 skipped)")
+
+	assert.Equal(t, newName, testsupport.Pwd())
+	_, err = os.Stat(tempDir)
+	assert.True(t, os.IsNotExist(err))
+
+	fakeGitHub.AssertCalledWith(t, [][]string{
+		{"work/org/repo1", "org/repo1", oldName, newName},
+		{"work/org/repo2", "org/repo2", oldName, newName},
+	})
+	fakeGit.AssertCalledWith(t, [][]string{
+		{"remoteRepoName", "work/org/repo1", "origin"},
+		{"renameBranch", "work/org/repo1", oldName, newName},
+		{"trackRemoteBranch", "work/org/repo1", "origin", newName},
+		{"remoteRepoName", "work/org/repo2", "origin"},
+		{"renameBranch", "work/org/repo2", oldName, newName},
+		{"trackRemoteBranch", "work/org/repo2", "origin", newName},
+	})
+}
+
+func TestItDoesNotRenameTheCampaignDirectoryWhenBranchesCannotBeRenamed(t *testing.T) {
+	gh = github.NewAlwaysFailsFakeGitHub()
+	fakeGit := git.NewAlwaysSucceedsFakeGit()
+	g = fakeGit
+
+	tempDir := testsupport.PrepareTempCampaign(true, "org/repo1")
+
+	out, err := runCommand(filepath.Base(tempDir) + "-renamed")
+	assert.NoError(t, err)
+	assert.Contains(t, out, "turbolift rename-campaign completed with errors")
+	assert.Contains(t, out, "The campaign directory has not been renamed")
+
+	assert.Equal(t, filepath.Base(tempDir), testsupport.Pwd())
+	fakeGit.AssertCalledWith(t, [][]string{
+		{"remoteRepoName", "work/org/repo1", "origin"},
+	})
+}
+
+func TestItRejectsNamesWhichCannotBeBranchesAndDirectories(t *testing.T) {
+	fakeGitHub := github.NewAlwaysSucceedsFakeGitHub()
+	gh = fakeGitHub
+
+	testsupport.PrepareTempCampaign(true, "org/repo1")
+
+	out, err := runCommand("new/name")
+	assert.NoError(t, err)
+	assert.Contains(t, out, "new/name cannot be used as both a directory and a branch name")
+
+	fakeGitHub.AssertCalledWith(t, [][]string{})
+}
+
+func TestItDoesNotRenameCampaignsWithAGivenBranch(t *testing.T) {
+	fakeGitHub := github.NewAlwaysSucceedsFakeGitHub()
+	gh = fakeGitHub
+	campaign.UseBranch("chore/upgrade-logging")
+	defer campaign.UseBranch("")
+
+	tempDir := testsupport.PrepareTempCampaign(true, "org/repo1")
+
+	out, err := runCommand(filepath.Base(tempDir) + "-renamed")
+	assert.NoError(t, err)
+	assert.Contains(t, out, "rename-campaign can only rename campaigns whose branch is named after the campaign directory")
+	assert.Equal(t, filepath.Base(tempDir), testsupport.Pwd())
+
+	fakeGitHub.AssertCalledWith(t, [][]string{})
+}
+
+func runCommand(newName string) (string, error) {
+	cmd := NewRenameCampaignCmd()
+	cmd.SetArgs([]string{newName})
+	outBuffer := bytes.NewBufferString("")
+	cmd.SetOut(outBuffer)
+	err := cmd.Execute()
+	if err != nil {
+		return outBuffer.String(), err
+	}
+	return outBuffer.String(), nil
+}
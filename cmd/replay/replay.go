@@ -0,0 +1,267 @@
+/*
+ * Copyright 2021 Skyscanner Limited.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * https://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package replay
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/skyscanner/turbolift/internal/audit"
+	"github.com/skyscanner/turbolift/internal/colors"
+	"github.com/skyscanner/turbolift/internal/github"
+	"github.com/skyscanner/turbolift/internal/interrupt"
+	"github.com/skyscanner/turbolift/internal/logging"
+)
+
+var gh github.GitHub = github.NewGitHub()
+
+var (
+	host   string
+	dryRun bool
+)
+
+// ReplayFailedFilename is the replay file that the operations which failed or were not reached are written to, so that
+// they can be retried
+const ReplayFailedFilename = "replay_failed.jsonl"
+
+func NewReplayCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "replay REPLAY_FILE",
+		Short: "Carry out the operations recorded with --record again, optionally on another host",
+		Long: `Carry out the PR, issue and label operations recorded in a replay file with --record again, in the order
+they were recorded. PRs are found by their branch, so the campaign's branches must already exist on the host. With
+--host, the operations are carried out on that GitHub host instead, e.g. to repeat a rehearsal on a staging
+host in production.`,
+		Args: cobra.ExactArgs(1),
+		Run:  run,
+	}
+
+	cmd.Flags().StringVar(&host, "host", "", "The GitHub host to carry out the operations on, instead of the host of each working copy.")
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "Only show the operations that would be carried out.")
+
+	return cmd
+}
+
+func run(c *cobra.Command, args []string) {
+	logger := logging.NewLogger(c)
+
+	readActivity := logger.StartActivity("Reading replay file %s", args[0])
+	entries, err := github.ReadReplayFile(args[0])
+	if err != nil {
+		readActivity.EndWithFailure(err)
+		return
+	}
+	readActivity.EndWithSuccess()
+
+	if host != "" {
+		restore := setEnv("GH_HOST", host)
+		defer restore()
+	}
+
+	doneCount := 0
+	errorCount := 0
+	var failed []github.ReplayEntry
+
+	for i, entry := range entries {
+		if interrupt.Requested() {
+			logger.Warnf("Interrupted - %d operations were not replayed", len(entries)-i)
+			failed = append(failed, entries[i:]...)
+			break
+		}
+
+		description := describe(entry)
+		if dryRun {
+			logger.Printf("Would %s", description)
+			continue
+		}
+
+		replayActivity := logger.StartActivity("%s", strings.ToUpper(description[:1])+description[1:])
+		if err := replayEntry(replayActivity.Writer(), entry); err != nil {
+			replayActivity.EndWithFailure(err)
+			failed = append(failed, entry)
+			errorCount++
+			continue
+		}
+		replayActivity.EndWithSuccess()
+		doneCount++
+	}
+
+	if len(failed) > 0 {
+		writeFailed(logger, failed)
+	}
+
+	if dryRun {
+		logger.Successf("turbolift replay dry run completed - nothing was changed\n")
+	} else if errorCount == 0 {
+		logger.Successf("turbolift replay completed %s(%s)\n", colors.Normal(), colors.Green(doneCount, " OK"))
+	} else {
+		logger.Warnf("turbolift replay completed with %s %s(%s, %s)\n", colors.Red("errors"), colors.Normal(), colors.Green(doneCount, " OK"), colors.Red(errorCount, " errored"))
+	}
+}
+
+// describe says what an operation does, e.g. "create a PR in org/repo"
+func describe(entry github.ReplayEntry) string {
+	repo := repoOf(entry)
+	switch entry.Operation {
+	case github.OpCreatePullRequest:
+		return fmt.Sprintf("create a PR in %s", repo)
+	case github.OpClosePullRequest:
+		return fmt.Sprintf("close the PR from %s in %s", entry.Branch, repo)
+	case github.OpUpdatePRDescription:
+		return fmt.Sprintf("update the description of the PR from %s in %s", entry.Branch, repo)
+	case github.OpCommentOnPullRequest:
+		return fmt.Sprintf("comment on the PR from %s in %s", entry.Branch, repo)
+	case github.OpReviewPullRequest:
+		return fmt.Sprintf("review the PR from %s in %s", entry.Branch, repo)
+	case github.OpRenameBranch:
+		return fmt.Sprintf("rename branch %s to %s in %s", entry.Branch, entry.NewBranch, repo)
+	case github.OpMergePullRequest:
+		return fmt.Sprintf("merge the PR from %s in %s", entry.Branch, repo)
+	case github.OpEnqueuePullRequest:
+		return fmt.Sprintf("add the PR from %s in %s to the merge queue", entry.Branch, repo)
+	case github.OpEnableAutoMerge:
+		return fmt.Sprintf("enable auto-merge of the PR from %s in %s", entry.Branch, repo)
+	case github.OpRevertPullRequest:
+		return fmt.Sprintf("revert the PR from %s in %s", entry.Branch, repo)
+	case github.OpCreateIssue:
+		return fmt.Sprintf("open an issue in %s", repo)
+	case github.OpEnsureLabel:
+		return fmt.Sprintf("create label %s in %s", entry.Label.Name, repo)
+	case github.OpUpdatePRLabels:
+		return fmt.Sprintf("update the labels of the PR from %s in %s", entry.Branch, repo)
+	default:
+		return fmt.Sprintf("%s in %s", entry.Operation, repo)
+	}
+}
+
+func replayEntry(output io.Writer, entry github.ReplayEntry) error {
+	if _, err := os.Stat(entry.Dir); os.IsNotExist(err) {
+		return fmt.Errorf("directory %s does not exist - has it been cloned?", entry.Dir)
+	}
+	if repo := audit.RepoOf(entry.Dir); host != "" && repo != "" {
+		// gh otherwise works on the repository of the working copy's remotes, which are on the original host
+		restore := setEnv("GH_REPO", onHost(repo))
+		defer restore()
+	}
+
+	switch entry.Operation {
+	case github.OpCreatePullRequest:
+		pr := *entry.PullRequest
+		pr.UpstreamRepo = onHost(pr.UpstreamRepo)
+		didCreate, err := gh.CreatePullRequest(output, entry.Dir, pr)
+		if err == nil && !didCreate {
+			return fmt.Errorf("no PR was created, as there are no changes between its branches")
+		}
+		return err
+	case github.OpClosePullRequest:
+		return gh.ClosePullRequest(output, entry.Dir, entry.Branch, entry.Body)
+	case github.OpUpdatePRDescription:
+		return gh.UpdatePRDescription(output, entry.Dir, entry.Branch, entry.Title, entry.Body)
+	case github.OpCommentOnPullRequest:
+		return gh.CommentOnPullRequest(output, entry.Dir, entry.Branch, entry.Body)
+	case github.OpReviewPullRequest:
+		return gh.ReviewPullRequest(output, entry.Dir, entry.Branch, entry.Approve, entry.Body)
+	case github.OpRenameBranch:
+		return gh.RenameBranch(output, entry.Dir, onHost(entry.FullRepoName), entry.Branch, entry.NewBranch)
+	case github.OpMergePullRequest, github.OpEnqueuePullRequest, github.OpEnableAutoMerge, github.OpRevertPullRequest:
+		pr, err := gh.GetPR(output, entry.Dir, entry.Branch)
+		if err != nil {
+			return err
+		}
+		switch entry.Operation {
+		case github.OpMergePullRequest:
+			return gh.MergePullRequest(output, entry.Dir, pr, entry.Method)
+		case github.OpEnqueuePullRequest:
+			_, err = gh.EnqueuePullRequest(output, entry.Dir, pr)
+			return err
+		case github.OpEnableAutoMerge:
+			return gh.EnableAutoMerge(output, entry.Dir, pr, entry.Method)
+		default:
+			_, err = gh.RevertPullRequest(output, entry.Dir, pr)
+			return err
+		}
+	case github.OpCreateIssue:
+		issue := *entry.Issue
+		issue.Repo = onHost(issue.Repo)
+		_, err := gh.CreateIssue(output, entry.Dir, issue)
+		return err
+	case github.OpEnsureLabel:
+		_, err := gh.EnsureLabel(output, entry.Dir, onHost(entry.FullRepoName), *entry.Label)
+		return err
+	case github.OpUpdatePRLabels:
+		return gh.UpdatePRLabels(output, entry.Dir, entry.Branch, entry.Add, entry.Remove)
+	default:
+		return fmt.Errorf("unknown operation %s", entry.Operation)
+	}
+}
+
+// repoOf is the repository an operation was carried out in
+func repoOf(entry github.ReplayEntry) string {
+	switch {
+	case entry.PullRequest != nil && entry.PullRequest.UpstreamRepo != "":
+		return entry.PullRequest.UpstreamRepo
+	case entry.Issue != nil && entry.Issue.Repo != "":
+		return entry.Issue.Repo
+	case entry.FullRepoName != "":
+		return entry.FullRepoName
+	default:
+		return audit.RepoOf(entry.Dir)
+	}
+}
+
+// onHost returns a repository given as org/repo or host/org/repo as one on the --host, if it is given
+func onHost(fullRepoName string) string {
+	if host == "" || fullRepoName == "" {
+		return fullRepoName
+	}
+	parts := strings.Split(fullRepoName, "/")
+	if len(parts) == 3 {
+		parts = parts[1:]
+	}
+	return host + "/" + strings.Join(parts, "/")
+}
+
+// setEnv sets an environment variable, returning a function which restores its previous value
+func setEnv(name string, value string) func() {
+	previous, wasSet := os.LookupEnv(name)
+	_ = os.Setenv(name, value)
+	return func() {
+		if wasSet {
+			_ = os.Setenv(name, previous)
+		} else {
+			_ = os.Unsetenv(name)
+		}
+	}
+}
+
+func writeFailed(logger *logging.Logger, entries []github.ReplayEntry) {
+	var lines []string
+	for _, entry := range entries {
+		line, _ := json.Marshal(entry)
+		lines = append(lines, string(line))
+	}
+	if err := ioutil.WriteFile(ReplayFailedFilename, []byte(strings.Join(lines, "\n")+"\n"), 0o644); err != nil {
+		logger.Warnf("%d operations were not replayed, but they could not be written to %s: %v", len(entries), ReplayFailedFilename, err)
+		return
+	}
+	logger.Warnf("%d operations were not replayed. To retry them, use %s", len(entries), colors.Cyan("turbolift replay ", ReplayFailedFilename))
+}
@@ -0,0 +1,104 @@
+/*
+ * Copyright 2021 Skyscanner Limited.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * https://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package replay
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/skyscanner/turbolift/internal/github"
+	"github.com/skyscanner/turbolift/internal/testsupport"
+)
+
+const replayFile = `{"operation":"create-pull-request","dir":"work/org/repo1","pullRequest":{"Title":"PR title","UpstreamRepo":"org/repo1"}}
+{"operation":"merge-pull-request","dir":"work/org/repo1","branch":"campaign","method":"squash"}
+{"operation":"close-pull-request","dir":"work/org/repo2","branch":"campaign"}
+`
+
+func TestItReplaysTheRecordedOperationsInOrder(t *testing.T) {
+	fakeGitHub := github.NewAlwaysSucceedsFakeGitHub()
+	gh = fakeGitHub
+
+	testsupport.PrepareTempCampaign(true, "org/repo1", "org/repo2")
+	assert.NoError(t, ioutil.WriteFile("replay.jsonl", []byte(replayFile), 0o644))
+
+	out, err := runCommand("replay.jsonl")
+	assert.NoError(t, err)
+	assert.Contains(t, out, "Create a PR in org/repo1")
+	assert.Contains(t, out, "Merge the PR from campaign in org/repo1")
+	assert.Contains(t, out, "turbolift replay completed (3 OK)")
+
+	assert.Equal(t, []github.PullRequest{{Title: "PR title", UpstreamRepo: "org/repo1"}}, fakeGitHub.PullRequests)
+	fakeGitHub.AssertCalledWith(t, [][]string{
+		{"work/org/repo1", "PR title"},
+		{"work/org/repo1"},
+		{"work/org/repo1", "squash"},
+		{"work/org/repo2", "campaign"},
+	})
+}
+
+func TestItReplaysOnAnotherHost(t *testing.T) {
+	fakeGitHub := github.NewAlwaysSucceedsFakeGitHub()
+	gh = fakeGitHub
+
+	testsupport.PrepareTempCampaign(true, "org/repo1", "org/repo2")
+	assert.NoError(t, ioutil.WriteFile("replay.jsonl", []byte(replayFile), 0o644))
+
+	_, err := runCommand("replay.jsonl", "--host", "github.staging.example.com")
+	assert.NoError(t, err)
+
+	assert.Equal(t, "github.staging.example.com/org/repo1", fakeGitHub.PullRequests[0].UpstreamRepo)
+	_, set := os.LookupEnv("GH_REPO")
+	assert.False(t, set)
+}
+
+func TestItWritesTheOperationsWhichFailedToRetry(t *testing.T) {
+	gh = github.NewFakeGitHub(func(command github.Command, args []string) (bool, error) {
+		if command == github.ClosePullRequest {
+			return false, errors.New("synthetic error")
+		}
+		return true, nil
+	}, func(string) (interface{}, error) {
+		return &github.PrStatus{}, nil
+	})
+
+	testsupport.PrepareTempCampaign(true, "org/repo1", "org/repo2")
+	assert.NoError(t, ioutil.WriteFile("replay.jsonl", []byte(replayFile), 0o644))
+
+	out, err := runCommand("replay.jsonl")
+	assert.NoError(t, err)
+	assert.Contains(t, out, "turbolift replay completed with errors (2 OK, 1 errored)")
+	assert.Contains(t, out, "To retry them, use turbolift replay "+ReplayFailedFilename)
+
+	failed, err := github.ReadReplayFile(ReplayFailedFilename)
+	assert.NoError(t, err)
+	assert.Len(t, failed, 1)
+	assert.Equal(t, github.OpClosePullRequest, failed[0].Operation)
+}
+
+func runCommand(args ...string) (string, error) {
+	cmd := NewReplayCmd()
+	outBuffer := bytes.NewBufferString("")
+	cmd.SetOut(outBuffer)
+	cmd.SetArgs(args)
+	err := cmd.Execute()
+	return outBuffer.String(), err
+}
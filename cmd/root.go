@@ -16,19 +16,70 @@
 package cmd
 
 import (
+	"errors"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
 
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
 
+	addRepoCmd "github.com/skyscanner/turbolift/cmd/addrepo"
+	applyCmd "github.com/skyscanner/turbolift/cmd/apply"
+	approveCmd "github.com/skyscanner/turbolift/cmd/approve"
+	archiveCmd "github.com/skyscanner/turbolift/cmd/archive"
+	backportCmd "github.com/skyscanner/turbolift/cmd/backport"
+	blockersCmd "github.com/skyscanner/turbolift/cmd/blockers"
+	checkoutCmd "github.com/skyscanner/turbolift/cmd/checkout"
 	cloneCmd "github.com/skyscanner/turbolift/cmd/clone"
+	closeStaleCmd "github.com/skyscanner/turbolift/cmd/closestale"
 	commitCmd "github.com/skyscanner/turbolift/cmd/commit"
+	conflictsCmd "github.com/skyscanner/turbolift/cmd/conflicts"
 	createPrsCmd "github.com/skyscanner/turbolift/cmd/create_prs"
+	createIssuesCmd "github.com/skyscanner/turbolift/cmd/createissues"
+	diffCmd "github.com/skyscanner/turbolift/cmd/diff"
+	discoverCmd "github.com/skyscanner/turbolift/cmd/discover"
+	doctorCmd "github.com/skyscanner/turbolift/cmd/doctor"
+	duCmd "github.com/skyscanner/turbolift/cmd/du"
 	"github.com/skyscanner/turbolift/cmd/flags"
 	foreachCmd "github.com/skyscanner/turbolift/cmd/foreach"
 	initCmd "github.com/skyscanner/turbolift/cmd/init"
+	mergeCmd "github.com/skyscanner/turbolift/cmd/merge"
 	prStatusCmd "github.com/skyscanner/turbolift/cmd/prstatus"
+	pruneCmd "github.com/skyscanner/turbolift/cmd/prune"
+	rateLimitCmd "github.com/skyscanner/turbolift/cmd/ratelimit"
+	rebaseCmd "github.com/skyscanner/turbolift/cmd/rebase"
+	recreatePrsCmd "github.com/skyscanner/turbolift/cmd/recreateprs"
+	refreshCmd "github.com/skyscanner/turbolift/cmd/refresh"
+	refreshMetadataCmd "github.com/skyscanner/turbolift/cmd/refreshmetadata"
+	removeRepoCmd "github.com/skyscanner/turbolift/cmd/removerepo"
+	renameCampaignCmd "github.com/skyscanner/turbolift/cmd/renamecampaign"
+	replayCmd "github.com/skyscanner/turbolift/cmd/replay"
+	serveCmd "github.com/skyscanner/turbolift/cmd/serve"
+	splitPrsCmd "github.com/skyscanner/turbolift/cmd/splitprs"
+	syncCmd "github.com/skyscanner/turbolift/cmd/sync"
+	transformCmd "github.com/skyscanner/turbolift/cmd/transform"
+	undoCmd "github.com/skyscanner/turbolift/cmd/undo"
 	updatePrsCmd "github.com/skyscanner/turbolift/cmd/updateprs"
+	upgradeCmd "github.com/skyscanner/turbolift/cmd/upgrade"
+	"github.com/skyscanner/turbolift/internal/audit"
+	"github.com/skyscanner/turbolift/internal/campaign"
+	"github.com/skyscanner/turbolift/internal/colors"
+	"github.com/skyscanner/turbolift/internal/config"
+	"github.com/skyscanner/turbolift/internal/executor"
+	"github.com/skyscanner/turbolift/internal/github"
+	"github.com/skyscanner/turbolift/internal/history"
+	"github.com/skyscanner/turbolift/internal/interrupt"
+	"github.com/skyscanner/turbolift/internal/lock"
+	"github.com/skyscanner/turbolift/internal/logging"
+	"github.com/skyscanner/turbolift/internal/metrics"
+	"github.com/skyscanner/turbolift/internal/notify"
+	"github.com/skyscanner/turbolift/internal/prompt"
 )
 
 var (
@@ -38,27 +89,360 @@ var (
 )
 
 var rootCmd = &cobra.Command{
-	Use:              "turbolift",
-	Short:            "Turbolift",
-	Long:             `Mass refactoring tool for repositories in GitHub`,
-	Version:          fmt.Sprintf("%s (%s, built %s)", version, commit, date),
-	TraverseChildren: true,
+	Use:                "turbolift",
+	Short:              "Turbolift",
+	Long:               `Mass refactoring tool for repositories in GitHub`,
+	Version:            fmt.Sprintf("%s (%s, built %s)", version, commit, date),
+	TraverseChildren:   true,
+	PersistentPreRunE:  applyConfig,
+	PersistentPostRunE: finish,
+}
+
+// timedOutReposFilename is the repo file listing the repositories in which a process was killed by --timeout
+const timedOutReposFilename = "timed_out.txt"
+
+var (
+	cfg        = &config.Config{}
+	transcript io.Closer
+	started    time.Time
+)
+
+func applyConfig(c *cobra.Command, args []string) error {
+	started = time.Now()
+	var err error
+	cfg, err = config.Load()
+	if err != nil {
+		return err
+	}
+	if c.DisableFlagParsing {
+		// foreach parses its own flags, but the variant decides which working copies it runs in
+		flags.Variant = variantArg(args)
+	}
+	if flags.Variant == allVariants {
+		// each variant is run separately, which sets up everything else
+		return runForAllVariants(c)
+	}
+	if flags.Variant != "" {
+		if err := selectVariant(); err != nil {
+			return err
+		}
+	}
+	if err := cfg.ApplyDefaults(c); err != nil {
+		return err
+	}
+	campaign.UseBranch(cfg.Branch)
+
+	if flags.Verbose && flags.Quiet {
+		return errors.New("only one of --verbose and --quiet can be used")
+	}
+	if flags.Yes && flags.No {
+		return errors.New("only one of --yes and --no can be used")
+	}
+	if err := prompt.SetDefaults(cfg.Prompts); err != nil {
+		return err
+	}
+
+	if flags.LogFile != "" {
+		transcript, err = logging.OpenTranscript(flags.LogFile, "turbolift "+strings.Join(os.Args[1:], " "))
+		if err != nil {
+			return err
+		}
+	}
+
+	colorMode := cfg.Color
+	if flags.NoColor || os.Getenv("NO_COLOR") != "" {
+		colorMode = "never"
+	}
+	if err := colors.SetMode(colorMode); err != nil {
+		return err
+	}
+	if err := colors.SetTheme(cfg.Theme); err != nil {
+		return err
+	}
+
+	if inCampaignDirectory(c) {
+		audit.Start("turbolift " + strings.Join(os.Args[1:], " "))
+	}
+	interrupt.Watch(c.ErrOrStderr())
+	interrupt.OnExit(abandon)
+
+	for name, path := range cfg.Binaries {
+		executor.SetBinaryPath(name, path)
+	}
+	executor.SetTimeout(flags.Timeout)
+
+	if flags.Record != "" {
+		github.SetRecording(flags.Record)
+	}
+
+	if flags.Offline != "" {
+		if err := github.SetOffline(flags.Offline, campaign.WorkDir()); err != nil {
+			return err
+		}
+		// responses cached from GitHub must not be mixed up with the offline forge
+		flags.NoCache = true
+	}
+
+	if err := cfg.ApplyEnvironment(); err != nil {
+		return err
+	}
+	return acquireLock(c)
+}
+
+// inCampaignDirectory reports whether a command which works on a campaign is run in a campaign directory, which holds
+// its repo file. Commands such as init and doctor can be run anywhere, where they must leave no files behind.
+func inCampaignDirectory(c *cobra.Command) bool {
+	if c.Flags().Lookup("repos") == nil {
+		return false
+	}
+	_, err := os.Stat(campaign.NewCampaignOptions().RepoFilename)
+	return err == nil
+}
+
+// readOnlyCommands are the campaign commands which only look at the campaign, and so can run alongside a command
+// which is changing it
+var readOnlyCommands = map[string]bool{
+	"blockers":   true,
+	"conflicts":  true,
+	"diff":       true,
+	"doctor":     true,
+	"du":         true,
+	"pr-status":  true,
+	"rate-limit": true,
+	"serve":      true,
+}
+
+// acquireLock stops two commands from changing the same campaign at once, such as two teammates creating PRs at the
+// same time
+func acquireLock(c *cobra.Command) error {
+	if c.Flags().Lookup("repos") == nil || readOnlyCommands[c.Name()] {
+		return nil
+	}
+	broken, err := lock.Acquire("turbolift "+strings.Join(os.Args[1:], " "), flags.ForceUnlock)
+	if err != nil {
+		return err
+	}
+	if broken != nil {
+		logging.NewLogger(c).Warnf("Broke the lock held by %s", broken)
+	}
+	return nil
+}
+
+func finish(c *cobra.Command, args []string) error {
+	if flags.Variant == allVariants {
+		// each variant's run has already finished up after itself
+		return nil
+	}
+	reportTimeouts(c)
+	if flags.Timing {
+		logging.NewLogger(c).Printf("Total time: %s", logging.FormatDuration(time.Since(started)))
+	}
+	sendNotification(c, args)
+	sendMetrics(c)
+	writeSummary(c, args)
+	if err := lock.Release(); err != nil {
+		c.PrintErrf("Unable to remove %s: %v\n", lock.Filename, err)
+	}
+
+	if flags.Actions {
+		if err := reportToActions(c); err != nil {
+			return err
+		}
+	}
+
+	if err := audit.Stop(); err != nil {
+		return err
+	}
+
+	if transcript != nil {
+		return logging.CloseTranscript(transcript)
+	}
+	return nil
+}
+
+// abandon releases the lock and closes the audit log and transcript when a second interrupt stops turbolift before
+// finish can
+func abandon() {
+	_ = lock.Release()
+	_ = audit.Stop()
+	if transcript != nil {
+		_ = logging.CloseTranscript(transcript)
+	}
+}
+
+// reportTimeouts writes the repositories in which a process timed out to a repo file, so that they can be retried
+func reportTimeouts(c *cobra.Command) {
+	var repos []string
+	seen := map[string]bool{}
+	for _, dir := range executor.TimedOut() {
+		if repo := audit.RepoOf(dir); repo != "" && !seen[repo] {
+			seen[repo] = true
+			repos = append(repos, repo)
+		}
+	}
+	if len(repos) == 0 {
+		return
+	}
+
+	logger := logging.NewLogger(c)
+	if err := ioutil.WriteFile(timedOutReposFilename, []byte(strings.Join(repos, "\n")+"\n"), 0o644); err != nil {
+		logger.Warnf("Processes timed out in %d repositories, but they could not be written to %s: %v", len(repos), timedOutReposFilename, err)
+		return
+	}
+	logger.Warnf("Processes timed out in %d repositories. To retry them, use %s", len(repos), colors.Cyan("--repos ", timedOutReposFilename))
+}
+
+func sendNotification(c *cobra.Command, _ []string) {
+	if cfg.NotificationWebhook == "" {
+		return
+	}
+
+	dir, _ := os.Getwd()
+	message := notificationMessage(c.Name(), filepath.Base(dir), logging.CurrentResults())
+	if err := notify.Send(cfg.NotificationWebhook, message); err != nil {
+		c.PrintErrln(err)
+	}
+}
+
+// notificationMessage says how a command went for a campaign, judging it the same way as the code turbolift exits with
+func notificationMessage(command string, campaignName string, results logging.Results) string {
+	counts := fmt.Sprintf("%d OK, %d warnings, %d failed",
+		results.Succeeded, len(results.Warnings), len(results.Failures)+results.Errors)
+
+	switch exitCode(nil, results) {
+	case exitSuccess:
+		return fmt.Sprintf("turbolift %s completed for campaign %s (%s)", command, campaignName, counts)
+	case exitPartialFailure:
+		return fmt.Sprintf("turbolift %s partially failed for campaign %s (%s)", command, campaignName, counts)
+	case exitInvalidUsage:
+		return fmt.Sprintf("turbolift %s could not start for campaign %s because of its flags, arguments or configuration", command, campaignName)
+	default:
+		return fmt.Sprintf("turbolift %s failed for campaign %s (%s)", command, campaignName, counts)
+	}
+}
+
+// sendMetrics reports the run to the configured statsd server or OpenTelemetry collector, for monitoring campaigns
+// centrally. Being unable to reach them does not fail the command.
+func sendMetrics(c *cobra.Command) {
+	if cfg.Metrics.Statsd == "" && cfg.Metrics.OTLP == "" {
+		return
+	}
+
+	dir, _ := os.Getwd()
+	results := logging.CurrentResults()
+	run := metrics.Run{
+		Command:   c.Name(),
+		Campaign:  filepath.Base(dir),
+		Duration:  time.Since(started),
+		Succeeded: results.Succeeded,
+		Warnings:  len(results.Warnings),
+		Failed:    len(results.Failures) + results.Errors,
+	}
+	if err := metrics.Send(cfg.Metrics, run); err != nil {
+		c.PrintErrln(err)
+	}
+}
+
+// writeSummary adds a summary of a campaign command to the campaign's execution history
+func writeSummary(c *cobra.Command, args []string) {
+	if c.Flags().Lookup("repos") == nil {
+		// not a command which works on a campaign
+		return
+	}
+
+	results := logging.CurrentResults()
+	var repos []string
+	for _, repo := range commandRepos(c) {
+		repos = append(repos, repo.FullRepoName)
+	}
+	run := history.NewRun(c.CommandPath(), started, results, repos)
+	run.Args = audit.Redact(args)
+	run.ExitCode = exitCode(nil, results)
+	recordFlag := func(f *pflag.Flag) {
+		if run.Flags == nil {
+			run.Flags = map[string]string{}
+		}
+		run.Flags[f.Name] = audit.Redact([]string{"--" + f.Name, f.Value.String()})[1]
+	}
+	// global flags given before the command's name are parsed by the root command
+	c.Root().Flags().Visit(recordFlag)
+	c.Flags().Visit(recordFlag)
+
+	filename := campaign.StatePath(history.Filename)
+	if err := history.Append(filename, run); err != nil {
+		c.PrintErrf("Unable to write %s: %v\n", filename, err)
+	}
 }
 
 func init() {
-	rootCmd.PersistentFlags().BoolVarP(&flags.Verbose, "verbose", "v", false, "verbose output")
+	rootCmd.PersistentFlags().BoolVarP(&flags.Verbose, "verbose", "v", false, "verbose output, including the output of git and gh inline")
+	rootCmd.PersistentFlags().BoolVarP(&flags.Quiet, "quiet", "q", false, "quiet output, only showing warnings, errors and final summaries")
+	rootCmd.PersistentFlags().StringVar(&flags.LogFile, "log-file", "", "append a plain transcript of all output, including the output of git and gh, to this file")
+	rootCmd.PersistentFlags().BoolVarP(&flags.Yes, "yes", "y", false, "answer yes to all confirmation prompts (also enabled by setting the TURBOLIFT_ASSUME_YES environment variable to true)")
+	rootCmd.PersistentFlags().BoolVar(&flags.No, "no", false, "answer no to all confirmation prompts (also enabled by setting the TURBOLIFT_ASSUME_NO environment variable to true)")
+	rootCmd.PersistentFlags().StringVar(&flags.Shard, "shard", "", "only operate on shard i of N of the repositories, e.g. 1/4 for the 1st, 5th, 9th, ... repository, to split a campaign across machines")
+	rootCmd.PersistentFlags().BoolVar(&flags.Timing, "timing", false, "show when each activity started and how long it took, and how long the whole command took, to find slow repositories")
+	rootCmd.PersistentFlags().DurationVar(&flags.Timeout, "timeout", 0, "kill any git, gh or other external process which runs for longer than this, e.g. 10m, marking its repository as errored (0 for no timeout)")
+	rootCmd.PersistentFlags().StringVar(&flags.Offline, "offline", "", "rehearse the campaign without touching GitHub: clone from local mirrors in this directory (laid out as org/repo), and record PRs in "+github.OfflineLedgerFilename+" instead of creating them")
+	rootCmd.PersistentFlags().Lookup("offline").NoOptDefVal = "mirrors"
+	rootCmd.PersistentFlags().StringVar(&flags.Branch, "branch", "", "the name of the campaign branch, e.g. chore/upgrade-logging, instead of the name of the campaign directory (also set with branch in turbolift.yaml)")
+	rootCmd.PersistentFlags().StringVar(&flags.Profile, "profile", "", "work on this profile of the campaign, e.g. phase-2, which shares the campaign's working copies but has its own branch and state in "+campaign.ProfilesDir+"/PROFILE")
+	rootCmd.PersistentFlags().StringVar(&flags.Variant, "variant", "", "run the command for this variant of the campaign, as configured in turbolift.yaml, or once for every variant with \"all\"")
+	rootCmd.PersistentFlags().StringVar(&flags.Record, "record", "", "append each PR, issue and label operation carried out on GitHub to this replay file, for turbolift replay")
+	rootCmd.PersistentFlags().BoolVar(&flags.NoCache, "no-cache", false, "query GitHub afresh rather than using responses cached in the campaign directory by earlier commands")
+	rootCmd.PersistentFlags().BoolVar(&flags.Actions, "actions", false, "format output for GitHub Actions: show each activity as a collapsible group, annotate warnings and failures, and write step outputs and a job summary")
+	rootCmd.PersistentFlags().StringSliceVar(&flags.OnlyTopics, "only-topic", nil, "only operate on the repositories with any of these topics, as recorded by refresh-metadata")
+	rootCmd.PersistentFlags().StringSliceVar(&flags.OnlyLanguages, "only-language", nil, "only operate on the repositories whose primary language is any of these, as recorded by refresh-metadata")
+	rootCmd.PersistentFlags().BoolVar(&flags.SkipArchived, "skip-archived", false, "leave out the repositories which are archived, as recorded by refresh-metadata")
+	rootCmd.PersistentFlags().StringVar(&flags.PushedSince, "pushed-since", "", "only operate on the repositories pushed to since a date (e.g. 2024-01-31) or within a duration (e.g. 720h), as recorded by refresh-metadata")
+	rootCmd.PersistentFlags().StringArrayVar(&flags.FilterFromResults, "filter-from-results", nil, "only operate on the repositories with an outcome (success, failed or skipped) in the latest run of a command, as recorded in "+history.Filename+", e.g. clone=success (can be given more than once)")
+	rootCmd.PersistentFlags().BoolVar(&flags.ForceUnlock, "force-unlock", false, "break the lock on the campaign held by another command, if it is no longer running but its lock has not been detected as stale")
+	rootCmd.PersistentFlags().BoolVar(&flags.NoColor, "no-color", false, "disable coloured output (also disabled by the NO_COLOR environment variable, or when output is not a terminal)")
 
+	rootCmd.AddCommand(addRepoCmd.NewAddRepoCmd())
+	rootCmd.AddCommand(applyCmd.NewApplyCmd())
+	rootCmd.AddCommand(approveCmd.NewApproveCmd())
+	rootCmd.AddCommand(archiveCmd.NewArchiveCmd())
+	rootCmd.AddCommand(backportCmd.NewBackportCmd())
+	rootCmd.AddCommand(blockersCmd.NewBlockersCmd())
+	rootCmd.AddCommand(checkoutCmd.NewCheckoutCmd())
 	rootCmd.AddCommand(cloneCmd.NewCloneCmd())
+	rootCmd.AddCommand(closeStaleCmd.NewCloseStaleCmd())
 	rootCmd.AddCommand(commitCmd.NewCommitCmd())
+	rootCmd.AddCommand(conflictsCmd.NewConflictsCmd())
+	rootCmd.AddCommand(createIssuesCmd.NewCreateIssuesCmd())
 	rootCmd.AddCommand(createPrsCmd.NewCreatePRsCmd())
+	rootCmd.AddCommand(diffCmd.NewDiffCmd())
+	rootCmd.AddCommand(discoverCmd.NewDiscoverCmd())
+	rootCmd.AddCommand(doctorCmd.NewDoctorCmd())
+	rootCmd.AddCommand(duCmd.NewDuCmd())
 	rootCmd.AddCommand(initCmd.NewInitCmd())
 	rootCmd.AddCommand(foreachCmd.NewForeachCmd())
 	rootCmd.AddCommand(updatePrsCmd.NewUpdatePRsCmd())
+	rootCmd.AddCommand(mergeCmd.NewMergeCmd())
 	rootCmd.AddCommand(prStatusCmd.NewPrStatusCmd())
+	rootCmd.AddCommand(pruneCmd.NewPruneCmd())
+	rootCmd.AddCommand(rateLimitCmd.NewRateLimitCmd())
+	rootCmd.AddCommand(rebaseCmd.NewRebaseCmd())
+	rootCmd.AddCommand(recreatePrsCmd.NewRecreatePRsCmd())
+	rootCmd.AddCommand(refreshCmd.NewRefreshCmd())
+	rootCmd.AddCommand(refreshMetadataCmd.NewRefreshMetadataCmd())
+	rootCmd.AddCommand(removeRepoCmd.NewRemoveRepoCmd())
+	rootCmd.AddCommand(renameCampaignCmd.NewRenameCampaignCmd())
+	rootCmd.AddCommand(replayCmd.NewReplayCmd())
+	rootCmd.AddCommand(serveCmd.NewServeCmd())
+	rootCmd.AddCommand(splitPrsCmd.NewSplitPRsCmd())
+	rootCmd.AddCommand(syncCmd.NewSyncCmd())
+	rootCmd.AddCommand(transformCmd.NewTransformCmd())
+	rootCmd.AddCommand(undoCmd.NewUndoCmd())
+	rootCmd.AddCommand(upgradeCmd.NewUpgradeCmd(version))
 }
 
+// Execute runs turbolift and exits with a code which reflects how the command went; see exitCode
 func Execute() {
-	if err := rootCmd.Execute(); err != nil {
-		log.Fatal(err)
+	err := rootCmd.Execute()
+	if err != nil {
+		log.Print(err)
 	}
+	os.Exit(exitCode(err, logging.CurrentResults()))
 }
@@ -0,0 +1,72 @@
+/*
+ * Copyright 2021 Skyscanner Limited.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * https://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package cmd
+
+import (
+	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/skyscanner/turbolift/internal/logging"
+	"github.com/skyscanner/turbolift/internal/testsupport"
+)
+
+func TestItNotifiesOfSuccessWithTheCounts(t *testing.T) {
+	message := notificationMessage("clone", "my-campaign", logging.Results{
+		Succeeded: 2,
+		Warnings:  []logging.Outcome{{Activity: "Cloning org/repo1", Message: "skipped"}},
+	})
+
+	assert.Equal(t, "turbolift clone completed for campaign my-campaign (2 OK, 1 warnings, 0 failed)", message)
+}
+
+func TestItNotifiesOfPartialFailure(t *testing.T) {
+	message := notificationMessage("create-prs", "my-campaign", logging.Results{
+		Succeeded: 1,
+		Failures:  []logging.Outcome{{Activity: "Creating PR in org/repo2", Message: "permission denied"}},
+		Errors:    1,
+	})
+
+	assert.Equal(t, "turbolift create-prs partially failed for campaign my-campaign (1 OK, 0 warnings, 2 failed)", message)
+}
+
+func TestItNotifiesOfFailure(t *testing.T) {
+	message := notificationMessage("clone", "my-campaign", logging.Results{
+		Failures: []logging.Outcome{{Activity: "Cloning org/repo1", Message: "permission denied"}},
+	})
+
+	assert.Equal(t, "turbolift clone failed for campaign my-campaign (0 OK, 0 warnings, 1 failed)", message)
+}
+
+func TestItNotifiesOfInvalidUsage(t *testing.T) {
+	message := notificationMessage("merge", "my-campaign", logging.Results{Errors: 1, UsageErrors: 1})
+
+	assert.Contains(t, message, "turbolift merge could not start for campaign my-campaign")
+}
+
+func TestItOnlyTreatsCampaignCommandsInACampaignDirectoryAsInACampaign(t *testing.T) {
+	campaignCmd := &cobra.Command{Use: "clone"}
+	campaignCmd.Flags().String("repos", "repos.txt", "")
+	otherCmd := &cobra.Command{Use: "init"}
+
+	testsupport.PrepareTempCampaign(false, "org/repo1")
+	assert.True(t, inCampaignDirectory(campaignCmd))
+	assert.False(t, inCampaignDirectory(otherCmd))
+
+	testsupport.CreateAndEnterTempDirectory()
+	assert.False(t, inCampaignDirectory(campaignCmd))
+}
@@ -0,0 +1,60 @@
+/*
+ * Copyright 2021 Skyscanner Limited.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * https://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package serve
+
+import "html/template"
+
+type pageData struct {
+	*Status
+	RefreshSeconds int
+}
+
+// states are the PR states in the order the dashboard summarises them
+var states = []string{"OPEN", "MERGED", "CLOSED", stateNoPR, stateNotCloned}
+
+var page = template.Must(template.New("dashboard").Funcs(template.FuncMap{"states": func() []string { return states }}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+{{if gt .RefreshSeconds 0}}<meta http-equiv="refresh" content="{{.RefreshSeconds}}">{{end}}
+<title>{{.Campaign}} - turbolift</title>
+<style>
+body { font-family: -apple-system, BlinkMacSystemFont, "Segoe UI", Helvetica, Arial, sans-serif; margin: 2em; color: #24292f; }
+table { border-collapse: collapse; margin-bottom: 2em; }
+th, td { text-align: left; padding: 0.3em 1em; border-bottom: 1px solid #d0d7de; }
+.OPEN { color: #1a7f37; } .MERGED { color: #8250df; } .CLOSED { color: #cf222e; } .NO_PR, .NOT_CLONED { color: #57606a; }
+pre { background: #f6f8fa; padding: 1em; overflow-x: auto; }
+</style>
+</head>
+<body>
+<h1>{{.Campaign}}</h1>
+<p>{{.PrTitle}}</p>
+<p>Updated {{.UpdatedAt.Format "2006-01-02 15:04:05"}}</p>
+<h2>Summary</h2>
+<table>
+{{range states}}<tr><td class="{{.}}">{{.}}</td><td>{{index $.Counts .}}</td></tr>
+{{end}}</table>
+<h2>Repositories</h2>
+<table>
+<tr><th>Repository</th><th>Group</th><th>State</th><th>Reviews</th><th>PR</th></tr>
+{{range .Repos}}<tr><td>{{.Repo}}</td><td>{{.Group}}</td><td class="{{.State}}"{{if .Error}} title="{{.Error}}"{{end}}>{{.State}}</td><td>{{.ReviewDecision}}</td><td>{{if .Url}}<a href="{{.Url}}">{{.Url}}</a>{{end}}</td></tr>
+{{end}}</table>
+<h2>Log</h2>
+<pre>{{range .Log}}{{.}}
+{{end}}</pre>
+</body>
+</html>
+`))
@@ -0,0 +1,211 @@
+/*
+ * Copyright 2021 Skyscanner Limited.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * https://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package serve
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/skyscanner/turbolift/internal/audit"
+	"github.com/skyscanner/turbolift/internal/campaign"
+	"github.com/skyscanner/turbolift/internal/github"
+	"github.com/skyscanner/turbolift/internal/interrupt"
+	"github.com/skyscanner/turbolift/internal/logging"
+)
+
+// gh is not cached, so that each reload of the page shows the PRs as they are now
+var gh github.GitHub = github.NewGitHub()
+
+var (
+	addr     string
+	repoFile string
+	refresh  time.Duration
+	logLines int
+)
+
+// interruptPollInterval is how often the server checks whether it has been interrupted
+const interruptPollInterval = 200 * time.Millisecond
+
+// The states shown for repositories which do not have a PR to report on
+const (
+	stateNotCloned = "NOT_CLONED"
+	stateNoPR      = "NO_PR"
+)
+
+// Status is the progress of the campaign, as shown by the dashboard and served as JSON
+type Status struct {
+	Campaign  string         `json:"campaign"`
+	PrTitle   string         `json:"prTitle"`
+	UpdatedAt time.Time      `json:"updatedAt"`
+	Counts    map[string]int `json:"counts"`
+	Repos     []RepoStatus   `json:"repos"`
+	Log       []string       `json:"log"`
+}
+
+// RepoStatus is the state of a repository's PR
+type RepoStatus struct {
+	Repo           string `json:"repo"`
+	Group          string `json:"group,omitempty"`
+	State          string `json:"state"`
+	ReviewDecision string `json:"reviewDecision,omitempty"`
+	Url            string `json:"url,omitempty"`
+	Error          string `json:"error,omitempty"`
+}
+
+func NewServeCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "serve",
+		Short: "Serve a local web dashboard of the campaign's progress",
+		Run:   run,
+	}
+
+	cmd.Flags().StringVar(&addr, "addr", "localhost:8080", "The address to serve the dashboard on.")
+	cmd.Flags().StringVar(&repoFile, "repos", "repos.txt", "A file containing a list of repositories to clone.")
+	cmd.Flags().DurationVar(&refresh, "refresh", time.Minute, "How often the dashboard reloads itself. PR states are fetched from GitHub at most every few minutes, however often it reloads.")
+	cmd.Flags().IntVar(&logLines, "log-lines", 100, "How many of the latest lines of the campaign's audit log to show.")
+
+	return cmd
+}
+
+func run(c *cobra.Command, _ []string) {
+	logger := logging.NewLogger(c)
+
+	// check that the campaign can be read before serving it
+	readCampaignActivity := logger.StartSetupActivity("Reading campaign data (%s)", repoFile)
+	if _, err := openCampaign(); err != nil {
+		readCampaignActivity.EndWithFailure(err)
+		return
+	}
+	readCampaignActivity.EndWithSuccess()
+
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		logger.Errorf("Unable to serve the dashboard on %s: %v", addr, err)
+		return
+	}
+
+	server := &http.Server{Handler: newHandler()}
+	go func() {
+		for !interrupt.Requested() {
+			time.Sleep(interruptPollInterval)
+		}
+		_ = server.Shutdown(context.Background())
+	}()
+
+	logger.Printf("Serving the dashboard on http://%s - interrupt to stop", listener.Addr())
+	if err := server.Serve(listener); err != nil && err != http.ErrServerClosed {
+		logger.Errorf("Unable to serve the dashboard: %v", err)
+		return
+	}
+	logger.Successf("turbolift serve completed\n")
+}
+
+func openCampaign() (*campaign.Campaign, error) {
+	options := campaign.NewCampaignOptions()
+	options.RepoFilename = repoFile
+	return campaign.OpenCampaign(options)
+}
+
+func newHandler() http.Handler {
+	// the campaign is shared with any turbolift command running alongside, so one request at a time
+	var mutex sync.Mutex
+	status := func(w http.ResponseWriter) (*Status, bool) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		status, err := gather(ioutil.Discard)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return nil, false
+		}
+		return status, true
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			http.NotFound(w, r)
+			return
+		}
+		if status, ok := status(w); ok {
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			_ = page.Execute(w, pageData{Status: status, RefreshSeconds: int(refresh.Seconds())})
+		}
+	})
+	mux.HandleFunc("/status.json", func(w http.ResponseWriter, r *http.Request) {
+		if status, ok := status(w); ok {
+			w.Header().Set("Content-Type", "application/json")
+			_ = json.NewEncoder(w).Encode(status)
+		}
+	})
+	return mux
+}
+
+// gather reads the campaign afresh, so that changes made by other commands show up, along with the state of its PRs
+func gather(output io.Writer) (*Status, error) {
+	dir, err := openCampaign()
+	if err != nil {
+		return nil, err
+	}
+
+	status := &Status{
+		Campaign:  dir.Name,
+		PrTitle:   dir.PrTitle,
+		UpdatedAt: time.Now(),
+		Counts:    map[string]int{},
+		Log:       tail(audit.Filename, logLines),
+	}
+	// PRs which cannot be fetched together are fetched one at a time below
+	prs, _ := github.FetchPRs(output, gh, dir.PRRefs())
+	for _, repo := range dir.Repos {
+		repoStatus := RepoStatus{Repo: repo.FullRepoName, Group: repo.Group}
+		if _, err := os.Stat(repo.FullRepoPath()); os.IsNotExist(err) {
+			repoStatus.State = stateNotCloned
+		} else if pr, err := prs.GetPR(output, repo.FullRepoPath(), dir.Name); err != nil {
+			repoStatus.State = stateNoPR
+			repoStatus.Error = err.Error()
+		} else {
+			repoStatus.State = pr.State
+			repoStatus.ReviewDecision = pr.ReviewDecision
+			repoStatus.Url = pr.Url
+		}
+		status.Counts[repoStatus.State]++
+		status.Repos = append(status.Repos, repoStatus)
+	}
+	return status, nil
+}
+
+// tail returns the last lines of a file, or none if it cannot be read
+func tail(filename string, lines int) []string {
+	content, err := ioutil.ReadFile(filename)
+	if err != nil || lines <= 0 {
+		return nil
+	}
+	all := strings.Split(strings.TrimRight(string(content), "\n"), "\n")
+	if len(all) > lines {
+		all = all[len(all)-lines:]
+	}
+	return all
+}
@@ -0,0 +1,92 @@
+/*
+ * Copyright 2021 Skyscanner Limited.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * https://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package serve
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/skyscanner/turbolift/internal/audit"
+	"github.com/skyscanner/turbolift/internal/github"
+	"github.com/skyscanner/turbolift/internal/testsupport"
+)
+
+func prepareFakeResponses() {
+	statuses := map[string]*github.PrStatus{
+		"work/org/repo1": {State: "OPEN", ReviewDecision: "REVIEW_REQUIRED", Url: "https://github.com/org/repo1/pull/1"},
+		"work/org/repo2": {State: "MERGED", ReviewDecision: "APPROVED", Url: "https://github.com/org/repo2/pull/2"},
+	}
+	gh = github.NewFakeGitHub(func(github.Command, []string) (bool, error) {
+		return true, nil
+	}, func(workingDir string) (interface{}, error) {
+		if status, ok := statuses[workingDir]; ok {
+			return status, nil
+		}
+		return nil, errors.New("no PR found")
+	})
+}
+
+func TestItServesTheStatusOfEachRepo(t *testing.T) {
+	prepareFakeResponses()
+	testsupport.PrepareTempCampaign(true, "org/repo1", "org/repo2", "org/repo3")
+	assert.NoError(t, os.RemoveAll("work/org/repo3"))
+	repoFile = "repos.txt"
+
+	server := httptest.NewServer(newHandler())
+	defer server.Close()
+
+	response, err := http.Get(server.URL + "/status.json")
+	assert.NoError(t, err)
+	defer response.Body.Close()
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+
+	var status Status
+	assert.NoError(t, json.NewDecoder(response.Body).Decode(&status))
+	assert.Equal(t, "PR title", status.PrTitle)
+	assert.Equal(t, map[string]int{"OPEN": 1, "MERGED": 1, stateNotCloned: 1}, status.Counts)
+	assert.Equal(t, RepoStatus{Repo: "org/repo1", State: "OPEN", ReviewDecision: "REVIEW_REQUIRED", Url: "https://github.com/org/repo1/pull/1"}, status.Repos[0])
+	assert.Equal(t, RepoStatus{Repo: "org/repo3", State: stateNotCloned}, status.Repos[2])
+}
+
+func TestItServesADashboardWithPRLinksAndTheLog(t *testing.T) {
+	prepareFakeResponses()
+	testsupport.PrepareTempCampaign(true, "org/repo1", "org/repo2")
+	repoFile = "repos.txt"
+	logLines = 1
+	defer func() { logLines = 100 }()
+	assert.NoError(t, ioutil.WriteFile(audit.Filename, []byte("first entry\nlatest entry\n"), 0o644))
+
+	server := httptest.NewServer(newHandler())
+	defer server.Close()
+
+	response, err := http.Get(server.URL)
+	assert.NoError(t, err)
+	defer response.Body.Close()
+	body, err := ioutil.ReadAll(response.Body)
+	assert.NoError(t, err)
+
+	assert.Contains(t, string(body), `<a href="https://github.com/org/repo2/pull/2">`)
+	assert.Contains(t, string(body), `<td class="MERGED">MERGED</td>`)
+	assert.Contains(t, string(body), "latest entry")
+	assert.NotContains(t, string(body), "first entry")
+}
@@ -0,0 +1,351 @@
+/*
+ * Copyright 2021 Skyscanner Limited.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * https://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package splitprs
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/skyscanner/turbolift/internal/campaign"
+	"github.com/skyscanner/turbolift/internal/changes"
+	"github.com/skyscanner/turbolift/internal/colors"
+	"github.com/skyscanner/turbolift/internal/git"
+	"github.com/skyscanner/turbolift/internal/github"
+	"github.com/skyscanner/turbolift/internal/hooks"
+	"github.com/skyscanner/turbolift/internal/interrupt"
+	"github.com/skyscanner/turbolift/internal/logging"
+	"github.com/skyscanner/turbolift/internal/secrets"
+)
+
+var (
+	// gh is not cached, as the PRs of the split branches change as they are pushed and raised
+	gh github.GitHub = github.NewGitHub()
+	g  git.Git       = git.NewRealGit()
+)
+
+var (
+	isDraft           bool
+	repoFile          string
+	prDescriptionFile string
+	splitsFile        string
+	byDirectory       bool
+	secretRules       string
+	allowSecrets      bool
+)
+
+// otherSplit holds the changes which are not in any split given in the splits file
+const otherSplit = "other"
+
+// maxListedPaths limits how many of a split's paths are listed in its PR description
+const maxListedPaths = 20
+
+func NewSplitPRsCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "split-prs",
+		Short: "Create several PRs in each repository, each with the campaign's changes to some of its paths",
+		Long: `For repositories where the campaign changes many areas, split the committed changes on the campaign branch
+by path and raise each split as its own PR, from a branch named after the campaign and the split. Splits are given
+in a YAML file with --splits, or made for each top-level directory with --by-directory. Changes which are in no
+split given in the file are raised together, as the split named "other".
+
+Running it again updates the split branches, and any open PRs from them, with the campaign's latest changes.
+Repositories whose changes are all within one split are skipped - use create-prs for them instead.`,
+		Args: cobra.NoArgs,
+		Run:  run,
+	}
+
+	cmd.Flags().BoolVar(&isDraft, "draft", false, "Creates the Pull Requests as Draft PRs")
+	cmd.Flags().StringVar(&repoFile, "repos", "repos.txt", "A file containing a list of repositories to create PRs in.")
+	cmd.Flags().StringVar(&prDescriptionFile, "description", "README.md", "A file containing the title and description for the PRs.")
+	cmd.Flags().StringVar(&splitsFile, "splits", "", "A YAML file listing the splits, each with a name, paths given as globs, and optionally a title template.")
+	cmd.Flags().BoolVar(&byDirectory, "by-directory", false, "Make a split for each top-level directory, with files outside any directory in the split named \"root\".")
+	cmd.Flags().StringVar(&secretRules, "secret-rules", "", "A gitleaks configuration file with rules for secrets to check for, in addition to the built-in rules.")
+	cmd.Flags().BoolVar(&allowSecrets, "allow-secrets", false, "Push changes even where they appear to contain secrets.")
+
+	return cmd
+}
+
+// group is the paths changed in a repository which belong to a split
+type group struct {
+	split campaign.Split
+	paths []string
+}
+
+func run(c *cobra.Command, _ []string) {
+	logger := logging.NewLogger(c)
+
+	if (splitsFile == "") == !byDirectory {
+		logger.FlagErrorf("one of --splits and --by-directory is required")
+		return
+	}
+
+	readCampaignActivity := logger.StartSetupActivity("Reading campaign data (%s, %s)", repoFile, prDescriptionFile)
+	options := campaign.NewCampaignOptions()
+	options.RepoFilename = repoFile
+	options.PrDescriptionFilename = prDescriptionFile
+	dir, err := campaign.OpenCampaign(options)
+	if err != nil {
+		readCampaignActivity.EndWithFailure(err)
+		return
+	}
+	var splits []campaign.Split
+	if splitsFile != "" {
+		if splits, err = campaign.ReadSplits(splitsFile); err != nil {
+			readCampaignActivity.EndWithFailure(err)
+			return
+		}
+	}
+	lifecycleHooks, err := hooks.Load()
+	if err != nil {
+		readCampaignActivity.EndWithFailure(err)
+		return
+	}
+	rules, err := secrets.LoadRules(secretRules)
+	if err != nil {
+		readCampaignActivity.EndWithFailure(err)
+		return
+	}
+	readCampaignActivity.EndWithSuccess()
+
+	if err := lifecycleHooks.RunForCommand(logger, hooks.PrePush); err != nil {
+		return
+	}
+
+	var doneCount, skippedCount, errorCount int
+	interrupt.ForEachRepo(logger, dir.Repos, func(repo campaign.Repo) {
+		repoDirPath := repo.FullRepoPath()
+
+		splitActivity := logger.StartActivity("Splitting changes in %s", repo.FullRepoName)
+		// skip if the working copy does not exist
+		if _, err = os.Stat(repoDirPath); os.IsNotExist(err) {
+			splitActivity.EndWithWarningf("Directory %s does not exist - has it been cloned?", repoDirPath)
+			skippedCount++
+			return
+		}
+
+		baseBranch, err := changes.BaseBranch(splitActivity.Writer(), gh, repo)
+		if err != nil {
+			splitActivity.EndWithFailure(err)
+			errorCount++
+			return
+		}
+		baseRemote, err := changes.BaseRemote(splitActivity.Writer(), g, repoDirPath)
+		if err != nil {
+			splitActivity.EndWithFailure(err)
+			errorCount++
+			return
+		}
+		baseRef := baseRemote + "/" + baseBranch
+
+		groups, err := groupChanges(splitActivity, repoDirPath, baseRef, splits)
+		if err != nil {
+			splitActivity.EndWithFailure(err)
+			errorCount++
+			return
+		}
+		if len(groups) == 0 {
+			splitActivity.EndWithWarning("No committed changes - skipping")
+			skippedCount++
+			return
+		}
+		if len(groups) == 1 {
+			splitActivity.EndWithWarningf("Not splitting, as all changes are in split %s - use create-prs instead", groups[0].split.Name)
+			skippedCount++
+			return
+		}
+
+		if !allowSecrets {
+			if err := secrets.CheckBranch(splitActivity.Writer(), g, gh, repo, rules); err != nil {
+				splitActivity.EndWithFailuref("Not pushing: %v", err)
+				errorCount++
+				return
+			}
+		}
+		// the splits are taken from the campaign branch, so its working copy is what the hook checks
+		if err := lifecycleHooks.RunForRepo(splitActivity.Writer(), hooks.PrePush, repo); err != nil {
+			splitActivity.EndWithFailure(err)
+			errorCount++
+			return
+		}
+
+		head, err := changes.HeadOwner(splitActivity.Writer(), g, repo, repoDirPath)
+		if err != nil {
+			splitActivity.EndWithFailure(err)
+			errorCount++
+			return
+		}
+		splitActivity.Logf("Split into %d PRs", len(groups))
+		splitActivity.EndWithSuccessAndEmitLogs()
+
+		for j, grp := range groups {
+			branchName := grp.split.BranchName(dir.Name)
+			prActivity := logger.StartActivity("Creating PR for split %s in %s", grp.split.Name, repo.FullRepoName)
+			created, err := createSplitPR(prActivity, dir, repo, baseRef, head+branchName, grp, j, len(groups))
+			if err != nil {
+				prActivity.EndWithFailure(err)
+				errorCount++
+			} else if !created {
+				prActivity.EndWithSuccessAndEmitLogs()
+				doneCount++
+			} else {
+				prActivity.EndWithSuccess()
+				doneCount++
+			}
+		}
+	})
+
+	if errorCount == 0 {
+		logger.Successf("turbolift split-prs completed %s(%s, %s)\n", colors.Normal(), colors.Green(doneCount, " OK"), colors.Yellow(skippedCount, " skipped"))
+	} else {
+		logger.Warnf("turbolift split-prs completed with %s %s(%s, %s, %s)\n", colors.Red("errors"), colors.Normal(), colors.Green(doneCount, " OK"), colors.Yellow(skippedCount, " skipped"), colors.Red(errorCount, " errored"))
+	}
+}
+
+// groupChanges divides the paths changed in a repository between the splits, in the order they are given, or
+// between its top-level directories
+func groupChanges(activity *logging.Activity, repoDirPath string, baseRef string, splits []campaign.Split) ([]group, error) {
+	changed, err := g.ChangedPaths(activity.Writer(), repoDirPath, baseRef)
+	if err != nil {
+		return nil, err
+	}
+
+	if byDirectory {
+		byName := map[string]*group{}
+		var names []string
+		for _, path := range changed {
+			name := "root"
+			if i := strings.Index(path, "/"); i >= 0 {
+				name = campaign.SplitName(path[:i])
+			}
+			if byName[name] == nil {
+				byName[name] = &group{split: campaign.Split{Name: name}}
+				names = append(names, name)
+			}
+			byName[name].paths = append(byName[name].paths, path)
+		}
+		sort.Strings(names)
+		var groups []group
+		for _, name := range names {
+			groups = append(groups, *byName[name])
+		}
+		return groups, nil
+	}
+
+	var groups []group
+	assigned := map[string]bool{}
+	for _, split := range splits {
+		matching, err := g.ChangedPaths(activity.Writer(), repoDirPath, baseRef, split.Paths...)
+		if err != nil {
+			return nil, err
+		}
+		grp := group{split: split}
+		for _, path := range matching {
+			if !assigned[path] {
+				assigned[path] = true
+				grp.paths = append(grp.paths, path)
+			}
+		}
+		if len(grp.paths) > 0 {
+			groups = append(groups, grp)
+		}
+	}
+
+	var rest []string
+	for _, path := range changed {
+		if !assigned[path] {
+			rest = append(rest, path)
+		}
+	}
+	if len(rest) > 0 {
+		for i := range groups {
+			if groups[i].split.Name == otherSplit {
+				groups[i].paths = append(groups[i].paths, rest...)
+				return groups, nil
+			}
+		}
+		groups = append(groups, group{split: campaign.Split{Name: otherSplit}, paths: rest})
+	}
+	return groups, nil
+}
+
+// createSplitPR commits a split's changes to its branch, pushes it, and raises a PR from it unless one is open
+// already, returning whether a PR was created
+func createSplitPR(activity *logging.Activity, dir *campaign.Campaign, repo campaign.Repo, baseRef string, head string, grp group, index int, total int) (bool, error) {
+	repoDirPath := repo.FullRepoPath()
+	branchName := grp.split.BranchName(dir.Name)
+
+	title := fmt.Sprintf("%s (%s)", dir.PrTitle, grp.split.Name)
+	if grp.split.Title != "" {
+		t, err := campaign.ParseTemplate(grp.split.Name, grp.split.Title)
+		if err != nil {
+			return false, fmt.Errorf("unable to parse the title of split %s: %w", grp.split.Name, err)
+		}
+		if title, err = campaign.RenderTemplate(t, campaign.NewTemplateData(dir, repo)); err != nil {
+			return false, fmt.Errorf("unable to render the title of split %s: %w", grp.split.Name, err)
+		}
+	}
+
+	if err := g.CommitPathsToBranch(activity.Writer(), repoDirPath, branchName, baseRef, grp.paths, title); err != nil {
+		return false, err
+	}
+	// the branch is recreated each time, so may have been pushed before with other commits
+	if err := g.ForcePush(activity.Writer(), repoDirPath, "origin", branchName); err != nil {
+		return false, err
+	}
+
+	// the working copy is still on the campaign branch, whose own PR GetPR would find
+	pr, err := gh.GetPRForBranch(activity.Writer(), repoDirPath, branchName)
+	if _, ok := err.(*github.NoPRFoundError); !ok && err != nil {
+		return false, err
+	}
+	if err == nil && pr.State == "OPEN" {
+		activity.Logf("Updated the open PR %s", pr.Url)
+		return false, nil
+	}
+
+	didCreate, err := gh.CreatePullRequest(activity.Writer(), repoDirPath, github.PullRequest{
+		Title:        title,
+		Body:         splitNote(dir.PrBody, grp, index, total),
+		UpstreamRepo: repo.FullRepoName,
+		IsDraft:      isDraft,
+		Head:         head,
+	})
+	if err != nil {
+		return false, err
+	}
+	if !didCreate {
+		return false, fmt.Errorf("no PR created from %s", branchName)
+	}
+	return true, nil
+}
+
+// splitNote tells reviewers which part of the campaign's changes a PR has
+func splitNote(body string, grp group, index int, total int) string {
+	var note strings.Builder
+	_, _ = fmt.Fprintf(&note, "%s\n\n> **Note**\n> This is part %d of %d of this campaign's changes to this repository, with the changes to:\n", strings.TrimRight(body, "\n"), index+1, total)
+	for i, path := range grp.paths {
+		if i == maxListedPaths {
+			_, _ = fmt.Fprintf(&note, "> * and %d more files\n", len(grp.paths)-maxListedPaths)
+			break
+		}
+		_, _ = fmt.Fprintf(&note, "> * `%s`\n", path)
+	}
+	return note.String()
+}
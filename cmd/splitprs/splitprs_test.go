@@ -0,0 +1,207 @@
+/*
+ * Copyright 2021 Skyscanner Limited.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * https://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package splitprs
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/skyscanner/turbolift/internal/git"
+	"github.com/skyscanner/turbolift/internal/github"
+	"github.com/skyscanner/turbolift/internal/testsupport"
+)
+
+func init() {
+	// disable output colouring so that strings we want to do 'Contains' checks on do not have ANSI escape sequences in IDEs
+	_ = os.Setenv("NO_COLOR", "1")
+}
+
+func TestItSplitsChangesByTopLevelDirectory(t *testing.T) {
+	fakeGitHub := noPRsGitHub()
+	gh = fakeGitHub
+	fakeGit := git.NewAlwaysSucceedsFakeGit()
+	fakeGit.Paths = []string{"Makefile", "docs/guide.md", "src/a.go", "src/b.go"}
+	g = fakeGit
+
+	testsupport.PrepareTempCampaign(true, "org/repo1")
+	branchName := filepath.Base(testsupport.Pwd())
+
+	out, err := runCommand("--by-directory")
+	assert.NoError(t, err)
+	assert.Contains(t, out, "turbolift split-prs completed (3 OK, 0 skipped)")
+
+	fakeGit.AssertCalledWith(t, [][]string{
+		{"remotes", "work/org/repo1"},
+		{"changedPaths", "work/org/repo1", "origin/main"},
+		{"remotes", "work/org/repo1"},
+		{"fetch", "work/org/repo1", "origin", "main"},
+		{"diff", "work/org/repo1", "origin/main"},
+		{"remoteRepoName", "work/org/repo1", "origin"},
+		{"commitPathsToBranch", "work/org/repo1", branchName + "-docs", "origin/main", "docs/guide.md", "PR title (docs)"},
+		{"forcePush", "work/org/repo1", "origin", branchName + "-docs"},
+		{"commitPathsToBranch", "work/org/repo1", branchName + "-root", "origin/main", "Makefile", "PR title (root)"},
+		{"forcePush", "work/org/repo1", "origin", branchName + "-root"},
+		{"commitPathsToBranch", "work/org/repo1", branchName + "-src", "origin/main", "src/a.go,src/b.go", "PR title (src)"},
+		{"forcePush", "work/org/repo1", "origin", branchName + "-src"},
+	})
+	assert.Len(t, fakeGitHub.PullRequests, 3)
+	assert.Equal(t, branchName+"-src", fakeGitHub.PullRequests[2].Head)
+	assert.Equal(t, "PR body\n\n> **Note**\n> This is part 3 of 3 of this campaign's changes to this repository, with the changes to:\n> * `src/a.go`\n> * `src/b.go`\n", fakeGitHub.PullRequests[2].Body)
+}
+
+func TestItSplitsChangesAsGivenInASplitsFile(t *testing.T) {
+	fakeGitHub := noPRsGitHub()
+	gh = fakeGitHub
+	fakeGit := git.NewAlwaysSucceedsFakeGit()
+	fakeGit.Paths = []string{"README.md", "docs/guide.md", "src/a.go"}
+	g = fakeGit
+
+	testsupport.PrepareTempCampaign(true, "org/repo1")
+	branchName := filepath.Base(testsupport.Pwd())
+	err := ioutil.WriteFile("splits.yaml", []byte(`
+- name: docs
+  paths: [docs/**, "*.md"]
+  title: Document {{.RepoName}}
+- name: ci
+  paths: [.github/**]
+`), 0o644)
+	assert.NoError(t, err)
+
+	out, err := runCommand("--splits", "splits.yaml", "--draft")
+	assert.NoError(t, err)
+	assert.Contains(t, out, "turbolift split-prs completed (2 OK, 0 skipped)")
+
+	fakeGit.AssertCalledWith(t, [][]string{
+		{"remotes", "work/org/repo1"},
+		{"changedPaths", "work/org/repo1", "origin/main"},
+		{"changedPaths", "work/org/repo1", "origin/main", "docs/**", "*.md"},
+		{"changedPaths", "work/org/repo1", "origin/main", ".github/**"},
+		{"remotes", "work/org/repo1"},
+		{"fetch", "work/org/repo1", "origin", "main"},
+		{"diff", "work/org/repo1", "origin/main"},
+		{"remoteRepoName", "work/org/repo1", "origin"},
+		{"commitPathsToBranch", "work/org/repo1", branchName + "-docs", "origin/main", "README.md,docs/guide.md", "Document repo1"},
+		{"forcePush", "work/org/repo1", "origin", branchName + "-docs"},
+		{"commitPathsToBranch", "work/org/repo1", branchName + "-other", "origin/main", "src/a.go", "PR title (other)"},
+		{"forcePush", "work/org/repo1", "origin", branchName + "-other"},
+	})
+	assert.Equal(t, "Document repo1", fakeGitHub.PullRequests[0].Title)
+	assert.True(t, fakeGitHub.PullRequests[0].IsDraft)
+}
+
+func TestItSkipsReposWithChangesInOnlyOneSplit(t *testing.T) {
+	fakeGitHub := noPRsGitHub()
+	gh = fakeGitHub
+	fakeGit := git.NewAlwaysSucceedsFakeGit()
+	fakeGit.Paths = []string{"src/a.go", "src/b.go"}
+	g = fakeGit
+
+	testsupport.PrepareTempCampaign(true, "org/repo1")
+
+	out, err := runCommand("--by-directory")
+	assert.NoError(t, err)
+	assert.Contains(t, out, "Not splitting, as all changes are in split src - use create-prs instead")
+	assert.Contains(t, out, "turbolift split-prs completed (0 OK, 1 skipped)")
+	assert.Empty(t, fakeGitHub.PullRequests)
+}
+
+func TestItUpdatesOpenPRsFromSplitBranches(t *testing.T) {
+	fakeGitHub := github.NewFakeGitHub(func(github.Command, []string) (bool, error) {
+		return true, nil
+	}, func(workingDir string) (interface{}, error) {
+		return &github.PrStatus{State: "OPEN", Url: "https://github.com/org/repo1/pull/7"}, nil
+	})
+	gh = fakeGitHub
+	fakeGit := git.NewAlwaysSucceedsFakeGit()
+	fakeGit.Paths = []string{"docs/guide.md", "src/a.go"}
+	g = fakeGit
+
+	testsupport.PrepareTempCampaign(true, "org/repo1")
+
+	out, err := runCommand("--by-directory")
+	assert.NoError(t, err)
+	assert.Contains(t, out, "Updated the open PR https://github.com/org/repo1/pull/7")
+	assert.Contains(t, out, "turbolift split-prs completed (2 OK, 0 skipped)")
+	assert.Empty(t, fakeGitHub.PullRequests)
+}
+
+func TestItCreatesSplitPRsWhenTheCampaignBranchHasAnOpenPR(t *testing.T) {
+	fakeGitHub := github.NewFakeGitHub(func(github.Command, []string) (bool, error) {
+		return true, nil
+	}, func(workingDir string) (interface{}, error) {
+		return &github.PrStatus{State: "OPEN", Url: "https://github.com/org/repo1/pull/1"}, nil
+	})
+	gh = fakeGitHub
+	fakeGit := git.NewAlwaysSucceedsFakeGit()
+	fakeGit.Paths = []string{"docs/guide.md", "src/a.go"}
+	g = fakeGit
+
+	testsupport.PrepareTempCampaign(true, "org/repo1")
+	branchName := filepath.Base(testsupport.Pwd())
+	fakeGitHub.BranchPRs = map[string]*github.PrStatus{
+		branchName: {State: "OPEN", Url: "https://github.com/org/repo1/pull/1"},
+	}
+
+	out, err := runCommand("--by-directory")
+	assert.NoError(t, err)
+	assert.NotContains(t, out, "Updated the open PR")
+	assert.Contains(t, out, "turbolift split-prs completed (2 OK, 0 skipped)")
+	assert.Len(t, fakeGitHub.PullRequests, 2)
+	assert.Equal(t, branchName+"-docs", fakeGitHub.PullRequests[0].Head)
+	assert.Equal(t, branchName+"-src", fakeGitHub.PullRequests[1].Head)
+}
+
+func TestItNeedsExactlyOneWayOfSplitting(t *testing.T) {
+	fakeGit := git.NewAlwaysSucceedsFakeGit()
+	g = fakeGit
+
+	testsupport.PrepareTempCampaign(true, "org/repo1")
+
+	out, err := runCommand()
+	assert.NoError(t, err)
+	assert.Contains(t, out, "one of --splits and --by-directory is required")
+
+	out, err = runCommand("--by-directory", "--splits", "splits.yaml")
+	assert.NoError(t, err)
+	assert.Contains(t, out, "one of --splits and --by-directory is required")
+
+	fakeGit.AssertCalledWith(t, [][]string{})
+}
+
+func noPRsGitHub() *github.FakeGitHub {
+	return github.NewFakeGitHub(func(github.Command, []string) (bool, error) {
+		return true, nil
+	}, func(workingDir string) (interface{}, error) {
+		return nil, &github.NoPRFoundError{Path: workingDir, BranchName: "branch"}
+	})
+}
+
+func runCommand(args ...string) (string, error) {
+	cmd := NewSplitPRsCmd()
+	cmd.SetArgs(args)
+	outBuffer := bytes.NewBufferString("")
+	cmd.SetOut(outBuffer)
+	err := cmd.Execute()
+	if err != nil {
+		return outBuffer.String(), err
+	}
+	return outBuffer.String(), nil
+}
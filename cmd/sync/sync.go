@@ -0,0 +1,161 @@
+/*
+ * Copyright 2021 Skyscanner Limited.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * https://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package sync
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/skyscanner/turbolift/internal/campaign"
+	"github.com/skyscanner/turbolift/internal/changes"
+	"github.com/skyscanner/turbolift/internal/colors"
+	"github.com/skyscanner/turbolift/internal/git"
+	"github.com/skyscanner/turbolift/internal/github"
+	"github.com/skyscanner/turbolift/internal/interrupt"
+	"github.com/skyscanner/turbolift/internal/logging"
+)
+
+var (
+	gh github.GitHub = github.NewCachingGitHub(github.NewGitHub())
+	g  git.Git       = git.NewRealGit()
+)
+
+var (
+	repoFile string
+	rebase   bool
+)
+
+// ConflictedReposFilename is the repo file that sync writes the repositories whose base branch could not be brought
+// in cleanly to, so that they can be worked on with --repos
+const ConflictedReposFilename = "conflicted.txt"
+
+func NewSyncCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "sync",
+		Short: "Bring the latest changes on each repository's base branch into its local campaign branch",
+		Long: `Fetch the base branch of each cloned repository, and merge it into the local campaign branch, or rebase the
+campaign branch onto it with --rebase. Nothing is pushed. Repositories where this conflicts are left as they were,
+and are listed in ` + ConflictedReposFilename + ` so that they can be resolved by hand.
+Working copies with uncommitted changes are skipped.`,
+		Args: cobra.NoArgs,
+		Run:  run,
+	}
+
+	cmd.Flags().StringVar(&repoFile, "repos", "repos.txt", "A file containing a list of repositories to sync.")
+	cmd.Flags().BoolVar(&rebase, "rebase", false, "Rebase the campaign branch onto the base branch, rather than merging the base branch into it.")
+
+	return cmd
+}
+
+func run(c *cobra.Command, _ []string) {
+	logger := logging.NewLogger(c)
+
+	readCampaignActivity := logger.StartSetupActivity("Reading campaign data (%s)", repoFile)
+	options := campaign.NewCampaignOptions()
+	options.RepoFilename = repoFile
+	dir, err := campaign.OpenCampaign(options)
+	if err != nil {
+		readCampaignActivity.EndWithFailure(err)
+		return
+	}
+	readCampaignActivity.EndWithSuccess()
+
+	var conflicted []string
+	doneCount := 0
+	skippedCount := 0
+	errorCount := 0
+	interrupt.ForEachRepo(logger, dir.Repos, func(repo campaign.Repo) {
+		repoDirPath := repo.FullRepoPath()
+
+		syncActivity := logger.StartActivity("Syncing %s", repo.FullRepoName)
+		// skip if the working copy does not exist
+		if _, err = os.Stat(repoDirPath); os.IsNotExist(err) {
+			syncActivity.EndWithWarningf("Directory %s does not exist - has it been cloned?", repoDirPath)
+			skippedCount++
+			return
+		}
+
+		changed, err := g.IsRepoChanged(syncActivity.Writer(), repoDirPath)
+		if err != nil {
+			syncActivity.EndWithFailure(err)
+			errorCount++
+			return
+		}
+		if changed {
+			syncActivity.EndWithWarningf("%s has uncommitted changes - commit or discard them first", repoDirPath)
+			skippedCount++
+			return
+		}
+
+		base, err := fetchBase(syncActivity, repo, repoDirPath, dir.Name)
+		if err != nil {
+			syncActivity.EndWithFailure(err)
+			errorCount++
+			return
+		}
+
+		// a failed merge or rebase is aborted, leaving the campaign branch as it was
+		if rebase {
+			err = g.Rebase(syncActivity.Writer(), repoDirPath, base)
+		} else {
+			err = g.Merge(syncActivity.Writer(), repoDirPath, base)
+		}
+		if err != nil {
+			syncActivity.EndWithFailuref("%s could not be brought in cleanly, so the campaign branch has been left as it was: %v", base, err)
+			conflicted = append(conflicted, repo.FullRepoName)
+			return
+		}
+		syncActivity.EndWithSuccess()
+		doneCount++
+	})
+
+	if len(conflicted) == 0 && errorCount == 0 {
+		logger.Successf("turbolift sync completed %s(%s, %s)\n", colors.Normal(), colors.Green(doneCount, " OK"), colors.Yellow(skippedCount, " skipped"))
+		return
+	}
+	logger.Warnf("turbolift sync completed with %s %s(%s, %s, %s, %s)\n", colors.Red("errors"), colors.Normal(), colors.Green(doneCount, " OK"), colors.Yellow(skippedCount, " skipped"), colors.Red(len(conflicted), " conflicted"), colors.Red(errorCount, " errored"))
+	if len(conflicted) > 0 {
+		if err := ioutil.WriteFile(ConflictedReposFilename, []byte(strings.Join(conflicted, "\n")+"\n"), 0o644); err != nil {
+			logger.Warnf("%d repositories have conflicts, but they could not be written to %s: %v", len(conflicted), ConflictedReposFilename, err)
+			return
+		}
+		logger.Printf("%d repositories have conflicts to resolve by hand. To work on them, use %s", len(conflicted), colors.Cyan("--repos ", ConflictedReposFilename))
+	}
+}
+
+// fetchBase checks out the campaign branch and fetches the repository's latest base branch, returning its ref
+func fetchBase(activity *logging.Activity, repo campaign.Repo, repoDirPath string, branchName string) (string, error) {
+	// the campaign branch normally exists already, having been created by clone
+	if _, err := g.SwitchBranch(activity.Writer(), repoDirPath, branchName, ""); err != nil {
+		return "", err
+	}
+
+	baseBranch, err := changes.BaseBranch(activity.Writer(), gh, repo)
+	if err != nil {
+		return "", err
+	}
+	baseRemote, err := changes.BaseRemote(activity.Writer(), g, repoDirPath)
+	if err != nil {
+		return "", err
+	}
+	if err := g.Fetch(activity.Writer(), repoDirPath, baseRemote, baseBranch); err != nil {
+		return "", err
+	}
+	return baseRemote + "/" + baseBranch, nil
+}
@@ -0,0 +1,184 @@
+/*
+ * Copyright 2021 Skyscanner Limited.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * https://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package sync
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/skyscanner/turbolift/internal/git"
+	"github.com/skyscanner/turbolift/internal/github"
+	"github.com/skyscanner/turbolift/internal/testsupport"
+)
+
+func init() {
+	// disable output colouring so that strings we want to do 'Contains' checks on do not have ANSI escape sequences in IDEs
+	_ = os.Setenv("NO_COLOR", "1")
+}
+
+func TestItMergesTheBaseBranchIntoTheCampaignBranch(t *testing.T) {
+	gh = github.NewAlwaysSucceedsFakeGitHub()
+	fakeGit := git.NewFakeGit(unchangedWorkingCopies)
+	g = fakeGit
+
+	testsupport.PrepareTempCampaign(true, "org/repo1")
+
+	out, err := runCommand()
+	assert.NoError(t, err)
+	assert.Contains(t, out, "turbolift sync completed (1 OK, 0 skipped)")
+
+	fakeGit.AssertCalledWith(t, [][]string{
+		{"isRepoChanged", "work/org/repo1"},
+		{"switchBranch", "work/org/repo1", testsupport.Pwd(), ""},
+		{"remotes", "work/org/repo1"},
+		{"fetch", "work/org/repo1", "origin", "main"},
+		{"merge", "work/org/repo1", "origin/main"},
+	})
+}
+
+func TestItRebasesTheCampaignBranchWhenAsked(t *testing.T) {
+	gh = github.NewAlwaysSucceedsFakeGitHub()
+	fakeGit := git.NewFakeGit(unchangedWorkingCopies)
+	g = fakeGit
+
+	testsupport.PrepareTempCampaign(true, "org/repo1")
+
+	out, err := runCommand("--rebase")
+	assert.NoError(t, err)
+	assert.Contains(t, out, "turbolift sync completed (1 OK, 0 skipped)")
+
+	fakeGit.AssertCalledWith(t, [][]string{
+		{"isRepoChanged", "work/org/repo1"},
+		{"switchBranch", "work/org/repo1", testsupport.Pwd(), ""},
+		{"remotes", "work/org/repo1"},
+		{"fetch", "work/org/repo1", "origin", "main"},
+		{"rebase", "work/org/repo1", "origin/main"},
+	})
+}
+
+func TestItReportsConflicts(t *testing.T) {
+	gh = github.NewAlwaysSucceedsFakeGitHub()
+	g = git.NewFakeGit(func(output io.Writer, call []string) (bool, error) {
+		if call[0] == "merge" && call[1] == "work/org/repo2" {
+			return false, errors.New("synthetic conflict")
+		}
+		return unchangedWorkingCopies(output, call)
+	})
+
+	testsupport.PrepareTempCampaign(true, "org/repo1", "org/repo2")
+
+	out, err := runCommand()
+	assert.NoError(t, err)
+	assert.Contains(t, out, "origin/main could not be brought in cleanly")
+	assert.Contains(t, out, "turbolift sync completed with errors (1 OK, 0 skipped, 1 conflicted, 0 errored)")
+	assert.Contains(t, out, "--repos conflicted.txt")
+
+	conflicted, err := ioutil.ReadFile(ConflictedReposFilename)
+	assert.NoError(t, err)
+	assert.Equal(t, "org/repo2\n", string(conflicted))
+}
+
+func TestItSkipsWorkingCopiesWithUncommittedChanges(t *testing.T) {
+	gh = github.NewAlwaysSucceedsFakeGitHub()
+	fakeGit := git.NewAlwaysSucceedsFakeGit()
+	g = fakeGit
+
+	testsupport.PrepareTempCampaign(true, "org/repo1")
+
+	out, err := runCommand()
+	assert.NoError(t, err)
+	assert.Contains(t, out, "has uncommitted changes")
+	assert.Contains(t, out, "turbolift sync completed (0 OK, 1 skipped)")
+
+	fakeGit.AssertCalledWith(t, [][]string{
+		{"isRepoChanged", "work/org/repo1"},
+	})
+}
+
+func TestItSyncsARealWorkingCopyOnItsExistingCampaignBranch(t *testing.T) {
+	gh = github.NewAlwaysSucceedsFakeGitHub()
+	g = git.NewRealGit()
+	defer func() { g = git.NewAlwaysSucceedsFakeGit() }()
+
+	testsupport.PrepareTempCampaign(false, "org/repo1")
+	branch := filepath.Base(testsupport.Pwd())
+
+	origin := filepath.Join(t.TempDir(), "origin.git")
+	runGit(t, ".", "init", "--quiet", "--bare", origin)
+	runGit(t, origin, "symbolic-ref", "HEAD", "refs/heads/main")
+	runGit(t, ".", "clone", "--quiet", origin, "work/org/repo1")
+	runGit(t, "work/org/repo1", "config", "user.name", "Turbolift")
+	runGit(t, "work/org/repo1", "config", "user.email", "turbolift@example.com")
+	runGit(t, "work/org/repo1", "checkout", "--quiet", "-b", "main")
+	runGit(t, "work/org/repo1", "commit", "--quiet", "--allow-empty", "-m", "Initial commit")
+	runGit(t, "work/org/repo1", "push", "--quiet", "origin", "main")
+	// as clone leaves it, on the campaign branch
+	runGit(t, "work/org/repo1", "checkout", "--quiet", "-b", branch)
+	runGit(t, "work/org/repo1", "commit", "--quiet", "--allow-empty", "-m", "Campaign change")
+
+	// meanwhile, the base branch moves on
+	upstream := filepath.Join(t.TempDir(), "upstream")
+	runGit(t, ".", "clone", "--quiet", origin, upstream)
+	runGit(t, upstream, "commit", "--quiet", "--allow-empty", "-m", "Base change")
+	runGit(t, upstream, "push", "--quiet", "origin", "main")
+
+	out, err := runCommand("--rebase")
+	assert.NoError(t, err)
+	assert.Contains(t, out, "turbolift sync completed (1 OK, 0 skipped)")
+
+	assert.Equal(t, branch+"\n", gitOutput(t, "work/org/repo1", "rev-parse", "--abbrev-ref", "HEAD"))
+	assert.Equal(t, "Campaign change\nBase change\nInitial commit\n", gitOutput(t, "work/org/repo1", "log", "--format=%s"))
+}
+
+func runGit(t *testing.T, dir string, args ...string) {
+	gitOutput(t, dir, args...)
+}
+
+func gitOutput(t *testing.T, dir string, args ...string) string {
+	cmd := exec.Command("git", append([]string{"-c", "user.name=Turbolift", "-c", "user.email=turbolift@example.com"}, args...)...)
+	cmd.Dir = dir
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("git %s failed: %v\n%s", strings.Join(args, " "), err, out)
+	}
+	return string(out)
+}
+
+func unchangedWorkingCopies(_ io.Writer, call []string) (bool, error) {
+	return call[0] != "isRepoChanged", nil
+}
+
+func runCommand(args ...string) (string, error) {
+	cmd := NewSyncCmd()
+	rebase = false
+	cmd.SetArgs(args)
+	outBuffer := bytes.NewBufferString("")
+	cmd.SetOut(outBuffer)
+	err := cmd.Execute()
+	if err != nil {
+		return outBuffer.String(), err
+	}
+	return outBuffer.String(), nil
+}
@@ -0,0 +1,182 @@
+/*
+ * Copyright 2021 Skyscanner Limited.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * https://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package transform
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+
+	"github.com/skyscanner/turbolift/internal/campaign"
+	"github.com/skyscanner/turbolift/internal/colors"
+	"github.com/skyscanner/turbolift/internal/executor"
+	"github.com/skyscanner/turbolift/internal/git"
+	"github.com/skyscanner/turbolift/internal/interrupt"
+	"github.com/skyscanner/turbolift/internal/logging"
+)
+
+var (
+	exec executor.Executor = executor.NewRealExecutor()
+	g    git.Git           = git.NewRealGit()
+)
+
+var (
+	repoFile  string
+	engine    string
+	match     string
+	rewrite   string
+	language  string
+	rulesFile string
+)
+
+func NewTransformCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "transform",
+		Short: "Run a codemod engine (comby, semgrep or ast-grep) against each working copy",
+		Long: `Run a structural search and replace against each working copy using comby, semgrep (with --autofix) or
+ast-grep, and report which repositories were changed. The rewrite is given either as a --match/--rewrite pair or as
+a --rules file in the engine's own format. Settings can be shared by everyone running the campaign under
+commands.transform in turbolift.yaml.`,
+		Example: `  turbolift transform --engine comby --match 'fmt.Println(:[args])' --rewrite 'log.Println(:[args])' --lang .go
+  turbolift transform --engine semgrep --rules rules.yaml
+  turbolift transform --engine ast-grep --match 'assert.Equal($A, nil)' --rewrite 'assert.Nil($A)' --lang go`,
+		Args: cobra.NoArgs,
+		Run:  run,
+	}
+
+	cmd.Flags().StringVar(&repoFile, "repos", "repos.txt", "A file containing a list of repositories to transform.")
+	cmd.Flags().StringVar(&engine, "engine", "", "The codemod engine to run: comby, semgrep or ast-grep.")
+	cmd.Flags().StringVar(&match, "match", "", "The pattern to match, in the syntax of the engine.")
+	cmd.Flags().StringVar(&rewrite, "rewrite", "", "The replacement for each match, in the syntax of the engine.")
+	cmd.Flags().StringVar(&language, "lang", "", "The language to transform, e.g. go (or a file extension such as .go for comby).")
+	cmd.Flags().StringVar(&rulesFile, "rules", "", "A rules file in the format of the engine, used instead of --match and --rewrite.")
+
+	return cmd
+}
+
+// invocation returns the executable and arguments which run the chosen engine over the current directory, rewriting
+// files in place
+func invocation() (string, []string, error) {
+	if rulesFile != "" && (match != "" || rewrite != "") {
+		return "", nil, fmt.Errorf("--rules cannot be combined with --match or --rewrite")
+	}
+	if rulesFile == "" && (match == "" || rewrite == "") {
+		return "", nil, fmt.Errorf("either --rules or both --match and --rewrite must be given")
+	}
+
+	var rules string
+	if rulesFile != "" {
+		// the engine runs from within each working copy
+		var err error
+		if rules, err = filepath.Abs(rulesFile); err == nil {
+			_, err = os.Stat(rules)
+		}
+		if err != nil {
+			return "", nil, fmt.Errorf("unable to read rules file: %w", err)
+		}
+	}
+
+	switch engine {
+	case "comby":
+		if rules != "" {
+			return "comby", []string{"-config", rules, "-in-place"}, nil
+		}
+		args := []string{match, rewrite}
+		if language != "" {
+			args = append(args, language)
+		}
+		return "comby", append(args, "-in-place"), nil
+	case "semgrep":
+		if rules != "" {
+			return "semgrep", []string{"--config", rules, "--autofix", "--quiet", "."}, nil
+		}
+		if language == "" {
+			return "", nil, fmt.Errorf("--lang is required by semgrep when using --match")
+		}
+		return "semgrep", []string{"--pattern", match, "--replacement", rewrite, "--lang", language, "--autofix", "--quiet", "."}, nil
+	case "ast-grep":
+		if rules != "" {
+			return "ast-grep", []string{"scan", "--rule", rules, "--update-all", "."}, nil
+		}
+		args := []string{"run", "--pattern", match, "--rewrite", rewrite}
+		if language != "" {
+			args = append(args, "--lang", language)
+		}
+		return "ast-grep", append(args, "--update-all", "."), nil
+	case "":
+		return "", nil, fmt.Errorf("no codemod engine given - use --engine with one of comby, semgrep or ast-grep")
+	default:
+		return "", nil, fmt.Errorf("unknown codemod engine %s - expected comby, semgrep or ast-grep", engine)
+	}
+}
+
+func run(c *cobra.Command, _ []string) {
+	logger := logging.NewLogger(c)
+
+	readCampaignActivity := logger.StartSetupActivity("Reading campaign data (%s)", repoFile)
+	options := campaign.NewCampaignOptions()
+	options.RepoFilename = repoFile
+	dir, err := campaign.OpenCampaign(options)
+	if err != nil {
+		readCampaignActivity.EndWithFailure(err)
+		return
+	}
+	name, args, err := invocation()
+	if err != nil {
+		readCampaignActivity.EndWithFailure(err)
+		return
+	}
+	readCampaignActivity.EndWithSuccess()
+
+	var changedCount, unchangedCount, skippedCount, errorCount int
+	interrupt.ForEachRepo(logger, dir.Repos, func(repo campaign.Repo) {
+		repoDirPath := repo.FullRepoPath()
+
+		transformActivity := logger.StartActivity("Running %s in %s", engine, repo.FullRepoName)
+		// skip if the working copy does not exist
+		if _, err = os.Stat(repoDirPath); os.IsNotExist(err) {
+			transformActivity.EndWithWarningf("Directory %s does not exist - has it been cloned?", repoDirPath)
+			skippedCount++
+			return
+		}
+
+		if err := exec.Execute(transformActivity.Writer(), repoDirPath, name, args...); err != nil {
+			transformActivity.EndWithFailure(err)
+			errorCount++
+			return
+		}
+
+		changed, err := g.IsRepoChanged(transformActivity.Writer(), repoDirPath)
+		if err != nil {
+			transformActivity.EndWithFailure(err)
+			errorCount++
+		} else if changed {
+			transformActivity.EndWithSuccess()
+			changedCount++
+		} else {
+			transformActivity.EndWithWarning("No changes made")
+			unchangedCount++
+		}
+	})
+
+	if errorCount == 0 {
+		logger.Successf("turbolift transform completed %s(%s, %s, %s)\n", colors.Normal(), colors.Green(changedCount, " changed"), colors.Yellow(unchangedCount, " unchanged"), colors.Yellow(skippedCount, " skipped"))
+	} else {
+		logger.Warnf("turbolift transform completed with %s %s(%s, %s, %s, %s)\n", colors.Red("errors"), colors.Normal(), colors.Green(changedCount, " changed"), colors.Yellow(unchangedCount, " unchanged"), colors.Yellow(skippedCount, " skipped"), colors.Red(errorCount, " errored"))
+	}
+}
@@ -0,0 +1,158 @@
+/*
+ * Copyright 2021 Skyscanner Limited.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * https://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package transform
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/skyscanner/turbolift/internal/executor"
+	"github.com/skyscanner/turbolift/internal/git"
+	"github.com/skyscanner/turbolift/internal/testsupport"
+)
+
+func init() {
+	// disable output colouring so that strings we want to do 'Contains' checks on do not have ANSI escape sequences in IDEs
+	_ = os.Setenv("NO_COLOR", "1")
+}
+
+func TestItRunsCombyAndReportsChangedRepos(t *testing.T) {
+	fakeExecutor := executor.NewAlwaysSucceedsFakeExecutor()
+	exec = fakeExecutor
+	fakeGit := git.NewFakeGit(func(_ io.Writer, call []string) (bool, error) {
+		return call[1] == "work/org/repo1", nil
+	})
+	g = fakeGit
+
+	testsupport.PrepareTempCampaign(true, "org/repo1", "org/repo2")
+
+	out, err := runCommand("--engine", "comby", "--match", "foo(:[x])", "--rewrite", "bar(:[x])", "--lang", ".go")
+	assert.NoError(t, err)
+	assert.Contains(t, out, "Running comby in org/repo1")
+	assert.Contains(t, out, "No changes made")
+	assert.Contains(t, out, "turbolift transform completed (1 changed, 1 unchanged, 0 skipped)")
+
+	fakeExecutor.AssertCalledWith(t, [][]string{
+		{"work/org/repo1", "comby", "foo(:[x])", "bar(:[x])", ".go", "-in-place"},
+		{"work/org/repo2", "comby", "foo(:[x])", "bar(:[x])", ".go", "-in-place"},
+	})
+	fakeGit.AssertCalledWith(t, [][]string{
+		{"isRepoChanged", "work/org/repo1"},
+		{"isRepoChanged", "work/org/repo2"},
+	})
+}
+
+func TestItRunsSemgrepWithARulesFile(t *testing.T) {
+	fakeExecutor := executor.NewAlwaysSucceedsFakeExecutor()
+	exec = fakeExecutor
+	g = git.NewAlwaysSucceedsFakeGit()
+
+	testsupport.PrepareTempCampaign(true, "org/repo1")
+	rules := createRulesFile()
+
+	out, err := runCommand("--engine", "semgrep", "--rules", "rules.yaml")
+	assert.NoError(t, err)
+	assert.Contains(t, out, "turbolift transform completed (1 changed, 0 unchanged, 0 skipped)")
+
+	fakeExecutor.AssertCalledWith(t, [][]string{
+		{"work/org/repo1", "semgrep", "--config", rules, "--autofix", "--quiet", "."},
+	})
+}
+
+func TestItRunsAstGrepWithAPattern(t *testing.T) {
+	fakeExecutor := executor.NewAlwaysSucceedsFakeExecutor()
+	exec = fakeExecutor
+	g = git.NewAlwaysSucceedsFakeGit()
+
+	testsupport.PrepareTempCampaign(true, "org/repo1")
+
+	_, err := runCommand("--engine", "ast-grep", "--match", "foo($A)", "--rewrite", "bar($A)", "--lang", "go")
+	assert.NoError(t, err)
+
+	fakeExecutor.AssertCalledWith(t, [][]string{
+		{"work/org/repo1", "ast-grep", "run", "--pattern", "foo($A)", "--rewrite", "bar($A)", "--lang", "go", "--update-all", "."},
+	})
+}
+
+func TestItSkipsMissingWorkingCopiesAndRecordsFailures(t *testing.T) {
+	fakeExecutor := executor.NewAlwaysFailsFakeExecutor()
+	exec = fakeExecutor
+	g = git.NewAlwaysSucceedsFakeGit()
+
+	testsupport.PrepareTempCampaign(true, "org/repo1", "org/repo2")
+	_ = os.Remove("work/org/repo2")
+
+	out, err := runCommand("--engine", "ast-grep", "--match", "foo($A)", "--rewrite", "bar($A)")
+	assert.NoError(t, err)
+	assert.Contains(t, out, "turbolift transform completed with errors (0 changed, 0 unchanged, 1 skipped, 1 errored)")
+}
+
+func TestItValidatesTheEngineAndRewrite(t *testing.T) {
+	testCases := []struct {
+		Name          string
+		Args          []string
+		ExpectedError string
+	}{
+		{"no engine", []string{"--match", "a", "--rewrite", "b"}, "no codemod engine given"},
+		{"unknown engine", []string{"--engine", "sed", "--match", "a", "--rewrite", "b"}, "unknown codemod engine sed"},
+		{"no rewrite", []string{"--engine", "comby", "--match", "a"}, "either --rules or both --match and --rewrite must be given"},
+		{"rules and match", []string{"--engine", "comby", "--rules", "rules.yaml", "--match", "a"}, "--rules cannot be combined with --match or --rewrite"},
+		{"missing rules file", []string{"--engine", "comby", "--rules", "missing.yaml"}, "unable to read rules file"},
+		{"semgrep without a language", []string{"--engine", "semgrep", "--match", "a", "--rewrite", "b"}, "--lang is required by semgrep"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			fakeExecutor := executor.NewAlwaysSucceedsFakeExecutor()
+			exec = fakeExecutor
+
+			testsupport.PrepareTempCampaign(true, "org/repo1")
+
+			out, err := runCommand(tc.Args...)
+			assert.NoError(t, err)
+			assert.Contains(t, out, tc.ExpectedError)
+
+			fakeExecutor.AssertCalledWith(t, [][]string{})
+		})
+	}
+}
+
+func createRulesFile() string {
+	err := ioutil.WriteFile("rules.yaml", []byte("rules: []\n"), 0o644)
+	if err != nil {
+		panic(err)
+	}
+	cwd, _ := os.Getwd()
+	return filepath.Join(cwd, "rules.yaml")
+}
+
+func runCommand(args ...string) (string, error) {
+	cmd := NewTransformCmd()
+	cmd.SetArgs(args)
+	outBuffer := bytes.NewBufferString("")
+	cmd.SetOut(outBuffer)
+	err := cmd.Execute()
+	if err != nil {
+		return outBuffer.String(), err
+	}
+	return outBuffer.String(), nil
+}
@@ -0,0 +1,215 @@
+/*
+ * Copyright 2021 Skyscanner Limited.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * https://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package undo
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/skyscanner/turbolift/internal/campaign"
+	"github.com/skyscanner/turbolift/internal/colors"
+	"github.com/skyscanner/turbolift/internal/git"
+	"github.com/skyscanner/turbolift/internal/github"
+	"github.com/skyscanner/turbolift/internal/interrupt"
+	"github.com/skyscanner/turbolift/internal/logging"
+	"github.com/skyscanner/turbolift/internal/prompt"
+)
+
+var (
+	gh github.GitHub = github.NewCachingGitHub(github.NewGitHub())
+	g  git.Git       = git.NewRealGit()
+	p  prompt.Prompt = prompt.NewRealPrompt()
+)
+
+var (
+	repoFile     string
+	revertMerged bool
+	dryRun       bool
+)
+
+// step is a single action taken to undo the campaign in a repository
+type step struct {
+	description string
+	run         func(output io.Writer) error
+}
+
+// alreadyDoneError is returned by a step which finds that there is nothing left for it to do
+type alreadyDoneError struct {
+	reason string
+}
+
+func (e *alreadyDoneError) Error() string {
+	return e.reason
+}
+
+func NewUndoCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "undo",
+		Short: "Roll back a campaign by closing its PRs and deleting its branches",
+		Long: `Roll back a campaign: close its open PRs and delete the campaign branch from each repository's origin.
+Merged PRs are left alone unless --revert-merged is used, in which case a PR reverting each of them is opened.
+Each step is confirmed before it is taken, unless --yes is used.`,
+		Run: run,
+	}
+
+	cmd.Flags().StringVar(&repoFile, "repos", "repos.txt", "A file containing a list of repositories to undo the campaign in.")
+	cmd.Flags().BoolVar(&revertMerged, "revert-merged", false, "Open PRs reverting the campaign's PRs which have already been merged.")
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "Only show what would be done, without changing anything.")
+
+	return cmd
+}
+
+func run(c *cobra.Command, _ []string) {
+	logger := logging.NewLogger(c)
+
+	readCampaignActivity := logger.StartSetupActivity("Reading campaign data (%s)", repoFile)
+	options := campaign.NewCampaignOptions()
+	options.RepoFilename = repoFile
+	dir, err := campaign.OpenCampaign(options)
+	if err != nil {
+		readCampaignActivity.EndWithFailure(err)
+		return
+	}
+	readCampaignActivity.EndWithSuccess()
+
+	doneCount := 0
+	skippedCount := 0
+	errorCount := 0
+
+	interrupt.ForEachRepo(logger, dir.Repos, func(repo campaign.Repo) {
+		repoDirPath := repo.FullRepoPath()
+
+		checkActivity := logger.StartActivity("Checking PR in %s", repo.FullRepoName)
+		// skip if the working copy does not exist
+		if _, err = os.Stat(repoDirPath); os.IsNotExist(err) {
+			checkActivity.EndWithWarningf("Directory %s does not exist - has it been cloned?", repoDirPath)
+			skippedCount++
+			return
+		}
+
+		pr, err := gh.GetPR(checkActivity.Writer(), repoDirPath, dir.Name)
+		var noPRFoundError *github.NoPRFoundError
+		if errors.As(err, &noPRFoundError) {
+			checkActivity.EndWithWarning(err)
+			pr = nil
+		} else if err != nil {
+			checkActivity.EndWithFailure(err)
+			errorCount++
+			return
+		} else {
+			checkActivity.EndWithSuccess()
+		}
+
+		steps := undoSteps(repo, repoDirPath, dir.Name, pr)
+		if dryRun {
+			for _, s := range steps {
+				logger.Printf("Would %s", s.description)
+			}
+			skippedCount++
+			return
+		}
+
+		stepsTaken := 0
+		failed := false
+		for _, s := range steps {
+			if !p.AskConfirm(prompt.UndoStep, fmt.Sprintf("%s?", s.description)) {
+				continue
+			}
+			stepActivity := logger.StartActivity(s.description)
+			err := s.run(stepActivity.Writer())
+			var alreadyDone *alreadyDoneError
+			if errors.As(err, &alreadyDone) {
+				stepActivity.EndWithWarning(alreadyDone)
+				stepsTaken++
+				continue
+			}
+			if err != nil {
+				stepActivity.EndWithFailure(err)
+				failed = true
+				break
+			}
+			stepActivity.EndWithSuccess()
+			stepsTaken++
+		}
+
+		if failed {
+			errorCount++
+		} else if stepsTaken == 0 {
+			skippedCount++
+		} else {
+			doneCount++
+		}
+	})
+
+	if dryRun {
+		logger.Successf("turbolift undo dry run completed - nothing was changed\n")
+	} else if errorCount == 0 {
+		logger.Successf("turbolift undo completed %s(%s, %s)\n", colors.Normal(), colors.Green(doneCount, " OK"), colors.Yellow(skippedCount, " skipped"))
+	} else {
+		logger.Warnf("turbolift undo completed with %s %s(%s, %s, %s)\n", colors.Red("errors"), colors.Normal(), colors.Green(doneCount, " OK"), colors.Yellow(skippedCount, " skipped"), colors.Red(errorCount, " errored"))
+	}
+}
+
+// undoSteps returns the steps needed to undo the campaign in a repository, given its PR (if there is one)
+func undoSteps(repo campaign.Repo, repoDirPath string, branchName string, pr *github.PrStatus) []step {
+	var steps []step
+
+	if pr != nil {
+		switch pr.State {
+		case "OPEN":
+			steps = append(steps, step{
+				description: fmt.Sprintf("Close PR #%d in %s", pr.Number, repo.FullRepoName),
+				run: func(output io.Writer) error {
+					return gh.ClosePullRequest(output, repoDirPath, branchName, "")
+				},
+			})
+		case "MERGED":
+			if revertMerged {
+				steps = append(steps, step{
+					description: fmt.Sprintf("Open a PR reverting PR #%d in %s", pr.Number, repo.FullRepoName),
+					run: func(output io.Writer) error {
+						revertUrl, err := gh.RevertPullRequest(output, repoDirPath, pr)
+						if err == nil {
+							_, _ = fmt.Fprintf(output, "Opened %s\n", revertUrl)
+						}
+						return err
+					},
+				})
+			}
+		}
+	}
+
+	steps = append(steps, step{
+		description: fmt.Sprintf("Delete branch %s from origin of %s", branchName, repo.FullRepoName),
+		run: func(output io.Writer) error {
+			// the branch may have been deleted already, e.g. when its PR was merged or by an earlier undo
+			exists, err := g.RemoteBranchExists(output, repoDirPath, "origin", branchName)
+			if err != nil {
+				return err
+			}
+			if !exists {
+				return &alreadyDoneError{reason: fmt.Sprintf("Branch %s is not on origin - nothing to delete", branchName)}
+			}
+			return g.DeleteRemoteBranch(output, repoDirPath, "origin", branchName)
+		},
+	})
+
+	return steps
+}
@@ -0,0 +1,190 @@
+/*
+ * Copyright 2021 Skyscanner Limited.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * https://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package undo
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/skyscanner/turbolift/internal/git"
+	"github.com/skyscanner/turbolift/internal/github"
+	"github.com/skyscanner/turbolift/internal/prompt"
+	"github.com/skyscanner/turbolift/internal/testsupport"
+)
+
+func init() {
+	// disable output colouring so that strings we want to do 'Contains' checks on do not have ANSI escape sequences in IDEs
+	_ = os.Setenv("NO_COLOR", "1")
+}
+
+func TestItClosesOpenPRsAndDeletesBranches(t *testing.T) {
+	fakeGitHub := prepareFakeGitHub()
+	fakeGit := git.NewAlwaysSucceedsFakeGit()
+	g = fakeGit
+	p = prompt.NewFakePromptYes()
+
+	testsupport.PrepareTempCampaign(true, "org/repo1", "org/repo2", "org/repo3")
+
+	out, err := runCommand(false, false)
+	assert.NoError(t, err)
+	assert.Contains(t, out, "Close PR #1 in org/repo1")
+	assert.NotContains(t, out, "reverting")
+	assert.Contains(t, out, "turbolift undo completed (3 OK, 0 skipped)")
+
+	fakeGitHub.AssertCalledWith(t, [][]string{
+		{"work/org/repo1"},
+		{"work/org/repo1", testsupport.Pwd()},
+		{"work/org/repo2"},
+		{"work/org/repo3"},
+	})
+	fakeGit.AssertCalledWith(t, [][]string{
+		{"remoteBranchExists", "work/org/repo1", "origin", testsupport.Pwd()},
+		{"deleteRemoteBranch", "work/org/repo1", "origin", testsupport.Pwd()},
+		{"remoteBranchExists", "work/org/repo2", "origin", testsupport.Pwd()},
+		{"deleteRemoteBranch", "work/org/repo2", "origin", testsupport.Pwd()},
+		{"remoteBranchExists", "work/org/repo3", "origin", testsupport.Pwd()},
+		{"deleteRemoteBranch", "work/org/repo3", "origin", testsupport.Pwd()},
+	})
+}
+
+func TestItTreatsBranchesAlreadyDeletedFromOriginAsDone(t *testing.T) {
+	prepareFakeGitHub()
+	fakeGit := git.NewFakeGit(func(output io.Writer, call []string) (bool, error) {
+		// only repo1 still has the branch on origin
+		return call[0] != "remoteBranchExists" || call[1] == "work/org/repo1", nil
+	})
+	g = fakeGit
+	p = prompt.NewFakePromptYes()
+
+	testsupport.PrepareTempCampaign(true, "org/repo1", "org/repo2")
+
+	out, err := runCommand(false, false)
+	assert.NoError(t, err)
+	assert.Contains(t, out, "is not on origin - nothing to delete")
+	assert.Contains(t, out, "turbolift undo completed (2 OK, 0 skipped)")
+
+	fakeGit.AssertCalledWith(t, [][]string{
+		{"remoteBranchExists", "work/org/repo1", "origin", testsupport.Pwd()},
+		{"deleteRemoteBranch", "work/org/repo1", "origin", testsupport.Pwd()},
+		{"remoteBranchExists", "work/org/repo2", "origin", testsupport.Pwd()},
+	})
+}
+
+func TestItOpensRevertPRsForMergedPRsWhenAsked(t *testing.T) {
+	fakeGitHub := prepareFakeGitHub()
+	g = git.NewAlwaysSucceedsFakeGit()
+	p = prompt.NewFakePromptYes()
+
+	testsupport.PrepareTempCampaign(true, "org/repo2")
+
+	out, err := runCommand(true, false)
+	assert.NoError(t, err)
+	assert.Contains(t, out, "Open a PR reverting PR #2 in org/repo2")
+
+	fakeGitHub.AssertCalledWith(t, [][]string{
+		{"work/org/repo2"},
+		{"work/org/repo2", "PR_2"},
+	})
+}
+
+func TestItDoesNothingWhenStepsAreDeclined(t *testing.T) {
+	fakeGitHub := prepareFakeGitHub()
+	fakeGit := git.NewAlwaysSucceedsFakeGit()
+	g = fakeGit
+	p = prompt.NewFakePromptNo()
+
+	testsupport.PrepareTempCampaign(true, "org/repo1", "org/repo2")
+
+	out, err := runCommand(true, false)
+	assert.NoError(t, err)
+	assert.Contains(t, out, "turbolift undo completed (0 OK, 2 skipped)")
+
+	fakeGitHub.AssertCalledWith(t, [][]string{
+		{"work/org/repo1"},
+		{"work/org/repo2"},
+	})
+	fakeGit.AssertCalledWith(t, [][]string{})
+}
+
+func TestItOnlyDescribesStepsInADryRun(t *testing.T) {
+	fakeGitHub := prepareFakeGitHub()
+	fakeGit := git.NewAlwaysSucceedsFakeGit()
+	g = fakeGit
+	p = prompt.NewFakePromptYes()
+
+	testsupport.PrepareTempCampaign(true, "org/repo1", "org/repo2")
+
+	out, err := runCommand(true, true)
+	assert.NoError(t, err)
+	assert.Contains(t, out, "Would Close PR #1 in org/repo1")
+	assert.Contains(t, out, "Would Open a PR reverting PR #2 in org/repo2")
+	assert.Contains(t, out, "Would Delete branch")
+	assert.Contains(t, out, "nothing was changed")
+
+	fakeGitHub.AssertCalledWith(t, [][]string{
+		{"work/org/repo1"},
+		{"work/org/repo2"},
+	})
+	fakeGit.AssertCalledWith(t, [][]string{})
+}
+
+func TestItReportsFailures(t *testing.T) {
+	prepareFakeGitHub()
+	g = git.NewAlwaysFailsFakeGit()
+	p = prompt.NewFakePromptYes()
+
+	testsupport.PrepareTempCampaign(true, "org/repo1", "org/repoWithError")
+
+	out, err := runCommand(false, false)
+	assert.NoError(t, err)
+	assert.Contains(t, out, "turbolift undo completed with errors (0 OK, 0 skipped, 2 errored)")
+}
+
+func runCommand(revert bool, dry bool) (string, error) {
+	cmd := NewUndoCmd()
+	revertMerged = revert
+	dryRun = dry
+	outBuffer := bytes.NewBufferString("")
+	cmd.SetOut(outBuffer)
+	err := cmd.Execute()
+	if err != nil {
+		return outBuffer.String(), err
+	}
+	return outBuffer.String(), nil
+}
+
+func prepareFakeGitHub() *github.FakeGitHub {
+	prs := map[string]*github.PrStatus{
+		"work/org/repo1": {Id: "PR_1", Number: 1, State: "OPEN"},
+		"work/org/repo2": {Id: "PR_2", Number: 2, State: "MERGED"},
+		"work/org/repo3": {Id: "PR_3", Number: 3, State: "CLOSED"},
+	}
+	fakeGitHub := github.NewFakeGitHub(func(command github.Command, args []string) (bool, error) {
+		return true, nil
+	}, func(workingDir string) (interface{}, error) {
+		if workingDir == "work/org/repoWithError" {
+			return nil, errors.New("synthetic error")
+		}
+		return prs[workingDir], nil
+	})
+	gh = fakeGitHub
+	return fakeGitHub
+}
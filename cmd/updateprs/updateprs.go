@@ -18,26 +18,40 @@ package updateprs
 import (
 	"errors"
 	"fmt"
+	"io/ioutil"
 	"os"
+	"strings"
 
 	"github.com/spf13/cobra"
 
 	"github.com/skyscanner/turbolift/internal/campaign"
+	"github.com/skyscanner/turbolift/internal/changes"
 	"github.com/skyscanner/turbolift/internal/colors"
+	"github.com/skyscanner/turbolift/internal/git"
 	"github.com/skyscanner/turbolift/internal/github"
+	"github.com/skyscanner/turbolift/internal/interrupt"
 	"github.com/skyscanner/turbolift/internal/logging"
 	"github.com/skyscanner/turbolift/internal/prompt"
+	"github.com/skyscanner/turbolift/internal/prtemplate"
 )
 
 var (
-	gh github.GitHub = github.NewRealGitHub()
+	gh github.GitHub = github.NewCachingGitHub(github.NewGitHub())
+	g  git.Git       = git.NewRealGit()
 	p  prompt.Prompt = prompt.NewRealPrompt()
 )
 
 var (
-	closeFlag bool
-	yesFlag   bool
-	repoFile  string
+	closeFlag            bool
+	amendDescriptionFlag bool
+	repoFile             string
+	descriptionFile      string
+	appendDiffstat       bool
+	useRepoTemplate      bool
+	closeComment         string
+	closeCommentFile     string
+	addLabel             string
+	removeLabel          string
 )
 
 func NewUpdatePRsCmd() *cobra.Command {
@@ -48,7 +62,14 @@ func NewUpdatePRsCmd() *cobra.Command {
 	}
 
 	cmd.Flags().BoolVar(&closeFlag, "close", false, "Close all generated PRs")
-	cmd.Flags().BoolVar(&yesFlag, "yes", false, "Skips the confirmation prompt")
+	cmd.Flags().BoolVar(&amendDescriptionFlag, "amend-description", false, "Update the title and description of all generated PRs")
+	cmd.Flags().StringVar(&descriptionFile, "description-file", "README.md", "A Markdown file containing the title and description to use with --amend-description.")
+	cmd.Flags().BoolVar(&appendDiffstat, "append-diffstat", false, "With --amend-description, append a summary of the changes made in each repository to its PR description.")
+	cmd.Flags().BoolVar(&useRepoTemplate, "use-repo-template", false, "With --amend-description, fill in each repository's own PR template with the description instead of replacing it.")
+	cmd.Flags().StringVar(&closeComment, "comment", "", "With --close, a comment explaining why the PRs are being closed, left on each PR before it is closed.")
+	cmd.Flags().StringVar(&closeCommentFile, "comment-file", "", "With --close, a Markdown file containing the comment to leave on each PR before it is closed.")
+	cmd.Flags().StringVar(&addLabel, "add-label", "", "Add a label to all generated PRs, creating it in each repository where it does not exist yet")
+	cmd.Flags().StringVar(&removeLabel, "remove-label", "", "Remove a label from all generated PRs")
 	cmd.Flags().StringVar(&repoFile, "repos", "repos.txt", "A file containing a list of repositories to clone.")
 
 	return cmd
@@ -67,31 +88,50 @@ func onlyOne(args ...bool) bool {
 	return b[true] == 1
 }
 
-func validateFlags(closeFlag bool) error {
-	// only option at the moment is `close`
-	if !onlyOne(closeFlag) {
+func validateFlags(closeFlag bool, amendDescriptionFlag bool, addLabel string, removeLabel string) error {
+	if !onlyOne(closeFlag, amendDescriptionFlag, addLabel != "", removeLabel != "") {
 		return errors.New("update-prs needs one and only one action flag")
 	}
 	return nil
 }
 
+func validateCommentFlags(closeFlag bool, comment string, commentFile string) error {
+	if comment != "" && commentFile != "" {
+		return errors.New("only one of --comment and --comment-file can be given")
+	}
+	if (comment != "" || commentFile != "") && !closeFlag {
+		return errors.New("--comment and --comment-file can only be used with --close")
+	}
+	return nil
+}
+
 // we keep the args as one of the subfunctions might need it one day.
 func run(c *cobra.Command, args []string) {
 	logger := logging.NewLogger(c)
-	if err := validateFlags(closeFlag); err != nil {
-		logger.Errorf("Error while parsing the flags: %v", err)
+	if err := validateFlags(closeFlag, amendDescriptionFlag, addLabel, removeLabel); err != nil {
+		logger.FlagErrorf("%v", err)
+		return
+	}
+	if err := validateCommentFlags(closeFlag, closeComment, closeCommentFile); err != nil {
+		logger.FlagErrorf("%v", err)
 		return
 	}
 
 	if closeFlag {
 		runClose(c, args)
 	}
+	if amendDescriptionFlag {
+		runAmendDescription(c, args)
+	}
+	if addLabel != "" || removeLabel != "" {
+		runUpdateLabels(c, args)
+	}
 }
 
 func runClose(c *cobra.Command, _ []string) {
 	logger := logging.NewLogger(c)
 
-	readCampaignActivity := logger.StartActivity("Reading campaign data (%s)", repoFile)
+	readCampaignActivity := logger.StartSetupActivity("Reading campaign data (%s)", repoFile)
 	options := campaign.NewCampaignOptions()
 	options.RepoFilename = repoFile
 	dir, err := campaign.OpenCampaign(options)
@@ -99,12 +139,25 @@ func runClose(c *cobra.Command, _ []string) {
 		readCampaignActivity.EndWithFailure(err)
 		return
 	}
+	comment := closeComment
+	if closeCommentFile != "" {
+		contents, err := ioutil.ReadFile(closeCommentFile)
+		if err != nil {
+			readCampaignActivity.EndWithFailure(fmt.Errorf("unable to read comment file: %w", err))
+			return
+		}
+		comment = strings.TrimSpace(string(contents))
+	}
 	readCampaignActivity.EndWithSuccess()
 
 	// Prompting for confirmation
-	if !yesFlag {
+	if !prompt.AssumeYes() {
 		// TODO: add the number of PRs that it will actually close
-		if !p.AskConfirm(fmt.Sprintf("Close all PRs from the %s campaign?", dir.Name)) {
+		question := fmt.Sprintf("Close all PRs from the %s campaign?", dir.Name)
+		if comment != "" {
+			question = fmt.Sprintf("Close all PRs from the %s campaign, leaving a comment on each?", dir.Name)
+		}
+		if !p.AskConfirm(prompt.ClosePRs, question) {
 			return
 		}
 	}
@@ -113,17 +166,16 @@ func runClose(c *cobra.Command, _ []string) {
 	skippedCount := 0
 	errorCount := 0
 
-	for _, repo := range dir.Repos {
-
+	interrupt.ForEachRepo(logger, dir.Repos, func(repo campaign.Repo) {
 		closeActivity := logger.StartActivity("Closing PR in %s", repo.FullRepoName)
 		// skip if the working copy does not exist
 		if _, err = os.Stat(repo.FullRepoPath()); os.IsNotExist(err) {
 			closeActivity.EndWithWarningf("Directory %s does not exist - has it been cloned?", repo.FullRepoPath())
 			skippedCount++
-			continue
+			return
 		}
 
-		err = gh.ClosePullRequest(closeActivity.Writer(), repo.FullRepoPath(), dir.Name)
+		err = gh.ClosePullRequest(closeActivity.Writer(), repo.FullRepoPath(), dir.Name, comment)
 		if err != nil {
 			if _, ok := err.(*github.NoPRFoundError); ok {
 				closeActivity.EndWithWarning(err)
@@ -136,8 +188,172 @@ func runClose(c *cobra.Command, _ []string) {
 			closeActivity.EndWithSuccess()
 			doneCount++
 		}
+	})
+
+	if errorCount == 0 {
+		logger.Successf("turbolift update-prs completed %s(%s, %s)\n", colors.Normal(), colors.Green(doneCount, " OK"), colors.Yellow(skippedCount, " skipped"))
+	} else {
+		logger.Warnf("turbolift update-prs completed with %s %s(%s, %s, %s)\n", colors.Red("errors"), colors.Normal(), colors.Green(doneCount, " OK"), colors.Yellow(skippedCount, " skipped"), colors.Red(errorCount, " errored"))
+	}
+}
+
+func runAmendDescription(c *cobra.Command, _ []string) {
+	logger := logging.NewLogger(c)
+
+	readCampaignActivity := logger.StartSetupActivity("Reading campaign data (%s, %s)", repoFile, descriptionFile)
+	options := campaign.NewCampaignOptions()
+	options.RepoFilename = repoFile
+	options.PrDescriptionFilename = descriptionFile
+	dir, err := campaign.OpenCampaign(options)
+	if err != nil {
+		readCampaignActivity.EndWithFailure(err)
+		return
+	}
+	readCampaignActivity.EndWithSuccess()
+
+	// Prompting for confirmation
+	if !prompt.AssumeYes() {
+		if !p.AskConfirm(prompt.UpdateDescriptions, fmt.Sprintf("Update the title and description of all PRs from the %s campaign using %s?", dir.Name, descriptionFile)) {
+			return
+		}
 	}
 
+	doneCount := 0
+	skippedCount := 0
+	errorCount := 0
+
+	interrupt.ForEachRepo(logger, dir.Repos, func(repo campaign.Repo) {
+		amendActivity := logger.StartActivity("Updating PR description in %s", repo.FullRepoName)
+		// skip if the working copy does not exist
+		if _, err = os.Stat(repo.FullRepoPath()); os.IsNotExist(err) {
+			amendActivity.EndWithWarningf("Directory %s does not exist - has it been cloned?", repo.FullRepoPath())
+			skippedCount++
+			return
+		}
+
+		body := dir.PrBody
+		if useRepoTemplate {
+			if body, _, err = prtemplate.Fill(repo.FullRepoPath(), body); err != nil {
+				amendActivity.EndWithFailure(err)
+				errorCount++
+				return
+			}
+		}
+		if appendDiffstat {
+			summary, err := changes.Summarise(amendActivity.Writer(), g, gh, repo)
+			if err != nil {
+				amendActivity.EndWithFailure(err)
+				errorCount++
+				return
+			}
+			body = summary.AppendTo(body)
+		}
+
+		err = gh.UpdatePRDescription(amendActivity.Writer(), repo.FullRepoPath(), dir.Name, dir.PrTitle, body)
+		if err != nil {
+			if _, ok := err.(*github.NoPRFoundError); ok {
+				amendActivity.EndWithWarning(err)
+				skippedCount++
+			} else {
+				amendActivity.EndWithFailure(err)
+				errorCount++
+			}
+		} else {
+			amendActivity.EndWithSuccess()
+			doneCount++
+		}
+	})
+
+	if errorCount == 0 {
+		logger.Successf("turbolift update-prs completed %s(%s, %s)\n", colors.Normal(), colors.Green(doneCount, " OK"), colors.Yellow(skippedCount, " skipped"))
+	} else {
+		logger.Warnf("turbolift update-prs completed with %s %s(%s, %s, %s)\n", colors.Red("errors"), colors.Normal(), colors.Green(doneCount, " OK"), colors.Yellow(skippedCount, " skipped"), colors.Red(errorCount, " errored"))
+	}
+}
+
+func runUpdateLabels(c *cobra.Command, _ []string) {
+	logger := logging.NewLogger(c)
+
+	readCampaignActivity := logger.StartSetupActivity("Reading campaign data (%s)", repoFile)
+	options := campaign.NewCampaignOptions()
+	options.RepoFilename = repoFile
+	dir, err := campaign.OpenCampaign(options)
+	if err != nil {
+		readCampaignActivity.EndWithFailure(err)
+		return
+	}
+	readCampaignActivity.EndWithSuccess()
+
+	var add, remove []string
+	var question, activityFormat string
+	if addLabel != "" {
+		capabilityActivity := logger.StartActivity("Checking gh supports %s", github.LabelsCapability.Feature)
+		if err := gh.CheckCapability(capabilityActivity.Writer(), github.LabelsCapability); err != nil {
+			capabilityActivity.EndWithFailure(err)
+			return
+		}
+		capabilityActivity.EndWithSuccess()
+
+		add = []string{addLabel}
+		question = fmt.Sprintf("Add the %s label to all PRs from the %s campaign?", addLabel, dir.Name)
+		activityFormat = "Adding label " + addLabel + " to PR in %s"
+	} else {
+		remove = []string{removeLabel}
+		question = fmt.Sprintf("Remove the %s label from all PRs from the %s campaign?", removeLabel, dir.Name)
+		activityFormat = "Removing label " + removeLabel + " from PR in %s"
+	}
+
+	// Prompting for confirmation
+	if !prompt.AssumeYes() {
+		if !p.AskConfirm(prompt.UpdateLabels, question) {
+			return
+		}
+	}
+
+	doneCount := 0
+	skippedCount := 0
+	errorCount := 0
+
+	interrupt.ForEachRepo(logger, dir.Repos, func(repo campaign.Repo) {
+		labelActivity := logger.StartActivity(activityFormat, repo.FullRepoName)
+		// skip if the working copy does not exist
+		if _, err = os.Stat(repo.FullRepoPath()); os.IsNotExist(err) {
+			labelActivity.EndWithWarningf("Directory %s does not exist - has it been cloned?", repo.FullRepoPath())
+			skippedCount++
+			return
+		}
+
+		if addLabel != "" {
+			created, err := gh.EnsureLabel(labelActivity.Writer(), repo.FullRepoPath(), repo.FullRepoName, github.Label{
+				Name:        addLabel,
+				Color:       github.DefaultLabelColor,
+				Description: github.DefaultLabelDescription,
+			})
+			if err != nil {
+				labelActivity.EndWithFailure(err)
+				errorCount++
+				return
+			}
+			if created {
+				labelActivity.Logf("Created the %s label in %s", addLabel, repo.FullRepoName)
+			}
+		}
+
+		err = gh.UpdatePRLabels(labelActivity.Writer(), repo.FullRepoPath(), dir.Name, add, remove)
+		if err != nil {
+			if _, ok := err.(*github.NoPRFoundError); ok {
+				labelActivity.EndWithWarning(err)
+				skippedCount++
+			} else {
+				labelActivity.EndWithFailure(err)
+				errorCount++
+			}
+		} else {
+			labelActivity.EndWithSuccessAndEmitLogs()
+			doneCount++
+		}
+	})
+
 	if errorCount == 0 {
 		logger.Successf("turbolift update-prs completed %s(%s, %s)\n", colors.Normal(), colors.Green(doneCount, " OK"), colors.Yellow(skippedCount, " skipped"))
 	} else {
@@ -2,11 +2,14 @@ package updateprs
 
 import (
 	"bytes"
+	"io/ioutil"
 	"path/filepath"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
 
+	"github.com/skyscanner/turbolift/cmd/flags"
+	"github.com/skyscanner/turbolift/internal/git"
 	"github.com/skyscanner/turbolift/internal/github"
 	"github.com/skyscanner/turbolift/internal/prompt"
 	"github.com/skyscanner/turbolift/internal/testsupport"
@@ -88,10 +91,233 @@ func TestItDoesNotClosePRsIfNotConfirmed(t *testing.T) {
 	fakeGitHub.AssertCalledWith(t, [][]string{})
 }
 
+func TestItAmendsDescriptionsFromTheGivenFile(t *testing.T) {
+	fakeGitHub := github.NewAlwaysSucceedsFakeGitHub()
+	gh = fakeGitHub
+
+	tempDir := testsupport.PrepareTempCampaign(true, "org/repo1", "org/repo2")
+	testsupport.CreateAnotherPrDescriptionFile("short.md", "Short PR title", "Short PR body")
+
+	out, err := runAmendDescriptionCommandAuto("short.md")
+	assert.NoError(t, err)
+	assert.Contains(t, out, "Reading campaign data (repos.txt, short.md)")
+	assert.Contains(t, out, "Updating PR description in org/repo1")
+	assert.Contains(t, out, "turbolift update-prs completed")
+	assert.Contains(t, out, "2 OK")
+
+	fakeGitHub.AssertCalledWith(t, [][]string{
+		{"work/org/repo1", filepath.Base(tempDir), "Short PR title"},
+		{"work/org/repo2", filepath.Base(tempDir), "Short PR title"},
+	})
+}
+
+func TestItAppendsDiffstatsWhenAmendingDescriptions(t *testing.T) {
+	fakeGitHub := github.NewAlwaysSucceedsFakeGitHub()
+	gh = fakeGitHub
+	fakeGit := git.NewAlwaysSucceedsFakeGit()
+	g = fakeGit
+
+	tempDir := testsupport.PrepareTempCampaign(true, "org/repo1")
+
+	out, err := runAmendDescriptionCommandAuto("README.md", "--append-diffstat")
+	assert.NoError(t, err)
+	assert.Contains(t, out, "1 OK")
+
+	fakeGitHub.AssertCalledWith(t, [][]string{
+		{"work/org/repo1", "org/repo1"},
+		{"work/org/repo1", filepath.Base(tempDir), "PR title"},
+	})
+	fakeGit.AssertCalledWith(t, [][]string{
+		{"remotes", "work/org/repo1"},
+		{"fetch", "work/org/repo1", "origin", "main"},
+		{"diffNumstat", "work/org/repo1", "origin/main"},
+	})
+}
+
+func TestItFailsToAmendDescriptionsFromAMissingFile(t *testing.T) {
+	fakeGitHub := github.NewAlwaysSucceedsFakeGitHub()
+	gh = fakeGitHub
+
+	testsupport.PrepareTempCampaign(true, "org/repo1")
+
+	out, err := runAmendDescriptionCommandAuto("missing.md")
+	assert.NoError(t, err)
+	assert.Contains(t, out, "missing.md")
+	assert.NotContains(t, out, "turbolift update-prs completed")
+
+	fakeGitHub.AssertCalledWith(t, [][]string{})
+}
+
+func TestItLeavesACommentWhenClosingPrs(t *testing.T) {
+	fakeGitHub := github.NewAlwaysSucceedsFakeGitHub()
+	gh = fakeGitHub
+
+	tempDir := testsupport.PrepareTempCampaign(true, "org/repo1")
+
+	out, err := runCommandAuto("--close", "--comment", "Superseded by another campaign")
+	assert.NoError(t, err)
+	assert.Contains(t, out, "1 OK")
+
+	fakeGitHub.AssertCalledWith(t, [][]string{
+		{"work/org/repo1", filepath.Base(tempDir), "Superseded by another campaign"},
+	})
+}
+
+func TestItReadsTheClosingCommentFromAFile(t *testing.T) {
+	fakeGitHub := github.NewAlwaysSucceedsFakeGitHub()
+	gh = fakeGitHub
+
+	tempDir := testsupport.PrepareTempCampaign(true, "org/repo1")
+	if err := ioutil.WriteFile("closing.md", []byte("This change is no longer needed.\n"), 0o644); err != nil {
+		panic(err)
+	}
+
+	_, err := runCommandAuto("--close", "--comment-file", "closing.md")
+	assert.NoError(t, err)
+
+	fakeGitHub.AssertCalledWith(t, [][]string{
+		{"work/org/repo1", filepath.Base(tempDir), "This change is no longer needed."},
+	})
+}
+
+func TestItRejectsInvalidCommentFlags(t *testing.T) {
+	fakeGitHub := github.NewAlwaysSucceedsFakeGitHub()
+	gh = fakeGitHub
+
+	testsupport.PrepareTempCampaign(true, "org/repo1")
+
+	out, err := runCommandAuto("--close", "--comment", "a", "--comment-file", "closing.md")
+	assert.NoError(t, err)
+	assert.Contains(t, out, "only one of --comment and --comment-file can be given")
+
+	out, err = runCommandAuto("--amend-description", "--comment", "a")
+	assert.NoError(t, err)
+	assert.Contains(t, out, "--comment and --comment-file can only be used with --close")
+
+	out, err = runCommandAuto("--close", "--comment-file", "missing.md")
+	assert.NoError(t, err)
+	assert.Contains(t, out, "unable to read comment file")
+
+	fakeGitHub.AssertCalledWith(t, [][]string{})
+}
+
+func TestItRejectsMoreThanOneAction(t *testing.T) {
+	fakeGitHub := github.NewAlwaysSucceedsFakeGitHub()
+	gh = fakeGitHub
+
+	testsupport.PrepareTempCampaign(true, "org/repo1")
+
+	cmd := NewUpdatePRsCmd()
+	closeFlag, amendDescriptionFlag = true, true
+	defer func() { amendDescriptionFlag = false }()
+	outBuffer := bytes.NewBufferString("")
+	cmd.SetOut(outBuffer)
+	assert.NoError(t, cmd.Execute())
+	assert.Contains(t, outBuffer.String(), "update-prs needs one and only one action flag")
+
+	fakeGitHub.AssertCalledWith(t, [][]string{})
+}
+
+func TestItAddsLabelsToPrs(t *testing.T) {
+	fakeGitHub := github.NewAlwaysSucceedsFakeGitHub()
+	gh = fakeGitHub
+
+	tempDir := testsupport.PrepareTempCampaign(true, "org/repo1", "org/repo2")
+
+	out, err := runCommandAuto("--add-label", "migration")
+	assert.NoError(t, err)
+	assert.Contains(t, out, "Adding label migration to PR in org/repo1")
+	assert.Contains(t, out, "Created the migration label in org/repo1")
+	assert.Contains(t, out, "turbolift update-prs completed (2 OK, 0 skipped)")
+
+	fakeGitHub.AssertCalledWith(t, [][]string{
+		{"work/org/repo1", "org/repo1", "migration"},
+		{"work/org/repo1", filepath.Base(tempDir), "+migration"},
+		{"work/org/repo2", "org/repo2", "migration"},
+		{"work/org/repo2", filepath.Base(tempDir), "+migration"},
+	})
+}
+
+func TestItRemovesLabelsFromPrs(t *testing.T) {
+	fakeGitHub := github.NewAlwaysSucceedsFakeGitHub()
+	gh = fakeGitHub
+
+	tempDir := testsupport.PrepareTempCampaign(true, "org/repo1")
+
+	out, err := runCommandAuto("--remove-label", "wip")
+	assert.NoError(t, err)
+	assert.Contains(t, out, "Removing label wip from PR in org/repo1")
+	assert.Contains(t, out, "turbolift update-prs completed (1 OK, 0 skipped)")
+
+	fakeGitHub.AssertCalledWith(t, [][]string{
+		{"work/org/repo1", filepath.Base(tempDir), "-wip"},
+	})
+}
+
+func TestItSkipsReposWithoutAPrWhenLabelling(t *testing.T) {
+	fakeGitHub := github.NewFakeGitHub(func(command github.Command, args []string) (bool, error) {
+		if command == github.UpdatePRLabels {
+			return false, &github.NoPRFoundError{Path: args[0], BranchName: args[1]}
+		}
+		return false, nil
+	}, nil)
+	gh = fakeGitHub
+
+	testsupport.PrepareTempCampaign(true, "org/repo1")
+
+	out, err := runCommandAuto("--add-label", "migration")
+	assert.NoError(t, err)
+	assert.NotContains(t, out, "Created the migration label")
+	assert.Contains(t, out, "turbolift update-prs completed (0 OK, 1 skipped)")
+}
+
+func TestItRejectsAddingAndRemovingLabelsTogether(t *testing.T) {
+	fakeGitHub := github.NewAlwaysSucceedsFakeGitHub()
+	gh = fakeGitHub
+
+	testsupport.PrepareTempCampaign(true, "org/repo1")
+
+	out, err := runCommandAuto("--add-label", "migration", "--remove-label", "wip")
+	assert.NoError(t, err)
+	assert.Contains(t, out, "update-prs needs one and only one action flag")
+
+	fakeGitHub.AssertCalledWith(t, [][]string{})
+}
+
+func runAmendDescriptionCommandAuto(filename string, args ...string) (string, error) {
+	cmd := NewUpdatePRsCmd()
+	cmd.SetArgs(args)
+	closeFlag = false
+	amendDescriptionFlag = true
+	defer func() { amendDescriptionFlag = false }()
+	descriptionFile = filename
+	flags.Yes = true
+	outBuffer := bytes.NewBufferString("")
+	cmd.SetOut(outBuffer)
+	err := cmd.Execute()
+	if err != nil {
+		return outBuffer.String(), err
+	}
+	return outBuffer.String(), nil
+}
+
+func runCommandAuto(args ...string) (string, error) {
+	cmd := NewUpdatePRsCmd()
+	cmd.SetArgs(args)
+	flags.Yes = true
+	outBuffer := bytes.NewBufferString("")
+	cmd.SetOut(outBuffer)
+	err := cmd.Execute()
+	if err != nil {
+		return outBuffer.String(), err
+	}
+	return outBuffer.String(), nil
+}
+
 func runCloseCommandAuto() (string, error) {
 	cmd := NewUpdatePRsCmd()
 	closeFlag = true
-	yesFlag = true
+	flags.Yes = true
 	outBuffer := bytes.NewBufferString("")
 	cmd.SetOut(outBuffer)
 	err := cmd.Execute()
@@ -104,7 +330,7 @@ func runCloseCommandAuto() (string, error) {
 func runCloseCommandConfirm() (string, error) {
 	cmd := NewUpdatePRsCmd()
 	closeFlag = true
-	yesFlag = false
+	flags.Yes = false
 	outBuffer := bytes.NewBufferString("")
 	cmd.SetOut(outBuffer)
 	err := cmd.Execute()
@@ -0,0 +1,96 @@
+/*
+ * Copyright 2021 Skyscanner Limited.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * https://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package upgrade
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+
+	"github.com/skyscanner/turbolift/internal/colors"
+	"github.com/skyscanner/turbolift/internal/logging"
+	"github.com/skyscanner/turbolift/internal/upgrade"
+)
+
+var (
+	latestRelease = upgrade.LatestRelease
+	install       = upgrade.Install
+	executable    = os.Executable
+)
+
+var (
+	checkOnly bool
+	force     bool
+)
+
+func NewUpgradeCmd(currentVersion string) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "upgrade",
+		Short: "Upgrade turbolift to the latest release",
+		Run: func(c *cobra.Command, args []string) {
+			run(c, currentVersion)
+		},
+	}
+
+	cmd.Flags().BoolVar(&checkOnly, "check", false, "Only check whether a newer release is available, without installing it.")
+	cmd.Flags().BoolVar(&force, "force", false, "Install the latest release even if it is not newer than the running version, e.g. for development builds.")
+
+	return cmd
+}
+
+func run(c *cobra.Command, currentVersion string) {
+	logger := logging.NewLogger(c)
+
+	checkActivity := logger.StartActivity("Checking for the latest release")
+	release, err := latestRelease()
+	if err != nil {
+		checkActivity.EndWithFailure(err)
+		return
+	}
+	checkActivity.EndWithSuccess()
+
+	if !upgrade.IsNewer(release.Version(), currentVersion) && !force {
+		if upgrade.IsRelease(currentVersion) {
+			logger.Successf("turbolift %s is already the latest release", currentVersion)
+		} else {
+			logger.Warnf("turbolift %s is a development build; use --force to replace it with release %s", currentVersion, release.Version())
+		}
+		return
+	}
+
+	if checkOnly {
+		logger.Printf("turbolift %s is available (running %s). Run %s to install it.", colors.Green(release.Version()), currentVersion, colors.Cyan("turbolift upgrade"))
+		return
+	}
+
+	installActivity := logger.StartActivity("Installing turbolift %s", release.Version())
+	executablePath, err := executable()
+	if err == nil {
+		executablePath, err = filepath.EvalSymlinks(executablePath)
+	}
+	if err != nil {
+		installActivity.EndWithFailure(err)
+		return
+	}
+	if err := install(release, executablePath); err != nil {
+		installActivity.EndWithFailure(err)
+		return
+	}
+	installActivity.EndWithSuccess()
+
+	logger.Successf("turbolift upgraded from %s to %s", currentVersion, release.Version())
+}
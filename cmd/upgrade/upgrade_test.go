@@ -0,0 +1,107 @@
+/*
+ * Copyright 2021 Skyscanner Limited.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * https://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package upgrade
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/skyscanner/turbolift/internal/upgrade"
+)
+
+func TestItInstallsANewerRelease(t *testing.T) {
+	installed := fakeRelease("v1.3.0")
+
+	out, err := runCommand("1.2.0")
+	assert.NoError(t, err)
+	assert.Contains(t, out, "Installing turbolift 1.3.0")
+	assert.Contains(t, out, "turbolift upgraded from 1.2.0 to 1.3.0")
+	assert.Equal(t, []string{"1.3.0"}, *installed)
+}
+
+func TestItDoesNothingWhenAlreadyUpToDate(t *testing.T) {
+	installed := fakeRelease("v1.2.0")
+
+	out, err := runCommand("1.2.0")
+	assert.NoError(t, err)
+	assert.Contains(t, out, "turbolift 1.2.0 is already the latest release")
+	assert.Empty(t, *installed)
+}
+
+func TestItOnlyReportsNewerReleasesWhenChecking(t *testing.T) {
+	installed := fakeRelease("v1.3.0")
+
+	out, err := runCommand("1.2.0", "--check")
+	assert.NoError(t, err)
+	assert.Contains(t, out, "turbolift 1.3.0 is available (running 1.2.0)")
+	assert.Empty(t, *installed)
+}
+
+func TestItDoesNotReplaceDevelopmentBuildsUnlessForced(t *testing.T) {
+	installed := fakeRelease("v1.3.0")
+
+	out, err := runCommand("version-dev")
+	assert.NoError(t, err)
+	assert.Contains(t, out, "development build")
+	assert.Empty(t, *installed)
+
+	out, err = runCommand("version-dev", "--force")
+	assert.NoError(t, err)
+	assert.Contains(t, out, "turbolift upgraded from version-dev to 1.3.0")
+	assert.Equal(t, []string{"1.3.0"}, *installed)
+}
+
+func TestItReportsFailureToCheckTheLatestRelease(t *testing.T) {
+	latestRelease = func() (upgrade.Release, error) {
+		return upgrade.Release{}, errors.New("synthetic error")
+	}
+
+	out, err := runCommand("1.2.0")
+	assert.NoError(t, err)
+	assert.Contains(t, out, "Checking for the latest release")
+	assert.Contains(t, out, "synthetic error")
+}
+
+func fakeRelease(tag string) *[]string {
+	var installed []string
+	latestRelease = func() (upgrade.Release, error) {
+		return upgrade.Release{TagName: tag}, nil
+	}
+	install = func(release upgrade.Release, _ string) error {
+		installed = append(installed, release.Version())
+		return nil
+	}
+	executable = func() (string, error) {
+		return ".", nil
+	}
+	return &installed
+}
+
+func runCommand(currentVersion string, args ...string) (string, error) {
+	checkOnly, force = false, false
+	cmd := NewUpgradeCmd(currentVersion)
+	cmd.SetArgs(args)
+	outBuffer := bytes.NewBufferString("")
+	cmd.SetOut(outBuffer)
+	err := cmd.Execute()
+	if err != nil {
+		return outBuffer.String(), err
+	}
+	return outBuffer.String(), nil
+}
@@ -0,0 +1,123 @@
+/*
+ * Copyright 2021 Skyscanner Limited.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * https://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/skyscanner/turbolift/cmd/flags"
+	"github.com/skyscanner/turbolift/internal/campaign"
+)
+
+// allVariants is the --variant value which runs a command once for each variant of the campaign
+const allVariants = "all"
+
+// selectVariant narrows the configuration down to the variant given with --variant, and makes the campaign work on its
+// branch and working copies
+func selectVariant() error {
+	selected, variant, err := cfg.ForVariant(flags.Variant)
+	if err != nil {
+		return err
+	}
+	cfg = selected
+	campaign.UseVariant(&campaign.Variant{
+		Name:         flags.Variant,
+		BranchSuffix: variant.BranchSuffix,
+		Params:       variant.Params,
+	})
+	return nil
+}
+
+// runForAllVariants replaces the command with one which runs turbolift again for each variant of the campaign in turn,
+// with the same arguments other than --variant
+func runForAllVariants(c *cobra.Command) error {
+	names := cfg.VariantNames()
+	if len(names) == 0 {
+		return fmt.Errorf("--variant %s was given, but no variants are configured in turbolift.yaml", allVariants)
+	}
+
+	self, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("unable to find the turbolift executable to run for each variant: %w", err)
+	}
+
+	c.Run = nil
+	c.RunE = func(c *cobra.Command, _ []string) error {
+		var failed []string
+		var codes []int
+		for _, name := range names {
+			fmt.Fprintf(c.OutOrStdout(), "Running for variant %s\n", name)
+			run := exec.Command(self, argsForVariant(os.Args[1:], name)...)
+			run.Stdin = os.Stdin
+			run.Stdout = c.OutOrStdout()
+			run.Stderr = c.ErrOrStderr()
+			code := exitSuccess
+			if err := run.Run(); err != nil {
+				failed = append(failed, name)
+				code = exitFailure
+				var exitErr *exec.ExitError
+				if errors.As(err, &exitErr) && exitErr.ExitCode() > 0 {
+					code = exitErr.ExitCode()
+				}
+			}
+			codes = append(codes, code)
+		}
+		if len(failed) > 0 {
+			return &exitCodeError{
+				code: worstExitCode(codes),
+				err:  fmt.Errorf("the command failed for variants: %s", strings.Join(failed, ", ")),
+			}
+		}
+		return nil
+	}
+	return nil
+}
+
+// argsForVariant returns the arguments with the value of --variant replaced by the given variant
+func argsForVariant(args []string, name string) []string {
+	var result []string
+	for i := 0; i < len(args); i++ {
+		switch {
+		case args[i] == "--variant" && i+1 < len(args):
+			result = append(result, args[i], name)
+			i++
+		case strings.HasPrefix(args[i], "--variant="):
+			result = append(result, "--variant="+name)
+		default:
+			result = append(result, args[i])
+		}
+	}
+	return result
+}
+
+// variantArg finds the value of --variant among the arguments of a command which parses its own flags, up to any --
+func variantArg(args []string) string {
+	for i := 0; i < len(args) && args[i] != "--"; i++ {
+		if args[i] == "--variant" && i+1 < len(args) {
+			return args[i+1]
+		}
+		if strings.HasPrefix(args[i], "--variant=") {
+			return strings.TrimPrefix(args[i], "--variant=")
+		}
+	}
+	return flags.Variant
+}
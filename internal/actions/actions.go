@@ -0,0 +1,114 @@
+/*
+ * Copyright 2021 Skyscanner Limited.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * https://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package actions
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/skyscanner/turbolift/internal/campaign"
+	"github.com/skyscanner/turbolift/internal/logging"
+)
+
+// The files which GitHub Actions reads a step's outputs and its part of the job summary from
+const (
+	outputFileVariable  = "GITHUB_OUTPUT"
+	summaryFileVariable = "GITHUB_STEP_SUMMARY"
+)
+
+// outputDelimiter marks the end of a multiline step output
+const outputDelimiter = "TURBOLIFT_EOF"
+
+// Report writes the results of a command as step outputs, giving the number of activities which succeeded, warned and
+// failed and the repositories which failed, and as a job summary. It does nothing outside GitHub Actions.
+func Report(command string, results logging.Results, repos []campaign.Repo) error {
+	failedRepos := FailedRepos(results, repos)
+
+	if filename := os.Getenv(outputFileVariable); filename != "" {
+		outputs := fmt.Sprintf("succeeded=%d\nwarnings=%d\nfailed=%d\nfailed-repos<<%s\n%s%s\n",
+			results.Succeeded, len(results.Warnings), len(results.Failures),
+			outputDelimiter, lines(failedRepos), outputDelimiter)
+		if err := appendToFile(filename, outputs); err != nil {
+			return fmt.Errorf("unable to write step outputs: %w", err)
+		}
+	}
+
+	if filename := os.Getenv(summaryFileVariable); filename != "" {
+		if err := appendToFile(filename, Summary(command, results)); err != nil {
+			return fmt.Errorf("unable to write the job summary: %w", err)
+		}
+	}
+	return nil
+}
+
+// FailedRepos returns the repositories named by the activities which failed, in the order they are listed
+func FailedRepos(results logging.Results, repos []campaign.Repo) []string {
+	var failed []string
+	for _, repo := range repos {
+		for _, failure := range results.Failures {
+			if repo.IsNamedIn(failure.Activity) {
+				failed = append(failed, repo.FullRepoName)
+				break
+			}
+		}
+	}
+	return failed
+}
+
+// Summary is the markdown job summary for a command
+func Summary(command string, results logging.Results) string {
+	var summary strings.Builder
+	fmt.Fprintf(&summary, "### %s\n\n", command)
+	fmt.Fprintf(&summary, "| Succeeded | Warnings | Failed |\n| --- | --- | --- |\n| %d | %d | %d |\n\n",
+		results.Succeeded, len(results.Warnings), len(results.Failures))
+	for _, message := range results.Summaries {
+		fmt.Fprintf(&summary, "%s\n\n", message)
+	}
+	writeOutcomes(&summary, "Failures", results.Failures)
+	writeOutcomes(&summary, "Warnings", results.Warnings)
+	return summary.String()
+}
+
+func writeOutcomes(summary *strings.Builder, heading string, outcomes []logging.Outcome) {
+	if len(outcomes) == 0 {
+		return
+	}
+	fmt.Fprintf(summary, "#### %s\n\n", heading)
+	for _, outcome := range outcomes {
+		fmt.Fprintf(summary, "* %s: %s\n", outcome.Activity, strings.ReplaceAll(outcome.Message, "\n", " "))
+	}
+	summary.WriteString("\n")
+}
+
+func lines(values []string) string {
+	if len(values) == 0 {
+		return ""
+	}
+	return strings.Join(values, "\n") + "\n"
+}
+
+func appendToFile(filename string, content string) error {
+	file, err := os.OpenFile(filename, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := file.WriteString(content); err != nil {
+		_ = file.Close()
+		return err
+	}
+	return file.Close()
+}
@@ -0,0 +1,86 @@
+/*
+ * Copyright 2021 Skyscanner Limited.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * https://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package actions
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/skyscanner/turbolift/internal/campaign"
+	"github.com/skyscanner/turbolift/internal/logging"
+)
+
+var results = logging.Results{
+	Succeeded: 2,
+	Warnings:  []logging.Outcome{{Activity: "Creating PR in org/repo3", Message: "No PR created in org/repo3"}},
+	Failures: []logging.Outcome{
+		{Activity: "Pushing changes in org/repo10 to origin", Message: "rejected"},
+		{Activity: "Reading campaign data (repos.txt, README.md)", Message: "unreadable"},
+	},
+	Summaries: []string{"turbolift create-prs completed with errors (2 OK, 1 skipped, 1 errored)"},
+}
+
+var repos = []campaign.Repo{{FullRepoName: "org/repo1"}, {FullRepoName: "org/repo10"}, {FullRepoName: "org/repo3"}}
+
+func TestItFindsTheReposOfFailedActivities(t *testing.T) {
+	assert.Equal(t, []string{"org/repo10"}, FailedRepos(results, repos))
+}
+
+func TestItWritesStepOutputsAndAJobSummary(t *testing.T) {
+	dir, err := ioutil.TempDir("", "actions")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	outputFile := filepath.Join(dir, "output")
+	summaryFile := filepath.Join(dir, "summary")
+	_ = os.Setenv(outputFileVariable, outputFile)
+	_ = os.Setenv(summaryFileVariable, summaryFile)
+	defer func() {
+		_ = os.Unsetenv(outputFileVariable)
+		_ = os.Unsetenv(summaryFileVariable)
+	}()
+
+	assert.NoError(t, Report("turbolift create-prs", results, repos))
+
+	outputs, err := ioutil.ReadFile(outputFile)
+	assert.NoError(t, err)
+	assert.Equal(t, "succeeded=2\nwarnings=1\nfailed=2\nfailed-repos<<TURBOLIFT_EOF\norg/repo10\nTURBOLIFT_EOF\n", string(outputs))
+
+	summary, err := ioutil.ReadFile(summaryFile)
+	assert.NoError(t, err)
+	assert.Equal(t, `### turbolift create-prs
+
+| Succeeded | Warnings | Failed |
+| --- | --- | --- |
+| 2 | 1 | 2 |
+
+turbolift create-prs completed with errors (2 OK, 1 skipped, 1 errored)
+
+#### Failures
+
+* Pushing changes in org/repo10 to origin: rejected
+* Reading campaign data (repos.txt, README.md): unreadable
+
+#### Warnings
+
+* Creating PR in org/repo3: No PR created in org/repo3
+
+`, string(summary))
+}
@@ -0,0 +1,163 @@
+/*
+ * Copyright 2021 Skyscanner Limited.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * https://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package audit
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Filename is the append-only audit log, kept in the campaign directory
+const Filename = ".turbolift-audit.log"
+
+const redacted = "[REDACTED]"
+
+var (
+	mutex   sync.Mutex
+	enabled bool
+	command string
+	file    *os.File
+
+	tokenPattern          = regexp.MustCompile(`\b(gh[pousr]_[A-Za-z0-9]{20,}|github_pat_[A-Za-z0-9_]{20,})\b`)
+	urlCredentialsPattern = regexp.MustCompile(`(://)[^/@\s]+@`)
+	secretKeyPattern      = regexp.MustCompile(`(?i)^([A-Z0-9_.-]*(TOKEN|SECRET|PASSWORD|PASSWD|CREDENTIALS?|API_?KEY)[A-Z0-9_.-]*=).+`)
+	authHeaderPattern     = regexp.MustCompile(`(?i)^(authorization:\s*)\S.*`)
+)
+
+// Entry is a single record in the audit log
+type Entry struct {
+	Time      string   `json:"time"`
+	Command   string   `json:"command"`
+	Repo      string   `json:"repo,omitempty"`
+	Dir       string   `json:"dir"`
+	Operation string   `json:"operation"`
+	Args      []string `json:"args"`
+	Result    string   `json:"result"`
+	Error     string   `json:"error,omitempty"`
+	Duration  string   `json:"duration"`
+}
+
+// Start records the external commands run from now on, attributing them to the given turbolift command.
+// The audit log is only created once the first external command is run.
+func Start(turboliftCommand string) {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	enabled = true
+	command = redactArg(turboliftCommand)
+}
+
+// Stop stops recording and closes the audit log
+func Stop() error {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	enabled = false
+	if file == nil {
+		return nil
+	}
+	err := file.Close()
+	file = nil
+	return err
+}
+
+// Record appends an entry to the audit log for an external command run in workingDir, with any secrets
+// in its arguments redacted
+func Record(workingDir string, name string, args []string, started time.Time, err error) {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	if !enabled {
+		return
+	}
+	if file == nil {
+		var openErr error
+		file, openErr = os.OpenFile(Filename, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+		if openErr != nil {
+			_, _ = fmt.Fprintf(os.Stderr, "Unable to open audit log %s: %v\n", Filename, openErr)
+			enabled = false
+			return
+		}
+	}
+
+	entry := Entry{
+		Time:      started.UTC().Format(time.RFC3339),
+		Command:   command,
+		Repo:      RepoOf(workingDir),
+		Dir:       filepath.ToSlash(workingDir),
+		Operation: name,
+		Args:      Redact(args),
+		Result:    "success",
+		Duration:  time.Since(started).Round(time.Millisecond).String(),
+	}
+	if err != nil {
+		entry.Result = "failure"
+		entry.Error = redactArg(err.Error())
+	}
+
+	line, _ := json.Marshal(entry)
+	_, _ = file.Write(append(line, '\n'))
+}
+
+// Redact returns a copy of args with tokens, credentials in URLs and values of secret-looking settings replaced
+func Redact(args []string) []string {
+	result := make([]string, len(args))
+	redactNext := false
+	for i, arg := range args {
+		if redactNext {
+			result[i] = redacted
+			redactNext = false
+			continue
+		}
+		switch strings.ToLower(arg) {
+		case "--token", "--password", "--secret":
+			redactNext = true
+		}
+		result[i] = redactArg(arg)
+	}
+	return result
+}
+
+// IsRedacted is true if Redact has replaced any part of the argument
+func IsRedacted(arg string) bool {
+	return strings.Contains(arg, redacted)
+}
+
+func redactArg(arg string) string {
+	arg = tokenPattern.ReplaceAllString(arg, redacted)
+	arg = urlCredentialsPattern.ReplaceAllString(arg, "${1}"+redacted+"@")
+	arg = secretKeyPattern.ReplaceAllString(arg, "${1}"+redacted)
+	return authHeaderPattern.ReplaceAllString(arg, "${1}"+redacted)
+}
+
+// RepoOf returns the org/repo (or host/org/repo) whose working copy is at workingDir, if any
+func RepoOf(workingDir string) string {
+	parts := strings.Split(filepath.ToSlash(filepath.Clean(workingDir)), "/")
+	// the working copies of a variant of the campaign are in variants/name/work
+	if len(parts) > 2 && parts[0] == "variants" {
+		parts = parts[2:]
+	}
+	if len(parts) < 3 || parts[0] != "work" {
+		return ""
+	}
+	return strings.Join(parts[1:], "/")
+}
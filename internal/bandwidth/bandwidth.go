@@ -0,0 +1,157 @@
+/*
+ * Copyright 2021 Skyscanner Limited.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * https://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package bandwidth
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// dialTimeout limits how long the proxy waits to connect to the server a client asks for
+const dialTimeout = 30 * time.Second
+
+// chunkSize is the most that is copied at once, so that the rate stays smooth even when it is low
+const chunkSize = 16 * 1024
+
+var units = map[string]int64{"": 1, "K": 1 << 10, "M": 1 << 20, "G": 1 << 30}
+
+// ParseRate parses a rate in bytes per second, given as a number with an optional K, M or G suffix, e.g. 500K
+func ParseRate(rate string) (int64, error) {
+	trimmed := strings.TrimSuffix(strings.ToUpper(strings.TrimSpace(rate)), "B")
+	suffix := ""
+	if len(trimmed) > 0 {
+		if _, ok := units[trimmed[len(trimmed)-1:]]; ok {
+			suffix = trimmed[len(trimmed)-1:]
+			trimmed = trimmed[:len(trimmed)-1]
+		}
+	}
+	value, err := strconv.ParseFloat(trimmed, 64)
+	if err != nil || value <= 0 {
+		return 0, fmt.Errorf("invalid rate %s - expected a number of bytes per second, such as 500K or 2M", rate)
+	}
+	return int64(value * float64(units[suffix])), nil
+}
+
+// Proxy is a local HTTP proxy which tunnels connections, such as those of git and gh over HTTPS, limiting the rate at
+// which each connection downloads
+type Proxy struct {
+	listener       net.Listener
+	bytesPerSecond int64
+}
+
+// Start starts a proxy on a local port, limiting each connection through it to the given rate
+func Start(bytesPerSecond int64) (*Proxy, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, fmt.Errorf("unable to start the bandwidth limiting proxy: %w", err)
+	}
+	proxy := &Proxy{listener: listener, bytesPerSecond: bytesPerSecond}
+	go proxy.serve()
+	return proxy, nil
+}
+
+// URL is the address to give to clients, e.g. in HTTPS_PROXY
+func (p *Proxy) URL() string {
+	return "http://" + p.listener.Addr().String()
+}
+
+// Close stops the proxy from accepting connections
+func (p *Proxy) Close() error {
+	return p.listener.Close()
+}
+
+func (p *Proxy) serve() {
+	for {
+		conn, err := p.listener.Accept()
+		if err != nil {
+			return
+		}
+		go p.tunnel(conn)
+	}
+}
+
+// tunnel handles a CONNECT request, copying between the client and the server it asked for
+func (p *Proxy) tunnel(client net.Conn) {
+	defer client.Close()
+
+	request, err := http.ReadRequest(bufio.NewReader(client))
+	if err != nil {
+		return
+	}
+	if request.Method != http.MethodConnect {
+		_, _ = io.WriteString(client, "HTTP/1.1 405 Method Not Allowed\r\n\r\n")
+		return
+	}
+
+	server, err := net.DialTimeout("tcp", request.Host, dialTimeout)
+	if err != nil {
+		_, _ = io.WriteString(client, "HTTP/1.1 502 Bad Gateway\r\n\r\n")
+		return
+	}
+	defer server.Close()
+	if _, err := io.WriteString(client, "HTTP/1.1 200 Connection Established\r\n\r\n"); err != nil {
+		return
+	}
+
+	done := make(chan struct{}, 2)
+	go func() {
+		_, _ = io.Copy(server, client)
+		done <- struct{}{}
+	}()
+	go func() {
+		_, _ = copyLimited(client, server, p.bytesPerSecond)
+		done <- struct{}{}
+	}()
+	// either side closing ends the tunnel
+	<-done
+}
+
+// copyLimited copies from src to dst, sleeping as needed to keep to the rate
+func copyLimited(dst io.Writer, src io.Reader, bytesPerSecond int64) (int64, error) {
+	size := int64(chunkSize)
+	if bytesPerSecond < size {
+		size = bytesPerSecond
+	}
+	buffer := make([]byte, size)
+
+	started := time.Now()
+	var copied int64
+	for {
+		n, err := src.Read(buffer)
+		if n > 0 {
+			if _, writeErr := dst.Write(buffer[:n]); writeErr != nil {
+				return copied, writeErr
+			}
+			copied += int64(n)
+			due := started.Add(time.Duration(float64(copied) / float64(bytesPerSecond) * float64(time.Second)))
+			if wait := time.Until(due); wait > 0 {
+				time.Sleep(wait)
+			}
+		}
+		if err == io.EOF {
+			return copied, nil
+		}
+		if err != nil {
+			return copied, err
+		}
+	}
+}
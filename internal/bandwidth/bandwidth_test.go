@@ -0,0 +1,81 @@
+/*
+ * Copyright 2021 Skyscanner Limited.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * https://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package bandwidth
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestItParsesRates(t *testing.T) {
+	for rate, expected := range map[string]int64{"100": 100, "500K": 500 * 1024, "2m": 2 * 1024 * 1024, "1.5MB": 1536 * 1024, "1G": 1 << 30} {
+		parsed, err := ParseRate(rate)
+		assert.NoError(t, err, rate)
+		assert.Equal(t, expected, parsed, rate)
+	}
+
+	for _, rate := range []string{"", "fast", "-1M", "0"} {
+		_, err := ParseRate(rate)
+		assert.Error(t, err, rate)
+	}
+}
+
+func TestItLimitsTheRateOfTunnelledDownloads(t *testing.T) {
+	const size = 30 * 1024
+	server, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer server.Close()
+	go func() {
+		conn, err := server.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		_, _ = conn.Write([]byte(strings.Repeat("x", size)))
+	}()
+
+	proxy, err := Start(100 * 1024)
+	assert.NoError(t, err)
+	defer proxy.Close()
+
+	proxyURL, err := url.Parse(proxy.URL())
+	assert.NoError(t, err)
+	conn, err := net.Dial("tcp", proxyURL.Host)
+	assert.NoError(t, err)
+	defer conn.Close()
+
+	started := time.Now()
+	_, err = fmt.Fprintf(conn, "CONNECT %s HTTP/1.1\r\nHost: %s\r\n\r\n", server.Addr(), server.Addr())
+	assert.NoError(t, err)
+	reader := bufio.NewReader(conn)
+	response, err := http.ReadResponse(reader, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+
+	downloaded, err := ioutil.ReadAll(reader)
+	assert.NoError(t, err)
+	assert.Len(t, downloaded, size)
+	assert.GreaterOrEqual(t, int64(time.Since(started)), int64(250*time.Millisecond))
+}
@@ -0,0 +1,61 @@
+/*
+ * Copyright 2021 Skyscanner Limited.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * https://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package campaign
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strings"
+)
+
+// BackportTargets gives the release branches to backport the campaign's changes to, keyed by full repo name or org/*
+type BackportTargets map[string][]string
+
+// ReadBackportTargets reads a file where each line is a repository (or org/*) followed by one or more branches to
+// backport its changes to, e.g. `org/repo1 release/1.x release/2.x`. Empty lines and lines starting with # are ignored.
+func ReadBackportTargets(filename string) (BackportTargets, error) {
+	contents, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("unable to open backport branches file: %s", filename)
+	}
+
+	targets := make(BackportTargets)
+	for i, line := range strings.Split(string(contents), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			return nil, fmt.Errorf("line %d of %s should be a repository and the branches to backport to: %s", i+1, filename, line)
+		}
+		targets[fields[0]] = append(targets[fields[0]], fields[1:]...)
+	}
+	return targets, nil
+}
+
+// For returns the branches to backport the repository's changes to, or nothing if none are given for it or its org
+func (t BackportTargets) For(repo Repo) []string {
+	if branches, ok := t[repo.FullRepoName]; ok {
+		return branches
+	}
+	return t[strings.TrimSuffix(repo.FullRepoName, repo.RepoName)+"*"]
+}
+
+// BackportBranchName returns the branch that the backport of the campaign to a release branch is raised from
+func BackportBranchName(campaignName string, target string) string {
+	return campaignName + "-backport-" + SplitName(target)
+}
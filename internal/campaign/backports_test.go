@@ -0,0 +1,54 @@
+/*
+ * Copyright 2021 Skyscanner Limited.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * https://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package campaign
+
+import (
+	"io/ioutil"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/skyscanner/turbolift/internal/testsupport"
+)
+
+func TestItReadsBackportTargets(t *testing.T) {
+	testsupport.PrepareTempCampaign(false)
+	err := ioutil.WriteFile("backports.txt", []byte("# release branches\norg/repo1 release/1.x release/2.x\n\norg/* maintenance\n"), 0o644)
+	assert.NoError(t, err)
+
+	targets, err := ReadBackportTargets("backports.txt")
+	assert.NoError(t, err)
+
+	assert.Equal(t, []string{"release/1.x", "release/2.x"}, targets.For(Repo{OrgName: "org", RepoName: "repo1", FullRepoName: "org/repo1"}))
+	assert.Equal(t, []string{"maintenance"}, targets.For(Repo{OrgName: "org", RepoName: "repo2", FullRepoName: "org/repo2"}))
+	assert.Empty(t, targets.For(Repo{OrgName: "acme", RepoName: "repo1", FullRepoName: "acme/repo1"}))
+}
+
+func TestItRejectsMalformedBackportTargets(t *testing.T) {
+	testsupport.PrepareTempCampaign(false)
+	err := ioutil.WriteFile("backports.txt", []byte("org/repo1 release/1.x\norg/repo2\n"), 0o644)
+	assert.NoError(t, err)
+
+	_, err = ReadBackportTargets("backports.txt")
+	assert.EqualError(t, err, "line 2 of backports.txt should be a repository and the branches to backport to: org/repo2")
+
+	_, err = ReadBackportTargets("missing.txt")
+	assert.EqualError(t, err, "unable to open backport branches file: missing.txt")
+}
+
+func TestItNamesBackportBranchesAfterTheCampaignAndRelease(t *testing.T) {
+	assert.Equal(t, "my-campaign-backport-release-1.x", BackportBranchName("my-campaign", "release/1.x"))
+}
@@ -0,0 +1,119 @@
+/*
+ * Copyright 2021 Skyscanner Limited.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * https://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package campaign
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// BaseBranchesFilename records the default branch of each repository when it was cloned, which its campaign branch
+// was created from, in the same form as a file of base branches given to create-prs
+const BaseBranchesFilename = "base_branches.txt"
+
+// BaseBranchMapping gives the branch to raise PRs against for repositories, keyed by full repo name or org/*
+type BaseBranchMapping map[string]string
+
+// ReadBaseBranchMapping reads a file where each line is a repository (or org/*) followed by the branch to raise its PR
+// against, e.g. `org/repo1 release/2024.06`. Empty lines and lines starting with # are ignored.
+func ReadBaseBranchMapping(filename string) (BaseBranchMapping, error) {
+	contents, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("unable to open base branches file: %s", filename)
+	}
+
+	mapping := make(BaseBranchMapping)
+	for i, line := range strings.Split(string(contents), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("line %d of %s should be a repository and its base branch: %s", i+1, filename, line)
+		}
+		mapping[fields[0]] = fields[1]
+	}
+	return mapping, nil
+}
+
+// For returns the base branch for the repository, or an empty string if none is given for it or its org
+func (m BaseBranchMapping) For(repo Repo) string {
+	if branch, ok := m[repo.FullRepoName]; ok {
+		return branch
+	}
+	return m[strings.TrimSuffix(repo.FullRepoName, repo.RepoName)+"*"]
+}
+
+// recordingBaseBranch serialises the updates of BaseBranchesFilename by repositories cloned at once
+var recordingBaseBranch sync.Mutex
+
+// RecordBaseBranch records the branch that a repository's campaign branch was created from in BaseBranchesFilename
+func RecordBaseBranch(repo Repo, branch string) error {
+	recordingBaseBranch.Lock()
+	defer recordingBaseBranch.Unlock()
+
+	recorded, err := readRecordedBaseBranches()
+	if err != nil {
+		return err
+	}
+	recorded[repo.FullRepoName] = branch
+	return writeRecordedBaseBranches(recorded)
+}
+
+// forgetBaseBranches removes the base branches recorded for repositories which have left the campaign
+func forgetBaseBranches(repoNames []string) error {
+	recordingBaseBranch.Lock()
+	defer recordingBaseBranch.Unlock()
+
+	if _, err := os.Stat(BaseBranchesFilename); os.IsNotExist(err) {
+		return nil
+	}
+	recorded, err := readRecordedBaseBranches()
+	if err != nil {
+		return err
+	}
+	for _, name := range repoNames {
+		delete(recorded, name)
+	}
+	return writeRecordedBaseBranches(recorded)
+}
+
+func writeRecordedBaseBranches(recorded BaseBranchMapping) error {
+	var names []string
+	for name := range recorded {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var contents strings.Builder
+	for _, name := range names {
+		_, _ = fmt.Fprintf(&contents, "%s %s\n", name, recorded[name])
+	}
+	return ioutil.WriteFile(BaseBranchesFilename, []byte(contents.String()), 0o644)
+}
+
+// readRecordedBaseBranches returns the base branches recorded when repositories were cloned, which is empty if none
+// have been
+func readRecordedBaseBranches() (BaseBranchMapping, error) {
+	if _, err := os.Stat(BaseBranchesFilename); os.IsNotExist(err) {
+		return BaseBranchMapping{}, nil
+	}
+	return ReadBaseBranchMapping(BaseBranchesFilename)
+}
@@ -0,0 +1,68 @@
+/*
+ * Copyright 2021 Skyscanner Limited.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * https://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package campaign
+
+import (
+	"io/ioutil"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/skyscanner/turbolift/internal/testsupport"
+)
+
+func TestItReadsBaseBranchMappings(t *testing.T) {
+	testsupport.PrepareTempCampaign(false)
+	err := ioutil.WriteFile("bases.txt", []byte("# base branches\norg/repo1 release/2024.06\n\norg/* maintenance\n"), 0o644)
+	assert.NoError(t, err)
+
+	mapping, err := ReadBaseBranchMapping("bases.txt")
+	assert.NoError(t, err)
+
+	assert.Equal(t, "release/2024.06", mapping.For(Repo{OrgName: "org", RepoName: "repo1", FullRepoName: "org/repo1"}))
+	assert.Equal(t, "maintenance", mapping.For(Repo{OrgName: "org", RepoName: "repo2", FullRepoName: "org/repo2"}))
+	assert.Equal(t, "", mapping.For(Repo{OrgName: "acme", RepoName: "repo1", FullRepoName: "acme/repo1"}))
+}
+
+func TestItRejectsMalformedBaseBranchMappings(t *testing.T) {
+	testsupport.PrepareTempCampaign(false)
+	err := ioutil.WriteFile("bases.txt", []byte("org/repo1 release/2024.06\norg/repo2\n"), 0o644)
+	assert.NoError(t, err)
+
+	_, err = ReadBaseBranchMapping("bases.txt")
+	assert.EqualError(t, err, "line 2 of bases.txt should be a repository and its base branch: org/repo2")
+
+	_, err = ReadBaseBranchMapping("missing.txt")
+	assert.EqualError(t, err, "unable to open base branches file: missing.txt")
+}
+
+func TestItRecordsBaseBranchesForOpeningTheCampaign(t *testing.T) {
+	testsupport.PrepareTempCampaign(false, "org/repo1", "org/repo2", "org/repo3")
+
+	assert.NoError(t, RecordBaseBranch(Repo{FullRepoName: "org/repo2"}, "master"))
+	assert.NoError(t, RecordBaseBranch(Repo{FullRepoName: "org/repo1"}, "trunk"))
+	assert.NoError(t, RecordBaseBranch(Repo{FullRepoName: "org/repo1"}, "main"))
+
+	recorded, err := ioutil.ReadFile(BaseBranchesFilename)
+	assert.NoError(t, err)
+	assert.Equal(t, "org/repo1 main\norg/repo2 master\n", string(recorded))
+
+	campaign, err := OpenCampaign(NewCampaignOptions())
+	assert.NoError(t, err)
+	assert.Equal(t, "main", campaign.Repos[0].BaseBranch)
+	assert.Equal(t, "master", campaign.Repos[1].BaseBranch)
+	assert.Equal(t, "", campaign.Repos[2].BaseBranch)
+}
@@ -0,0 +1,70 @@
+/*
+ * Copyright 2021 Skyscanner Limited.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * https://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package campaign
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/skyscanner/turbolift/cmd/flags"
+)
+
+// configuredBranch is the campaign branch set in turbolift.yaml, or empty to name it after the campaign directory
+var configuredBranch string
+
+// UseBranch sets the campaign branch configured in turbolift.yaml, which --branch takes precedence over
+func UseBranch(name string) {
+	configuredBranch = name
+}
+
+// IsBranchOverridden reports whether the campaign branch is given with --branch or in turbolift.yaml, rather than
+// being named after the campaign directory
+func IsBranchOverridden() bool {
+	return flags.Branch != "" || configuredBranch != ""
+}
+
+// branchName returns the name of the campaign branch: the one given with --branch or in turbolift.yaml if any, or else
+// the name of the campaign directory, followed by the name of the selected profile
+func branchName(dirBasename string) (string, error) {
+	name := flags.Branch
+	if name == "" {
+		name = configuredBranch
+	}
+	if name != "" {
+		if err := validateBranchName(name); err != nil {
+			return "", err
+		}
+	} else {
+		name = dirBasename
+	}
+	if profile := SelectedProfile(); profile != "" {
+		if err := validateProfileName(profile); err != nil {
+			return "", err
+		}
+		name += "-" + profile
+	}
+	return name, nil
+}
+
+// validateBranchName rejects names which git does not allow for branches
+func validateBranchName(name string) error {
+	if strings.ContainsAny(name, " \t~^:?*[\\") || strings.Contains(name, "..") || strings.Contains(name, "//") ||
+		strings.HasPrefix(name, "/") || strings.HasSuffix(name, "/") || strings.HasPrefix(name, "-") ||
+		strings.HasSuffix(name, ".lock") || strings.HasSuffix(name, ".") || name == "@" {
+		return fmt.Errorf("%s cannot be used as a branch name", name)
+	}
+	return nil
+}
@@ -0,0 +1,70 @@
+/*
+ * Copyright 2021 Skyscanner Limited.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * https://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package campaign
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/skyscanner/turbolift/cmd/flags"
+	"github.com/skyscanner/turbolift/internal/testsupport"
+)
+
+func TestTheCampaignBranchIsNamedAfterTheDirectoryByDefault(t *testing.T) {
+	testsupport.PrepareTempCampaign(false, "org/repo1")
+
+	campaign, err := OpenCampaign(NewCampaignOptions())
+	assert.NoError(t, err)
+	assert.Equal(t, testsupport.Pwd(), campaign.Name)
+	assert.False(t, IsBranchOverridden())
+}
+
+func TestTheBranchFlagTakesPrecedenceOverTheConfiguredBranch(t *testing.T) {
+	testsupport.PrepareTempCampaign(false, "org/repo1")
+	UseBranch("chore/configured")
+	defer UseBranch("")
+
+	campaign, err := OpenCampaign(NewCampaignOptions())
+	assert.NoError(t, err)
+	assert.Equal(t, "chore/configured", campaign.Name)
+
+	flags.Branch = "chore/upgrade-logging"
+	defer func() { flags.Branch = "" }()
+	campaign, err = OpenCampaign(NewCampaignOptions())
+	assert.NoError(t, err)
+	assert.Equal(t, "chore/upgrade-logging", campaign.Name)
+	assert.True(t, IsBranchOverridden())
+}
+
+func TestVariantsAddTheirSuffixToTheGivenBranch(t *testing.T) {
+	testsupport.PrepareTempCampaign(false, "org/repo1")
+	flags.Branch = "chore/upgrade-spring"
+	defer func() { flags.Branch = "" }()
+	UseVariant(&Variant{Name: "spring6", BranchSuffix: "boot3"})
+	defer UseVariant(nil)
+
+	campaign, err := OpenCampaign(NewCampaignOptions())
+	assert.NoError(t, err)
+	assert.Equal(t, "chore/upgrade-spring-boot3", campaign.Name)
+}
+
+func TestItRejectsBranchNamesWhichGitDoesNotAllow(t *testing.T) {
+	for _, invalid := range []string{"chore/", "/chore", "chore//x", "a..b", "has space", "x.lock", "-x", "a:b"} {
+		assert.Error(t, validateBranchName(invalid), invalid)
+	}
+	assert.NoError(t, validateBranchName("chore/upgrade-logging_2"))
+}
@@ -19,10 +19,33 @@ import (
 	"bufio"
 	"errors"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"os"
 	"path"
 	"path/filepath"
 	"strings"
+	"time"
+
+	"github.com/skyscanner/turbolift/cmd/flags"
+	"github.com/skyscanner/turbolift/internal/github"
+	"github.com/skyscanner/turbolift/internal/history"
+)
+
+// orgReposCacheDir holds the cached listings of repositories for `org/*` entries
+const orgReposCacheDir = ".turbolift-cache/orgs"
+
+const orgReposCacheTTL = 24 * time.Hour
+
+// ArchivedFilename marks a campaign directory as archived, and holds the report written when it was archived
+const ArchivedFilename = "ARCHIVED.md"
+
+// StdinFilename can be given as the repo filename to read the list of repositories from stdin
+const StdinFilename = "-"
+
+var (
+	gh    github.GitHub = github.NewGitHub()
+	stdin io.Reader     = os.Stdin
 )
 
 type Repo struct {
@@ -30,6 +53,13 @@ type Repo struct {
 	OrgName      string
 	RepoName     string
 	FullRepoName string
+	// BaseBranch is the branch PRs are raised against, as recorded when the repository was cloned or given for the
+	// campaign, or empty if it is to be looked up as the repository's default branch
+	BaseBranch string
+	// Group is the ordering group the repository is listed under in the repo file, or empty if it is not under one
+	Group string
+	// Priority is given after the repository in the repo file, and puts it ahead of lower priority repositories
+	Priority Priority
 }
 
 type Campaign struct {
@@ -40,12 +70,48 @@ type Campaign struct {
 }
 
 func (r Repo) FullRepoPath() string {
-	return path.Join("work", r.OrgName, r.RepoName) // i.e. work/org/repo
+	return path.Join(WorkDir(), r.OrgName, r.RepoName) // i.e. work/org/repo
+}
+
+// HostName returns the host of the repository, which is the one gh uses by default unless the repo file gives another
+func (r Repo) HostName() string {
+	if r.Host != "" {
+		return r.Host
+	}
+	if host := os.Getenv("GH_HOST"); host != "" {
+		return host
+	}
+	return "github.com"
+}
+
+// CloneURL returns the HTTPS URL which git can clone the repository from
+func (r Repo) CloneURL() string {
+	return fmt.Sprintf("https://%s/%s/%s.git", r.HostName(), r.OrgName, r.RepoName)
+}
+
+// IsNamedIn reports whether the repository is named in text, such as the name of an activity carried out on it
+func (r Repo) IsNamedIn(text string) bool {
+	return history.NamesRepo(text, r.FullRepoName)
+}
+
+// PRRefs identifies the PRs from the campaign branch of every repository which has been cloned, for fetching them
+// together with github.FetchPRs
+func (c *Campaign) PRRefs() []github.PRRef {
+	var refs []github.PRRef
+	for _, repo := range c.Repos {
+		if _, err := os.Stat(repo.FullRepoPath()); err != nil {
+			continue
+		}
+		refs = append(refs, github.PRRef{WorkingDir: repo.FullRepoPath(), FullRepoName: repo.FullRepoName, BranchName: c.Name})
+	}
+	return refs
 }
 
 type CampaignOptions struct {
 	RepoFilename          string
 	PrDescriptionFilename string
+	// Unfiltered keeps every repository, ignoring --only-topic, --filter-from-results and the other filters
+	Unfiltered bool
 }
 
 func NewCampaignOptions() *CampaignOptions {
@@ -59,28 +125,89 @@ func OpenCampaign(options *CampaignOptions) (*Campaign, error) {
 	dir, _ := os.Getwd()
 	dirBasename := filepath.Base(dir)
 
-	repos, err := readReposTxtFile(options.RepoFilename)
+	if _, err := os.Stat(ArchivedFilename); err == nil {
+		return nil, fmt.Errorf("campaign %s has been archived - see %s", dirBasename, ArchivedFilename)
+	}
+
+	repos, err := readReposTxtFile(ProfileFile(options.RepoFilename))
 	if err != nil {
 		return nil, err
 	}
 
-	prTitle, prBody, err := readPrDescriptionFile(options.PrDescriptionFilename)
+	if flags.Shard != "" {
+		shard, err := ParseShard(flags.Shard)
+		if err != nil {
+			return nil, err
+		}
+		repos = shard.Select(repos)
+	}
+
+	if !options.Unfiltered {
+		if repos, err = filterRepos(repos); err != nil {
+			return nil, err
+		}
+	}
+
+	recordedBaseBranches, err := readRecordedBaseBranches()
 	if err != nil {
 		return nil, err
 	}
+	for i, repo := range repos {
+		repos[i].BaseBranch = recordedBaseBranches[repo.FullRepoName]
+	}
+
+	prTitle, prBody, err := readPrDescriptionFile(ProfileFile(options.PrDescriptionFilename))
+	if err != nil {
+		return nil, err
+	}
+
+	name, err := branchName(dirBasename)
+	if err != nil {
+		return nil, err
+	}
+	if selectedVariant != nil {
+		name += "-" + selectedVariant.BranchSuffix
+	}
 
 	return &Campaign{
-		Name:    dirBasename,
+		Name:    name,
 		Repos:   repos,
 		PrTitle: prTitle,
 		PrBody:  prBody,
 	}, nil
 }
 
+// filterRepos narrows the repositories down by their metadata, as given with --only-topic and the other filters, and
+// by the results of earlier commands, as given with --filter-from-results
+func filterRepos(repos []Repo) ([]Repo, error) {
+	filter, err := repoFilterFromFlags()
+	if err != nil {
+		return nil, err
+	}
+	if !filter.IsEmpty() {
+		metadata, err := ReadRepoMetadata()
+		if err != nil {
+			return nil, err
+		}
+		if repos, err = filter.Select(repos, metadata); err != nil {
+			return nil, err
+		}
+	}
+	return filterReposByResults(repos)
+}
+
+// ReadRepoFile reads the repositories listed in a repo file, without reading the rest of the campaign
+func ReadRepoFile(filename string) ([]Repo, error) {
+	return readReposTxtFile(ProfileFile(filename))
+}
+
 func readReposTxtFile(filename string) ([]Repo, error) {
 	if filename == "" {
 		return nil, errors.New("no repos filename to open")
 	}
+	if filename == StdinFilename {
+		return readRepos(stdin, "stdin")
+	}
 	file, err := os.Open(filename)
 	if err != nil {
 		return nil, fmt.Errorf("unable to open repo file: %s", filename)
@@ -92,39 +219,47 @@ func readReposTxtFile(filename string) ([]Repo, error) {
 		}
 	}()
 
-	scanner := bufio.NewScanner(file)
+	return readRepos(file, filename)
+}
+
+func readRepos(reader io.Reader, filename string) ([]Repo, error) {
+	scanner := bufio.NewScanner(reader)
 	uniq := map[string]interface{}{}
 	var repos []Repo
+	group := ""
 	for scanner.Scan() {
 		line := scanner.Text()
+		if name, ok := parseGroupHeader(line); ok {
+			group = name
+			continue
+		}
 		if !strings.HasPrefix(line, "#") && len(line) > 0 {
-			if _, seen := uniq[line]; seen {
-				continue
+			entry, priority, err := parseRepoLine(line)
+			if err != nil {
+				return nil, fmt.Errorf("unable to parse entry in %s file: %s: %w", filename, line, err)
 			}
-			uniq[line] = struct{}{}
-
-			splitLine := strings.Split(line, "/")
-			numParts := len(splitLine)
-
-			var repo Repo
-			switch numParts {
-			case 2:
-				repo = Repo{
-					OrgName:      splitLine[0],
-					RepoName:     splitLine[1],
-					FullRepoName: line,
+			lines := []string{entry}
+			if strings.HasSuffix(entry, "/*") {
+				lines, err = expandOrgWildcard(strings.TrimSuffix(entry, "/*"))
+				if err != nil {
+					return nil, fmt.Errorf("unable to expand entry in %s file: %s: %w", filename, line, err)
 				}
-			case 3:
-				repo = Repo{
-					Host:         splitLine[0],
-					OrgName:      splitLine[1],
-					RepoName:     splitLine[2],
-					FullRepoName: line,
+			}
+
+			for _, line := range lines {
+				if _, seen := uniq[line]; seen {
+					continue
+				}
+				uniq[line] = struct{}{}
+
+				repo, err := parseRepo(line)
+				if err != nil {
+					return nil, fmt.Errorf("unable to parse entry in %s file: %s", filename, line)
 				}
-			default:
-				return nil, fmt.Errorf("unable to parse entry in %s file: %s", filename, line)
+				repo.Group = group
+				repo.Priority = priority
+				repos = append(repos, repo)
 			}
-			repos = append(repos, repo)
 		}
 	}
 
@@ -132,9 +267,66 @@ func readReposTxtFile(filename string) ([]Repo, error) {
 		return nil, fmt.Errorf("unable to open %s file: %w", filename, err)
 	}
 
+	sortByPriority(repos)
 	return repos, nil
 }
 
+func parseRepo(line string) (Repo, error) {
+	splitLine := strings.Split(line, "/")
+	numParts := len(splitLine)
+
+	switch numParts {
+	case 2:
+		return Repo{
+			OrgName:      splitLine[0],
+			RepoName:     splitLine[1],
+			FullRepoName: line,
+		}, nil
+	case 3:
+		return Repo{
+			Host:         splitLine[0],
+			OrgName:      splitLine[1],
+			RepoName:     splitLine[2],
+			FullRepoName: line,
+		}, nil
+	default:
+		return Repo{}, fmt.Errorf("unexpected number of parts: %d", numParts)
+	}
+}
+
+// expandOrgWildcard lists every repository of an org, given an `org` or `host/org` entry which was followed by `/*`.
+// Listings are cached in the campaign directory so that successive commands don't query the org again.
+func expandOrgWildcard(org string) ([]string, error) {
+	host := ""
+	orgName := org
+	if i := strings.Index(org, "/"); i >= 0 {
+		host, orgName = org[:i], org[i+1:]
+	}
+
+	cacheFile := path.Join(orgReposCacheDir, host, orgName+".txt")
+	if info, err := os.Stat(cacheFile); !flags.NoCache && err == nil && time.Since(info.ModTime()) < orgReposCacheTTL {
+		contents, err := ioutil.ReadFile(cacheFile)
+		if err != nil {
+			return nil, err
+		}
+		return strings.Fields(string(contents)), nil
+	}
+
+	lines, err := gh.ListOrgRepos(ioutil.Discard, ".", org)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := os.MkdirAll(path.Dir(cacheFile), os.ModeDir|0o755); err != nil {
+		return nil, err
+	}
+	if err := ioutil.WriteFile(cacheFile, []byte(strings.Join(lines, "\n")), 0o644); err != nil {
+		return nil, err
+	}
+
+	return lines, nil
+}
+
 func readPrDescriptionFile(filename string) (string, string, error) {
 	if filename == "" {
 		return "", "", errors.New("no PR description file to open")
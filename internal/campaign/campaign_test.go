@@ -16,10 +16,16 @@
 package campaign
 
 import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
 
+	"github.com/skyscanner/turbolift/internal/github"
 	"github.com/skyscanner/turbolift/internal/testsupport"
 )
 
@@ -49,6 +55,18 @@ func TestItReadsSimpleRepoNamesFromReposFile(t *testing.T) {
 	assert.Equal(t, "PR body", campaign.PrBody)
 }
 
+func TestItIdentifiesThePRsOfClonedRepos(t *testing.T) {
+	testsupport.PrepareTempCampaign(false, "org/repo1", "org/repo2")
+	assert.NoError(t, os.MkdirAll("work/org/repo2", 0o755))
+
+	campaign, err := OpenCampaign(NewCampaignOptions())
+	assert.NoError(t, err)
+
+	assert.Equal(t, []github.PRRef{
+		{WorkingDir: "work/org/repo2", FullRepoName: "org/repo2", BranchName: campaign.Name},
+	}, campaign.PRRefs())
+}
+
 func TestItReadsRepoNamesWithOtherHostsFromReposFile(t *testing.T) {
 	testsupport.PrepareTempCampaign(false, "org/repo1", "mygitserver.com/org/repo2")
 
@@ -254,3 +272,97 @@ func TestItShouldErrorWhenPrDescriptionFileNameIsEmpty(t *testing.T) {
 	_, err := OpenCampaign(options)
 	assert.Error(t, err)
 }
+
+func TestItExpandsOrgWildcards(t *testing.T) {
+	fakeGitHub := github.NewAlwaysSucceedsFakeGitHub()
+	gh = fakeGitHub
+
+	testsupport.PrepareTempCampaign(false, "org/repo1", "acme/*", "mygitserver.com/other/*")
+
+	campaign, err := OpenCampaign(NewCampaignOptions())
+	assert.NoError(t, err)
+
+	var fullRepoNames []string
+	for _, repo := range campaign.Repos {
+		fullRepoNames = append(fullRepoNames, repo.FullRepoName)
+	}
+	assert.Equal(t, []string{
+		"org/repo1",
+		"acme/repo1",
+		"acme/repo2",
+		"mygitserver.com/other/repo1",
+		"mygitserver.com/other/repo2",
+	}, fullRepoNames)
+	assert.Equal(t, "mygitserver.com", campaign.Repos[3].Host)
+
+	fakeGitHub.AssertCalledWith(t, [][]string{
+		{".", "acme"},
+		{".", "mygitserver.com/other"},
+	})
+}
+
+func TestItUsesCachedOrgWildcardExpansions(t *testing.T) {
+	fakeGitHub := github.NewAlwaysFailsFakeGitHub()
+	gh = fakeGitHub
+
+	testsupport.PrepareTempCampaign(false, "acme/*")
+	_ = os.MkdirAll(orgReposCacheDir, os.ModeDir|0o755)
+	err := ioutil.WriteFile(path.Join(orgReposCacheDir, "acme.txt"), []byte("acme/cached1\nacme/cached2"), 0o644)
+	if err != nil {
+		panic(err)
+	}
+
+	campaign, err := OpenCampaign(NewCampaignOptions())
+	assert.NoError(t, err)
+	assert.Len(t, campaign.Repos, 2)
+	assert.Equal(t, "cached1", campaign.Repos[0].RepoName)
+	assert.Equal(t, "cached2", campaign.Repos[1].RepoName)
+
+	fakeGitHub.AssertCalledWith(t, [][]string{})
+}
+
+func TestItErrorsWhenOrgWildcardCannotBeExpanded(t *testing.T) {
+	gh = github.NewAlwaysFailsFakeGitHub()
+
+	testsupport.PrepareTempCampaign(false, "acme/*")
+
+	_, err := OpenCampaign(NewCampaignOptions())
+	assert.Error(t, err)
+}
+
+func TestItReadsReposFromStdin(t *testing.T) {
+	testsupport.PrepareTempCampaign(false)
+	stdin = strings.NewReader("org/repo1\n# comment\nmygitserver.com/org/repo2\n")
+	defer func() { stdin = os.Stdin }()
+
+	options := NewCampaignOptions()
+	options.RepoFilename = StdinFilename
+	campaign, err := OpenCampaign(options)
+	assert.NoError(t, err)
+
+	assert.Equal(t, []Repo{
+		{
+			Host:         "",
+			OrgName:      "org",
+			RepoName:     "repo1",
+			FullRepoName: "org/repo1",
+		},
+		{
+			Host:         "mygitserver.com",
+			OrgName:      "org",
+			RepoName:     "repo2",
+			FullRepoName: "mygitserver.com/org/repo2",
+		},
+	}, campaign.Repos)
+}
+
+func TestItRefusesToOpenArchivedCampaigns(t *testing.T) {
+	testsupport.PrepareTempCampaign(false, "org/repo1")
+	err := ioutil.WriteFile(ArchivedFilename, []byte("# Archived"), 0o644)
+	if err != nil {
+		panic(err)
+	}
+
+	_, err = OpenCampaign(NewCampaignOptions())
+	assert.EqualError(t, err, fmt.Sprintf("campaign %s has been archived - see ARCHIVED.md", testsupport.Pwd()))
+}
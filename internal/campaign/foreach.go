@@ -0,0 +1,113 @@
+/*
+ * Copyright 2021 Skyscanner Limited.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * https://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package campaign
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/skyscanner/turbolift/cmd/flags"
+	"github.com/skyscanner/turbolift/internal/executor"
+)
+
+// ForeachCommandFilename records the command run with foreach --save-for-refresh, so that it can be run again by refresh. Each
+// profile records its own.
+const ForeachCommandFilename = ".turbolift-foreach"
+
+// ForeachCommand is the campaign's script, as run by foreach --save-for-refresh, with the options it was run with
+type ForeachCommand struct {
+	Command string `json:"command"`
+	// Shell is the shell given with --shell, or empty for the default shell
+	Shell string `json:"shell,omitempty"`
+	// Container is the image given with --container, or empty to run the command directly
+	Container string `json:"container,omitempty"`
+	// Env, EnvFile, PassEnv and Isolate are the --env, --env-file, --pass-env and --isolate-env given
+	Env     []string `json:"env,omitempty"`
+	EnvFile string   `json:"envFile,omitempty"`
+	PassEnv []string `json:"passEnv,omitempty"`
+	Isolate bool     `json:"isolateEnv,omitempty"`
+	// Timeout is the --timeout given, or empty for the configured timeout
+	Timeout string `json:"timeout,omitempty"`
+}
+
+// Environment returns the environment the command runs with: that of the selected variant, then the entries of its
+// env file, then its own entries
+func (c ForeachCommand) Environment() (executor.Environment, error) {
+	environment := executor.Environment{Isolated: c.Isolate, Passed: c.PassEnv}
+	if variant := SelectedVariant(); variant != nil {
+		environment.Set = variant.Environment()
+	}
+	if c.EnvFile != "" {
+		entries, err := executor.ReadEnvFile(c.EnvFile)
+		if err != nil {
+			return executor.Environment{}, fmt.Errorf("unable to read --env-file: %w", err)
+		}
+		environment.Set = append(environment.Set, entries...)
+	}
+	for _, entry := range c.Env {
+		if err := executor.ParseVariable(entry); err != nil {
+			return executor.Environment{}, fmt.Errorf("--env %w", err)
+		}
+		environment.Set = append(environment.Set, entry)
+	}
+	return environment, nil
+}
+
+// Limit returns how long the command may run in each repository, which is the configured timeout unless it has its own
+func (c ForeachCommand) Limit() (time.Duration, error) {
+	if c.Timeout == "" {
+		return flags.Timeout, nil
+	}
+	limit, err := time.ParseDuration(c.Timeout)
+	if err != nil || limit < 0 {
+		return 0, fmt.Errorf("invalid --timeout %s - expected a duration such as 30s or 5m", c.Timeout)
+	}
+	return limit, nil
+}
+
+// RecordForeachCommand saves command as the campaign's script
+func RecordForeachCommand(command ForeachCommand) error {
+	contents, err := json.MarshalIndent(command, "", "  ")
+	if err != nil {
+		return err
+	}
+	filename := StatePath(ForeachCommandFilename)
+	if err := os.MkdirAll(filepath.Dir(filename), 0o755); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filename, append(contents, '\n'), 0o644)
+}
+
+// ReadForeachCommand returns the campaign's recorded script
+func ReadForeachCommand() (ForeachCommand, error) {
+	contents, err := ioutil.ReadFile(StatePath(ForeachCommandFilename))
+	if os.IsNotExist(err) {
+		return ForeachCommand{}, errors.New("no foreach command has been recorded for this campaign")
+	}
+	if err != nil {
+		return ForeachCommand{}, err
+	}
+	var command ForeachCommand
+	if err := json.Unmarshal(contents, &command); err != nil {
+		return ForeachCommand{}, err
+	}
+	return command, nil
+}
@@ -0,0 +1,62 @@
+/*
+ * Copyright 2021 Skyscanner Limited.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * https://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package campaign
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/skyscanner/turbolift/cmd/flags"
+	"github.com/skyscanner/turbolift/internal/testsupport"
+)
+
+func TestItRecordsTheForeachCommand(t *testing.T) {
+	testsupport.PrepareTempCampaign(false)
+
+	assert.NoError(t, RecordForeachCommand(ForeachCommand{Command: "sed -i 's/foo/bar/' README.md", Shell: "bash"}))
+
+	command, err := ReadForeachCommand()
+	assert.NoError(t, err)
+	assert.Equal(t, ForeachCommand{Command: "sed -i 's/foo/bar/' README.md", Shell: "bash"}, command)
+}
+
+func TestEachProfileRecordsItsOwnForeachCommand(t *testing.T) {
+	testsupport.PrepareTempCampaign(false)
+	assert.NoError(t, RecordForeachCommand(ForeachCommand{Command: "./phase-1.sh"}))
+
+	flags.Profile = "phase-2"
+	defer func() { flags.Profile = "" }()
+	assert.NoError(t, RecordForeachCommand(ForeachCommand{Command: "./phase-2.sh", Container: "node:18", Timeout: "5m"}))
+
+	command, err := ReadForeachCommand()
+	assert.NoError(t, err)
+	assert.Equal(t, ForeachCommand{Command: "./phase-2.sh", Container: "node:18", Timeout: "5m"}, command)
+	assert.FileExists(t, filepath.Join(ProfilesDir, "phase-2", ForeachCommandFilename))
+
+	flags.Profile = ""
+	command, err = ReadForeachCommand()
+	assert.NoError(t, err)
+	assert.Equal(t, "./phase-1.sh", command.Command)
+}
+
+func TestItErrorsWhenNoForeachCommandHasBeenRecorded(t *testing.T) {
+	testsupport.PrepareTempCampaign(false)
+
+	_, err := ReadForeachCommand()
+	assert.EqualError(t, err, "no foreach command has been recorded for this campaign")
+}
@@ -0,0 +1,57 @@
+/*
+ * Copyright 2021 Skyscanner Limited.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * https://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package campaign
+
+import (
+	"regexp"
+	"strings"
+)
+
+// groupHeader starts an ordering group in a repo file, e.g. `[libraries]`
+var groupHeader = regexp.MustCompile(`^\[([^\]]+)\]$`)
+
+// OrderingGroup is a set of repositories whose PRs are only raised and merged once those of the groups listed before
+// it in the repo file have merged, e.g. shared libraries before the services which use them
+type OrderingGroup struct {
+	Name  string
+	Repos []Repo
+}
+
+// parseGroupHeader returns the name of the ordering group started by a line of a repo file, if it starts one
+func parseGroupHeader(line string) (string, bool) {
+	match := groupHeader.FindStringSubmatch(strings.TrimSpace(line))
+	if match == nil {
+		return "", false
+	}
+	return strings.TrimSpace(match[1]), true
+}
+
+// OrderingGroups divides the repositories between their ordering groups, in the order each group is first listed.
+// Repositories listed before any group header form a group of their own, which comes first.
+func OrderingGroups(repos []Repo) []OrderingGroup {
+	var groups []OrderingGroup
+	index := map[string]int{}
+	for _, repo := range repos {
+		i, ok := index[repo.Group]
+		if !ok {
+			i = len(groups)
+			index[repo.Group] = i
+			groups = append(groups, OrderingGroup{Name: repo.Group})
+		}
+		groups[i].Repos = append(groups[i].Repos, repo)
+	}
+	return groups
+}
@@ -0,0 +1,56 @@
+/*
+ * Copyright 2021 Skyscanner Limited.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * https://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package campaign
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/skyscanner/turbolift/internal/testsupport"
+)
+
+func TestItReadsOrderingGroupsFromTheRepoFile(t *testing.T) {
+	testsupport.PrepareTempCampaign(false, "org/tooling", "[libraries]", "org/lib1", "org/lib2", "", "[ services ]", "org/service1", "[libraries]", "org/lib3")
+
+	campaign, err := OpenCampaign(NewCampaignOptions())
+	assert.NoError(t, err)
+
+	var names [][]string
+	for _, group := range OrderingGroups(campaign.Repos) {
+		groupNames := []string{group.Name}
+		for _, repo := range group.Repos {
+			groupNames = append(groupNames, repo.FullRepoName)
+		}
+		names = append(names, groupNames)
+	}
+	assert.Equal(t, [][]string{
+		{"", "org/tooling"},
+		{"libraries", "org/lib1", "org/lib2", "org/lib3"},
+		{"services", "org/service1"},
+	}, names)
+}
+
+func TestItHasOneOrderingGroupWithoutGroupHeaders(t *testing.T) {
+	testsupport.PrepareTempCampaign(false, "org/repo1", "org/repo2")
+
+	campaign, err := OpenCampaign(NewCampaignOptions())
+	assert.NoError(t, err)
+
+	groups := OrderingGroups(campaign.Repos)
+	assert.Len(t, groups, 1)
+	assert.Equal(t, campaign.Repos, groups[0].Repos)
+}
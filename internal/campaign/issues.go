@@ -0,0 +1,53 @@
+/*
+ * Copyright 2021 Skyscanner Limited.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * https://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package campaign
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/skyscanner/turbolift/internal/github"
+)
+
+// IssuesFilename tracks the issues opened by create-issues, keyed by full repo name
+const IssuesFilename = "issues.json"
+
+// ReadIssues returns the issues which have been opened for the campaign, which is empty if none have been
+func ReadIssues() (map[string]github.CreatedIssue, error) {
+	issues := make(map[string]github.CreatedIssue)
+	contents, err := ioutil.ReadFile(IssuesFilename)
+	if os.IsNotExist(err) {
+		return issues, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(contents, &issues); err != nil {
+		return nil, fmt.Errorf("unable to parse %s: %w", IssuesFilename, err)
+	}
+	return issues, nil
+}
+
+// WriteIssues saves the issues which have been opened for the campaign
+func WriteIssues(issues map[string]github.CreatedIssue) error {
+	contents, err := json.MarshalIndent(issues, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(IssuesFilename, append(contents, '\n'), 0o644)
+}
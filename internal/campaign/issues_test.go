@@ -0,0 +1,46 @@
+/*
+ * Copyright 2021 Skyscanner Limited.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * https://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package campaign
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/skyscanner/turbolift/internal/github"
+	"github.com/skyscanner/turbolift/internal/testsupport"
+)
+
+func TestItReadsNoIssuesBeforeAnyAreWritten(t *testing.T) {
+	testsupport.PrepareTempCampaign(false)
+
+	issues, err := ReadIssues()
+	assert.NoError(t, err)
+	assert.Empty(t, issues)
+}
+
+func TestItReadsWrittenIssues(t *testing.T) {
+	testsupport.PrepareTempCampaign(false)
+
+	written := map[string]github.CreatedIssue{
+		"org/repo1": {Number: 12, Url: "https://github.com/org/repo1/issues/12"},
+	}
+	assert.NoError(t, WriteIssues(written))
+
+	issues, err := ReadIssues()
+	assert.NoError(t, err)
+	assert.Equal(t, written, issues)
+}
@@ -0,0 +1,149 @@
+/*
+ * Copyright 2021 Skyscanner Limited.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * https://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package campaign
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/skyscanner/turbolift/cmd/flags"
+	"github.com/skyscanner/turbolift/internal/github"
+)
+
+// MetadataFilename records the attributes of each repository, as fetched by refresh-metadata, for filtering on
+const MetadataFilename = "repo_metadata.json"
+
+// ReadRepoMetadata returns the metadata recorded for the campaign's repositories, keyed by full repo name, which is
+// empty if refresh-metadata has not been run
+func ReadRepoMetadata() (map[string]*github.RepoMetadata, error) {
+	contents, err := ioutil.ReadFile(MetadataFilename)
+	if os.IsNotExist(err) {
+		return map[string]*github.RepoMetadata{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	metadata := map[string]*github.RepoMetadata{}
+	if err := json.Unmarshal(contents, &metadata); err != nil {
+		return nil, fmt.Errorf("unable to parse %s: %w", MetadataFilename, err)
+	}
+	return metadata, nil
+}
+
+// WriteRepoMetadata records the metadata of the campaign's repositories, keyed by full repo name
+func WriteRepoMetadata(metadata map[string]*github.RepoMetadata) error {
+	contents, err := json.MarshalIndent(metadata, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(MetadataFilename, append(contents, '\n'), 0o644)
+}
+
+// RepoFilter narrows a campaign down to the repositories whose recorded metadata matches all of its conditions
+type RepoFilter struct {
+	// Topics keeps the repositories with any of these topics
+	Topics []string
+	// Languages keeps the repositories whose primary language is any of these, ignoring case
+	Languages []string
+	// SkipArchived leaves out archived repositories
+	SkipArchived bool
+	// PushedSince keeps the repositories pushed to at or after this time, unless it is zero
+	PushedSince time.Time
+}
+
+// ParsePushedSince parses a date (e.g. 2024-01-31) or a duration before now (e.g. 720h) for RepoFilter.PushedSince
+func ParsePushedSince(value string) (time.Time, error) {
+	if date, err := time.Parse("2006-01-02", value); err == nil {
+		return date, nil
+	}
+	if duration, err := time.ParseDuration(value); err == nil {
+		return time.Now().Add(-duration), nil
+	}
+	return time.Time{}, fmt.Errorf("invalid time %s - expected a date such as 2024-01-31 or a duration such as 720h", value)
+}
+
+// IsEmpty reports whether the filter keeps every repository
+func (f RepoFilter) IsEmpty() bool {
+	return len(f.Topics) == 0 && len(f.Languages) == 0 && !f.SkipArchived && f.PushedSince.IsZero()
+}
+
+// Select returns the repositories matching the filter, in their original order. Every repository must have metadata
+// recorded, so that none are left out only because refresh-metadata has not been run since they were added.
+func (f RepoFilter) Select(repos []Repo, metadata map[string]*github.RepoMetadata) ([]Repo, error) {
+	var selected []Repo
+	for _, repo := range repos {
+		repoMetadata, ok := metadata[repo.FullRepoName]
+		if !ok {
+			return nil, fmt.Errorf("no metadata is recorded for %s - run turbolift refresh-metadata to fetch it", repo.FullRepoName)
+		}
+		if f.matches(repoMetadata) {
+			selected = append(selected, repo)
+		}
+	}
+	return selected, nil
+}
+
+func (f RepoFilter) matches(metadata *github.RepoMetadata) bool {
+	if f.SkipArchived && metadata.Archived {
+		return false
+	}
+	if !f.PushedSince.IsZero() && metadata.PushedAt.Before(f.PushedSince) {
+		return false
+	}
+	if len(f.Languages) > 0 && !containsFold(f.Languages, metadata.Language) {
+		return false
+	}
+	if len(f.Topics) > 0 {
+		for _, topic := range metadata.Topics {
+			if containsFold(f.Topics, topic) {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+func containsFold(values []string, value string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// repoFilterFromFlags returns the filter given with --only-topic, --only-language, --skip-archived and --pushed-since
+func repoFilterFromFlags() (RepoFilter, error) {
+	filter := RepoFilter{
+		Topics:       flags.OnlyTopics,
+		Languages:    flags.OnlyLanguages,
+		SkipArchived: flags.SkipArchived,
+	}
+	if flags.PushedSince != "" {
+		pushedSince, err := ParsePushedSince(flags.PushedSince)
+		if err != nil {
+			return RepoFilter{}, err
+		}
+		filter.PushedSince = pushedSince
+	}
+	return filter, nil
+}
@@ -0,0 +1,102 @@
+/*
+ * Copyright 2021 Skyscanner Limited.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * https://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package campaign
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/skyscanner/turbolift/cmd/flags"
+	"github.com/skyscanner/turbolift/internal/github"
+	"github.com/skyscanner/turbolift/internal/testsupport"
+)
+
+var recordedMetadata = map[string]*github.RepoMetadata{
+	"org/repo1": {Topics: []string{"payments", "java"}, Language: "Java", PushedAt: time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC), DefaultBranch: "main"},
+	"org/repo2": {Topics: []string{"payments"}, Language: "Go", PushedAt: time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC), DefaultBranch: "main"},
+	"org/repo3": {Archived: true, Topics: []string{"payments"}, Language: "Go", DefaultBranch: "master"},
+	"org/repo4": {Language: "Go", PushedAt: time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC), DefaultBranch: "main"},
+}
+
+func TestItFiltersReposByTheirMetadata(t *testing.T) {
+	repos := []Repo{{FullRepoName: "org/repo1"}, {FullRepoName: "org/repo2"}, {FullRepoName: "org/repo3"}, {FullRepoName: "org/repo4"}}
+
+	for _, tc := range []struct {
+		filter   RepoFilter
+		expected []string
+	}{
+		{RepoFilter{Topics: []string{"payments"}}, []string{"org/repo1", "org/repo2", "org/repo3"}},
+		{RepoFilter{Topics: []string{"payments"}, SkipArchived: true}, []string{"org/repo1", "org/repo2"}},
+		{RepoFilter{Languages: []string{"go"}}, []string{"org/repo2", "org/repo3", "org/repo4"}},
+		{RepoFilter{PushedSince: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}, []string{"org/repo1", "org/repo4"}},
+		{RepoFilter{Topics: []string{"payments"}, Languages: []string{"Go"}, SkipArchived: true}, []string{"org/repo2"}},
+	} {
+		selected, err := tc.filter.Select(repos, recordedMetadata)
+		assert.NoError(t, err)
+		var names []string
+		for _, repo := range selected {
+			names = append(names, repo.FullRepoName)
+		}
+		assert.Equal(t, tc.expected, names, "%+v", tc.filter)
+	}
+}
+
+func TestItParsesWhenReposWerePushedSince(t *testing.T) {
+	date, err := ParsePushedSince("2024-01-31")
+	assert.NoError(t, err)
+	assert.Equal(t, time.Date(2024, 1, 31, 0, 0, 0, 0, time.UTC), date)
+
+	since, err := ParsePushedSince("720h")
+	assert.NoError(t, err)
+	assert.WithinDuration(t, time.Now().Add(-720*time.Hour), since, time.Minute)
+
+	_, err = ParsePushedSince("last month")
+	assert.Error(t, err)
+}
+
+func TestItOnlyOpensTheReposMatchingTheFilterFlags(t *testing.T) {
+	testsupport.PrepareTempCampaign(false, "org/repo1", "org/repo2", "org/repo3")
+	assert.NoError(t, WriteRepoMetadata(recordedMetadata))
+	flags.OnlyTopics = []string{"payments"}
+	flags.SkipArchived = true
+	defer func() {
+		flags.OnlyTopics = nil
+		flags.SkipArchived = false
+	}()
+
+	campaign, err := OpenCampaign(NewCampaignOptions())
+	assert.NoError(t, err)
+	assert.Len(t, campaign.Repos, 2)
+	assert.Equal(t, "org/repo1", campaign.Repos[0].FullRepoName)
+	assert.Equal(t, "org/repo2", campaign.Repos[1].FullRepoName)
+
+	options := NewCampaignOptions()
+	options.Unfiltered = true
+	campaign, err = OpenCampaign(options)
+	assert.NoError(t, err)
+	assert.Len(t, campaign.Repos, 3)
+}
+
+func TestItRefusesToFilterReposWithoutMetadata(t *testing.T) {
+	testsupport.PrepareTempCampaign(false, "org/repo1")
+	flags.OnlyTopics = []string{"payments"}
+	defer func() { flags.OnlyTopics = nil }()
+
+	_, err := OpenCampaign(NewCampaignOptions())
+	assert.EqualError(t, err, "no metadata is recorded for org/repo1 - run turbolift refresh-metadata to fetch it")
+}
@@ -0,0 +1,77 @@
+/*
+ * Copyright 2021 Skyscanner Limited.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * https://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package campaign
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Priority decides which repositories commands work on first, so that the most important ones are done if a campaign
+// is cut short
+type Priority int
+
+const (
+	PriorityLow    Priority = -1
+	PriorityNormal Priority = 0
+	PriorityHigh   Priority = 1
+)
+
+// priorityPrefix marks the priority of a repository after its name in a repo file, e.g. `org/repo priority=high`
+const priorityPrefix = "priority="
+
+var priorities = map[string]Priority{
+	"high":   PriorityHigh,
+	"normal": PriorityNormal,
+	"low":    PriorityLow,
+}
+
+// parseRepoLine splits an entry of a repo file into the repository (or org/*) it names and its priority
+func parseRepoLine(line string) (string, Priority, error) {
+	fields := strings.Fields(line)
+	switch len(fields) {
+	case 1:
+		return fields[0], PriorityNormal, nil
+	case 2:
+		if !strings.HasPrefix(fields[1], priorityPrefix) {
+			return "", PriorityNormal, fmt.Errorf("expected a priority such as %shigh after the repository, not %s", priorityPrefix, fields[1])
+		}
+		priority, ok := priorities[strings.TrimPrefix(fields[1], priorityPrefix)]
+		if !ok {
+			return "", PriorityNormal, fmt.Errorf("%s is not a priority - expected high, normal or low", strings.TrimPrefix(fields[1], priorityPrefix))
+		}
+		return fields[0], priority, nil
+	default:
+		return "", PriorityNormal, fmt.Errorf("expected a repository, optionally followed by a priority such as %shigh", priorityPrefix)
+	}
+}
+
+// sortByPriority puts higher priority repositories first under each group header, leaving the groups, and the
+// repositories of the same priority, in the order they are listed
+func sortByPriority(repos []Repo) {
+	start := 0
+	for end := 1; end <= len(repos); end++ {
+		if end < len(repos) && repos[end].Group == repos[start].Group {
+			continue
+		}
+		listed := repos[start:end]
+		sort.SliceStable(listed, func(i, j int) bool {
+			return listed[i].Priority > listed[j].Priority
+		})
+		start = end
+	}
+}
@@ -0,0 +1,69 @@
+/*
+ * Copyright 2021 Skyscanner Limited.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * https://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package campaign
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/skyscanner/turbolift/internal/testsupport"
+)
+
+func TestHigherPriorityReposComeFirst(t *testing.T) {
+	testsupport.PrepareTempCampaign(false, "org/repo1 priority=low", "org/repo2", "org/repo3 priority=high", "org/repo4 priority=normal", "org/repo5 priority=high")
+
+	campaign, err := OpenCampaign(NewCampaignOptions())
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"org/repo3", "org/repo5", "org/repo2", "org/repo4", "org/repo1"}, repoNames(campaign.Repos))
+	assert.Equal(t, PriorityHigh, campaign.Repos[0].Priority)
+	assert.Equal(t, PriorityLow, campaign.Repos[4].Priority)
+}
+
+func TestPrioritiesDoNotReorderGroups(t *testing.T) {
+	testsupport.PrepareTempCampaign(false, "[libraries]", "org/lib1", "org/lib2 priority=high", "[services]", "org/service1 priority=low", "org/service2 priority=high")
+
+	campaign, err := OpenCampaign(NewCampaignOptions())
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"org/lib2", "org/lib1", "org/service2", "org/service1"}, repoNames(campaign.Repos))
+}
+
+func TestItRejectsInvalidPriorities(t *testing.T) {
+	for _, line := range []string{"org/repo1 priority=urgent", "org/repo1 high", "org/repo1 priority=high extra"} {
+		_, _, err := parseRepoLine(line)
+		assert.Error(t, err, line)
+	}
+}
+
+func TestItDropsReposListedWithAPriority(t *testing.T) {
+	testsupport.PrepareTempCampaign(false, "org/repo1 priority=high", "org/repo2")
+
+	notListed, err := DropRepos("repos.txt", []string{"org/repo1"}, "removed")
+	assert.NoError(t, err)
+	assert.Empty(t, notListed)
+
+	campaign, err := OpenCampaign(NewCampaignOptions())
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"org/repo2"}, repoNames(campaign.Repos))
+}
+
+func repoNames(repos []Repo) []string {
+	var names []string
+	for _, repo := range repos {
+		names = append(names, repo.FullRepoName)
+	}
+	return names
+}
@@ -0,0 +1,65 @@
+/*
+ * Copyright 2021 Skyscanner Limited.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * https://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package campaign
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/skyscanner/turbolift/cmd/flags"
+)
+
+// ProfilesDir holds a directory for each profile of the campaign, with the profile's own state and, optionally, its
+// own PR description and repo file
+const ProfilesDir = "profiles"
+
+// SelectedProfile returns the profile of the campaign that commands work on, selected with --profile, or an empty
+// string if there is none. A profile shares the campaign's working copies, but has its own branch.
+func SelectedProfile() string {
+	return flags.Profile
+}
+
+// validateProfileName rejects names which cannot be used for both a directory and part of a branch name
+func validateProfileName(name string) error {
+	if name == "." || strings.HasPrefix(name, "-") || strings.ContainsAny(name, "/\\ \t~^:?*[") || strings.Contains(name, "..") {
+		return fmt.Errorf("%s cannot be used as the name of a profile", name)
+	}
+	return nil
+}
+
+// StatePath returns where the campaign keeps a file of its state, such as its execution history, which each profile
+// keeps separately in its own directory
+func StatePath(filename string) string {
+	if flags.Profile == "" {
+		return filename
+	}
+	return filepath.Join(ProfilesDir, flags.Profile, filename)
+}
+
+// ProfileFile returns the profile's own copy of a campaign file, such as its PR description, if it has one, or else
+// the campaign's file
+func ProfileFile(filename string) string {
+	if flags.Profile == "" || filename == StdinFilename || filepath.IsAbs(filename) {
+		return filename
+	}
+	profileFilename := filepath.Join(ProfilesDir, flags.Profile, filename)
+	if _, err := os.Stat(profileFilename); err == nil {
+		return profileFilename
+	}
+	return filename
+}
@@ -0,0 +1,62 @@
+/*
+ * Copyright 2021 Skyscanner Limited.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * https://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package campaign
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/skyscanner/turbolift/cmd/flags"
+	"github.com/skyscanner/turbolift/internal/testsupport"
+)
+
+func TestAProfileHasItsOwnBranch(t *testing.T) {
+	testsupport.PrepareTempCampaign(false, "org/repo1")
+	flags.Profile = "phase-2"
+	defer func() { flags.Profile = "" }()
+
+	campaign, err := OpenCampaign(NewCampaignOptions())
+	assert.NoError(t, err)
+	assert.Equal(t, testsupport.Pwd()+"-phase-2", campaign.Name)
+	assert.Equal(t, filepath.Join(ProfilesDir, "phase-2", "summary.json"), StatePath("summary.json"))
+}
+
+func TestAProfileUsesItsOwnCampaignFilesWhenItHasThem(t *testing.T) {
+	testsupport.PrepareTempCampaign(false, "org/repo1", "org/repo2")
+	assert.NoError(t, os.MkdirAll(filepath.Join(ProfilesDir, "phase-2"), 0o755))
+	testsupport.CreateAnotherRepoFile(filepath.Join(ProfilesDir, "phase-2", "repos.txt"), "org/repo2")
+	flags.Profile = "phase-2"
+	defer func() { flags.Profile = "" }()
+
+	campaign, err := OpenCampaign(NewCampaignOptions())
+	assert.NoError(t, err)
+	assert.Len(t, campaign.Repos, 1)
+	assert.Equal(t, "org/repo2", campaign.Repos[0].FullRepoName)
+	// without its own PR description, the profile uses the campaign's
+	assert.Equal(t, "PR title", campaign.PrTitle)
+}
+
+func TestItRejectsProfileNamesWhichCannotBeUsedInBranchNames(t *testing.T) {
+	testsupport.PrepareTempCampaign(false, "org/repo1")
+	flags.Profile = "phase/2"
+	defer func() { flags.Profile = "" }()
+
+	_, err := OpenCampaign(NewCampaignOptions())
+	assert.Error(t, err)
+}
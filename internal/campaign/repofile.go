@@ -0,0 +1,115 @@
+/*
+ * Copyright 2021 Skyscanner Limited.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * https://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package campaign
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+// DropRepos comments out the lines of a repo file which list the given repositories, noting the reason, so that later
+// commands no longer operate on them. It returns the repositories which could not be dropped because they are not
+// listed individually, e.g. as they come from an org/* entry.
+func DropRepos(filename string, repoNames []string, reason string) ([]string, error) {
+	if filename == StdinFilename {
+		return nil, errors.New("repositories cannot be dropped from a list read from stdin")
+	}
+
+	contents, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read repo file %s: %w", filename, err)
+	}
+
+	toDrop := make(map[string]bool)
+	for _, name := range repoNames {
+		toDrop[name] = true
+	}
+
+	lines := strings.Split(string(contents), "\n")
+	for i, line := range lines {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		// the repository may be followed by its priority
+		name := fields[0]
+		if toDrop[name] {
+			lines[i] = fmt.Sprintf("# %s (%s)", name, reason)
+			delete(toDrop, name)
+		}
+	}
+
+	var notListed []string
+	for _, name := range repoNames {
+		if toDrop[name] {
+			notListed = append(notListed, name)
+		}
+	}
+
+	if err := ioutil.WriteFile(filename, []byte(strings.Join(lines, "\n")), 0o644); err != nil {
+		return nil, fmt.Errorf("unable to write repo file %s: %w", filename, err)
+	}
+	return notListed, nil
+}
+
+// AddRepos appends repositories, given by their full names, to the end of a repo file
+func AddRepos(filename string, repoNames []string) error {
+	if filename == StdinFilename {
+		return errors.New("repositories cannot be added to a list read from stdin")
+	}
+	for _, name := range repoNames {
+		if _, err := parseRepo(name); err != nil {
+			return fmt.Errorf("%s is not the full name of a repository, e.g. org/repo", name)
+		}
+	}
+
+	contents, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return fmt.Errorf("unable to read repo file %s: %w", filename, err)
+	}
+	if len(contents) > 0 && !strings.HasSuffix(string(contents), "\n") {
+		contents = append(contents, '\n')
+	}
+	contents = append(contents, strings.Join(repoNames, "\n")+"\n"...)
+
+	if err := ioutil.WriteFile(filename, contents, 0o644); err != nil {
+		return fmt.Errorf("unable to write repo file %s: %w", filename, err)
+	}
+	return nil
+}
+
+// ForgetRepos removes what the campaign has recorded about repositories, such as their base branches and metadata,
+// once they have been removed from it
+func ForgetRepos(repoNames []string) error {
+	if err := forgetBaseBranches(repoNames); err != nil {
+		return err
+	}
+
+	if _, err := os.Stat(MetadataFilename); os.IsNotExist(err) {
+		return nil
+	}
+	metadata, err := ReadRepoMetadata()
+	if err != nil {
+		return err
+	}
+	for _, name := range repoNames {
+		delete(metadata, name)
+	}
+	return WriteRepoMetadata(metadata)
+}
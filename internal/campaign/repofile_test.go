@@ -0,0 +1,82 @@
+/*
+ * Copyright 2021 Skyscanner Limited.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * https://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package campaign
+
+import (
+	"io/ioutil"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/skyscanner/turbolift/internal/github"
+	"github.com/skyscanner/turbolift/internal/testsupport"
+)
+
+func TestItCommentsOutDroppedRepos(t *testing.T) {
+	testsupport.PrepareTempCampaign(false, "org/repo1", "org/repo2", "org/repo3")
+
+	notListed, err := DropRepos("repos.txt", []string{"org/repo3", "org/repo1", "org/other"}, "already applied")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"org/other"}, notListed)
+
+	contents, err := ioutil.ReadFile("repos.txt")
+	assert.NoError(t, err)
+	assert.Equal(t, "# org/repo1 (already applied)\norg/repo2\n# org/repo3 (already applied)", string(contents))
+
+	repos, err := readReposTxtFile("repos.txt")
+	assert.NoError(t, err)
+	assert.Equal(t, []Repo{{OrgName: "org", RepoName: "repo2", FullRepoName: "org/repo2"}}, repos)
+}
+
+func TestItForgetsWhatIsRecordedAboutRemovedRepos(t *testing.T) {
+	testsupport.PrepareTempCampaign(false, "org/repo1", "org/repo2")
+	assert.NoError(t, RecordBaseBranch(Repo{FullRepoName: "org/repo1"}, "main"))
+	assert.NoError(t, RecordBaseBranch(Repo{FullRepoName: "org/repo2"}, "develop"))
+	assert.NoError(t, WriteRepoMetadata(map[string]*github.RepoMetadata{
+		"org/repo1": {Language: "Go"},
+		"org/repo2": {Language: "Java"},
+	}))
+
+	assert.NoError(t, ForgetRepos([]string{"org/repo1"}))
+
+	recorded, err := ioutil.ReadFile(BaseBranchesFilename)
+	assert.NoError(t, err)
+	assert.Equal(t, "org/repo2 develop\n", string(recorded))
+	metadata, err := ReadRepoMetadata()
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]*github.RepoMetadata{"org/repo2": {Language: "Java"}}, metadata)
+}
+
+func TestForgettingReposRecordsNothingNew(t *testing.T) {
+	testsupport.PrepareTempCampaign(false, "org/repo1")
+
+	assert.NoError(t, ForgetRepos([]string{"org/repo1"}))
+	assert.NoFileExists(t, BaseBranchesFilename)
+	assert.NoFileExists(t, MetadataFilename)
+}
+
+func TestItAddsReposToTheEndOfTheRepoFile(t *testing.T) {
+	testsupport.PrepareTempCampaign(false, "org/repo1")
+
+	assert.NoError(t, AddRepos("repos.txt", []string{"org/repo2", "github.example.com/org/repo3"}))
+
+	repos, err := readReposTxtFile("repos.txt")
+	assert.NoError(t, err)
+	assert.Len(t, repos, 3)
+	assert.Equal(t, "github.example.com/org/repo3", repos[2].FullRepoName)
+
+	assert.Error(t, AddRepos("repos.txt", []string{"repo4"}))
+}
@@ -0,0 +1,94 @@
+/*
+ * Copyright 2021 Skyscanner Limited.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * https://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package campaign
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/skyscanner/turbolift/cmd/flags"
+	"github.com/skyscanner/turbolift/internal/history"
+)
+
+// resultsOutcomes are the outcomes which --filter-from-results accepts, and the outcomes in the history they stand for
+var resultsOutcomes = map[string]string{
+	"success":   history.Succeeded,
+	"succeeded": history.Succeeded,
+	"failed":    history.Failed,
+	"failure":   history.Failed,
+	"skipped":   history.Warning,
+	"warning":   history.Warning,
+}
+
+// ResultsFilter narrows a campaign down to the repositories with an outcome in the latest run of a command, as
+// recorded in the campaign's execution history
+type ResultsFilter struct {
+	// Command is the command as recorded in the history, e.g. turbolift clone
+	Command string
+	Outcome string
+}
+
+// ParseResultsFilter parses a filter given as COMMAND=OUTCOME, e.g. clone=success or create-prs=skipped
+func ParseResultsFilter(value string) (ResultsFilter, error) {
+	parts := strings.SplitN(value, "=", 2)
+	if len(parts) != 2 || strings.TrimSpace(parts[0]) == "" {
+		return ResultsFilter{}, fmt.Errorf("invalid results filter %s - expected the form COMMAND=OUTCOME, e.g. clone=success", value)
+	}
+	outcome, ok := resultsOutcomes[strings.ToLower(parts[1])]
+	if !ok {
+		return ResultsFilter{}, fmt.Errorf("invalid outcome %s in results filter %s - expected success, failed or skipped", parts[1], value)
+	}
+	return ResultsFilter{Command: "turbolift " + strings.TrimSpace(parts[0]), Outcome: outcome}, nil
+}
+
+// Select returns the repositories which had the filter's outcome in the latest run of its command, in their original
+// order. Repositories which the run did not work on are left out.
+func (f ResultsFilter) Select(repos []Repo, runs []history.Run) ([]Repo, error) {
+	run, ok := history.LastRun(runs, f.Command)
+	if !ok {
+		return nil, fmt.Errorf("no results of %s are recorded in %s", f.Command, StatePath(history.Filename))
+	}
+
+	var selected []Repo
+	for _, repo := range repos {
+		if run.OutcomeOf(repo.FullRepoName) == f.Outcome {
+			selected = append(selected, repo)
+		}
+	}
+	return selected, nil
+}
+
+// filterReposByResults narrows the repositories down by the filters given with --filter-from-results, all of which
+// they must match
+func filterReposByResults(repos []Repo) ([]Repo, error) {
+	if len(flags.FilterFromResults) == 0 {
+		return repos, nil
+	}
+	runs, err := history.Read(StatePath(history.Filename))
+	if err != nil {
+		return nil, err
+	}
+	for _, value := range flags.FilterFromResults {
+		filter, err := ParseResultsFilter(value)
+		if err != nil {
+			return nil, err
+		}
+		if repos, err = filter.Select(repos, runs); err != nil {
+			return nil, err
+		}
+	}
+	return repos, nil
+}
@@ -0,0 +1,87 @@
+/*
+ * Copyright 2021 Skyscanner Limited.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * https://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package campaign
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/skyscanner/turbolift/cmd/flags"
+	"github.com/skyscanner/turbolift/internal/history"
+	"github.com/skyscanner/turbolift/internal/testsupport"
+)
+
+func TestItParsesResultsFilters(t *testing.T) {
+	filter, err := ParseResultsFilter("clone=success")
+	assert.NoError(t, err)
+	assert.Equal(t, ResultsFilter{Command: "turbolift clone", Outcome: history.Succeeded}, filter)
+
+	filter, err = ParseResultsFilter("create-prs=skipped")
+	assert.NoError(t, err)
+	assert.Equal(t, ResultsFilter{Command: "turbolift create-prs", Outcome: history.Warning}, filter)
+
+	for _, invalid := range []string{"", "clone", "=success", "clone=maybe"} {
+		_, err := ParseResultsFilter(invalid)
+		assert.Error(t, err, invalid)
+	}
+}
+
+func TestItOnlyOpensTheReposWithAnOutcomeInTheLatestRunOfACommand(t *testing.T) {
+	testsupport.PrepareTempCampaign(false, "org/repo1", "org/repo2", "org/repo3")
+	assert.NoError(t, history.Append(history.Filename, history.Run{
+		Command: "turbolift commit",
+		Repos:   []history.RepoOutcome{{Repo: "org/repo1", Outcome: history.Failed}},
+	}))
+	assert.NoError(t, history.Append(history.Filename, history.Run{
+		Command: "turbolift commit",
+		Repos: []history.RepoOutcome{
+			{Repo: "org/repo1", Outcome: history.Succeeded},
+			{Repo: "org/repo2", Outcome: history.Failed},
+			{Repo: "org/repo3", Outcome: history.Succeeded},
+		},
+	}))
+	assert.NoError(t, history.Append(history.Filename, history.Run{
+		Command: "turbolift foreach",
+		Repos: []history.RepoOutcome{
+			{Repo: "org/repo1", Outcome: history.Succeeded},
+			{Repo: "org/repo3", Outcome: history.Warning},
+		},
+	}))
+	flags.FilterFromResults = []string{"commit=success"}
+	defer func() { flags.FilterFromResults = nil }()
+
+	campaign, err := OpenCampaign(NewCampaignOptions())
+	assert.NoError(t, err)
+	assert.Len(t, campaign.Repos, 2)
+	assert.Equal(t, "org/repo1", campaign.Repos[0].FullRepoName)
+	assert.Equal(t, "org/repo3", campaign.Repos[1].FullRepoName)
+
+	flags.FilterFromResults = []string{"commit=success", "foreach=success"}
+	campaign, err = OpenCampaign(NewCampaignOptions())
+	assert.NoError(t, err)
+	assert.Len(t, campaign.Repos, 1)
+	assert.Equal(t, "org/repo1", campaign.Repos[0].FullRepoName)
+}
+
+func TestItRefusesToFilterByTheResultsOfACommandWhichHasNotRun(t *testing.T) {
+	testsupport.PrepareTempCampaign(false, "org/repo1")
+	flags.FilterFromResults = []string{"clone=failed"}
+	defer func() { flags.FilterFromResults = nil }()
+
+	_, err := OpenCampaign(NewCampaignOptions())
+	assert.EqualError(t, err, "no results of turbolift clone are recorded in summary.json")
+}
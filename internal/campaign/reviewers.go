@@ -0,0 +1,140 @@
+/*
+ * Copyright 2021 Skyscanner Limited.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * https://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package campaign
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// ReviewersFilename records the reviewers whose review was requested on each PR, keyed by full repo name
+const ReviewersFilename = "reviewers.json"
+
+// ReviewerPool is the reviewers that PRs are shared between, in proportion to their weights
+type ReviewerPool []PoolMember
+
+type PoolMember struct {
+	Login  string
+	Weight int
+}
+
+// ParseReviewerPool parses reviewers given as LOGIN or LOGIN:WEIGHT, where a reviewer with weight 2 is given twice as
+// many PRs as one with the default weight of 1. Teams can be given as ORG/TEAM.
+func ParseReviewerPool(entries []string) (ReviewerPool, error) {
+	var pool ReviewerPool
+	for _, entry := range entries {
+		member := PoolMember{Login: entry, Weight: 1}
+		if i := strings.LastIndex(entry, ":"); i >= 0 {
+			weight, err := strconv.Atoi(entry[i+1:])
+			if err != nil || weight <= 0 || i == 0 {
+				return nil, fmt.Errorf("invalid reviewer %s - expected the form LOGIN or LOGIN:WEIGHT, with a positive weight", entry)
+			}
+			member = PoolMember{Login: entry[:i], Weight: weight}
+		}
+		pool = append(pool, member)
+	}
+	return pool, nil
+}
+
+// Next chooses the reviewer for a PR, given the reviewers already chosen for the campaign's other PRs: the one with
+// the fewest PRs for their weight, with ties going to the earliest in the pool. Successive PRs therefore rotate
+// round the pool, carrying on from where any earlier run of the campaign left off.
+func (pool ReviewerPool) Next(assigned map[string][]string) string {
+	counts := make(map[string]int)
+	for _, reviewers := range assigned {
+		for _, reviewer := range reviewers {
+			counts[reviewer]++
+		}
+	}
+
+	best := -1
+	for i, member := range pool {
+		// compare counts[i]/weight[i] < counts[best]/weight[best] without dividing
+		if best < 0 || counts[member.Login]*pool[best].Weight < counts[pool[best].Login]*member.Weight {
+			best = i
+		}
+	}
+	if best < 0 {
+		return ""
+	}
+	return pool[best].Login
+}
+
+// ReviewerMapping gives the reviewers for repositories, keyed by full repo name, or by org/* for every repository
+// in an org which is not given individually
+type ReviewerMapping map[string][]string
+
+// ReadReviewerMapping reads a file where each line is a repository (or org/*) followed by its reviewers, separated
+// by spaces or commas, e.g. `org/repo1 alice org/payments-team`. Empty lines and lines starting with # are ignored.
+func ReadReviewerMapping(filename string) (ReviewerMapping, error) {
+	contents, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("unable to open reviewers file: %s", filename)
+	}
+
+	mapping := make(ReviewerMapping)
+	for i, line := range strings.Split(string(contents), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.FieldsFunc(line, func(r rune) bool {
+			return r == ',' || r == ' ' || r == '\t'
+		})
+		if len(fields) < 2 {
+			return nil, fmt.Errorf("line %d of %s has no reviewers: %s", i+1, filename, line)
+		}
+		mapping[fields[0]] = append(mapping[fields[0]], fields[1:]...)
+	}
+	return mapping, nil
+}
+
+// For returns the reviewers for the repository, or nil if none are given for it or its org
+func (m ReviewerMapping) For(repo Repo) []string {
+	if reviewers, ok := m[repo.FullRepoName]; ok {
+		return reviewers
+	}
+	return m[strings.TrimSuffix(repo.FullRepoName, repo.RepoName)+"*"]
+}
+
+// ReadReviewers returns the reviewers which have been requested for the campaign's PRs, which is empty if none have been
+func ReadReviewers() (map[string][]string, error) {
+	reviewers := make(map[string][]string)
+	contents, err := ioutil.ReadFile(ReviewersFilename)
+	if os.IsNotExist(err) {
+		return reviewers, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(contents, &reviewers); err != nil {
+		return nil, fmt.Errorf("unable to parse %s: %w", ReviewersFilename, err)
+	}
+	return reviewers, nil
+}
+
+// WriteReviewers saves the reviewers which have been requested for the campaign's PRs
+func WriteReviewers(reviewers map[string][]string) error {
+	contents, err := json.MarshalIndent(reviewers, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(ReviewersFilename, append(contents, '\n'), 0o644)
+}
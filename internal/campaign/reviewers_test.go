@@ -0,0 +1,114 @@
+/*
+ * Copyright 2021 Skyscanner Limited.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * https://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package campaign
+
+import (
+	"io/ioutil"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/skyscanner/turbolift/internal/testsupport"
+)
+
+func TestItParsesReviewerPools(t *testing.T) {
+	pool, err := ParseReviewerPool([]string{"alice", "bob:3", "org/platform-team:2"})
+	assert.NoError(t, err)
+	assert.Equal(t, ReviewerPool{
+		{Login: "alice", Weight: 1},
+		{Login: "bob", Weight: 3},
+		{Login: "org/platform-team", Weight: 2},
+	}, pool)
+
+	for _, entry := range []string{"alice:", "alice:0", "alice:x", ":2"} {
+		_, err := ParseReviewerPool([]string{entry})
+		assert.EqualError(t, err, "invalid reviewer "+entry+" - expected the form LOGIN or LOGIN:WEIGHT, with a positive weight")
+	}
+}
+
+func TestItRotatesReviewersRoundThePool(t *testing.T) {
+	pool := ReviewerPool{{Login: "alice", Weight: 1}, {Login: "bob", Weight: 1}, {Login: "carol", Weight: 1}}
+
+	assigned := map[string][]string{}
+	var chosen []string
+	for _, repo := range []string{"org/repo1", "org/repo2", "org/repo3", "org/repo4"} {
+		reviewer := pool.Next(assigned)
+		assigned[repo] = []string{reviewer}
+		chosen = append(chosen, reviewer)
+	}
+	assert.Equal(t, []string{"alice", "bob", "carol", "alice"}, chosen)
+}
+
+func TestItSharesReviewsInProportionToWeights(t *testing.T) {
+	pool := ReviewerPool{{Login: "alice", Weight: 1}, {Login: "bob", Weight: 2}}
+
+	assigned := map[string][]string{}
+	counts := map[string]int{}
+	for i := 0; i < 9; i++ {
+		reviewer := pool.Next(assigned)
+		assigned[string(rune('a'+i))] = []string{reviewer}
+		counts[reviewer]++
+	}
+	assert.Equal(t, map[string]int{"alice": 3, "bob": 6}, counts)
+}
+
+func TestItCarriesOnFromEarlierAssignments(t *testing.T) {
+	pool := ReviewerPool{{Login: "alice", Weight: 1}, {Login: "bob", Weight: 1}}
+
+	assert.Equal(t, "bob", pool.Next(map[string][]string{"org/repo1": {"alice"}}))
+	assert.Equal(t, "", ReviewerPool{}.Next(nil))
+}
+
+func TestItReadsReviewerMappings(t *testing.T) {
+	testsupport.PrepareTempCampaign(false)
+	err := ioutil.WriteFile("owners.txt", []byte("# owners\norg/repo1 alice, org/payments-team\n\norg/* bob\nmygitserver.com/other/repo2\tcarol\n"), 0o644)
+	assert.NoError(t, err)
+
+	mapping, err := ReadReviewerMapping("owners.txt")
+	assert.NoError(t, err)
+
+	assert.Equal(t, []string{"alice", "org/payments-team"}, mapping.For(Repo{OrgName: "org", RepoName: "repo1", FullRepoName: "org/repo1"}))
+	assert.Equal(t, []string{"bob"}, mapping.For(Repo{OrgName: "org", RepoName: "repo3", FullRepoName: "org/repo3"}))
+	assert.Equal(t, []string{"carol"}, mapping.For(Repo{Host: "mygitserver.com", OrgName: "other", RepoName: "repo2", FullRepoName: "mygitserver.com/other/repo2"}))
+	assert.Nil(t, mapping.For(Repo{OrgName: "acme", RepoName: "repo1", FullRepoName: "acme/repo1"}))
+}
+
+func TestItRejectsReviewerMappingsWithoutReviewers(t *testing.T) {
+	testsupport.PrepareTempCampaign(false)
+	err := ioutil.WriteFile("owners.txt", []byte("org/repo1 alice\norg/repo2\n"), 0o644)
+	assert.NoError(t, err)
+
+	_, err = ReadReviewerMapping("owners.txt")
+	assert.EqualError(t, err, "line 2 of owners.txt has no reviewers: org/repo2")
+
+	_, err = ReadReviewerMapping("missing.txt")
+	assert.EqualError(t, err, "unable to open reviewers file: missing.txt")
+}
+
+func TestItReadsWrittenReviewers(t *testing.T) {
+	testsupport.PrepareTempCampaign(false)
+
+	reviewers, err := ReadReviewers()
+	assert.NoError(t, err)
+	assert.Empty(t, reviewers)
+
+	written := map[string][]string{"org/repo1": {"alice"}}
+	assert.NoError(t, WriteReviewers(written))
+
+	reviewers, err = ReadReviewers()
+	assert.NoError(t, err)
+	assert.Equal(t, written, reviewers)
+}
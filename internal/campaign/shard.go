@@ -0,0 +1,58 @@
+/*
+ * Copyright 2021 Skyscanner Limited.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * https://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package campaign
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Shard selects a deterministic subset of a campaign's repositories, so that a campaign can be split across
+// several machines or CI jobs. Shard 1/4 holds the 1st, 5th, 9th, ... repositories of the repo file.
+type Shard struct {
+	Index int
+	Count int
+}
+
+// ParseShard parses a shard given as i/N, where 1 <= i <= N
+func ParseShard(value string) (Shard, error) {
+	parts := strings.Split(value, "/")
+	if len(parts) != 2 {
+		return Shard{}, fmt.Errorf("invalid shard %s - expected the form i/N, e.g. 1/4", value)
+	}
+	index, indexErr := strconv.Atoi(parts[0])
+	count, countErr := strconv.Atoi(parts[1])
+	if indexErr != nil || countErr != nil || count < 1 || index < 1 || index > count {
+		return Shard{}, fmt.Errorf("invalid shard %s - expected the form i/N, where i is between 1 and N", value)
+	}
+	return Shard{Index: index, Count: count}, nil
+}
+
+// Select returns the repositories belonging to the shard, in their original order
+func (s Shard) Select(repos []Repo) []Repo {
+	var selected []Repo
+	for i, repo := range repos {
+		if i%s.Count == s.Index-1 {
+			selected = append(selected, repo)
+		}
+	}
+	return selected
+}
+
+func (s Shard) String() string {
+	return fmt.Sprintf("%d/%d", s.Index, s.Count)
+}
@@ -0,0 +1,72 @@
+/*
+ * Copyright 2021 Skyscanner Limited.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * https://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package campaign
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/skyscanner/turbolift/cmd/flags"
+	"github.com/skyscanner/turbolift/internal/testsupport"
+)
+
+func TestItParsesShards(t *testing.T) {
+	shard, err := ParseShard("2/4")
+	assert.NoError(t, err)
+	assert.Equal(t, Shard{Index: 2, Count: 4}, shard)
+	assert.Equal(t, "2/4", shard.String())
+
+	for _, invalid := range []string{"", "2", "0/4", "5/4", "1/0", "a/b", "1/2/3"} {
+		_, err := ParseShard(invalid)
+		assert.Error(t, err, invalid)
+	}
+}
+
+func TestItSelectsEveryNthRepoForAShard(t *testing.T) {
+	var repos []Repo
+	for _, name := range []string{"a", "b", "c", "d", "e", "f"} {
+		repos = append(repos, Repo{RepoName: name})
+	}
+
+	var names []string
+	for _, repo := range (Shard{Index: 2, Count: 4}).Select(repos) {
+		names = append(names, repo.RepoName)
+	}
+	assert.Equal(t, []string{"b", "f"}, names)
+}
+
+func TestItOnlyOpensTheReposOfTheShard(t *testing.T) {
+	testsupport.PrepareTempCampaign(false, "org/repo1", "org/repo2", "org/repo3")
+	flags.Shard = "1/2"
+	defer func() { flags.Shard = "" }()
+
+	campaign, err := OpenCampaign(NewCampaignOptions())
+	assert.NoError(t, err)
+
+	assert.Len(t, campaign.Repos, 2)
+	assert.Equal(t, "org/repo1", campaign.Repos[0].FullRepoName)
+	assert.Equal(t, "org/repo3", campaign.Repos[1].FullRepoName)
+}
+
+func TestItRejectsAnInvalidShard(t *testing.T) {
+	testsupport.PrepareTempCampaign(false, "org/repo1")
+	flags.Shard = "3/2"
+	defer func() { flags.Shard = "" }()
+
+	_, err := OpenCampaign(NewCampaignOptions())
+	assert.EqualError(t, err, "invalid shard 3/2 - expected the form i/N, where i is between 1 and N")
+}
@@ -0,0 +1,74 @@
+/*
+ * Copyright 2021 Skyscanner Limited.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * https://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package campaign
+
+import (
+	"fmt"
+	"io/ioutil"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Split is a part of the campaign's changes in a repository, by path, which is raised as its own PR
+type Split struct {
+	Name string `yaml:"name"`
+	// Paths are git glob pathspecs, where * matches within a directory and ** across directories
+	Paths []string `yaml:"paths"`
+	// Title is a template for the PR title, which defaults to the campaign's PR title followed by the split's name
+	Title string `yaml:"title"`
+}
+
+var unsafeBranchCharacters = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// SplitName makes a name, such as a directory, safe to use in a split's branch name
+func SplitName(name string) string {
+	return strings.Trim(unsafeBranchCharacters.ReplaceAllString(name, "-"), "-.")
+}
+
+// BranchName returns the branch the split is raised from, which is named after the campaign
+func (s Split) BranchName(campaignName string) string {
+	return campaignName + "-" + s.Name
+}
+
+// ReadSplits reads a YAML file giving a list of splits, each with a name, paths and optionally a title
+func ReadSplits(filename string) ([]Split, error) {
+	contents, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("unable to open splits file: %s", filename)
+	}
+
+	var splits []Split
+	if err := yaml.Unmarshal(contents, &splits); err != nil {
+		return nil, fmt.Errorf("unable to parse splits file %s: %w", filename, err)
+	}
+
+	names := map[string]bool{}
+	for i, split := range splits {
+		if split.Name == "" || SplitName(split.Name) != split.Name {
+			return nil, fmt.Errorf("split %d in %s needs a name made of letters, digits, '.', '_' and '-'", i+1, filename)
+		}
+		if names[split.Name] {
+			return nil, fmt.Errorf("split %s is given more than once in %s", split.Name, filename)
+		}
+		names[split.Name] = true
+		if len(split.Paths) == 0 {
+			return nil, fmt.Errorf("split %s in %s has no paths", split.Name, filename)
+		}
+	}
+	return splits, nil
+}
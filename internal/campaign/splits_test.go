@@ -0,0 +1,69 @@
+/*
+ * Copyright 2021 Skyscanner Limited.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * https://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package campaign
+
+import (
+	"io/ioutil"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/skyscanner/turbolift/internal/testsupport"
+)
+
+func TestItReadsSplits(t *testing.T) {
+	testsupport.PrepareTempCampaign(false)
+	err := ioutil.WriteFile("splits.yaml", []byte(`
+- name: docs
+  paths: [docs/**, "**/*.md"]
+  title: Update the documentation for {{.RepoName}}
+- name: ci
+  paths: [.github/**]
+`), 0o644)
+	assert.NoError(t, err)
+
+	splits, err := ReadSplits("splits.yaml")
+	assert.NoError(t, err)
+	assert.Equal(t, []Split{
+		{Name: "docs", Paths: []string{"docs/**", "**/*.md"}, Title: "Update the documentation for {{.RepoName}}"},
+		{Name: "ci", Paths: []string{".github/**"}},
+	}, splits)
+	assert.Equal(t, "my-campaign-docs", splits[0].BranchName("my-campaign"))
+}
+
+func TestItRejectsInvalidSplits(t *testing.T) {
+	testsupport.PrepareTempCampaign(false)
+
+	for contents, expected := range map[string]string{
+		"- paths: [docs/**]":                  "split 1 in splits.yaml needs a name",
+		"- name: my docs\n  paths: [docs/**]": "split 1 in splits.yaml needs a name",
+		"- name: docs":                        "split docs in splits.yaml has no paths",
+		"- {name: docs, paths: [a]}\n- {name: docs, paths: [b]}": "split docs is given more than once in splits.yaml",
+		"name: docs": "unable to parse splits file splits.yaml",
+	} {
+		assert.NoError(t, ioutil.WriteFile("splits.yaml", []byte(contents), 0o644))
+		_, err := ReadSplits("splits.yaml")
+		if assert.Error(t, err, contents) {
+			assert.Contains(t, err.Error(), expected)
+		}
+	}
+}
+
+func TestItMakesNamesSafeForBranches(t *testing.T) {
+	assert.Equal(t, "my-dir", SplitName("my dir"))
+	assert.Equal(t, "config", SplitName(".config"))
+	assert.Equal(t, "a-b_c", SplitName("a/b_c"))
+}
@@ -0,0 +1,76 @@
+/*
+ * Copyright 2021 Skyscanner Limited.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * https://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package campaign
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"text/template"
+)
+
+// TemplateData is available to templates which are rendered for each repository, e.g. as {{.RepoName}}
+type TemplateData struct {
+	Campaign     string
+	FullRepoName string
+	OrgName      string
+	RepoName     string
+	// Variant and Params are the name and parameters of the selected variant of the campaign, if there is one
+	Variant string
+	Params  map[string]string
+}
+
+// NewTemplateData returns the template variables for a repository in the campaign
+func NewTemplateData(c *Campaign, repo Repo) TemplateData {
+	data := TemplateData{
+		Campaign:     c.Name,
+		FullRepoName: repo.FullRepoName,
+		OrgName:      repo.OrgName,
+		RepoName:     repo.RepoName,
+	}
+	if selectedVariant != nil {
+		data.Variant = selectedVariant.Name
+		data.Params = selectedVariant.Params
+	}
+	return data
+}
+
+// ReadTemplateFile parses a template file, where kind describes the file in errors (e.g. "issue template")
+func ReadTemplateFile(filename string, kind string) (*template.Template, error) {
+	contents, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("unable to open %s file: %s", kind, filename)
+	}
+	t, err := ParseTemplate(filename, string(contents))
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse %s file %s: %w", kind, filename, err)
+	}
+	return t, nil
+}
+
+// ParseTemplate parses a template given as text, e.g. in a flag, which is named in errors
+func ParseTemplate(name string, text string) (*template.Template, error) {
+	return template.New(name).Option("missingkey=error").Parse(text)
+}
+
+// RenderTemplate renders a template for a repository
+func RenderTemplate(t *template.Template, data TemplateData) (string, error) {
+	var rendered bytes.Buffer
+	if err := t.Execute(&rendered, data); err != nil {
+		return "", err
+	}
+	return rendered.String(), nil
+}
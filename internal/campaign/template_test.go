@@ -0,0 +1,58 @@
+/*
+ * Copyright 2021 Skyscanner Limited.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * https://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package campaign
+
+import (
+	"io/ioutil"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/skyscanner/turbolift/internal/testsupport"
+)
+
+func TestItRendersTemplatesForEachRepo(t *testing.T) {
+	testsupport.PrepareTempCampaign(false)
+	err := ioutil.WriteFile("body.md", []byte("{{.Campaign}}: {{.FullRepoName}} ({{.RepoName}} in {{.OrgName}})"), 0o644)
+	assert.NoError(t, err)
+
+	tmpl, err := ReadTemplateFile("body.md", "review template")
+	assert.NoError(t, err)
+
+	repo := Repo{OrgName: "org", RepoName: "repo1", FullRepoName: "org/repo1"}
+	rendered, err := RenderTemplate(tmpl, NewTemplateData(&Campaign{Name: "my-campaign"}, repo))
+	assert.NoError(t, err)
+	assert.Equal(t, "my-campaign: org/repo1 (repo1 in org)", rendered)
+}
+
+func TestItReportsInvalidTemplates(t *testing.T) {
+	testsupport.PrepareTempCampaign(false)
+	err := ioutil.WriteFile("body.md", []byte("{{.Campaign"), 0o644)
+	assert.NoError(t, err)
+
+	_, err = ReadTemplateFile("body.md", "review template")
+	assert.Contains(t, err.Error(), "unable to parse review template file body.md")
+
+	_, err = ReadTemplateFile("missing.md", "review template")
+	assert.EqualError(t, err, "unable to open review template file: missing.md")
+
+	err = ioutil.WriteFile("body.md", []byte("{{.Unknown}}"), 0o644)
+	assert.NoError(t, err)
+	tmpl, err := ReadTemplateFile("body.md", "review template")
+	assert.NoError(t, err)
+	_, err = RenderTemplate(tmpl, TemplateData{})
+	assert.Error(t, err)
+}
@@ -0,0 +1,71 @@
+/*
+ * Copyright 2021 Skyscanner Limited.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * https://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package campaign
+
+import (
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Variant is one of several versions of the campaign's change, e.g. for each major version of a framework, which is
+// made in working copies of its own, on a branch named after the campaign and the variant's branch suffix
+type Variant struct {
+	Name         string
+	BranchSuffix string
+	Params       map[string]string
+}
+
+// selectedVariant is the variant that commands work on, selected with --variant, or nil if there is none
+var selectedVariant *Variant
+
+// UseVariant selects the variant of the campaign that commands work on, or none if given nil
+func UseVariant(variant *Variant) {
+	selectedVariant = variant
+}
+
+// SelectedVariant returns the variant that commands work on, or nil if there is none
+func SelectedVariant() *Variant {
+	return selectedVariant
+}
+
+// WorkDir returns the directory holding the working copies, which is separate for each variant
+func WorkDir() string {
+	if selectedVariant == nil {
+		return "work"
+	}
+	return path.Join("variants", selectedVariant.Name, "work") // i.e. variants/name/work
+}
+
+var unsafeVariableCharacters = regexp.MustCompile(`[^A-Z0-9_]`)
+
+// Environment returns the variables which give commands the variant's name and parameters, as KEY=VALUE entries:
+// TURBOLIFT_VARIANT, and TURBOLIFT_VARIANT_ followed by the name of each parameter in upper case
+func (v *Variant) Environment() []string {
+	var names []string
+	for name := range v.Params {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	env := []string{"TURBOLIFT_VARIANT=" + v.Name}
+	for _, name := range names {
+		key := unsafeVariableCharacters.ReplaceAllString(strings.ToUpper(name), "_")
+		env = append(env, "TURBOLIFT_VARIANT_"+key+"="+v.Params[name])
+	}
+	return env
+}
@@ -0,0 +1,48 @@
+/*
+ * Copyright 2021 Skyscanner Limited.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * https://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package campaign
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/skyscanner/turbolift/internal/testsupport"
+)
+
+func TestItWorksOnTheSelectedVariantOfTheCampaign(t *testing.T) {
+	testsupport.PrepareTempCampaign(false, "org/repo1")
+	UseVariant(&Variant{Name: "spring6", BranchSuffix: "boot3", Params: map[string]string{"version": "6.1"}})
+	defer UseVariant(nil)
+
+	campaign, err := OpenCampaign(NewCampaignOptions())
+	assert.NoError(t, err)
+	assert.Equal(t, testsupport.Pwd()+"-boot3", campaign.Name)
+	assert.Equal(t, "variants/spring6/work/org/repo1", campaign.Repos[0].FullRepoPath())
+
+	data := NewTemplateData(campaign, campaign.Repos[0])
+	assert.Equal(t, "spring6", data.Variant)
+	assert.Equal(t, "6.1", data.Params["version"])
+}
+
+func TestItGivesTheVariantToCommandsInTheEnvironment(t *testing.T) {
+	variant := &Variant{Name: "spring6", Params: map[string]string{"version": "6.1", "java-release": "17"}}
+	assert.Equal(t, []string{
+		"TURBOLIFT_VARIANT=spring6",
+		"TURBOLIFT_VARIANT_JAVA_RELEASE=17",
+		"TURBOLIFT_VARIANT_VERSION=6.1",
+	}, variant.Environment())
+}
@@ -0,0 +1,245 @@
+/*
+ * Copyright 2021 Skyscanner Limited.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * https://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package changes
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/skyscanner/turbolift/internal/campaign"
+	"github.com/skyscanner/turbolift/internal/git"
+	"github.com/skyscanner/turbolift/internal/github"
+)
+
+// maxNotablePaths limits how many paths are listed in a summary
+const maxNotablePaths = 10
+
+// Summary describes the changes on a campaign branch since it diverged from the base branch
+type Summary struct {
+	Files []git.FileChange
+}
+
+// Path is a file or top-level directory with the changes made within it
+type Path struct {
+	Name       string
+	Files      int
+	Insertions int
+	Deletions  int
+}
+
+// BaseBranch returns the branch that PRs are raised against: the repository's base branch if one was recorded when it
+// was cloned or is given for the campaign, otherwise its current default branch
+func BaseBranch(output io.Writer, gh github.GitHub, repo campaign.Repo) (string, error) {
+	if repo.BaseBranch != "" {
+		return repo.BaseBranch, nil
+	}
+	return gh.GetDefaultBranchName(output, repo.FullRepoPath(), repo.FullRepoName)
+}
+
+// BaseRemote returns the remote holding the branch that PRs are raised against: upstream for forks, otherwise origin
+func BaseRemote(output io.Writer, g git.Git, repoDirPath string) (string, error) {
+	remotes, err := g.Remotes(output, repoDirPath)
+	if err != nil {
+		return "", err
+	}
+	for _, remote := range remotes {
+		if remote == "upstream" {
+			return remote, nil
+		}
+	}
+	return "origin", nil
+}
+
+// BaseRef fetches the branch that PRs are raised against and returns its remote-tracking ref, so that the campaign
+// branch is compared with the base branch as it is now rather than as it was when last fetched
+func BaseRef(output io.Writer, g git.Git, gh github.GitHub, repo campaign.Repo) (string, error) {
+	repoDirPath := repo.FullRepoPath()
+	baseBranch, err := BaseBranch(output, gh, repo)
+	if err != nil {
+		return "", err
+	}
+	baseRemote, err := BaseRemote(output, g, repoDirPath)
+	if err != nil {
+		return "", err
+	}
+	if err := g.Fetch(output, repoDirPath, baseRemote, baseBranch); err != nil {
+		return "", err
+	}
+	return baseRemote + "/" + baseBranch, nil
+}
+
+// HeadOwner returns the prefix for branches pushed to a fork, which PRs need to be raised from, or nothing where the
+// repository is not forked
+func HeadOwner(output io.Writer, g git.Git, repo campaign.Repo, repoDirPath string) (string, error) {
+	origin, err := g.RemoteRepoName(output, repoDirPath, "origin")
+	if err != nil {
+		return "", err
+	}
+	if origin == repo.FullRepoName {
+		return "", nil
+	}
+	return strings.SplitN(origin, "/", 2)[0] + ":", nil
+}
+
+// WrongBranchError is returned for a working copy which is not on the campaign branch of the selected profile
+type WrongBranchError struct {
+	Path          string
+	CurrentBranch string
+	BranchName    string
+}
+
+func (e *WrongBranchError) Error() string {
+	return fmt.Sprintf("%s is on branch %s rather than %s - switch it with checkout", e.Path, e.CurrentBranch, e.BranchName)
+}
+
+// CheckProfileBranch returns a *WrongBranchError if a profile is selected and the working copy is not on its branch.
+// Profiles share working copies, so one may still be on the branch of the campaign or of another profile.
+func CheckProfileBranch(output io.Writer, g git.Git, repoDirPath string, branchName string) error {
+	if campaign.SelectedProfile() == "" {
+		return nil
+	}
+	current, err := g.CurrentBranch(output, repoDirPath)
+	if err != nil {
+		return err
+	}
+	if current != branchName {
+		return &WrongBranchError{Path: repoDirPath, CurrentBranch: current, BranchName: branchName}
+	}
+	return nil
+}
+
+// Summarise summarises the committed changes on the campaign branch in a repository's working copy
+func Summarise(output io.Writer, g git.Git, gh github.GitHub, repo campaign.Repo) (*Summary, error) {
+	return summarise(output, g, gh, repo, false)
+}
+
+// SummariseWorkingCopy summarises the changes in a repository's working copy, whether or not they have been committed.
+// Untracked files are not included until they are added.
+func SummariseWorkingCopy(output io.Writer, g git.Git, gh github.GitHub, repo campaign.Repo) (*Summary, error) {
+	return summarise(output, g, gh, repo, true)
+}
+
+func summarise(output io.Writer, g git.Git, gh github.GitHub, repo campaign.Repo, includeUncommitted bool) (*Summary, error) {
+	baseRef, err := BaseRef(output, g, gh, repo)
+	if err != nil {
+		return nil, err
+	}
+
+	files, err := g.DiffNumstat(output, repo.FullRepoPath(), baseRef, includeUncommitted)
+	if err != nil {
+		return nil, err
+	}
+	return &Summary{Files: files}, nil
+}
+
+// Totals returns the number of files changed and lines inserted and deleted
+func (s *Summary) Totals() (files int, insertions int, deletions int) {
+	for _, file := range s.Files {
+		insertions += file.Insertions
+		deletions += file.Deletions
+	}
+	return len(s.Files), insertions, deletions
+}
+
+// ChangesWorkflows reports whether any GitHub Actions workflow is changed, which needs a token with the workflow scope
+// to push
+func (s *Summary) ChangesWorkflows() bool {
+	for _, file := range s.Files {
+		if strings.HasPrefix(file.Path, ".github/workflows/") {
+			return true
+		}
+	}
+	return false
+}
+
+// String describes the totals in the same way as git diff --shortstat
+func (s *Summary) String() string {
+	files, insertions, deletions := s.Totals()
+	return fmt.Sprintf("%s changed, %s(+), %s(-)", plural(files, "file"), plural(insertions, "insertion"), plural(deletions, "deletion"))
+}
+
+// NotablePaths groups the changed files by top-level directory, most changed first
+func (s *Summary) NotablePaths() []Path {
+	byName := map[string]*Path{}
+	var paths []*Path
+	for _, file := range s.Files {
+		name := file.Path
+		if i := strings.Index(name, "/"); i >= 0 {
+			name = name[:i+1]
+		}
+		path, ok := byName[name]
+		if !ok {
+			path = &Path{Name: name}
+			byName[name] = path
+			paths = append(paths, path)
+		}
+		path.Files++
+		path.Insertions += file.Insertions
+		path.Deletions += file.Deletions
+	}
+
+	sort.SliceStable(paths, func(i, j int) bool {
+		return paths[i].Insertions+paths[i].Deletions > paths[j].Insertions+paths[j].Deletions
+	})
+	result := make([]Path, len(paths))
+	for i, path := range paths {
+		result[i] = *path
+	}
+	return result
+}
+
+// Markdown renders the summary as a collapsible section, suitable for appending to a PR description
+func (s *Summary) Markdown() string {
+	sb := strings.Builder{}
+	_, _ = fmt.Fprintf(&sb, "<details>\n<summary>Changes in this repository: %s</summary>\n\n", s)
+
+	paths := s.NotablePaths()
+	for i, path := range paths {
+		if i == maxNotablePaths {
+			_, _ = fmt.Fprintf(&sb, "* ...and %d more\n", len(paths)-maxNotablePaths)
+			break
+		}
+		_, _ = fmt.Fprintf(&sb, "* `%s` %s\n", path.Name, path.counts())
+	}
+	sb.WriteString("</details>\n")
+	return sb.String()
+}
+
+// String describes the path and the changes within it, e.g. "src/ (2 files, +9 -2)"
+func (p Path) String() string {
+	return p.Name + " " + p.counts()
+}
+
+func (p Path) counts() string {
+	if strings.HasSuffix(p.Name, "/") {
+		return fmt.Sprintf("(%s, +%d -%d)", plural(p.Files, "file"), p.Insertions, p.Deletions)
+	}
+	return fmt.Sprintf("(+%d -%d)", p.Insertions, p.Deletions)
+}
+
+// AppendTo appends the summary to a PR description
+func (s *Summary) AppendTo(body string) string {
+	return strings.TrimRight(body, "\n") + "\n\n" + s.Markdown()
+}
+
+func plural(n int, noun string) string {
+	if n == 1 {
+		return fmt.Sprintf("%d %s", n, noun)
+	}
+	return fmt.Sprintf("%d %ss", n, noun)
+}
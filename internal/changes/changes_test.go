@@ -0,0 +1,96 @@
+/*
+ * Copyright 2021 Skyscanner Limited.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * https://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package changes
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/skyscanner/turbolift/internal/campaign"
+	"github.com/skyscanner/turbolift/internal/git"
+	"github.com/skyscanner/turbolift/internal/github"
+)
+
+func TestItSummarisesChangesAgainstTheBaseBranch(t *testing.T) {
+	fakeGit := git.NewAlwaysSucceedsFakeGit()
+	fakeGitHub := github.NewAlwaysSucceedsFakeGitHub()
+	repo := campaign.Repo{OrgName: "org", RepoName: "repo1", FullRepoName: "org/repo1"}
+
+	summary, err := Summarise(&strings.Builder{}, fakeGit, fakeGitHub, repo)
+	assert.NoError(t, err)
+	assert.Equal(t, "3 files changed, 10 insertions(+), 2 deletions(-)", summary.String())
+
+	fakeGit.AssertCalledWith(t, [][]string{
+		{"remotes", "work/org/repo1"},
+		{"fetch", "work/org/repo1", "origin", "main"},
+		{"diffNumstat", "work/org/repo1", "origin/main"},
+	})
+	fakeGitHub.AssertCalledWith(t, [][]string{
+		{"work/org/repo1", "org/repo1"},
+	})
+}
+
+func TestItGroupsNotablePathsByTopLevelDirectory(t *testing.T) {
+	summary := &Summary{Files: []git.FileChange{
+		{Path: "README.md", Insertions: 1},
+		{Path: "src/main.go", Insertions: 5, Deletions: 2},
+		{Path: "src/util/util.go", Insertions: 4},
+		{Path: "logo.png", Binary: true},
+	}}
+
+	assert.Equal(t, []Path{
+		{Name: "src/", Files: 2, Insertions: 9, Deletions: 2},
+		{Name: "README.md", Files: 1, Insertions: 1},
+		{Name: "logo.png", Files: 1},
+	}, summary.NotablePaths())
+
+	assert.Equal(t, "PR body\n\n<details>\n<summary>Changes in this repository: 4 files changed, 10 insertions(+), 2 deletions(-)</summary>\n\n"+
+		"* `src/` (2 files, +9 -2)\n"+
+		"* `README.md` (+1 -0)\n"+
+		"* `logo.png` (+0 -0)\n"+
+		"</details>\n", summary.AppendTo("PR body\n"))
+}
+
+func TestItLimitsTheNumberOfNotablePaths(t *testing.T) {
+	summary := &Summary{}
+	for i := 0; i < maxNotablePaths+3; i++ {
+		summary.Files = append(summary.Files, git.FileChange{Path: fmt.Sprintf("file%d", i), Insertions: 1})
+	}
+
+	assert.Contains(t, summary.Markdown(), "* `file9` (+1 -0)\n* ...and 3 more\n</details>")
+	assert.Contains(t, summary.String(), "13 files changed, 13 insertions(+), 0 deletions(-)")
+}
+
+func TestItDetectsChangesToWorkflows(t *testing.T) {
+	assert.False(t, (&Summary{Files: []git.FileChange{{Path: "README.md"}, {Path: ".github/CODEOWNERS"}}}).ChangesWorkflows())
+	assert.True(t, (&Summary{Files: []git.FileChange{{Path: "README.md"}, {Path: ".github/workflows/ci.yml"}}}).ChangesWorkflows())
+}
+
+func TestItRaisesPRsFromForks(t *testing.T) {
+	fakeGit := git.NewAlwaysSucceedsFakeGit()
+
+	// the fake reports the origin remote as the working copy's path, without work/
+	head, err := HeadOwner(&strings.Builder{}, fakeGit, campaign.Repo{FullRepoName: "upstream-org/repo1"}, "work/me/repo1")
+	assert.NoError(t, err)
+	assert.Equal(t, "me:", head)
+
+	head, err = HeadOwner(&strings.Builder{}, fakeGit, campaign.Repo{FullRepoName: "org/repo1"}, "work/org/repo1")
+	assert.NoError(t, err)
+	assert.Equal(t, "", head)
+}
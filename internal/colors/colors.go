@@ -16,11 +16,18 @@
 package colors
 
 import (
+	"fmt"
+	"os"
+
 	"github.com/fatih/color"
+	"github.com/mattn/go-isatty"
 )
 
+// Green, Yellow and Red colour successes, warnings and failures, Cyan highlights and White colours details, in the
+// colours of the theme set with SetTheme
 var Green = color.New(color.FgGreen).SprintFunc()
 var Cyan = color.New(color.FgCyan).SprintFunc()
+var Cyanf = color.New(color.FgCyan).SprintfFunc()
 var White = color.New(color.FgWhite).SprintFunc()
 var Red = color.New(color.FgRed).SprintFunc()
 var Yellow = color.New(color.FgYellow).SprintFunc()
@@ -29,3 +36,20 @@ var Normal = color.New(color.Reset).SprintFunc()
 var Pass = color.New(color.BgGreen, color.FgBlack).SprintFunc()
 var Warn = color.New(color.BgYellow, color.FgBlack).SprintFunc()
 var Fail = color.New(color.BgRed, color.FgBlack).SprintFunc()
+
+// SetMode chooses whether output is coloured: "always", "never", or "auto" (the default), which colours output only
+// when stdout is a terminal and the NO_COLOR environment variable is unset
+func SetMode(mode string) error {
+	switch mode {
+	case "", "auto":
+		color.NoColor = os.Getenv("NO_COLOR") != "" || os.Getenv("TERM") == "dumb" ||
+			(!isatty.IsTerminal(os.Stdout.Fd()) && !isatty.IsCygwinTerminal(os.Stdout.Fd()))
+	case "always":
+		color.NoColor = false
+	case "never":
+		color.NoColor = true
+	default:
+		return fmt.Errorf("unknown color mode %s - expected auto, always or never", mode)
+	}
+	return nil
+}
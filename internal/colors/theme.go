@@ -0,0 +1,161 @@
+/*
+ * Copyright 2021 Skyscanner Limited.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * https://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package colors
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/fatih/color"
+)
+
+// The roles that colours play in output, which a theme gives a colour to each of
+const (
+	Success   = "success"
+	Warning   = "warning"
+	Failure   = "failure"
+	Highlight = "highlight"
+	Detail    = "detail"
+)
+
+// PresetSetting is the setting of a theme which chooses the preset it starts from
+const PresetSetting = "preset"
+
+// presets are the themes which can be chosen by name, each giving the attributes of every role
+var presets = map[string]map[string][]color.Attribute{
+	"default": {
+		Success:   {color.FgGreen},
+		Warning:   {color.FgYellow},
+		Failure:   {color.FgRed},
+		Highlight: {color.FgCyan},
+		Detail:    {color.FgWhite},
+	},
+	"high-contrast": {
+		Success:   {color.Bold, color.FgHiGreen},
+		Warning:   {color.Bold, color.FgHiYellow},
+		Failure:   {color.Bold, color.FgHiRed},
+		Highlight: {color.Bold, color.FgHiCyan},
+		Detail:    {color.FgHiWhite},
+	},
+	// blue and orange-ish yellow against magenta stay distinct with the common forms of colour blindness
+	"colour-blind": {
+		Success:   {color.FgBlue},
+		Warning:   {color.FgYellow},
+		Failure:   {color.FgMagenta},
+		Highlight: {color.FgCyan},
+		Detail:    {color.FgWhite},
+	},
+}
+
+var colorNames = map[string]color.Attribute{
+	"black":   color.FgBlack,
+	"red":     color.FgRed,
+	"green":   color.FgGreen,
+	"yellow":  color.FgYellow,
+	"blue":    color.FgBlue,
+	"magenta": color.FgMagenta,
+	"cyan":    color.FgCyan,
+	"white":   color.FgWhite,
+}
+
+// SetTheme colours output with a theme: the preset named by its preset setting ("default", "high-contrast" or
+// "colour-blind"), with the colour of any role given by its own setting, e.g. `failure: bold bright-magenta`
+func SetTheme(settings map[string]string) error {
+	name := settings[PresetSetting]
+	if name == "" {
+		name = "default"
+	}
+	preset, ok := presets[name]
+	if !ok {
+		return fmt.Errorf("unknown theme preset %s - expected one of %s", name, strings.Join(presetNames(), ", "))
+	}
+
+	theme := map[string][]color.Attribute{}
+	for role, attributes := range preset {
+		theme[role] = attributes
+	}
+	for role, value := range settings {
+		if role == PresetSetting {
+			continue
+		}
+		if _, ok := preset[role]; !ok {
+			return fmt.Errorf("unknown theme setting %s - expected %s, %s, %s, %s, %s or %s", role, PresetSetting, Success, Warning, Failure, Highlight, Detail)
+		}
+		attributes, err := parseAttributes(value)
+		if err != nil {
+			return fmt.Errorf("theme setting %s: %w", role, err)
+		}
+		theme[role] = attributes
+	}
+
+	Green = color.New(theme[Success]...).SprintFunc()
+	Yellow = color.New(theme[Warning]...).SprintFunc()
+	Red = color.New(theme[Failure]...).SprintFunc()
+	Cyan = color.New(theme[Highlight]...).SprintFunc()
+	Cyanf = color.New(theme[Highlight]...).SprintfFunc()
+	White = color.New(theme[Detail]...).SprintFunc()
+	Pass = badge(theme[Success])
+	Warn = badge(theme[Warning])
+	Fail = badge(theme[Failure])
+	return nil
+}
+
+// parseAttributes parses a colour such as `blue`, `bright-blue` or `bold bright-blue`
+func parseAttributes(value string) ([]color.Attribute, error) {
+	var attributes []color.Attribute
+	for _, word := range strings.Fields(strings.ToLower(value)) {
+		switch {
+		case word == "bold":
+			attributes = append(attributes, color.Bold)
+		case word == "underline":
+			attributes = append(attributes, color.Underline)
+		case strings.HasPrefix(word, "bright-") && colorNames[strings.TrimPrefix(word, "bright-")] != 0:
+			// the bright colours come 60 after the normal ones
+			attributes = append(attributes, colorNames[strings.TrimPrefix(word, "bright-")]+60)
+		case colorNames[word] != 0:
+			attributes = append(attributes, colorNames[word])
+		default:
+			return nil, fmt.Errorf("unknown colour %s - expected black, red, green, yellow, blue, magenta, cyan or white, optionally as bright-NAME, and optionally with bold or underline", word)
+		}
+	}
+	if len(attributes) == 0 {
+		return nil, fmt.Errorf("no colour given")
+	}
+	return attributes, nil
+}
+
+// badge colours the label of an activity's outcome, such as OK, with black text on the background of the role's colour
+func badge(attributes []color.Attribute) func(a ...interface{}) string {
+	badgeAttributes := []color.Attribute{}
+	for _, attribute := range attributes {
+		// the background colours come 10 after the foreground ones
+		if (attribute >= color.FgBlack && attribute <= color.FgWhite) || (attribute >= color.FgHiBlack && attribute <= color.FgHiWhite) {
+			attribute += 10
+		}
+		badgeAttributes = append(badgeAttributes, attribute)
+	}
+	return color.New(append(badgeAttributes, color.FgBlack)...).SprintFunc()
+}
+
+func presetNames() []string {
+	var names []string
+	for name := range presets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
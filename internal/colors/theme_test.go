@@ -0,0 +1,76 @@
+/*
+ * Copyright 2021 Skyscanner Limited.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * https://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package colors
+
+import (
+	"testing"
+
+	"github.com/fatih/color"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestItColoursOutputWithTheDefaultThemeUnlessOtherwiseSet(t *testing.T) {
+	defer useColor()()
+
+	assert.NoError(t, SetTheme(nil))
+
+	assert.Equal(t, "\x1b[32mdone\x1b[0m", Green("done"))
+	assert.Equal(t, "\x1b[33mdone\x1b[0m", Yellow("done"))
+	assert.Equal(t, "\x1b[31mdone\x1b[0m", Red("done"))
+	assert.Equal(t, "\x1b[42;30m OK\x1b[0m", Pass(" OK"))
+}
+
+func TestItColoursOutputWithAPreset(t *testing.T) {
+	defer useColor()()
+
+	assert.NoError(t, SetTheme(map[string]string{"preset": "colour-blind"}))
+
+	assert.Equal(t, "\x1b[34mdone\x1b[0m", Green("done"))
+	assert.Equal(t, "\x1b[35mdone\x1b[0m", Red("done"))
+	assert.Equal(t, "\x1b[45;30m FAILED\x1b[0m", Fail(" FAILED"))
+}
+
+func TestItOverridesTheColoursOfRoles(t *testing.T) {
+	defer useColor()()
+
+	assert.NoError(t, SetTheme(map[string]string{"preset": "high-contrast", "success": "Bold bright-blue", "highlight": "white"}))
+
+	assert.Equal(t, "\x1b[1;94mdone\x1b[0m", Green("done"))
+	assert.Equal(t, "\x1b[1;104;30m OK\x1b[0m", Pass(" OK"))
+	assert.Equal(t, "\x1b[1;93mdone\x1b[0m", Yellow("done"))
+	assert.Equal(t, "\x1b[37mrepo\x1b[0m", Cyanf("%s", "repo"))
+}
+
+func TestItRejectsUnknownThemeSettings(t *testing.T) {
+	defer useColor()()
+
+	assert.EqualError(t, SetTheme(map[string]string{"preset": "sepia"}),
+		"unknown theme preset sepia - expected one of colour-blind, default, high-contrast")
+	assert.EqualError(t, SetTheme(map[string]string{"error": "red"}),
+		"unknown theme setting error - expected preset, success, warning, failure, highlight or detail")
+	assert.Contains(t, SetTheme(map[string]string{"failure": "scarlet"}).Error(), "theme setting failure: unknown colour scarlet")
+	assert.EqualError(t, SetTheme(map[string]string{"failure": " "}), "theme setting failure: no colour given")
+}
+
+// useColor forces coloured output and returns a function restoring the previous mode and the default theme
+func useColor() func() {
+	noColor := color.NoColor
+	color.NoColor = false
+	return func() {
+		color.NoColor = noColor
+		_ = SetTheme(nil)
+	}
+}
@@ -0,0 +1,49 @@
+/*
+ * Copyright 2021 Skyscanner Limited.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * https://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package config
+
+import "os"
+
+// TokenVariables are the environment variables a token can be given to turbolift in, in order of precedence, so that
+// it runs without gh auth login, e.g. in CI jobs and containers
+var TokenVariables = []string{"TURBOLIFT_TOKEN", "GITHUB_TOKEN"}
+
+// applyToken authenticates gh, and git over HTTPS, with a token from the environment. gh reads GH_TOKEN for
+// github.com and GH_ENTERPRISE_TOKEN for other hosts, and git asks gh for credentials.
+func (c *Config) applyToken(setIfUnset func(key string, value string)) {
+	token := Token()
+	if token == "" {
+		return
+	}
+	setIfUnset("GH_TOKEN", token)
+	setIfUnset("GH_ENTERPRISE_TOKEN", token)
+
+	gh := c.Binaries["gh"]
+	if gh == "" {
+		gh = "gh"
+	}
+	addGitConfig("credential.helper", "!"+gh+" auth git-credential")
+}
+
+// Token returns the token given in the environment, or an empty string if there is none
+func Token() string {
+	for _, key := range TokenVariables {
+		if token := os.Getenv(key); token != "" {
+			return token
+		}
+	}
+	return ""
+}
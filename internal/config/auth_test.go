@@ -0,0 +1,52 @@
+/*
+ * Copyright 2021 Skyscanner Limited.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * https://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package config
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestItAuthenticatesWithATokenFromTheEnvironment(t *testing.T) {
+	for _, key := range []string{"TURBOLIFT_TOKEN", "GITHUB_TOKEN", "GH_TOKEN", "GH_ENTERPRISE_TOKEN", "GIT_CONFIG_COUNT", "GIT_CONFIG_KEY_0", "GIT_CONFIG_VALUE_0"} {
+		defer restoreEnv(key, os.Getenv(key))
+		_ = os.Unsetenv(key)
+	}
+	_ = os.Setenv("GITHUB_TOKEN", "from-actions")
+	_ = os.Setenv("TURBOLIFT_TOKEN", "from-turbolift")
+
+	config := &Config{Binaries: map[string]string{"gh": "/opt/gh/bin/gh"}}
+	assert.NoError(t, config.ApplyEnvironment())
+
+	assert.Equal(t, "from-turbolift", os.Getenv("GH_TOKEN"))
+	assert.Equal(t, "from-turbolift", os.Getenv("GH_ENTERPRISE_TOKEN"))
+	assert.Equal(t, "credential.helper", os.Getenv("GIT_CONFIG_KEY_0"))
+	assert.Equal(t, "!/opt/gh/bin/gh auth git-credential", os.Getenv("GIT_CONFIG_VALUE_0"))
+}
+
+func TestItLeavesAuthenticationToGhWithoutAToken(t *testing.T) {
+	for _, key := range []string{"TURBOLIFT_TOKEN", "GITHUB_TOKEN", "GH_TOKEN", "GIT_CONFIG_COUNT"} {
+		defer restoreEnv(key, os.Getenv(key))
+		_ = os.Unsetenv(key)
+	}
+
+	assert.NoError(t, (&Config{}).ApplyEnvironment())
+
+	assert.Equal(t, "", os.Getenv("GH_TOKEN"))
+	assert.Equal(t, "", os.Getenv("GIT_CONFIG_COUNT"))
+}
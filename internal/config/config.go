@@ -0,0 +1,339 @@
+/*
+ * Copyright 2021 Skyscanner Limited.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * https://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"gopkg.in/yaml.v3"
+)
+
+// CampaignConfigFilename is the name of the optional configuration file within a campaign directory
+const CampaignConfigFilename = "turbolift.yaml"
+
+// Config holds settings that are shared by everyone running a campaign, merged over the preferences of the user.
+// Defaults apply to the flags of every command which has a flag of that name, whereas Commands holds defaults
+// for a single command, keyed by command name (e.g. create-prs). Flags given on the command line always take precedence.
+type Config struct {
+	Host                string                            `yaml:"host"`
+	Branch              string                            `yaml:"branch"`
+	Protocol            string                            `yaml:"protocol"`
+	Git                 GitIdentity                       `yaml:"git"`
+	NotificationWebhook string                            `yaml:"notificationWebhook"`
+	Metrics             Metrics                           `yaml:"metrics"`
+	Color               string                            `yaml:"color"`
+	Theme               map[string]string                 `yaml:"theme"`
+	Proxy               string                            `yaml:"proxy"`
+	NoProxy             string                            `yaml:"noProxy"`
+	CABundle            string                            `yaml:"caBundle"`
+	Binaries            map[string]string                 `yaml:"binaries"`
+	Prompts             map[string]string                 `yaml:"prompts"`
+	Hooks               map[string]Hook                   `yaml:"hooks"`
+	Defaults            map[string]interface{}            `yaml:"defaults"`
+	Commands            map[string]map[string]interface{} `yaml:"commands"`
+	Variants            map[string]Variant                `yaml:"variants"`
+}
+
+type GitIdentity struct {
+	Name  string `yaml:"name"`
+	Email string `yaml:"email"`
+}
+
+// Metrics configures where metrics about each command run are sent: a statsd server (host:port), and/or an
+// OpenTelemetry collector accepting OTLP over HTTP, with any headers it needs. Tags are added to every metric.
+type Metrics struct {
+	Statsd      string            `yaml:"statsd"`
+	OTLP        string            `yaml:"otlp"`
+	OTLPHeaders map[string]string `yaml:"otlpHeaders"`
+	Tags        map[string]string `yaml:"tags"`
+}
+
+// Hook is a shell command run at a lifecycle point of a campaign, either once per repository (the default) or once
+// per command when Per is "command"
+type Hook struct {
+	Run string `yaml:"run"`
+	Per string `yaml:"per"`
+}
+
+// Variant is one of several versions of a campaign's change, e.g. for each major version of a framework, which has
+// its own branch and PRs. Its defaults and commands override those of the campaign while it is selected with --variant.
+type Variant struct {
+	BranchSuffix string                            `yaml:"branch-suffix"`
+	Params       map[string]string                 `yaml:"params"`
+	Defaults     map[string]interface{}            `yaml:"defaults"`
+	Commands     map[string]map[string]interface{} `yaml:"commands"`
+}
+
+// UserConfigFilename returns the location of the user's configuration, i.e. ~/.config/turbolift/config.yaml
+func UserConfigFilename() string {
+	configHome := os.Getenv("XDG_CONFIG_HOME")
+	if configHome == "" {
+		home, _ := os.UserHomeDir()
+		configHome = filepath.Join(home, ".config")
+	}
+	return filepath.Join(configHome, "turbolift", "config.yaml")
+}
+
+// Load reads the user configuration and the campaign configuration from the current directory, with campaign settings
+// taking precedence. Missing files result in an empty Config.
+func Load() (*Config, error) {
+	userConfig, err := loadFile(UserConfigFilename())
+	if err != nil {
+		return nil, err
+	}
+
+	campaignConfig, err := loadFile(CampaignConfigFilename)
+	if err != nil {
+		return nil, err
+	}
+
+	return userConfig.merge(campaignConfig), nil
+}
+
+func loadFile(filename string) (*Config, error) {
+	config := &Config{}
+
+	contents, err := ioutil.ReadFile(filename)
+	if errors.Is(err, os.ErrNotExist) {
+		return config, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("unable to read config file %s: %w", filename, err)
+	}
+
+	if err := yaml.Unmarshal(contents, config); err != nil {
+		return nil, fmt.Errorf("unable to parse config file %s: %w", filename, err)
+	}
+	return config, nil
+}
+
+// merge returns a Config where any setting made in other overrides the one made in c
+func (c *Config) merge(other *Config) *Config {
+	merged := *c
+	merged.Host = overrideString(c.Host, other.Host)
+	merged.Branch = overrideString(c.Branch, other.Branch)
+	merged.Protocol = overrideString(c.Protocol, other.Protocol)
+	merged.Git.Name = overrideString(c.Git.Name, other.Git.Name)
+	merged.Git.Email = overrideString(c.Git.Email, other.Git.Email)
+	merged.NotificationWebhook = overrideString(c.NotificationWebhook, other.NotificationWebhook)
+	merged.Metrics.Statsd = overrideString(c.Metrics.Statsd, other.Metrics.Statsd)
+	merged.Metrics.OTLP = overrideString(c.Metrics.OTLP, other.Metrics.OTLP)
+	merged.Metrics.OTLPHeaders = mergeStrings(c.Metrics.OTLPHeaders, other.Metrics.OTLPHeaders)
+	merged.Metrics.Tags = mergeStrings(c.Metrics.Tags, other.Metrics.Tags)
+	merged.Color = overrideString(c.Color, other.Color)
+	merged.Proxy = overrideString(c.Proxy, other.Proxy)
+	merged.NoProxy = overrideString(c.NoProxy, other.NoProxy)
+	merged.CABundle = overrideString(c.CABundle, other.CABundle)
+
+	merged.Binaries = mergeStrings(c.Binaries, other.Binaries)
+	merged.Prompts = mergeStrings(c.Prompts, other.Prompts)
+	merged.Theme = mergeStrings(c.Theme, other.Theme)
+
+	merged.Hooks = map[string]Hook{}
+	for _, hooks := range []map[string]Hook{c.Hooks, other.Hooks} {
+		for point, hook := range hooks {
+			merged.Hooks[point] = hook
+		}
+	}
+
+	merged.Defaults = mergeFlagValues(c.Defaults, other.Defaults)
+	merged.Commands = mergeCommands(c.Commands, other.Commands)
+
+	merged.Variants = map[string]Variant{}
+	for _, variants := range []map[string]Variant{c.Variants, other.Variants} {
+		for name, variant := range variants {
+			merged.Variants[name] = variant
+		}
+	}
+	return &merged
+}
+
+// VariantNames lists the campaign's variants in alphabetical order
+func (c *Config) VariantNames() []string {
+	var names []string
+	for name := range c.Variants {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ForVariant returns the configuration to use while the named variant is selected, where its defaults and commands
+// override those of the campaign
+func (c *Config) ForVariant(name string) (*Config, Variant, error) {
+	variant, ok := c.Variants[name]
+	if !ok {
+		if len(c.Variants) == 0 {
+			return nil, Variant{}, fmt.Errorf("unknown variant %s - no variants are configured in %s", name, CampaignConfigFilename)
+		}
+		return nil, Variant{}, fmt.Errorf("unknown variant %s - expected one of %s", name, strings.Join(c.VariantNames(), ", "))
+	}
+	if variant.BranchSuffix == "" {
+		variant.BranchSuffix = name
+	}
+
+	selected := *c
+	selected.Defaults = mergeFlagValues(c.Defaults, variant.Defaults)
+	selected.Commands = mergeCommands(c.Commands, variant.Commands)
+	return &selected, variant, nil
+}
+
+func overrideString(value string, override string) string {
+	if override != "" {
+		return override
+	}
+	return value
+}
+
+func mergeStrings(values map[string]string, overrides map[string]string) map[string]string {
+	merged := map[string]string{}
+	for _, each := range []map[string]string{values, overrides} {
+		for name, value := range each {
+			merged[name] = value
+		}
+	}
+	return merged
+}
+
+func mergeCommands(commands map[string]map[string]interface{}, overrides map[string]map[string]interface{}) map[string]map[string]interface{} {
+	merged := map[string]map[string]interface{}{}
+	for _, each := range []map[string]map[string]interface{}{commands, overrides} {
+		for name, values := range each {
+			merged[name] = mergeFlagValues(merged[name], values)
+		}
+	}
+	return merged
+}
+
+func mergeFlagValues(values map[string]interface{}, overrides map[string]interface{}) map[string]interface{} {
+	merged := map[string]interface{}{}
+	for name, value := range values {
+		merged[name] = value
+	}
+	for name, value := range overrides {
+		merged[name] = value
+	}
+	return merged
+}
+
+// ApplyEnvironment exports the configured host, protocol, git identity, proxy and CA bundle, along with any token in
+// TokenVariables, to the environment, so that they are picked up by every git and gh process that turbolift runs, as
+// well as by turbolift itself. Variables already set by the user are left untouched.
+func (c *Config) ApplyEnvironment() error {
+	setIfUnset := func(key string, value string) {
+		if value != "" && os.Getenv(key) == "" {
+			_ = os.Setenv(key, value)
+		}
+	}
+
+	setIfUnset("GH_HOST", c.Host)
+	setIfUnset("GIT_AUTHOR_NAME", c.Git.Name)
+	setIfUnset("GIT_COMMITTER_NAME", c.Git.Name)
+	setIfUnset("GIT_AUTHOR_EMAIL", c.Git.Email)
+	setIfUnset("GIT_COMMITTER_EMAIL", c.Git.Email)
+
+	c.applyToken(setIfUnset)
+	if err := c.applyProxy(); err != nil {
+		return err
+	}
+	if err := c.applyCABundle(setIfUnset); err != nil {
+		return err
+	}
+
+	host := os.Getenv("GH_HOST")
+	if host == "" {
+		host = "github.com"
+	}
+	switch c.Protocol {
+	case "":
+	case "ssh":
+		addGitConfig(fmt.Sprintf("url.git@%s:.insteadOf", host), fmt.Sprintf("https://%s/", host))
+	case "https":
+		addGitConfig(fmt.Sprintf("url.https://%s/.insteadOf", host), fmt.Sprintf("git@%s:", host))
+	default:
+		return fmt.Errorf("unknown protocol %s in configuration - expected https or ssh", c.Protocol)
+	}
+	return nil
+}
+
+// addGitConfig adds a git configuration setting for every git process started by turbolift (and by gh), without
+// touching the user's git configuration files
+func addGitConfig(key string, value string) {
+	count, _ := strconv.Atoi(os.Getenv("GIT_CONFIG_COUNT"))
+	_ = os.Setenv(fmt.Sprintf("GIT_CONFIG_KEY_%d", count), key)
+	_ = os.Setenv(fmt.Sprintf("GIT_CONFIG_VALUE_%d", count), value)
+	_ = os.Setenv("GIT_CONFIG_COUNT", strconv.Itoa(count+1))
+}
+
+// ApplyDefaults sets any flag of the command that was not given on the command line to its configured default
+func (c *Config) ApplyDefaults(cmd *cobra.Command) error {
+	commandDefaults := c.Commands[cmd.Name()]
+
+	var unknownFlags []string
+	for name := range commandDefaults {
+		if cmd.Flags().Lookup(name) == nil {
+			unknownFlags = append(unknownFlags, name)
+		}
+	}
+	if len(unknownFlags) > 0 {
+		sort.Strings(unknownFlags)
+		return fmt.Errorf("unknown flags for %s in configuration: %s", cmd.Name(), strings.Join(unknownFlags, ", "))
+	}
+
+	var err error
+	cmd.Flags().VisitAll(func(flag *pflag.Flag) {
+		if err != nil || flag.Changed {
+			return
+		}
+
+		value, ok := commandDefaults[flag.Name]
+		if !ok {
+			value, ok = c.Defaults[flag.Name]
+		}
+		if !ok {
+			return
+		}
+
+		for _, item := range flagValues(value) {
+			if setErr := cmd.Flags().Set(flag.Name, item); setErr != nil {
+				err = fmt.Errorf("invalid default for flag %s in configuration: %w", flag.Name, setErr)
+				return
+			}
+		}
+	})
+	return err
+}
+
+// flagValues renders a YAML value as it would have been given on the command line, where a list is given as the
+// flag repeated once for each item so that items of repeatable flags can contain commas
+func flagValues(value interface{}) []string {
+	if list, ok := value.([]interface{}); ok {
+		var items []string
+		for _, item := range list {
+			items = append(items, fmt.Sprint(item))
+		}
+		return items
+	}
+	return []string{fmt.Sprint(value)}
+}
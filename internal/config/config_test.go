@@ -0,0 +1,259 @@
+/*
+ * Copyright 2021 Skyscanner Limited.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * https://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/skyscanner/turbolift/internal/testsupport"
+)
+
+func TestItReturnsAnEmptyConfigWhenNoFileExists(t *testing.T) {
+	enterTempDirectory()
+
+	config, err := Load()
+	assert.NoError(t, err)
+	assert.Empty(t, config.Defaults)
+	assert.Empty(t, config.Commands)
+}
+
+func TestItErrorsOnMalformedConfig(t *testing.T) {
+	enterTempDirectory()
+	writeConfig("defaults: [")
+
+	_, err := Load()
+	assert.Error(t, err)
+}
+
+func TestItAppliesDefaultsToFlagsNotGivenOnTheCommandLine(t *testing.T) {
+	enterTempDirectory()
+	writeConfig(`
+defaults:
+  repos: other.txt
+  unrelated: value
+commands:
+  create-prs:
+    draft: true
+    sleep: 30s
+    labels: [one, two]
+    trailer: ["Ticket: ABC-1", "Co-authored-by: A, B <ab@example.com>"]
+`)
+
+	var repos string
+	var draft bool
+	var sleep time.Duration
+	var labels []string
+	var trailers []string
+	cmd := &cobra.Command{Use: "create-prs"}
+	cmd.Flags().StringVar(&repos, "repos", "repos.txt", "")
+	cmd.Flags().BoolVar(&draft, "draft", false, "")
+	cmd.Flags().DurationVar(&sleep, "sleep", 0, "")
+	cmd.Flags().StringSliceVar(&labels, "labels", nil, "")
+	cmd.Flags().StringArrayVar(&trailers, "trailer", nil, "")
+	_ = cmd.Flags().Parse([]string{"--sleep", "5s"})
+
+	config, err := Load()
+	assert.NoError(t, err)
+	assert.NoError(t, config.ApplyDefaults(cmd))
+
+	assert.Equal(t, "other.txt", repos)
+	assert.True(t, draft)
+	assert.Equal(t, 5*time.Second, sleep)
+	assert.Equal(t, []string{"one", "two"}, labels)
+	assert.Equal(t, []string{"Ticket: ABC-1", "Co-authored-by: A, B <ab@example.com>"}, trailers)
+}
+
+func TestItRejectsUnknownFlagsForACommand(t *testing.T) {
+	enterTempDirectory()
+	writeConfig(`
+commands:
+  commit:
+    mesage: typo
+`)
+
+	cmd := &cobra.Command{Use: "commit"}
+	cmd.Flags().String("message", "", "")
+
+	config, err := Load()
+	assert.NoError(t, err)
+	assert.EqualError(t, config.ApplyDefaults(cmd), "unknown flags for commit in configuration: mesage")
+}
+
+func TestItRejectsInvalidDefaults(t *testing.T) {
+	enterTempDirectory()
+	writeConfig(`
+defaults:
+  sleep: soon
+`)
+
+	cmd := &cobra.Command{Use: "create-prs"}
+	cmd.Flags().Duration("sleep", 0, "")
+
+	config, err := Load()
+	assert.NoError(t, err)
+	assert.Error(t, config.ApplyDefaults(cmd))
+}
+
+func TestItMergesUserAndCampaignConfig(t *testing.T) {
+	enterTempDirectory()
+	writeUserConfig(`
+host: github.example.com
+protocol: ssh
+git:
+  name: Jane Doe
+  email: jane@example.com
+binaries:
+  gh: /opt/gh/bin/gh
+theme:
+  preset: colour-blind
+  failure: bold red
+defaults:
+  repos: mine.txt
+commands:
+  create-prs:
+    draft: true
+`)
+	writeConfig(`
+protocol: https
+git:
+  email: campaigns@example.com
+theme:
+  failure: magenta
+defaults:
+  repos: campaign.txt
+commands:
+  create-prs:
+    sleep: 1m
+`)
+
+	config, err := Load()
+	assert.NoError(t, err)
+	assert.Equal(t, "github.example.com", config.Host)
+	assert.Equal(t, "https", config.Protocol)
+	assert.Equal(t, GitIdentity{Name: "Jane Doe", Email: "campaigns@example.com"}, config.Git)
+	assert.Equal(t, map[string]string{"gh": "/opt/gh/bin/gh"}, config.Binaries)
+	assert.Equal(t, map[string]string{"preset": "colour-blind", "failure": "magenta"}, config.Theme)
+	assert.Equal(t, map[string]interface{}{"repos": "campaign.txt"}, config.Defaults)
+	assert.Equal(t, map[string]interface{}{"draft": true, "sleep": "1m"}, config.Commands["create-prs"])
+}
+
+func TestItAppliesTheDefaultsOfTheSelectedVariant(t *testing.T) {
+	enterTempDirectory()
+	writeConfig(`
+defaults:
+  repos: campaign.txt
+  description: README.md
+commands:
+  create-prs:
+    draft: true
+variants:
+  spring6:
+    params:
+      version: "6.1"
+    defaults:
+      description: README-spring6.md
+    commands:
+      create-prs:
+        draft: false
+  spring5:
+    branch-suffix: legacy
+`)
+
+	config, err := Load()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"spring5", "spring6"}, config.VariantNames())
+
+	selected, variant, err := config.ForVariant("spring6")
+	assert.NoError(t, err)
+	assert.Equal(t, "spring6", variant.BranchSuffix)
+	assert.Equal(t, map[string]string{"version": "6.1"}, variant.Params)
+	assert.Equal(t, map[string]interface{}{"repos": "campaign.txt", "description": "README-spring6.md"}, selected.Defaults)
+	assert.Equal(t, map[string]interface{}{"draft": false}, selected.Commands["create-prs"])
+	assert.Equal(t, "README.md", config.Defaults["description"])
+
+	_, variant, err = config.ForVariant("spring5")
+	assert.NoError(t, err)
+	assert.Equal(t, "legacy", variant.BranchSuffix)
+
+	_, _, err = config.ForVariant("spring4")
+	assert.EqualError(t, err, "unknown variant spring4 - expected one of spring5, spring6")
+}
+
+func TestItExportsSettingsToTheEnvironment(t *testing.T) {
+	for _, key := range []string{"GH_HOST", "GIT_AUTHOR_NAME", "GIT_COMMITTER_NAME", "GIT_AUTHOR_EMAIL", "GIT_COMMITTER_EMAIL", "GIT_CONFIG_COUNT", "GIT_CONFIG_KEY_0", "GIT_CONFIG_VALUE_0", "TURBOLIFT_TOKEN", "GITHUB_TOKEN"} {
+		defer restoreEnv(key, os.Getenv(key))
+		_ = os.Unsetenv(key)
+	}
+	_ = os.Setenv("GIT_AUTHOR_NAME", "Already Set")
+
+	config := &Config{
+		Host:     "github.example.com",
+		Protocol: "ssh",
+		Git:      GitIdentity{Name: "Jane Doe", Email: "jane@example.com"},
+	}
+	assert.NoError(t, config.ApplyEnvironment())
+
+	assert.Equal(t, "github.example.com", os.Getenv("GH_HOST"))
+	assert.Equal(t, "Already Set", os.Getenv("GIT_AUTHOR_NAME"))
+	assert.Equal(t, "Jane Doe", os.Getenv("GIT_COMMITTER_NAME"))
+	assert.Equal(t, "jane@example.com", os.Getenv("GIT_AUTHOR_EMAIL"))
+	assert.Equal(t, "1", os.Getenv("GIT_CONFIG_COUNT"))
+	assert.Equal(t, "url.git@github.example.com:.insteadOf", os.Getenv("GIT_CONFIG_KEY_0"))
+	assert.Equal(t, "https://github.example.com/", os.Getenv("GIT_CONFIG_VALUE_0"))
+}
+
+func TestItRejectsUnknownProtocols(t *testing.T) {
+	config := &Config{Protocol: "ftp"}
+	assert.Error(t, config.ApplyEnvironment())
+}
+
+func enterTempDirectory() {
+	tempDir := testsupport.CreateAndEnterTempDirectory()
+	_ = os.Setenv("XDG_CONFIG_HOME", filepath.Join(tempDir, "config"))
+}
+
+func restoreEnv(key string, value string) {
+	if value == "" {
+		_ = os.Unsetenv(key)
+	} else {
+		_ = os.Setenv(key, value)
+	}
+}
+
+func writeUserConfig(contents string) {
+	err := os.MkdirAll(filepath.Dir(UserConfigFilename()), os.ModeDir|0o755)
+	if err != nil {
+		panic(err)
+	}
+	err = ioutil.WriteFile(UserConfigFilename(), []byte(contents), 0o644)
+	if err != nil {
+		panic(err)
+	}
+}
+
+func writeConfig(contents string) {
+	err := ioutil.WriteFile(CampaignConfigFilename, []byte(contents), 0o644)
+	if err != nil {
+		panic(err)
+	}
+}
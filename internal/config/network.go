@@ -0,0 +1,84 @@
+/*
+ * Copyright 2021 Skyscanner Limited.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * https://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package config
+
+import (
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+)
+
+// proxyVariables are the environment variables which git (through curl), gh and turbolift itself take a proxy from.
+// curl only reads http_proxy in lower case, and tools differ in which case they look at first, so both are set.
+var proxyVariables = []string{"HTTPS_PROXY", "https_proxy", "HTTP_PROXY", "http_proxy", "ALL_PROXY", "all_proxy"}
+
+// applyProxy sends HTTP and HTTPS traffic through the configured proxy, unless the user has set a proxy in the
+// environment already, in which case that is respected instead
+func (c *Config) applyProxy() error {
+	if c.Proxy == "" {
+		return nil
+	}
+	proxy, err := url.Parse(c.Proxy)
+	if err != nil || proxy.Host == "" {
+		return fmt.Errorf("invalid proxy %s in configuration - expected a URL such as http://proxy.example.com:3128", c.Proxy)
+	}
+	switch proxy.Scheme {
+	case "http", "https", "socks5":
+	default:
+		return fmt.Errorf("unsupported proxy scheme %s in configuration - expected http, https or socks5", proxy.Scheme)
+	}
+
+	for _, key := range proxyVariables {
+		if os.Getenv(key) != "" {
+			return nil
+		}
+	}
+	for _, key := range []string{"HTTPS_PROXY", "https_proxy", "HTTP_PROXY", "http_proxy"} {
+		_ = os.Setenv(key, c.Proxy)
+	}
+	if c.NoProxy != "" && os.Getenv("NO_PROXY") == "" && os.Getenv("no_proxy") == "" {
+		_ = os.Setenv("NO_PROXY", c.NoProxy)
+		_ = os.Setenv("no_proxy", c.NoProxy)
+	}
+	return nil
+}
+
+// applyCABundle makes git, gh and turbolift trust the certificates in the configured CA bundle, instead of the
+// system's, for HTTPS. The bundle is given as an absolute path, as processes run in each repository's working copy.
+func (c *Config) applyCABundle(setIfUnset func(key string, value string)) error {
+	if c.CABundle == "" {
+		return nil
+	}
+	bundle, err := filepath.Abs(c.CABundle)
+	if err != nil {
+		return err
+	}
+	contents, err := ioutil.ReadFile(bundle)
+	if err != nil {
+		return fmt.Errorf("unable to read the CA bundle in configuration: %w", err)
+	}
+	if !x509.NewCertPool().AppendCertsFromPEM(contents) {
+		return fmt.Errorf("the CA bundle %s in configuration contains no PEM encoded certificates", c.CABundle)
+	}
+
+	// git reads GIT_SSL_CAINFO, while gh and turbolift, being written in Go, read SSL_CERT_FILE
+	setIfUnset("GIT_SSL_CAINFO", bundle)
+	setIfUnset("SSL_CERT_FILE", bundle)
+	return nil
+}
@@ -0,0 +1,113 @@
+/*
+ * Copyright 2021 Skyscanner Limited.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * https://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package config
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestItSendsTrafficThroughTheConfiguredProxy(t *testing.T) {
+	clearNetworkEnv()
+	defer clearNetworkEnv()
+
+	config := &Config{Proxy: "http://proxy.example.com:3128", NoProxy: "localhost,.internal"}
+	assert.NoError(t, config.ApplyEnvironment())
+
+	assert.Equal(t, "http://proxy.example.com:3128", os.Getenv("HTTPS_PROXY"))
+	assert.Equal(t, "http://proxy.example.com:3128", os.Getenv("http_proxy"))
+	assert.Equal(t, "localhost,.internal", os.Getenv("NO_PROXY"))
+}
+
+func TestItRespectsAProxyAlreadySetInTheEnvironment(t *testing.T) {
+	clearNetworkEnv()
+	defer clearNetworkEnv()
+	_ = os.Setenv("https_proxy", "http://mine.example.com:8080")
+
+	config := &Config{Proxy: "http://proxy.example.com:3128"}
+	assert.NoError(t, config.ApplyEnvironment())
+
+	assert.Equal(t, "", os.Getenv("HTTPS_PROXY"))
+	assert.Equal(t, "http://mine.example.com:8080", os.Getenv("https_proxy"))
+}
+
+func TestItRejectsInvalidProxies(t *testing.T) {
+	clearNetworkEnv()
+	defer clearNetworkEnv()
+
+	assert.Error(t, (&Config{Proxy: "proxy.example.com"}).ApplyEnvironment())
+	assert.Error(t, (&Config{Proxy: "ftp://proxy.example.com"}).ApplyEnvironment())
+}
+
+func TestItTrustsTheConfiguredCABundle(t *testing.T) {
+	clearNetworkEnv()
+	defer clearNetworkEnv()
+	enterTempDirectory()
+	writeCABundle(t, "ca.pem")
+
+	config := &Config{CABundle: "ca.pem"}
+	assert.NoError(t, config.ApplyEnvironment())
+
+	bundle, _ := filepath.Abs("ca.pem")
+	assert.Equal(t, bundle, os.Getenv("GIT_SSL_CAINFO"))
+	assert.Equal(t, bundle, os.Getenv("SSL_CERT_FILE"))
+}
+
+func TestItRejectsCABundlesWithoutCertificates(t *testing.T) {
+	clearNetworkEnv()
+	defer clearNetworkEnv()
+	enterTempDirectory()
+	assert.NoError(t, ioutil.WriteFile("ca.pem", []byte("not a certificate"), 0o644))
+
+	assert.Error(t, (&Config{CABundle: "ca.pem"}).ApplyEnvironment())
+	assert.Error(t, (&Config{CABundle: "missing.pem"}).ApplyEnvironment())
+	assert.Equal(t, "", os.Getenv("GIT_SSL_CAINFO"))
+}
+
+func clearNetworkEnv() {
+	for _, key := range append(proxyVariables, "NO_PROXY", "no_proxy", "GIT_SSL_CAINFO", "SSL_CERT_FILE") {
+		_ = os.Unsetenv(key)
+	}
+}
+
+// writeCABundle writes a self-signed CA certificate in PEM format
+func writeCABundle(t *testing.T, filename string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Corporate CA"},
+		NotBefore:             time.Now(),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	assert.NoError(t, err)
+	assert.NoError(t, ioutil.WriteFile(filename, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o644))
+}
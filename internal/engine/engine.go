@@ -0,0 +1,119 @@
+/*
+ * Copyright 2021 Skyscanner Limited.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * https://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+// Package engine works through the repositories of a campaign, for the commands and for the public API in pkg/engine
+package engine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/skyscanner/turbolift/internal/campaign"
+)
+
+// ErrSkipped can be returned, or wrapped, by a RepoFunc to count its repository as skipped rather than failed
+var ErrSkipped = errors.New("skipped")
+
+// RepoFunc does the work for a single repository, writing the output of any git, gh or other processes to output
+type RepoFunc func(ctx context.Context, output io.Writer, repo campaign.Repo) error
+
+// Options controls how ForEachRepo works through the repositories
+type Options struct {
+	// Output receives the output of the work in every repository. It is discarded if nil.
+	Output io.Writer
+	// RequireWorkingCopy skips repositories which have not been cloned, rather than doing the work for them
+	RequireWorkingCopy bool
+	// Sleep is a pause between repositories, to spread the load on shared infrastructure such as CI
+	Sleep time.Duration
+}
+
+// Failure is a repository where the work failed
+type Failure struct {
+	Repo campaign.Repo
+	Err  error
+}
+
+// Result is what happened in each repository
+type Result struct {
+	Done    []campaign.Repo
+	Skipped []campaign.Repo
+	Failed  []Failure
+	// NotRun are the repositories which were not reached, because the context was cancelled
+	NotRun []campaign.Repo
+}
+
+// Err returns an error listing the repositories where the work failed or was not run, or nil if there are none
+func (r Result) Err() error {
+	var problems []string
+	for _, failure := range r.Failed {
+		problems = append(problems, fmt.Sprintf("%s: %v", failure.Repo.FullRepoName, failure.Err))
+	}
+	if len(r.NotRun) > 0 {
+		problems = append(problems, fmt.Sprintf("%d repositories were not run", len(r.NotRun)))
+	}
+	if len(problems) == 0 {
+		return nil
+	}
+	return errors.New(strings.Join(problems, "; "))
+}
+
+// ForEachRepo does the work in each repository in turn, carrying on past failures, until all have been done or the
+// context is cancelled
+func ForEachRepo(ctx context.Context, repos []campaign.Repo, options Options, work RepoFunc) Result {
+	output := options.Output
+	if output == nil {
+		output = ioutil.Discard
+	}
+
+	var result Result
+	for i, repo := range repos {
+		if ctx.Err() != nil {
+			result.NotRun = append(result.NotRun, repos[i:]...)
+			break
+		}
+		if i > 0 && options.Sleep > 0 {
+			select {
+			case <-time.After(options.Sleep):
+			case <-ctx.Done():
+				result.NotRun = append(result.NotRun, repos[i:]...)
+				return result
+			}
+		}
+
+		if options.RequireWorkingCopy {
+			if _, err := os.Stat(repo.FullRepoPath()); os.IsNotExist(err) {
+				result.Skipped = append(result.Skipped, repo)
+				continue
+			}
+		}
+
+		err := work(ctx, output, repo)
+		switch {
+		case err == nil:
+			result.Done = append(result.Done, repo)
+		case errors.Is(err, ErrSkipped):
+			result.Skipped = append(result.Skipped, repo)
+		default:
+			result.Failed = append(result.Failed, Failure{Repo: repo, Err: err})
+		}
+	}
+	return result
+}
@@ -0,0 +1,82 @@
+/*
+ * Copyright 2021 Skyscanner Limited.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * https://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package engine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/skyscanner/turbolift/internal/campaign"
+	"github.com/skyscanner/turbolift/internal/testsupport"
+)
+
+func TestItDoesTheWorkInEachRepoAndCarriesOnPastFailures(t *testing.T) {
+	testsupport.PrepareTempCampaign(true, "org/repo1", "org/repo2", "org/repo3")
+	c, err := campaign.OpenCampaign(campaign.NewCampaignOptions())
+	assert.NoError(t, err)
+
+	result := ForEachRepo(context.Background(), c.Repos, Options{}, func(_ context.Context, output io.Writer, repo campaign.Repo) error {
+		switch repo.RepoName {
+		case "repo1":
+			return errors.New("synthetic error")
+		case "repo2":
+			return fmt.Errorf("nothing to do: %w", ErrSkipped)
+		}
+		return nil
+	})
+
+	assert.Equal(t, []campaign.Repo{c.Repos[2]}, result.Done)
+	assert.Equal(t, []campaign.Repo{c.Repos[1]}, result.Skipped)
+	assert.Equal(t, []Failure{{Repo: c.Repos[0], Err: errors.New("synthetic error")}}, result.Failed)
+	assert.EqualError(t, result.Err(), "org/repo1: synthetic error")
+}
+
+func TestItSkipsReposWhichHaveNotBeenCloned(t *testing.T) {
+	testsupport.PrepareTempCampaign(false, "org/repo1")
+	c, err := campaign.OpenCampaign(campaign.NewCampaignOptions())
+	assert.NoError(t, err)
+
+	called := false
+	result := ForEachRepo(context.Background(), c.Repos, Options{RequireWorkingCopy: true}, func(context.Context, io.Writer, campaign.Repo) error {
+		called = true
+		return nil
+	})
+
+	assert.False(t, called)
+	assert.Equal(t, c.Repos, result.Skipped)
+	assert.NoError(t, result.Err())
+}
+
+func TestItStopsWhenTheContextIsCancelled(t *testing.T) {
+	testsupport.PrepareTempCampaign(true, "org/repo1", "org/repo2")
+	c, err := campaign.OpenCampaign(campaign.NewCampaignOptions())
+	assert.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	result := ForEachRepo(ctx, c.Repos, Options{}, func(context.Context, io.Writer, campaign.Repo) error {
+		cancel()
+		return nil
+	})
+
+	assert.Equal(t, []campaign.Repo{c.Repos[0]}, result.Done)
+	assert.Equal(t, []campaign.Repo{c.Repos[1]}, result.NotRun)
+	assert.EqualError(t, result.Err(), "1 repositories were not run")
+}
@@ -0,0 +1,68 @@
+/*
+ * Copyright 2021 Skyscanner Limited.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * https://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package executor
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+)
+
+// ContainerWorkDir is where a working copy is mounted within a container
+const ContainerWorkDir = "/work"
+
+// ContainerInvocation returns the executable and arguments needed to run the command in the given shell within a new
+// container of the image, with the working copy at workingCopyPath (which must be absolute) mounted as its working
+// directory. The shell defaults to sh, as the user's own shell may not be in the image. The container receives the
+// named environment variables from the container runtime's environment, which is docker, and can be pointed at podman
+// in the binaries configuration.
+func ContainerInvocation(image string, workingCopyPath string, envNames []string, shell string, command string) (string, []string) {
+	if shell == "" {
+		shell = "sh"
+	}
+	shellCommand, shellArgs := ShellInvocation(shell, command)
+
+	args := []string{"run", "--rm", "--init", "--volume", workingCopyPath + ":" + ContainerWorkDir, "--workdir", ContainerWorkDir}
+	// files written within the container would otherwise belong to root
+	if runtime.GOOS != "windows" {
+		args = append(args, "--user", fmt.Sprintf("%d:%d", os.Getuid(), os.Getgid()))
+	}
+	// values are taken from the environment rather than given as arguments, where they could be seen by other users
+	for _, name := range envNames {
+		args = append(args, "--env", name)
+	}
+	args = append(args, image, shellCommand)
+	return "docker", append(args, shellArgs...)
+}
+
+// ScriptInvocation returns the executable, arguments and environment entries which run the command in the given shell
+// within the working copy at repoDirPath, or within a new container of the image if one is given. The entries are nil
+// where turbolift's own environment is inherited unchanged.
+func ScriptInvocation(image string, repoDirPath string, environment Environment, shell string, command string) (string, []string, []string, error) {
+	if image == "" {
+		shellCommand, shellArgs := ShellInvocation(shell, command)
+		return shellCommand, shellArgs, environment.Build(os.Environ()), nil
+	}
+	workingCopyPath, err := filepath.Abs(repoDirPath)
+	if err != nil {
+		return "", nil, nil, err
+	}
+	shellCommand, shellArgs := ContainerInvocation(image, workingCopyPath, environment.Names(), shell, command)
+	// the container runtime itself needs turbolift's environment, and the container only receives the variables which
+	// are named
+	return shellCommand, shellArgs, Environment{Set: environment.Set}.Build(os.Environ()), nil
+}
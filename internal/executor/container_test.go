@@ -0,0 +1,45 @@
+/*
+ * Copyright 2021 Skyscanner Limited.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * https://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package executor
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestItRunsCommandsInContainersWithTheWorkingCopyMounted(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("containers are run as the user on unix only")
+	}
+
+	name, args := ContainerInvocation("node:18", "/campaign/work/org/repo1", []string{"NPM_TOKEN", "CI"}, "", "npm install")
+	assert.Equal(t, "docker", name)
+	assert.Equal(t, []string{
+		"run", "--rm", "--init", "--volume", "/campaign/work/org/repo1:/work", "--workdir", "/work",
+		"--user", fmt.Sprintf("%d:%d", os.Getuid(), os.Getgid()),
+		"--env", "NPM_TOKEN", "--env", "CI",
+		"node:18", "sh", "-c", "npm install",
+	}, args)
+}
+
+func TestItRunsCommandsInTheChosenShellWithinContainers(t *testing.T) {
+	_, args := ContainerInvocation("python:3.11", "/campaign/work/org/repo1", nil, "bash", "pip install -r requirements.txt")
+	assert.Equal(t, []string{"python:3.11", "bash", "-c", "pip install -r requirements.txt"}, args[len(args)-4:])
+}
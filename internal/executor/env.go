@@ -0,0 +1,127 @@
+/*
+ * Copyright 2021 Skyscanner Limited.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * https://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package executor
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"runtime"
+	"strings"
+)
+
+// essentialVariables are kept from turbolift's environment even when it is isolated, as commands need them to run
+var essentialVariables = []string{
+	"PATH", "HOME", "USER", "LOGNAME", "SHELL", "TERM", "LANG", "LC_ALL", "TMPDIR", "TZ",
+	// needed on Windows
+	"SYSTEMROOT", "WINDIR", "COMSPEC", "PATHEXT", "TEMP", "TMP", "USERPROFILE", "APPDATA", "LOCALAPPDATA",
+}
+
+// Environment describes the environment to run a command with, in relation to turbolift's own
+type Environment struct {
+	// Isolated leaves out all of turbolift's environment apart from the essential variables and those Passed
+	Isolated bool
+	// Passed are the names of variables to keep from turbolift's environment
+	Passed []string
+	// Set are KEY=VALUE entries which are added to the environment, taking precedence over turbolift's own
+	Set []string
+}
+
+// Build returns the entries of the environment, given turbolift's own (as from os.Environ), or nil if it is
+// inherited unchanged
+func (e Environment) Build(own []string) []string {
+	if !e.Isolated && len(e.Set) == 0 {
+		return nil
+	}
+
+	var env []string
+	for _, entry := range own {
+		if !e.Isolated || e.keeps(variableName(entry)) {
+			env = append(env, entry)
+		}
+	}
+	// later entries override earlier ones with the same name
+	return append(env, e.Set...)
+}
+
+// Names returns the names of the variables which are set or passed, which are all that a container receives
+func (e Environment) Names() []string {
+	names := append([]string{}, e.Passed...)
+	for _, entry := range e.Set {
+		names = append(names, variableName(entry))
+	}
+	return names
+}
+
+func (e Environment) keeps(name string) bool {
+	for _, kept := range append(essentialVariables, e.Passed...) {
+		// names are case-insensitive on Windows
+		if kept == name || (runtime.GOOS == "windows" && strings.EqualFold(kept, name)) {
+			return true
+		}
+	}
+	return false
+}
+
+func variableName(entry string) string {
+	// Windows has variables such as =C:=C:\ which record the working directory of each drive, so the name starts
+	// after a leading =
+	if len(entry) > 0 {
+		if i := strings.Index(entry[1:], "="); i >= 0 {
+			return entry[:i+1]
+		}
+	}
+	return entry
+}
+
+// ParseVariable checks that an entry is of the form KEY=VALUE
+func ParseVariable(entry string) error {
+	if i := strings.Index(entry, "="); i <= 0 {
+		return fmt.Errorf("%s is not of the form KEY=VALUE", entry)
+	}
+	return nil
+}
+
+// ReadEnvFile reads KEY=VALUE entries from a file, one per line, ignoring blank lines and # comments. Values may be
+// quoted, and lines may start with export, as in a shell script.
+func ReadEnvFile(filename string) ([]string, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = file.Close() }()
+
+	var entries []string
+	scanner := bufio.NewScanner(file)
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimPrefix(line, "export ")
+		if err := ParseVariable(line); err != nil {
+			return nil, fmt.Errorf("line %d of %s: %w", lineNumber, filename, err)
+		}
+
+		i := strings.Index(line, "=")
+		name, value := strings.TrimSpace(line[:i]), strings.TrimSpace(line[i+1:])
+		if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+			value = value[1 : len(value)-1]
+		}
+		entries = append(entries, name+"="+value)
+	}
+	return entries, scanner.Err()
+}
@@ -0,0 +1,64 @@
+/*
+ * Copyright 2021 Skyscanner Limited.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * https://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package executor
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var own = []string{"PATH=/usr/bin", "HOME=/home/user", "GITHUB_TOKEN=secret", "NPM_TOKEN=npm-secret", "EDITOR=vim"}
+
+func TestItInheritsTheEnvironmentUnlessItIsChanged(t *testing.T) {
+	assert.Nil(t, Environment{}.Build(own))
+	assert.Nil(t, Environment{Passed: []string{"NPM_TOKEN"}}.Build(own))
+}
+
+func TestItAddsVariablesToTheEnvironment(t *testing.T) {
+	env := Environment{Set: []string{"EDITOR=nano", "CI=true"}}.Build(own)
+	assert.Equal(t, append(append([]string{}, own...), "EDITOR=nano", "CI=true"), env)
+}
+
+func TestItIsolatesTheEnvironment(t *testing.T) {
+	env := Environment{Isolated: true, Passed: []string{"NPM_TOKEN"}, Set: []string{"CI=true"}}.Build(own)
+	assert.Equal(t, []string{"PATH=/usr/bin", "HOME=/home/user", "NPM_TOKEN=npm-secret", "CI=true"}, env)
+}
+
+func TestItNamesTheVariablesWhichAreSetOrPassed(t *testing.T) {
+	names := Environment{Passed: []string{"NPM_TOKEN"}, Set: []string{"CI=true", "EMPTY="}}.Names()
+	assert.Equal(t, []string{"NPM_TOKEN", "CI", "EMPTY"}, names)
+}
+
+func TestItReadsEnvFiles(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "campaign.env")
+	contents := "# settings for the codemod\nCI=true\n\nexport NODE_ENV=production\nGREETING=\"hello world\"\nQUOTED='a=b'\n"
+	assert.NoError(t, ioutil.WriteFile(filename, []byte(contents), 0o644))
+
+	entries, err := ReadEnvFile(filename)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"CI=true", "NODE_ENV=production", "GREETING=hello world", "QUOTED=a=b"}, entries)
+}
+
+func TestItRejectsEnvFilesWithInvalidLines(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "campaign.env")
+	assert.NoError(t, ioutil.WriteFile(filename, []byte("CI=true\nNODE_ENV\n"), 0o644))
+
+	_, err := ReadEnvFile(filename)
+	assert.EqualError(t, err, "line 2 of "+filename+": NODE_ENV is not of the form KEY=VALUE")
+}
@@ -17,62 +17,177 @@ package executor
 
 import (
 	"bufio"
+	"bytes"
 	"fmt"
 	"io"
 	"log"
 	"os/exec"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/skyscanner/turbolift/internal/audit"
+	"github.com/skyscanner/turbolift/internal/metrics"
 )
 
 type Executor interface {
 	Execute(output io.Writer, workingDir string, name string, args ...string) error
+	ExecuteWithEnv(output io.Writer, workingDir string, env []string, name string, args ...string) error
 	ExecuteAndCapture(output io.Writer, workingDir string, name string, args ...string) (string, error)
+	ExecuteWithTimeout(output io.Writer, workingDir string, env []string, limit time.Duration, name string, args ...string) error
 }
 
 type RealExecutor struct {
 }
 
-func (e *RealExecutor) Execute(output io.Writer, workingDir string, name string, args ...string) error {
-	command := exec.Command(name, args...)
-	command.Dir = workingDir
-	tailer(output)(command.StdoutPipe())
-	tailer(output)(command.StderrPipe())
+var binaryPaths = map[string]string{}
 
-	_, err := fmt.Fprintln(output, "Executing:", name, summarizedArgs(args), "in", workingDir)
-	if err != nil {
-		return err
+var (
+	timeout time.Duration
+
+	timedOutMutex sync.Mutex
+	timedOut      []string
+)
+
+// SetTimeout makes any external process which runs for longer than the given duration be killed, failing the
+// operation. Zero means that processes can run for as long as they need.
+func SetTimeout(d time.Duration) {
+	timeout = d
+}
+
+// TimedOut returns the working directories of processes that have been killed for running for longer than the timeout
+func TimedOut() []string {
+	timedOutMutex.Lock()
+	defer timedOutMutex.Unlock()
+	return append([]string{}, timedOut...)
+}
+
+// newCommand prepares a command to be run with runCommand for up to limit, where zero means no limit. A limited command
+// is started in a process group of its own, so that the processes it starts, such as git's remote helpers and ssh, can
+// be killed along with it. Other commands stay in the terminal's foreground group, so that prompts such as ssh's for a
+// passphrase can still read from the terminal.
+func newCommand(workingDir string, env []string, limit time.Duration, name string, args ...string) *exec.Cmd {
+	command := exec.Command(resolveBinary(name), args...)
+	command.Dir = workingDir
+	command.Env = env
+	if limit > 0 {
+		startInProcessGroup(command)
 	}
+	return command
+}
 
+// runCommand starts a command prepared with newCommand and waits for it to complete, killing it along with any
+// processes it has started if it runs for longer than limit, where zero means no limit. Killing the command alone
+// would leave them running, holding its output open and so keeping Wait from returning.
+func runCommand(command *exec.Cmd, name string, limit time.Duration) error {
 	if err := command.Start(); err != nil {
 		return err
 	}
 
-	err = command.Wait()
-	if err != nil {
+	var expired int32
+	if limit > 0 {
+		stopForwarding := forwardInterrupts(command.Process)
+		defer stopForwarding()
+		timer := time.AfterFunc(limit, func() {
+			atomic.StoreInt32(&expired, 1)
+			killProcessTree(command.Process)
+		})
+		defer timer.Stop()
+	}
+	err := command.Wait()
+
+	if atomic.LoadInt32(&expired) == 1 {
+		timedOutMutex.Lock()
+		timedOut = append(timedOut, command.Dir)
+		timedOutMutex.Unlock()
+		return fmt.Errorf("%s timed out after %s", name, limit)
+	}
+	return err
+}
+
+// SetBinaryPath makes executions of the named executable (e.g. git) use the executable at the given path instead
+func SetBinaryPath(name string, path string) {
+	binaryPaths[name] = path
+}
+
+func resolveBinary(name string) string {
+	if path, ok := binaryPaths[name]; ok {
+		return path
+	}
+	return name
+}
+
+func (e *RealExecutor) Execute(output io.Writer, workingDir string, name string, args ...string) error {
+	return e.ExecuteWithEnv(output, workingDir, nil, name, args...)
+}
+
+// ExecuteWithEnv executes a command with the given environment (as KEY=VALUE entries) instead of inheriting
+// turbolift's own. A nil env inherits turbolift's environment.
+func (e *RealExecutor) ExecuteWithEnv(output io.Writer, workingDir string, env []string, name string, args ...string) (err error) {
+	started := time.Now()
+	defer func() {
+		audit.Record(workingDir, name, args, started, err)
+		metrics.RecordProcess(name, workingDir, err)
+	}()
+
+	return e.execute(output, workingDir, env, timeout, name, args...)
+}
+
+// ExecuteWithTimeout executes a command, killing it along with any processes it has started if it runs for longer than
+// limit. The limit replaces the timeout, and zero means no limit other than the timeout. As with ExecuteWithEnv, a nil
+// env inherits turbolift's environment.
+func (e *RealExecutor) ExecuteWithTimeout(output io.Writer, workingDir string, env []string, limit time.Duration, name string, args ...string) (err error) {
+	if limit <= 0 {
+		return e.ExecuteWithEnv(output, workingDir, env, name, args...)
+	}
+
+	started := time.Now()
+	defer func() {
+		audit.Record(workingDir, name, args, started, err)
+		metrics.RecordProcess(name, workingDir, err)
+	}()
+
+	return e.execute(output, workingDir, env, limit, name, args...)
+}
+
+func (e *RealExecutor) execute(output io.Writer, workingDir string, env []string, limit time.Duration, name string, args ...string) error {
+	command := newCommand(workingDir, env, limit, name, args...)
+	tailer(output)(command.StdoutPipe())
+	tailer(output)(command.StderrPipe())
+
+	if _, err := fmt.Fprintln(output, "Executing:", name, summarizedArgs(args), "in", workingDir); err != nil {
 		return err
 	}
 
-	return nil
+	return runCommand(command, name, limit)
 }
 
-func (e *RealExecutor) ExecuteAndCapture(output io.Writer, workingDir string, name string, args ...string) (string, error) {
-	command := exec.Command(name, args...)
-	command.Dir = workingDir
+func (e *RealExecutor) ExecuteAndCapture(output io.Writer, workingDir string, name string, args ...string) (_ string, err error) {
+	started := time.Now()
+	defer func() {
+		audit.Record(workingDir, name, args, started, err)
+		metrics.RecordProcess(name, workingDir, err)
+	}()
 
-	_, err := fmt.Fprintln(output, "Executing:", name, summarizedArgs(args))
+	command := newCommand(workingDir, nil, timeout, name, args...)
+	var stdout, stderr bytes.Buffer
+	command.Stdout = &stdout
+	command.Stderr = &stderr
+
+	_, err = fmt.Fprintln(output, "Executing:", name, summarizedArgs(args))
 	if err != nil {
 		return "", err
 	}
 
-	commandOutput, err := command.Output()
-	if err != nil {
+	if err = runCommand(command, name, timeout); err != nil {
 		if exitErr, _ := err.(*exec.ExitError); exitErr != nil {
-			stdErr := string(exitErr.Stderr)
+			stdErr := stderr.String()
 			return stdErr, fmt.Errorf("error: %w. Stderr: %s", exitErr, stdErr)
 		}
-		return string(commandOutput), err
+		return stdout.String(), err
 	}
 
-	return string(commandOutput), nil
+	return stdout.String(), nil
 }
 
 // summarizedArgs transforms a list of command arguments where any long value is replaced by "...". Used to ensure
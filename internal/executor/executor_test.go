@@ -0,0 +1,122 @@
+/*
+ * Copyright 2021 Skyscanner Limited.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * https://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package executor
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestItKillsProcessesWhichExceedTheTimeout(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("relies on sleep")
+	}
+	SetTimeout(100 * time.Millisecond)
+	defer SetTimeout(0)
+
+	started := time.Now()
+	err := NewRealExecutor().Execute(&strings.Builder{}, ".", "sleep", "10")
+	assert.EqualError(t, err, "sleep timed out after 100ms")
+	assert.Less(t, int64(time.Since(started)), int64(5*time.Second))
+
+	_, err = NewRealExecutor().ExecuteAndCapture(&strings.Builder{}, "..", "sleep", "10")
+	assert.EqualError(t, err, "sleep timed out after 100ms")
+
+	assert.Equal(t, []string{".", ".."}, TimedOut())
+}
+
+func TestItKillsProcessesStartedByCommandsWhichExceedTheirLimit(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("relies on sh")
+	}
+	dir := t.TempDir()
+	marker := filepath.Join(dir, "marker")
+
+	started := time.Now()
+	err := NewRealExecutor().ExecuteWithTimeout(&strings.Builder{}, dir, nil, 100*time.Millisecond, "sh", "-c", "(sleep 1; touch marker) & wait")
+	assert.EqualError(t, err, "sh timed out after 100ms")
+	assert.Less(t, int64(time.Since(started)), int64(time.Second))
+	assert.Contains(t, TimedOut(), dir)
+
+	// the subshell would have created the marker by now, had it been left running
+	time.Sleep(1500 * time.Millisecond)
+	_, err = os.Stat(marker)
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestItKillsProcessesStartedByCommandsWhichExceedTheTimeout(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("relies on sh")
+	}
+	SetTimeout(100 * time.Millisecond)
+	defer SetTimeout(0)
+	dir := t.TempDir()
+	marker := filepath.Join(dir, "marker")
+
+	// the sleeping child holds on to the output, so waiting for the output would hang were it left running
+	started := time.Now()
+	err := NewRealExecutor().Execute(&strings.Builder{}, dir, "sh", "-c", "(sleep 1; touch marker) & wait")
+	assert.EqualError(t, err, "sh timed out after 100ms")
+	_, err = NewRealExecutor().ExecuteAndCapture(&strings.Builder{}, dir, "sh", "-c", "(sleep 1; touch marker) & wait")
+	assert.EqualError(t, err, "sh timed out after 100ms")
+	assert.Less(t, int64(time.Since(started)), int64(time.Second))
+
+	// the subshells would have created the marker by now, had they been left running
+	time.Sleep(1500 * time.Millisecond)
+	_, err = os.Stat(marker)
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestItOnlyMovesLimitedCommandsOutOfTheTerminalsProcessGroup(t *testing.T) {
+	// commands outside the foreground group are stopped when they read from the terminal, e.g. to prompt for a passphrase
+	assert.Nil(t, newCommand(".", nil, 0, "git", "fetch").SysProcAttr)
+
+	if runtime.GOOS == "windows" {
+		t.Skip("process groups are only used on Unix")
+	}
+	assert.NotNil(t, newCommand(".", nil, time.Minute, "git", "fetch").SysProcAttr)
+}
+
+func TestItDoesNotLimitCommandsWhichComplete(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("relies on sh")
+	}
+	output := &strings.Builder{}
+
+	err := NewRealExecutor().ExecuteWithTimeout(output, ".", nil, 10*time.Second, "sh", "-c", "echo hello")
+	assert.NoError(t, err)
+
+	err = NewRealExecutor().ExecuteWithTimeout(output, ".", nil, 10*time.Second, "sh", "-c", "exit 3")
+	assert.EqualError(t, err, "exit status 3")
+}
+
+func TestItDoesNotTimeOutProcessesWhichComplete(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("relies on echo")
+	}
+	SetTimeout(10 * time.Second)
+	defer SetTimeout(0)
+
+	output, err := NewRealExecutor().ExecuteAndCapture(&strings.Builder{}, ".", "echo", "hello")
+	assert.NoError(t, err)
+	assert.Equal(t, "hello\n", output)
+}
@@ -20,12 +20,15 @@ import (
 	"github.com/stretchr/testify/assert"
 	"io"
 	"testing"
+	"time"
 )
 
 type FakeExecutor struct {
 	Handler          func(workingDir string, name string, args ...string) error
 	ReturningHandler func(workingDir string, name string, args ...string) (string, error)
 	calls            [][]string
+	// LastEnv is the environment given to the last command executed with one
+	LastEnv []string
 }
 
 func (e *FakeExecutor) Execute(_ io.Writer, workingDir string, name string, args ...string) error {
@@ -34,6 +37,15 @@ func (e *FakeExecutor) Execute(_ io.Writer, workingDir string, name string, args
 	return e.Handler(workingDir, name, args...)
 }
 
+func (e *FakeExecutor) ExecuteWithEnv(output io.Writer, workingDir string, env []string, name string, args ...string) error {
+	e.LastEnv = env
+	return e.Execute(output, workingDir, name, args...)
+}
+
+func (e *FakeExecutor) ExecuteWithTimeout(output io.Writer, workingDir string, env []string, _ time.Duration, name string, args ...string) error {
+	return e.ExecuteWithEnv(output, workingDir, env, name, args...)
+}
+
 func (e *FakeExecutor) ExecuteAndCapture(_ io.Writer, workingDir string, name string, args ...string) (string, error) {
 	allArgs := append([]string{workingDir, name}, args...)
 	e.calls = append(e.calls, allArgs)
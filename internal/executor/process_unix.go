@@ -0,0 +1,59 @@
+//go:build !windows
+// +build !windows
+
+/*
+ * Copyright 2021 Skyscanner Limited.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * https://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package executor
+
+import (
+	"os"
+	"os/exec"
+	"os/signal"
+	"syscall"
+)
+
+// startInProcessGroup makes a command the leader of a new process group, which the processes it starts join, so that
+// they can all be killed together
+func startInProcessGroup(command *exec.Cmd) {
+	command.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+}
+
+// killProcessTree kills a process started with startInProcessGroup along with the processes it has started
+func killProcessTree(process *os.Process) {
+	_ = syscall.Kill(-process.Pid, syscall.SIGKILL)
+}
+
+// forwardInterrupts passes interrupts on to a process started with startInProcessGroup, which the terminal no longer
+// sends them to, until the returned function is called
+func forwardInterrupts(process *os.Process) func() {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt)
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-signals:
+				_ = syscall.Kill(-process.Pid, syscall.SIGINT)
+			case <-done:
+				return
+			}
+		}
+	}()
+	return func() {
+		signal.Stop(signals)
+		close(done)
+	}
+}
@@ -0,0 +1,39 @@
+//go:build windows
+// +build windows
+
+/*
+ * Copyright 2021 Skyscanner Limited.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * https://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package executor
+
+import (
+	"os"
+	"os/exec"
+	"strconv"
+)
+
+// startInProcessGroup does nothing on Windows, where taskkill finds the processes a command has started by itself
+func startInProcessGroup(_ *exec.Cmd) {
+}
+
+// killProcessTree kills a process along with the processes it has started
+func killProcessTree(process *os.Process) {
+	_ = exec.Command("taskkill", "/T", "/F", "/PID", strconv.Itoa(process.Pid)).Run()
+}
+
+// forwardInterrupts does nothing on Windows, where processes started by a command still receive interrupts
+func forwardInterrupts(_ *os.Process) func() {
+	return func() {}
+}
@@ -0,0 +1,55 @@
+/*
+ * Copyright 2021 Skyscanner Limited.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * https://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package executor
+
+import (
+	"os"
+	"runtime"
+	"strings"
+)
+
+// DefaultShell returns the user's shell from $SHELL, falling back to sh (or to cmd.exe on Windows) if unset
+func DefaultShell() string {
+	if shell := os.Getenv("SHELL"); shell != "" {
+		return shell
+	}
+	if runtime.GOOS == "windows" {
+		if comSpec := os.Getenv("ComSpec"); comSpec != "" {
+			return comSpec
+		}
+		return "cmd.exe"
+	}
+	return "sh"
+}
+
+// ShellInvocation returns the executable and arguments needed to run the command in the given shell, falling back
+// to the DefaultShell
+func ShellInvocation(shell string, command string) (string, []string) {
+	if shell == "" {
+		shell = DefaultShell()
+	}
+
+	// filepath.Base only understands backslashes on Windows, but $SHELL and ComSpec may hold either kind of path
+	name := shell[strings.LastIndexAny(shell, `/\`)+1:]
+	switch strings.TrimSuffix(strings.ToLower(name), ".exe") {
+	case "pwsh", "powershell":
+		return shell, []string{"-NoProfile", "-Command", command}
+	case "cmd":
+		return shell, []string{"/C", command}
+	default:
+		return shell, []string{"-c", command}
+	}
+}
@@ -0,0 +1,46 @@
+/*
+ * Copyright 2021 Skyscanner Limited.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * https://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package executor
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestShellInvocation(t *testing.T) {
+	testCases := []struct {
+		Shell        string
+		ExpectedName string
+		ExpectedArgs []string
+	}{
+		{"bash", "bash", []string{"-c", "ls -l"}},
+		{"/bin/sh", "/bin/sh", []string{"-c", "ls -l"}},
+		{"pwsh", "pwsh", []string{"-NoProfile", "-Command", "ls -l"}},
+		{"powershell.exe", "powershell.exe", []string{"-NoProfile", "-Command", "ls -l"}},
+		{"cmd.exe", "cmd.exe", []string{"/C", "ls -l"}},
+		{`C:\Windows\System32\cmd.exe`, `C:\Windows\System32\cmd.exe`, []string{"/C", "ls -l"}},
+		{"", DefaultShell(), []string{"-c", "ls -l"}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Shell, func(t *testing.T) {
+			name, args := ShellInvocation(tc.Shell, "ls -l")
+			assert.Equal(t, tc.ExpectedName, name)
+			assert.Equal(t, tc.ExpectedArgs, args)
+		})
+	}
+}
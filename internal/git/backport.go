@@ -0,0 +1,62 @@
+/*
+ * Copyright 2021 Skyscanner Limited.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * https://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package git
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// CherryPickToBranch points branchName at the result of cherry-picking the commits on the current branch which are not
+// on baseRef onto ontoRef, returning how many commits were cherry-picked. Merge commits are left out, and the branch is
+// left as it was if there is nothing to cherry-pick or the commits do not apply cleanly. The working copy is left as it
+// is, as the commits are cherry-picked in a temporary working tree.
+func (r *RealGit) CherryPickToBranch(output io.Writer, workingDir string, branchName string, baseRef string, ontoRef string) (int, error) {
+	revisions, err := execInstance.ExecuteAndCapture(output, workingDir, "git", "rev-list", "--reverse", "--no-merges", baseRef+"..HEAD")
+	if err != nil {
+		return 0, err
+	}
+	commits := strings.Fields(revisions)
+	if len(commits) == 0 {
+		return 0, nil
+	}
+
+	tempDir, err := ioutil.TempDir("", "turbolift-backport-")
+	if err != nil {
+		return 0, err
+	}
+	defer func() { _ = os.RemoveAll(tempDir) }()
+
+	worktree := filepath.Join(tempDir, "worktree")
+	if err := r.AddWorktree(output, workingDir, worktree, ontoRef); err != nil {
+		return 0, err
+	}
+	defer func() { _ = r.RemoveWorktree(output, workingDir, worktree) }()
+
+	// -x notes the original commit in each message, for reviewers and for tracing the backport later
+	if err := execInstance.Execute(output, worktree, "git", append([]string{"cherry-pick", "-x"}, commits...)...); err != nil {
+		_ = execInstance.Execute(output, worktree, "git", "cherry-pick", "--abort")
+		return 0, fmt.Errorf("the changes do not apply cleanly to %s: %w", ontoRef, err)
+	}
+	if err := execInstance.Execute(output, worktree, "git", "branch", "--force", branchName, "HEAD"); err != nil {
+		return 0, err
+	}
+	return len(commits), nil
+}
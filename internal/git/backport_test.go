@@ -0,0 +1,66 @@
+/*
+ * Copyright 2021 Skyscanner Limited.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * https://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package git
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/skyscanner/turbolift/internal/executor"
+)
+
+func TestItCherryPicksTheCampaignCommitsOntoAnotherBranch(t *testing.T) {
+	execInstance = executor.NewRealExecutor()
+	r := NewRealGit()
+	output := &strings.Builder{}
+
+	repo := t.TempDir()
+	commit := func(file string, contents string, message string) {
+		assert.NoError(t, ioutil.WriteFile(filepath.Join(repo, file), []byte(contents), 0o644))
+		runGit(t, repo, "add", file)
+		runGit(t, repo, "commit", "--quiet", "-m", message)
+	}
+	runGit(t, repo, "init", "--quiet")
+	runGit(t, repo, "config", "user.name", "Turbolift")
+	runGit(t, repo, "config", "user.email", "turbolift@example.com")
+	commit("README.md", "# Readme\n", "Initial commit")
+	runGit(t, repo, "branch", "release")
+	commit("main.txt", "main\n", "Only on main")
+	runGit(t, repo, "branch", "base")
+	runGit(t, repo, "checkout", "--quiet", "-b", "campaign")
+
+	count, err := r.CherryPickToBranch(output, repo, "campaign-backport-release", "base", "release")
+	assert.NoError(t, err)
+	assert.Equal(t, 0, count)
+
+	commit("a.txt", "a\n", "Add a")
+	commit("b.txt", "b\n", "Add b")
+	count, err = r.CherryPickToBranch(output, repo, "campaign-backport-release", "base", "release")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, count)
+	assert.Equal(t, "Add b\nAdd a\n", gitOutput(t, repo, "log", "--format=%s", "release..campaign-backport-release"))
+	assert.Equal(t, "A\ta.txt\nA\tb.txt\n", gitOutput(t, repo, "diff", "--name-status", "release", "campaign-backport-release"))
+	assert.Equal(t, "campaign\n", gitOutput(t, repo, "rev-parse", "--abbrev-ref", "HEAD"))
+
+	commit("main.txt", "main, changed\n", "Change main")
+	_, err = r.CherryPickToBranch(output, repo, "campaign-backport-release", "base", "release")
+	assert.Error(t, err)
+	assert.Equal(t, "A\ta.txt\nA\tb.txt\n", gitOutput(t, repo, "diff", "--name-status", "release", "campaign-backport-release"))
+}
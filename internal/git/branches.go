@@ -0,0 +1,44 @@
+/*
+ * Copyright 2021 Skyscanner Limited.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * https://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package git
+
+import (
+	"io"
+	"strings"
+)
+
+// CurrentBranch returns the branch checked out in the working copy, or HEAD if none is
+func (r *RealGit) CurrentBranch(output io.Writer, workingDir string) (string, error) {
+	branch, err := execInstance.ExecuteAndCapture(output, workingDir, "git", "rev-parse", "--abbrev-ref", "HEAD")
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(branch), nil
+}
+
+// SwitchBranch checks out a branch in the working copy, first creating it at startPoint (or at the current commit if
+// startPoint is empty) if it does not exist yet, and reports whether it was created
+func (r *RealGit) SwitchBranch(output io.Writer, workingDir string, branchName string, startPoint string) (bool, error) {
+	if err := execInstance.Execute(output, workingDir, "git", "rev-parse", "--verify", "--quiet", "refs/heads/"+branchName); err == nil {
+		return false, execInstance.Execute(output, workingDir, "git", "checkout", branchName)
+	}
+
+	args := []string{"checkout", "-b", branchName}
+	if startPoint != "" {
+		args = append(args, startPoint)
+	}
+	return true, execInstance.Execute(output, workingDir, "git", args...)
+}
@@ -0,0 +1,62 @@
+/*
+ * Copyright 2021 Skyscanner Limited.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * https://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package git
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/skyscanner/turbolift/internal/executor"
+)
+
+func TestItSwitchesBetweenBranchesCreatingThemAsNeeded(t *testing.T) {
+	execInstance = executor.NewRealExecutor()
+	r := NewRealGit()
+	output := &strings.Builder{}
+
+	repo := t.TempDir()
+	runGit(t, repo, "init", "--quiet")
+	runGit(t, repo, "config", "user.name", "Turbolift")
+	runGit(t, repo, "config", "user.email", "turbolift@example.com")
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(repo, "README.md"), []byte("# Readme\n"), 0o644))
+	runGit(t, repo, "add", "README.md")
+	runGit(t, repo, "commit", "--quiet", "-m", "Initial commit")
+	runGit(t, repo, "branch", "-M", "main")
+	runGit(t, repo, "checkout", "--quiet", "-b", "campaign")
+	runGit(t, repo, "commit", "--quiet", "--allow-empty", "-m", "Phase 1")
+
+	created, err := r.SwitchBranch(output, repo, "campaign-phase2", "")
+	assert.NoError(t, err)
+	assert.True(t, created)
+	assert.Equal(t, "Phase 1\n", gitOutput(t, repo, "log", "-1", "--format=%s"))
+
+	created, err = r.SwitchBranch(output, repo, "campaign", "")
+	assert.NoError(t, err)
+	assert.False(t, created)
+	assert.Equal(t, "campaign\n", gitOutput(t, repo, "rev-parse", "--abbrev-ref", "HEAD"))
+	current, err := r.CurrentBranch(output, repo)
+	assert.NoError(t, err)
+	assert.Equal(t, "campaign", current)
+
+	created, err = r.SwitchBranch(output, repo, "campaign-fresh", "main")
+	assert.NoError(t, err)
+	assert.True(t, created)
+	assert.Equal(t, "Initial commit\n", gitOutput(t, repo, "log", "-1", "--format=%s"))
+}
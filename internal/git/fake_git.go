@@ -17,14 +17,28 @@ package git
 
 import (
 	"errors"
+	"fmt"
 	"github.com/stretchr/testify/assert"
 	"io"
+	"path"
+	"strings"
 	"testing"
 )
 
 type FakeGit struct {
 	handler func(output io.Writer, call []string) (bool, error)
 	calls   [][]string
+	// Patch is returned by Diff
+	Patch string
+	// Submodules is returned by ChangedSubmodules as having moved, and other changes are reported as the handler
+	// returns
+	Submodules []string
+	// Paths is returned by ChangedPaths, filtered by its globs
+	Paths []string
+	// Branches are returned by CurrentBranch for each working copy
+	Branches map[string]string
+	// Untracked is returned by UntrackedFiles
+	Untracked []string
 }
 
 func (f *FakeGit) Checkout(output io.Writer, workingDir string, branch string) error {
@@ -62,6 +76,273 @@ func (f *FakeGit) Pull(output io.Writer, workingDir string, remote string, branc
 	return err
 }
 
+func (f *FakeGit) DeleteRemoteBranch(output io.Writer, workingDir string, remote string, branchName string) error {
+	call := []string{"deleteRemoteBranch", workingDir, remote, branchName}
+	f.calls = append(f.calls, call)
+	_, err := f.handler(output, call)
+	return err
+}
+
+func (f *FakeGit) RemoteBranchExists(output io.Writer, workingDir string, remote string, branchName string) (bool, error) {
+	call := []string{"remoteBranchExists", workingDir, remote, branchName}
+	f.calls = append(f.calls, call)
+	return f.handler(output, call)
+}
+
+func (f *FakeGit) RenameBranch(output io.Writer, workingDir string, branchName string, newBranchName string) error {
+	call := []string{"renameBranch", workingDir, branchName, newBranchName}
+	f.calls = append(f.calls, call)
+	_, err := f.handler(output, call)
+	return err
+}
+
+func (f *FakeGit) TrackRemoteBranch(output io.Writer, workingDir string, remote string, branchName string) error {
+	call := []string{"trackRemoteBranch", workingDir, remote, branchName}
+	f.calls = append(f.calls, call)
+	_, err := f.handler(output, call)
+	return err
+}
+
+// RemoteRepoName returns the name of the repo from its working directory, e.g. org/repo1 for work/org/repo1
+func (f *FakeGit) RemoteRepoName(output io.Writer, workingDir string, remote string) (string, error) {
+	call := []string{"remoteRepoName", workingDir, remote}
+	f.calls = append(f.calls, call)
+	_, err := f.handler(output, call)
+	return strings.TrimPrefix(workingDir, "work/"), err
+}
+
+func (f *FakeGit) Remotes(output io.Writer, workingDir string) ([]string, error) {
+	call := []string{"remotes", workingDir}
+	f.calls = append(f.calls, call)
+	_, err := f.handler(output, call)
+	return []string{"origin"}, err
+}
+
+func (f *FakeGit) Fetch(output io.Writer, workingDir string, remote string, branchName string) error {
+	call := []string{"fetch", workingDir, remote, branchName}
+	f.calls = append(f.calls, call)
+	_, err := f.handler(output, call)
+	return err
+}
+
+func (f *FakeGit) Rebase(output io.Writer, workingDir string, upstream string) error {
+	call := []string{"rebase", workingDir, upstream}
+	f.calls = append(f.calls, call)
+	_, err := f.handler(output, call)
+	return err
+}
+
+func (f *FakeGit) Merge(output io.Writer, workingDir string, ref string) error {
+	call := []string{"merge", workingDir, ref}
+	f.calls = append(f.calls, call)
+	_, err := f.handler(output, call)
+	return err
+}
+
+func (f *FakeGit) ResetHard(output io.Writer, workingDir string, ref string) error {
+	call := []string{"resetHard", workingDir, ref}
+	f.calls = append(f.calls, call)
+	_, err := f.handler(output, call)
+	return err
+}
+
+func (f *FakeGit) DiscardChanges(output io.Writer, workingDir string) error {
+	call := []string{"discardChanges", workingDir}
+	f.calls = append(f.calls, call)
+	_, err := f.handler(output, call)
+	return err
+}
+
+func (f *FakeGit) ForcePush(output io.Writer, workingDir string, remote string, branchName string) error {
+	call := []string{"forcePush", workingDir, remote, branchName}
+	f.calls = append(f.calls, call)
+	_, err := f.handler(output, call)
+	return err
+}
+
+func (f *FakeGit) DiffNumstat(output io.Writer, workingDir string, baseRef string, _ bool) ([]FileChange, error) {
+	call := []string{"diffNumstat", workingDir, baseRef}
+	f.calls = append(f.calls, call)
+	_, err := f.handler(output, call)
+	return []FileChange{
+		{Path: "README.md", Insertions: 1, Deletions: 0},
+		{Path: "src/main.go", Insertions: 5, Deletions: 2},
+		{Path: "src/util.go", Insertions: 4, Deletions: 0},
+	}, err
+}
+
+func (f *FakeGit) AddWorktree(output io.Writer, workingDir string, _ string, ref string) error {
+	call := []string{"addWorktree", workingDir, ref}
+	f.calls = append(f.calls, call)
+	_, err := f.handler(output, call)
+	return err
+}
+
+func (f *FakeGit) RemoveWorktree(output io.Writer, workingDir string, _ string) error {
+	call := []string{"removeWorktree", workingDir}
+	f.calls = append(f.calls, call)
+	_, err := f.handler(output, call)
+	return err
+}
+
+func (f *FakeGit) CloneMirror(output io.Writer, url string, path string) error {
+	call := []string{"cloneMirror", url, path}
+	f.calls = append(f.calls, call)
+	_, err := f.handler(output, call)
+	return err
+}
+
+func (f *FakeGit) UpdateMirror(output io.Writer, path string) error {
+	call := []string{"updateMirror", path}
+	f.calls = append(f.calls, call)
+	_, err := f.handler(output, call)
+	return err
+}
+
+func (f *FakeGit) CheckLFSInstalled(output io.Writer) error {
+	call := []string{"checkLFSInstalled"}
+	f.calls = append(f.calls, call)
+	_, err := f.handler(output, call)
+	return err
+}
+
+func (f *FakeGit) InitLFS(output io.Writer, workingDir string, skipContent bool) error {
+	call := []string{"initLFS", workingDir, fmt.Sprint(skipContent)}
+	f.calls = append(f.calls, call)
+	_, err := f.handler(output, call)
+	return err
+}
+
+func (f *FakeGit) CloneShared(output io.Writer, url string, path string, gitFlags ...string) error {
+	call := append([]string{"cloneShared", url, path}, gitFlags...)
+	f.calls = append(f.calls, call)
+	_, err := f.handler(output, call)
+	return err
+}
+
+func (f *FakeGit) UpdateShared(output io.Writer, path string) error {
+	call := []string{"updateShared", path}
+	f.calls = append(f.calls, call)
+	_, err := f.handler(output, call)
+	return err
+}
+
+func (f *FakeGit) AddWorktreeBranch(output io.Writer, workingDir string, path string, branchName string, startPoint string) error {
+	call := []string{"addWorktreeBranch", workingDir, path, branchName, startPoint}
+	f.calls = append(f.calls, call)
+	_, err := f.handler(output, call)
+	return err
+}
+
+func (f *FakeGit) ChangedSubmodules(output io.Writer, workingDir string) ([]string, bool, error) {
+	call := []string{"changedSubmodules", workingDir}
+	f.calls = append(f.calls, call)
+	otherChanges, err := f.handler(output, call)
+	return f.Submodules, otherChanges, err
+}
+
+func (f *FakeGit) CommitIgnoringSubmodules(output io.Writer, workingDir string, message string) error {
+	call := []string{"commitIgnoringSubmodules", workingDir, message}
+	f.calls = append(f.calls, call)
+	_, err := f.handler(output, call)
+	return err
+}
+
+func (f *FakeGit) AuthorIdentity(output io.Writer, workingDir string) (string, error) {
+	call := []string{"authorIdentity", workingDir}
+	f.calls = append(f.calls, call)
+	_, err := f.handler(output, call)
+	return "Fake Author <fake@example.com>", err
+}
+
+// Squash reports two commits as squashed when the handler returns true, and none otherwise
+func (f *FakeGit) Squash(output io.Writer, workingDir string, baseRef string, message string) (int, error) {
+	call := []string{"squash", workingDir, baseRef, message}
+	f.calls = append(f.calls, call)
+	squashed, err := f.handler(output, call)
+	if !squashed {
+		return 0, err
+	}
+	return 2, err
+}
+
+func (f *FakeGit) ChangedPaths(output io.Writer, workingDir string, baseRef string, globs ...string) ([]string, error) {
+	call := append([]string{"changedPaths", workingDir, baseRef}, globs...)
+	f.calls = append(f.calls, call)
+	_, err := f.handler(output, call)
+	if len(globs) == 0 {
+		return f.Paths, err
+	}
+
+	var matching []string
+	for _, p := range f.Paths {
+		for _, glob := range globs {
+			// only ** at the end of a glob is supported, unlike git
+			matched, _ := path.Match(glob, p)
+			if matched || (strings.HasSuffix(glob, "/**") && strings.HasPrefix(p, strings.TrimSuffix(glob, "**"))) {
+				matching = append(matching, p)
+				break
+			}
+		}
+	}
+	return matching, err
+}
+
+func (f *FakeGit) CommitPathsToBranch(output io.Writer, workingDir string, branchName string, baseRef string, paths []string, message string) error {
+	call := []string{"commitPathsToBranch", workingDir, branchName, baseRef, strings.Join(paths, ","), message}
+	f.calls = append(f.calls, call)
+	_, err := f.handler(output, call)
+	return err
+}
+
+func (f *FakeGit) CherryPickToBranch(output io.Writer, workingDir string, branchName string, baseRef string, ontoRef string) (int, error) {
+	call := []string{"cherryPickToBranch", workingDir, branchName, baseRef, ontoRef}
+	f.calls = append(f.calls, call)
+	ok, err := f.handler(output, call)
+	if !ok {
+		return 0, err
+	}
+	return 1, err
+}
+
+// SwitchBranch reports the branch as created when the handler returns true
+func (f *FakeGit) SwitchBranch(output io.Writer, workingDir string, branchName string, startPoint string) (bool, error) {
+	call := []string{"switchBranch", workingDir, branchName, startPoint}
+	f.calls = append(f.calls, call)
+	return f.handler(output, call)
+}
+
+func (f *FakeGit) CurrentBranch(output io.Writer, workingDir string) (string, error) {
+	call := []string{"currentBranch", workingDir}
+	f.calls = append(f.calls, call)
+	_, err := f.handler(output, call)
+	return f.Branches[workingDir], err
+}
+
+func (f *FakeGit) UntrackedFiles(output io.Writer, workingDir string) ([]string, error) {
+	call := []string{"untrackedFiles", workingDir}
+	f.calls = append(f.calls, call)
+	_, err := f.handler(output, call)
+	return f.Untracked, err
+}
+
+func (f *FakeGit) Diff(output io.Writer, workingDir string, baseRef string, _ bool) (string, error) {
+	call := []string{"diff", workingDir, baseRef}
+	f.calls = append(f.calls, call)
+	_, err := f.handler(output, call)
+	return f.Patch, err
+}
+
+func (f *FakeGit) Apply(output io.Writer, workingDir string, patchFile string, threeWay bool) error {
+	call := []string{"apply", workingDir, patchFile}
+	if threeWay {
+		call = []string{"apply", "--3way", workingDir, patchFile}
+	}
+	f.calls = append(f.calls, call)
+	_, err := f.handler(output, call)
+	return err
+}
+
 func (f *FakeGit) AssertCalledWith(t *testing.T, expected [][]string) {
 	assert.Equal(t, expected, f.calls)
 }
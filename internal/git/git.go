@@ -16,10 +16,13 @@
 package git
 
 import (
-	"github.com/skyscanner/turbolift/internal/executor"
+	"fmt"
 	"io"
-	"os"
+	"regexp"
 	"strconv"
+	"strings"
+
+	"github.com/skyscanner/turbolift/internal/executor"
 )
 
 var execInstance executor.Executor = executor.NewRealExecutor()
@@ -30,8 +33,54 @@ type Git interface {
 	Commit(output io.Writer, workingDir string, message string) error
 	IsRepoChanged(output io.Writer, workingDir string) (bool, error)
 	Pull(output io.Writer, workingDir string, remote string, branchName string) error
+	DeleteRemoteBranch(output io.Writer, workingDir string, remote string, branchName string) error
+	RemoteBranchExists(output io.Writer, workingDir string, remote string, branchName string) (bool, error)
+	RenameBranch(output io.Writer, workingDir string, branchName string, newBranchName string) error
+	TrackRemoteBranch(output io.Writer, workingDir string, remote string, branchName string) error
+	RemoteRepoName(output io.Writer, workingDir string, remote string) (string, error)
+	Remotes(output io.Writer, workingDir string) ([]string, error)
+	Fetch(output io.Writer, workingDir string, remote string, branchName string) error
+	Rebase(output io.Writer, workingDir string, upstream string) error
+	Merge(output io.Writer, workingDir string, ref string) error
+	ResetHard(output io.Writer, workingDir string, ref string) error
+	DiscardChanges(output io.Writer, workingDir string) error
+	ForcePush(output io.Writer, workingDir string, remote string, branchName string) error
+	DiffNumstat(output io.Writer, workingDir string, baseRef string, includeUncommitted bool) ([]FileChange, error)
+	Diff(output io.Writer, workingDir string, baseRef string, includeUncommitted bool) (string, error)
+	UntrackedFiles(output io.Writer, workingDir string) ([]string, error)
+	Apply(output io.Writer, workingDir string, patchFile string, threeWay bool) error
+	AddWorktree(output io.Writer, workingDir string, path string, ref string) error
+	RemoveWorktree(output io.Writer, workingDir string, path string) error
+	CloneMirror(output io.Writer, url string, path string) error
+	UpdateMirror(output io.Writer, path string) error
+	CloneShared(output io.Writer, url string, path string, gitFlags ...string) error
+	UpdateShared(output io.Writer, path string) error
+	AddWorktreeBranch(output io.Writer, workingDir string, path string, branchName string, startPoint string) error
+	CheckLFSInstalled(output io.Writer) error
+	InitLFS(output io.Writer, workingDir string, skipContent bool) error
+	ChangedSubmodules(output io.Writer, workingDir string) (moved []string, otherChanges bool, err error)
+	CommitIgnoringSubmodules(output io.Writer, workingDir string, message string) error
+	AuthorIdentity(output io.Writer, workingDir string) (string, error)
+	Squash(output io.Writer, workingDir string, baseRef string, message string) (int, error)
+	ChangedPaths(output io.Writer, workingDir string, baseRef string, globs ...string) ([]string, error)
+	CommitPathsToBranch(output io.Writer, workingDir string, branchName string, baseRef string, paths []string, message string) error
+	CherryPickToBranch(output io.Writer, workingDir string, branchName string, baseRef string, ontoRef string) (int, error)
+	SwitchBranch(output io.Writer, workingDir string, branchName string, startPoint string) (bool, error)
+	CurrentBranch(output io.Writer, workingDir string) (string, error)
 }
 
+// FileChange is the number of lines changed in a file. Binary files have no line counts.
+type FileChange struct {
+	Path       string
+	Insertions int
+	Deletions  int
+	Binary     bool
+}
+
+// remoteUrlPattern matches the host and org/repo of https and ssh remote URLs,
+// e.g. https://github.com/org/repo.git and git@github.com:org/repo.git
+var remoteUrlPattern = regexp.MustCompile(`^(?:[a-z+]+://)?(?:[^@/]+@)?([^:/]+)(?::\d+)?[:/](.+?)(?:\.git)?/?$`)
+
 type RealGit struct {
 }
 
@@ -40,35 +89,281 @@ func (r *RealGit) Checkout(output io.Writer, workingDir string, branchName strin
 }
 
 func (r *RealGit) Push(output io.Writer, workingDir string, remote string, branchName string) error {
-	return execInstance.Execute(output, workingDir, "git", "push", "-u", remote, branchName)
+	// fails rather than pushing a commit which refers to submodule commits which have not been pushed themselves
+	return execInstance.Execute(output, workingDir, "git", "push", "--recurse-submodules=check", "-u", remote, branchName)
 }
 
 func (r *RealGit) Commit(output io.Writer, workingDir string, message string) error {
 	return execInstance.Execute(output, workingDir, "git", "commit", "--all", "--message", message)
 }
 
-func (r *RealGit) IsRepoChanged(output io.Writer, workingDir string) (bool, error) {
-	shellCommand := os.Getenv("SHELL")
-	if shellCommand == "" {
-		shellCommand = "sh"
+// AuthorIdentity returns the identity that commits are authored with, as "Name <email>". It fails rather than
+// returning an identity which git has guessed from the user and host names.
+func (r *RealGit) AuthorIdentity(output io.Writer, workingDir string) (string, error) {
+	ident, err := execInstance.ExecuteAndCapture(output, workingDir, "git", "-c", "user.useConfigOnly=true", "var", "GIT_AUTHOR_IDENT")
+	if err != nil {
+		return "", err
+	}
+	// the identity is followed by a timestamp and timezone
+	ident = strings.TrimSpace(ident)
+	if i := strings.LastIndex(ident, ">"); i >= 0 {
+		ident = ident[:i+1]
 	}
-	shellArgs := []string{"-c", "git status --porcelain=v1 | wc -l | tr -d '[:space:]'"}
-	commandOutput, err := execInstance.ExecuteAndCapture(output, workingDir, shellCommand, shellArgs...)
+	return ident, nil
+}
 
+func (r *RealGit) IsRepoChanged(output io.Writer, workingDir string) (bool, error) {
+	commandOutput, err := execInstance.ExecuteAndCapture(output, workingDir, "git", "status", "--porcelain=v1")
 	if err != nil {
 		return false, err
 	}
 
-	diffSize, err := strconv.Atoi(commandOutput)
+	return strings.TrimSpace(commandOutput) != "", nil
+}
+
+func (r *RealGit) Pull(output io.Writer, workingDir string, remote string, branchName string) error {
+	return execInstance.Execute(output, workingDir, "git", "pull", "--ff-only", remote, branchName)
+}
+
+func (r *RealGit) DeleteRemoteBranch(output io.Writer, workingDir string, remote string, branchName string) error {
+	return execInstance.Execute(output, workingDir, "git", "push", remote, "--delete", branchName)
+}
+
+// RemoteBranchExists asks the remote itself whether it has the branch, rather than relying on what was last fetched
+func (r *RealGit) RemoteBranchExists(output io.Writer, workingDir string, remote string, branchName string) (bool, error) {
+	commandOutput, err := execInstance.ExecuteAndCapture(output, workingDir, "git", "ls-remote", "--heads", remote, "refs/heads/"+branchName)
 	if err != nil {
 		return false, err
 	}
 
-	return diffSize > 0, nil
+	return strings.TrimSpace(commandOutput) != "", nil
 }
 
-func (r *RealGit) Pull(output io.Writer, workingDir string, remote string, branchName string) error {
-	return execInstance.Execute(output, workingDir, "git", "pull", "--ff-only", remote, branchName)
+func (r *RealGit) RenameBranch(output io.Writer, workingDir string, branchName string, newBranchName string) error {
+	return execInstance.Execute(output, workingDir, "git", "branch", "--move", branchName, newBranchName)
+}
+
+// TrackRemoteBranch fetches a remote and sets the local branch of the same name to track the remote's branch
+func (r *RealGit) TrackRemoteBranch(output io.Writer, workingDir string, remote string, branchName string) error {
+	if err := execInstance.Execute(output, workingDir, "git", "fetch", "--prune", remote); err != nil {
+		return err
+	}
+	return execInstance.Execute(output, workingDir, "git", "branch", "--set-upstream-to", remote+"/"+branchName, branchName)
+}
+
+// RemoteRepoName returns the full name of the repository that a remote points at, as org/repo for github.com
+// and host/org/repo for other hosts
+func (r *RealGit) RemoteRepoName(output io.Writer, workingDir string, remote string) (string, error) {
+	url, err := execInstance.ExecuteAndCapture(output, workingDir, "git", "remote", "get-url", remote)
+	if err != nil {
+		return "", err
+	}
+
+	match := remoteUrlPattern.FindStringSubmatch(strings.TrimSpace(url))
+	if match == nil {
+		return "", fmt.Errorf("unable to parse the URL of remote %s: %s", remote, strings.TrimSpace(url))
+	}
+	if match[1] == "github.com" {
+		return match[2], nil
+	}
+	return match[1] + "/" + match[2], nil
+}
+
+func (r *RealGit) Remotes(output io.Writer, workingDir string) ([]string, error) {
+	remotes, err := execInstance.ExecuteAndCapture(output, workingDir, "git", "remote")
+	if err != nil {
+		return nil, err
+	}
+	return strings.Fields(remotes), nil
+}
+
+func (r *RealGit) Fetch(output io.Writer, workingDir string, remote string, branchName string) error {
+	return execInstance.Execute(output, workingDir, "git", "fetch", remote, branchName)
+}
+
+// Rebase rebases the current branch onto upstream, aborting the rebase (and leaving the branch as it was) if it fails
+func (r *RealGit) Rebase(output io.Writer, workingDir string, upstream string) error {
+	err := execInstance.Execute(output, workingDir, "git", "rebase", upstream)
+	if err != nil {
+		_ = execInstance.Execute(output, workingDir, "git", "rebase", "--abort")
+	}
+	return err
+}
+
+// Merge merges ref into the current branch, aborting the merge (and leaving the branch as it was) if it fails
+func (r *RealGit) Merge(output io.Writer, workingDir string, ref string) error {
+	err := execInstance.Execute(output, workingDir, "git", "merge", "--no-edit", ref)
+	if err != nil {
+		_ = execInstance.Execute(output, workingDir, "git", "merge", "--abort")
+	}
+	return err
+}
+
+func (r *RealGit) ResetHard(output io.Writer, workingDir string, ref string) error {
+	return execInstance.Execute(output, workingDir, "git", "reset", "--hard", ref)
+}
+
+// DiscardChanges throws away the uncommitted changes in the working copy, including untracked files which are not
+// ignored
+func (r *RealGit) DiscardChanges(output io.Writer, workingDir string) error {
+	if err := execInstance.Execute(output, workingDir, "git", "reset", "--hard", "HEAD"); err != nil {
+		return err
+	}
+	return execInstance.Execute(output, workingDir, "git", "clean", "-fd")
+}
+
+// ForcePush pushes a rewritten branch, refusing to overwrite any changes on the remote which have not been fetched
+func (r *RealGit) ForcePush(output io.Writer, workingDir string, remote string, branchName string) error {
+	return execInstance.Execute(output, workingDir, "git", "push", "--recurse-submodules=check", "--force-with-lease", remote, branchName)
+}
+
+// Squash replaces the commits on the current branch since it diverged from baseRef with a single commit with the
+// given message, returning how many commits were squashed. Branches with fewer than two commits are left as they are.
+// Uncommitted changes are left uncommitted.
+func (r *RealGit) Squash(output io.Writer, workingDir string, baseRef string, message string) (int, error) {
+	mergeBase, err := execInstance.ExecuteAndCapture(output, workingDir, "git", "merge-base", "HEAD", baseRef)
+	if err != nil {
+		return 0, err
+	}
+	mergeBase = strings.TrimSpace(mergeBase)
+	countOutput, err := execInstance.ExecuteAndCapture(output, workingDir, "git", "rev-list", "--count", mergeBase+"..HEAD")
+	if err != nil {
+		return 0, err
+	}
+	count, err := strconv.Atoi(strings.TrimSpace(countOutput))
+	if err != nil {
+		return 0, fmt.Errorf("unable to count the commits to squash: %w", err)
+	}
+	if count < 2 {
+		return count, nil
+	}
+
+	head, err := execInstance.ExecuteAndCapture(output, workingDir, "git", "rev-parse", "HEAD")
+	if err != nil {
+		return 0, err
+	}
+	if err := execInstance.Execute(output, workingDir, "git", "reset", "--soft", mergeBase); err != nil {
+		return 0, err
+	}
+	if err := execInstance.Execute(output, workingDir, "git", "commit", "--message", message); err != nil {
+		// put the original commits back rather than leaving their changes staged
+		_ = execInstance.Execute(output, workingDir, "git", "reset", "--soft", strings.TrimSpace(head))
+		return 0, err
+	}
+	return count, nil
+}
+
+// DiffNumstat returns the files changed on the current branch since it diverged from baseRef, optionally including
+// changes to tracked files which have not yet been committed. Untracked files are left out, as commit leaves them out
+// too. baseRef is not fetched, so callers fetch it first if it may be out of date.
+func (r *RealGit) DiffNumstat(output io.Writer, workingDir string, baseRef string, includeUncommitted bool) ([]FileChange, error) {
+	args := []string{"diff", "--numstat", baseRef + "...HEAD"}
+	if includeUncommitted {
+		args = []string{"diff", "--numstat", "--merge-base", baseRef}
+	}
+	numstat, err := execInstance.ExecuteAndCapture(output, workingDir, "git", args...)
+	if err != nil {
+		return nil, err
+	}
+
+	var changes []FileChange
+	for _, line := range strings.Split(numstat, "\n") {
+		fields := strings.SplitN(line, "\t", 3)
+		if len(fields) != 3 {
+			continue
+		}
+		change := FileChange{Path: fields[2]}
+		if fields[0] == "-" {
+			change.Binary = true
+		} else {
+			change.Insertions, _ = strconv.Atoi(fields[0])
+			change.Deletions, _ = strconv.Atoi(fields[1])
+		}
+		changes = append(changes, change)
+	}
+	return changes, nil
+}
+
+// Diff returns the patch for the same changes as DiffNumstat, with no context lines
+func (r *RealGit) Diff(output io.Writer, workingDir string, baseRef string, includeUncommitted bool) (string, error) {
+	args := []string{"diff", "--no-color", "--no-ext-diff", "--unified=0", baseRef + "...HEAD"}
+	if includeUncommitted {
+		args = []string{"diff", "--no-color", "--no-ext-diff", "--unified=0", "--merge-base", baseRef}
+	}
+	return execInstance.ExecuteAndCapture(output, workingDir, "git", args...)
+}
+
+// UntrackedFiles returns the new files in the working copy which git does not track, and so are not in its diffs,
+// leaving out those that are ignored
+func (r *RealGit) UntrackedFiles(output io.Writer, workingDir string) ([]string, error) {
+	listing, err := execInstance.ExecuteAndCapture(output, workingDir, "git", "ls-files", "--others", "--exclude-standard", "-z")
+	if err != nil {
+		return nil, err
+	}
+
+	var paths []string
+	for _, path := range strings.Split(listing, "\x00") {
+		if path != "" {
+			paths = append(paths, path)
+		}
+	}
+	return paths, nil
+}
+
+// Apply applies a patch to the working copy. With threeWay, a patch which does not apply cleanly is merged using the
+// blobs it records, leaving conflict markers where that fails.
+func (r *RealGit) Apply(output io.Writer, workingDir string, patchFile string, threeWay bool) error {
+	if threeWay {
+		return execInstance.Execute(output, workingDir, "git", "apply", "--3way", patchFile)
+	}
+	return execInstance.Execute(output, workingDir, "git", "apply", patchFile)
+}
+
+// AddWorktree checks out ref, detached, into a new working tree at path which shares the repository's objects
+func (r *RealGit) AddWorktree(output io.Writer, workingDir string, path string, ref string) error {
+	return execInstance.Execute(output, workingDir, "git", "worktree", "add", "--detach", path, ref)
+}
+
+// RemoveWorktree removes a working tree created by AddWorktree, along with any changes made in it
+func (r *RealGit) RemoveWorktree(output io.Writer, workingDir string, path string) error {
+	return execInstance.Execute(output, workingDir, "git", "worktree", "remove", "--force", path)
+}
+
+// CloneMirror creates a bare mirror of the repository at url, holding all of its refs
+func (r *RealGit) CloneMirror(output io.Writer, url string, path string) error {
+	return execInstance.Execute(output, ".", "git", "clone", "--mirror", url, path)
+}
+
+// UpdateMirror fetches everything new into a mirror created by CloneMirror, pruning refs which no longer exist
+func (r *RealGit) UpdateMirror(output io.Writer, path string) error {
+	return execInstance.Execute(output, path, "git", "remote", "update", "--prune")
+}
+
+// CloneShared creates a bare clone of the repository at url, for working trees to be added to with AddWorktreeBranch.
+// Unlike a mirror, it keeps the remote's branches apart from its own, so that fetching never removes a branch which is
+// checked out in a working tree.
+func (r *RealGit) CloneShared(output io.Writer, url string, path string, gitFlags ...string) error {
+	args := append([]string{"clone", "--bare", "--config", "remote.origin.fetch=+refs/heads/*:refs/remotes/origin/*"}, gitFlags...)
+	return execInstance.Execute(output, ".", "git", append(args, url, path)...)
+}
+
+// UpdateShared fetches the remote's branches into a clone created by CloneShared, and points origin/HEAD at its
+// default branch
+func (r *RealGit) UpdateShared(output io.Writer, path string) error {
+	if err := execInstance.Execute(output, path, "git", "fetch", "--prune", "origin"); err != nil {
+		return err
+	}
+	return execInstance.Execute(output, path, "git", "remote", "set-head", "origin", "--auto")
+}
+
+// AddWorktreeBranch checks out a branch in a new working tree at path, creating it from startPoint, or resetting it to
+// startPoint if it was left behind by a working tree which has since been deleted. Working trees whose directories
+// have been deleted are forgotten first, as git would otherwise still count the branch as checked out in them.
+func (r *RealGit) AddWorktreeBranch(output io.Writer, workingDir string, path string, branchName string, startPoint string) error {
+	if err := execInstance.Execute(output, workingDir, "git", "worktree", "prune"); err != nil {
+		return err
+	}
+	return execInstance.Execute(output, workingDir, "git", "worktree", "add", "--no-track", "-B", branchName, path, startPoint)
 }
 
 func NewRealGit() *RealGit {
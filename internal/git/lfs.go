@@ -0,0 +1,56 @@
+/*
+ * Copyright 2021 Skyscanner Limited.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * https://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package git
+
+import (
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+)
+
+// UsesLFS reports whether a working copy stores any files with Git LFS, according to its top-level .gitattributes
+func UsesLFS(workingDir string) bool {
+	attributes, err := ioutil.ReadFile(filepath.Join(workingDir, ".gitattributes"))
+	if err != nil {
+		return false
+	}
+	for _, line := range strings.Split(string(attributes), "\n") {
+		line = strings.TrimSpace(line)
+		if !strings.HasPrefix(line, "#") && strings.Contains(line, "filter=lfs") {
+			return true
+		}
+	}
+	return false
+}
+
+// CheckLFSInstalled fails if git-lfs is not installed, in which case files stored with LFS are checked out as pointers
+func (r *RealGit) CheckLFSInstalled(output io.Writer) error {
+	return execInstance.Execute(output, ".", "git", "lfs", "version")
+}
+
+// InitLFS sets up LFS within a working copy, whatever the user's global git configuration, so that LFS files are
+// pushed along with commits. Unless skipContent is set, the content of LFS files is also downloaded in place of their
+// pointers.
+func (r *RealGit) InitLFS(output io.Writer, workingDir string, skipContent bool) error {
+	if skipContent {
+		return execInstance.Execute(output, workingDir, "git", "lfs", "install", "--local", "--skip-smudge")
+	}
+	if err := execInstance.Execute(output, workingDir, "git", "lfs", "install", "--local"); err != nil {
+		return err
+	}
+	return execInstance.Execute(output, workingDir, "git", "lfs", "pull")
+}
@@ -0,0 +1,61 @@
+/*
+ * Copyright 2021 Skyscanner Limited.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * https://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package git
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/skyscanner/turbolift/internal/executor"
+)
+
+func TestItDetectsReposWhichUseLFS(t *testing.T) {
+	dir := t.TempDir()
+	assert.False(t, UsesLFS(dir))
+
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, ".gitattributes"), []byte("# *.bin filter=lfs\n*.sh text eol=lf\n"), 0o644))
+	assert.False(t, UsesLFS(dir))
+
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, ".gitattributes"), []byte("*.sh text eol=lf\n*.psd filter=lfs diff=lfs merge=lfs -text\n"), 0o644))
+	assert.True(t, UsesLFS(dir))
+}
+
+func TestItInitialisesLFSAndDownloadsContent(t *testing.T) {
+	fakeExecutor := executor.NewAlwaysSucceedsFakeExecutor()
+	execInstance = fakeExecutor
+
+	assert.NoError(t, NewRealGit().InitLFS(&strings.Builder{}, "work/org/repo1", false))
+
+	fakeExecutor.AssertCalledWith(t, [][]string{
+		{"work/org/repo1", "git", "lfs", "install", "--local"},
+		{"work/org/repo1", "git", "lfs", "pull"},
+	})
+}
+
+func TestItInitialisesLFSWithoutContent(t *testing.T) {
+	fakeExecutor := executor.NewAlwaysSucceedsFakeExecutor()
+	execInstance = fakeExecutor
+
+	assert.NoError(t, NewRealGit().InitLFS(&strings.Builder{}, "work/org/repo1", true))
+
+	fakeExecutor.AssertCalledWith(t, [][]string{
+		{"work/org/repo1", "git", "lfs", "install", "--local", "--skip-smudge"},
+	})
+}
@@ -0,0 +1,89 @@
+/*
+ * Copyright 2021 Skyscanner Limited.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * https://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package git
+
+import (
+	"io/ioutil"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/skyscanner/turbolift/internal/executor"
+)
+
+// Partial clones fetch blobs lazily from their origin, so check that turbolift's git operations work within them
+func TestItCommitsAndPushesFromPartialClones(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("file:// URLs for partial clones need a unix path")
+	}
+	execInstance = executor.NewRealExecutor()
+	r := NewRealGit()
+	output := &strings.Builder{}
+
+	dir := t.TempDir()
+	source := filepath.Join(dir, "source")
+	runGit(t, dir, "init", "--quiet", source)
+	runGit(t, source, "symbolic-ref", "HEAD", "refs/heads/main")
+	for _, name := range []string{"README.md", "large.bin"} {
+		assert.NoError(t, ioutil.WriteFile(filepath.Join(source, name), []byte(name+"\n"), 0o644))
+	}
+	runGit(t, source, "add", ".")
+	runGit(t, source, "-c", "user.name=Turbolift", "-c", "user.email=turbolift@example.com", "commit", "--quiet", "-m", "Initial commit")
+	origin := filepath.Join(dir, "origin.git")
+	runGit(t, dir, "clone", "--quiet", "--bare", source, origin)
+	runGit(t, origin, "config", "uploadpack.allowFilter", "true")
+
+	work := filepath.Join(dir, "work")
+	runGit(t, dir, "clone", "--quiet", "--filter=blob:none", "--no-checkout", "file://"+origin, work)
+	assert.Contains(t, gitOutput(t, work, "rev-list", "--objects", "--missing=print", "--all"), "?", "expected blobs to be missing from the partial clone")
+	runGit(t, work, "checkout", "--quiet", "main")
+	runGit(t, work, "config", "user.name", "Turbolift")
+	runGit(t, work, "config", "user.email", "turbolift@example.com")
+
+	assert.NoError(t, r.Checkout(output, work, "campaign"))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(work, "README.md"), []byte("# Changed\n"), 0o644))
+	changed, err := r.IsRepoChanged(output, work)
+	assert.NoError(t, err)
+	assert.True(t, changed)
+
+	patch, err := r.Diff(output, work, "HEAD", true)
+	assert.NoError(t, err)
+	assert.Contains(t, patch, "+# Changed")
+
+	assert.NoError(t, r.Commit(output, work, "Change README"))
+	files, err := r.DiffNumstat(output, work, "origin/main", false)
+	assert.NoError(t, err)
+	assert.Equal(t, []FileChange{{Path: "README.md", Insertions: 1, Deletions: 1}}, files)
+
+	assert.NoError(t, r.Push(output, work, "origin", "campaign"))
+	assert.Equal(t, "# Changed\n", gitOutput(t, origin, "show", "campaign:README.md"))
+}
+
+func runGit(t *testing.T, dir string, args ...string) {
+	gitOutput(t, dir, args...)
+}
+
+func gitOutput(t *testing.T, dir string, args ...string) string {
+	command := exec.Command("git", args...)
+	command.Dir = dir
+	output, err := command.CombinedOutput()
+	assert.NoError(t, err, string(output))
+	return string(output)
+}
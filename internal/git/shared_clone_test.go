@@ -0,0 +1,76 @@
+/*
+ * Copyright 2021 Skyscanner Limited.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * https://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package git
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/skyscanner/turbolift/internal/executor"
+)
+
+// Working copies added to a shared clone have a .git file rather than a directory, so check that turbolift's git
+// operations work within them, and that two campaigns can share a clone
+func TestItWorksInWorktreesOfSharedClones(t *testing.T) {
+	execInstance = executor.NewRealExecutor()
+	r := NewRealGit()
+	output := &strings.Builder{}
+
+	dir := t.TempDir()
+	source := filepath.Join(dir, "source")
+	runGit(t, dir, "init", "--quiet", source)
+	runGit(t, source, "symbolic-ref", "HEAD", "refs/heads/main")
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(source, "README.md"), []byte("# Readme\n"), 0o644))
+	runGit(t, source, "add", ".")
+	runGit(t, source, "-c", "user.name=Turbolift", "-c", "user.email=turbolift@example.com", "commit", "--quiet", "-m", "Initial commit")
+
+	shared := filepath.Join(dir, "shared", "repo.git")
+	assert.NoError(t, r.CloneShared(output, source, shared))
+	assert.NoError(t, r.UpdateShared(output, shared))
+	runGit(t, shared, "config", "user.name", "Turbolift")
+	runGit(t, shared, "config", "user.email", "turbolift@example.com")
+
+	first := filepath.Join(dir, "first", "work", "org", "repo")
+	second := filepath.Join(dir, "second", "work", "org", "repo")
+	assert.NoError(t, r.AddWorktreeBranch(output, shared, first, "first", "origin/HEAD"))
+	assert.NoError(t, r.AddWorktreeBranch(output, shared, second, "second", "origin/HEAD"))
+
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(first, "README.md"), []byte("# Changed\n"), 0o644))
+	changed, err := r.IsRepoChanged(output, first)
+	assert.NoError(t, err)
+	assert.True(t, changed)
+	changed, err = r.IsRepoChanged(output, second)
+	assert.NoError(t, err)
+	assert.False(t, changed)
+
+	assert.NoError(t, r.Commit(output, first, "Change README"))
+	files, err := r.DiffNumstat(output, first, "origin/main", false)
+	assert.NoError(t, err)
+	assert.Equal(t, []FileChange{{Path: "README.md", Insertions: 1, Deletions: 1}}, files)
+
+	assert.NoError(t, r.Push(output, first, "origin", "first"))
+	assert.Equal(t, "# Changed\n", gitOutput(t, source, "show", "first:README.md"))
+
+	// a campaign's working copy can be deleted and added again
+	assert.NoError(t, os.RemoveAll(first))
+	assert.NoError(t, r.UpdateShared(output, shared))
+	assert.NoError(t, r.AddWorktreeBranch(output, shared, first, "first", "origin/HEAD"))
+}
@@ -0,0 +1,83 @@
+/*
+ * Copyright 2021 Skyscanner Limited.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * https://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package git
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ChangedPaths returns the files changed on the current branch since it diverged from baseRef, limited to those
+// matching any of the given globs if there are some. In globs, * matches within a directory and ** across directories.
+func (r *RealGit) ChangedPaths(output io.Writer, workingDir string, baseRef string, globs ...string) ([]string, error) {
+	args := append([]string{"--glob-pathspecs", "diff", "--name-only", "--no-renames", "-z", baseRef + "...HEAD", "--"}, globs...)
+	names, err := execInstance.ExecuteAndCapture(output, workingDir, "git", args...)
+	if err != nil {
+		return nil, err
+	}
+
+	var paths []string
+	for _, name := range strings.Split(names, "\x00") {
+		if name = strings.TrimSpace(name); name != "" {
+			paths = append(paths, name)
+		}
+	}
+	return paths, nil
+}
+
+// CommitPathsToBranch points branchName at a new commit on top of the point where the current branch diverged from
+// baseRef, which has the current branch's changes to the given paths and no others. The working copy is left as it
+// is, as the commit is made in a temporary working tree.
+func (r *RealGit) CommitPathsToBranch(output io.Writer, workingDir string, branchName string, baseRef string, paths []string, message string) error {
+	mergeBase, err := execInstance.ExecuteAndCapture(output, workingDir, "git", "merge-base", "HEAD", baseRef)
+	if err != nil {
+		return err
+	}
+	head, err := execInstance.ExecuteAndCapture(output, workingDir, "git", "rev-parse", "HEAD")
+	if err != nil {
+		return err
+	}
+
+	tempDir, err := ioutil.TempDir("", "turbolift-split-")
+	if err != nil {
+		return err
+	}
+	defer func() { _ = os.RemoveAll(tempDir) }()
+
+	// the paths are given in a file, as there may be too many for the command line
+	pathsFile := filepath.Join(tempDir, "paths")
+	if err := ioutil.WriteFile(pathsFile, []byte(strings.Join(paths, "\x00")), 0o600); err != nil {
+		return err
+	}
+
+	worktree := filepath.Join(tempDir, "worktree")
+	if err := r.AddWorktree(output, workingDir, worktree, strings.TrimSpace(mergeBase)); err != nil {
+		return err
+	}
+	defer func() { _ = r.RemoveWorktree(output, workingDir, worktree) }()
+
+	// restoring a path which does not exist in the source removes it, so deletions are included too
+	if err := execInstance.Execute(output, worktree, "git", "--literal-pathspecs", "restore", "--source", strings.TrimSpace(head), "--staged", "--worktree", "--pathspec-from-file", pathsFile, "--pathspec-file-nul"); err != nil {
+		return err
+	}
+	if err := execInstance.Execute(output, worktree, "git", "commit", "--quiet", "--message", message); err != nil {
+		return err
+	}
+	return execInstance.Execute(output, worktree, "git", "branch", "--force", branchName, "HEAD")
+}
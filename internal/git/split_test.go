@@ -0,0 +1,70 @@
+/*
+ * Copyright 2021 Skyscanner Limited.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * https://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package git
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/skyscanner/turbolift/internal/executor"
+)
+
+func TestItCommitsSomeOfABranchsChangesToAnotherBranch(t *testing.T) {
+	execInstance = executor.NewRealExecutor()
+	r := NewRealGit()
+	output := &strings.Builder{}
+
+	repo := t.TempDir()
+	write := func(file string, contents string) {
+		assert.NoError(t, os.MkdirAll(filepath.Dir(filepath.Join(repo, file)), 0o755))
+		assert.NoError(t, ioutil.WriteFile(filepath.Join(repo, file), []byte(contents), 0o644))
+	}
+	runGit(t, repo, "init", "--quiet")
+	runGit(t, repo, "config", "user.name", "Turbolift")
+	runGit(t, repo, "config", "user.email", "turbolift@example.com")
+	write("docs/old.md", "old\n")
+	write("src/main.go", "package main\n")
+	runGit(t, repo, "add", ".")
+	runGit(t, repo, "commit", "--quiet", "-m", "Initial commit")
+	runGit(t, repo, "branch", "base")
+
+	runGit(t, repo, "checkout", "--quiet", "-b", "campaign")
+	write("docs/guide/new.md", "new\n")
+	runGit(t, repo, "rm", "--quiet", "docs/old.md")
+	write("src/main.go", "package main\n\nfunc main() {}\n")
+	runGit(t, repo, "add", ".")
+	runGit(t, repo, "commit", "--quiet", "-m", "Campaign change")
+
+	all, err := r.ChangedPaths(output, repo, "base")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"docs/guide/new.md", "docs/old.md", "src/main.go"}, all)
+	docs, err := r.ChangedPaths(output, repo, "base", "docs/**", "*.txt")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"docs/guide/new.md", "docs/old.md"}, docs)
+
+	assert.NoError(t, r.CommitPathsToBranch(output, repo, "campaign-docs", "base", docs, "Campaign change (docs)"), output.String())
+
+	assert.Equal(t, "Campaign change (docs)\n", gitOutput(t, repo, "log", "--format=%s", "base..campaign-docs"))
+	assert.Equal(t, "A\tdocs/guide/new.md\nD\tdocs/old.md\n", gitOutput(t, repo, "diff", "--name-status", "base", "campaign-docs"))
+	assert.Equal(t, "campaign\n", gitOutput(t, repo, "branch", "--show-current"))
+	assert.Equal(t, "", gitOutput(t, repo, "status", "--porcelain"))
+	assert.Equal(t, 1, strings.Count(gitOutput(t, repo, "worktree", "list"), "\n"))
+}
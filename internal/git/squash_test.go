@@ -0,0 +1,62 @@
+/*
+ * Copyright 2021 Skyscanner Limited.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * https://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package git
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/skyscanner/turbolift/internal/executor"
+)
+
+func TestItSquashesTheCommitsOnABranch(t *testing.T) {
+	execInstance = executor.NewRealExecutor()
+	r := NewRealGit()
+	output := &strings.Builder{}
+
+	repo := t.TempDir()
+	commit := func(file string, contents string, message string) {
+		assert.NoError(t, ioutil.WriteFile(filepath.Join(repo, file), []byte(contents), 0o644))
+		runGit(t, repo, "add", file)
+		runGit(t, repo, "commit", "--quiet", "-m", message)
+	}
+	runGit(t, repo, "init", "--quiet")
+	runGit(t, repo, "config", "user.name", "Turbolift")
+	runGit(t, repo, "config", "user.email", "turbolift@example.com")
+	commit("README.md", "# Readme\n", "Initial commit")
+	runGit(t, repo, "branch", "base")
+
+	commit("a.txt", "a\n", "Add a")
+	squashed, err := r.Squash(output, repo, "base", "Campaign change")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, squashed)
+	assert.Equal(t, "Add a\n", gitOutput(t, repo, "log", "--format=%s", "base..HEAD"))
+
+	commit("b.txt", "b\n", "Add b")
+	commit("a.txt", "a, fixed\n", "Fix a")
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(repo, "README.md"), []byte("# Uncommitted\n"), 0o644))
+
+	squashed, err = r.Squash(output, repo, "base", "Campaign change")
+	assert.NoError(t, err)
+	assert.Equal(t, 3, squashed)
+	assert.Equal(t, "Campaign change\n", gitOutput(t, repo, "log", "--format=%s", "base..HEAD"))
+	assert.Equal(t, "A\ta.txt\nA\tb.txt\n", gitOutput(t, repo, "diff", "--name-status", "base", "HEAD"))
+	assert.Equal(t, " M README.md\n", gitOutput(t, repo, "status", "--porcelain"))
+}
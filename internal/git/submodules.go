@@ -0,0 +1,60 @@
+/*
+ * Copyright 2021 Skyscanner Limited.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * https://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package git
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// HasSubmodules reports whether a working copy declares any submodules
+func HasSubmodules(workingDir string) bool {
+	_, err := os.Stat(filepath.Join(workingDir, ".gitmodules"))
+	return err == nil
+}
+
+// ChangedSubmodules returns the paths of submodules which have been moved to another commit, which commit --all
+// records, and whether there are any changes to tracked files other than submodules. Changes within a submodule which
+// have not been committed there are not included, as they cannot be committed in the superproject.
+func (r *RealGit) ChangedSubmodules(output io.Writer, workingDir string) (moved []string, otherChanges bool, err error) {
+	status, err := execInstance.ExecuteAndCapture(output, workingDir, "git", "status", "--porcelain=v2", "--untracked-files=no")
+	if err != nil {
+		return nil, false, err
+	}
+
+	for _, line := range strings.Split(status, "\n") {
+		// changed entries are "1 XY SUB ... PATH" or, for renames, "2 XY SUB ... PATH\tORIGPATH", where SUB is
+		// "N..." for files and "S<commit changed><modified><untracked>" for submodules
+		fields := strings.Fields(line)
+		if len(fields) < 9 || (fields[0] != "1" && fields[0] != "2") {
+			continue
+		}
+		if !strings.HasPrefix(fields[2], "S") {
+			otherChanges = true
+		} else if fields[2][1] == 'C' {
+			moved = append(moved, fields[len(fields)-1])
+		}
+	}
+	return moved, otherChanges, nil
+}
+
+// CommitIgnoringSubmodules commits all changes to tracked files in the same way as Commit, except for changes to
+// submodules, which are left uncommitted
+func (r *RealGit) CommitIgnoringSubmodules(output io.Writer, workingDir string, message string) error {
+	return execInstance.Execute(output, workingDir, "git", "-c", "diff.ignoreSubmodules=all", "commit", "--all", "--message", message)
+}
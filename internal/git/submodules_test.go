@@ -0,0 +1,80 @@
+/*
+ * Copyright 2021 Skyscanner Limited.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * https://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package git
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/skyscanner/turbolift/internal/executor"
+)
+
+func TestItDetectsReposWithSubmodules(t *testing.T) {
+	dir := t.TempDir()
+	assert.False(t, HasSubmodules(dir))
+
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, ".gitmodules"), []byte("[submodule \"lib\"]\n\tpath = lib\n"), 0o644))
+	assert.True(t, HasSubmodules(dir))
+}
+
+func TestItListsMovedSubmodules(t *testing.T) {
+	fakeExecutor := executor.NewFakeExecutor(func(workingDir string, name string, args ...string) error {
+		return nil
+	}, func(workingDir string, name string, args ...string) (string, error) {
+		return "1 .M SC.. 160000 160000 160000 1111111 2222222 vendor/moved\n" +
+			"1 .M S.M. 160000 160000 160000 3333333 3333333 vendor/dirty\n", nil
+	})
+	execInstance = fakeExecutor
+
+	moved, otherChanges, err := NewRealGit().ChangedSubmodules(&strings.Builder{}, "work/org/repo1")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"vendor/moved"}, moved)
+	assert.False(t, otherChanges)
+
+	fakeExecutor.AssertCalledWith(t, [][]string{
+		{"work/org/repo1", "git", "status", "--porcelain=v2", "--untracked-files=no"},
+	})
+}
+
+func TestItReportsChangesOtherThanSubmodules(t *testing.T) {
+	fakeExecutor := executor.NewFakeExecutor(func(workingDir string, name string, args ...string) error {
+		return nil
+	}, func(workingDir string, name string, args ...string) (string, error) {
+		return "1 .M N... 100644 100644 100644 4444444 4444444 README.md\n" +
+			"2 R. N... 100644 100644 100644 5555555 5555555 R100 docs/new.md\tdocs/old.md\n", nil
+	})
+	execInstance = fakeExecutor
+
+	moved, otherChanges, err := NewRealGit().ChangedSubmodules(&strings.Builder{}, "work/org/repo1")
+	assert.NoError(t, err)
+	assert.Empty(t, moved)
+	assert.True(t, otherChanges)
+}
+
+func TestItCommitsIgnoringSubmodules(t *testing.T) {
+	fakeExecutor := executor.NewAlwaysSucceedsFakeExecutor()
+	execInstance = fakeExecutor
+
+	assert.NoError(t, NewRealGit().CommitIgnoringSubmodules(&strings.Builder{}, "work/org/repo1", "a message"))
+
+	fakeExecutor.AssertCalledWith(t, [][]string{
+		{"work/org/repo1", "git", "-c", "diff.ignoreSubmodules=all", "commit", "--all", "--message", "a message"},
+	})
+}
@@ -0,0 +1,213 @@
+/*
+ * Copyright 2021 Skyscanner Limited.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * https://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package github
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// prBatchSize is how many repositories' PRs each GraphQL query fetches. Larger batches make fewer calls, but each
+// costs more of the GraphQL budget and is more likely to time out.
+const prBatchSize = 25
+
+// PRRef identifies the PR from a branch of a repository (given as org/repo or host/org/repo), whose working copy is
+// at WorkingDir
+type PRRef struct {
+	WorkingDir   string
+	FullRepoName string
+	BranchName   string
+}
+
+// PRDetails is a PR along with its merge requirements, as fetched by GetPRs
+type PRDetails struct {
+	PR           *PrStatus
+	Requirements *MergeRequirements
+}
+
+const batchedPRFragment = `fragment pr on PullRequest {
+      closed createdAt headRefName id mergeable number state title updatedAt url
+      reactionGroups { content users { totalCount } }
+      reviews(last: 50) { nodes { author { login } body state submittedAt } }` + mergeRequirementsFields + `
+}`
+
+// GetPRs fetches the latest PR from the branch of each repository, along with its merge requirements, in one GraphQL
+// query for every prBatchSize repositories on a host. Repositories without a PR are left out of the result. If a query
+// fails, the PRs fetched by the earlier ones are returned along with the error.
+func (r *RealGitHub) GetPRs(output io.Writer, workingDir string, refs []PRRef) (map[PRRef]*PRDetails, error) {
+	details := map[PRRef]*PRDetails{}
+	for _, batch := range batchesOf(refs) {
+		if err := getPRBatch(output, workingDir, batch, details); err != nil {
+			return details, err
+		}
+	}
+	return details, nil
+}
+
+type prBatch struct {
+	host string
+	refs []PRRef
+}
+
+// batchesOf splits the refs into batches of at most prBatchSize, each of repositories on the same host
+func batchesOf(refs []PRRef) []prBatch {
+	var hosts []string
+	byHost := map[string][]PRRef{}
+	for _, ref := range refs {
+		host, _, _ := splitRepoName(ref.FullRepoName)
+		if _, ok := byHost[host]; !ok {
+			hosts = append(hosts, host)
+		}
+		byHost[host] = append(byHost[host], ref)
+	}
+
+	var batches []prBatch
+	for _, host := range hosts {
+		remaining := byHost[host]
+		for len(remaining) > 0 {
+			size := prBatchSize
+			if len(remaining) < size {
+				size = len(remaining)
+			}
+			batches = append(batches, prBatch{host: host, refs: remaining[:size]})
+			remaining = remaining[size:]
+		}
+	}
+	return batches
+}
+
+// splitRepoName splits org/repo or host/org/repo into its host, which is empty for the default host, owner and name
+func splitRepoName(fullRepoName string) (string, string, string) {
+	parts := strings.Split(fullRepoName, "/")
+	if len(parts) == 3 {
+		return parts[0], parts[1], parts[2]
+	}
+	if len(parts) == 2 {
+		return "", parts[0], parts[1]
+	}
+	return "", "", fullRepoName
+}
+
+func batchedPRQuery(refs []PRRef) string {
+	var query strings.Builder
+	query.WriteString("query {\n")
+	for i, ref := range refs {
+		_, owner, name := splitRepoName(ref.FullRepoName)
+		_, _ = fmt.Fprintf(&query, "  r%d: repository(owner: %s, name: %s) {\n", i, strconv.Quote(owner), strconv.Quote(name))
+		_, _ = fmt.Fprintf(&query, "    pullRequests(headRefName: %s, first: 1, orderBy: {field: CREATED_AT, direction: DESC}) { nodes { ...pr } }\n", strconv.Quote(ref.BranchName))
+		query.WriteString("  }\n")
+	}
+	query.WriteString("}\n")
+	query.WriteString(batchedPRFragment)
+	return query.String()
+}
+
+func getPRBatch(output io.Writer, workingDir string, batch prBatch, details map[PRRef]*PRDetails) error {
+	args := []string{"api", "graphql", "-f", "query=" + batchedPRQuery(batch.refs), "--jq", ".data"}
+	if batch.host != "" {
+		args = append(args, "--hostname", batch.host)
+	}
+	response, err := execInstance.ExecuteAndCapture(output, workingDir, "gh", args...)
+	if err != nil {
+		return err
+	}
+
+	var repositories map[string]*struct {
+		PullRequests struct {
+			Nodes []json.RawMessage `json:"nodes"`
+		} `json:"pullRequests"`
+	}
+	if err := json.Unmarshal([]byte(response), &repositories); err != nil {
+		return fmt.Errorf("unable to parse PRs: %w", err)
+	}
+
+	for i, ref := range batch.refs {
+		repository := repositories[fmt.Sprintf("r%d", i)]
+		if repository == nil || len(repository.PullRequests.Nodes) == 0 {
+			continue
+		}
+		pr, err := parseBatchedPR(repository.PullRequests.Nodes[0])
+		if err != nil {
+			return err
+		}
+		details[ref] = pr
+	}
+	return nil
+}
+
+func parseBatchedPR(node json.RawMessage) (*PRDetails, error) {
+	// reviews come as a connection, rather than the list that gh pr status gives
+	var pr struct {
+		PrStatus
+		Reviews struct {
+			Nodes []Review `json:"nodes"`
+		} `json:"reviews"`
+	}
+	if err := json.Unmarshal(node, &pr); err != nil {
+		return nil, fmt.Errorf("unable to parse PR: %w", err)
+	}
+	pr.PrStatus.Reviews = pr.Reviews.Nodes
+
+	var requirements mergeRequirementsResponse
+	if err := json.Unmarshal(node, &requirements); err != nil {
+		return nil, fmt.Errorf("unable to parse merge requirements: %w", err)
+	}
+	return &PRDetails{PR: &pr.PrStatus, Requirements: requirements.requirements()}, nil
+}
+
+// PRBatch answers PR lookups and merge requirement queries from the PRs fetched together by GetPRs, falling back to
+// GitHub for any which were not fetched, such as those of repositories without a PR
+type PRBatch struct {
+	gh           GitHub
+	prs          map[string]*PrStatus
+	requirements map[string]*MergeRequirements
+}
+
+// FetchPRs fetches the PRs of many repositories in a few batched queries, so that commands don't make one or two
+// calls per repository. If that fails, the error is returned along with a PRBatch which fetches any PRs still needed
+// one at a time, so that commands can warn and carry on.
+func FetchPRs(output io.Writer, gh GitHub, refs []PRRef) (*PRBatch, error) {
+	batch := &PRBatch{gh: gh, prs: map[string]*PrStatus{}, requirements: map[string]*MergeRequirements{}}
+	details, err := gh.GetPRs(output, ".", refs)
+	for ref, d := range details {
+		batch.prs[prKey(ref.WorkingDir, ref.BranchName)] = d.PR
+		if d.Requirements != nil {
+			batch.requirements[prKey(ref.WorkingDir, d.PR.Id)] = d.Requirements
+		}
+	}
+	return batch, err
+}
+
+func prKey(workingDir string, branchName string) string {
+	return workingDir + "\x00" + branchName
+}
+
+func (b *PRBatch) GetPR(output io.Writer, workingDir string, branchName string) (*PrStatus, error) {
+	if pr, ok := b.prs[prKey(workingDir, branchName)]; ok {
+		return pr, nil
+	}
+	return b.gh.GetPR(output, workingDir, branchName)
+}
+
+func (b *PRBatch) GetMergeRequirements(output io.Writer, workingDir string, pr *PrStatus) (*MergeRequirements, error) {
+	if requirements, ok := b.requirements[prKey(workingDir, pr.Id)]; ok {
+		return requirements, nil
+	}
+	return b.gh.GetMergeRequirements(output, workingDir, pr)
+}
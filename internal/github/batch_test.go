@@ -0,0 +1,137 @@
+/*
+ * Copyright 2021 Skyscanner Limited.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * https://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package github
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/skyscanner/turbolift/internal/executor"
+)
+
+func TestItBatchesPRsByHost(t *testing.T) {
+	var refs []PRRef
+	for i := 0; i < prBatchSize+1; i++ {
+		refs = append(refs, PRRef{FullRepoName: fmt.Sprintf("org/repo%d", i)})
+	}
+	refs = append(refs, PRRef{FullRepoName: "mygitserver.com/org/repo1"})
+
+	batches := batchesOf(refs)
+	assert.Len(t, batches, 3)
+	assert.Equal(t, "", batches[0].host)
+	assert.Len(t, batches[0].refs, prBatchSize)
+	assert.Equal(t, []PRRef{refs[prBatchSize]}, batches[1].refs)
+	assert.Equal(t, prBatch{host: "mygitserver.com", refs: []PRRef{refs[prBatchSize+1]}}, batches[2])
+}
+
+func TestItFetchesPRsAndTheirMergeRequirementsTogether(t *testing.T) {
+	fakeExecutor := executor.NewFakeExecutor(func(workingDir string, name string, args ...string) error {
+		return nil
+	}, func(workingDir string, name string, args ...string) (string, error) {
+		return `{
+			"r0": {"pullRequests": {"nodes": [{
+				"id": "PR_1", "number": 7, "state": "OPEN", "url": "https://github.com/org/repo1/pull/7",
+				"reviewDecision": "APPROVED", "mergeStateStatus": "CLEAN",
+				"reviews": {"nodes": [{"author": {"login": "reviewer"}, "state": "APPROVED"}]},
+				"reactionGroups": [{"content": "HEART", "users": {"totalCount": 2}}],
+				"commits": {"nodes": [{"commit": {"statusCheckRollup": {"contexts": {"nodes": [{"name": "build", "status": "COMPLETED", "conclusion": "SUCCESS"}]}}}}]}
+			}]}},
+			"r1": {"pullRequests": {"nodes": []}},
+			"r2": null
+		}`, nil
+	})
+	execInstance = fakeExecutor
+
+	refs := []PRRef{
+		{WorkingDir: "work/org/repo1", FullRepoName: "org/repo1", BranchName: "campaign"},
+		{WorkingDir: "work/org/repo2", FullRepoName: "org/repo2", BranchName: "campaign"},
+		{WorkingDir: "work/org/repo3", FullRepoName: "org/repo3", BranchName: "campaign"},
+	}
+	details, err := NewRealGitHub().GetPRs(&strings.Builder{}, ".", refs)
+	assert.NoError(t, err)
+
+	assert.Len(t, details, 1)
+	pr := details[refs[0]].PR
+	assert.Equal(t, 7, pr.Number)
+	assert.Equal(t, "APPROVED", pr.ReviewDecision)
+	assert.Equal(t, "reviewer", pr.Reviews[0].Author.Login)
+	assert.Equal(t, 2, pr.ReactionGroups[0].Users.TotalCount)
+	requirements := details[refs[0]].Requirements
+	assert.Equal(t, "CLEAN", requirements.MergeStateStatus)
+	assert.Equal(t, "APPROVED", requirements.ReviewDecision)
+	assert.Equal(t, map[string]string{"build": "SUCCESS"}, requirements.Checks)
+
+	fakeExecutor.AssertCalledWith(t, [][]string{
+		{".", "gh", "api", "graphql", "-f", "query=" + batchedPRQuery(refs), "--jq", ".data"},
+	})
+}
+
+func TestItQueriesEachRepositoryForTheLatestPRFromTheBranch(t *testing.T) {
+	query := batchedPRQuery([]PRRef{{FullRepoName: "mygitserver.com/org/repo1", BranchName: "campaign"}})
+
+	assert.Contains(t, query, `r0: repository(owner: "org", name: "repo1")`)
+	assert.Contains(t, query, `pullRequests(headRefName: "campaign", first: 1, orderBy: {field: CREATED_AT, direction: DESC})`)
+	assert.Contains(t, query, "fragment pr on PullRequest")
+}
+
+func TestItFallsBackToFetchingPRsWhichWereNotBatched(t *testing.T) {
+	fakeGitHub := NewFakeGitHub(nil, func(workingDir string) (interface{}, error) {
+		return &PrStatus{Id: workingDir}, nil
+	})
+	fakeGitHub.BatchesPRs = true
+	refs := []PRRef{{WorkingDir: "work/org/repo1", FullRepoName: "org/repo1", BranchName: "campaign"}}
+
+	batch, err := FetchPRs(&strings.Builder{}, fakeGitHub, refs)
+	assert.NoError(t, err)
+
+	pr, err := batch.GetPR(&strings.Builder{}, "work/org/repo1", "campaign")
+	assert.NoError(t, err)
+	_, err = batch.GetMergeRequirements(&strings.Builder{}, "work/org/repo1", pr)
+	assert.NoError(t, err)
+	_, err = batch.GetPR(&strings.Builder{}, "work/org/repo2", "campaign")
+	assert.NoError(t, err)
+
+	fakeGitHub.AssertCalledWith(t, [][]string{
+		{".", "work/org/repo1"},
+		{"work/org/repo2"},
+	})
+}
+
+func TestItReturnsThePRsFetchedBeforeABatchFailed(t *testing.T) {
+	calls := 0
+	fakeExecutor := executor.NewFakeExecutor(func(workingDir string, name string, args ...string) error {
+		return nil
+	}, func(workingDir string, name string, args ...string) (string, error) {
+		calls++
+		if calls > 1 {
+			return "", fmt.Errorf("HTTP 502")
+		}
+		return `{"r0": {"pullRequests": {"nodes": [{"id": "PR_1"}]}}}`, nil
+	})
+	execInstance = fakeExecutor
+
+	refs := []PRRef{
+		{WorkingDir: "work/org/repo1", FullRepoName: "org/repo1", BranchName: "campaign"},
+		{WorkingDir: "work/org/repo1", FullRepoName: "mygitserver.com/org/repo1", BranchName: "campaign"},
+	}
+	details, err := NewRealGitHub().GetPRs(&strings.Builder{}, ".", refs)
+	assert.Error(t, err)
+	assert.Len(t, details, 1)
+	assert.Equal(t, "PR_1", details[refs[0]].PR.Id)
+}
@@ -0,0 +1,166 @@
+/*
+ * Copyright 2021 Skyscanner Limited.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * https://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package github
+
+import (
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path"
+	"time"
+
+	"github.com/skyscanner/turbolift/cmd/flags"
+)
+
+// CacheDir holds cached responses from GitHub, within the campaign directory
+const CacheDir = ".turbolift-cache/github"
+
+// PRs change as they are reviewed, so are cached for much less time than default branches
+const (
+	prCacheTTL            = 5 * time.Minute
+	defaultBranchCacheTTL = 24 * time.Hour
+)
+
+// CachingGitHub caches PR lookups and default branch queries in the campaign directory, so that repeated commands
+// against many repositories don't repeat identical API calls. Changes made to a PR through it invalidate the
+// cached lookups for its working copy. Caching is bypassed with --no-cache.
+type CachingGitHub struct {
+	GitHub
+}
+
+func NewCachingGitHub(gh GitHub) *CachingGitHub {
+	return &CachingGitHub{GitHub: gh}
+}
+
+func (c *CachingGitHub) GetPR(output io.Writer, workingDir string, branchName string) (*PrStatus, error) {
+	cacheFile := path.Join(CacheDir, "prs", workingDir, url.PathEscape(branchName)+".json")
+	if contents, ok := readCache(cacheFile, prCacheTTL); ok {
+		var pr PrStatus
+		if err := json.Unmarshal(contents, &pr); err == nil {
+			return &pr, nil
+		}
+	}
+
+	pr, err := c.GitHub.GetPR(output, workingDir, branchName)
+	if err != nil {
+		return nil, err
+	}
+	if contents, err := json.Marshal(pr); err == nil {
+		writeCache(cacheFile, contents)
+	}
+	return pr, nil
+}
+
+func (c *CachingGitHub) GetDefaultBranchName(output io.Writer, workingDir string, fullRepoName string) (string, error) {
+	cacheFile := path.Join(CacheDir, "default-branches", fullRepoName+".txt")
+	if contents, ok := readCache(cacheFile, defaultBranchCacheTTL); ok {
+		return string(contents), nil
+	}
+
+	defaultBranch, err := c.GitHub.GetDefaultBranchName(output, workingDir, fullRepoName)
+	if err != nil {
+		return "", err
+	}
+	if defaultBranch != "" {
+		writeCache(cacheFile, []byte(defaultBranch))
+	}
+	return defaultBranch, nil
+}
+
+func (c *CachingGitHub) CreatePullRequest(output io.Writer, workingDir string, metadata PullRequest) (bool, error) {
+	c.invalidatePRs(workingDir)
+	return c.GitHub.CreatePullRequest(output, workingDir, metadata)
+}
+
+func (c *CachingGitHub) ClosePullRequest(output io.Writer, workingDir string, branchName string, comment string) error {
+	c.invalidatePRs(workingDir)
+	return c.GitHub.ClosePullRequest(output, workingDir, branchName, comment)
+}
+
+func (c *CachingGitHub) UpdatePRDescription(output io.Writer, workingDir string, branchName string, title string, body string) error {
+	c.invalidatePRs(workingDir)
+	return c.GitHub.UpdatePRDescription(output, workingDir, branchName, title, body)
+}
+
+func (c *CachingGitHub) CommentOnPullRequest(output io.Writer, workingDir string, branchName string, body string) error {
+	c.invalidatePRs(workingDir)
+	return c.GitHub.CommentOnPullRequest(output, workingDir, branchName, body)
+}
+
+func (c *CachingGitHub) UpdatePRLabels(output io.Writer, workingDir string, branchName string, add []string, remove []string) error {
+	c.invalidatePRs(workingDir)
+	return c.GitHub.UpdatePRLabels(output, workingDir, branchName, add, remove)
+}
+
+func (c *CachingGitHub) ReviewPullRequest(output io.Writer, workingDir string, branchName string, approve bool, body string) error {
+	c.invalidatePRs(workingDir)
+	return c.GitHub.ReviewPullRequest(output, workingDir, branchName, approve, body)
+}
+
+func (c *CachingGitHub) MergePullRequest(output io.Writer, workingDir string, pr *PrStatus, method string) error {
+	c.invalidatePRs(workingDir)
+	return c.GitHub.MergePullRequest(output, workingDir, pr, method)
+}
+
+func (c *CachingGitHub) EnableAutoMerge(output io.Writer, workingDir string, pr *PrStatus, method string) error {
+	c.invalidatePRs(workingDir)
+	return c.GitHub.EnableAutoMerge(output, workingDir, pr, method)
+}
+
+func (c *CachingGitHub) EnqueuePullRequest(output io.Writer, workingDir string, pr *PrStatus) (*MergeQueueEntry, error) {
+	c.invalidatePRs(workingDir)
+	return c.GitHub.EnqueuePullRequest(output, workingDir, pr)
+}
+
+func (c *CachingGitHub) RevertPullRequest(output io.Writer, workingDir string, pr *PrStatus) (string, error) {
+	c.invalidatePRs(workingDir)
+	return c.GitHub.RevertPullRequest(output, workingDir, pr)
+}
+
+func (c *CachingGitHub) RenameBranch(output io.Writer, workingDir string, fullRepoName string, branchName string, newBranchName string) error {
+	c.invalidatePRs(workingDir)
+	return c.GitHub.RenameBranch(output, workingDir, fullRepoName, branchName, newBranchName)
+}
+
+func (c *CachingGitHub) invalidatePRs(workingDir string) {
+	_ = os.RemoveAll(path.Join(CacheDir, "prs", workingDir))
+}
+
+// readCache returns the contents of a cache file if caching is enabled and the file is younger than the TTL
+func readCache(cacheFile string, ttl time.Duration) ([]byte, bool) {
+	if flags.NoCache {
+		return nil, false
+	}
+	info, err := os.Stat(cacheFile)
+	if err != nil || time.Since(info.ModTime()) >= ttl {
+		return nil, false
+	}
+	contents, err := ioutil.ReadFile(cacheFile)
+	if err != nil {
+		return nil, false
+	}
+	return contents, true
+}
+
+// writeCache stores a response on a best-effort basis: failing to cache only costs a repeated API call later
+func writeCache(cacheFile string, contents []byte) {
+	if err := os.MkdirAll(path.Dir(cacheFile), os.ModeDir|0o755); err != nil {
+		return
+	}
+	_ = ioutil.WriteFile(cacheFile, contents, 0o644)
+}
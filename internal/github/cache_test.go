@@ -0,0 +1,98 @@
+/*
+ * Copyright 2021 Skyscanner Limited.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * https://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package github
+
+import (
+	"io/ioutil"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/skyscanner/turbolift/cmd/flags"
+	"github.com/skyscanner/turbolift/internal/testsupport"
+)
+
+func TestItCachesPRLookups(t *testing.T) {
+	testsupport.PrepareTempCampaign(true, "org/repo1")
+	fakeGitHub := newFakeGitHubReturningPR()
+	gh := NewCachingGitHub(fakeGitHub)
+
+	for i := 0; i < 2; i++ {
+		pr, err := gh.GetPR(ioutil.Discard, "work/org/repo1", "my-branch")
+		assert.NoError(t, err)
+		assert.Equal(t, 42, pr.Number)
+	}
+
+	fakeGitHub.AssertCalledWith(t, [][]string{
+		{"work/org/repo1"},
+	})
+}
+
+func TestItInvalidatesCachedPRsWhenAPRIsChanged(t *testing.T) {
+	testsupport.PrepareTempCampaign(true, "org/repo1")
+	fakeGitHub := newFakeGitHubReturningPR()
+	gh := NewCachingGitHub(fakeGitHub)
+
+	_, _ = gh.GetPR(ioutil.Discard, "work/org/repo1", "my-branch")
+	_ = gh.ClosePullRequest(ioutil.Discard, "work/org/repo1", "my-branch", "")
+	_, _ = gh.GetPR(ioutil.Discard, "work/org/repo1", "my-branch")
+
+	fakeGitHub.AssertCalledWith(t, [][]string{
+		{"work/org/repo1"},
+		{"work/org/repo1", "my-branch"},
+		{"work/org/repo1"},
+	})
+}
+
+func TestItCachesDefaultBranches(t *testing.T) {
+	testsupport.PrepareTempCampaign(true, "org/repo1")
+	fakeGitHub := newFakeGitHubReturningPR()
+	gh := NewCachingGitHub(fakeGitHub)
+
+	for i := 0; i < 2; i++ {
+		defaultBranch, err := gh.GetDefaultBranchName(ioutil.Discard, "work/org/repo1", "org/repo1")
+		assert.NoError(t, err)
+		assert.Equal(t, "main", defaultBranch)
+	}
+
+	fakeGitHub.AssertCalledWith(t, [][]string{
+		{"work/org/repo1", "org/repo1"},
+	})
+}
+
+func TestItBypassesTheCacheWhenDisabled(t *testing.T) {
+	testsupport.PrepareTempCampaign(true, "org/repo1")
+	fakeGitHub := newFakeGitHubReturningPR()
+	gh := NewCachingGitHub(fakeGitHub)
+	flags.NoCache = true
+	defer func() { flags.NoCache = false }()
+
+	_, _ = gh.GetPR(ioutil.Discard, "work/org/repo1", "my-branch")
+	_, _ = gh.GetPR(ioutil.Discard, "work/org/repo1", "my-branch")
+
+	fakeGitHub.AssertCalledWith(t, [][]string{
+		{"work/org/repo1"},
+		{"work/org/repo1"},
+	})
+}
+
+func newFakeGitHubReturningPR() *FakeGitHub {
+	return NewFakeGitHub(func(command Command, args []string) (bool, error) {
+		return true, nil
+	}, func(workingDir string) (interface{}, error) {
+		return &PrStatus{Number: 42, State: "OPEN"}, nil
+	})
+}
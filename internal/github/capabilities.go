@@ -0,0 +1,86 @@
+/*
+ * Copyright 2021 Skyscanner Limited.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * https://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package github
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"sync"
+
+	"github.com/skyscanner/turbolift/internal/upgrade"
+)
+
+// Capability is a feature of gh that turbolift relies on, but which older versions of gh do not have
+type Capability struct {
+	Feature    string
+	MinVersion string
+}
+
+var (
+	// ProjectsCapability is needed to add PRs to GitHub Projects (gh project)
+	ProjectsCapability = Capability{Feature: "adding PRs to projects", MinVersion: "2.31.0"}
+	// LabelsCapability is needed to create the labels that PRs are labelled with (gh label create)
+	LabelsCapability = Capability{Feature: "creating labels", MinVersion: "2.12.0"}
+	// DraftPRsCapability is needed to create PRs as drafts (gh pr create --draft)
+	DraftPRsCapability = Capability{Feature: "creating draft PRs", MinVersion: "1.0.0"}
+	// AutoMergeCapability is needed to have PRs merged once they are ready (gh pr merge --auto)
+	AutoMergeCapability = Capability{Feature: "enabling auto-merge", MinVersion: "2.0.0"}
+	// MergeQueueCapability is needed to add PRs to merge queues (gh api graphql with --jq)
+	MergeQueueCapability = Capability{Feature: "adding PRs to merge queues", MinVersion: "2.0.0"}
+)
+
+var ghVersionPattern = regexp.MustCompile(`gh version (\d+\.\d+\.\d+)`)
+
+var (
+	ghVersionMutex sync.Mutex
+	ghVersion      string
+)
+
+// CheckCapability returns an error explaining that gh needs upgrading if the installed gh is too old for the capability.
+// If the version of gh cannot be determined (e.g. for a development build), the capability is assumed to be present.
+func (r *RealGitHub) CheckCapability(output io.Writer, capability Capability) error {
+	version, err := installedGhVersion(output)
+	if err != nil {
+		return err
+	}
+	return capability.check(version)
+}
+
+func (c Capability) check(version string) error {
+	if version != "" && upgrade.IsNewer(c.MinVersion, version) {
+		return fmt.Errorf("%s needs gh %s or later, but gh %s is installed - upgrade it from https://cli.github.com", c.Feature, c.MinVersion, version)
+	}
+	return nil
+}
+
+// installedGhVersion runs gh --version once per run, as every capability check needs the same answer
+func installedGhVersion(output io.Writer) (string, error) {
+	ghVersionMutex.Lock()
+	defer ghVersionMutex.Unlock()
+	if ghVersion != "" {
+		return ghVersion, nil
+	}
+
+	versionOutput, err := execInstance.ExecuteAndCapture(output, ".", "gh", "--version")
+	if err != nil {
+		return "", fmt.Errorf("unable to find the version of gh: %w", err)
+	}
+	if match := ghVersionPattern.FindStringSubmatch(versionOutput); match != nil {
+		ghVersion = match[1]
+	}
+	return ghVersion, nil
+}
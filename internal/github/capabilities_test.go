@@ -0,0 +1,70 @@
+/*
+ * Copyright 2021 Skyscanner Limited.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * https://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package github
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/skyscanner/turbolift/internal/executor"
+)
+
+func TestItChecksCapabilitiesAgainstTheInstalledGhVersion(t *testing.T) {
+	testCases := []struct {
+		Name          string
+		VersionOutput string
+		ExpectedError string
+	}{
+		{"recent enough", "gh version 2.40.1 (2023-12-13)\nhttps://github.com/cli/cli/releases/tag/v2.40.1\n", ""},
+		{"exactly the minimum", "gh version 2.31.0 (2023-06-20)\n", ""},
+		{"too old", "gh version 2.14.7 (2022-08-25)\n", "adding PRs to projects needs gh 2.31.0 or later, but gh 2.14.7 is installed - upgrade it from https://cli.github.com"},
+		{"unknown version", "gh version DEV\n", ""},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			ghVersion = ""
+			fakeExecutor := executor.NewFakeExecutor(nil, func(string, string, ...string) (string, error) {
+				return tc.VersionOutput, nil
+			})
+			execInstance = fakeExecutor
+
+			err := NewRealGitHub().CheckCapability(&strings.Builder{}, ProjectsCapability)
+			if tc.ExpectedError == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.EqualError(t, err, tc.ExpectedError)
+			}
+		})
+	}
+}
+
+func TestItOnlyChecksTheGhVersionOnce(t *testing.T) {
+	ghVersion = ""
+	fakeExecutor := executor.NewFakeExecutor(nil, func(string, string, ...string) (string, error) {
+		return "gh version 2.40.1 (2023-12-13)\n", nil
+	})
+	execInstance = fakeExecutor
+
+	assert.NoError(t, NewRealGitHub().CheckCapability(&strings.Builder{}, ProjectsCapability))
+	assert.NoError(t, NewRealGitHub().CheckCapability(&strings.Builder{}, LabelsCapability))
+
+	fakeExecutor.AssertCalledWith(t, [][]string{
+		{".", "gh", "--version"},
+	})
+}
@@ -17,6 +17,7 @@ package github
 
 import (
 	"errors"
+	"fmt"
 	"io"
 	"testing"
 
@@ -27,35 +28,79 @@ type FakeGitHub struct {
 	handler          func(command Command, args []string) (bool, error)
 	returningHandler func(workingDir string) (interface{}, error)
 	calls            [][]string
+	// PullRequests holds the metadata of every PR that creation was attempted for
+	PullRequests []PullRequest
+	// MergeRequirements is returned for every PR, or requirements which are all met if nil
+	MergeRequirements *MergeRequirements
+	// Issues holds the metadata of every issue that creation was attempted for
+	Issues []Issue
+	// GhVersion is the version of gh that capabilities are checked against, with every capability present if empty
+	GhVersion string
+	// BatchesPRs makes GetPRs fetch PRs from the returningHandler, rather than leaving them to be fetched one at a time
+	BatchesPRs bool
+	// RepoMetadata is returned for the repositories it has an entry for, or metadata with only a default branch if not
+	RepoMetadata map[string]*RepoMetadata
+	// BranchPRs makes GetPRForBranch return the PR of each branch it has an entry for, and no PR for the others, rather
+	// than the PR from the returningHandler
+	BranchPRs map[string]*PrStatus
 }
 
 func (f *FakeGitHub) CreatePullRequest(_ io.Writer, workingDir string, metadata PullRequest) (didCreate bool, err error) {
 	args := []string{workingDir, metadata.Title}
 	f.calls = append(f.calls, args)
+	f.PullRequests = append(f.PullRequests, metadata)
 	return f.handler(CreatePullRequest, args)
 }
 
-func (f *FakeGitHub) ForkAndClone(_ io.Writer, workingDir string, fullRepoName string) error {
-	args := []string{workingDir, fullRepoName}
+func (f *FakeGitHub) ForkAndClone(_ io.Writer, workingDir string, fullRepoName string, gitFlags ...string) error {
+	args := append([]string{workingDir, fullRepoName}, gitFlags...)
 	f.calls = append(f.calls, args)
 	_, err := f.handler(ForkAndClone, args)
 	return err
 }
 
-func (f *FakeGitHub) Clone(_ io.Writer, workingDir string, fullRepoName string) error {
-	args := []string{workingDir, fullRepoName}
+func (f *FakeGitHub) Clone(_ io.Writer, workingDir string, fullRepoName string, gitFlags ...string) error {
+	args := append([]string{workingDir, fullRepoName}, gitFlags...)
 	f.calls = append(f.calls, args)
 	_, err := f.handler(Clone, args)
 	return err
 }
 
-func (f *FakeGitHub) ClosePullRequest(_ io.Writer, workingDir string, branchName string) error {
+func (f *FakeGitHub) ClosePullRequest(_ io.Writer, workingDir string, branchName string, comment string) error {
 	args := []string{workingDir, branchName}
+	if comment != "" {
+		args = append(args, comment)
+	}
 	f.calls = append(f.calls, args)
 	_, err := f.handler(ClosePullRequest, args)
 	return err
 }
 
+func (f *FakeGitHub) CommentOnPullRequest(_ io.Writer, workingDir string, branchName string, body string) error {
+	args := []string{workingDir, branchName, body}
+	f.calls = append(f.calls, args)
+	_, err := f.handler(CommentOnPullRequest, args)
+	return err
+}
+
+func (f *FakeGitHub) ReviewPullRequest(_ io.Writer, workingDir string, branchName string, approve bool, body string) error {
+	event := "COMMENT"
+	if approve {
+		event = "APPROVE"
+	}
+	args := []string{workingDir, branchName, event, body}
+	f.calls = append(f.calls, args)
+	_, err := f.handler(ReviewPullRequest, args)
+	return err
+}
+
+func (f *FakeGitHub) UpdatePRDescription(_ io.Writer, workingDir string, branchName string, title string, _ string) error {
+	args := []string{workingDir, branchName, title}
+	f.calls = append(f.calls, args)
+	_, err := f.handler(UpdatePRDescription, args)
+	return err
+}
+
 func (f *FakeGitHub) GetPR(_ io.Writer, workingDir string, _ string) (*PrStatus, error) {
 	f.calls = append(f.calls, []string{workingDir})
 	result, err := f.returningHandler(workingDir)
@@ -65,6 +110,49 @@ func (f *FakeGitHub) GetPR(_ io.Writer, workingDir string, _ string) (*PrStatus,
 	return result.(*PrStatus), err
 }
 
+func (f *FakeGitHub) GetPRForBranch(_ io.Writer, workingDir string, branchName string) (*PrStatus, error) {
+	f.calls = append(f.calls, []string{workingDir, branchName})
+	if f.BranchPRs != nil {
+		if pr, ok := f.BranchPRs[branchName]; ok {
+			return pr, nil
+		}
+		return nil, &NoPRFoundError{Path: workingDir, BranchName: branchName}
+	}
+	result, err := f.returningHandler(workingDir)
+	if result == nil {
+		return nil, err
+	}
+	return result.(*PrStatus), err
+}
+
+func (f *FakeGitHub) GetPRs(_ io.Writer, workingDir string, refs []PRRef) (map[PRRef]*PRDetails, error) {
+	details := map[PRRef]*PRDetails{}
+	if !f.BatchesPRs {
+		return details, nil
+	}
+
+	args := []string{workingDir}
+	for _, ref := range refs {
+		args = append(args, ref.WorkingDir)
+	}
+	f.calls = append(f.calls, args)
+	for _, ref := range refs {
+		result, err := f.returningHandler(ref.WorkingDir)
+		if err != nil {
+			return details, err
+		}
+		if result == nil {
+			continue
+		}
+		requirements := f.MergeRequirements
+		if requirements == nil {
+			requirements = &MergeRequirements{MergeStateStatus: "CLEAN"}
+		}
+		details[ref] = &PRDetails{PR: result.(*PrStatus), Requirements: requirements}
+	}
+	return details, nil
+}
+
 func (f *FakeGitHub) GetDefaultBranchName(_ io.Writer, workingDir string, fullRepoName string) (string, error) {
 	args := []string{workingDir, fullRepoName}
 	f.calls = append(f.calls, args)
@@ -72,10 +160,158 @@ func (f *FakeGitHub) GetDefaultBranchName(_ io.Writer, workingDir string, fullRe
 	return "main", err
 }
 
+func (f *FakeGitHub) GetRepoMetadata(_ io.Writer, workingDir string, fullRepoName string) (*RepoMetadata, error) {
+	args := []string{workingDir, fullRepoName}
+	f.calls = append(f.calls, args)
+	if _, err := f.handler(GetRepoMetadata, args); err != nil {
+		return nil, err
+	}
+	if metadata, ok := f.RepoMetadata[fullRepoName]; ok {
+		return metadata, nil
+	}
+	return &RepoMetadata{DefaultBranch: "main"}, nil
+}
+
+func (f *FakeGitHub) ListOrgRepos(_ io.Writer, workingDir string, orgName string) ([]string, error) {
+	args := []string{workingDir, orgName}
+	f.calls = append(f.calls, args)
+	_, err := f.handler(ListOrgRepos, args)
+	return []string{orgName + "/repo1", orgName + "/repo2"}, err
+}
+
+func (f *FakeGitHub) ListTeamRepos(_ io.Writer, workingDir string, orgName string, teamSlug string) ([]string, error) {
+	args := []string{workingDir, orgName, teamSlug}
+	f.calls = append(f.calls, args)
+	_, err := f.handler(ListTeamRepos, args)
+	return []string{orgName + "/repo1", orgName + "/repo2"}, err
+}
+
+func (f *FakeGitHub) RevertPullRequest(_ io.Writer, workingDir string, pr *PrStatus) (string, error) {
+	args := []string{workingDir, pr.Id}
+	f.calls = append(f.calls, args)
+	_, err := f.handler(RevertPullRequest, args)
+	return "https://github.com/revert/" + pr.Id, err
+}
+
+func (f *FakeGitHub) RenameBranch(_ io.Writer, workingDir string, fullRepoName string, branchName string, newBranchName string) error {
+	args := []string{workingDir, fullRepoName, branchName, newBranchName}
+	f.calls = append(f.calls, args)
+	_, err := f.handler(RenameBranch, args)
+	return err
+}
+
+func (f *FakeGitHub) GetRateLimits(_ io.Writer, workingDir string) (*RateLimits, error) {
+	args := []string{workingDir}
+	f.calls = append(f.calls, args)
+	_, err := f.handler(GetRateLimits, args)
+	if err != nil {
+		return nil, err
+	}
+	// both budgets reset at 2021-01-01 13:00 UTC
+	return &RateLimits{
+		Core:    RateLimit{Limit: 5000, Remaining: 4000, Reset: 1609506000},
+		GraphQL: RateLimit{Limit: 5000, Remaining: 100, Reset: 1609506000},
+	}, nil
+}
+
+func (f *FakeGitHub) GetMergeRequirements(_ io.Writer, workingDir string, pr *PrStatus) (*MergeRequirements, error) {
+	args := []string{workingDir, pr.Id}
+	f.calls = append(f.calls, args)
+	_, err := f.handler(GetMergeRequirements, args)
+	if err != nil {
+		return nil, err
+	}
+	if f.MergeRequirements == nil {
+		return &MergeRequirements{MergeStateStatus: "CLEAN"}, nil
+	}
+	return f.MergeRequirements, nil
+}
+
+func (f *FakeGitHub) MergePullRequest(_ io.Writer, workingDir string, _ *PrStatus, method string) error {
+	args := []string{workingDir, method}
+	f.calls = append(f.calls, args)
+	_, err := f.handler(MergePullRequest, args)
+	return err
+}
+
+func (f *FakeGitHub) EnableAutoMerge(_ io.Writer, workingDir string, _ *PrStatus, method string) error {
+	args := []string{workingDir, "auto", method}
+	f.calls = append(f.calls, args)
+	_, err := f.handler(EnableAutoMerge, args)
+	return err
+}
+
+func (f *FakeGitHub) EnqueuePullRequest(_ io.Writer, workingDir string, pr *PrStatus) (*MergeQueueEntry, error) {
+	args := []string{workingDir, pr.Id}
+	f.calls = append(f.calls, args)
+	_, err := f.handler(EnqueuePullRequest, args)
+	if err != nil {
+		return nil, err
+	}
+	return &MergeQueueEntry{Position: 1, State: "QUEUED"}, nil
+}
+
+func (f *FakeGitHub) CheckCapability(_ io.Writer, capability Capability) error {
+	return capability.check(f.GhVersion)
+}
+
 func (f *FakeGitHub) AssertCalledWith(t *testing.T, expected [][]string) {
 	assert.Equal(t, expected, f.calls)
 }
 
+func (f *FakeGitHub) CreateIssue(_ io.Writer, workingDir string, issue Issue) (*CreatedIssue, error) {
+	args := []string{workingDir, issue.Repo, issue.Title}
+	f.calls = append(f.calls, args)
+	f.Issues = append(f.Issues, issue)
+	_, err := f.handler(CreateIssue, args)
+	if err != nil {
+		return nil, err
+	}
+	return &CreatedIssue{Number: len(f.Issues), Url: fmt.Sprintf("https://github.com/%s/issues/%d", issue.Repo, len(f.Issues))}, nil
+}
+
+func (f *FakeGitHub) GetProject(_ io.Writer, workingDir string, owner string, number int) (*Project, error) {
+	args := []string{workingDir, owner, fmt.Sprint(number)}
+	f.calls = append(f.calls, args)
+	_, err := f.handler(GetProject, args)
+	if err != nil {
+		return nil, err
+	}
+	return &Project{Owner: owner, Number: number, Id: "PVT_1", Fields: []ProjectField{
+		{Id: "PVTSSF_1", Name: "Status", Options: []ProjectFieldOption{
+			{Id: "todo", Name: "Todo"},
+			{Id: "in-progress", Name: "In Progress"},
+			{Id: "done", Name: "Done"},
+		}},
+	}}, nil
+}
+
+func (f *FakeGitHub) AddToProject(_ io.Writer, workingDir string, _ *Project, url string, status string) error {
+	args := []string{workingDir, url, status}
+	f.calls = append(f.calls, args)
+	_, err := f.handler(AddToProject, args)
+	return err
+}
+
+func (f *FakeGitHub) EnsureLabel(_ io.Writer, workingDir string, fullRepoName string, label Label) (bool, error) {
+	args := []string{workingDir, fullRepoName, label.Name}
+	f.calls = append(f.calls, args)
+	return f.handler(EnsureLabel, args)
+}
+
+func (f *FakeGitHub) UpdatePRLabels(_ io.Writer, workingDir string, branchName string, add []string, remove []string) error {
+	args := []string{workingDir, branchName}
+	for _, label := range add {
+		args = append(args, "+"+label)
+	}
+	for _, label := range remove {
+		args = append(args, "-"+label)
+	}
+	f.calls = append(f.calls, args)
+	_, err := f.handler(UpdatePRLabels, args)
+	return err
+}
+
 func NewFakeGitHub(h func(command Command, args []string) (bool, error), r func(workingDir string) (interface{}, error)) *FakeGitHub {
 	return &FakeGitHub{
 		handler:          h,
@@ -88,7 +324,7 @@ func NewAlwaysSucceedsFakeGitHub() *FakeGitHub {
 	return NewFakeGitHub(func(command Command, args []string) (bool, error) {
 		return true, nil
 	}, func(workingDir string) (interface{}, error) {
-		return PrStatus{}, nil
+		return &PrStatus{}, nil
 	})
 }
 
@@ -113,7 +349,7 @@ func NewAlwaysReturnsFalseFakeGitHub() *FakeGitHub {
 	return NewFakeGitHub(func(command Command, args []string) (bool, error) {
 		return false, nil
 	}, func(workingDir string) (interface{}, error) {
-		return PrStatus{}, nil
+		return &PrStatus{}, nil
 	})
 }
 
@@ -124,7 +360,7 @@ func NewAlwaysFailsOnGetDefaultBranchFakeGitHub() *FakeGitHub {
 		}
 		return true, nil
 	}, func(workingDir string) (interface{}, error) {
-		return PrStatus{}, nil
+		return &PrStatus{}, nil
 	})
 }
 
@@ -136,4 +372,22 @@ const (
 	CreatePullRequest
 	ClosePullRequest
 	GetDefaultBranchName
+	ListOrgRepos
+	ListTeamRepos
+	RevertPullRequest
+	RenameBranch
+	UpdatePRDescription
+	GetRateLimits
+	GetMergeRequirements
+	CommentOnPullRequest
+	CreateIssue
+	GetProject
+	AddToProject
+	EnsureLabel
+	UpdatePRLabels
+	ReviewPullRequest
+	MergePullRequest
+	EnqueuePullRequest
+	GetRepoMetadata
+	EnableAutoMerge
 )
@@ -0,0 +1,164 @@
+/*
+ * Copyright 2021 Skyscanner Limited.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * https://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package github
+
+import "io"
+
+// offline is the forge used instead of GitHub once SetOffline has been called
+var offline *OfflineGitHub
+
+// SetOffline makes every GitHub returned by NewGitHub rehearse against local mirrors instead of using GitHub. It
+// refuses to if any working copy in workDir would still push to somewhere other than the mirrors.
+func SetOffline(mirrorsDir string, workDir string) error {
+	o, err := NewOfflineGitHub(mirrorsDir)
+	if err != nil {
+		return err
+	}
+	if err := o.checkWorkingCopies(workDir); err != nil {
+		return err
+	}
+	offline = o
+	return nil
+}
+
+// NewGitHub returns the GitHub for commands to use. As commands create it before their flags are parsed, it defers
+// the choice between GitHub itself and the offline forge until each call.
+func NewGitHub() GitHub {
+	return &selectedGitHub{real: NewRealGitHub()}
+}
+
+type selectedGitHub struct {
+	real *RealGitHub
+}
+
+func (s *selectedGitHub) current() GitHub {
+	var current GitHub = s.real
+	if offline != nil {
+		current = offline
+	}
+	if recording() {
+		return &RecordingGitHub{GitHub: current}
+	}
+	return current
+}
+
+func (s *selectedGitHub) ForkAndClone(output io.Writer, workingDir string, fullRepoName string, gitFlags ...string) error {
+	return s.current().ForkAndClone(output, workingDir, fullRepoName, gitFlags...)
+}
+
+func (s *selectedGitHub) Clone(output io.Writer, workingDir string, fullRepoName string, gitFlags ...string) error {
+	return s.current().Clone(output, workingDir, fullRepoName, gitFlags...)
+}
+
+func (s *selectedGitHub) CreatePullRequest(output io.Writer, workingDir string, metadata PullRequest) (bool, error) {
+	return s.current().CreatePullRequest(output, workingDir, metadata)
+}
+
+func (s *selectedGitHub) ClosePullRequest(output io.Writer, workingDir string, branchName string, comment string) error {
+	return s.current().ClosePullRequest(output, workingDir, branchName, comment)
+}
+
+func (s *selectedGitHub) UpdatePRDescription(output io.Writer, workingDir string, branchName string, title string, body string) error {
+	return s.current().UpdatePRDescription(output, workingDir, branchName, title, body)
+}
+
+func (s *selectedGitHub) CommentOnPullRequest(output io.Writer, workingDir string, branchName string, body string) error {
+	return s.current().CommentOnPullRequest(output, workingDir, branchName, body)
+}
+
+func (s *selectedGitHub) ReviewPullRequest(output io.Writer, workingDir string, branchName string, approve bool, body string) error {
+	return s.current().ReviewPullRequest(output, workingDir, branchName, approve, body)
+}
+
+func (s *selectedGitHub) GetPR(output io.Writer, workingDir string, branchName string) (*PrStatus, error) {
+	return s.current().GetPR(output, workingDir, branchName)
+}
+
+func (s *selectedGitHub) GetPRForBranch(output io.Writer, workingDir string, branchName string) (*PrStatus, error) {
+	return s.current().GetPRForBranch(output, workingDir, branchName)
+}
+
+func (s *selectedGitHub) GetPRs(output io.Writer, workingDir string, refs []PRRef) (map[PRRef]*PRDetails, error) {
+	return s.current().GetPRs(output, workingDir, refs)
+}
+
+func (s *selectedGitHub) GetDefaultBranchName(output io.Writer, workingDir string, fullRepoName string) (string, error) {
+	return s.current().GetDefaultBranchName(output, workingDir, fullRepoName)
+}
+
+func (s *selectedGitHub) GetRepoMetadata(output io.Writer, workingDir string, fullRepoName string) (*RepoMetadata, error) {
+	return s.current().GetRepoMetadata(output, workingDir, fullRepoName)
+}
+
+func (s *selectedGitHub) ListOrgRepos(output io.Writer, workingDir string, orgName string) ([]string, error) {
+	return s.current().ListOrgRepos(output, workingDir, orgName)
+}
+
+func (s *selectedGitHub) ListTeamRepos(output io.Writer, workingDir string, orgName string, teamSlug string) ([]string, error) {
+	return s.current().ListTeamRepos(output, workingDir, orgName, teamSlug)
+}
+
+func (s *selectedGitHub) RevertPullRequest(output io.Writer, workingDir string, pr *PrStatus) (string, error) {
+	return s.current().RevertPullRequest(output, workingDir, pr)
+}
+
+func (s *selectedGitHub) RenameBranch(output io.Writer, workingDir string, fullRepoName string, branchName string, newBranchName string) error {
+	return s.current().RenameBranch(output, workingDir, fullRepoName, branchName, newBranchName)
+}
+
+func (s *selectedGitHub) GetRateLimits(output io.Writer, workingDir string) (*RateLimits, error) {
+	return s.current().GetRateLimits(output, workingDir)
+}
+
+func (s *selectedGitHub) GetMergeRequirements(output io.Writer, workingDir string, pr *PrStatus) (*MergeRequirements, error) {
+	return s.current().GetMergeRequirements(output, workingDir, pr)
+}
+
+func (s *selectedGitHub) MergePullRequest(output io.Writer, workingDir string, pr *PrStatus, method string) error {
+	return s.current().MergePullRequest(output, workingDir, pr, method)
+}
+
+func (s *selectedGitHub) CheckCapability(output io.Writer, capability Capability) error {
+	return s.current().CheckCapability(output, capability)
+}
+
+func (s *selectedGitHub) EnableAutoMerge(output io.Writer, workingDir string, pr *PrStatus, method string) error {
+	return s.current().EnableAutoMerge(output, workingDir, pr, method)
+}
+
+func (s *selectedGitHub) EnqueuePullRequest(output io.Writer, workingDir string, pr *PrStatus) (*MergeQueueEntry, error) {
+	return s.current().EnqueuePullRequest(output, workingDir, pr)
+}
+
+func (s *selectedGitHub) CreateIssue(output io.Writer, workingDir string, issue Issue) (*CreatedIssue, error) {
+	return s.current().CreateIssue(output, workingDir, issue)
+}
+
+func (s *selectedGitHub) GetProject(output io.Writer, workingDir string, owner string, number int) (*Project, error) {
+	return s.current().GetProject(output, workingDir, owner, number)
+}
+
+func (s *selectedGitHub) AddToProject(output io.Writer, workingDir string, project *Project, url string, status string) error {
+	return s.current().AddToProject(output, workingDir, project, url, status)
+}
+
+func (s *selectedGitHub) EnsureLabel(output io.Writer, workingDir string, fullRepoName string, label Label) (bool, error) {
+	return s.current().EnsureLabel(output, workingDir, fullRepoName, label)
+}
+
+func (s *selectedGitHub) UpdatePRLabels(output io.Writer, workingDir string, branchName string, add []string, remove []string) error {
+	return s.current().UpdatePRLabels(output, workingDir, branchName, add, remove)
+}
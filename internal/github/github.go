@@ -20,6 +20,7 @@ import (
 	"fmt"
 	"io"
 	"strings"
+	"time"
 
 	"github.com/skyscanner/turbolift/internal/executor"
 )
@@ -32,15 +33,43 @@ type PullRequest struct {
 	UpstreamRepo   string
 	IsDraft        bool
 	ReviewDecision string
+	Labels         []string
+	Reviewers      []string
+	Assignees      []string
+	// Head is the branch to raise the PR from, as BRANCH or OWNER:BRANCH for a fork, rather than the current branch
+	Head string
+	// Base is the branch to raise the PR against, rather than the repository's default branch
+	Base string
 }
 
 type GitHub interface {
-	ForkAndClone(output io.Writer, workingDir string, fullRepoName string) error
-	Clone(output io.Writer, workingDir string, fullRepoName string) error
+	ForkAndClone(output io.Writer, workingDir string, fullRepoName string, gitFlags ...string) error
+	Clone(output io.Writer, workingDir string, fullRepoName string, gitFlags ...string) error
 	CreatePullRequest(output io.Writer, workingDir string, metadata PullRequest) (didCreate bool, err error)
-	ClosePullRequest(output io.Writer, workingDir string, branchName string) error
+	ClosePullRequest(output io.Writer, workingDir string, branchName string, comment string) error
+	UpdatePRDescription(output io.Writer, workingDir string, branchName string, title string, body string) error
+	CommentOnPullRequest(output io.Writer, workingDir string, branchName string, body string) error
+	ReviewPullRequest(output io.Writer, workingDir string, branchName string, approve bool, body string) error
 	GetPR(output io.Writer, workingDir string, branchName string) (*PrStatus, error)
+	GetPRForBranch(output io.Writer, workingDir string, branchName string) (*PrStatus, error)
+	GetPRs(output io.Writer, workingDir string, refs []PRRef) (map[PRRef]*PRDetails, error)
 	GetDefaultBranchName(output io.Writer, workingDir string, fullRepoName string) (string, error)
+	GetRepoMetadata(output io.Writer, workingDir string, fullRepoName string) (*RepoMetadata, error)
+	ListOrgRepos(output io.Writer, workingDir string, orgName string) ([]string, error)
+	ListTeamRepos(output io.Writer, workingDir string, orgName string, teamSlug string) ([]string, error)
+	RevertPullRequest(output io.Writer, workingDir string, pr *PrStatus) (revertUrl string, err error)
+	RenameBranch(output io.Writer, workingDir string, fullRepoName string, branchName string, newBranchName string) error
+	GetRateLimits(output io.Writer, workingDir string) (*RateLimits, error)
+	GetMergeRequirements(output io.Writer, workingDir string, pr *PrStatus) (*MergeRequirements, error)
+	MergePullRequest(output io.Writer, workingDir string, pr *PrStatus, method string) error
+	CheckCapability(output io.Writer, capability Capability) error
+	EnqueuePullRequest(output io.Writer, workingDir string, pr *PrStatus) (*MergeQueueEntry, error)
+	EnableAutoMerge(output io.Writer, workingDir string, pr *PrStatus, method string) error
+	CreateIssue(output io.Writer, workingDir string, issue Issue) (*CreatedIssue, error)
+	GetProject(output io.Writer, workingDir string, owner string, number int) (*Project, error)
+	AddToProject(output io.Writer, workingDir string, project *Project, url string, status string) error
+	EnsureLabel(output io.Writer, workingDir string, fullRepoName string, label Label) (created bool, err error)
+	UpdatePRLabels(output io.Writer, workingDir string, branchName string, add []string, remove []string) error
 }
 
 type RealGitHub struct{}
@@ -57,10 +86,30 @@ func (r *RealGitHub) CreatePullRequest(output io.Writer, workingDir string, pr P
 		pr.UpstreamRepo,
 	}
 
+	if pr.Head != "" {
+		gh_args = append(gh_args, "--head", pr.Head)
+	}
+
+	if pr.Base != "" {
+		gh_args = append(gh_args, "--base", pr.Base)
+	}
+
 	if pr.IsDraft {
 		gh_args = append(gh_args, "--draft")
 	}
 
+	for _, label := range pr.Labels {
+		gh_args = append(gh_args, "--label", label)
+	}
+
+	for _, reviewer := range pr.Reviewers {
+		gh_args = append(gh_args, "--reviewer", reviewer)
+	}
+
+	for _, assignee := range pr.Assignees {
+		gh_args = append(gh_args, "--assignee", assignee)
+	}
+
 	execOutput, err := execInstance.ExecuteAndCapture(output, workingDir, "gh", gh_args...)
 	if strings.Contains(execOutput, "GraphQL error: No commits between") {
 		// no PR was created because there are no differences between remotes
@@ -71,21 +120,72 @@ func (r *RealGitHub) CreatePullRequest(output io.Writer, workingDir string, pr P
 	return true, nil
 }
 
-func (r *RealGitHub) ForkAndClone(output io.Writer, workingDir string, fullRepoName string) error {
-	return execInstance.Execute(output, workingDir, "gh", "repo", "fork", "--clone=true", fullRepoName)
+// ForkAndClone forks the repository and clones the fork, passing any gitFlags on to git clone
+func (r *RealGitHub) ForkAndClone(output io.Writer, workingDir string, fullRepoName string, gitFlags ...string) error {
+	return execInstance.Execute(output, workingDir, "gh", withGitFlags([]string{"repo", "fork", "--clone=true", fullRepoName}, gitFlags)...)
+}
+
+// Clone clones the repository, passing any gitFlags on to git clone
+func (r *RealGitHub) Clone(output io.Writer, workingDir string, fullRepoName string, gitFlags ...string) error {
+	return execInstance.Execute(output, workingDir, "gh", withGitFlags([]string{"repo", "clone", fullRepoName}, gitFlags)...)
+}
+
+func withGitFlags(args []string, gitFlags []string) []string {
+	if len(gitFlags) == 0 {
+		return args
+	}
+	return append(append(args, "--"), gitFlags...)
+}
+
+// ClosePullRequest closes the PR from the branch, first leaving the comment on it unless the comment is empty
+func (r *RealGitHub) ClosePullRequest(output io.Writer, workingDir string, branchName string, comment string) error {
+	pr, err := r.GetPR(output, workingDir, branchName)
+	if err != nil {
+		return err
+	}
+
+	args := []string{"pr", "close", fmt.Sprint(pr.Number)}
+	if comment != "" {
+		args = append(args, "--comment", comment)
+	}
+	return execInstance.Execute(output, workingDir, "gh", args...)
+}
+
+func (r *RealGitHub) UpdatePRDescription(output io.Writer, workingDir string, branchName string, title string, body string) error {
+	pr, err := r.GetPR(output, workingDir, branchName)
+	if err != nil {
+		return err
+	}
+
+	return execInstance.Execute(output, workingDir, "gh", "pr", "edit", fmt.Sprint(pr.Number), "--title", title, "--body", body)
 }
 
-func (r *RealGitHub) Clone(output io.Writer, workingDir string, fullRepoName string) error {
-	return execInstance.Execute(output, workingDir, "gh", "repo", "clone", fullRepoName)
+func (r *RealGitHub) CommentOnPullRequest(output io.Writer, workingDir string, branchName string, body string) error {
+	pr, err := r.GetPR(output, workingDir, branchName)
+	if err != nil {
+		return err
+	}
+
+	return execInstance.Execute(output, workingDir, "gh", "pr", "comment", fmt.Sprint(pr.Number), "--body", body)
 }
 
-func (r *RealGitHub) ClosePullRequest(output io.Writer, workingDir string, branchName string) error {
+// ReviewPullRequest leaves a review on the PR from the branch, approving it if approve is set and otherwise only
+// commenting, in which case the body must not be empty
+func (r *RealGitHub) ReviewPullRequest(output io.Writer, workingDir string, branchName string, approve bool, body string) error {
 	pr, err := r.GetPR(output, workingDir, branchName)
 	if err != nil {
 		return err
 	}
 
-	return execInstance.Execute(output, workingDir, "gh", "pr", "close", fmt.Sprint(pr.Number))
+	event := "--comment"
+	if approve {
+		event = "--approve"
+	}
+	ghArgs := []string{"pr", "review", fmt.Sprint(pr.Number), event}
+	if body != "" {
+		ghArgs = append(ghArgs, "--body", body)
+	}
+	return execInstance.Execute(output, workingDir, "gh", ghArgs...)
 }
 
 func (r *RealGitHub) GetDefaultBranchName(output io.Writer, workingDir string, fullRepoName string) (string, error) {
@@ -93,6 +193,90 @@ func (r *RealGitHub) GetDefaultBranchName(output io.Writer, workingDir string, f
 	return strings.Trim(defaultBranch, "\n"), err
 }
 
+// ListOrgRepos returns the full names of every non-archived repository in the given org. An org on another host,
+// given as host/org, is listed from that host, and its repositories are named host/org/repo.
+func (r *RealGitHub) ListOrgRepos(output io.Writer, workingDir string, orgName string) ([]string, error) {
+	parts := strings.Split(orgName, "/")
+	if len(parts) != 2 {
+		repos, err := execInstance.ExecuteAndCapture(output, workingDir, "gh", "repo", "list", orgName, "--no-archived", "--limit", "10000", "--json", "nameWithOwner", "--jq", ".[].nameWithOwner")
+		if err != nil {
+			return nil, err
+		}
+		return strings.Fields(repos), nil
+	}
+
+	// gh repo list only lists from the default host, which the API can be told to look beyond
+	host := parts[0]
+	repos, err := execInstance.ExecuteAndCapture(output, workingDir, "gh", "api", "--hostname", host, "--paginate", fmt.Sprintf("orgs/%s/repos", parts[1]), "--jq", ".[] | select(.archived | not) | .full_name")
+	if err != nil {
+		return nil, err
+	}
+	var fullRepoNames []string
+	for _, repo := range strings.Fields(repos) {
+		fullRepoNames = append(fullRepoNames, host+"/"+repo)
+	}
+	return fullRepoNames, nil
+}
+
+// ListTeamRepos returns the full names of the non-archived repositories that the given team administers or maintains
+func (r *RealGitHub) ListTeamRepos(output io.Writer, workingDir string, orgName string, teamSlug string) ([]string, error) {
+	repos, err := execInstance.ExecuteAndCapture(output, workingDir, "gh", "api", "--paginate", fmt.Sprintf("orgs/%s/teams/%s/repos", orgName, teamSlug), "--jq", ".[] | select(.archived | not) | select(.permissions.admin or .permissions.maintain) | .full_name")
+	if err != nil {
+		return nil, err
+	}
+	return strings.Fields(repos), nil
+}
+
+// RevertPullRequest opens a PR reverting the changes of a merged PR, in the same way as GitHub's Revert button
+func (r *RealGitHub) RevertPullRequest(output io.Writer, workingDir string, pr *PrStatus) (string, error) {
+	mutation := "mutation($id: ID!) { revertPullRequest(input: {pullRequestId: $id}) { revertPullRequest { url } } }"
+	revertUrl, err := execInstance.ExecuteAndCapture(output, workingDir, "gh", "api", "graphql", "-f", "query="+mutation, "-f", "id="+pr.Id, "--jq", ".data.revertPullRequest.revertPullRequest.url")
+	return strings.TrimSpace(revertUrl), err
+}
+
+// RenameBranch renames a branch in a repository (given as org/repo or host/org/repo). GitHub updates the
+// head of any open PRs from the branch to follow the rename.
+func (r *RealGitHub) RenameBranch(output io.Writer, workingDir string, fullRepoName string, branchName string, newBranchName string) error {
+	var args []string
+	if parts := strings.Split(fullRepoName, "/"); len(parts) == 3 {
+		args = append(args, "--hostname", parts[0])
+		fullRepoName = parts[1] + "/" + parts[2]
+	}
+	args = append([]string{"api", "--method", "POST", fmt.Sprintf("repos/%s/branches/%s/rename", fullRepoName, branchName), "-f", "new_name=" + newBranchName}, args...)
+	return execInstance.Execute(output, workingDir, "gh", args...)
+}
+
+// RateLimits holds the API budgets of the authenticated user
+type RateLimits struct {
+	Core    RateLimit `json:"core"`
+	GraphQL RateLimit `json:"graphql"`
+}
+
+type RateLimit struct {
+	Limit     int   `json:"limit"`
+	Remaining int   `json:"remaining"`
+	Reset     int64 `json:"reset"`
+}
+
+// ResetTime is when the budget is next replenished
+func (r RateLimit) ResetTime() time.Time {
+	return time.Unix(r.Reset, 0)
+}
+
+// GetRateLimits returns the remaining REST (core) and GraphQL API budgets. Querying them does not use up either.
+func (r *RealGitHub) GetRateLimits(output io.Writer, workingDir string) (*RateLimits, error) {
+	response, err := execInstance.ExecuteAndCapture(output, workingDir, "gh", "api", "rate_limit", "--jq", ".resources")
+	if err != nil {
+		return nil, err
+	}
+
+	var limits RateLimits
+	if err := json.Unmarshal([]byte(response), &limits); err != nil {
+		return nil, fmt.Errorf("unable to parse rate limits: %w", err)
+	}
+	return &limits, nil
+}
+
 // the following is used internally to retrieve PRs from a given repository
 // using `gh pr status`
 
@@ -104,14 +288,27 @@ type PrStatusResponse struct { // https://github.com/cli/cli/blob/4b415f80d79e57
 
 type PrStatus struct {
 	Closed         bool            `json:"closed"`
+	CreatedAt      time.Time       `json:"createdAt"`
 	HeadRefName    string          `json:"headRefName"`
+	Id             string          `json:"id"`
 	Mergeable      string          `json:"mergeable"`
 	Number         int             `json:"number"`
 	ReactionGroups []ReactionGroup `json:"reactionGroups"`
 	ReviewDecision string          `json:"reviewDecision"`
 	State          string          `json:"state"`
 	Title          string          `json:"title"`
+	UpdatedAt      time.Time       `json:"updatedAt"`
 	Url            string          `json:"url"`
+	Reviews        []Review        `json:"reviews"`
+}
+
+type Review struct {
+	Author struct {
+		Login string `json:"login"`
+	} `json:"author"`
+	Body        string    `json:"body"`
+	State       string    `json:"state"`
+	SubmittedAt time.Time `json:"submittedAt"`
 }
 
 type ReactionGroupUsers struct {
@@ -133,8 +330,11 @@ func (e *NoPRFoundError) Error() string {
 	return fmt.Sprintf("no PR found for %s and branch %s", e.Path, e.BranchName)
 }
 
+// prStatusFields are the fields of a PR which are read into a PrStatus
+const prStatusFields = "closed,createdAt,headRefName,id,mergeable,number,reactionGroups,reviewDecision,reviews,state,title,updatedAt,url"
+
 func (r *RealGitHub) GetPR(output io.Writer, workingDir string, branchName string) (*PrStatus, error) {
-	s, err := execInstance.ExecuteAndCapture(output, workingDir, "gh", "pr", "status", "--json", "closed,headRefName,mergeable,number,reactionGroups,reviewDecision,state,title,url")
+	s, err := execInstance.ExecuteAndCapture(output, workingDir, "gh", "pr", "status", "--json", prStatusFields)
 	if err != nil {
 		return nil, err
 	}
@@ -160,6 +360,24 @@ func (r *RealGitHub) GetPR(output io.Writer, workingDir string, branchName strin
 	return nil, &NoPRFoundError{Path: workingDir, BranchName: branchName}
 }
 
+// GetPRForBranch returns the latest PR raised from the given branch, whichever branch the working copy has checked out.
+// GetPR only finds the PR of the checked-out branch.
+func (r *RealGitHub) GetPRForBranch(output io.Writer, workingDir string, branchName string) (*PrStatus, error) {
+	s, err := execInstance.ExecuteAndCapture(output, workingDir, "gh", "pr", "list", "--head", branchName, "--state", "all", "--limit", "1", "--json", prStatusFields)
+	if err != nil {
+		return nil, err
+	}
+
+	var prs []*PrStatus
+	if err := json.Unmarshal([]byte(s), &prs); err != nil {
+		return nil, fmt.Errorf("unable to unmarshall the PR list output: %w", err)
+	}
+	if len(prs) == 0 {
+		return nil, &NoPRFoundError{Path: workingDir, BranchName: branchName}
+	}
+	return prs[0], nil
+}
+
 func NewRealGitHub() *RealGitHub {
 	return &RealGitHub{}
 }
@@ -71,6 +71,19 @@ func TestItReturnsNilErrorOnSuccessfulClone(t *testing.T) {
 	})
 }
 
+func TestItPassesGitFlagsToClone(t *testing.T) {
+	fakeExecutor := executor.NewAlwaysSucceedsFakeExecutor()
+	execInstance = fakeExecutor
+
+	sb := strings.Builder{}
+	err := NewRealGitHub().Clone(&sb, "work/org", "org/repo1", "--reference-if-able", "/cache/org/repo1.git", "--dissociate")
+	assert.NoError(t, err)
+
+	fakeExecutor.AssertCalledWith(t, [][]string{
+		{"work/org", "gh", "repo", "clone", "org/repo1", "--", "--reference-if-able", "/cache/org/repo1.git", "--dissociate"},
+	})
+}
+
 func TestItReturnsErrorOnFailedCreatePr(t *testing.T) {
 	fakeExecutor := executor.NewAlwaysFailsFakeExecutor()
 	execInstance = fakeExecutor
@@ -114,6 +127,62 @@ func TestItSuccessfulCreatesADraftPr(t *testing.T) {
 	})
 }
 
+func TestItCreatesPrsWithLabelsReviewersAndAssignees(t *testing.T) {
+	fakeExecutor := executor.NewAlwaysSucceedsFakeExecutor()
+	execInstance = fakeExecutor
+
+	didCreatePr, err := NewRealGitHub().CreatePullRequest(&strings.Builder{}, "work/org/repo1", PullRequest{
+		Title:        "some title",
+		Body:         "some body",
+		UpstreamRepo: "org/repo1",
+		Labels:       []string{"migration"},
+		Reviewers:    []string{"alice", "org/team"},
+		Assignees:    []string{"alice"},
+	})
+	assert.NoError(t, err)
+	assert.True(t, didCreatePr)
+
+	fakeExecutor.AssertCalledWith(t, [][]string{
+		{"work/org/repo1", "gh", "pr", "create", "--title", "some title", "--body", "some body", "--repo", "org/repo1", "--label", "migration", "--reviewer", "alice", "--reviewer", "org/team", "--assignee", "alice"},
+	})
+}
+
+func TestItCreatesPrsFromAnotherBranch(t *testing.T) {
+	fakeExecutor := executor.NewAlwaysSucceedsFakeExecutor()
+	execInstance = fakeExecutor
+
+	didCreatePr, err := NewRealGitHub().CreatePullRequest(&strings.Builder{}, "work/org/repo1", PullRequest{
+		Title:        "some title",
+		Body:         "some body",
+		UpstreamRepo: "org/repo1",
+		Head:         "me:campaign-docs",
+	})
+	assert.NoError(t, err)
+	assert.True(t, didCreatePr)
+
+	fakeExecutor.AssertCalledWith(t, [][]string{
+		{"work/org/repo1", "gh", "pr", "create", "--title", "some title", "--body", "some body", "--repo", "org/repo1", "--head", "me:campaign-docs"},
+	})
+}
+
+func TestItCreatesPrsAgainstAnotherBase(t *testing.T) {
+	fakeExecutor := executor.NewAlwaysSucceedsFakeExecutor()
+	execInstance = fakeExecutor
+
+	didCreatePr, err := NewRealGitHub().CreatePullRequest(&strings.Builder{}, "work/org/repo1", PullRequest{
+		Title:        "some title",
+		Body:         "some body",
+		UpstreamRepo: "org/repo1",
+		Base:         "release/2024.06",
+	})
+	assert.NoError(t, err)
+	assert.True(t, didCreatePr)
+
+	fakeExecutor.AssertCalledWith(t, [][]string{
+		{"work/org/repo1", "gh", "pr", "create", "--title", "some title", "--body", "some body", "--repo", "org/repo1", "--base", "release/2024.06"},
+	})
+}
+
 func TestItReturnsTrueAndNilErrorOnSuccessfulCreatePr(t *testing.T) {
 	fakeExecutor := executor.NewAlwaysSucceedsFakeExecutor()
 	execInstance = fakeExecutor
@@ -151,6 +220,236 @@ func TestItReturnsNilErrorOnSuccessfulGetDefaultBranchName(t *testing.T) {
 	})
 }
 
+func TestItListsOrgRepos(t *testing.T) {
+	fakeExecutor := executor.NewFakeExecutor(func(workingDir string, name string, args ...string) error {
+		return nil
+	}, func(workingDir string, name string, args ...string) (string, error) {
+		return "org/repo1\norg/repo2\n", nil
+	})
+	execInstance = fakeExecutor
+
+	sb := strings.Builder{}
+	repos, err := NewRealGitHub().ListOrgRepos(&sb, ".", "org")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"org/repo1", "org/repo2"}, repos)
+
+	fakeExecutor.AssertCalledWith(t, [][]string{
+		{".", "gh", "repo", "list", "org", "--no-archived", "--limit", "10000", "--json", "nameWithOwner", "--jq", ".[].nameWithOwner"},
+	})
+}
+
+func TestItListsOrgReposFromOtherHosts(t *testing.T) {
+	fakeExecutor := executor.NewFakeExecutor(func(workingDir string, name string, args ...string) error {
+		return nil
+	}, func(workingDir string, name string, args ...string) (string, error) {
+		return "org/repo1\norg/repo2\n", nil
+	})
+	execInstance = fakeExecutor
+
+	sb := strings.Builder{}
+	repos, err := NewRealGitHub().ListOrgRepos(&sb, ".", "github.example.com/org")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"github.example.com/org/repo1", "github.example.com/org/repo2"}, repos)
+
+	fakeExecutor.AssertCalledWith(t, [][]string{
+		{".", "gh", "api", "--hostname", "github.example.com", "--paginate", "orgs/org/repos", "--jq", ".[] | select(.archived | not) | .full_name"},
+	})
+}
+
+func TestItLeavesACommentWhenClosingAPR(t *testing.T) {
+	fakeExecutor := executor.NewFakeExecutor(func(workingDir string, name string, args ...string) error {
+		return nil
+	}, func(workingDir string, name string, args ...string) (string, error) {
+		return `{"currentBranch": {"number": 7}}`, nil
+	})
+	execInstance = fakeExecutor
+
+	err := NewRealGitHub().ClosePullRequest(&strings.Builder{}, "work/org/repo1", "my-branch", "No longer needed")
+	assert.NoError(t, err)
+
+	fakeExecutor.AssertCalledWith(t, [][]string{
+		{"work/org/repo1", "gh", "pr", "status", "--json", "closed,createdAt,headRefName,id,mergeable,number,reactionGroups,reviewDecision,reviews,state,title,updatedAt,url"},
+		{"work/org/repo1", "gh", "pr", "close", "7", "--comment", "No longer needed"},
+	})
+}
+
+func TestItCommentsOnAPR(t *testing.T) {
+	fakeExecutor := executor.NewFakeExecutor(func(workingDir string, name string, args ...string) error {
+		return nil
+	}, func(workingDir string, name string, args ...string) (string, error) {
+		return `{"currentBranch": {"number": 7}}`, nil
+	})
+	execInstance = fakeExecutor
+
+	err := NewRealGitHub().CommentOnPullRequest(&strings.Builder{}, "work/org/repo1", "my-branch", "Please take a look")
+	assert.NoError(t, err)
+
+	fakeExecutor.AssertCalledWith(t, [][]string{
+		{"work/org/repo1", "gh", "pr", "status", "--json", "closed,createdAt,headRefName,id,mergeable,number,reactionGroups,reviewDecision,reviews,state,title,updatedAt,url"},
+		{"work/org/repo1", "gh", "pr", "comment", "7", "--body", "Please take a look"},
+	})
+}
+
+func TestItCreatesIssues(t *testing.T) {
+	fakeExecutor := executor.NewFakeExecutor(func(workingDir string, name string, args ...string) error {
+		return nil
+	}, func(workingDir string, name string, args ...string) (string, error) {
+		return "\nCreating issue in org/repo1\n\nhttps://github.com/org/repo1/issues/42\n", nil
+	})
+	execInstance = fakeExecutor
+
+	issue, err := NewRealGitHub().CreateIssue(&strings.Builder{}, ".", Issue{
+		Title:     "Please migrate",
+		Body:      "Details",
+		Repo:      "org/repo1",
+		Labels:    []string{"migration", "platform"},
+		Assignees: []string{"alice"},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, &CreatedIssue{Number: 42, Url: "https://github.com/org/repo1/issues/42"}, issue)
+
+	fakeExecutor.AssertCalledWith(t, [][]string{
+		{".", "gh", "issue", "create", "--repo", "org/repo1", "--title", "Please migrate", "--body", "Details", "--label", "migration", "--label", "platform", "--assignee", "alice"},
+	})
+}
+
+func TestItReviewsPRs(t *testing.T) {
+	fakeExecutor := executor.NewFakeExecutor(func(workingDir string, name string, args ...string) error {
+		return nil
+	}, func(workingDir string, name string, args ...string) (string, error) {
+		return `{"currentBranch": {"number": 7}}`, nil
+	})
+	execInstance = fakeExecutor
+
+	assert.NoError(t, NewRealGitHub().ReviewPullRequest(&strings.Builder{}, "work/org/repo1", "my-branch", true, ""))
+	assert.NoError(t, NewRealGitHub().ReviewPullRequest(&strings.Builder{}, "work/org/repo1", "my-branch", false, "Looks good, but see the docs"))
+
+	fakeExecutor.AssertCalledWith(t, [][]string{
+		{"work/org/repo1", "gh", "pr", "status", "--json", "closed,createdAt,headRefName,id,mergeable,number,reactionGroups,reviewDecision,reviews,state,title,updatedAt,url"},
+		{"work/org/repo1", "gh", "pr", "review", "7", "--approve"},
+		{"work/org/repo1", "gh", "pr", "status", "--json", "closed,createdAt,headRefName,id,mergeable,number,reactionGroups,reviewDecision,reviews,state,title,updatedAt,url"},
+		{"work/org/repo1", "gh", "pr", "review", "7", "--comment", "--body", "Looks good, but see the docs"},
+	})
+}
+
+func TestItGetsThePROfAnotherBranch(t *testing.T) {
+	fakeExecutor := executor.NewFakeExecutor(func(workingDir string, name string, args ...string) error {
+		return nil
+	}, func(workingDir string, name string, args ...string) (string, error) {
+		return `[{"headRefName":"campaign-docs","number":8,"state":"OPEN","url":"https://github.com/org/repo1/pull/8"}]`, nil
+	})
+	execInstance = fakeExecutor
+
+	pr, err := NewRealGitHub().GetPRForBranch(&strings.Builder{}, "work/org/repo1", "campaign-docs")
+	assert.NoError(t, err)
+	assert.Equal(t, 8, pr.Number)
+	assert.Equal(t, "OPEN", pr.State)
+
+	fakeExecutor.AssertCalledWith(t, [][]string{
+		{"work/org/repo1", "gh", "pr", "list", "--head", "campaign-docs", "--state", "all", "--limit", "1", "--json", prStatusFields},
+	})
+}
+
+func TestItFindsNoPRForABranchWithoutOne(t *testing.T) {
+	execInstance = executor.NewFakeExecutor(func(workingDir string, name string, args ...string) error {
+		return nil
+	}, func(workingDir string, name string, args ...string) (string, error) {
+		return "[]", nil
+	})
+
+	_, err := NewRealGitHub().GetPRForBranch(&strings.Builder{}, "work/org/repo1", "campaign-docs")
+	var noPRFoundError *NoPRFoundError
+	assert.True(t, errors.As(err, &noPRFoundError))
+}
+
+func TestItGetsRateLimits(t *testing.T) {
+	fakeExecutor := executor.NewFakeExecutor(func(workingDir string, name string, args ...string) error {
+		return nil
+	}, func(workingDir string, name string, args ...string) (string, error) {
+		return `{"core":{"limit":5000,"used":10,"remaining":4990,"reset":1609506000},"graphql":{"limit":5000,"used":0,"remaining":5000,"reset":1609506000}}`, nil
+	})
+	execInstance = fakeExecutor
+
+	sb := strings.Builder{}
+	limits, err := NewRealGitHub().GetRateLimits(&sb, ".")
+	assert.NoError(t, err)
+	assert.Equal(t, 4990, limits.Core.Remaining)
+	assert.Equal(t, 5000, limits.GraphQL.Limit)
+	assert.Equal(t, int64(1609506000), limits.GraphQL.ResetTime().Unix())
+
+	fakeExecutor.AssertCalledWith(t, [][]string{
+		{".", "gh", "api", "rate_limit", "--jq", ".resources"},
+	})
+}
+
+func TestItListsTeamRepos(t *testing.T) {
+	fakeExecutor := executor.NewFakeExecutor(func(workingDir string, name string, args ...string) error {
+		return nil
+	}, func(workingDir string, name string, args ...string) (string, error) {
+		return "org/repo1\norg/repo2\n", nil
+	})
+	execInstance = fakeExecutor
+
+	sb := strings.Builder{}
+	repos, err := NewRealGitHub().ListTeamRepos(&sb, ".", "org", "team")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"org/repo1", "org/repo2"}, repos)
+
+	fakeExecutor.AssertCalledWith(t, [][]string{
+		{".", "gh", "api", "--paginate", "orgs/org/teams/team/repos", "--jq", ".[] | select(.archived | not) | select(.permissions.admin or .permissions.maintain) | .full_name"},
+	})
+}
+
+func TestItRevertsPullRequests(t *testing.T) {
+	fakeExecutor := executor.NewFakeExecutor(func(workingDir string, name string, args ...string) error {
+		return nil
+	}, func(workingDir string, name string, args ...string) (string, error) {
+		return "https://github.com/org/repo1/pull/2\n", nil
+	})
+	execInstance = fakeExecutor
+
+	sb := strings.Builder{}
+	revertUrl, err := NewRealGitHub().RevertPullRequest(&sb, "work/org/repo1", &PrStatus{Id: "PR_id1"})
+	assert.NoError(t, err)
+	assert.Equal(t, "https://github.com/org/repo1/pull/2", revertUrl)
+
+	fakeExecutor.AssertCalledWith(t, [][]string{
+		{"work/org/repo1", "gh", "api", "graphql", "-f", "query=mutation($id: ID!) { revertPullRequest(input: {pullRequestId: $id}) { revertPullRequest { url } } }", "-f", "id=PR_id1", "--jq", ".data.revertPullRequest.revertPullRequest.url"},
+	})
+}
+
+func TestItRenamesBranches(t *testing.T) {
+	fakeExecutor := executor.NewAlwaysSucceedsFakeExecutor()
+	execInstance = fakeExecutor
+
+	sb := strings.Builder{}
+	assert.NoError(t, NewRealGitHub().RenameBranch(&sb, "work/org/repo1", "org/repo1", "old", "new"))
+	assert.NoError(t, NewRealGitHub().RenameBranch(&sb, "work/org/repo2", "mygitserver.com/org/repo2", "old", "new"))
+
+	fakeExecutor.AssertCalledWith(t, [][]string{
+		{"work/org/repo1", "gh", "api", "--method", "POST", "repos/org/repo1/branches/old/rename", "-f", "new_name=new"},
+		{"work/org/repo2", "gh", "api", "--method", "POST", "repos/org/repo2/branches/old/rename", "-f", "new_name=new", "--hostname", "mygitserver.com"},
+	})
+}
+
+func TestItUpdatesPRDescriptions(t *testing.T) {
+	fakeExecutor := executor.NewFakeExecutor(func(workingDir string, name string, args ...string) error {
+		return nil
+	}, func(workingDir string, name string, args ...string) (string, error) {
+		return `{"currentBranch": {"number": 12, "state": "OPEN"}}`, nil
+	})
+	execInstance = fakeExecutor
+
+	sb := strings.Builder{}
+	err := NewRealGitHub().UpdatePRDescription(&sb, "work/org/repo1", "campaign", "New title", "New body")
+	assert.NoError(t, err)
+
+	fakeExecutor.AssertCalledWith(t, [][]string{
+		{"work/org/repo1", "gh", "pr", "status", "--json", "closed,createdAt,headRefName,id,mergeable,number,reactionGroups,reviewDecision,reviews,state,title,updatedAt,url"},
+		{"work/org/repo1", "gh", "pr", "edit", "12", "--title", "New title", "--body", "New body"},
+	})
+}
+
 func runForkAndCloneAndCaptureOutput() (string, error) {
 	sb := strings.Builder{}
 	err := NewRealGitHub().ForkAndClone(&sb, "work/org", "org/repo1")
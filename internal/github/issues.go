@@ -0,0 +1,64 @@
+/*
+ * Copyright 2021 Skyscanner Limited.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * https://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package github
+
+import (
+	"fmt"
+	"io"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// Issue is the metadata of an issue to be opened in a repository
+type Issue struct {
+	Title     string
+	Body      string
+	Repo      string
+	Labels    []string
+	Assignees []string
+}
+
+// CreatedIssue identifies an issue which has been opened
+type CreatedIssue struct {
+	Number int    `json:"number"`
+	Url    string `json:"url"`
+}
+
+// CreateIssue opens an issue in the repository, returning its number and URL
+func (r *RealGitHub) CreateIssue(output io.Writer, workingDir string, issue Issue) (*CreatedIssue, error) {
+	ghArgs := []string{"issue", "create", "--repo", issue.Repo, "--title", issue.Title, "--body", issue.Body}
+	for _, label := range issue.Labels {
+		ghArgs = append(ghArgs, "--label", label)
+	}
+	for _, assignee := range issue.Assignees {
+		ghArgs = append(ghArgs, "--assignee", assignee)
+	}
+
+	response, err := execInstance.ExecuteAndCapture(output, workingDir, "gh", ghArgs...)
+	if err != nil {
+		return nil, err
+	}
+
+	// gh prints the URL of the new issue as the last line of its output
+	lines := strings.Split(strings.TrimSpace(response), "\n")
+	url := strings.TrimSpace(lines[len(lines)-1])
+	number, err := strconv.Atoi(path.Base(url))
+	if err != nil {
+		return nil, fmt.Errorf("unable to find the number of the new issue in: %s", url)
+	}
+	return &CreatedIssue{Number: number, Url: url}, nil
+}
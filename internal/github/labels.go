@@ -0,0 +1,63 @@
+/*
+ * Copyright 2021 Skyscanner Limited.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * https://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package github
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Labels which turbolift creates are given this colour and description unless others are chosen
+const (
+	DefaultLabelColor       = "5319e7"
+	DefaultLabelDescription = "Part of a change made across many repositories with turbolift"
+)
+
+type Label struct {
+	Name        string
+	Color       string
+	Description string
+}
+
+// EnsureLabel creates the label in the repository unless a label with the same name already exists there, in which
+// case it is left as it is. It returns whether the label was created.
+func (r *RealGitHub) EnsureLabel(output io.Writer, workingDir string, fullRepoName string, label Label) (created bool, err error) {
+	execOutput, err := execInstance.ExecuteAndCapture(output, workingDir, "gh", "label", "create", label.Name, "--repo", fullRepoName, "--color", label.Color, "--description", label.Description)
+	if strings.Contains(execOutput, "already exists") {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// UpdatePRLabels adds and removes labels on the PR from the branch
+func (r *RealGitHub) UpdatePRLabels(output io.Writer, workingDir string, branchName string, add []string, remove []string) error {
+	pr, err := r.GetPR(output, workingDir, branchName)
+	if err != nil {
+		return err
+	}
+
+	ghArgs := []string{"pr", "edit", fmt.Sprint(pr.Number)}
+	for _, label := range add {
+		ghArgs = append(ghArgs, "--add-label", label)
+	}
+	for _, label := range remove {
+		ghArgs = append(ghArgs, "--remove-label", label)
+	}
+	return execInstance.Execute(output, workingDir, "gh", ghArgs...)
+}
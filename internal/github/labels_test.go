@@ -0,0 +1,68 @@
+/*
+ * Copyright 2021 Skyscanner Limited.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * https://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package github
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/skyscanner/turbolift/internal/executor"
+)
+
+func TestItCreatesMissingLabels(t *testing.T) {
+	fakeExecutor := executor.NewAlwaysSucceedsFakeExecutor()
+	execInstance = fakeExecutor
+
+	created, err := NewRealGitHub().EnsureLabel(&strings.Builder{}, ".", "org/repo1", Label{Name: "migration", Color: DefaultLabelColor, Description: "A migration"})
+	assert.NoError(t, err)
+	assert.True(t, created)
+
+	fakeExecutor.AssertCalledWith(t, [][]string{
+		{".", "gh", "label", "create", "migration", "--repo", "org/repo1", "--color", DefaultLabelColor, "--description", "A migration"},
+	})
+}
+
+func TestItLeavesExistingLabelsAsTheyAre(t *testing.T) {
+	execInstance = executor.NewFakeExecutor(func(workingDir string, name string, args ...string) error {
+		return nil
+	}, func(workingDir string, name string, args ...string) (string, error) {
+		return "label with name \"migration\" already exists; use `--force` to update its color and description", errors.New("exit status 1")
+	})
+
+	created, err := NewRealGitHub().EnsureLabel(&strings.Builder{}, ".", "org/repo1", Label{Name: "migration"})
+	assert.NoError(t, err)
+	assert.False(t, created)
+}
+
+func TestItUpdatesPRLabels(t *testing.T) {
+	fakeExecutor := executor.NewFakeExecutor(func(workingDir string, name string, args ...string) error {
+		return nil
+	}, func(workingDir string, name string, args ...string) (string, error) {
+		return `{"currentBranch": {"number": 7}}`, nil
+	})
+	execInstance = fakeExecutor
+
+	err := NewRealGitHub().UpdatePRLabels(&strings.Builder{}, "work/org/repo1", "my-branch", []string{"migration"}, []string{"wip", "blocked"})
+	assert.NoError(t, err)
+
+	fakeExecutor.AssertCalledWith(t, [][]string{
+		{"work/org/repo1", "gh", "pr", "status", "--json", "closed,createdAt,headRefName,id,mergeable,number,reactionGroups,reviewDecision,reviews,state,title,updatedAt,url"},
+		{"work/org/repo1", "gh", "pr", "edit", "7", "--add-label", "migration", "--remove-label", "wip", "--remove-label", "blocked"},
+	})
+}
@@ -0,0 +1,55 @@
+/*
+ * Copyright 2021 Skyscanner Limited.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * https://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package github
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// MergeMethods are the ways that a PR can be merged, as accepted by MergePullRequest
+var MergeMethods = []string{"merge", "squash", "rebase"}
+
+const enqueuePullRequestMutation = `mutation($id: ID!) {
+  enqueuePullRequest(input: {pullRequestId: $id}) {
+    mergeQueueEntry { position state }
+  }
+}`
+
+// MergePullRequest merges the PR directly, using one of the MergeMethods
+func (r *RealGitHub) MergePullRequest(output io.Writer, workingDir string, pr *PrStatus, method string) error {
+	return execInstance.Execute(output, workingDir, "gh", "pr", "merge", fmt.Sprint(pr.Number), "--"+method)
+}
+
+// EnableAutoMerge has GitHub merge the PR, using one of the MergeMethods, once its requirements are met
+func (r *RealGitHub) EnableAutoMerge(output io.Writer, workingDir string, pr *PrStatus, method string) error {
+	return execInstance.Execute(output, workingDir, "gh", "pr", "merge", fmt.Sprint(pr.Number), "--auto", "--"+method)
+}
+
+// EnqueuePullRequest adds the PR to its base branch's merge queue, returning its place in the queue
+func (r *RealGitHub) EnqueuePullRequest(output io.Writer, workingDir string, pr *PrStatus) (*MergeQueueEntry, error) {
+	response, err := execInstance.ExecuteAndCapture(output, workingDir, "gh", "api", "graphql", "-f", "query="+enqueuePullRequestMutation, "-f", "id="+pr.Id, "--jq", ".data.enqueuePullRequest.mergeQueueEntry")
+	if err != nil {
+		return nil, err
+	}
+
+	var entry MergeQueueEntry
+	if err := json.Unmarshal([]byte(response), &entry); err != nil {
+		return nil, fmt.Errorf("unable to parse merge queue entry: %w", err)
+	}
+	return &entry, nil
+}
@@ -0,0 +1,54 @@
+/*
+ * Copyright 2021 Skyscanner Limited.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * https://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package github
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/skyscanner/turbolift/internal/executor"
+)
+
+func TestItMergesPRs(t *testing.T) {
+	fakeExecutor := executor.NewAlwaysSucceedsFakeExecutor()
+	execInstance = fakeExecutor
+
+	err := NewRealGitHub().MergePullRequest(&strings.Builder{}, "work/org/repo1", &PrStatus{Number: 7}, "squash")
+	assert.NoError(t, err)
+
+	fakeExecutor.AssertCalledWith(t, [][]string{
+		{"work/org/repo1", "gh", "pr", "merge", "7", "--squash"},
+	})
+}
+
+func TestItEnqueuesPRs(t *testing.T) {
+	fakeExecutor := executor.NewFakeExecutor(func(workingDir string, name string, args ...string) error {
+		return nil
+	}, func(workingDir string, name string, args ...string) (string, error) {
+		return `{"position": 3, "state": "QUEUED"}`, nil
+	})
+	execInstance = fakeExecutor
+
+	entry, err := NewRealGitHub().EnqueuePullRequest(&strings.Builder{}, "work/org/repo1", &PrStatus{Id: "PR_1"})
+	assert.NoError(t, err)
+	assert.Equal(t, &MergeQueueEntry{Position: 3, State: "QUEUED"}, entry)
+
+	fakeExecutor.AssertCalledWith(t, [][]string{
+		{"work/org/repo1", "gh", "api", "graphql", "-f", "query=" + enqueuePullRequestMutation, "-f", "id=PR_1", "--jq", ".data.enqueuePullRequest.mergeQueueEntry"},
+	})
+}
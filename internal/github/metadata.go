@@ -0,0 +1,76 @@
+/*
+ * Copyright 2021 Skyscanner Limited.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * https://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package github
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+)
+
+// RepoMetadata are the attributes of a repository which a campaign can be narrowed down by
+type RepoMetadata struct {
+	Archived      bool      `json:"archived"`
+	Topics        []string  `json:"topics,omitempty"`
+	Language      string    `json:"language,omitempty"`
+	PushedAt      time.Time `json:"pushedAt"`
+	DefaultBranch string    `json:"defaultBranch"`
+}
+
+// repoViewMetadata is the output of gh repo view for the fields of RepoMetadata
+type repoViewMetadata struct {
+	IsArchived       bool `json:"isArchived"`
+	RepositoryTopics []struct {
+		Name string `json:"name"`
+	} `json:"repositoryTopics"`
+	PrimaryLanguage *struct {
+		Name string `json:"name"`
+	} `json:"primaryLanguage"`
+	PushedAt         time.Time `json:"pushedAt"`
+	DefaultBranchRef struct {
+		Name string `json:"name"`
+	} `json:"defaultBranchRef"`
+}
+
+// GetRepoMetadata fetches the attributes of a repository, given as org/repo or host/org/repo
+func (r *RealGitHub) GetRepoMetadata(output io.Writer, workingDir string, fullRepoName string) (*RepoMetadata, error) {
+	response, err := execInstance.ExecuteAndCapture(output, workingDir, "gh", "repo", "view", fullRepoName, "--json", "isArchived,repositoryTopics,primaryLanguage,pushedAt,defaultBranchRef")
+	if err != nil {
+		return nil, err
+	}
+	return parseRepoMetadata(response)
+}
+
+func parseRepoMetadata(response string) (*RepoMetadata, error) {
+	var parsed repoViewMetadata
+	if err := json.Unmarshal([]byte(response), &parsed); err != nil {
+		return nil, fmt.Errorf("unable to parse the repository's metadata: %w", err)
+	}
+
+	metadata := &RepoMetadata{
+		Archived:      parsed.IsArchived,
+		PushedAt:      parsed.PushedAt,
+		DefaultBranch: parsed.DefaultBranchRef.Name,
+	}
+	for _, topic := range parsed.RepositoryTopics {
+		metadata.Topics = append(metadata.Topics, topic.Name)
+	}
+	if parsed.PrimaryLanguage != nil {
+		metadata.Language = parsed.PrimaryLanguage.Name
+	}
+	return metadata, nil
+}
@@ -0,0 +1,59 @@
+/*
+ * Copyright 2021 Skyscanner Limited.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * https://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package github
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/skyscanner/turbolift/internal/executor"
+)
+
+func TestItFetchesRepoMetadata(t *testing.T) {
+	fakeExecutor := executor.NewFakeExecutor(nil, func(string, string, ...string) (string, error) {
+		return `{"defaultBranchRef":{"name":"main"},"isArchived":false,"primaryLanguage":{"name":"Go"},` +
+			`"pushedAt":"2024-03-01T10:00:00Z","repositoryTopics":[{"name":"payments"},{"name":"platform"}]}`, nil
+	})
+	execInstance = fakeExecutor
+
+	metadata, err := NewRealGitHub().GetRepoMetadata(bytes.NewBufferString(""), ".", "org/repo1")
+	assert.NoError(t, err)
+	assert.Equal(t, &RepoMetadata{
+		Topics:        []string{"payments", "platform"},
+		Language:      "Go",
+		PushedAt:      time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC),
+		DefaultBranch: "main",
+	}, metadata)
+
+	fakeExecutor.AssertCalledWith(t, [][]string{
+		{".", "gh", "repo", "view", "org/repo1", "--json", "isArchived,repositoryTopics,primaryLanguage,pushedAt,defaultBranchRef"},
+	})
+}
+
+func TestItFetchesMetadataOfEmptyArchivedRepos(t *testing.T) {
+	execInstance = executor.NewFakeExecutor(nil, func(string, string, ...string) (string, error) {
+		return `{"defaultBranchRef":{"name":"master"},"isArchived":true,"primaryLanguage":null,"pushedAt":"2019-01-01T00:00:00Z","repositoryTopics":null}`, nil
+	})
+
+	metadata, err := NewRealGitHub().GetRepoMetadata(bytes.NewBufferString(""), ".", "org/repo1")
+	assert.NoError(t, err)
+	assert.True(t, metadata.Archived)
+	assert.Empty(t, metadata.Topics)
+	assert.Empty(t, metadata.Language)
+}
@@ -0,0 +1,518 @@
+/*
+ * Copyright 2021 Skyscanner Limited.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * https://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package github
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/skyscanner/turbolift/internal/audit"
+)
+
+// OfflineLedgerFilename is where the offline forge records the PRs, issues and labels that would have been created,
+// kept in the campaign directory
+const OfflineLedgerFilename = "offline-ledger.json"
+
+// offlineUrlHost is used in the URLs of offline PRs and issues, and is reserved so that it can never resolve
+const offlineUrlHost = "offline.invalid"
+
+var errNotAvailableOffline = errors.New("not available in offline mode")
+
+// OfflineGitHub is a stand-in for GitHub used to rehearse campaigns. Repositories are cloned from local mirrors,
+// laid out as MIRRORS/org/repo, so that branches are pushed to the mirrors rather than to GitHub. PRs, issues and labels
+// are recorded in a ledger file instead of being created.
+type OfflineGitHub struct {
+	mirrorsDir string
+	mutex      sync.Mutex
+}
+
+// Ledger is everything that the offline forge has recorded for a campaign
+type Ledger struct {
+	PullRequests []*LedgerPullRequest `json:"pullRequests"`
+	Issues       []*LedgerIssue       `json:"issues"`
+	// Labels maps each repository to the labels created in it
+	Labels map[string][]string `json:"labels"`
+}
+
+type LedgerPullRequest struct {
+	Repo      string    `json:"repo"`
+	Branch    string    `json:"branch"`
+	Number    int       `json:"number"`
+	Url       string    `json:"url"`
+	State     string    `json:"state"`
+	Title     string    `json:"title"`
+	Body      string    `json:"body"`
+	IsDraft   bool      `json:"isDraft,omitempty"`
+	Labels    []string  `json:"labels,omitempty"`
+	Reviewers []string  `json:"reviewers,omitempty"`
+	Assignees []string  `json:"assignees,omitempty"`
+	Comments  []string  `json:"comments,omitempty"`
+	Reviews   []Review  `json:"reviews,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+type LedgerIssue struct {
+	Repo      string   `json:"repo"`
+	Number    int      `json:"number"`
+	Url       string   `json:"url"`
+	Title     string   `json:"title"`
+	Body      string   `json:"body"`
+	Labels    []string `json:"labels,omitempty"`
+	Assignees []string `json:"assignees,omitempty"`
+}
+
+func NewOfflineGitHub(mirrorsDir string) (*OfflineGitHub, error) {
+	absMirrorsDir, err := filepath.Abs(mirrorsDir)
+	if err != nil {
+		return nil, err
+	}
+	if info, err := os.Stat(absMirrorsDir); err != nil || !info.IsDir() {
+		return nil, fmt.Errorf("offline mirrors directory %s does not exist", mirrorsDir)
+	}
+	return &OfflineGitHub{mirrorsDir: absMirrorsDir}, nil
+}
+
+// ReadLedger reads the offline ledger of the campaign in the current directory, which is empty if nothing has
+// been recorded yet
+func ReadLedger() (*Ledger, error) {
+	ledger := &Ledger{Labels: map[string][]string{}}
+	contents, err := ioutil.ReadFile(OfflineLedgerFilename)
+	if errors.Is(err, os.ErrNotExist) {
+		return ledger, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("unable to read the offline ledger: %w", err)
+	}
+	if err := json.Unmarshal(contents, ledger); err != nil {
+		return nil, fmt.Errorf("unable to parse the offline ledger: %w", err)
+	}
+	if ledger.Labels == nil {
+		ledger.Labels = map[string][]string{}
+	}
+	return ledger, nil
+}
+
+func writeLedger(ledger *Ledger) error {
+	contents, err := json.MarshalIndent(ledger, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(OfflineLedgerFilename, append(contents, '\n'), 0o644)
+}
+
+// updateLedger applies a change to the ledger, saving it unless the change fails
+func (o *OfflineGitHub) updateLedger(update func(ledger *Ledger) error) error {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+
+	ledger, err := ReadLedger()
+	if err != nil {
+		return err
+	}
+	if err := update(ledger); err != nil {
+		return err
+	}
+	return writeLedger(ledger)
+}
+
+// latestPR is the most recent PR from the branch of the repository whose working copy is at workingDir
+func (l *Ledger) latestPR(workingDir string, branchName string) (*LedgerPullRequest, error) {
+	repo := audit.RepoOf(workingDir)
+	for i := len(l.PullRequests) - 1; i >= 0; i-- {
+		if pr := l.PullRequests[i]; pr.Repo == repo && pr.Branch == branchName {
+			return pr, nil
+		}
+	}
+	return nil, &NoPRFoundError{Path: workingDir, BranchName: branchName}
+}
+
+func (l *Ledger) addPR(pr *LedgerPullRequest) {
+	pr.Number = 1
+	for _, other := range l.PullRequests {
+		if other.Repo == pr.Repo && other.Number >= pr.Number {
+			pr.Number = other.Number + 1
+		}
+	}
+	pr.Url = fmt.Sprintf("https://%s/%s/pull/%d", offlineUrlHost, pr.Repo, pr.Number)
+	pr.CreatedAt = time.Now().UTC()
+	pr.UpdatedAt = pr.CreatedAt
+	l.PullRequests = append(l.PullRequests, pr)
+}
+
+func (pr *LedgerPullRequest) status() *PrStatus {
+	reviewDecision := "REVIEW_REQUIRED"
+	for _, review := range pr.Reviews {
+		if review.State == "APPROVED" {
+			reviewDecision = "APPROVED"
+		}
+	}
+	return &PrStatus{
+		Closed:         pr.State != "OPEN",
+		CreatedAt:      pr.CreatedAt,
+		HeadRefName:    pr.Branch,
+		Id:             fmt.Sprintf("OFFLINE_%s#%d", pr.Repo, pr.Number),
+		Mergeable:      "MERGEABLE",
+		Number:         pr.Number,
+		ReviewDecision: reviewDecision,
+		State:          pr.State,
+		Title:          pr.Title,
+		UpdatedAt:      pr.UpdatedAt,
+		Url:            pr.Url,
+		Reviews:        pr.Reviews,
+	}
+}
+
+func (o *OfflineGitHub) mirrorPath(fullRepoName string) string {
+	return filepath.Join(o.mirrorsDir, filepath.FromSlash(fullRepoName))
+}
+
+// checkWorkingCopies makes sure that every working copy in workDir was cloned from the mirrors, as git pushes from a
+// working copy cloned from GitHub would still go to GitHub
+func (o *OfflineGitHub) checkWorkingCopies(workDir string) error {
+	// working copies are at work/org/repo, or at work/host/org/repo for other hosts
+	gitDirs, _ := filepath.Glob(filepath.Join(workDir, "*", "*", ".git"))
+	hostGitDirs, _ := filepath.Glob(filepath.Join(workDir, "*", "*", "*", ".git"))
+
+	for _, gitDir := range append(gitDirs, hostGitDirs...) {
+		workingCopy := filepath.Dir(gitDir)
+		remotes, err := execInstance.ExecuteAndCapture(ioutil.Discard, workingCopy, "git", "remote", "-v")
+		if err != nil {
+			return fmt.Errorf("unable to check the remotes of %s: %w", workingCopy, err)
+		}
+		for _, line := range strings.Split(remotes, "\n") {
+			fields := strings.Fields(line)
+			if len(fields) < 2 {
+				continue
+			}
+			if !o.isMirror(fields[1]) {
+				return fmt.Errorf("%s was cloned from %s rather than from the offline mirrors, so branches would be pushed there - remove the working copies and clone again with --offline, or run without --offline", workingCopy, fields[1])
+			}
+		}
+	}
+	return nil
+}
+
+// isMirror reports whether a remote's URL is within the mirrors directory
+func (o *OfflineGitHub) isMirror(url string) bool {
+	url = strings.TrimPrefix(url, "file://")
+	if !filepath.IsAbs(url) {
+		return false
+	}
+	mirrorsDir := o.mirrorsDir
+	if resolved, err := filepath.EvalSymlinks(mirrorsDir); err == nil {
+		mirrorsDir = resolved
+	}
+	if resolved, err := filepath.EvalSymlinks(url); err == nil {
+		url = resolved
+	}
+	rel, err := filepath.Rel(mirrorsDir, url)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+func (o *OfflineGitHub) ForkAndClone(output io.Writer, workingDir string, fullRepoName string, gitFlags ...string) error {
+	return o.Clone(output, workingDir, fullRepoName, gitFlags...)
+}
+
+func (o *OfflineGitHub) Clone(output io.Writer, workingDir string, fullRepoName string, gitFlags ...string) error {
+	args := append([]string{"clone"}, gitFlags...)
+	return execInstance.Execute(output, workingDir, "git", append(args, o.mirrorPath(fullRepoName), path.Base(fullRepoName))...)
+}
+
+func (o *OfflineGitHub) CreatePullRequest(output io.Writer, workingDir string, metadata PullRequest) (bool, error) {
+	branch := metadata.Head
+	if i := strings.LastIndex(branch, ":"); i >= 0 {
+		branch = branch[i+1:]
+	}
+	if branch == "" {
+		currentBranch, err := execInstance.ExecuteAndCapture(output, workingDir, "git", "rev-parse", "--abbrev-ref", "HEAD")
+		if err != nil {
+			return false, err
+		}
+		branch = strings.TrimSpace(currentBranch)
+	}
+
+	didCreate := false
+	err := o.updateLedger(func(ledger *Ledger) error {
+		if existing, err := ledger.latestPR(workingDir, branch); err == nil && existing.State == "OPEN" {
+			return nil
+		}
+		ledger.addPR(&LedgerPullRequest{
+			Repo:      audit.RepoOf(workingDir),
+			Branch:    branch,
+			State:     "OPEN",
+			Title:     metadata.Title,
+			Body:      metadata.Body,
+			IsDraft:   metadata.IsDraft,
+			Labels:    metadata.Labels,
+			Reviewers: metadata.Reviewers,
+			Assignees: metadata.Assignees,
+		})
+		didCreate = true
+		return nil
+	})
+	return didCreate, err
+}
+
+// updateOpenPR applies a change to the open PR from the branch
+func (o *OfflineGitHub) updateOpenPR(workingDir string, branchName string, update func(pr *LedgerPullRequest)) error {
+	return o.updateLedger(func(ledger *Ledger) error {
+		pr, err := ledger.latestPR(workingDir, branchName)
+		if err != nil {
+			return err
+		}
+		if pr.State != "OPEN" {
+			return fmt.Errorf("the PR from %s is %s", branchName, strings.ToLower(pr.State))
+		}
+		update(pr)
+		pr.UpdatedAt = time.Now().UTC()
+		return nil
+	})
+}
+
+func (o *OfflineGitHub) ClosePullRequest(_ io.Writer, workingDir string, branchName string, comment string) error {
+	return o.updateOpenPR(workingDir, branchName, func(pr *LedgerPullRequest) {
+		pr.State = "CLOSED"
+		if comment != "" {
+			pr.Comments = append(pr.Comments, comment)
+		}
+	})
+}
+
+func (o *OfflineGitHub) UpdatePRDescription(_ io.Writer, workingDir string, branchName string, title string, body string) error {
+	return o.updateOpenPR(workingDir, branchName, func(pr *LedgerPullRequest) {
+		pr.Title = title
+		pr.Body = body
+	})
+}
+
+func (o *OfflineGitHub) CommentOnPullRequest(_ io.Writer, workingDir string, branchName string, body string) error {
+	return o.updateOpenPR(workingDir, branchName, func(pr *LedgerPullRequest) {
+		pr.Comments = append(pr.Comments, body)
+	})
+}
+
+func (o *OfflineGitHub) ReviewPullRequest(_ io.Writer, workingDir string, branchName string, approve bool, body string) error {
+	return o.updateOpenPR(workingDir, branchName, func(pr *LedgerPullRequest) {
+		review := Review{State: "COMMENTED", Body: body, SubmittedAt: time.Now().UTC()}
+		if approve {
+			review.State = "APPROVED"
+		}
+		review.Author.Login = "offline"
+		pr.Reviews = append(pr.Reviews, review)
+	})
+}
+
+func (o *OfflineGitHub) UpdatePRLabels(_ io.Writer, workingDir string, branchName string, add []string, remove []string) error {
+	return o.updateOpenPR(workingDir, branchName, func(pr *LedgerPullRequest) {
+		var labels []string
+		for _, label := range pr.Labels {
+			if !contains(remove, label) && !contains(add, label) {
+				labels = append(labels, label)
+			}
+		}
+		pr.Labels = append(labels, add...)
+	})
+}
+
+func (o *OfflineGitHub) GetPR(_ io.Writer, workingDir string, branchName string) (*PrStatus, error) {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+
+	ledger, err := ReadLedger()
+	if err != nil {
+		return nil, err
+	}
+	pr, err := ledger.latestPR(workingDir, branchName)
+	if err != nil {
+		return nil, err
+	}
+	return pr.status(), nil
+}
+
+// GetPRForBranch is the same as GetPR, as the ledger records the branch each PR was raised from
+func (o *OfflineGitHub) GetPRForBranch(output io.Writer, workingDir string, branchName string) (*PrStatus, error) {
+	return o.GetPR(output, workingDir, branchName)
+}
+
+// GetPRs fetches nothing, leaving each PR to be looked up in the ledger, which is as quick as fetching them together
+func (o *OfflineGitHub) GetPRs(_ io.Writer, _ string, _ []PRRef) (map[PRRef]*PRDetails, error) {
+	return map[PRRef]*PRDetails{}, nil
+}
+
+func (o *OfflineGitHub) GetDefaultBranchName(output io.Writer, _ string, fullRepoName string) (string, error) {
+	branch, err := execInstance.ExecuteAndCapture(output, o.mirrorPath(fullRepoName), "git", "symbolic-ref", "--short", "HEAD")
+	return strings.TrimSpace(branch), err
+}
+
+// GetRepoMetadata describes a mirror, which is never archived and has no topics or language
+func (o *OfflineGitHub) GetRepoMetadata(output io.Writer, workingDir string, fullRepoName string) (*RepoMetadata, error) {
+	branch, err := o.GetDefaultBranchName(output, workingDir, fullRepoName)
+	if err != nil {
+		return nil, err
+	}
+	committed, err := execInstance.ExecuteAndCapture(output, o.mirrorPath(fullRepoName), "git", "log", "-1", "--format=%cI")
+	if err != nil {
+		return nil, err
+	}
+	pushedAt, _ := time.Parse(time.RFC3339, strings.TrimSpace(committed))
+	return &RepoMetadata{PushedAt: pushedAt, DefaultBranch: branch}, nil
+}
+
+func (o *OfflineGitHub) ListOrgRepos(_ io.Writer, _ string, orgName string) ([]string, error) {
+	// mirrors are laid out by org alone, whichever host the org is on
+	entries, err := ioutil.ReadDir(filepath.Join(o.mirrorsDir, path.Base(orgName)))
+	if err != nil {
+		return nil, fmt.Errorf("no mirrors found for org %s: %w", orgName, err)
+	}
+	var repos []string
+	for _, entry := range entries {
+		if entry.IsDir() {
+			repos = append(repos, orgName+"/"+entry.Name())
+		}
+	}
+	sort.Strings(repos)
+	return repos, nil
+}
+
+func (o *OfflineGitHub) ListTeamRepos(_ io.Writer, _ string, _ string, _ string) ([]string, error) {
+	return nil, fmt.Errorf("listing team repositories is %w", errNotAvailableOffline)
+}
+
+func (o *OfflineGitHub) RevertPullRequest(_ io.Writer, workingDir string, pr *PrStatus) (string, error) {
+	var revertUrl string
+	err := o.updateLedger(func(ledger *Ledger) error {
+		revert := &LedgerPullRequest{
+			Repo:   audit.RepoOf(workingDir),
+			Branch: fmt.Sprintf("revert-%d-%s", pr.Number, pr.HeadRefName),
+			State:  "OPEN",
+			Title:  fmt.Sprintf("Revert \"%s\"", pr.Title),
+			Body:   fmt.Sprintf("Reverts #%d", pr.Number),
+		}
+		ledger.addPR(revert)
+		revertUrl = revert.Url
+		return nil
+	})
+	return revertUrl, err
+}
+
+func (o *OfflineGitHub) RenameBranch(output io.Writer, workingDir string, fullRepoName string, branchName string, newBranchName string) error {
+	if err := execInstance.Execute(output, o.mirrorPath(fullRepoName), "git", "branch", "-m", branchName, newBranchName); err != nil {
+		return err
+	}
+	return o.updateLedger(func(ledger *Ledger) error {
+		for _, pr := range ledger.PullRequests {
+			if pr.Repo == audit.RepoOf(workingDir) && pr.Branch == branchName && pr.State == "OPEN" {
+				pr.Branch = newBranchName
+			}
+		}
+		return nil
+	})
+}
+
+func (o *OfflineGitHub) GetRateLimits(_ io.Writer, _ string) (*RateLimits, error) {
+	reset := time.Now().Add(time.Hour).Unix()
+	return &RateLimits{
+		Core:    RateLimit{Limit: 5000, Remaining: 5000, Reset: reset},
+		GraphQL: RateLimit{Limit: 5000, Remaining: 5000, Reset: reset},
+	}, nil
+}
+
+func (o *OfflineGitHub) GetMergeRequirements(_ io.Writer, _ string, pr *PrStatus) (*MergeRequirements, error) {
+	return &MergeRequirements{MergeStateStatus: "CLEAN", ReviewDecision: pr.ReviewDecision}, nil
+}
+
+// MergePullRequest records the PR as merged, but does not merge it into the mirror's default branch
+func (o *OfflineGitHub) MergePullRequest(_ io.Writer, workingDir string, pr *PrStatus, _ string) error {
+	return o.updateOpenPR(workingDir, pr.HeadRefName, func(pr *LedgerPullRequest) {
+		pr.State = "MERGED"
+	})
+}
+
+func (o *OfflineGitHub) CheckCapability(_ io.Writer, _ Capability) error {
+	return nil
+}
+
+func (o *OfflineGitHub) EnqueuePullRequest(_ io.Writer, _ string, _ *PrStatus) (*MergeQueueEntry, error) {
+	return nil, fmt.Errorf("merge queues are %w", errNotAvailableOffline)
+}
+
+func (o *OfflineGitHub) EnableAutoMerge(_ io.Writer, _ string, _ *PrStatus, _ string) error {
+	return fmt.Errorf("auto-merge is %w", errNotAvailableOffline)
+}
+
+func (o *OfflineGitHub) CreateIssue(_ io.Writer, _ string, issue Issue) (*CreatedIssue, error) {
+	var created *CreatedIssue
+	err := o.updateLedger(func(ledger *Ledger) error {
+		number := 1
+		for _, other := range ledger.Issues {
+			if other.Repo == issue.Repo && other.Number >= number {
+				number = other.Number + 1
+			}
+		}
+		created = &CreatedIssue{Number: number, Url: fmt.Sprintf("https://%s/%s/issues/%d", offlineUrlHost, issue.Repo, number)}
+		ledger.Issues = append(ledger.Issues, &LedgerIssue{
+			Repo:      issue.Repo,
+			Number:    number,
+			Url:       created.Url,
+			Title:     issue.Title,
+			Body:      issue.Body,
+			Labels:    issue.Labels,
+			Assignees: issue.Assignees,
+		})
+		return nil
+	})
+	return created, err
+}
+
+func (o *OfflineGitHub) GetProject(_ io.Writer, _ string, _ string, _ int) (*Project, error) {
+	return nil, fmt.Errorf("projects are %w", errNotAvailableOffline)
+}
+
+func (o *OfflineGitHub) AddToProject(_ io.Writer, _ string, _ *Project, _ string, _ string) error {
+	return fmt.Errorf("projects are %w", errNotAvailableOffline)
+}
+
+func (o *OfflineGitHub) EnsureLabel(_ io.Writer, _ string, fullRepoName string, label Label) (bool, error) {
+	created := false
+	err := o.updateLedger(func(ledger *Ledger) error {
+		if contains(ledger.Labels[fullRepoName], label.Name) {
+			return nil
+		}
+		ledger.Labels[fullRepoName] = append(ledger.Labels[fullRepoName], label.Name)
+		created = true
+		return nil
+	})
+	return created, err
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
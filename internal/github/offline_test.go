@@ -0,0 +1,140 @@
+/*
+ * Copyright 2021 Skyscanner Limited.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * https://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package github
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/skyscanner/turbolift/internal/executor"
+	"github.com/skyscanner/turbolift/internal/testsupport"
+)
+
+func TestItRehearsesPRsAgainstLocalMirrors(t *testing.T) {
+	execInstance = executor.NewRealExecutor()
+	testsupport.PrepareTempCampaign(false, "org/repo1")
+	createMirror(t, "mirrors/org/repo1")
+	createMirror(t, "mirrors/org/repo2")
+
+	offline, err := NewOfflineGitHub("mirrors")
+	assert.NoError(t, err)
+	output := &strings.Builder{}
+
+	assert.NoError(t, os.MkdirAll("work/org", 0o755))
+	assert.NoError(t, offline.Clone(output, "work/org", "org/repo1"))
+	runGit(t, "work/org/repo1", "checkout", "-b", "my-campaign")
+
+	defaultBranch, err := offline.GetDefaultBranchName(output, "work/org/repo1", "org/repo1")
+	assert.NoError(t, err)
+	assert.Equal(t, "main", defaultBranch)
+
+	repos, err := offline.ListOrgRepos(output, ".", "org")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"org/repo1", "org/repo2"}, repos)
+
+	_, err = offline.GetPR(output, "work/org/repo1", "my-campaign")
+	assert.IsType(t, &NoPRFoundError{}, err)
+
+	didCreate, err := offline.CreatePullRequest(output, "work/org/repo1", PullRequest{Title: "PR title", Body: "PR body", Labels: []string{"turbolift"}})
+	assert.NoError(t, err)
+	assert.True(t, didCreate)
+	didCreate, err = offline.CreatePullRequest(output, "work/org/repo1", PullRequest{Title: "PR title", Body: "PR body"})
+	assert.NoError(t, err)
+	assert.False(t, didCreate)
+
+	assert.NoError(t, offline.ReviewPullRequest(output, "work/org/repo1", "my-campaign", true, "LGTM"))
+	pr, err := offline.GetPR(output, "work/org/repo1", "my-campaign")
+	assert.NoError(t, err)
+	assert.Equal(t, "OPEN", pr.State)
+	assert.Equal(t, "APPROVED", pr.ReviewDecision)
+	assert.Equal(t, "https://offline.invalid/org/repo1/pull/1", pr.Url)
+
+	assert.NoError(t, offline.ClosePullRequest(output, "work/org/repo1", "my-campaign", "Not needed"))
+	pr, err = offline.GetPR(output, "work/org/repo1", "my-campaign")
+	assert.NoError(t, err)
+	assert.Equal(t, "CLOSED", pr.State)
+
+	ledger, err := ReadLedger()
+	assert.NoError(t, err)
+	assert.Len(t, ledger.PullRequests, 1)
+	assert.Equal(t, "org/repo1", ledger.PullRequests[0].Repo)
+	assert.Equal(t, []string{"turbolift"}, ledger.PullRequests[0].Labels)
+	assert.Equal(t, []string{"Not needed"}, ledger.PullRequests[0].Comments)
+}
+
+func TestItRefusesMissingMirrorDirectories(t *testing.T) {
+	testsupport.PrepareTempCampaign(false)
+
+	_, err := NewOfflineGitHub("mirrors")
+	assert.EqualError(t, err, "offline mirrors directory mirrors does not exist")
+}
+
+func TestNewGitHubUsesTheOfflineForgeOnceSet(t *testing.T) {
+	testsupport.PrepareTempCampaign(false)
+	assert.NoError(t, os.MkdirAll("mirrors", 0o755))
+
+	gh := NewGitHub().(*selectedGitHub)
+	assert.Equal(t, gh.real, gh.current())
+
+	assert.NoError(t, SetOffline("mirrors", "work"))
+	defer func() { offline = nil }()
+	assert.Equal(t, offline, gh.current())
+}
+
+func TestItRefusesToGoOfflineWithWorkingCopiesClonedFromElsewhere(t *testing.T) {
+	execInstance = executor.NewRealExecutor()
+	testsupport.PrepareTempCampaign(false, "org/repo1", "org/repo2")
+	createMirror(t, "mirrors/org/repo1")
+	createMirror(t, "elsewhere/org/repo2")
+	offlineGitHub, err := NewOfflineGitHub("mirrors")
+	assert.NoError(t, err)
+	assert.NoError(t, os.MkdirAll("work/org", 0o755))
+	assert.NoError(t, offlineGitHub.Clone(&strings.Builder{}, "work/org", "org/repo1"))
+
+	assert.NoError(t, SetOffline("mirrors", "work"))
+	offline = nil
+
+	elsewhere, err := filepath.Abs("elsewhere/org/repo2")
+	assert.NoError(t, err)
+	runGit(t, "work/org", "clone", "--quiet", elsewhere, "repo2")
+
+	err = SetOffline("mirrors", "work")
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), filepath.Join("work", "org", "repo2")+" was cloned from "+elsewhere+" rather than from the offline mirrors")
+	assert.Nil(t, offline)
+}
+
+func createMirror(t *testing.T, dir string) {
+	assert.NoError(t, os.MkdirAll(dir, 0o755))
+	runGit(t, dir, "init", "--quiet")
+	runGit(t, dir, "symbolic-ref", "HEAD", "refs/heads/main")
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "README.md"), []byte("# Mirror\n"), 0o644))
+	runGit(t, dir, "add", "README.md")
+	runGit(t, dir, "-c", "user.name=Turbolift", "-c", "user.email=turbolift@example.com", "commit", "--quiet", "-m", "Initial commit")
+}
+
+func runGit(t *testing.T, dir string, args ...string) {
+	command := exec.Command("git", args...)
+	command.Dir = dir
+	output, err := command.CombinedOutput()
+	assert.NoError(t, err, string(output))
+}
@@ -0,0 +1,114 @@
+/*
+ * Copyright 2021 Skyscanner Limited.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * https://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package github
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// statusFieldName is the name of the single select field which Projects (v2) use for an item's status
+const statusFieldName = "Status"
+
+// Project is a GitHub Project (v2), identified by its owner (an org or user) and number
+type Project struct {
+	Owner  string
+	Number int
+	Id     string
+	Fields []ProjectField
+}
+
+type ProjectField struct {
+	Id      string               `json:"id"`
+	Name    string               `json:"name"`
+	Options []ProjectFieldOption `json:"options"`
+}
+
+type ProjectFieldOption struct {
+	Id   string `json:"id"`
+	Name string `json:"name"`
+}
+
+// ParseProjectRef parses a project given as OWNER/NUMBER, e.g. skyscanner/12
+func ParseProjectRef(ref string) (owner string, number int, err error) {
+	i := strings.LastIndex(ref, "/")
+	if i > 0 {
+		number, err = strconv.Atoi(ref[i+1:])
+	}
+	if i <= 0 || err != nil || number <= 0 {
+		return "", 0, fmt.Errorf("invalid project %s - expected the form OWNER/NUMBER", ref)
+	}
+	return ref[:i], number, nil
+}
+
+// StatusOption returns the IDs of the status field and of its option with the given name (ignoring case)
+func (p *Project) StatusOption(status string) (fieldId string, optionId string, err error) {
+	for _, field := range p.Fields {
+		if field.Name != statusFieldName {
+			continue
+		}
+		var names []string
+		for _, option := range field.Options {
+			if strings.EqualFold(option.Name, status) {
+				return field.Id, option.Id, nil
+			}
+			names = append(names, option.Name)
+		}
+		return "", "", fmt.Errorf("project %s/%d has no status %s - the statuses are: %s", p.Owner, p.Number, status, strings.Join(names, ", "))
+	}
+	return "", "", fmt.Errorf("project %s/%d has no %s field", p.Owner, p.Number, statusFieldName)
+}
+
+func (r *RealGitHub) GetProject(output io.Writer, workingDir string, owner string, number int) (*Project, error) {
+	projectNumber := strconv.Itoa(number)
+	id, err := execInstance.ExecuteAndCapture(output, workingDir, "gh", "project", "view", projectNumber, "--owner", owner, "--format", "json", "--jq", ".id")
+	if err != nil {
+		return nil, err
+	}
+
+	fields, err := execInstance.ExecuteAndCapture(output, workingDir, "gh", "project", "field-list", projectNumber, "--owner", owner, "--format", "json")
+	if err != nil {
+		return nil, err
+	}
+	var response struct {
+		Fields []ProjectField `json:"fields"`
+	}
+	if err := json.Unmarshal([]byte(fields), &response); err != nil {
+		return nil, fmt.Errorf("unable to parse the fields of project %s/%d: %w", owner, number, err)
+	}
+
+	return &Project{Owner: owner, Number: number, Id: strings.TrimSpace(id), Fields: response.Fields}, nil
+}
+
+// AddToProject adds the issue or PR with the given URL to the project, then sets its status unless status is empty
+func (r *RealGitHub) AddToProject(output io.Writer, workingDir string, project *Project, url string, status string) error {
+	itemId, err := execInstance.ExecuteAndCapture(output, workingDir, "gh", "project", "item-add", strconv.Itoa(project.Number), "--owner", project.Owner, "--url", url, "--format", "json", "--jq", ".id")
+	if err != nil {
+		return err
+	}
+	if status == "" {
+		return nil
+	}
+
+	fieldId, optionId, err := project.StatusOption(status)
+	if err != nil {
+		return err
+	}
+	return execInstance.Execute(output, workingDir, "gh", "project", "item-edit", "--id", strings.TrimSpace(itemId), "--project-id", project.Id, "--field-id", fieldId, "--single-select-option-id", optionId)
+}
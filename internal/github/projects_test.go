@@ -0,0 +1,82 @@
+/*
+ * Copyright 2021 Skyscanner Limited.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * https://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package github
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/skyscanner/turbolift/internal/executor"
+)
+
+func TestItParsesProjectRefs(t *testing.T) {
+	owner, number, err := ParseProjectRef("skyscanner/12")
+	assert.NoError(t, err)
+	assert.Equal(t, "skyscanner", owner)
+	assert.Equal(t, 12, number)
+
+	for _, ref := range []string{"skyscanner", "/12", "skyscanner/", "skyscanner/twelve", "skyscanner/0"} {
+		_, _, err := ParseProjectRef(ref)
+		assert.EqualError(t, err, "invalid project "+ref+" - expected the form OWNER/NUMBER")
+	}
+}
+
+func TestItGetsProjectsAndAddsItemsWithAStatus(t *testing.T) {
+	fakeExecutor := executor.NewFakeExecutor(func(workingDir string, name string, args ...string) error {
+		return nil
+	}, func(workingDir string, name string, args ...string) (string, error) {
+		switch args[1] {
+		case "view":
+			return "PVT_abc\n", nil
+		case "field-list":
+			return `{"fields": [
+				{"id": "PVTF_title", "name": "Title", "type": "ProjectV2Field"},
+				{"id": "PVTSSF_status", "name": "Status", "type": "ProjectV2SingleSelectField", "options": [{"id": "f75ad846", "name": "Todo"}, {"id": "47fc9ee4", "name": "In Progress"}]}
+			], "totalCount": 2}`, nil
+		default:
+			return "PVTI_item\n", nil
+		}
+	})
+	execInstance = fakeExecutor
+
+	project, err := NewRealGitHub().GetProject(&strings.Builder{}, ".", "skyscanner", 12)
+	assert.NoError(t, err)
+	assert.Equal(t, "PVT_abc", project.Id)
+
+	err = NewRealGitHub().AddToProject(&strings.Builder{}, "work/org/repo1", project, "https://github.com/org/repo1/pull/3", "in progress")
+	assert.NoError(t, err)
+
+	fakeExecutor.AssertCalledWith(t, [][]string{
+		{".", "gh", "project", "view", "12", "--owner", "skyscanner", "--format", "json", "--jq", ".id"},
+		{".", "gh", "project", "field-list", "12", "--owner", "skyscanner", "--format", "json"},
+		{"work/org/repo1", "gh", "project", "item-add", "12", "--owner", "skyscanner", "--url", "https://github.com/org/repo1/pull/3", "--format", "json", "--jq", ".id"},
+		{"work/org/repo1", "gh", "project", "item-edit", "--id", "PVTI_item", "--project-id", "PVT_abc", "--field-id", "PVTSSF_status", "--single-select-option-id", "47fc9ee4"},
+	})
+}
+
+func TestItReportsUnknownStatuses(t *testing.T) {
+	project := &Project{Owner: "skyscanner", Number: 12, Fields: []ProjectField{
+		{Id: "PVTSSF_status", Name: "Status", Options: []ProjectFieldOption{{Id: "1", Name: "Todo"}, {Id: "2", Name: "Done"}}},
+	}}
+
+	_, _, err := project.StatusOption("Blocked")
+	assert.EqualError(t, err, "project skyscanner/12 has no status Blocked - the statuses are: Todo, Done")
+
+	_, _, err = (&Project{Owner: "skyscanner", Number: 12}).StatusOption("Todo")
+	assert.EqualError(t, err, "project skyscanner/12 has no Status field")
+}
@@ -0,0 +1,229 @@
+/*
+ * Copyright 2021 Skyscanner Limited.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * https://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package github
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// The mutating operations which are recorded for replay
+const (
+	OpCreatePullRequest    = "create-pull-request"
+	OpClosePullRequest     = "close-pull-request"
+	OpUpdatePRDescription  = "update-pr-description"
+	OpCommentOnPullRequest = "comment-on-pull-request"
+	OpReviewPullRequest    = "review-pull-request"
+	OpRenameBranch         = "rename-branch"
+	OpMergePullRequest     = "merge-pull-request"
+	OpEnqueuePullRequest   = "enqueue-pull-request"
+	OpEnableAutoMerge      = "enable-auto-merge"
+	OpRevertPullRequest    = "revert-pull-request"
+	OpCreateIssue          = "create-issue"
+	OpEnsureLabel          = "ensure-label"
+	OpUpdatePRLabels       = "update-pr-labels"
+)
+
+// ReplayEntry is a mutating operation in a replay file, with the arguments needed to carry it out again. PRs are
+// identified by their branch, as their numbers differ between hosts.
+type ReplayEntry struct {
+	Time         string       `json:"time"`
+	Operation    string       `json:"operation"`
+	Dir          string       `json:"dir"`
+	FullRepoName string       `json:"fullRepoName,omitempty"`
+	Branch       string       `json:"branch,omitempty"`
+	NewBranch    string       `json:"newBranch,omitempty"`
+	Title        string       `json:"title,omitempty"`
+	Body         string       `json:"body,omitempty"`
+	Approve      bool         `json:"approve,omitempty"`
+	Method       string       `json:"method,omitempty"`
+	PullRequest  *PullRequest `json:"pullRequest,omitempty"`
+	Issue        *Issue       `json:"issue,omitempty"`
+	Label        *Label       `json:"label,omitempty"`
+	Add          []string     `json:"add,omitempty"`
+	Remove       []string     `json:"remove,omitempty"`
+}
+
+var (
+	recordingMutex sync.Mutex
+	recordingFile  string
+)
+
+// SetRecording makes every GitHub returned by NewGitHub append the mutating operations it carries out successfully
+// to a replay file, which turbolift replay can carry out again
+func SetRecording(filename string) {
+	recordingMutex.Lock()
+	defer recordingMutex.Unlock()
+	recordingFile = filename
+}
+
+func recording() bool {
+	recordingMutex.Lock()
+	defer recordingMutex.Unlock()
+	return recordingFile != ""
+}
+
+func record(entry ReplayEntry) error {
+	recordingMutex.Lock()
+	defer recordingMutex.Unlock()
+
+	entry.Time = time.Now().UTC().Format(time.RFC3339)
+	entry.Dir = filepath.ToSlash(entry.Dir)
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	file, err := os.OpenFile(recordingFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return fmt.Errorf("unable to record to replay file %s: %w", recordingFile, err)
+	}
+	if _, err := file.Write(append(line, '\n')); err != nil {
+		_ = file.Close()
+		return fmt.Errorf("unable to record to replay file %s: %w", recordingFile, err)
+	}
+	return file.Close()
+}
+
+// ReadReplayFile reads the operations recorded in a replay file, in the order they were carried out
+func ReadReplayFile(filename string) ([]ReplayEntry, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, fmt.Errorf("unable to open replay file: %s", filename)
+	}
+	defer file.Close()
+
+	var entries []ReplayEntry
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var entry ReplayEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return nil, fmt.Errorf("line %d of %s is not a recorded operation: %w", line, filename, err)
+		}
+		entries = append(entries, entry)
+	}
+	return entries, scanner.Err()
+}
+
+// RecordingGitHub records the mutating operations of another GitHub once they succeed
+type RecordingGitHub struct {
+	GitHub
+}
+
+func (r *RecordingGitHub) CreatePullRequest(output io.Writer, workingDir string, pr PullRequest) (bool, error) {
+	didCreate, err := r.GitHub.CreatePullRequest(output, workingDir, pr)
+	if err != nil || !didCreate {
+		return didCreate, err
+	}
+	return true, record(ReplayEntry{Operation: OpCreatePullRequest, Dir: workingDir, PullRequest: &pr})
+}
+
+func (r *RecordingGitHub) ClosePullRequest(output io.Writer, workingDir string, branchName string, comment string) error {
+	if err := r.GitHub.ClosePullRequest(output, workingDir, branchName, comment); err != nil {
+		return err
+	}
+	return record(ReplayEntry{Operation: OpClosePullRequest, Dir: workingDir, Branch: branchName, Body: comment})
+}
+
+func (r *RecordingGitHub) UpdatePRDescription(output io.Writer, workingDir string, branchName string, title string, body string) error {
+	if err := r.GitHub.UpdatePRDescription(output, workingDir, branchName, title, body); err != nil {
+		return err
+	}
+	return record(ReplayEntry{Operation: OpUpdatePRDescription, Dir: workingDir, Branch: branchName, Title: title, Body: body})
+}
+
+func (r *RecordingGitHub) CommentOnPullRequest(output io.Writer, workingDir string, branchName string, body string) error {
+	if err := r.GitHub.CommentOnPullRequest(output, workingDir, branchName, body); err != nil {
+		return err
+	}
+	return record(ReplayEntry{Operation: OpCommentOnPullRequest, Dir: workingDir, Branch: branchName, Body: body})
+}
+
+func (r *RecordingGitHub) ReviewPullRequest(output io.Writer, workingDir string, branchName string, approve bool, body string) error {
+	if err := r.GitHub.ReviewPullRequest(output, workingDir, branchName, approve, body); err != nil {
+		return err
+	}
+	return record(ReplayEntry{Operation: OpReviewPullRequest, Dir: workingDir, Branch: branchName, Approve: approve, Body: body})
+}
+
+func (r *RecordingGitHub) RenameBranch(output io.Writer, workingDir string, fullRepoName string, branchName string, newBranchName string) error {
+	if err := r.GitHub.RenameBranch(output, workingDir, fullRepoName, branchName, newBranchName); err != nil {
+		return err
+	}
+	return record(ReplayEntry{Operation: OpRenameBranch, Dir: workingDir, FullRepoName: fullRepoName, Branch: branchName, NewBranch: newBranchName})
+}
+
+func (r *RecordingGitHub) MergePullRequest(output io.Writer, workingDir string, pr *PrStatus, method string) error {
+	if err := r.GitHub.MergePullRequest(output, workingDir, pr, method); err != nil {
+		return err
+	}
+	return record(ReplayEntry{Operation: OpMergePullRequest, Dir: workingDir, Branch: pr.HeadRefName, Method: method})
+}
+
+func (r *RecordingGitHub) EnableAutoMerge(output io.Writer, workingDir string, pr *PrStatus, method string) error {
+	if err := r.GitHub.EnableAutoMerge(output, workingDir, pr, method); err != nil {
+		return err
+	}
+	return record(ReplayEntry{Operation: OpEnableAutoMerge, Dir: workingDir, Branch: pr.HeadRefName, Method: method})
+}
+
+func (r *RecordingGitHub) EnqueuePullRequest(output io.Writer, workingDir string, pr *PrStatus) (*MergeQueueEntry, error) {
+	entry, err := r.GitHub.EnqueuePullRequest(output, workingDir, pr)
+	if err != nil {
+		return nil, err
+	}
+	return entry, record(ReplayEntry{Operation: OpEnqueuePullRequest, Dir: workingDir, Branch: pr.HeadRefName})
+}
+
+func (r *RecordingGitHub) RevertPullRequest(output io.Writer, workingDir string, pr *PrStatus) (string, error) {
+	revertUrl, err := r.GitHub.RevertPullRequest(output, workingDir, pr)
+	if err != nil {
+		return "", err
+	}
+	return revertUrl, record(ReplayEntry{Operation: OpRevertPullRequest, Dir: workingDir, Branch: pr.HeadRefName})
+}
+
+func (r *RecordingGitHub) CreateIssue(output io.Writer, workingDir string, issue Issue) (*CreatedIssue, error) {
+	created, err := r.GitHub.CreateIssue(output, workingDir, issue)
+	if err != nil {
+		return nil, err
+	}
+	return created, record(ReplayEntry{Operation: OpCreateIssue, Dir: workingDir, Issue: &issue})
+}
+
+func (r *RecordingGitHub) EnsureLabel(output io.Writer, workingDir string, fullRepoName string, label Label) (bool, error) {
+	created, err := r.GitHub.EnsureLabel(output, workingDir, fullRepoName, label)
+	if err != nil || !created {
+		return created, err
+	}
+	return true, record(ReplayEntry{Operation: OpEnsureLabel, Dir: workingDir, FullRepoName: fullRepoName, Label: &label})
+}
+
+func (r *RecordingGitHub) UpdatePRLabels(output io.Writer, workingDir string, branchName string, add []string, remove []string) error {
+	if err := r.GitHub.UpdatePRLabels(output, workingDir, branchName, add, remove); err != nil {
+		return err
+	}
+	return record(ReplayEntry{Operation: OpUpdatePRLabels, Dir: workingDir, Branch: branchName, Add: add, Remove: remove})
+}
@@ -0,0 +1,71 @@
+/*
+ * Copyright 2021 Skyscanner Limited.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * https://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package github
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestItRecordsMutatingOperationsWhichSucceed(t *testing.T) {
+	dir, err := ioutil.TempDir("", "recording")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	replayFile := filepath.Join(dir, "replay.jsonl")
+	SetRecording(replayFile)
+	defer SetRecording("")
+
+	recording := &RecordingGitHub{GitHub: NewFakeGitHub(func(command Command, args []string) (bool, error) {
+		if command == ClosePullRequest {
+			return false, errors.New("synthetic error")
+		}
+		return true, nil
+	}, nil)}
+	output := bytes.NewBufferString("")
+
+	_, err = recording.CreatePullRequest(output, "work/org/repo1", PullRequest{Title: "PR title", UpstreamRepo: "org/repo1"})
+	assert.NoError(t, err)
+	assert.Error(t, recording.ClosePullRequest(output, "work/org/repo2", "campaign", ""))
+	assert.NoError(t, recording.MergePullRequest(output, "work/org/repo1", &PrStatus{Number: 7, HeadRefName: "campaign"}, "squash"))
+
+	entries, err := ReadReplayFile(replayFile)
+	assert.NoError(t, err)
+	assert.Len(t, entries, 2)
+	assert.Equal(t, OpCreatePullRequest, entries[0].Operation)
+	assert.Equal(t, "work/org/repo1", entries[0].Dir)
+	assert.Equal(t, &PullRequest{Title: "PR title", UpstreamRepo: "org/repo1"}, entries[0].PullRequest)
+	assert.Equal(t, OpMergePullRequest, entries[1].Operation)
+	assert.Equal(t, "campaign", entries[1].Branch)
+	assert.Equal(t, "squash", entries[1].Method)
+}
+
+func TestItRejectsReplayFilesWhichAreNotRecordedOperations(t *testing.T) {
+	dir, err := ioutil.TempDir("", "recording")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	replayFile := filepath.Join(dir, "replay.jsonl")
+	assert.NoError(t, ioutil.WriteFile(replayFile, []byte("{\"operation\":\"close-pull-request\"}\nnot json\n"), 0o644))
+
+	_, err = ReadReplayFile(replayFile)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "line 2 of "+replayFile+" is not a recorded operation")
+}
@@ -0,0 +1,225 @@
+/*
+ * Copyright 2021 Skyscanner Limited.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * https://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package github
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// MergeRequirements describes the branch protection of a PR's base branch, along with the state of the PR that it
+// applies to
+type MergeRequirements struct {
+	MergeStateStatus string
+	ReviewDecision   string
+	IsDraft          bool
+	Protection       *BranchProtection
+	// Checks maps the name of each check or commit status on the latest commit to its outcome, e.g. SUCCESS
+	Checks map[string]string
+	Signed bool
+	// MergeQueueEnabled is set when the base branch requires PRs to be merged through a merge queue
+	MergeQueueEnabled bool
+	// MergeQueueEntry is the PR's place in the merge queue, or nil if it is not queued
+	MergeQueueEntry *MergeQueueEntry
+}
+
+type MergeQueueEntry struct {
+	Position int    `json:"position"`
+	State    string `json:"state"`
+}
+
+// BranchProtection holds the branch protection rules that turbolift can explain. It is nil for unprotected branches.
+type BranchProtection struct {
+	RequiresApprovingReviews     bool     `json:"requiresApprovingReviews"`
+	RequiredApprovingReviewCount int      `json:"requiredApprovingReviewCount"`
+	RequiresCodeOwnerReviews     bool     `json:"requiresCodeOwnerReviews"`
+	RequiresStatusChecks         bool     `json:"requiresStatusChecks"`
+	RequiredStatusCheckContexts  []string `json:"requiredStatusCheckContexts"`
+	RequiresCommitSignatures     bool     `json:"requiresCommitSignatures"`
+}
+
+// mergeRequirementsFields are the fields of a PullRequest which make up its MergeRequirements
+const mergeRequirementsFields = `
+      mergeStateStatus
+      reviewDecision
+      isDraft
+      isMergeQueueEnabled
+      mergeQueueEntry { position state }
+      baseRef {
+        branchProtectionRule {
+          requiresApprovingReviews requiredApprovingReviewCount requiresCodeOwnerReviews
+          requiresStatusChecks requiredStatusCheckContexts requiresCommitSignatures
+        }
+      }
+      commits(last: 1) {
+        nodes {
+          commit {
+            signature { isValid }
+            statusCheckRollup {
+              contexts(first: 100) {
+                nodes {
+                  ... on CheckRun { name status conclusion }
+                  ... on StatusContext { context state }
+                }
+              }
+            }
+          }
+        }
+      }`
+
+const mergeRequirementsQuery = `query($id: ID!) {
+  node(id: $id) {
+    ... on PullRequest {` + mergeRequirementsFields + `
+    }
+  }
+}`
+
+type mergeRequirementsResponse struct {
+	MergeStateStatus    string           `json:"mergeStateStatus"`
+	ReviewDecision      string           `json:"reviewDecision"`
+	IsDraft             bool             `json:"isDraft"`
+	IsMergeQueueEnabled bool             `json:"isMergeQueueEnabled"`
+	MergeQueueEntry     *MergeQueueEntry `json:"mergeQueueEntry"`
+	BaseRef             *struct {
+		BranchProtectionRule *BranchProtection `json:"branchProtectionRule"`
+	} `json:"baseRef"`
+	Commits struct {
+		Nodes []struct {
+			Commit struct {
+				Signature *struct {
+					IsValid bool `json:"isValid"`
+				} `json:"signature"`
+				StatusCheckRollup *struct {
+					Contexts struct {
+						Nodes []struct {
+							Name       string `json:"name"`
+							Status     string `json:"status"`
+							Conclusion string `json:"conclusion"`
+							Context    string `json:"context"`
+							State      string `json:"state"`
+						} `json:"nodes"`
+					} `json:"contexts"`
+				} `json:"statusCheckRollup"`
+			} `json:"commit"`
+		} `json:"nodes"`
+	} `json:"commits"`
+}
+
+// GetMergeRequirements fetches the branch protection of the PR's base branch and the state of the PR against it
+func (r *RealGitHub) GetMergeRequirements(output io.Writer, workingDir string, pr *PrStatus) (*MergeRequirements, error) {
+	response, err := execInstance.ExecuteAndCapture(output, workingDir, "gh", "api", "graphql", "-f", "query="+mergeRequirementsQuery, "-f", "id="+pr.Id, "--jq", ".data.node")
+	if err != nil {
+		return nil, err
+	}
+
+	var parsed mergeRequirementsResponse
+	if err := json.Unmarshal([]byte(response), &parsed); err != nil {
+		return nil, fmt.Errorf("unable to parse merge requirements: %w", err)
+	}
+	return parsed.requirements(), nil
+}
+
+func (parsed *mergeRequirementsResponse) requirements() *MergeRequirements {
+	requirements := &MergeRequirements{
+		MergeStateStatus:  parsed.MergeStateStatus,
+		ReviewDecision:    parsed.ReviewDecision,
+		IsDraft:           parsed.IsDraft,
+		Checks:            map[string]string{},
+		MergeQueueEnabled: parsed.IsMergeQueueEnabled,
+		MergeQueueEntry:   parsed.MergeQueueEntry,
+	}
+	if parsed.BaseRef != nil {
+		requirements.Protection = parsed.BaseRef.BranchProtectionRule
+	}
+	for _, node := range parsed.Commits.Nodes {
+		requirements.Signed = node.Commit.Signature != nil && node.Commit.Signature.IsValid
+		if node.Commit.StatusCheckRollup == nil {
+			continue
+		}
+		for _, context := range node.Commit.StatusCheckRollup.Contexts.Nodes {
+			if context.Context != "" {
+				requirements.Checks[context.Context] = context.State
+			} else if context.Conclusion != "" {
+				requirements.Checks[context.Name] = context.Conclusion
+			} else {
+				requirements.Checks[context.Name] = context.Status
+			}
+		}
+	}
+	return requirements
+}
+
+// Unmet explains each requirement that stops the PR from being merged, or returns nothing if it can be merged
+func (m *MergeRequirements) Unmet() []string {
+	var unmet []string
+	if m.IsDraft {
+		unmet = append(unmet, "the PR is a draft")
+	}
+
+	switch m.MergeStateStatus {
+	case "DIRTY":
+		unmet = append(unmet, "the PR has conflicts with the base branch")
+	case "BEHIND":
+		unmet = append(unmet, "the PR branch must be brought up to date with the base branch")
+	}
+
+	if p := m.Protection; p != nil {
+		if m.ReviewDecision == "CHANGES_REQUESTED" {
+			unmet = append(unmet, "changes have been requested by a reviewer")
+		} else if p.RequiresApprovingReviews && m.ReviewDecision != "APPROVED" {
+			approvals := fmt.Sprintf("%d approving review(s) are required", p.RequiredApprovingReviewCount)
+			if p.RequiresCodeOwnerReviews {
+				approvals += ", including from code owners"
+			}
+			unmet = append(unmet, approvals)
+		}
+
+		if p.RequiresStatusChecks {
+			contexts := append([]string{}, p.RequiredStatusCheckContexts...)
+			sort.Strings(contexts)
+			for _, context := range contexts {
+				outcome, ok := m.Checks[context]
+				if !ok {
+					unmet = append(unmet, fmt.Sprintf("required check %s has not run", context))
+				} else if !passedCheck(outcome) {
+					unmet = append(unmet, fmt.Sprintf("required check %s is %s", context, strings.ToLower(outcome)))
+				}
+			}
+		}
+
+		if p.RequiresCommitSignatures && !m.Signed {
+			unmet = append(unmet, "commits must be signed")
+		}
+	}
+
+	// a merge queue blocks merging directly, but PRs can still be added to the queue
+	if len(unmet) == 0 && m.MergeStateStatus == "BLOCKED" && !m.MergeQueueEnabled {
+		unmet = append(unmet, "merging is blocked by a rule that turbolift cannot see, such as a repository ruleset")
+	}
+	return unmet
+}
+
+func passedCheck(outcome string) bool {
+	switch outcome {
+	case "SUCCESS", "NEUTRAL", "SKIPPED":
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,111 @@
+/*
+ * Copyright 2021 Skyscanner Limited.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * https://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package github
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/skyscanner/turbolift/internal/executor"
+)
+
+func TestItGetsMergeRequirements(t *testing.T) {
+	fakeExecutor := executor.NewFakeExecutor(func(workingDir string, name string, args ...string) error {
+		return nil
+	}, func(workingDir string, name string, args ...string) (string, error) {
+		return `{
+			"mergeStateStatus": "BLOCKED",
+			"reviewDecision": "REVIEW_REQUIRED",
+			"isDraft": false,
+			"baseRef": {"branchProtectionRule": {"requiresApprovingReviews": true, "requiredApprovingReviewCount": 2, "requiresStatusChecks": true, "requiredStatusCheckContexts": ["build", "ci/lint"]}},
+			"commits": {"nodes": [{"commit": {"signature": null, "statusCheckRollup": {"contexts": {"nodes": [
+				{"name": "build", "status": "COMPLETED", "conclusion": "FAILURE"},
+				{"name": "test", "status": "IN_PROGRESS", "conclusion": ""},
+				{"context": "ci/lint", "state": "SUCCESS"}
+			]}}}}]}
+		}`, nil
+	})
+	execInstance = fakeExecutor
+
+	requirements, err := NewRealGitHub().GetMergeRequirements(&strings.Builder{}, "work/org/repo1", &PrStatus{Id: "PR_1"})
+	assert.NoError(t, err)
+	assert.Equal(t, "BLOCKED", requirements.MergeStateStatus)
+	assert.Equal(t, 2, requirements.Protection.RequiredApprovingReviewCount)
+	assert.Equal(t, map[string]string{"build": "FAILURE", "test": "IN_PROGRESS", "ci/lint": "SUCCESS"}, requirements.Checks)
+	assert.False(t, requirements.Signed)
+
+	assert.Equal(t, []string{
+		"2 approving review(s) are required",
+		"required check build is failure",
+	}, requirements.Unmet())
+
+	fakeExecutor.AssertCalledWith(t, [][]string{
+		{"work/org/repo1", "gh", "api", "graphql", "-f", "query=" + mergeRequirementsQuery, "-f", "id=PR_1", "--jq", ".data.node"},
+	})
+}
+
+func TestItExplainsUnmetMergeRequirements(t *testing.T) {
+	requirements := &MergeRequirements{
+		MergeStateStatus: "DIRTY",
+		ReviewDecision:   "CHANGES_REQUESTED",
+		IsDraft:          true,
+		Protection: &BranchProtection{
+			RequiresApprovingReviews:     true,
+			RequiredApprovingReviewCount: 1,
+			RequiresStatusChecks:         true,
+			RequiredStatusCheckContexts:  []string{"build"},
+			RequiresCommitSignatures:     true,
+		},
+		Checks: map[string]string{},
+	}
+
+	assert.Equal(t, []string{
+		"the PR is a draft",
+		"the PR has conflicts with the base branch",
+		"changes have been requested by a reviewer",
+		"required check build has not run",
+		"commits must be signed",
+	}, requirements.Unmet())
+}
+
+func TestItDoesNotTreatAMergeQueueAsABlocker(t *testing.T) {
+	blocked := &MergeRequirements{MergeStateStatus: "BLOCKED"}
+	assert.Len(t, blocked.Unmet(), 1)
+
+	queued := &MergeRequirements{MergeStateStatus: "BLOCKED", MergeQueueEnabled: true}
+	assert.Empty(t, queued.Unmet())
+}
+
+func TestItHasNoUnmetRequirementsWhenMergeable(t *testing.T) {
+	requirements := &MergeRequirements{
+		MergeStateStatus: "CLEAN",
+		ReviewDecision:   "APPROVED",
+		Protection: &BranchProtection{
+			RequiresApprovingReviews:     true,
+			RequiredApprovingReviewCount: 1,
+			RequiresCodeOwnerReviews:     true,
+			RequiresStatusChecks:         true,
+			RequiredStatusCheckContexts:  []string{"build"},
+		},
+		Checks: map[string]string{"build": "SUCCESS"},
+	}
+	assert.Empty(t, requirements.Unmet())
+
+	unprotected := &MergeRequirements{MergeStateStatus: "BLOCKED"}
+	assert.Equal(t, []string{"merging is blocked by a rule that turbolift cannot see, such as a repository ruleset"}, unprotected.Unmet())
+}
@@ -0,0 +1,170 @@
+/*
+ * Copyright 2021 Skyscanner Limited.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * https://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package history
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"time"
+
+	"github.com/skyscanner/turbolift/internal/logging"
+)
+
+// Filename is the campaign's execution history, with a summary of every command run in the campaign directory
+const Filename = "summary.json"
+
+// The outcomes of a repository in a run, from best to worst
+const (
+	Succeeded = "succeeded"
+	Warning   = "warning"
+	Failed    = "failed"
+)
+
+// Run is the summary of one command
+type Run struct {
+	Timestamp time.Time         `json:"timestamp"`
+	Command   string            `json:"command"`
+	Args      []string          `json:"args,omitempty"`
+	Flags     map[string]string `json:"flags,omitempty"`
+	Duration  string            `json:"duration"`
+	ExitCode  int               `json:"exitCode"`
+	Totals    Totals            `json:"totals"`
+	Repos     []RepoOutcome     `json:"repos,omitempty"`
+}
+
+// Totals counts the activities of a run by how they ended
+type Totals struct {
+	Succeeded int `json:"succeeded"`
+	Warnings  int `json:"warnings"`
+	Failed    int `json:"failed"`
+}
+
+// RepoOutcome is how a run went for one repository: the worst outcome of the activities naming it, with their
+// messages if there were problems
+type RepoOutcome struct {
+	Repo     string   `json:"repo"`
+	Outcome  string   `json:"outcome"`
+	Messages []string `json:"messages,omitempty"`
+}
+
+// NewRun summarises a command from what happened in its activities on the given repositories (full repo names).
+// Repositories which no activity names are left out.
+func NewRun(command string, started time.Time, results logging.Results, repos []string) Run {
+	run := Run{
+		Timestamp: started.UTC().Truncate(time.Second),
+		Command:   command,
+		Duration:  time.Since(started).Round(time.Millisecond).String(),
+		Totals: Totals{
+			Succeeded: results.Succeeded,
+			Warnings:  len(results.Warnings),
+			Failed:    len(results.Failures),
+		},
+	}
+
+	for _, repo := range repos {
+		outcome := RepoOutcome{Repo: repo}
+		for _, activity := range results.Successes {
+			if NamesRepo(activity, repo) {
+				outcome.Outcome = Succeeded
+				break
+			}
+		}
+		for _, warning := range results.Warnings {
+			if NamesRepo(warning.Activity, repo) {
+				outcome.Outcome = Warning
+				outcome.Messages = append(outcome.Messages, warning.Message)
+			}
+		}
+		for _, failure := range results.Failures {
+			if NamesRepo(failure.Activity, repo) {
+				if outcome.Outcome != Failed {
+					outcome.Messages = nil
+				}
+				outcome.Outcome = Failed
+				outcome.Messages = append(outcome.Messages, failure.Message)
+			}
+		}
+		if outcome.Outcome != "" {
+			run.Repos = append(run.Repos, outcome)
+		}
+	}
+	return run
+}
+
+// LastRun returns the latest of the runs of a command, e.g. turbolift clone
+func LastRun(runs []Run, command string) (Run, bool) {
+	for i := len(runs) - 1; i >= 0; i-- {
+		if runs[i].Command == command {
+			return runs[i], true
+		}
+	}
+	return Run{}, false
+}
+
+// OutcomeOf returns the outcome of the run for a repository, or an empty string if the run did not work on it
+func (r Run) OutcomeOf(repo string) string {
+	for _, outcome := range r.Repos {
+		if outcome.Repo == repo {
+			return outcome.Outcome
+		}
+	}
+	return ""
+}
+
+// NamesRepo reports whether a repository, given as its full repo name, is named in text, such as the name of an
+// activity carried out on it
+func NamesRepo(text string, fullRepoName string) bool {
+	pattern := regexp.MustCompile(`(^|[\s(])` + regexp.QuoteMeta(fullRepoName) + `($|[\s),:])`)
+	return pattern.MatchString(text)
+}
+
+// Read returns the runs in the history file, oldest first, or none if there is no history yet
+func Read(filename string) ([]Run, error) {
+	contents, err := ioutil.ReadFile(filename)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var runs []Run
+	if err := json.Unmarshal(contents, &runs); err != nil {
+		return nil, fmt.Errorf("unable to parse %s: %w", filename, err)
+	}
+	return runs, nil
+}
+
+// Append adds a run to the end of the history file, creating it if needed
+func Append(filename string, run Run) error {
+	runs, err := Read(filename)
+	if err != nil {
+		return err
+	}
+	contents, err := json.MarshalIndent(append(runs, run), "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(filename), 0o755); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filename, append(contents, '\n'), 0o644)
+}
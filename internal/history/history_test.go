@@ -0,0 +1,67 @@
+/*
+ * Copyright 2021 Skyscanner Limited.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * https://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package history
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/skyscanner/turbolift/internal/logging"
+)
+
+var results = logging.Results{
+	Succeeded: 3,
+	Successes: []string{"Reading campaign data (repos.txt, README.md)", "Pushing changes in org/repo1 to origin", "Creating PR in org/repo1"},
+	Warnings:  []logging.Outcome{{Activity: "Creating PR in org/repo3", Message: "No PR created in org/repo3"}},
+	Failures:  []logging.Outcome{{Activity: "Pushing changes in org/repo10 to origin", Message: "rejected"}},
+}
+
+var repos = []string{"org/repo1", "org/repo10", "org/repo3", "org/repo4"}
+
+func TestItSummarisesTheOutcomeOfEachRepo(t *testing.T) {
+	started := time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC)
+	run := NewRun("turbolift create-prs", started, results, repos)
+
+	assert.Equal(t, started, run.Timestamp)
+	assert.Equal(t, "turbolift create-prs", run.Command)
+	assert.Equal(t, Totals{Succeeded: 3, Warnings: 1, Failed: 1}, run.Totals)
+	assert.Equal(t, []RepoOutcome{
+		{Repo: "org/repo1", Outcome: Succeeded},
+		{Repo: "org/repo10", Outcome: Failed, Messages: []string{"rejected"}},
+		{Repo: "org/repo3", Outcome: Warning, Messages: []string{"No PR created in org/repo3"}},
+	}, run.Repos)
+}
+
+func TestItAppendsRunsToTheHistory(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), Filename)
+
+	runs, err := Read(filename)
+	assert.NoError(t, err)
+	assert.Empty(t, runs)
+
+	assert.NoError(t, Append(filename, Run{Command: "turbolift clone", ExitCode: 0}))
+	assert.NoError(t, Append(filename, Run{Command: "turbolift create-prs", ExitCode: 3}))
+
+	runs, err = Read(filename)
+	assert.NoError(t, err)
+	assert.Len(t, runs, 2)
+	assert.Equal(t, "turbolift clone", runs[0].Command)
+	assert.Equal(t, "turbolift create-prs", runs[1].Command)
+	assert.Equal(t, 3, runs[1].ExitCode)
+}
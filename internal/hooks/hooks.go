@@ -0,0 +1,122 @@
+/*
+ * Copyright 2021 Skyscanner Limited.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * https://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package hooks
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/skyscanner/turbolift/internal/campaign"
+	"github.com/skyscanner/turbolift/internal/config"
+	"github.com/skyscanner/turbolift/internal/executor"
+	"github.com/skyscanner/turbolift/internal/logging"
+)
+
+// Lifecycle points at which hooks can run
+const (
+	PreClone      = "pre-clone"
+	PostForeach   = "post-foreach"
+	PrePush       = "pre-push"
+	PostCreatePrs = "post-create-prs"
+)
+
+var exec executor.Executor = executor.NewRealExecutor()
+
+// Hooks runs the scripts configured in the hooks section of the campaign configuration
+type Hooks struct {
+	hooks map[string]config.Hook
+}
+
+func Load() (*Hooks, error) {
+	cfg, err := config.Load()
+	if err != nil {
+		return nil, err
+	}
+
+	for point, hook := range cfg.Hooks {
+		switch point {
+		case PreClone, PostForeach, PrePush, PostCreatePrs:
+		default:
+			return nil, fmt.Errorf("unknown hook %s - expected one of %s, %s, %s or %s", point, PreClone, PostForeach, PrePush, PostCreatePrs)
+		}
+		if hook.Per != "" && hook.Per != "repo" && hook.Per != "command" {
+			return nil, fmt.Errorf("unknown value for per in hook %s: %s - expected repo or command", point, hook.Per)
+		}
+	}
+
+	return &Hooks{hooks: cfg.Hooks}, nil
+}
+
+// RunForRepo runs the hook for the given point against a repository, if one is configured to run per repository.
+// The hook runs within the working copy, or within the campaign directory if the working copy doesn't exist yet.
+func (h *Hooks) RunForRepo(output io.Writer, point string, repo campaign.Repo) error {
+	hook, ok := h.hooks[point]
+	if !ok || hook.Per == "command" {
+		return nil
+	}
+
+	workingDir := repo.FullRepoPath()
+	if _, err := os.Stat(workingDir); os.IsNotExist(err) {
+		workingDir = "."
+	}
+
+	return run(output, point, hook, workingDir,
+		"TURBOLIFT_REPO="+repo.FullRepoName,
+		"TURBOLIFT_REPO_DIR="+absolute(repo.FullRepoPath()))
+}
+
+// RunForCommand runs the hook for the given point within the campaign directory, as an activity of its own, if one
+// is configured to run per command
+func (h *Hooks) RunForCommand(logger *logging.Logger, point string) error {
+	hook, ok := h.hooks[point]
+	if !ok || hook.Per != "command" {
+		return nil
+	}
+
+	hookActivity := logger.StartActivity("Running %s hook", point)
+	if err := run(hookActivity.Writer(), point, hook, "."); err != nil {
+		hookActivity.EndWithFailure(err)
+		return err
+	}
+	hookActivity.EndWithSuccess()
+	return nil
+}
+
+func run(output io.Writer, point string, hook config.Hook, workingDir string, extraEnv ...string) error {
+	campaignDir, _ := os.Getwd()
+	env := append(os.Environ(),
+		"TURBOLIFT_HOOK="+point,
+		"TURBOLIFT_CAMPAIGN="+filepath.Base(campaignDir),
+		"TURBOLIFT_CAMPAIGN_DIR="+campaignDir,
+	)
+	env = append(env, extraEnv...)
+
+	shellCommand, shellArgs := executor.ShellInvocation("", hook.Run)
+	if err := exec.ExecuteWithEnv(output, workingDir, env, shellCommand, shellArgs...); err != nil {
+		return fmt.Errorf("%s hook failed: %w", point, err)
+	}
+	return nil
+}
+
+func absolute(path string) string {
+	absolutePath, err := filepath.Abs(path)
+	if err != nil {
+		return path
+	}
+	return absolutePath
+}
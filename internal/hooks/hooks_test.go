@@ -0,0 +1,141 @@
+/*
+ * Copyright 2021 Skyscanner Limited.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * https://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package hooks
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/skyscanner/turbolift/internal/campaign"
+	"github.com/skyscanner/turbolift/internal/executor"
+	"github.com/skyscanner/turbolift/internal/logging"
+	"github.com/skyscanner/turbolift/internal/testsupport"
+)
+
+var repo = campaign.Repo{OrgName: "org", RepoName: "repo1", FullRepoName: "org/repo1"}
+
+func TestItRunsPerRepoHooksInTheWorkingCopy(t *testing.T) {
+	fakeExecutor := executor.NewAlwaysSucceedsFakeExecutor()
+	exec = fakeExecutor
+
+	prepareCampaignWithConfig(`
+hooks:
+  pre-push:
+    run: make test
+`)
+
+	lifecycleHooks, err := Load()
+	assert.NoError(t, err)
+	assert.NoError(t, lifecycleHooks.RunForRepo(ioutil.Discard, PrePush, repo))
+	assert.NoError(t, lifecycleHooks.RunForRepo(ioutil.Discard, PostForeach, repo))
+	assert.NoError(t, lifecycleHooks.RunForCommand(newLogger(), PrePush))
+
+	fakeExecutor.AssertCalledWith(t, [][]string{
+		expectedCall("work/org/repo1", "make test"),
+	})
+}
+
+func TestItRunsPreCloneHooksInTheCampaignDirectory(t *testing.T) {
+	fakeExecutor := executor.NewAlwaysSucceedsFakeExecutor()
+	exec = fakeExecutor
+
+	prepareCampaignWithConfig(`
+hooks:
+  pre-clone:
+    run: ./check-ownership.sh
+`)
+	_ = os.RemoveAll(filepath.Join("work", "org", "repo1"))
+
+	lifecycleHooks, err := Load()
+	assert.NoError(t, err)
+	assert.NoError(t, lifecycleHooks.RunForRepo(ioutil.Discard, PreClone, repo))
+
+	fakeExecutor.AssertCalledWith(t, [][]string{
+		expectedCall(".", "./check-ownership.sh"),
+	})
+}
+
+func TestItRunsPerCommandHooksOnce(t *testing.T) {
+	fakeExecutor := executor.NewAlwaysFailsFakeExecutor()
+	exec = fakeExecutor
+
+	prepareCampaignWithConfig(`
+hooks:
+  post-create-prs:
+    run: ./notify-owners.sh
+    per: command
+`)
+
+	lifecycleHooks, err := Load()
+	assert.NoError(t, err)
+	assert.NoError(t, lifecycleHooks.RunForRepo(ioutil.Discard, PostCreatePrs, repo))
+
+	err = lifecycleHooks.RunForCommand(newLogger(), PostCreatePrs)
+	assert.EqualError(t, err, "post-create-prs hook failed: synthetic error")
+
+	fakeExecutor.AssertCalledWith(t, [][]string{
+		expectedCall(".", "./notify-owners.sh"),
+	})
+}
+
+func TestItRejectsUnknownHooks(t *testing.T) {
+	prepareCampaignWithConfig(`
+hooks:
+  post-commit:
+    run: echo done
+`)
+
+	_, err := Load()
+	assert.Error(t, err)
+}
+
+func TestItRejectsUnknownHookScopes(t *testing.T) {
+	prepareCampaignWithConfig(`
+hooks:
+  pre-push:
+    run: make test
+    per: org
+`)
+
+	_, err := Load()
+	assert.Error(t, err)
+}
+
+func prepareCampaignWithConfig(contents string) {
+	tempDir := testsupport.PrepareTempCampaign(true, "org/repo1")
+	_ = os.Setenv("XDG_CONFIG_HOME", filepath.Join(tempDir, "config"))
+	err := ioutil.WriteFile("turbolift.yaml", []byte(contents), 0o644)
+	if err != nil {
+		panic(err)
+	}
+}
+
+func newLogger() *logging.Logger {
+	cmd := &cobra.Command{}
+	cmd.SetOut(bytes.NewBufferString(""))
+	return logging.NewLogger(cmd)
+}
+
+func expectedCall(workingDir string, command string) []string {
+	shell, args := executor.ShellInvocation("", command)
+	return append([]string{workingDir, shell}, args...)
+}
@@ -0,0 +1,144 @@
+/*
+ * Copyright 2021 Skyscanner Limited.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * https://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package interrupt
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+
+	"github.com/skyscanner/turbolift/internal/campaign"
+	"github.com/skyscanner/turbolift/internal/colors"
+	"github.com/skyscanner/turbolift/internal/engine"
+	"github.com/skyscanner/turbolift/internal/logging"
+)
+
+// RemainingReposFilename is the repo file that an interrupted command writes the repositories it did not reach to
+const RemainingReposFilename = "remaining.txt"
+
+var (
+	requested int32
+
+	ctxMutex    sync.Mutex
+	ctx, cancel = context.WithCancel(context.Background())
+
+	cleanupMutex sync.Mutex
+	cleanup      func()
+
+	exit = os.Exit
+)
+
+// Watch handles SIGINT and SIGTERM for the rest of the run. The first signal asks the running command to stop once
+// it has finished with the repository in hand; a second exits immediately.
+// Subprocesses in the terminal's foreground group receive its interrupt themselves, and those limited by a timeout, which
+// run in a process group of their own, have it forwarded to them, so the repository in hand usually fails promptly
+// rather than running to completion.
+func Watch(output io.Writer) {
+	signals := make(chan os.Signal, 2)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		for range signals {
+			handleSignal(output)
+		}
+	}()
+}
+
+func handleSignal(output io.Writer) {
+	if Requested() {
+		_, _ = fmt.Fprintln(output, "\nInterrupted again - stopping immediately")
+		cleanupMutex.Lock()
+		if cleanup != nil {
+			cleanup()
+		}
+		cleanupMutex.Unlock()
+		exit(130)
+		return
+	}
+	Request()
+	_, _ = fmt.Fprintln(output, "\nInterrupted - stopping after the current repository. Interrupt again to stop immediately.")
+}
+
+// OnExit sets what to do before a second interrupt exits, such as releasing the campaign's lock, as the command does not
+// get to finish up after itself
+func OnExit(f func()) {
+	cleanupMutex.Lock()
+	defer cleanupMutex.Unlock()
+	cleanup = f
+}
+
+// Request asks the running command to stop after the repository in hand
+func Request() {
+	atomic.StoreInt32(&requested, 1)
+	ctxMutex.Lock()
+	defer ctxMutex.Unlock()
+	cancel()
+}
+
+// Requested is true once the run has been interrupted. Commands check it before starting work on each repository.
+func Requested() bool {
+	return atomic.LoadInt32(&requested) == 1
+}
+
+// Reset forgets any interrupt, so that a later command runs in full
+func Reset() {
+	atomic.StoreInt32(&requested, 0)
+	ctxMutex.Lock()
+	defer ctxMutex.Unlock()
+	ctx, cancel = context.WithCancel(context.Background())
+}
+
+// Context is cancelled once the run has been interrupted
+func Context() context.Context {
+	ctxMutex.Lock()
+	defer ctxMutex.Unlock()
+	return ctx
+}
+
+// ForEachRepo works on each repository in turn through the engine, stopping before the next one once the run has been
+// interrupted and reporting the repositories it did not reach as Stop does. It returns false if it was interrupted.
+func ForEachRepo(logger *logging.Logger, repos []campaign.Repo, work func(repo campaign.Repo)) bool {
+	result := engine.ForEachRepo(Context(), repos, engine.Options{}, func(_ context.Context, _ io.Writer, repo campaign.Repo) error {
+		work(repo)
+		return nil
+	})
+	if len(result.NotRun) > 0 {
+		Stop(logger, result.NotRun)
+		return false
+	}
+	return true
+}
+
+// Stop reports that a command was interrupted, and writes the repositories it did not reach to a repo file so that
+// the run can be resumed with --repos
+func Stop(logger *logging.Logger, remaining []campaign.Repo) {
+	var names []string
+	for _, repo := range remaining {
+		names = append(names, repo.FullRepoName)
+	}
+
+	if err := ioutil.WriteFile(RemainingReposFilename, []byte(strings.Join(names, "\n")+"\n"), 0o644); err != nil {
+		logger.Warnf("Interrupted - %d repositories were not reached, but they could not be written to %s: %v", len(remaining), RemainingReposFilename, err)
+		return
+	}
+	logger.Warnf("Interrupted - %d repositories were not reached. To resume, use %s", len(remaining), colors.Cyan("--repos ", RemainingReposFilename))
+}
@@ -0,0 +1,110 @@
+/*
+ * Copyright 2021 Skyscanner Limited.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * https://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package interrupt
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/skyscanner/turbolift/internal/campaign"
+	"github.com/skyscanner/turbolift/internal/logging"
+	"github.com/skyscanner/turbolift/internal/testsupport"
+)
+
+func init() {
+	_ = os.Setenv("NO_COLOR", "1")
+}
+
+func TestItStopsAfterTheFirstSignalAndExitsOnTheSecond(t *testing.T) {
+	Reset()
+	defer Reset()
+	var exitCode int
+	exit = func(code int) { exitCode = code }
+	defer func() { exit = os.Exit }()
+
+	out := bytes.NewBufferString("")
+	handleSignal(out)
+	assert.True(t, Requested())
+	assert.Equal(t, 0, exitCode)
+	assert.Contains(t, out.String(), "Interrupted - stopping after the current repository")
+
+	handleSignal(out)
+	assert.Equal(t, 130, exitCode)
+}
+
+func TestItCleansUpBeforeExitingOnTheSecondSignal(t *testing.T) {
+	Reset()
+	defer Reset()
+	var cleanedUp bool
+	OnExit(func() { cleanedUp = true })
+	defer OnExit(nil)
+	exit = func(int) { assert.True(t, cleanedUp) }
+	defer func() { exit = os.Exit }()
+
+	out := bytes.NewBufferString("")
+	handleSignal(out)
+	assert.False(t, cleanedUp)
+
+	handleSignal(out)
+	assert.True(t, cleanedUp)
+}
+
+func TestItWritesTheRemainingRepos(t *testing.T) {
+	testsupport.PrepareTempCampaign(false)
+
+	out := bytes.NewBufferString("")
+	c := &cobra.Command{}
+	c.SetOut(out)
+
+	Stop(logging.NewLogger(c), []campaign.Repo{
+		{OrgName: "org", RepoName: "repo2", FullRepoName: "org/repo2"},
+		{Host: "mygitserver.com", OrgName: "org", RepoName: "repo3", FullRepoName: "mygitserver.com/org/repo3"},
+	})
+	assert.Contains(t, out.String(), "Interrupted - 2 repositories were not reached. To resume, use --repos remaining.txt")
+
+	contents, err := ioutil.ReadFile(RemainingReposFilename)
+	assert.NoError(t, err)
+	assert.Equal(t, "org/repo2\nmygitserver.com/org/repo3\n", string(contents))
+}
+
+func TestItStopsWorkingOnReposOnceInterrupted(t *testing.T) {
+	testsupport.PrepareTempCampaign(false)
+	Reset()
+	defer Reset()
+
+	out := bytes.NewBufferString("")
+	c := &cobra.Command{}
+	c.SetOut(out)
+
+	var worked []string
+	completed := ForEachRepo(logging.NewLogger(c), []campaign.Repo{
+		{OrgName: "org", RepoName: "repo1", FullRepoName: "org/repo1"},
+		{OrgName: "org", RepoName: "repo2", FullRepoName: "org/repo2"},
+		{OrgName: "org", RepoName: "repo3", FullRepoName: "org/repo3"},
+	}, func(repo campaign.Repo) {
+		worked = append(worked, repo.FullRepoName)
+		Request()
+	})
+
+	assert.False(t, completed)
+	assert.Equal(t, []string{"org/repo1"}, worked)
+	assert.Contains(t, out.String(), "Interrupted - 2 repositories were not reached")
+}
@@ -0,0 +1,173 @@
+/*
+ * Copyright 2021 Skyscanner Limited.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * https://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package lock
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/user"
+	"strconv"
+	"time"
+)
+
+// Filename is the lock file held in the campaign directory by the command which is changing the campaign
+const Filename = ".turbolift.lock"
+
+// StaleAfter is how old a lock held on another machine must be before it is taken to be stale. Locks held on this
+// machine are stale as soon as the process holding them has gone.
+const StaleAfter = 24 * time.Hour
+
+// InheritedEnvVar is set for turbolift commands run by the command holding the lock, to the process ID of the holder,
+// so that they can work on the campaign under its lock
+const InheritedEnvVar = "TURBOLIFT_LOCK_HOLDER"
+
+// Holder describes the command holding the lock, so that whoever is locked out knows who to ask
+type Holder struct {
+	Command string    `json:"command"`
+	User    string    `json:"user"`
+	Host    string    `json:"host"`
+	PID     int       `json:"pid"`
+	Started time.Time `json:"started"`
+}
+
+func (h Holder) String() string {
+	return fmt.Sprintf("%s running %q on %s (pid %d) since %s", h.User, h.Command, h.Host, h.PID, h.Started.Format(time.RFC3339))
+}
+
+// LockedError is returned when another command holds the lock
+type LockedError struct {
+	Holder Holder
+}
+
+func (e *LockedError) Error() string {
+	return fmt.Sprintf("the campaign is locked by %s - if that command is no longer running, use --force-unlock", e.Holder)
+}
+
+var (
+	held bool
+	now  = time.Now
+
+	// processAlive is swapped out in tests
+	processAlive = isProcessAlive
+)
+
+// Acquire takes the lock for a command, failing with a LockedError if another command holds it. A stale lock, left
+// behind by a command which did not finish, is broken and returned so that it can be reported; with force, any lock is
+// broken.
+func Acquire(command string, force bool) (*Holder, error) {
+	self := currentHolder(command)
+	contents, err := json.MarshalIndent(self, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+
+	var broken *Holder
+	for attempt := 0; attempt < 2; attempt++ {
+		file, err := os.OpenFile(Filename, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+		if err == nil {
+			_, err = file.Write(append(contents, '\n'))
+			if closeErr := file.Close(); err == nil {
+				err = closeErr
+			}
+			if err != nil {
+				_ = os.Remove(Filename)
+				return nil, err
+			}
+			held = true
+			return broken, nil
+		}
+		if !errors.Is(err, os.ErrExist) {
+			return nil, err
+		}
+
+		holder, err := read()
+		if err != nil {
+			return nil, err
+		}
+		if holder.Host == self.Host && os.Getenv(InheritedEnvVar) == strconv.Itoa(holder.PID) {
+			// the command which started this one holds the lock, and will release it
+			return nil, nil
+		}
+		if !force && !holder.isStale(self.Host) {
+			return nil, &LockedError{Holder: holder}
+		}
+		if err := os.Remove(Filename); err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+		broken = &holder
+	}
+	return nil, fmt.Errorf("%s was recreated while breaking it - another command has just taken the lock", Filename)
+}
+
+// Release gives up the lock, if this process holds it
+func Release() error {
+	if !held {
+		return nil
+	}
+	held = false
+	if err := os.Remove(Filename); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// Environ returns the environment for running another turbolift command under the lock held by this one
+func Environ() []string {
+	return append(os.Environ(), fmt.Sprintf("%s=%d", InheritedEnvVar, os.Getpid()))
+}
+
+func read() (Holder, error) {
+	var holder Holder
+	contents, err := ioutil.ReadFile(Filename)
+	if err != nil {
+		return holder, err
+	}
+	if err := json.Unmarshal(contents, &holder); err != nil {
+		// a lock file which cannot be read is still being written, or was left behind by a command which did not finish
+		// writing it, so is held until it is as old as a stale lock
+		info, err := os.Stat(Filename)
+		if err != nil {
+			return holder, err
+		}
+		return Holder{Command: "an unknown command", User: "unknown", Host: "unknown", Started: info.ModTime()}, nil
+	}
+	return holder, nil
+}
+
+// isStale is true if the holder has gone: its process is no longer running on this machine, or it is too old to
+// still be running on another
+func (h Holder) isStale(host string) bool {
+	if h.Host == host && h.PID != 0 {
+		return !processAlive(h.PID)
+	}
+	return now().Sub(h.Started) > StaleAfter
+}
+
+func currentHolder(command string) Holder {
+	holder := Holder{
+		Command: command,
+		PID:     os.Getpid(),
+		Started: now(),
+	}
+	holder.Host, _ = os.Hostname()
+	if u, err := user.Current(); err == nil {
+		holder.User = u.Username
+	}
+	return holder
+}
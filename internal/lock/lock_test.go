@@ -0,0 +1,149 @@
+/*
+ * Copyright 2021 Skyscanner Limited.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * https://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package lock
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/skyscanner/turbolift/internal/testsupport"
+)
+
+func TestOnlyOneCommandCanHoldTheLock(t *testing.T) {
+	testsupport.CreateAndEnterTempDirectory()
+	defer func() { processAlive = isProcessAlive }()
+	processAlive = func(int) bool { return true }
+
+	broken, err := Acquire("turbolift create-prs", false)
+	assert.NoError(t, err)
+	assert.Nil(t, broken)
+	held = false // as if the lock were held by another process
+
+	_, err = Acquire("turbolift merge", false)
+	var locked *LockedError
+	assert.ErrorAs(t, err, &locked)
+	assert.Equal(t, "turbolift create-prs", locked.Holder.Command)
+	assert.Contains(t, err.Error(), "use --force-unlock")
+}
+
+func TestReleasingTheLockLetsAnotherCommandTakeIt(t *testing.T) {
+	testsupport.CreateAndEnterTempDirectory()
+
+	_, err := Acquire("turbolift create-prs", false)
+	assert.NoError(t, err)
+	assert.NoError(t, Release())
+	assert.NoFileExists(t, Filename)
+
+	_, err = Acquire("turbolift merge", false)
+	assert.NoError(t, err)
+	assert.NoError(t, Release())
+}
+
+func TestReleaseLeavesALockHeldByAnotherCommand(t *testing.T) {
+	testsupport.CreateAndEnterTempDirectory()
+	writeLock(t, Holder{Command: "turbolift create-prs", Host: "elsewhere", Started: time.Now()})
+
+	assert.NoError(t, Release())
+	assert.FileExists(t, Filename)
+}
+
+func TestItBreaksALockWhoseProcessHasGone(t *testing.T) {
+	testsupport.CreateAndEnterTempDirectory()
+	defer func() { processAlive = isProcessAlive }()
+	processAlive = func(int) bool { return false }
+	host, _ := os.Hostname()
+	writeLock(t, Holder{Command: "turbolift create-prs", Host: host, PID: 12345, Started: time.Now()})
+
+	broken, err := Acquire("turbolift merge", false)
+	assert.NoError(t, err)
+	assert.Equal(t, "turbolift create-prs", broken.Command)
+	assert.NoError(t, Release())
+}
+
+func TestItBreaksALockHeldElsewhereOnlyOnceItIsOld(t *testing.T) {
+	testsupport.CreateAndEnterTempDirectory()
+	writeLock(t, Holder{Command: "turbolift create-prs", Host: "elsewhere", PID: 12345, Started: time.Now().Add(-time.Hour)})
+
+	_, err := Acquire("turbolift merge", false)
+	assert.Error(t, err)
+
+	writeLock(t, Holder{Command: "turbolift create-prs", Host: "elsewhere", PID: 12345, Started: time.Now().Add(-StaleAfter - time.Hour)})
+	broken, err := Acquire("turbolift merge", false)
+	assert.NoError(t, err)
+	assert.NotNil(t, broken)
+	assert.NoError(t, Release())
+}
+
+func TestItBreaksAnUnreadableLockOnlyOnceItIsOld(t *testing.T) {
+	testsupport.CreateAndEnterTempDirectory()
+	assert.NoError(t, ioutil.WriteFile(Filename, []byte("{\"command\": \"turbolift"), 0o644))
+
+	_, err := Acquire("turbolift merge", false)
+	var locked *LockedError
+	assert.ErrorAs(t, err, &locked)
+	assert.Equal(t, "an unknown command", locked.Holder.Command)
+
+	old := time.Now().Add(-StaleAfter - time.Hour)
+	assert.NoError(t, os.Chtimes(Filename, old, old))
+	broken, err := Acquire("turbolift merge", false)
+	assert.NoError(t, err)
+	assert.Equal(t, "an unknown command", broken.Command)
+	assert.NoError(t, Release())
+}
+
+func TestForceUnlockBreaksALockWhichIsStillHeld(t *testing.T) {
+	testsupport.CreateAndEnterTempDirectory()
+	writeLock(t, Holder{Command: "turbolift create-prs", Host: "elsewhere", PID: 12345, Started: time.Now()})
+
+	broken, err := Acquire("turbolift merge", true)
+	assert.NoError(t, err)
+	assert.Equal(t, "elsewhere", broken.Host)
+
+	holder, err := read()
+	assert.NoError(t, err)
+	assert.Equal(t, "turbolift merge", holder.Command)
+	assert.Equal(t, os.Getpid(), holder.PID)
+	assert.NoError(t, Release())
+}
+
+func writeLock(t *testing.T, holder Holder) {
+	contents, err := json.Marshal(holder)
+	assert.NoError(t, err)
+	assert.NoError(t, ioutil.WriteFile(Filename, contents, 0o644))
+}
+
+func TestCommandsRunByTheHolderWorkUnderItsLock(t *testing.T) {
+	testsupport.CreateAndEnterTempDirectory()
+	host, _ := os.Hostname()
+	writeLock(t, Holder{Command: "turbolift add-repo org/repo1", Host: host, PID: 12345, Started: time.Now()})
+	_ = os.Setenv(InheritedEnvVar, "12345")
+	defer func() { _ = os.Unsetenv(InheritedEnvVar) }()
+
+	broken, err := Acquire("turbolift clone", false)
+	assert.NoError(t, err)
+	assert.Nil(t, broken)
+
+	// the lock is left for the holder to release
+	assert.NoError(t, Release())
+	holder, err := read()
+	assert.NoError(t, err)
+	assert.Equal(t, "turbolift add-repo org/repo1", holder.Command)
+}
@@ -0,0 +1,126 @@
+/*
+ * Copyright 2021 Skyscanner Limited.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * https://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package logging
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// Outcome is an activity which ended with a warning or failure
+type Outcome struct {
+	Activity string
+	Message  string
+}
+
+// Results are what happened in a command's activities, which --actions reports as step outputs and a job summary, and
+// which are sent as metrics
+type Results struct {
+	Succeeded int
+	// Successes are the names of the activities which succeeded
+	Successes []string
+	Warnings  []Outcome
+	Failures  []Outcome
+	// Summaries are the messages logged outside activities, such as the command's closing summary
+	Summaries []string
+	// Errors counts the errors logged outside activities, of which UsageErrors were problems with flags or arguments
+	Errors      int
+	UsageErrors int
+}
+
+var (
+	resultsMutex sync.Mutex
+	results      Results
+)
+
+// CurrentResults returns what has happened in the activities of all loggers. Summaries are only recorded by loggers
+// writing GitHub Actions workflow commands.
+func CurrentResults() Results {
+	resultsMutex.Lock()
+	defer resultsMutex.Unlock()
+	return Results{
+		Succeeded:   results.Succeeded,
+		Successes:   append([]string(nil), results.Successes...),
+		Warnings:    append([]Outcome(nil), results.Warnings...),
+		Failures:    append([]Outcome(nil), results.Failures...),
+		Summaries:   append([]string(nil), results.Summaries...),
+		Errors:      results.Errors,
+		UsageErrors: results.UsageErrors,
+	}
+}
+
+// ResetResults forgets what has happened so far, so that a later command reports only its own activities
+func ResetResults() {
+	resultsMutex.Lock()
+	defer resultsMutex.Unlock()
+	results = Results{}
+}
+
+func recordSuccess(activity string) {
+	resultsMutex.Lock()
+	defer resultsMutex.Unlock()
+	results.Succeeded++
+	results.Successes = append(results.Successes, activity)
+}
+
+func recordWarning(activity string, message string) {
+	resultsMutex.Lock()
+	defer resultsMutex.Unlock()
+	results.Warnings = append(results.Warnings, Outcome{Activity: activity, Message: message})
+}
+
+func recordFailure(activity string, message string) {
+	resultsMutex.Lock()
+	defer resultsMutex.Unlock()
+	results.Failures = append(results.Failures, Outcome{Activity: activity, Message: message})
+}
+
+func recordError() {
+	resultsMutex.Lock()
+	defer resultsMutex.Unlock()
+	results.Errors++
+}
+
+func recordUsageError() {
+	resultsMutex.Lock()
+	defer resultsMutex.Unlock()
+	results.UsageErrors++
+}
+
+func recordSummary(message string) {
+	resultsMutex.Lock()
+	defer resultsMutex.Unlock()
+	results.Summaries = append(results.Summaries, message)
+}
+
+// workflowCommand formats a GitHub Actions workflow command, e.g. ::error title=Cloning org/repo::message
+func workflowCommand(command string, title string, message string) string {
+	if title == "" {
+		return fmt.Sprintf("::%s::%s", command, escapeWorkflowData(message))
+	}
+	return fmt.Sprintf("::%s title=%s::%s", command, escapeWorkflowProperty(title), escapeWorkflowData(message))
+}
+
+// escapeWorkflowData escapes the message of a workflow command, which must fit on one line
+func escapeWorkflowData(s string) string {
+	return strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A").Replace(s)
+}
+
+// escapeWorkflowProperty escapes a property of a workflow command, such as an annotation's title
+func escapeWorkflowProperty(s string) string {
+	return strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A", ":", "%3A", ",", "%2C").Replace(s)
+}
@@ -21,60 +21,183 @@ import (
 	"github.com/skyscanner/turbolift/internal/colors"
 	"io"
 	"strings"
+	"sync"
+	"time"
 )
 
 // Activity is a buffered logger associated with an on-screen spinner.
 // As well as being able to signal completion state (EndWithSuccess, EndWithWarning and EndWithFailure), logs can be
-// buffered. Whether or not the logs are actually displayed depends on the completion state.
+// buffered. Whether or not the logs are actually displayed depends on the completion state and the verbosity level:
+// at Verbose, logs are displayed inline as they arrive instead of a spinner, and at Quiet, successful activities are
+// not displayed at all. Without a spinner, the start and end of activities are displayed as separate lines, which are
+// timestamped when not writing to a terminal.
+// Concurrent activities hold back everything they would display until they end, so that they can run alongside
+// each other without interleaving their output.
 type Activity struct {
-	name    string
-	logs    []string
-	spinner *spinner.Spinner
-	writer  io.Writer
-	verbose bool
+	name       string
+	logs       []string
+	spinner    *spinner.Spinner
+	writer     io.Writer
+	level      Level
+	timestamps bool
+	// timing is set with --timing, to display when the activity started and how long it took
+	timing  bool
+	started time.Time
+	// actions is set with --actions, to display the activity as a group in the GitHub Actions log
+	actions bool
+	// setup is set for activities which prepare a command rather than doing its work, so their success is not counted
+	setup bool
+
+	// mutex guards the logs and held back output, as an activity's Writer may be shared by several goroutines
+	mutex             sync.Mutex
+	buffered          bool
+	pendingOutput     []string
+	pendingTranscript []string
 }
 
 func (a *Activity) Log(message string) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
 	a.logs = append(a.logs, message)
+	a.transcribe("     " + message)
+
+	if a.level == Verbose || a.actions {
+		a.print("     " + colors.White(message))
+	}
 }
 
 func (a *Activity) Logf(format string, args ...interface{}) {
 	a.Log(fmt.Sprintf(format, args...))
 }
 
+// print displays a line, or holds it back until the end of a concurrent activity
+func (a *Activity) print(line string) {
+	if a.buffered {
+		a.pendingOutput = append(a.pendingOutput, line)
+		return
+	}
+	outputMutex.Lock()
+	defer outputMutex.Unlock()
+	_, _ = fmt.Fprintln(a.writer, line)
+}
+
+// transcribe writes to the transcript, or holds the entry back until the end of a concurrent activity
+func (a *Activity) transcribe(s string) {
+	if a.buffered {
+		a.pendingTranscript = append(a.pendingTranscript, s)
+		return
+	}
+	writeTranscript(s)
+}
+
+// flush writes out everything held back by a concurrent activity
+func (a *Activity) flush() {
+	if !a.buffered {
+		return
+	}
+	outputMutex.Lock()
+	defer outputMutex.Unlock()
+	for _, line := range a.pendingOutput {
+		_, _ = fmt.Fprintln(a.writer, line)
+	}
+	for _, s := range a.pendingTranscript {
+		writeTranscriptLocked(s)
+	}
+	a.pendingOutput = nil
+	a.pendingTranscript = nil
+}
+
 func (a *Activity) emitLogs(colourTransform func(...interface{}) string) {
-	_, _ = fmt.Fprintln(a.writer)
+	// logs have already been displayed inline
+	if a.level == Verbose || a.actions {
+		return
+	}
+
+	a.print("")
 
 	for _, log := range a.logs {
-		_, _ = fmt.Fprint(a.writer, "     ")
-		_, _ = fmt.Fprintln(a.writer, colourTransform(log))
+		a.print("     " + colourTransform(log))
+	}
+}
+
+// finish replaces the spinner (if any) with the final message of the activity
+func (a *Activity) finish(finalMsg string) {
+	a.transcribe(finalMsg)
+	if a.spinner != nil {
+		outputMutex.Lock()
+		defer outputMutex.Unlock()
+		a.spinner.FinalMSG = finalMsg
+		a.spinner.Stop()
+		_, _ = fmt.Fprintln(a.writer)
+	} else {
+		a.printLine(finalMsg)
+	}
+}
+
+// title is the name of the activity as displayed when it ends, which with --timing includes when it started and how
+// long it took
+func (a *Activity) title() string {
+	if !a.timing {
+		return a.name
+	}
+	return fmt.Sprintf("%s (started %s, took %s)", a.name, a.started.Format("15:04:05"), FormatDuration(time.Since(a.started)))
+}
+
+// FormatDuration rounds a duration for display, to the millisecond below a second and to a tenth of a second above
+func FormatDuration(d time.Duration) string {
+	if d < time.Second {
+		return d.Round(time.Millisecond).String()
 	}
+	return d.Round(100 * time.Millisecond).String()
+}
+
+func (a *Activity) printLine(line string) {
+	if a.timestamps {
+		line = fmt.Sprintf("%s %s", time.Now().Format("15:04:05"), line)
+	}
+	a.print(line)
 }
 
 func (a *Activity) EndWithSuccess() {
-	a.spinner.FinalMSG = fmt.Sprintf("%s %s", colors.Pass("  OK  "), a.name)
-	a.spinner.Stop()
-	_, _ = fmt.Fprintln(a.writer)
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	defer a.flush()
 
-	if a.verbose {
-		a.emitLogs(colors.White)
+	if a.level == Quiet && !a.actions {
+		a.transcribe(fmt.Sprintf("  OK   %s", a.title()))
+		a.recordSuccess()
+		return
 	}
+	a.finish(fmt.Sprintf("%s %s", colors.Pass("  OK  "), a.title()))
+	a.endGroup("", "")
 }
 
 func (a *Activity) EndWithSuccessAndEmitLogs() {
-	a.spinner.FinalMSG = fmt.Sprintf("%s %s", colors.Pass("  OK  "), a.name)
-	a.spinner.Stop()
-	_, _ = fmt.Fprintln(a.writer)
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	defer a.flush()
+
+	if a.level == Quiet && !a.actions {
+		a.transcribe(fmt.Sprintf("  OK   %s", a.title()))
+		a.recordSuccess()
+		return
+	}
+	a.finish(fmt.Sprintf("%s %s", colors.Pass("  OK  "), a.title()))
 
 	a.emitLogs(colors.White)
+	a.endGroup("", "")
 }
 
 func (a *Activity) EndWithWarning(message interface{}) {
-	a.spinner.FinalMSG = fmt.Sprintf(colors.Warn(" WARN ")+colors.Yellow(" %s: %s"), a.name, message)
-	a.spinner.Stop()
-	_, _ = fmt.Fprintln(a.writer)
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	defer a.flush()
+
+	a.finish(fmt.Sprintf(colors.Warn(" WARN ")+colors.Yellow(" %s: %s"), a.title(), message))
 
 	a.emitLogs(colors.Yellow)
+	a.endGroup("warning", fmt.Sprint(message))
 }
 
 func (a *Activity) EndWithWarningf(format string, args ...interface{}) {
@@ -82,11 +205,41 @@ func (a *Activity) EndWithWarningf(format string, args ...interface{}) {
 }
 
 func (a *Activity) EndWithFailure(message interface{}) {
-	a.spinner.FinalMSG = fmt.Sprintf(colors.Fail(" FAIL ")+colors.Red(" %s: %s"), a.name, message)
-	a.spinner.Stop()
-	_, _ = fmt.Fprintln(a.writer)
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	defer a.flush()
+
+	a.finish(fmt.Sprintf(colors.Fail(" FAIL ")+colors.Red(" %s: %s"), a.title(), message))
 
 	a.emitLogs(colors.Red)
+	a.endGroup("error", fmt.Sprint(message))
+}
+
+func (a *Activity) recordSuccess() {
+	if !a.setup {
+		recordSuccess(a.name)
+	}
+}
+
+// endGroup records the outcome of the activity, for the job summary and metrics, and with --actions closes its group
+// in the GitHub Actions log, annotating the activity as a warning or error if one of those is given
+func (a *Activity) endGroup(annotation string, message string) {
+	switch annotation {
+	case "warning":
+		recordWarning(a.name, message)
+	case "error":
+		recordFailure(a.name, message)
+	default:
+		a.recordSuccess()
+	}
+
+	if !a.actions {
+		return
+	}
+	a.print(workflowCommand("endgroup", "", ""))
+	if annotation != "" {
+		a.print(workflowCommand(annotation, a.name, message))
+	}
 }
 
 func (a *Activity) EndWithFailuref(format string, args ...interface{}) {
@@ -18,70 +18,182 @@ package logging
 import (
 	"fmt"
 	"io"
+	"os"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/briandowns/spinner"
+	"github.com/mattn/go-isatty"
 	"github.com/skyscanner/turbolift/cmd/flags"
 	"github.com/skyscanner/turbolift/internal/colors"
 	"github.com/spf13/cobra"
 )
 
+// Level controls how much of the output of activities is displayed
+type Level int
+
+const (
+	Quiet Level = iota
+	Normal
+	Verbose
+)
+
+// outputMutex serialises writes to the output and the transcript, so that activities running concurrently cannot
+// corrupt each other's lines
+var outputMutex sync.Mutex
+
 // Logger is a facade for CLI logging.
+// When not writing to a terminal (e.g. in CI), activities are rendered as plain, timestamped lines instead of spinners.
+// With --actions, each activity is a collapsible group in the GitHub Actions log, and warnings and failures are
+// annotations.
 type Logger struct {
-	writer  io.Writer
-	verbose bool
+	writer      io.Writer
+	level       Level
+	interactive bool
+	actions     bool
+	timing      bool
 }
 
 // NewLogger creates a Logger associated with a particular *cobra.Command instance.
 // Logs will be delivered to the command's stdout writer.
 func NewLogger(c *cobra.Command) *Logger {
+	level := Normal
+	if flags.Verbose {
+		level = Verbose
+	} else if flags.Quiet {
+		level = Quiet
+	}
+
+	writer := c.OutOrStdout()
 	return &Logger{
-		writer:  c.OutOrStdout(),
-		verbose: flags.Verbose,
+		writer:      writer,
+		level:       level,
+		interactive: isTerminal(writer) && !flags.Actions,
+		actions:     flags.Actions,
+		timing:      flags.Timing,
 	}
 }
 
+func isTerminal(writer io.Writer) bool {
+	file, ok := writer.(*os.File)
+	return ok && (isatty.IsTerminal(file.Fd()) || isatty.IsCygwinTerminal(file.Fd()))
+}
+
 func (log *Logger) Printf(s string, args ...interface{}) {
+	outputMutex.Lock()
+	defer outputMutex.Unlock()
 	_, _ = fmt.Fprintf(log.writer, s, args...)
 	_, _ = fmt.Fprintln(log.writer)
+	writeTranscriptLocked(fmt.Sprintf(s, args...))
 }
 
 func (log *Logger) Println(s ...interface{}) {
+	outputMutex.Lock()
+	defer outputMutex.Unlock()
 	_, _ = fmt.Fprintln(log.writer, s...)
+	writeTranscriptLocked(fmt.Sprintln(s...))
 }
 
 func (log *Logger) Successf(format string, args ...interface{}) {
+	log.summarise("", format, args...)
 	prefixedFormat := fmt.Sprint(colors.Pass("  OK  "), " ", colors.Green(format))
 	log.Printf(prefixedFormat, args...)
 }
 
 func (log *Logger) Warnf(format string, args ...interface{}) {
+	log.summarise("warning", format, args...)
 	prefixedFormat := fmt.Sprint(colors.Warn(" WARN "), " ", colors.Yellow(format))
 	log.Printf(prefixedFormat, args...)
 }
 
 func (log *Logger) Errorf(format string, args ...interface{}) {
+	recordError()
+	log.summarise("error", format, args...)
 	prefixedFormat := fmt.Sprint(colors.Warn("  ERR "), " ", colors.Red(format))
 	log.Printf(prefixedFormat, args...)
 }
 
+// FlagErrorf reports that the command cannot run because of its flags or arguments, which it exits with a distinct
+// code for
+func (log *Logger) FlagErrorf(format string, args ...interface{}) {
+	recordUsageError()
+	log.Errorf("Error while parsing the flags: "+format, args...)
+}
+
+// summarise records a message for the job summary with --actions, and annotates it as a warning or error if one of
+// those is given
+func (log *Logger) summarise(annotation string, format string, args ...interface{}) {
+	if !log.actions {
+		return
+	}
+	message := strings.TrimSpace(fmt.Sprintf(format, args...))
+	recordSummary(message)
+	if annotation != "" {
+		log.Printf("%s", workflowCommand(annotation, "", message))
+	}
+}
+
 // StartActivity creates and starts an *Activity with an associated spinner.
 // Only once Activity should be active at any given time, and the Activity should be completed before any other logging
-// is performed using this Logger.
+// is performed using this Logger. Use StartConcurrentActivity for activities which run in parallel.
 func (log *Logger) StartActivity(format string, args ...interface{}) *Activity {
-	name := fmt.Sprintf(format, args...)
-	s := spinner.New(spinner.CharSets[11], 100*time.Millisecond) // Build our new spinner
-	s.Suffix = fmt.Sprintf("  %s", name)
-	s.Writer = log.writer
-	s.HideCursor = true
-	s.Start()
+	activity := log.newActivity(fmt.Sprintf(format, args...), false)
+	activity.transcribe(fmt.Sprintf("  ..   %s", activity.name))
+
+	switch {
+	case log.actions:
+		activity.print(workflowCommand("group", "", activity.name))
+	case log.level == Verbose || (log.level == Normal && !log.interactive):
+		// no spinner, as logs are displayed inline or output is not going to a terminal
+		activity.printLine(fmt.Sprintf("%s %s", colors.Normal("  ..  "), activity.name))
+	case log.level == Normal:
+		s := spinner.New(spinner.CharSets[11], 100*time.Millisecond) // Build our new spinner
+		s.Suffix = fmt.Sprintf("  %s", activity.name)
+		s.Writer = log.writer
+		s.HideCursor = true
+		s.Start()
+		activity.spinner = s
+	}
+
+	return activity
+}
+
+// StartSetupActivity starts an *Activity like StartActivity, for preparing a command, such as reading the campaign's
+// data. It is not counted as part of the command's work when deciding whether the command as a whole failed.
+func (log *Logger) StartSetupActivity(format string, args ...interface{}) *Activity {
+	activity := log.StartActivity(format, args...)
+	activity.setup = true
+	return activity
+}
+
+// StartConcurrentActivity creates and starts an *Activity which can run at the same time as other concurrent
+// activities, e.g. from separate goroutines. It has no spinner; instead, all of its output (and its part of the
+// transcript) is held back until it ends, and is then written in one piece.
+func (log *Logger) StartConcurrentActivity(format string, args ...interface{}) *Activity {
+	activity := log.newActivity(fmt.Sprintf(format, args...), true)
+	activity.transcribe(fmt.Sprintf("  ..   %s", activity.name))
+
+	if log.actions {
+		activity.print(workflowCommand("group", "", activity.name))
+	} else if log.level == Verbose || (log.level == Normal && !log.interactive) {
+		activity.printLine(fmt.Sprintf("%s %s", colors.Normal("  ..  "), activity.name))
+	}
+
+	return activity
+}
 
+func (log *Logger) newActivity(name string, buffered bool) *Activity {
 	return &Activity{
-		name:    name,
-		logs:    []string{},
-		spinner: s,
-		writer:  log.writer,
-		verbose: log.verbose,
+		name:       name,
+		logs:       []string{},
+		writer:     log.writer,
+		level:      log.level,
+		timestamps: !log.interactive,
+		timing:     log.timing,
+		started:    time.Now(),
+		buffered:   buffered,
+		actions:    log.actions,
 	}
 }
 
@@ -0,0 +1,193 @@
+/*
+ * Copyright 2021 Skyscanner Limited.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * https://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package logging
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func init() {
+	_ = os.Setenv("NO_COLOR", "1")
+}
+
+func TestVerboseActivitiesDisplayLogsInline(t *testing.T) {
+	out := bytes.NewBufferString("")
+	logger := &Logger{writer: out, level: Verbose, interactive: true}
+
+	activity := logger.StartActivity("Cloning %s", "org/repo1")
+	activity.Log("Cloning into 'repo1'...")
+	assert.Equal(t, "  ..   Cloning org/repo1\n     Cloning into 'repo1'...\n", out.String())
+
+	activity.EndWithFailure("synthetic error")
+	assert.Equal(t, "  ..   Cloning org/repo1\n     Cloning into 'repo1'...\n FAIL  Cloning org/repo1: synthetic error\n", out.String())
+}
+
+func TestQuietActivitiesOnlyDisplayProblems(t *testing.T) {
+	out := bytes.NewBufferString("")
+	logger := &Logger{writer: out, level: Quiet, interactive: true}
+
+	activity := logger.StartActivity("Cloning %s", "org/repo1")
+	activity.Log("Cloning into 'repo1'...")
+	activity.EndWithSuccess()
+	assert.Equal(t, "", out.String())
+
+	activity = logger.StartActivity("Cloning %s", "org/repo2")
+	activity.Log("Permission denied")
+	activity.EndWithWarning("skipped")
+	assert.Equal(t, " WARN  Cloning org/repo2: skipped\n\n     Permission denied\n", out.String())
+
+	logger.Successf("turbolift clone completed")
+	assert.Contains(t, out.String(), "turbolift clone completed")
+}
+
+func TestNonInteractiveActivitiesAreDisplayedAsTimestampedLines(t *testing.T) {
+	out := bytes.NewBufferString("")
+	logger := &Logger{writer: out, level: Normal, interactive: false}
+
+	activity := logger.StartActivity("Cloning %s", "org/repo1")
+	activity.Log("Cloning into 'repo1'...")
+	activity.EndWithSuccess()
+
+	assert.Regexp(t, "^\\d\\d:\\d\\d:\\d\\d   \\.\\.   Cloning org/repo1\n\\d\\d:\\d\\d:\\d\\d   OK   Cloning org/repo1\n$", out.String())
+}
+
+func TestTimedActivitiesShowWhenTheyStartedAndHowLongTheyTook(t *testing.T) {
+	out := bytes.NewBufferString("")
+	logger := &Logger{writer: out, level: Verbose, interactive: true, timing: true}
+
+	activity := logger.StartActivity("Cloning %s", "org/repo1")
+	activity.started = time.Now().Add(-1500 * time.Millisecond)
+	activity.EndWithFailure("synthetic error")
+
+	assert.Equal(t, "  ..   Cloning org/repo1\n FAIL  Cloning org/repo1 (started "+activity.started.Format("15:04:05")+", took 1.5s): synthetic error\n", out.String())
+}
+
+func TestItFormatsDurations(t *testing.T) {
+	assert.Equal(t, "235ms", FormatDuration(234567*time.Microsecond))
+	assert.Equal(t, "1m2.3s", FormatDuration(62345*time.Millisecond))
+}
+
+func TestActionsActivitiesAreGroupsWithAnnotatedProblems(t *testing.T) {
+	ResetResults()
+	out := bytes.NewBufferString("")
+	logger := &Logger{writer: out, level: Normal, actions: true}
+
+	activity := logger.StartActivity("Cloning %s", "org/repo1")
+	activity.Log("Cloning into 'repo1'...")
+	activity.EndWithSuccess()
+
+	activity = logger.StartActivity("Cloning %s", "org/repo2")
+	activity.EndWithFailure("permission denied\nfor org/repo2")
+
+	logger.Warnf("turbolift clone completed with errors (1 OK, 1 errored)\n")
+
+	assert.Regexp(t, "^::group::Cloning org/repo1\n     Cloning into 'repo1'...\n\\d\\d:\\d\\d:\\d\\d   OK   Cloning org/repo1\n::endgroup::\n", out.String())
+	assert.Contains(t, out.String(), "::endgroup::\n::error title=Cloning org/repo2::permission denied%0Afor org/repo2\n")
+	assert.Contains(t, out.String(), "::warning::turbolift clone completed with errors (1 OK, 1 errored)\n")
+
+	assert.Equal(t, Results{
+		Succeeded: 1,
+		Successes: []string{"Cloning org/repo1"},
+		Failures:  []Outcome{{Activity: "Cloning org/repo2", Message: "permission denied\nfor org/repo2"}},
+		Summaries: []string{"turbolift clone completed with errors (1 OK, 1 errored)"},
+	}, CurrentResults())
+}
+
+func TestSetupActivitiesAndFlagErrorsAreRecordedSeparatelyFromWork(t *testing.T) {
+	ResetResults()
+	logger := &Logger{writer: bytes.NewBufferString(""), level: Quiet}
+
+	logger.StartSetupActivity("Reading campaign data").EndWithSuccess()
+	logger.FlagErrorf("unknown flag --foo")
+	logger.Errorf("Unable to read the campaign")
+
+	assert.Equal(t, Results{
+		Errors:      2,
+		UsageErrors: 1,
+	}, CurrentResults())
+}
+
+func TestConcurrentActivitiesDoNotInterleave(t *testing.T) {
+	out := bytes.NewBufferString("")
+	logger := &Logger{writer: out, level: Verbose, interactive: true}
+
+	first := logger.StartConcurrentActivity("Cloning %s", "org/repo1")
+	second := logger.StartConcurrentActivity("Cloning %s", "org/repo2")
+	first.Log("Cloning into 'repo1'...")
+	second.Log("Cloning into 'repo2'...")
+	assert.Equal(t, "", out.String())
+
+	second.EndWithSuccess()
+	first.EndWithFailure("synthetic error")
+	assert.Equal(t, "  ..   Cloning org/repo2\n     Cloning into 'repo2'...\n  OK   Cloning org/repo2\n"+
+		"  ..   Cloning org/repo1\n     Cloning into 'repo1'...\n FAIL  Cloning org/repo1: synthetic error\n", out.String())
+}
+
+func TestConcurrentActivitiesCanBeUsedFromManyGoroutines(t *testing.T) {
+	out := bytes.NewBufferString("")
+	logger := &Logger{writer: out, level: Normal, interactive: true}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			activity := logger.StartConcurrentActivity("Activity %d", i)
+			writer := activity.Writer()
+			for j := 0; j < 10; j++ {
+				_, _ = writer.Write([]byte("some output\n"))
+			}
+			activity.EndWithWarning("done")
+		}(i)
+	}
+	wg.Wait()
+
+	// each activity's warning is immediately followed by a blank line and all of its logs
+	blocks := strings.Split(out.String(), " WARN ")[1:]
+	assert.Len(t, blocks, 20)
+	for _, block := range blocks {
+		assert.Regexp(t, "^ Activity \\d+: done\n\n(     some output\n){10}$", block)
+	}
+}
+
+func TestItWritesAPlainTranscriptIncludingHiddenLogs(t *testing.T) {
+	logFile := filepath.Join(t.TempDir(), "turbolift.log")
+	closer, err := OpenTranscript(logFile, "turbolift clone")
+	assert.NoError(t, err)
+
+	logger := &Logger{writer: bytes.NewBufferString(""), level: Quiet}
+	activity := logger.StartActivity("Cloning %s", "org/repo1")
+	activity.Log("Cloning into 'repo1'...")
+	activity.EndWithSuccess()
+	logger.Successf("turbolift clone completed")
+
+	assert.NoError(t, CloseTranscript(closer))
+
+	contents, err := ioutil.ReadFile(logFile)
+	assert.NoError(t, err)
+	withoutTimestamps := regexp.MustCompile(`(?m)^\S+ `).ReplaceAllString(string(contents), "")
+	assert.Equal(t, "turbolift clone\n  ..   Cloning org/repo1\n     Cloning into 'repo1'...\n  OK   Cloning org/repo1\n  OK   turbolift clone completed\n", withoutTimestamps)
+}
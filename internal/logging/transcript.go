@@ -0,0 +1,67 @@
+/*
+ * Copyright 2021 Skyscanner Limited.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * https://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package logging
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+)
+
+var (
+	transcript io.Writer
+
+	ansiEscapeSequence = regexp.MustCompile("\x1b\\[[0-9;]*m")
+)
+
+// OpenTranscript starts appending a plain, timestamped transcript of all output, including the output of
+// subprocesses that would not otherwise be displayed, to the given file
+func OpenTranscript(filename string, header string) (io.Closer, error) {
+	file, err := os.OpenFile(filename, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("unable to open log file: %w", err)
+	}
+	transcript = file
+	writeTranscript(header)
+	return file, nil
+}
+
+// CloseTranscript stops writing the transcript
+func CloseTranscript(closer io.Closer) error {
+	transcript = nil
+	return closer.Close()
+}
+
+func writeTranscript(s string) {
+	outputMutex.Lock()
+	defer outputMutex.Unlock()
+	writeTranscriptLocked(s)
+}
+
+// writeTranscriptLocked writes to the transcript when outputMutex is already held
+func writeTranscriptLocked(s string) {
+	if transcript == nil {
+		return
+	}
+
+	timestamp := time.Now().Format(time.RFC3339)
+	for _, line := range strings.Split(strings.TrimRight(ansiEscapeSequence.ReplaceAllString(s, ""), "\n"), "\n") {
+		_, _ = fmt.Fprintf(transcript, "%s %s\n", timestamp, line)
+	}
+}
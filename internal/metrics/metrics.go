@@ -0,0 +1,162 @@
+/*
+ * Copyright 2021 Skyscanner Limited.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * https://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package metrics
+
+import (
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/skyscanner/turbolift/internal/audit"
+	"github.com/skyscanner/turbolift/internal/config"
+)
+
+// Run is what happened in a run of a turbolift command
+type Run struct {
+	Command   string
+	Campaign  string
+	Duration  time.Duration
+	Succeeded int
+	Warnings  int
+	Failed    int
+}
+
+// Kind is how a metric's value is aggregated
+type Kind int
+
+const (
+	// Counter is a count of things which happened during the run
+	Counter Kind = iota
+	// Timing is a duration in milliseconds
+	Timing
+)
+
+// Metric is a single measurement of a run
+type Metric struct {
+	Name  string
+	Kind  Kind
+	Value int64
+	Tags  map[string]string
+}
+
+var (
+	mutex     sync.Mutex
+	processes = map[string]int{}
+	failures  = map[string]int{}
+	repos     = map[string]bool{}
+)
+
+// RecordProcess counts an external process run by turbolift, such as a call to the GitHub API through gh, along with
+// the repository it ran in, if any
+func RecordProcess(name string, workingDir string, err error) {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	processes[name]++
+	if err != nil {
+		failures[name]++
+	}
+	if repo := audit.RepoOf(workingDir); repo != "" {
+		repos[repo] = true
+	}
+}
+
+func reset() {
+	mutex.Lock()
+	defer mutex.Unlock()
+	processes = map[string]int{}
+	failures = map[string]int{}
+	repos = map[string]bool{}
+}
+
+// Metrics returns the measurements of the run, each tagged with the command, campaign and outcome as well as the
+// given tags
+func (r Run) Metrics(extraTags map[string]string) []Metric {
+	outcome := "success"
+	if r.Failed > 0 {
+		outcome = "failure"
+	}
+	tags := func(more ...string) map[string]string {
+		all := map[string]string{"command": r.Command, "campaign": r.Campaign, "outcome": outcome}
+		for name, value := range extraTags {
+			all[name] = value
+		}
+		for i := 0; i+1 < len(more); i += 2 {
+			all[more[i]] = more[i+1]
+		}
+		return all
+	}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	metrics := []Metric{
+		{Name: "turbolift.runs", Kind: Counter, Value: 1, Tags: tags()},
+		{Name: "turbolift.duration", Kind: Timing, Value: r.Duration.Milliseconds(), Tags: tags()},
+		{Name: "turbolift.repos", Kind: Counter, Value: int64(len(repos)), Tags: tags()},
+		{Name: "turbolift.activities", Kind: Counter, Value: int64(r.Succeeded), Tags: tags("result", "succeeded")},
+		{Name: "turbolift.activities", Kind: Counter, Value: int64(r.Warnings), Tags: tags("result", "warning")},
+		{Name: "turbolift.activities", Kind: Counter, Value: int64(r.Failed), Tags: tags("result", "failed")},
+		{Name: "turbolift.api_calls", Kind: Counter, Value: int64(processes["gh"]), Tags: tags()},
+	}
+
+	var names []string
+	for name := range processes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		metrics = append(metrics,
+			Metric{Name: "turbolift.processes", Kind: Counter, Value: int64(processes[name]), Tags: tags("tool", name)},
+			Metric{Name: "turbolift.process_failures", Kind: Counter, Value: int64(failures[name]), Tags: tags("tool", name)},
+		)
+	}
+	return metrics
+}
+
+// Send sends the metrics of the run to each configured endpoint, returning the errors of any which could not be
+// reached
+func Send(cfg config.Metrics, run Run) error {
+	metrics := run.Metrics(cfg.Tags)
+
+	var problems []string
+	if cfg.Statsd != "" {
+		if err := sendStatsd(cfg.Statsd, metrics); err != nil {
+			problems = append(problems, err.Error())
+		}
+	}
+	if cfg.OTLP != "" {
+		if err := sendOTLP(cfg.OTLP, cfg.OTLPHeaders, metrics); err != nil {
+			problems = append(problems, err.Error())
+		}
+	}
+	if len(problems) > 0 {
+		return errors.New(strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// sortedTags returns the names of a metric's tags in alphabetical order, so that they are sent in a stable order
+func sortedTags(tags map[string]string) []string {
+	var names []string
+	for name := range tags {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
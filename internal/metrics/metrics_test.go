@@ -0,0 +1,114 @@
+/*
+ * Copyright 2021 Skyscanner Limited.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * https://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package metrics
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/skyscanner/turbolift/internal/config"
+)
+
+func TestItMeasuresTheRun(t *testing.T) {
+	reset()
+	RecordProcess("gh", "work/org/repo1", nil)
+	RecordProcess("gh", "work/org/repo2", errors.New("synthetic error"))
+	RecordProcess("git", "work/org/repo1", nil)
+
+	run := Run{Command: "create-prs", Campaign: "my-campaign", Duration: 1500 * time.Millisecond, Succeeded: 3, Failed: 1}
+	metrics := run.Metrics(map[string]string{"team": "platform"})
+
+	tags := map[string]string{"command": "create-prs", "campaign": "my-campaign", "outcome": "failure", "team": "platform"}
+	assert.Contains(t, metrics, Metric{Name: "turbolift.runs", Kind: Counter, Value: 1, Tags: tags})
+	assert.Contains(t, metrics, Metric{Name: "turbolift.duration", Kind: Timing, Value: 1500, Tags: tags})
+	assert.Contains(t, metrics, Metric{Name: "turbolift.repos", Kind: Counter, Value: 2, Tags: tags})
+	assert.Contains(t, metrics, Metric{Name: "turbolift.api_calls", Kind: Counter, Value: 2, Tags: tags})
+	assert.Contains(t, metrics, Metric{Name: "turbolift.activities", Kind: Counter, Value: 1, Tags: withTag(tags, "result", "failed")})
+	assert.Contains(t, metrics, Metric{Name: "turbolift.process_failures", Kind: Counter, Value: 1, Tags: withTag(tags, "tool", "gh")})
+	assert.Contains(t, metrics, Metric{Name: "turbolift.processes", Kind: Counter, Value: 1, Tags: withTag(tags, "tool", "git")})
+}
+
+func TestItFormatsStatsdLinesWithTags(t *testing.T) {
+	line := statsdLine(Metric{Name: "turbolift.duration", Kind: Timing, Value: 1500, Tags: map[string]string{"command": "clone", "campaign": "a,b"}})
+	assert.Equal(t, "turbolift.duration:1500|ms|#campaign:a_b,command:clone", line)
+}
+
+func TestItSendsMetricsToStatsd(t *testing.T) {
+	reset()
+	listener, err := net.ListenPacket("udp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer func() { _ = listener.Close() }()
+
+	err = Send(config.Metrics{Statsd: listener.LocalAddr().String()}, Run{Command: "clone", Campaign: "my-campaign"})
+	assert.NoError(t, err)
+
+	buffer := make([]byte, 1024)
+	_ = listener.SetReadDeadline(time.Now().Add(5 * time.Second))
+	n, _, err := listener.ReadFrom(buffer)
+	assert.NoError(t, err)
+	assert.Equal(t, "turbolift.runs:1|c|#campaign:my-campaign,command:clone,outcome:success", string(buffer[:n]))
+}
+
+func TestItSendsMetricsToAnOpenTelemetryCollector(t *testing.T) {
+	reset()
+	var path, authorization string
+	var request map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+		authorization = r.Header.Get("Authorization")
+		body, _ := ioutil.ReadAll(r.Body)
+		_ = json.Unmarshal(body, &request)
+	}))
+	defer server.Close()
+
+	cfg := config.Metrics{OTLP: server.URL, OTLPHeaders: map[string]string{"Authorization": "Bearer secret"}}
+	assert.NoError(t, Send(cfg, Run{Command: "clone", Campaign: "my-campaign"}))
+
+	assert.Equal(t, "/v1/metrics", path)
+	assert.Equal(t, "Bearer secret", authorization)
+	encoded, _ := json.Marshal(request)
+	assert.Contains(t, string(encoded), `"name":"turbolift.runs"`)
+	assert.Contains(t, string(encoded), `"aggregationTemporality":1`)
+	assert.Contains(t, string(encoded), `"unit":"ms"`)
+}
+
+func TestItReportsCollectorsWhichRejectMetrics(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer server.Close()
+
+	err := Send(config.Metrics{OTLP: server.URL + "/v1/metrics"}, Run{Command: "clone"})
+	assert.Error(t, err)
+	assert.True(t, strings.Contains(err.Error(), "401"))
+}
+
+func withTag(tags map[string]string, name string, value string) map[string]string {
+	all := map[string]string{name: value}
+	for k, v := range tags {
+		all[k] = v
+	}
+	return all
+}
@@ -0,0 +1,135 @@
+/*
+ * Copyright 2021 Skyscanner Limited.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * https://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package metrics
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var client = &http.Client{Timeout: 10 * time.Second}
+
+// aggregationTemporalityDelta marks counters as counting only what happened during the run
+const aggregationTemporalityDelta = 1
+
+type otlpAttribute struct {
+	Key   string `json:"key"`
+	Value struct {
+		StringValue string `json:"stringValue"`
+	} `json:"value"`
+}
+
+type otlpDataPoint struct {
+	Attributes        []otlpAttribute `json:"attributes"`
+	StartTimeUnixNano string          `json:"startTimeUnixNano,omitempty"`
+	TimeUnixNano      string          `json:"timeUnixNano"`
+	AsInt             string          `json:"asInt"`
+}
+
+type otlpSum struct {
+	DataPoints             []otlpDataPoint `json:"dataPoints"`
+	AggregationTemporality int             `json:"aggregationTemporality"`
+	IsMonotonic            bool            `json:"isMonotonic"`
+}
+
+type otlpGauge struct {
+	DataPoints []otlpDataPoint `json:"dataPoints"`
+}
+
+type otlpMetric struct {
+	Name  string     `json:"name"`
+	Unit  string     `json:"unit,omitempty"`
+	Sum   *otlpSum   `json:"sum,omitempty"`
+	Gauge *otlpGauge `json:"gauge,omitempty"`
+}
+
+// otlpRequest builds an OTLP ExportMetricsServiceRequest in its JSON encoding, with counters as delta sums and
+// timings as gauges in milliseconds
+func otlpRequest(metrics []Metric, now time.Time) map[string]interface{} {
+	var exported []otlpMetric
+	for _, metric := range metrics {
+		point := otlpDataPoint{
+			TimeUnixNano: strconv.FormatInt(now.UnixNano(), 10),
+			AsInt:        strconv.FormatInt(metric.Value, 10),
+		}
+		for _, name := range sortedTags(metric.Tags) {
+			attribute := otlpAttribute{Key: name}
+			attribute.Value.StringValue = metric.Tags[name]
+			point.Attributes = append(point.Attributes, attribute)
+		}
+
+		if metric.Kind == Timing {
+			exported = append(exported, otlpMetric{Name: metric.Name, Unit: "ms", Gauge: &otlpGauge{DataPoints: []otlpDataPoint{point}}})
+			continue
+		}
+		point.StartTimeUnixNano = point.TimeUnixNano
+		exported = append(exported, otlpMetric{Name: metric.Name, Sum: &otlpSum{
+			DataPoints:             []otlpDataPoint{point},
+			AggregationTemporality: aggregationTemporalityDelta,
+			IsMonotonic:            true,
+		}})
+	}
+
+	serviceName := otlpAttribute{Key: "service.name"}
+	serviceName.Value.StringValue = "turbolift"
+	return map[string]interface{}{
+		"resourceMetrics": []interface{}{map[string]interface{}{
+			"resource": map[string]interface{}{"attributes": []otlpAttribute{serviceName}},
+			"scopeMetrics": []interface{}{map[string]interface{}{
+				"scope":   map[string]string{"name": "turbolift"},
+				"metrics": exported,
+			}},
+		}},
+	}
+}
+
+// sendOTLP posts the metrics to an OpenTelemetry collector, at its /v1/metrics path unless the endpoint gives a path
+func sendOTLP(endpoint string, headers map[string]string, metrics []Metric) error {
+	if !strings.HasSuffix(strings.TrimRight(endpoint, "/"), "/v1/metrics") {
+		endpoint = strings.TrimRight(endpoint, "/") + "/v1/metrics"
+	}
+	payload, err := json.Marshal(otlpRequest(metrics, time.Now()))
+	if err != nil {
+		return err
+	}
+
+	request, err := http.NewRequest(http.MethodPost, endpoint, bytes.NewReader(payload))
+	if err != nil {
+		return fmt.Errorf("unable to send metrics to %s: %w", endpoint, err)
+	}
+	request.Header.Set("Content-Type", "application/json")
+	for name, value := range headers {
+		request.Header.Set(name, value)
+	}
+
+	response, err := client.Do(request)
+	if err != nil {
+		return fmt.Errorf("unable to send metrics: %w", err)
+	}
+	defer func() {
+		_ = response.Body.Close()
+	}()
+
+	if response.StatusCode >= 300 {
+		return fmt.Errorf("unable to send metrics: %s responded with %s", endpoint, response.Status)
+	}
+	return nil
+}
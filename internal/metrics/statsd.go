@@ -0,0 +1,67 @@
+/*
+ * Copyright 2021 Skyscanner Limited.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * https://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package metrics
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"time"
+)
+
+const statsdTimeout = 5 * time.Second
+
+// sendStatsd sends each metric to a statsd server over UDP, with tags in the DogStatsD format understood by Datadog,
+// Telegraf and the statsd exporter of Prometheus
+func sendStatsd(address string, metrics []Metric) error {
+	connection, err := net.DialTimeout("udp", address, statsdTimeout)
+	if err != nil {
+		return fmt.Errorf("unable to send metrics to statsd: %w", err)
+	}
+	defer func() {
+		_ = connection.Close()
+	}()
+
+	for _, metric := range metrics {
+		if _, err := connection.Write([]byte(statsdLine(metric))); err != nil {
+			return fmt.Errorf("unable to send metrics to statsd: %w", err)
+		}
+	}
+	return nil
+}
+
+// statsdLine formats a metric, e.g. turbolift.duration:1500|ms|#campaign:my-campaign,command:clone
+func statsdLine(metric Metric) string {
+	kind := "c"
+	if metric.Kind == Timing {
+		kind = "ms"
+	}
+
+	var tags []string
+	for _, name := range sortedTags(metric.Tags) {
+		tags = append(tags, statsdSafe(name)+":"+statsdSafe(metric.Tags[name]))
+	}
+	line := fmt.Sprintf("%s:%d|%s", metric.Name, metric.Value, kind)
+	if len(tags) > 0 {
+		line += "|#" + strings.Join(tags, ",")
+	}
+	return line
+}
+
+// statsdSafe replaces the characters which separate the parts of a statsd line
+func statsdSafe(s string) string {
+	return strings.NewReplacer("|", "_", ",", "_", ":", "_", "#", "_", "\n", "_").Replace(s)
+}
@@ -0,0 +1,131 @@
+/*
+ * Copyright 2021 Skyscanner Limited.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * https://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package ordering
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/skyscanner/turbolift/internal/campaign"
+	"github.com/skyscanner/turbolift/internal/github"
+	"github.com/skyscanner/turbolift/internal/logging"
+)
+
+// Stage is what a run works on when the repo file has ordering groups: the repositories of the first group whose PRs
+// have not all merged, while the groups after it wait
+type Stage struct {
+	// Group is the name of the ordering group being worked on
+	Group string
+	// Repos are the repositories in the group whose PRs have not merged yet
+	Repos []campaign.Repo
+	// Waiting are the repositories in later groups
+	Waiting []campaign.Repo
+}
+
+// Grouped reports whether the campaign's repositories are divided into more than one ordering group
+func Grouped(dir *campaign.Campaign) bool {
+	return len(campaign.OrderingGroups(dir.Repos)) > 1
+}
+
+// CurrentStage finds the first ordering group whose PRs have not all merged. Without ordering groups, every
+// repository is in the stage and GitHub is not queried.
+func CurrentStage(output io.Writer, gh github.GitHub, dir *campaign.Campaign) (*Stage, error) {
+	groups := campaign.OrderingGroups(dir.Repos)
+	if len(groups) < 2 {
+		return &Stage{Repos: dir.Repos}, nil
+	}
+
+	for i, group := range groups {
+		var unmerged []campaign.Repo
+		for _, repo := range group.Repos {
+			merged, err := isMerged(output, gh, repo, dir.Name)
+			if err != nil {
+				return nil, err
+			}
+			if !merged {
+				unmerged = append(unmerged, repo)
+			}
+		}
+		if len(unmerged) == 0 {
+			continue
+		}
+
+		stage := &Stage{Group: group.Name, Repos: unmerged}
+		for _, later := range groups[i+1:] {
+			stage.Waiting = append(stage.Waiting, later.Repos...)
+		}
+		return stage, nil
+	}
+	return &Stage{}, nil
+}
+
+// Start narrows the campaign down to the repositories of its current stage, where the repo file has ordering groups,
+// returning the stage, or false if there is nothing for the command to do
+func Start(logger *logging.Logger, gh github.GitHub, dir *campaign.Campaign) (*Stage, bool) {
+	if !Grouped(dir) {
+		return &Stage{Repos: dir.Repos}, true
+	}
+
+	activity := logger.StartActivity("Checking the PRs of each ordering group")
+	stage, err := CurrentStage(activity.Writer(), gh, dir)
+	if err != nil {
+		activity.EndWithFailure(err)
+		return nil, false
+	}
+	if len(stage.Repos) == 0 {
+		activity.Logf("The PRs of every ordering group have merged")
+		activity.EndWithSuccessAndEmitLogs()
+		return stage, false
+	}
+	activity.Logf("Working on %s, with %d repositories in later groups waiting for its PRs to merge", stage.Describe(), len(stage.Waiting))
+	activity.EndWithSuccessAndEmitLogs()
+
+	dir.Repos = stage.Repos
+	return stage, true
+}
+
+// Describe names the ordering group being worked on
+func (s *Stage) Describe() string {
+	if s.Group == "" {
+		return "the repositories listed before any ordering group"
+	}
+	return fmt.Sprintf("ordering group %s", s.Group)
+}
+
+// ReportWaiting tells the user about the repositories which are waiting for the stage's PRs to merge
+func (s *Stage) ReportWaiting(logger *logging.Logger, commandName string) {
+	if len(s.Waiting) == 0 {
+		return
+	}
+	logger.Printf("%d repositories in later ordering groups are waiting for the PRs of %s to merge - run turbolift %s again once they have", len(s.Waiting), s.Describe(), commandName)
+}
+
+// isMerged reports whether the PR from the campaign branch in a repository has merged
+func isMerged(output io.Writer, gh github.GitHub, repo campaign.Repo, branchName string) (bool, error) {
+	repoDirPath := repo.FullRepoPath()
+	// a repository which has not been cloned has no PR yet, and is skipped by the command itself
+	if _, err := os.Stat(repoDirPath); os.IsNotExist(err) {
+		return false, nil
+	}
+	pr, err := gh.GetPR(output, repoDirPath, branchName)
+	if _, ok := err.(*github.NoPRFoundError); ok {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	return pr.State == "MERGED", nil
+}
@@ -0,0 +1,102 @@
+/*
+ * Copyright 2021 Skyscanner Limited.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * https://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package ordering
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/skyscanner/turbolift/internal/campaign"
+	"github.com/skyscanner/turbolift/internal/github"
+	"github.com/skyscanner/turbolift/internal/testsupport"
+)
+
+func TestItWorksOnTheFirstGroupWhosePRsHaveNotAllMerged(t *testing.T) {
+	fakeGitHub := fakeGitHubWithMergedPRsIn("work/org/lib1", "work/org/lib2")
+	testsupport.PrepareTempCampaign(true, "[libraries]", "org/lib1", "org/lib2", "[services]", "org/service1", "org/service2", "[apps]", "org/app1")
+
+	dir, err := campaign.OpenCampaign(campaign.NewCampaignOptions())
+	assert.NoError(t, err)
+	assert.True(t, Grouped(dir))
+
+	stage, err := CurrentStage(&strings.Builder{}, fakeGitHub, dir)
+	assert.NoError(t, err)
+	assert.Equal(t, "services", stage.Group)
+	assert.Equal(t, []string{"org/service1", "org/service2"}, names(stage.Repos))
+	assert.Equal(t, []string{"org/app1"}, names(stage.Waiting))
+}
+
+func TestItLeavesOutMergedReposOfTheCurrentGroup(t *testing.T) {
+	fakeGitHub := fakeGitHubWithMergedPRsIn("work/org/lib1")
+	testsupport.PrepareTempCampaign(true, "[libraries]", "org/lib1", "org/lib2", "[services]", "org/service1")
+
+	dir, err := campaign.OpenCampaign(campaign.NewCampaignOptions())
+	assert.NoError(t, err)
+
+	stage, err := CurrentStage(&strings.Builder{}, fakeGitHub, dir)
+	assert.NoError(t, err)
+	assert.Equal(t, "libraries", stage.Group)
+	assert.Equal(t, []string{"org/lib2"}, names(stage.Repos))
+	assert.Equal(t, []string{"org/service1"}, names(stage.Waiting))
+}
+
+func TestItHasNothingToDoOnceEveryGroupHasMerged(t *testing.T) {
+	fakeGitHub := fakeGitHubWithMergedPRsIn("work/org/lib1", "work/org/service1")
+	testsupport.PrepareTempCampaign(true, "[libraries]", "org/lib1", "[services]", "org/service1")
+
+	dir, err := campaign.OpenCampaign(campaign.NewCampaignOptions())
+	assert.NoError(t, err)
+
+	stage, err := CurrentStage(&strings.Builder{}, fakeGitHub, dir)
+	assert.NoError(t, err)
+	assert.Empty(t, stage.Repos)
+	assert.Empty(t, stage.Waiting)
+}
+
+func TestItDoesNotQueryGitHubWithoutOrderingGroups(t *testing.T) {
+	fakeGitHub := github.NewAlwaysFailsFakeGitHub()
+	testsupport.PrepareTempCampaign(true, "org/repo1", "org/repo2")
+
+	dir, err := campaign.OpenCampaign(campaign.NewCampaignOptions())
+	assert.NoError(t, err)
+	assert.False(t, Grouped(dir))
+
+	stage, err := CurrentStage(&strings.Builder{}, fakeGitHub, dir)
+	assert.NoError(t, err)
+	assert.Equal(t, dir.Repos, stage.Repos)
+	fakeGitHub.AssertCalledWith(t, [][]string{})
+}
+
+func fakeGitHubWithMergedPRsIn(mergedDirs ...string) *github.FakeGitHub {
+	return github.NewFakeGitHub(nil, func(workingDir string) (interface{}, error) {
+		for _, dir := range mergedDirs {
+			if workingDir == dir {
+				return &github.PrStatus{State: "MERGED"}, nil
+			}
+		}
+		return &github.PrStatus{State: "OPEN"}, nil
+	})
+}
+
+func names(repos []campaign.Repo) []string {
+	var names []string
+	for _, repo := range repos {
+		names = append(names, repo.FullRepoName)
+	}
+	return names
+}
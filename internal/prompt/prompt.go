@@ -1,13 +1,55 @@
 package prompt
 
 import (
+	"fmt"
+	"io"
+	"os"
+	"strconv"
 	"strings"
 
 	"github.com/manifoldco/promptui"
+	"github.com/mattn/go-isatty"
+
+	"github.com/skyscanner/turbolift/cmd/flags"
+)
+
+// AssumeYesEnvVar can be set to a true value to answer yes to every confirmation prompt, like --yes
+const AssumeYesEnvVar = "TURBOLIFT_ASSUME_YES"
+
+// AssumeNoEnvVar can be set to a true value to answer no to every confirmation prompt, like --no
+const AssumeNoEnvVar = "TURBOLIFT_ASSUME_NO"
+
+// DefaultEnvVarPrefix followed by the name of a prompt in upper case, with dashes as underscores (e.g.
+// TURBOLIFT_PROMPT_MERGE), can be set to yes or no to override the default answer to that prompt
+const DefaultEnvVarPrefix = "TURBOLIFT_PROMPT_"
+
+// The names of the confirmation prompts, which their default answers are configured by
+const (
+	Approve             = "approve"
+	CloseStale          = "close-stale"
+	ClosePRs            = "close-prs"
+	ContinueAfterCanary = "continue-after-canary"
+	KeepChanges         = "keep-changes"
+	Merge               = "merge"
+	RemoveWorkingCopies = "remove-working-copies"
+	UndoStep            = "undo-step"
+	UpdateDescriptions  = "update-descriptions"
+	UpdateLabels        = "update-labels"
+)
+
+// Names are the names of every confirmation prompt
+var Names = []string{Approve, CloseStale, ClosePRs, ContinueAfterCanary, KeepChanges, Merge, RemoveWorkingCopies, UndoStep, UpdateDescriptions, UpdateLabels}
+
+var (
+	stdin  *os.File  = os.Stdin
+	stderr io.Writer = os.Stderr
+
+	// defaults are the configured default answers to prompts, keyed by name
+	defaults = map[string]bool{}
 )
 
 type Prompt interface {
-	AskConfirm(string) bool
+	AskConfirm(name string, question string) bool
 }
 
 type RealPrompt struct{}
@@ -17,16 +59,117 @@ func NewRealPrompt() *RealPrompt {
 	return &RealPrompt{}
 }
 
-// AskConfirm will use promptui to provide a confirmation
-func (r *RealPrompt) AskConfirm(confirm string) bool {
+// AssumeYes reports whether confirmations should be answered with yes without asking
+func AssumeYes() bool {
+	if flags.Yes || flags.No {
+		return flags.Yes
+	}
+	return isSet(AssumeYesEnvVar) && !isSet(AssumeNoEnvVar)
+}
+
+// AssumeNo reports whether confirmations should be answered with no without asking
+func AssumeNo() bool {
+	if flags.Yes || flags.No {
+		return flags.No
+	}
+	return isSet(AssumeNoEnvVar)
+}
+
+func isSet(envVar string) bool {
+	value, _ := strconv.ParseBool(os.Getenv(envVar))
+	return value
+}
+
+// SetDefaults configures the default answers to prompts, keyed by name, as yes or no. The default answer is taken
+// when input is not a terminal, and when Enter is pressed at the prompt. Prompts default to no unless configured.
+func SetDefaults(answers map[string]string) error {
+	configured := map[string]bool{}
+	for name, answer := range answers {
+		if !isName(name) {
+			return fmt.Errorf("unknown prompt %s - expected one of %s", name, strings.Join(Names, ", "))
+		}
+		yes, err := parseAnswer(answer)
+		if err != nil {
+			return fmt.Errorf("invalid default answer to prompt %s: %w", name, err)
+		}
+		configured[name] = yes
+	}
+	defaults = configured
+	return nil
+}
+
+// Default returns the default answer to a prompt, which an environment variable overrides
+func Default(name string) (bool, error) {
+	envVar := DefaultEnvVarPrefix + strings.ToUpper(strings.ReplaceAll(name, "-", "_"))
+	if answer, ok := os.LookupEnv(envVar); ok {
+		yes, err := parseAnswer(answer)
+		if err != nil {
+			return false, fmt.Errorf("invalid %s: %w", envVar, err)
+		}
+		return yes, nil
+	}
+	return defaults[name], nil
+}
+
+func isName(name string) bool {
+	for _, n := range Names {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+func parseAnswer(answer string) (bool, error) {
+	switch strings.ToLower(answer) {
+	case "y", "yes", "true":
+		return true, nil
+	case "n", "no", "false":
+		return false, nil
+	}
+	return false, fmt.Errorf("%s is not yes or no", answer)
+}
+
+func describe(answer bool) string {
+	if answer {
+		return "yes"
+	}
+	return "no"
+}
+
+// AskConfirm will use promptui to provide a confirmation, unless --yes or --no (or their environment variables) give
+// the answer. When input is not a terminal, it takes the prompt's default answer rather than waiting for an answer
+// that will never come.
+func (r *RealPrompt) AskConfirm(name string, confirm string) bool {
+	if AssumeNo() {
+		return false
+	}
+	if AssumeYes() {
+		return true
+	}
+	defaultAnswer, err := Default(name)
+	if err != nil {
+		_, _ = fmt.Fprintf(stderr, "%s\n%v, so answering no.\n", confirm, err)
+		return false
+	}
+	if !isatty.IsTerminal(stdin.Fd()) && !isatty.IsCygwinTerminal(stdin.Fd()) {
+		_, _ = fmt.Fprintf(stderr, "%s\nCannot ask for confirmation as input is not a terminal, so answering %s. Use --yes or --no, or set %s=true or %s=true, to answer every prompt non-interactively.\n",
+			confirm, describe(defaultAnswer), AssumeYesEnvVar, AssumeNoEnvVar)
+		return defaultAnswer
+	}
 	p := promptui.Prompt{
 		Label:     confirm,
 		IsConfirm: true,
 	}
+	if defaultAnswer {
+		p.Default = "y"
+	}
 	if res, err := p.Run(); err != nil {
 		return false
 	} else {
 		switch strings.ToLower(res) {
+		case "":
+			return defaultAnswer
 		case "y":
 			return true
 		case "yes":
@@ -44,7 +187,7 @@ func NewFakePromptYes() *FakePromptYes {
 	return &FakePromptYes{}
 }
 
-func (f FakePromptYes) AskConfirm(_ string) bool {
+func (f FakePromptYes) AskConfirm(_ string, _ string) bool {
 	return true
 }
 
@@ -55,6 +198,6 @@ func NewFakePromptNo() *FakePromptNo {
 	return &FakePromptNo{}
 }
 
-func (f FakePromptNo) AskConfirm(_ string) bool {
+func (f FakePromptNo) AskConfirm(_ string, _ string) bool {
 	return false
 }
@@ -0,0 +1,103 @@
+package prompt
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/skyscanner/turbolift/cmd/flags"
+)
+
+func TestItDeclinesWhenInputIsNotATerminal(t *testing.T) {
+	out := useNonTerminalInput(t)
+
+	assert.False(t, NewRealPrompt().AskConfirm(ClosePRs, "Close all PRs?"))
+	assert.Contains(t, out.String(), "Close all PRs?")
+	assert.Contains(t, out.String(), "input is not a terminal")
+}
+
+func TestItConfirmsWithoutAskingWhenYesFlagIsSet(t *testing.T) {
+	out := useNonTerminalInput(t)
+	flags.Yes = true
+	defer func() { flags.Yes = false }()
+
+	assert.True(t, NewRealPrompt().AskConfirm(ClosePRs, "Close all PRs?"))
+	assert.Empty(t, out.String())
+}
+
+func TestItConfirmsWithoutAskingWhenAssumeYesIsSetInEnvironment(t *testing.T) {
+	out := useNonTerminalInput(t)
+	_ = os.Setenv(AssumeYesEnvVar, "true")
+	defer func() { _ = os.Unsetenv(AssumeYesEnvVar) }()
+
+	assert.True(t, NewRealPrompt().AskConfirm(ClosePRs, "Close all PRs?"))
+	assert.Empty(t, out.String())
+}
+
+func TestItDeclinesWithoutAskingWhenNoFlagIsSet(t *testing.T) {
+	out := useNonTerminalInput(t)
+	_ = os.Setenv(AssumeYesEnvVar, "true")
+	defer func() { _ = os.Unsetenv(AssumeYesEnvVar) }()
+	flags.No = true
+	defer func() { flags.No = false }()
+
+	assert.False(t, NewRealPrompt().AskConfirm(ClosePRs, "Close all PRs?"))
+	assert.Empty(t, out.String())
+}
+
+func TestItDeclinesWithoutAskingWhenAssumeNoIsSetInEnvironment(t *testing.T) {
+	out := useNonTerminalInput(t)
+	_ = os.Setenv(AssumeNoEnvVar, "true")
+	defer func() { _ = os.Unsetenv(AssumeNoEnvVar) }()
+	assert.NoError(t, SetDefaults(map[string]string{ClosePRs: "yes"}))
+	defer func() { _ = SetDefaults(nil) }()
+
+	assert.False(t, NewRealPrompt().AskConfirm(ClosePRs, "Close all PRs?"))
+	assert.Empty(t, out.String())
+}
+
+func TestItTakesTheConfiguredDefaultWhenInputIsNotATerminal(t *testing.T) {
+	out := useNonTerminalInput(t)
+	assert.NoError(t, SetDefaults(map[string]string{Merge: "yes"}))
+	defer func() { _ = SetDefaults(nil) }()
+
+	assert.True(t, NewRealPrompt().AskConfirm(Merge, "Merge all ready PRs?"))
+	assert.Contains(t, out.String(), "answering yes")
+	assert.False(t, NewRealPrompt().AskConfirm(ClosePRs, "Close all PRs?"))
+}
+
+func TestTheEnvironmentOverridesTheConfiguredDefault(t *testing.T) {
+	useNonTerminalInput(t)
+	assert.NoError(t, SetDefaults(map[string]string{RemoveWorkingCopies: "no"}))
+	defer func() { _ = SetDefaults(nil) }()
+	_ = os.Setenv("TURBOLIFT_PROMPT_REMOVE_WORKING_COPIES", "yes")
+	defer func() { _ = os.Unsetenv("TURBOLIFT_PROMPT_REMOVE_WORKING_COPIES") }()
+
+	assert.True(t, NewRealPrompt().AskConfirm(RemoveWorkingCopies, "Remove 3 working copies?"))
+}
+
+func TestItRejectsUnknownPromptsAndAnswers(t *testing.T) {
+	assert.EqualError(t, SetDefaults(map[string]string{"merge-all": "yes"}),
+		"unknown prompt merge-all - expected one of "+strings.Join(Names, ", "))
+	assert.EqualError(t, SetDefaults(map[string]string{Merge: "maybe"}),
+		"invalid default answer to prompt merge: maybe is not yes or no")
+}
+
+func useNonTerminalInput(t *testing.T) *bytes.Buffer {
+	file, err := ioutil.TempFile("", "stdin")
+	if err != nil {
+		panic(err)
+	}
+	out := bytes.NewBufferString("")
+	stdin, stderr = file, out
+	t.Cleanup(func() {
+		_ = file.Close()
+		_ = os.Remove(file.Name())
+		stdin, stderr = os.Stdin, os.Stderr
+	})
+	return out
+}
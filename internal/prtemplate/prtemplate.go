@@ -0,0 +1,176 @@
+/*
+ * Copyright 2021 Skyscanner Limited.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * https://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package prtemplate
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// templateDirs are the directories in which GitHub looks for a repository's PR template, in the order it looks
+var templateDirs = []string{".github", ".", "docs"}
+
+const templateFilename = "pull_request_template.md"
+
+var (
+	headingPattern = regexp.MustCompile(`^#{1,6}\s+(.*?)\s*#*\s*$`)
+	commentPattern = regexp.MustCompile(`(?s)<!--.*?-->`)
+)
+
+// Find returns the content of the PR template in a working copy, and false if it has none
+func Find(repoDirPath string) (string, bool, error) {
+	for _, dir := range templateDirs {
+		entries, err := ioutil.ReadDir(filepath.Join(repoDirPath, dir))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return "", false, err
+		}
+		for _, entry := range entries {
+			// GitHub accepts the file name in any case
+			if entry.IsDir() || strings.ToLower(entry.Name()) != templateFilename {
+				continue
+			}
+			content, err := ioutil.ReadFile(filepath.Join(repoDirPath, dir, entry.Name()))
+			if err != nil {
+				return "", false, err
+			}
+			return string(content), true, nil
+		}
+	}
+	return "", false, nil
+}
+
+// Fill returns the PR description for a working copy: its PR template merged with the campaign's description, or the
+// description as it is where there is no PR template, as shown by the returned bool
+func Fill(repoDirPath string, body string) (string, bool, error) {
+	template, found, err := Find(repoDirPath)
+	if err != nil {
+		return "", false, fmt.Errorf("unable to read the repository's PR template: %w", err)
+	}
+	if !found {
+		return body, false, nil
+	}
+	return Merge(template, body), true, nil
+}
+
+// section is a heading of a markdown document and the text up to the next heading. The text before the first heading
+// is a section without a heading.
+type section struct {
+	heading string
+	content []string
+}
+
+func (s section) key() string {
+	return strings.TrimSuffix(strings.ToLower(headingPattern.FindStringSubmatch(s.heading)[1]), ":")
+}
+
+// Merge fills the sections of a repository's PR template with the campaign's PR description. Each section of the
+// description fills the template's section with the same heading, ignoring case and heading level, after any text the
+// template has there apart from its comments; the text before the first heading fills the template's text before its
+// first heading. Sections of the description which the template does not have are added at the end, or for the text
+// before the first heading, at the start.
+func Merge(template string, body string) string {
+	templateSections := split(template)
+	bodySections := split(body)
+
+	for _, bodySection := range bodySections {
+		i := matching(templateSections, bodySection)
+		switch {
+		case i >= 0:
+			templateSections[i] = fill(templateSections[i], bodySection.content)
+		case bodySection.heading == "":
+			templateSections = append([]section{bodySection}, templateSections...)
+		default:
+			templateSections = append(templateSections, bodySection)
+		}
+	}
+
+	var lines []string
+	for _, s := range templateSections {
+		if s.heading != "" {
+			if len(lines) > 0 && strings.TrimSpace(lines[len(lines)-1]) != "" {
+				lines = append(lines, "")
+			}
+			lines = append(lines, s.heading)
+		}
+		lines = append(lines, s.content...)
+	}
+	return strings.TrimSpace(strings.Join(lines, "\n")) + "\n"
+}
+
+func matching(sections []section, s section) int {
+	for i, candidate := range sections {
+		if candidate.heading == "" || s.heading == "" {
+			if candidate.heading == s.heading {
+				return i
+			}
+			continue
+		}
+		if candidate.key() == s.key() {
+			return i
+		}
+	}
+	return -1
+}
+
+// fill puts the content into a template section, after whatever the section has apart from its comments
+func fill(s section, content []string) section {
+	kept := strings.TrimSpace(commentPattern.ReplaceAllString(strings.Join(s.content, "\n"), ""))
+	filled := trim(content)
+	if kept != "" {
+		filled = append([]string{kept, ""}, filled...)
+	}
+	return section{heading: s.heading, content: append(append([]string{""}, filled...), "")}
+}
+
+// split divides a markdown document into sections at its headings, other than lines in code blocks which look like
+// headings
+func split(document string) []section {
+	sections := []section{{}}
+	inCodeBlock := false
+	for _, line := range strings.Split(strings.ReplaceAll(document, "\r\n", "\n"), "\n") {
+		if strings.HasPrefix(strings.TrimSpace(line), "```") {
+			inCodeBlock = !inCodeBlock
+		}
+		if !inCodeBlock && headingPattern.MatchString(line) {
+			sections = append(sections, section{heading: line})
+			continue
+		}
+		last := &sections[len(sections)-1]
+		last.content = append(last.content, line)
+	}
+	if len(trim(sections[0].content)) == 0 {
+		sections = sections[1:]
+	}
+	return sections
+}
+
+// trim removes the blank lines at the start and end of some lines
+func trim(lines []string) []string {
+	for len(lines) > 0 && strings.TrimSpace(lines[0]) == "" {
+		lines = lines[1:]
+	}
+	for len(lines) > 0 && strings.TrimSpace(lines[len(lines)-1]) == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
@@ -0,0 +1,128 @@
+/*
+ * Copyright 2021 Skyscanner Limited.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * https://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package prtemplate
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const template = `<!-- Describe your change -->
+
+## Summary
+
+<!-- What does this PR do? -->
+
+## Testing
+
+- [ ] I have tested this change
+
+## Checklist
+
+- [ ] Changelog updated
+`
+
+func TestItFillsTheSectionsOfTheTemplateWithMatchingHeadings(t *testing.T) {
+	body := `Upgrades the build to Java 17.
+
+# Summary:
+
+The build now uses Java 17.
+
+### Testing
+
+CI passes with the new version.
+`
+
+	assert.Equal(t, `Upgrades the build to Java 17.
+
+## Summary
+
+The build now uses Java 17.
+
+## Testing
+
+- [ ] I have tested this change
+
+CI passes with the new version.
+
+## Checklist
+
+- [ ] Changelog updated
+`, Merge(template, body))
+}
+
+func TestItAddsSectionsWhichTheTemplateDoesNotHaveAtTheEnd(t *testing.T) {
+	body := `## Rollout
+
+Merged by the platform team.
+
+## Summary
+
+Java 17
+`
+
+	assert.Equal(t, `<!-- Describe your change -->
+
+## Summary
+
+Java 17
+
+## Testing
+
+- [ ] I have tested this change
+
+## Checklist
+
+- [ ] Changelog updated
+
+## Rollout
+
+Merged by the platform team.
+`, Merge(template, body))
+}
+
+func TestItDoesNotTreatCommentsInCodeBlocksAsHeadings(t *testing.T) {
+	body := "## Summary\n\nRun this:\n\n```sh\n# Testing\nmake test\n```\n"
+
+	merged := Merge(template, body)
+
+	assert.Contains(t, merged, "## Summary\n\nRun this:\n\n```sh\n# Testing\nmake test\n```\n\n## Testing\n\n- [ ] I have tested this change\n")
+}
+
+func TestItFindsThePRTemplateOfAWorkingCopy(t *testing.T) {
+	dir, err := ioutil.TempDir("", "prtemplate")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	_, found, err := Find(dir)
+	assert.NoError(t, err)
+	assert.False(t, found)
+
+	assert.NoError(t, os.Mkdir(filepath.Join(dir, "docs"), 0755))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "docs", "pull_request_template.md"), []byte("docs"), 0644))
+	assert.NoError(t, os.Mkdir(filepath.Join(dir, ".github"), 0755))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, ".github", "PULL_REQUEST_TEMPLATE.md"), []byte("github"), 0644))
+
+	content, found, err := Find(dir)
+	assert.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, "github", content)
+}
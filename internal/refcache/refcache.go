@@ -0,0 +1,78 @@
+/*
+ * Copyright 2021 Skyscanner Limited.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * https://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package refcache
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/skyscanner/turbolift/internal/campaign"
+	"github.com/skyscanner/turbolift/internal/git"
+)
+
+// DefaultDir is where the reference cache is kept unless another directory is given, shared by every campaign of the
+// user, i.e. ~/.cache/turbolift/references on Linux
+func DefaultDir() string {
+	cacheHome, err := os.UserCacheDir()
+	if err != nil {
+		home, _ := os.UserHomeDir()
+		cacheHome = filepath.Join(home, ".cache")
+	}
+	return filepath.Join(cacheHome, "turbolift", "references")
+}
+
+// Cache holds a bare mirror of each repository that has been cloned with it, which later clones of the same
+// repository borrow objects from instead of downloading them again
+type Cache struct {
+	Dir string
+}
+
+// Path returns the location of a repository's mirror within the cache
+func (c Cache) Path(repo campaign.Repo) string {
+	return filepath.Join(c.Dir, repo.HostName(), repo.OrgName, repo.RepoName+".git")
+}
+
+// Update brings a repository's mirror up to date, creating it if this is the first time the repository is cloned with
+// the cache, and returns its absolute path to be given to git clone --reference
+func (c Cache) Update(output io.Writer, g git.Git, repo campaign.Repo) (string, error) {
+	mirrorPath, err := filepath.Abs(c.Path(repo))
+	if err != nil {
+		return "", err
+	}
+
+	if _, err := os.Stat(mirrorPath); err == nil {
+		return mirrorPath, g.UpdateMirror(output, mirrorPath)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(mirrorPath), 0o755); err != nil {
+		return "", fmt.Errorf("unable to create reference cache directory: %w", err)
+	}
+	url := fmt.Sprintf("https://%s/%s/%s.git", repo.HostName(), repo.OrgName, repo.RepoName)
+	if err := g.CloneMirror(output, url, mirrorPath); err != nil {
+		// leave no partial mirror behind to be mistaken for a complete one next time
+		_ = os.RemoveAll(mirrorPath)
+		return "", err
+	}
+	return mirrorPath, nil
+}
+
+// CloneFlags are the flags for git clone which borrow objects from the mirror at mirrorPath, then copy them into the
+// clone so that it keeps working if the cache is removed
+func CloneFlags(mirrorPath string) []string {
+	return []string{"--reference-if-able", mirrorPath, "--dissociate"}
+}
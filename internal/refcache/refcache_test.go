@@ -0,0 +1,86 @@
+/*
+ * Copyright 2021 Skyscanner Limited.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * https://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package refcache
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/skyscanner/turbolift/internal/campaign"
+	"github.com/skyscanner/turbolift/internal/git"
+)
+
+var repo = campaign.Repo{OrgName: "org", RepoName: "repo1", FullRepoName: "org/repo1"}
+
+func TestItCreatesMirrorsOnFirstUse(t *testing.T) {
+	cache := Cache{Dir: t.TempDir()}
+	fakeGit := git.NewAlwaysSucceedsFakeGit()
+
+	mirrorPath, err := cache.Update(&bytes.Buffer{}, fakeGit, repo)
+	assert.NoError(t, err)
+	assert.Equal(t, filepath.Join(cache.Dir, "github.com", "org", "repo1.git"), mirrorPath)
+
+	fakeGit.AssertCalledWith(t, [][]string{
+		{"cloneMirror", "https://github.com/org/repo1.git", mirrorPath},
+	})
+}
+
+func TestItUpdatesExistingMirrors(t *testing.T) {
+	cache := Cache{Dir: t.TempDir()}
+	assert.NoError(t, os.MkdirAll(cache.Path(repo), 0o755))
+	fakeGit := git.NewAlwaysSucceedsFakeGit()
+
+	mirrorPath, err := cache.Update(&bytes.Buffer{}, fakeGit, repo)
+	assert.NoError(t, err)
+
+	fakeGit.AssertCalledWith(t, [][]string{
+		{"updateMirror", mirrorPath},
+	})
+}
+
+func TestItKeepsMirrorsOfEachHostApart(t *testing.T) {
+	cache := Cache{Dir: t.TempDir()}
+	enterpriseRepo := campaign.Repo{Host: "github.example.com", OrgName: "org", RepoName: "repo1", FullRepoName: "github.example.com/org/repo1"}
+	fakeGit := git.NewAlwaysSucceedsFakeGit()
+
+	_, err := cache.Update(&bytes.Buffer{}, fakeGit, enterpriseRepo)
+	assert.NoError(t, err)
+
+	fakeGit.AssertCalledWith(t, [][]string{
+		{"cloneMirror", "https://github.example.com/org/repo1.git", filepath.Join(cache.Dir, "github.example.com", "org", "repo1.git")},
+	})
+}
+
+func TestItRemovesPartialMirrors(t *testing.T) {
+	cache := Cache{Dir: t.TempDir()}
+	fakeGit := git.NewFakeGit(func(_ io.Writer, call []string) (bool, error) {
+		// git leaves a partial mirror behind when the clone is interrupted
+		_ = os.MkdirAll(call[2], 0o755)
+		return false, errors.New("synthetic error")
+	})
+
+	_, err := cache.Update(&bytes.Buffer{}, fakeGit, repo)
+	assert.Error(t, err)
+
+	_, err = os.Stat(cache.Path(repo))
+	assert.True(t, os.IsNotExist(err))
+}
@@ -0,0 +1,231 @@
+/*
+ * Copyright 2021 Skyscanner Limited.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * https://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package secrets
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/skyscanner/turbolift/internal/campaign"
+	"github.com/skyscanner/turbolift/internal/changes"
+	"github.com/skyscanner/turbolift/internal/git"
+	"github.com/skyscanner/turbolift/internal/github"
+)
+
+// allowMarkers exempt a line from scanning, e.g. for test fixtures. gitleaks:allow is honoured so that lines already
+// allowed for gitleaks are not reported again.
+var allowMarkers = []string{"turbolift:allow-secret", "gitleaks:allow"}
+
+// Rule is a pattern for one kind of secret
+type Rule struct {
+	ID          string
+	Description string
+	Regex       *regexp.Regexp
+}
+
+// DefaultRules detect the credentials most likely to be leaked by a script run across many repositories
+var DefaultRules = []Rule{
+	{"github-token", "GitHub token", regexp.MustCompile(`\b(gh[pousr]_[A-Za-z0-9]{36,}|github_pat_[A-Za-z0-9_]{22,})\b`)},
+	{"aws-access-key-id", "AWS access key ID", regexp.MustCompile(`\b(AKIA|ASIA)[0-9A-Z]{16}\b`)},
+	{"private-key", "Private key", regexp.MustCompile(`-----BEGIN[ A-Z0-9_-]{0,100}PRIVATE KEY( BLOCK)?-----`)},
+	{"slack-token", "Slack token", regexp.MustCompile(`\bxox[abposr]-[0-9A-Za-z-]{10,}`)},
+	{"slack-webhook", "Slack webhook URL", regexp.MustCompile(`https://hooks\.slack\.com/services/T[A-Za-z0-9_]+/B[A-Za-z0-9_]+/[A-Za-z0-9_]+`)},
+	{"google-api-key", "Google API key", regexp.MustCompile(`\bAIza[0-9A-Za-z_-]{35}\b`)},
+	{"stripe-key", "Stripe live key", regexp.MustCompile(`\b[sr]k_live_[0-9A-Za-z]{24,}\b`)},
+	{"url-credentials", "Password in a URL", regexp.MustCompile(`[a-z][a-z0-9+.-]*://[^/\s:@]+:[^/\s:@]+@[^/\s@]+`)},
+}
+
+// Finding is a line added by a change which looks like it contains a secret. The secret itself is not kept, so that
+// findings can be displayed safely.
+type Finding struct {
+	File   string
+	Line   int
+	RuleID string
+}
+
+func (f Finding) String() string {
+	return fmt.Sprintf("%s:%d (%s)", f.File, f.Line, f.RuleID)
+}
+
+var hunkHeaderPattern = regexp.MustCompile(`^@@ -\d+(?:,\d+)? \+(\d+)(?:,\d+)? @@`)
+
+// Scan checks the lines added in a patch, as output by git diff, against the rules
+func Scan(patch string, rules []Rule) []Finding {
+	var findings []Finding
+	var file string
+	var line int
+	for _, text := range strings.Split(patch, "\n") {
+		switch {
+		case strings.HasPrefix(text, "+++ "):
+			file = strings.TrimPrefix(strings.TrimPrefix(text, "+++ "), "b/")
+		case strings.HasPrefix(text, "@@"):
+			if match := hunkHeaderPattern.FindStringSubmatch(text); match != nil {
+				line, _ = strconv.Atoi(match[1])
+			}
+		case strings.HasPrefix(text, "+"):
+			if !isAllowed(text) {
+				for _, rule := range rules {
+					if rule.Regex.MatchString(text) {
+						findings = append(findings, Finding{File: file, Line: line, RuleID: rule.ID})
+					}
+				}
+			}
+			line++
+		case strings.HasPrefix(text, " "):
+			line++
+		}
+	}
+	return findings
+}
+
+// CheckWorkingCopy scans the changes to tracked files which have not been committed yet
+func CheckWorkingCopy(output io.Writer, g git.Git, repoDirPath string, rules []Rule) error {
+	patch, err := g.Diff(output, repoDirPath, "HEAD", true)
+	if err != nil {
+		return err
+	}
+	return check(patch, rules)
+}
+
+// CheckBranch scans the changes committed on the campaign branch since it diverged from the base branch
+func CheckBranch(output io.Writer, g git.Git, gh github.GitHub, repo campaign.Repo, rules []Rule) error {
+	baseRef, err := changes.BaseRef(output, g, gh, repo)
+	if err != nil {
+		return err
+	}
+	patch, err := g.Diff(output, repo.FullRepoPath(), baseRef, false)
+	if err != nil {
+		return err
+	}
+	return check(patch, rules)
+}
+
+func check(patch string, rules []Rule) error {
+	findings := Scan(patch, rules)
+	if len(findings) == 0 {
+		return nil
+	}
+	descriptions := make([]string, len(findings))
+	for i, finding := range findings {
+		descriptions[i] = finding.String()
+	}
+	return fmt.Errorf("possible secrets found in %s. Remove them, or mark false positives with a %s comment on the same line", strings.Join(descriptions, ", "), allowMarkers[0])
+}
+
+func isAllowed(line string) bool {
+	for _, marker := range allowMarkers {
+		if strings.Contains(line, marker) {
+			return true
+		}
+	}
+	return false
+}
+
+// LoadRules returns the default rules, along with the rules in a gitleaks configuration file if one is given.
+// Only the id, description and regex of each [[rules]] entry are used.
+func LoadRules(filename string) ([]Rule, error) {
+	rules := append([]Rule{}, DefaultRules...)
+	if filename == "" {
+		return rules, nil
+	}
+
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, fmt.Errorf("unable to open secret rules file: %w", err)
+	}
+	defer file.Close()
+
+	var current *Rule
+	var inRule bool
+	addCurrent := func() {
+		if current != nil && current.Regex != nil {
+			rules = append(rules, *current)
+		}
+		current = nil
+	}
+
+	scanner := bufio.NewScanner(file)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		if strings.HasPrefix(text, "[") {
+			addCurrent()
+			inRule = text == "[[rules]]"
+			if inRule {
+				current = &Rule{}
+			}
+			continue
+		}
+		if !inRule {
+			continue
+		}
+
+		key, value, ok := parseKeyValue(text)
+		if !ok {
+			continue
+		}
+		switch key {
+		case "id":
+			current.ID = value
+		case "description":
+			current.Description = value
+		case "regex":
+			regex, err := regexp.Compile(value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid regex on line %d of %s: %w", lineNumber, filename, err)
+			}
+			current.Regex = regex
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	addCurrent()
+	return rules, nil
+}
+
+// parseKeyValue parses a TOML key and string value, as literal ('...' or ”'...”') or basic ("...") strings
+func parseKeyValue(text string) (string, string, bool) {
+	i := strings.Index(text, "=")
+	if i < 0 {
+		return "", "", false
+	}
+	key := strings.TrimSpace(text[:i])
+	value := strings.TrimSpace(text[i+1:])
+
+	switch {
+	case strings.HasPrefix(value, "'''") && strings.HasSuffix(value, "'''") && len(value) >= 6:
+		return key, value[3 : len(value)-3], true
+	case strings.HasPrefix(value, "'") && strings.HasSuffix(value, "'") && len(value) >= 2:
+		return key, value[1 : len(value)-1], true
+	case strings.HasPrefix(value, `"`):
+		unquoted, err := strconv.Unquote(value)
+		if err != nil {
+			return "", "", false
+		}
+		return key, unquoted, true
+	}
+	return "", "", false
+}
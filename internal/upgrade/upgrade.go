@@ -0,0 +1,270 @@
+/*
+ * Copyright 2021 Skyscanner Limited.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * https://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package upgrade
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const checksumsAssetName = "checksums.txt"
+
+var (
+	latestReleaseURL = "https://api.github.com/repos/Skyscanner/turbolift/releases/latest"
+	client           = &http.Client{Timeout: 5 * time.Minute}
+)
+
+type Asset struct {
+	Name        string `json:"name"`
+	DownloadURL string `json:"browser_download_url"`
+}
+
+type Release struct {
+	TagName string  `json:"tag_name"`
+	Assets  []Asset `json:"assets"`
+}
+
+// Version returns the version of the release without the leading v of its tag
+func (r Release) Version() string {
+	return strings.TrimPrefix(r.TagName, "v")
+}
+
+func (r Release) asset(name string) (Asset, error) {
+	for _, asset := range r.Assets {
+		if asset.Name == name {
+			return asset, nil
+		}
+	}
+	return Asset{}, fmt.Errorf("release %s has no asset named %s", r.TagName, name)
+}
+
+// LatestRelease fetches the details of the latest turbolift release from GitHub
+func LatestRelease() (Release, error) {
+	var release Release
+	body, err := download(latestReleaseURL)
+	if err != nil {
+		return release, fmt.Errorf("unable to check the latest release: %w", err)
+	}
+	if err := json.Unmarshal(body, &release); err != nil {
+		return release, fmt.Errorf("unable to check the latest release: %w", err)
+	}
+	return release, nil
+}
+
+// IsNewer reports whether the candidate version is newer than the current one.
+// Versions which are not of the form major.minor.patch (such as development builds) are never considered newer.
+func IsNewer(candidate string, current string) bool {
+	candidateParts, ok := parseVersion(candidate)
+	if !ok {
+		return false
+	}
+	currentParts, ok := parseVersion(current)
+	if !ok {
+		return false
+	}
+	for i := range candidateParts {
+		if candidateParts[i] != currentParts[i] {
+			return candidateParts[i] > currentParts[i]
+		}
+	}
+	return false
+}
+
+// IsRelease reports whether a version is that of a released build, as opposed to a development build
+func IsRelease(version string) bool {
+	_, ok := parseVersion(version)
+	return ok
+}
+
+func parseVersion(version string) ([3]int, bool) {
+	var parts [3]int
+	version = strings.TrimPrefix(version, "v")
+	// ignore pre-release and build metadata suffixes
+	version = strings.SplitN(version, "-", 2)[0]
+	version = strings.SplitN(version, "+", 2)[0]
+	split := strings.Split(version, ".")
+	if len(split) != 3 {
+		return parts, false
+	}
+	for i, s := range split {
+		n, err := strconv.Atoi(s)
+		if err != nil {
+			return parts, false
+		}
+		parts[i] = n
+	}
+	return parts, true
+}
+
+// ArchiveName returns the name of the release archive for a platform, as produced by goreleaser
+func ArchiveName(version string, goos string, goarch string) string {
+	arch := goarch
+	switch goarch {
+	case "amd64":
+		arch = "x86_64"
+	case "386":
+		arch = "i386"
+	}
+	format := "tar.gz"
+	if goos == "windows" {
+		format = "zip"
+	}
+	return fmt.Sprintf("turbolift_%s_%s_%s.%s", version, strings.Title(goos), arch, format)
+}
+
+// Install downloads the release archive for the current platform, verifies it against the
+// release checksums and replaces the binary at executablePath with the one it contains
+func Install(release Release, executablePath string) error {
+	archiveName := ArchiveName(release.Version(), runtime.GOOS, runtime.GOARCH)
+	archiveAsset, err := release.asset(archiveName)
+	if err != nil {
+		return err
+	}
+	checksumsAsset, err := release.asset(checksumsAssetName)
+	if err != nil {
+		return err
+	}
+
+	checksums, err := download(checksumsAsset.DownloadURL)
+	if err != nil {
+		return fmt.Errorf("unable to download %s: %w", checksumsAssetName, err)
+	}
+	archive, err := download(archiveAsset.DownloadURL)
+	if err != nil {
+		return fmt.Errorf("unable to download %s: %w", archiveName, err)
+	}
+	if err := verifyChecksum(archiveName, archive, checksums); err != nil {
+		return err
+	}
+
+	binary, err := extractBinary(archiveName, archive)
+	if err != nil {
+		return err
+	}
+	return replaceExecutable(executablePath, binary)
+}
+
+func download(url string) ([]byte, error) {
+	response, err := client.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = response.Body.Close()
+	}()
+
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s responded with %s", url, response.Status)
+	}
+	return ioutil.ReadAll(response.Body)
+}
+
+func verifyChecksum(name string, contents []byte, checksums []byte) error {
+	scanner := bufio.NewScanner(bytes.NewReader(checksums))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 2 || fields[1] != name {
+			continue
+		}
+		sum := sha256.Sum256(contents)
+		if hex.EncodeToString(sum[:]) != strings.ToLower(fields[0]) {
+			return fmt.Errorf("checksum of %s does not match the published checksum", name)
+		}
+		return nil
+	}
+	return fmt.Errorf("no published checksum for %s", name)
+}
+
+func extractBinary(archiveName string, archive []byte) ([]byte, error) {
+	if strings.HasSuffix(archiveName, ".zip") {
+		reader, err := zip.NewReader(bytes.NewReader(archive), int64(len(archive)))
+		if err != nil {
+			return nil, err
+		}
+		for _, file := range reader.File {
+			if file.Name == "turbolift.exe" {
+				contents, err := file.Open()
+				if err != nil {
+					return nil, err
+				}
+				defer func() {
+					_ = contents.Close()
+				}()
+				return ioutil.ReadAll(contents)
+			}
+		}
+		return nil, fmt.Errorf("%s does not contain turbolift.exe", archiveName)
+	}
+
+	gzipReader, err := gzip.NewReader(bytes.NewReader(archive))
+	if err != nil {
+		return nil, err
+	}
+	tarReader := tar.NewReader(gzipReader)
+	for {
+		header, err := tarReader.Next()
+		if errors.Is(err, io.EOF) {
+			return nil, fmt.Errorf("%s does not contain turbolift", archiveName)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if header.Name == "turbolift" {
+			return ioutil.ReadAll(tarReader)
+		}
+	}
+}
+
+// replaceExecutable moves the current executable aside rather than overwriting it,
+// as a running executable cannot be overwritten on Windows
+func replaceExecutable(executablePath string, binary []byte) error {
+	dir := filepath.Dir(executablePath)
+	newPath := filepath.Join(dir, ".turbolift.new")
+	oldPath := filepath.Join(dir, ".turbolift.old")
+
+	if err := ioutil.WriteFile(newPath, binary, 0o755); err != nil {
+		return fmt.Errorf("unable to write the new binary: %w", err)
+	}
+	_ = os.Remove(oldPath)
+	if err := os.Rename(executablePath, oldPath); err != nil {
+		_ = os.Remove(newPath)
+		return fmt.Errorf("unable to replace %s: %w", executablePath, err)
+	}
+	if err := os.Rename(newPath, executablePath); err != nil {
+		_ = os.Rename(oldPath, executablePath)
+		return fmt.Errorf("unable to replace %s: %w", executablePath, err)
+	}
+	// this fails on Windows while the old binary is still running, and is retried on the next upgrade
+	_ = os.Remove(oldPath)
+	return nil
+}
@@ -0,0 +1,162 @@
+/*
+ * Copyright 2021 Skyscanner Limited.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * https://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package upgrade
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestItComparesVersions(t *testing.T) {
+	assert.True(t, IsNewer("1.2.0", "1.1.9"))
+	assert.True(t, IsNewer("v2.0.0", "1.10.3"))
+	assert.True(t, IsNewer("1.10.0", "1.9.0"))
+	assert.False(t, IsNewer("1.2.0", "1.2.0"))
+	assert.False(t, IsNewer("1.1.0", "1.2.0"))
+	assert.False(t, IsNewer("1.2.0", "version-dev"))
+	assert.False(t, IsNewer("latest", "1.2.0"))
+}
+
+func TestItNamesArchivesLikeGoreleaser(t *testing.T) {
+	assert.Equal(t, "turbolift_1.2.0_Linux_x86_64.tar.gz", ArchiveName("1.2.0", "linux", "amd64"))
+	assert.Equal(t, "turbolift_1.2.0_Darwin_arm64.tar.gz", ArchiveName("1.2.0", "darwin", "arm64"))
+	assert.Equal(t, "turbolift_1.2.0_Windows_i386.zip", ArchiveName("1.2.0", "windows", "386"))
+}
+
+func TestItFetchesTheLatestRelease(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = fmt.Fprint(w, `{"tag_name": "v1.2.0", "assets": [{"name": "checksums.txt", "browser_download_url": "https://example.com/checksums.txt"}]}`)
+	}))
+	defer server.Close()
+	latestReleaseURL = server.URL
+
+	release, err := LatestRelease()
+	assert.NoError(t, err)
+	assert.Equal(t, "1.2.0", release.Version())
+	assert.Equal(t, []Asset{{Name: "checksums.txt", DownloadURL: "https://example.com/checksums.txt"}}, release.Assets)
+}
+
+func TestItInstallsAVerifiedRelease(t *testing.T) {
+	archiveName := ArchiveName("1.2.0", runtime.GOOS, runtime.GOARCH)
+	archive := createArchive(archiveName, "new binary")
+	server := serveRelease(archiveName, archive, checksum(archive))
+	defer server.Close()
+
+	executablePath := createExecutable(t)
+	err := Install(releaseOn(server, archiveName), executablePath)
+	assert.NoError(t, err)
+
+	contents, _ := ioutil.ReadFile(executablePath)
+	assert.Equal(t, "new binary", string(contents))
+}
+
+func TestItRefusesToInstallAReleaseWithABadChecksum(t *testing.T) {
+	archiveName := ArchiveName("1.2.0", runtime.GOOS, runtime.GOARCH)
+	archive := createArchive(archiveName, "new binary")
+	server := serveRelease(archiveName, archive, checksum([]byte("something else")))
+	defer server.Close()
+
+	executablePath := createExecutable(t)
+	err := Install(releaseOn(server, archiveName), executablePath)
+	assert.EqualError(t, err, fmt.Sprintf("checksum of %s does not match the published checksum", archiveName))
+
+	contents, _ := ioutil.ReadFile(executablePath)
+	assert.Equal(t, "old binary", string(contents))
+}
+
+func TestItFailsWhenThereIsNoArchiveForThePlatform(t *testing.T) {
+	executablePath := createExecutable(t)
+	err := Install(Release{TagName: "v1.2.0"}, executablePath)
+	assert.Error(t, err)
+
+	contents, _ := ioutil.ReadFile(executablePath)
+	assert.Equal(t, "old binary", string(contents))
+}
+
+func createExecutable(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "turbolift-upgrade")
+	if err != nil {
+		panic(err)
+	}
+	t.Cleanup(func() { _ = os.RemoveAll(dir) })
+
+	executablePath := filepath.Join(dir, "turbolift")
+	if err := ioutil.WriteFile(executablePath, []byte("old binary"), 0o755); err != nil {
+		panic(err)
+	}
+	return executablePath
+}
+
+func serveRelease(archiveName string, archive []byte, archiveChecksum string) *httptest.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/"+archiveName, func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write(archive)
+	})
+	mux.HandleFunc("/checksums.txt", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = fmt.Fprintf(w, "0000  turbolift_1.2.0_Other_arch.tar.gz\n%s  %s\n", archiveChecksum, archiveName)
+	})
+	return httptest.NewServer(mux)
+}
+
+func releaseOn(server *httptest.Server, archiveName string) Release {
+	return Release{
+		TagName: "v1.2.0",
+		Assets: []Asset{
+			{Name: archiveName, DownloadURL: server.URL + "/" + archiveName},
+			{Name: "checksums.txt", DownloadURL: server.URL + "/checksums.txt"},
+		},
+	}
+}
+
+func checksum(contents []byte) string {
+	sum := sha256.Sum256(contents)
+	return hex.EncodeToString(sum[:])
+}
+
+func createArchive(archiveName string, binary string) []byte {
+	buffer := new(bytes.Buffer)
+	if filepath.Ext(archiveName) == ".zip" {
+		writer := zip.NewWriter(buffer)
+		file, _ := writer.Create("turbolift.exe")
+		_, _ = file.Write([]byte(binary))
+		_ = writer.Close()
+		return buffer.Bytes()
+	}
+
+	gzipWriter := gzip.NewWriter(buffer)
+	tarWriter := tar.NewWriter(gzipWriter)
+	_ = tarWriter.WriteHeader(&tar.Header{Name: "README.md", Mode: 0o644, Size: 6})
+	_, _ = tarWriter.Write([]byte("readme"))
+	_ = tarWriter.WriteHeader(&tar.Header{Name: "turbolift", Mode: 0o755, Size: int64(len(binary))})
+	_, _ = tarWriter.Write([]byte(binary))
+	_ = tarWriter.Close()
+	_ = gzipWriter.Close()
+	return buffer.Bytes()
+}
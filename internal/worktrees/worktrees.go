@@ -0,0 +1,91 @@
+/*
+ * Copyright 2021 Skyscanner Limited.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * https://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package worktrees
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/skyscanner/turbolift/internal/campaign"
+	"github.com/skyscanner/turbolift/internal/git"
+)
+
+// DefaultDir is where shared clones are kept unless another directory is given, shared by every campaign of the user,
+// i.e. ~/.cache/turbolift/repos on Linux
+func DefaultDir() string {
+	cacheHome, err := os.UserCacheDir()
+	if err != nil {
+		home, _ := os.UserHomeDir()
+		cacheHome = filepath.Join(home, ".cache")
+	}
+	return filepath.Join(cacheHome, "turbolift", "repos")
+}
+
+// Store holds a single bare clone of each repository, which the working copies of every campaign against the
+// repository are added to as working trees, so that its history is only stored once
+type Store struct {
+	Dir string
+}
+
+// Path returns the location of a repository's shared clone within the store
+func (s Store) Path(repo campaign.Repo) string {
+	return filepath.Join(s.Dir, repo.HostName(), repo.OrgName, repo.RepoName+".git")
+}
+
+// AddWorkingCopy creates the campaign's branch from the latest default branch of a repository and checks it out at
+// the repository's working copy path, cloning the repository into the store if this is the first campaign to use it
+func (s Store) AddWorkingCopy(output io.Writer, g git.Git, repo campaign.Repo, branchName string, gitFlags ...string) error {
+	sharedPath, err := filepath.Abs(s.Path(repo))
+	if err != nil {
+		return err
+	}
+
+	if _, err := os.Stat(sharedPath); os.IsNotExist(err) {
+		if err := os.MkdirAll(filepath.Dir(sharedPath), 0o755); err != nil {
+			return fmt.Errorf("unable to create shared clone directory: %w", err)
+		}
+		if err := g.CloneShared(output, repo.CloneURL(), sharedPath, gitFlags...); err != nil {
+			// leave no partial clone behind to be mistaken for a complete one next time
+			_ = os.RemoveAll(sharedPath)
+			return err
+		}
+	}
+
+	if err := g.UpdateShared(output, sharedPath); err != nil {
+		return err
+	}
+
+	workingCopyPath, err := filepath.Abs(repo.FullRepoPath())
+	if err != nil {
+		return err
+	}
+	return g.AddWorktreeBranch(output, sharedPath, workingCopyPath, branchName, "origin/HEAD")
+}
+
+// RemoveWorkingCopy deletes a working copy along with any changes in it. Working copies added to a shared clone are
+// removed through git, so that the shared clone does not go on counting the campaign branch as checked out there.
+func RemoveWorkingCopy(output io.Writer, g git.Git, path string) error {
+	// the .git of a working tree is a file pointing at the shared clone, rather than a directory
+	if info, err := os.Stat(filepath.Join(path, ".git")); err == nil && info.Mode().IsRegular() {
+		if err := g.RemoveWorktree(output, path, path); err == nil {
+			return nil
+		}
+		// the shared clone may have gone, in which case there is nothing to tell it and the directory can just go
+	}
+	return os.RemoveAll(path)
+}
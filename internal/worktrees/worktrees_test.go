@@ -0,0 +1,155 @@
+/*
+ * Copyright 2021 Skyscanner Limited.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * https://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package worktrees
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/skyscanner/turbolift/internal/campaign"
+	"github.com/skyscanner/turbolift/internal/git"
+	"github.com/skyscanner/turbolift/internal/testsupport"
+)
+
+var repo = campaign.Repo{OrgName: "org", RepoName: "repo1", FullRepoName: "org/repo1"}
+
+func TestItClonesRepositoriesOnFirstUse(t *testing.T) {
+	store := Store{Dir: t.TempDir()}
+	testsupport.PrepareTempCampaign(false, "org/repo1")
+	fakeGit := git.NewAlwaysSucceedsFakeGit()
+
+	err := store.AddWorkingCopy(&bytes.Buffer{}, fakeGit, repo, "campaign", "--filter=blob:none")
+	assert.NoError(t, err)
+
+	sharedPath := filepath.Join(store.Dir, "github.com", "org", "repo1.git")
+	fakeGit.AssertCalledWith(t, [][]string{
+		{"cloneShared", "https://github.com/org/repo1.git", sharedPath, "--filter=blob:none"},
+		{"updateShared", sharedPath},
+		{"addWorktreeBranch", sharedPath, workingCopyPath(), "campaign", "origin/HEAD"},
+	})
+}
+
+func TestItReusesSharedClones(t *testing.T) {
+	store := Store{Dir: t.TempDir()}
+	assert.NoError(t, os.MkdirAll(store.Path(repo), 0o755))
+	testsupport.PrepareTempCampaign(false, "org/repo1")
+	fakeGit := git.NewAlwaysSucceedsFakeGit()
+
+	err := store.AddWorkingCopy(&bytes.Buffer{}, fakeGit, repo, "campaign")
+	assert.NoError(t, err)
+
+	sharedPath := store.Path(repo)
+	fakeGit.AssertCalledWith(t, [][]string{
+		{"updateShared", sharedPath},
+		{"addWorktreeBranch", sharedPath, workingCopyPath(), "campaign", "origin/HEAD"},
+	})
+}
+
+func TestItRemovesPartialSharedClones(t *testing.T) {
+	store := Store{Dir: t.TempDir()}
+	testsupport.PrepareTempCampaign(false, "org/repo1")
+	fakeGit := git.NewFakeGit(func(_ io.Writer, call []string) (bool, error) {
+		// git leaves a partial clone behind when the clone is interrupted
+		_ = os.MkdirAll(call[2], 0o755)
+		return false, errors.New("synthetic error")
+	})
+
+	err := store.AddWorkingCopy(&bytes.Buffer{}, fakeGit, repo, "campaign")
+	assert.Error(t, err)
+
+	_, err = os.Stat(store.Path(repo))
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestItRemovesWorkingTreesThroughGit(t *testing.T) {
+	testsupport.PrepareTempCampaign(false, "org/repo1")
+	fakeGit := git.NewAlwaysSucceedsFakeGit()
+	assert.NoError(t, os.MkdirAll("work/org/repo1", 0o755))
+	assert.NoError(t, ioutil.WriteFile("work/org/repo1/.git", []byte("gitdir: /shared/repo1.git/worktrees/repo1\n"), 0o644))
+
+	assert.NoError(t, RemoveWorkingCopy(&bytes.Buffer{}, fakeGit, "work/org/repo1"))
+
+	fakeGit.AssertCalledWith(t, [][]string{
+		{"removeWorktree", "work/org/repo1"},
+	})
+}
+
+func TestItDeletesOtherWorkingCopies(t *testing.T) {
+	testsupport.PrepareTempCampaign(true, "org/repo1")
+	fakeGit := git.NewAlwaysSucceedsFakeGit()
+	assert.NoError(t, os.MkdirAll("work/org/repo1/.git", 0o755))
+
+	assert.NoError(t, RemoveWorkingCopy(&bytes.Buffer{}, fakeGit, "work/org/repo1"))
+
+	_, err := os.Stat("work/org/repo1")
+	assert.True(t, os.IsNotExist(err))
+	fakeGit.AssertCalledWith(t, [][]string{})
+}
+
+// A working copy which is removed, however it was removed, must be able to be added again to the same shared clone
+func TestItAddsWorkingTreesAgainAfterTheyAreRemoved(t *testing.T) {
+	g := git.NewRealGit()
+	output := &bytes.Buffer{}
+	dir := t.TempDir()
+	source := filepath.Join(dir, "source")
+	runGit(t, dir, "init", "--quiet", source)
+	runGit(t, source, "commit", "--quiet", "--allow-empty", "-m", "Initial commit")
+	shared := filepath.Join(dir, "shared.git")
+	assert.NoError(t, g.CloneShared(output, source, shared))
+	assert.NoError(t, g.UpdateShared(output, shared))
+	workingCopy := filepath.Join(dir, "work", "org", "repo1")
+
+	assert.NoError(t, g.AddWorktreeBranch(output, shared, workingCopy, "campaign", "origin/HEAD"))
+	assert.NoError(t, RemoveWorkingCopy(output, g, workingCopy))
+	assert.Equal(t, 1, strings.Count(gitOutput(t, shared, "worktree", "list"), "\n"))
+
+	assert.NoError(t, g.AddWorktreeBranch(output, shared, workingCopy, "campaign", "origin/HEAD"))
+	// as when an older turbolift, or the user, deleted the directory without telling git
+	assert.NoError(t, os.RemoveAll(workingCopy))
+
+	assert.NoError(t, g.AddWorktreeBranch(output, shared, workingCopy, "campaign", "origin/HEAD"), output.String())
+}
+
+func runGit(t *testing.T, dir string, args ...string) {
+	gitOutput(t, dir, args...)
+}
+
+func gitOutput(t *testing.T, dir string, args ...string) string {
+	cmd := exec.Command("git", append([]string{"-c", "user.name=Turbolift", "-c", "user.email=turbolift@example.com"}, args...)...)
+	cmd.Dir = dir
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("git %s failed: %v\n%s", strings.Join(args, " "), err, out)
+	}
+	return string(out)
+}
+
+func workingCopyPath() string {
+	path, err := filepath.Abs("work/org/repo1")
+	if err != nil {
+		panic(err)
+	}
+	return path
+}
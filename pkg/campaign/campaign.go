@@ -0,0 +1,126 @@
+/*
+ * Copyright 2021 Skyscanner Limited.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * https://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+// Package campaign reads turbolift campaigns, for tools which embed turbolift's engine rather than running the CLI.
+package campaign
+
+import "github.com/skyscanner/turbolift/internal/campaign"
+
+// Repo is a repository in a campaign
+type Repo struct {
+	// Host is the host of the repository when the repo file gives one, or empty for the default host
+	Host         string
+	OrgName      string
+	RepoName     string
+	FullRepoName string
+	// BaseBranch is the branch PRs are raised against, or empty if it is the repository's default branch
+	BaseBranch string
+	// Group is the ordering group the repository is listed under in the repo file, or empty if it is not under one
+	Group string
+	// Priority is given after the repository in the repo file, and puts it ahead of lower priority repositories
+	Priority Priority
+}
+
+// Priority decides which repositories are worked on first, so that the most important ones are done if a campaign is
+// cut short
+type Priority = campaign.Priority
+
+const (
+	PriorityLow    = campaign.PriorityLow
+	PriorityNormal = campaign.PriorityNormal
+	PriorityHigh   = campaign.PriorityHigh
+)
+
+// Campaign is a campaign's name, which is also the name of its branch, its repositories and its PR title and
+// description
+type Campaign struct {
+	Name    string
+	Repos   []Repo
+	PrTitle string
+	PrBody  string
+}
+
+// Options gives the files a campaign is read from
+type Options struct {
+	RepoFilename          string
+	PrDescriptionFilename string
+	// Unfiltered keeps every repository, ignoring the CLI's topic and results filters
+	Unfiltered bool
+}
+
+// FullRepoPath returns the path of the repository's working copy, relative to the campaign directory
+func (r Repo) FullRepoPath() string {
+	return r.internal().FullRepoPath()
+}
+
+// HostName returns the host of the repository, which is the one gh uses by default unless the repo file gives another
+func (r Repo) HostName() string {
+	return r.internal().HostName()
+}
+
+// CloneURL returns the HTTPS URL which git can clone the repository from
+func (r Repo) CloneURL() string {
+	return r.internal().CloneURL()
+}
+
+func (r Repo) internal() campaign.Repo {
+	return campaign.Repo{
+		Host:         r.Host,
+		OrgName:      r.OrgName,
+		RepoName:     r.RepoName,
+		FullRepoName: r.FullRepoName,
+		BaseBranch:   r.BaseBranch,
+		Group:        r.Group,
+		Priority:     r.Priority,
+	}
+}
+
+// NewOptions returns the options the CLI uses by default: the repositories in repos.txt, and the PR title and
+// description in README.md
+func NewOptions() *Options {
+	defaults := campaign.NewCampaignOptions()
+	return &Options{
+		RepoFilename:          defaults.RepoFilename,
+		PrDescriptionFilename: defaults.PrDescriptionFilename,
+		Unfiltered:            defaults.Unfiltered,
+	}
+}
+
+// Open reads the campaign in the current directory, as the CLI does. The working copies of its repositories are
+// relative to the same directory.
+func Open(options *Options) (*Campaign, error) {
+	c, err := campaign.OpenCampaign(&campaign.CampaignOptions{
+		RepoFilename:          options.RepoFilename,
+		PrDescriptionFilename: options.PrDescriptionFilename,
+		Unfiltered:            options.Unfiltered,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	opened := &Campaign{Name: c.Name, PrTitle: c.PrTitle, PrBody: c.PrBody}
+	for _, repo := range c.Repos {
+		opened.Repos = append(opened.Repos, Repo{
+			Host:         repo.Host,
+			OrgName:      repo.OrgName,
+			RepoName:     repo.RepoName,
+			FullRepoName: repo.FullRepoName,
+			BaseBranch:   repo.BaseBranch,
+			Group:        repo.Group,
+			Priority:     repo.Priority,
+		})
+	}
+	return opened, nil
+}
@@ -0,0 +1,117 @@
+/*
+ * Copyright 2021 Skyscanner Limited.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * https://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+// Package engine runs work in each repository of a campaign, as turbolift's commands do, for tools which embed
+// turbolift's engine rather than running the CLI.
+package engine
+
+import (
+	"context"
+	"io"
+	"time"
+
+	internalcampaign "github.com/skyscanner/turbolift/internal/campaign"
+	"github.com/skyscanner/turbolift/internal/engine"
+	"github.com/skyscanner/turbolift/pkg/campaign"
+)
+
+// ErrSkipped can be returned, or wrapped, by a RepoFunc to count its repository as skipped rather than failed
+var ErrSkipped = engine.ErrSkipped
+
+// RepoFunc does the work for a single repository, writing the output of any git, gh or other processes to output
+type RepoFunc func(ctx context.Context, output io.Writer, repo campaign.Repo) error
+
+// Options controls how ForEachRepo works through the repositories
+type Options struct {
+	// Output receives the output of the work in every repository. It is discarded if nil.
+	Output io.Writer
+	// RequireWorkingCopy skips repositories which have not been cloned, rather than doing the work for them
+	RequireWorkingCopy bool
+	// Sleep is a pause between repositories, to spread the load on shared infrastructure such as CI
+	Sleep time.Duration
+}
+
+// Failure is a repository where the work failed
+type Failure struct {
+	Repo campaign.Repo
+	Err  error
+}
+
+// Result is what happened in each repository
+type Result struct {
+	Done    []campaign.Repo
+	Skipped []campaign.Repo
+	Failed  []Failure
+	// NotRun are the repositories which were not reached, because the context was cancelled
+	NotRun []campaign.Repo
+}
+
+// Err returns an error listing the repositories where the work failed or was not run, or nil if there are none
+func (r Result) Err() error {
+	result := engine.Result{NotRun: make([]internalcampaign.Repo, len(r.NotRun))}
+	for _, failure := range r.Failed {
+		result.Failed = append(result.Failed, engine.Failure{Repo: internalRepo(failure.Repo), Err: failure.Err})
+	}
+	return result.Err()
+}
+
+// ForEachRepo does the work in each repository of the campaign in turn, carrying on past failures, until all have been
+// done or the context is cancelled. It works through the repositories as the CLI's commands do.
+func ForEachRepo(ctx context.Context, c *campaign.Campaign, options Options, work RepoFunc) Result {
+	byName := map[string]campaign.Repo{}
+	var repos []internalcampaign.Repo
+	for _, repo := range c.Repos {
+		byName[repo.FullRepoName] = repo
+		repos = append(repos, internalRepo(repo))
+	}
+
+	internalOptions := engine.Options{
+		Output:             options.Output,
+		RequireWorkingCopy: options.RequireWorkingCopy,
+		Sleep:              options.Sleep,
+	}
+	result := engine.ForEachRepo(ctx, repos, internalOptions, func(ctx context.Context, output io.Writer, repo internalcampaign.Repo) error {
+		return work(ctx, output, byName[repo.FullRepoName])
+	})
+
+	publicRepos := func(repos []internalcampaign.Repo) []campaign.Repo {
+		var converted []campaign.Repo
+		for _, repo := range repos {
+			converted = append(converted, byName[repo.FullRepoName])
+		}
+		return converted
+	}
+	converted := Result{
+		Done:    publicRepos(result.Done),
+		Skipped: publicRepos(result.Skipped),
+		NotRun:  publicRepos(result.NotRun),
+	}
+	for _, failure := range result.Failed {
+		converted.Failed = append(converted.Failed, Failure{Repo: byName[failure.Repo.FullRepoName], Err: failure.Err})
+	}
+	return converted
+}
+
+func internalRepo(repo campaign.Repo) internalcampaign.Repo {
+	return internalcampaign.Repo{
+		Host:         repo.Host,
+		OrgName:      repo.OrgName,
+		RepoName:     repo.RepoName,
+		FullRepoName: repo.FullRepoName,
+		BaseBranch:   repo.BaseBranch,
+		Group:        repo.Group,
+		Priority:     repo.Priority,
+	}
+}
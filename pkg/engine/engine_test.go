@@ -0,0 +1,96 @@
+/*
+ * Copyright 2021 Skyscanner Limited.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * https://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package engine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/skyscanner/turbolift/internal/testsupport"
+	"github.com/skyscanner/turbolift/pkg/campaign"
+)
+
+func TestItDoesTheWorkInEachRepoOfTheCampaign(t *testing.T) {
+	testsupport.PrepareTempCampaign(true, "org/repo1", "org/repo2", "mygitserver.com/org/repo3")
+	c, err := campaign.Open(campaign.NewOptions())
+	assert.NoError(t, err)
+
+	var paths []string
+	result := ForEachRepo(context.Background(), c, Options{}, func(_ context.Context, output io.Writer, repo campaign.Repo) error {
+		paths = append(paths, repo.FullRepoPath())
+		switch repo.RepoName {
+		case "repo1":
+			return errors.New("synthetic error")
+		case "repo2":
+			return fmt.Errorf("nothing to do: %w", ErrSkipped)
+		}
+		return nil
+	})
+
+	assert.Equal(t, []string{"work/org/repo1", "work/org/repo2", "work/org/repo3"}, paths)
+	assert.Equal(t, []campaign.Repo{c.Repos[2]}, result.Done)
+	assert.Equal(t, "mygitserver.com", result.Done[0].HostName())
+	assert.Equal(t, []campaign.Repo{c.Repos[1]}, result.Skipped)
+	assert.Equal(t, []Failure{{Repo: c.Repos[0], Err: errors.New("synthetic error")}}, result.Failed)
+	assert.EqualError(t, result.Err(), "org/repo1: synthetic error")
+}
+
+func TestItStopsWhenTheContextIsCancelled(t *testing.T) {
+	testsupport.PrepareTempCampaign(true, "org/repo1", "org/repo2")
+	c, err := campaign.Open(campaign.NewOptions())
+	assert.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	result := ForEachRepo(ctx, c, Options{}, func(context.Context, io.Writer, campaign.Repo) error {
+		cancel()
+		return nil
+	})
+
+	assert.Equal(t, []campaign.Repo{c.Repos[0]}, result.Done)
+	assert.Equal(t, []campaign.Repo{c.Repos[1]}, result.NotRun)
+	assert.EqualError(t, result.Err(), "1 repositories were not run")
+}
+
+func TestItPassesTheGroupAndPriorityOfEachRepoThrough(t *testing.T) {
+	testsupport.PrepareTempCampaign(false)
+	testsupport.CreateAnotherRepoFile("repos.txt", "[canary]", "org/repo1 priority=high", "org/repo2")
+	c, err := campaign.Open(campaign.NewOptions())
+	assert.NoError(t, err)
+
+	var repos []campaign.Repo
+	ForEachRepo(context.Background(), c, Options{}, func(_ context.Context, _ io.Writer, repo campaign.Repo) error {
+		repos = append(repos, repo)
+		return nil
+	})
+
+	assert.Equal(t, "canary", repos[0].Group)
+	assert.Equal(t, campaign.PriorityHigh, repos[0].Priority)
+	assert.Equal(t, campaign.PriorityNormal, repos[1].Priority)
+}
+
+func TestTheErrOfAResultIsDerivedFromItsFailures(t *testing.T) {
+	result := Result{
+		Failed: []Failure{{Repo: campaign.Repo{FullRepoName: "org/repo1"}, Err: errors.New("synthetic error")}},
+		NotRun: []campaign.Repo{{FullRepoName: "org/repo2"}},
+	}
+	assert.EqualError(t, result.Err(), "org/repo1: synthetic error; 1 repositories were not run")
+	assert.NoError(t, Result{Done: []campaign.Repo{{FullRepoName: "org/repo3"}}}.Err())
+}
@@ -0,0 +1,181 @@
+/*
+ * Copyright 2021 Skyscanner Limited.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * https://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+// Package provider gives access to the hosting provider and git operations turbolift uses, for tools which embed
+// turbolift's engine rather than running the CLI.
+package provider
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/skyscanner/turbolift/internal/git"
+	"github.com/skyscanner/turbolift/internal/github"
+)
+
+// Provider is the hosting provider of a campaign's repositories, through which they are cloned and their PRs managed.
+// Its methods run in the working copy at workingDir, and write the output of the tools they run to output.
+type Provider interface {
+	Clone(output io.Writer, workingDir string, fullRepoName string) error
+	ForkAndClone(output io.Writer, workingDir string, fullRepoName string) error
+	// CreatePullRequest raises a PR from the current branch, returning false if the provider did not create one
+	CreatePullRequest(output io.Writer, workingDir string, pr PullRequest) (didCreate bool, err error)
+	// GetPR returns the PR from branchName, or a *NoPRFoundError if there is none
+	GetPR(output io.Writer, workingDir string, branchName string) (*PrStatus, error)
+	ClosePullRequest(output io.Writer, workingDir string, branchName string, comment string) error
+	CommentOnPullRequest(output io.Writer, workingDir string, branchName string, body string) error
+	UpdatePRDescription(output io.Writer, workingDir string, branchName string, title string, body string) error
+	GetDefaultBranchName(output io.Writer, workingDir string, fullRepoName string) (string, error)
+	// ListOrgRepos returns the full names of the unarchived repositories in an organisation, which may be given as
+	// host/org for one on another host
+	ListOrgRepos(output io.Writer, workingDir string, orgName string) ([]string, error)
+}
+
+// Git runs git in the working copies of a campaign
+type Git interface {
+	Checkout(output io.Writer, workingDir string, branchName string) error
+	Commit(output io.Writer, workingDir string, message string) error
+	Push(output io.Writer, workingDir string, remote string, branchName string) error
+	Pull(output io.Writer, workingDir string, remote string, branchName string) error
+	IsRepoChanged(output io.Writer, workingDir string) (bool, error)
+}
+
+// PullRequest describes a PR to be created
+type PullRequest struct {
+	Title string
+	Body  string
+	// UpstreamRepo is the repository to raise the PR in, when it is raised from a fork
+	UpstreamRepo string
+	IsDraft      bool
+	Labels       []string
+	Reviewers    []string
+	Assignees    []string
+	// Head is the branch to raise the PR from, as BRANCH or OWNER:BRANCH for a fork, rather than the current branch
+	Head string
+	// Base is the branch to raise the PR against, rather than the repository's default branch
+	Base string
+}
+
+// PrStatus is the state of an existing PR
+type PrStatus struct {
+	Number         int
+	Url            string
+	Title          string
+	HeadRefName    string
+	State          string
+	Closed         bool
+	Mergeable      string
+	ReviewDecision string
+	CreatedAt      time.Time
+	UpdatedAt      time.Time
+}
+
+// NoPRFoundError is returned when there is no PR from a branch
+type NoPRFoundError struct {
+	Path       string
+	BranchName string
+}
+
+func (e *NoPRFoundError) Error() string {
+	return fmt.Sprintf("no PR found for %s and branch %s", e.Path, e.BranchName)
+}
+
+// NewGitHub returns the provider for GitHub, which uses gh and honours GH_HOST and gh's own configuration as the CLI
+// does
+func NewGitHub() Provider {
+	return &gitHubProvider{gh: github.NewGitHub()}
+}
+
+// NewCachingGitHub returns a provider which caches GitHub's responses in the campaign directory, as the CLI does
+func NewCachingGitHub() Provider {
+	return &gitHubProvider{gh: github.NewCachingGitHub(github.NewGitHub())}
+}
+
+// NewGit returns the Git which runs git itself
+func NewGit() Git {
+	return git.NewRealGit()
+}
+
+// gitHubProvider adapts the GitHub the commands use to Provider
+type gitHubProvider struct {
+	gh github.GitHub
+}
+
+func (p *gitHubProvider) Clone(output io.Writer, workingDir string, fullRepoName string) error {
+	return p.gh.Clone(output, workingDir, fullRepoName)
+}
+
+func (p *gitHubProvider) ForkAndClone(output io.Writer, workingDir string, fullRepoName string) error {
+	return p.gh.ForkAndClone(output, workingDir, fullRepoName)
+}
+
+func (p *gitHubProvider) CreatePullRequest(output io.Writer, workingDir string, pr PullRequest) (bool, error) {
+	return p.gh.CreatePullRequest(output, workingDir, github.PullRequest{
+		Title:        pr.Title,
+		Body:         pr.Body,
+		UpstreamRepo: pr.UpstreamRepo,
+		IsDraft:      pr.IsDraft,
+		Labels:       pr.Labels,
+		Reviewers:    pr.Reviewers,
+		Assignees:    pr.Assignees,
+		Head:         pr.Head,
+		Base:         pr.Base,
+	})
+}
+
+func (p *gitHubProvider) GetPR(output io.Writer, workingDir string, branchName string) (*PrStatus, error) {
+	pr, err := p.gh.GetPR(output, workingDir, branchName)
+	var noPRFoundError *github.NoPRFoundError
+	if errors.As(err, &noPRFoundError) {
+		return nil, &NoPRFoundError{Path: noPRFoundError.Path, BranchName: noPRFoundError.BranchName}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &PrStatus{
+		Number:         pr.Number,
+		Url:            pr.Url,
+		Title:          pr.Title,
+		HeadRefName:    pr.HeadRefName,
+		State:          pr.State,
+		Closed:         pr.Closed,
+		Mergeable:      pr.Mergeable,
+		ReviewDecision: pr.ReviewDecision,
+		CreatedAt:      pr.CreatedAt,
+		UpdatedAt:      pr.UpdatedAt,
+	}, nil
+}
+
+func (p *gitHubProvider) ClosePullRequest(output io.Writer, workingDir string, branchName string, comment string) error {
+	return p.gh.ClosePullRequest(output, workingDir, branchName, comment)
+}
+
+func (p *gitHubProvider) CommentOnPullRequest(output io.Writer, workingDir string, branchName string, body string) error {
+	return p.gh.CommentOnPullRequest(output, workingDir, branchName, body)
+}
+
+func (p *gitHubProvider) UpdatePRDescription(output io.Writer, workingDir string, branchName string, title string, body string) error {
+	return p.gh.UpdatePRDescription(output, workingDir, branchName, title, body)
+}
+
+func (p *gitHubProvider) GetDefaultBranchName(output io.Writer, workingDir string, fullRepoName string) (string, error) {
+	return p.gh.GetDefaultBranchName(output, workingDir, fullRepoName)
+}
+
+func (p *gitHubProvider) ListOrgRepos(output io.Writer, workingDir string, orgName string) ([]string, error) {
+	return p.gh.ListOrgRepos(output, workingDir, orgName)
+}
@@ -0,0 +1,61 @@
+/*
+ * Copyright 2021 Skyscanner Limited.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * https://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package provider
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/skyscanner/turbolift/internal/github"
+)
+
+func TestItReturnsThePRFromGitHub(t *testing.T) {
+	fakeGitHub := github.NewFakeGitHub(nil, func(workingDir string) (interface{}, error) {
+		return &github.PrStatus{Number: 42, State: "OPEN", Url: "https://github.com/org/repo1/pull/42"}, nil
+	})
+	p := &gitHubProvider{gh: fakeGitHub}
+
+	pr, err := p.GetPR(bytes.NewBufferString(""), "work/org/repo1", "campaign")
+	assert.NoError(t, err)
+	assert.Equal(t, &PrStatus{Number: 42, State: "OPEN", Url: "https://github.com/org/repo1/pull/42"}, pr)
+}
+
+func TestItReturnsItsOwnErrorWhenThereIsNoPR(t *testing.T) {
+	fakeGitHub := github.NewFakeGitHub(nil, func(workingDir string) (interface{}, error) {
+		return nil, &github.NoPRFoundError{Path: workingDir, BranchName: "campaign"}
+	})
+	p := &gitHubProvider{gh: fakeGitHub}
+
+	_, err := p.GetPR(bytes.NewBufferString(""), "work/org/repo1", "campaign")
+	var noPRFoundError *NoPRFoundError
+	assert.True(t, errors.As(err, &noPRFoundError))
+	assert.Equal(t, &NoPRFoundError{Path: "work/org/repo1", BranchName: "campaign"}, noPRFoundError)
+}
+
+func TestItRaisesThePullRequestThroughGitHub(t *testing.T) {
+	fakeGitHub := github.NewAlwaysSucceedsFakeGitHub()
+	p := &gitHubProvider{gh: fakeGitHub}
+
+	didCreate, err := p.CreatePullRequest(bytes.NewBufferString(""), "work/org/repo1", PullRequest{Title: "PR title", Body: "PR body"})
+	assert.NoError(t, err)
+	assert.True(t, didCreate)
+	fakeGitHub.AssertCalledWith(t, [][]string{
+		{"work/org/repo1", "PR title"},
+	})
+}